@@ -0,0 +1,299 @@
+package boom
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AggregatingBloomFilter is a Bloom filter for concurrent, add-dominated
+// workloads which eliminates write contention. Each writer registers a
+// LocalShard, a private Bloom filter which only it adds to, so adds never
+// contend with each other. Tests consult the main filter and then every
+// shard, and Fold periodically merges the shards into the main filter so
+// tests stay fast. The filter hashes without shared state, so it's safe for
+// concurrent use.
+//
+// Since a Bloom filter is the OR of its elements' bits, the combination of
+// the main filter and its shards answers exactly as a single filter with all
+// the elements would.
+type AggregatingBloomFilter struct {
+	main   *BloomFilter         // folded filter
+	mu     sync.RWMutex         // guards main
+	shards map[*LocalShard]bool // registered shards
+	regMu  sync.RWMutex         // guards shards, acquired before mu
+	n      uint                 // capacity of each filter
+	fpRate float64              // target false-positive rate
+}
+
+// LocalShard is a private shard of an AggregatingBloomFilter registered by a
+// single writer. Adds only touch the shard, so writers holding their own
+// shards never contend. A shard must not be shared between goroutines.
+type LocalShard struct {
+	shard  *BloomFilter            // elements added since the last fold
+	mu     sync.Mutex              // guards shard against folding
+	parent *AggregatingBloomFilter // filter the shard belongs to
+}
+
+// NewAggregatingBloomFilter creates a new AggregatingBloomFilter optimized to
+// store n items with a specified target false-positive rate.
+func NewAggregatingBloomFilter(n uint, fpRate float64) *AggregatingBloomFilter {
+	return &AggregatingBloomFilter{
+		main:   NewBloomFilter(n, fpRate),
+		shards: make(map[*LocalShard]bool),
+		n:      n,
+		fpRate: fpRate,
+	}
+}
+
+// NewAggregatingBloomFilterE is like NewAggregatingBloomFilter but returns an
+// error if n is zero, fpRate isn't between 0 and 1, or the filter would be too
+// large to address.
+func NewAggregatingBloomFilterE(n uint, fpRate float64) (*AggregatingBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+	return NewAggregatingBloomFilter(n, fpRate), nil
+}
+
+// Shard registers and returns a new LocalShard for a writer to add to.
+func (a *AggregatingBloomFilter) Shard() *LocalShard {
+	s := &LocalShard{shard: NewBloomFilter(a.n, a.fpRate), parent: a}
+	a.regMu.Lock()
+	a.shards[s] = true
+	a.regMu.Unlock()
+	return s
+}
+
+// Shards returns the number of registered shards.
+func (a *AggregatingBloomFilter) Shards() uint {
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+	return uint(len(a.shards))
+}
+
+// Count returns the number of items added to the filter and its shards.
+func (a *AggregatingBloomFilter) Count() uint {
+	a.mu.RLock()
+	count := a.main.count
+	a.mu.RUnlock()
+
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+	for s := range a.shards {
+		s.mu.Lock()
+		count += s.shard.count
+		s.mu.Unlock()
+	}
+	return count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. Elements added to any shard are members, whether or
+// not they have been folded. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (a *AggregatingBloomFilter) Test(data []byte) bool {
+	sum := fnv64(data)
+	return a.TestHash(uint32(sum), uint32(sum>>32))
+}
+
+// TestHash is equivalent to Test for data whose 64-bit FNV-1 hash has the
+// lower and upper 32 bits provided. It avoids hashing data twice when the
+// hash has already been computed.
+func (a *AggregatingBloomFilter) TestHash(lower, upper uint32) bool {
+	a.mu.RLock()
+	member := a.main.testKernel(lower, upper)
+	a.mu.RUnlock()
+	if member {
+		return true
+	}
+
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+	for s := range a.shards {
+		s.mu.Lock()
+		member = s.shard.testKernel(lower, upper)
+		s.mu.Unlock()
+		if member {
+			return true
+		}
+	}
+	return false
+}
+
+// TestString is equivalent to Test for the bytes of the string, without
+// allocating.
+func (a *AggregatingBloomFilter) TestString(data string) bool {
+	sum := fnv64String(data)
+	return a.TestHash(uint32(sum), uint32(sum>>32))
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element,
+// but takes each lock once rather than once per element.
+func (a *AggregatingBloomFilter) TestMany(data [][]byte) []bool {
+	var (
+		results = make([]bool, len(data))
+		lowers  = make([]uint32, len(data))
+		uppers  = make([]uint32, len(data))
+		pending = make([]int, 0, len(data))
+	)
+	a.mu.RLock()
+	for i, element := range data {
+		sum := fnv64(element)
+		lowers[i], uppers[i] = uint32(sum), uint32(sum>>32)
+		if results[i] = a.main.testKernel(lowers[i], uppers[i]); !results[i] {
+			pending = append(pending, i)
+		}
+	}
+	a.mu.RUnlock()
+
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+	for s := range a.shards {
+		if len(pending) == 0 {
+			break
+		}
+		s.mu.Lock()
+		remaining := pending[:0]
+		for _, i := range pending {
+			if results[i] = s.shard.testKernel(lowers[i], uppers[i]); !results[i] {
+				remaining = append(remaining, i)
+			}
+		}
+		s.mu.Unlock()
+		pending = remaining
+	}
+	return results
+}
+
+// Fold merges every shard into the main filter and clears the shards. It
+// should be called periodically so that tests don't have to consult many
+// shards. Returns the number of items folded.
+func (a *AggregatingBloomFilter) Fold() uint {
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+
+	folded := uint(0)
+	for s := range a.shards {
+		folded += s.fold()
+	}
+	return folded
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including its shards.
+func (a *AggregatingBloomFilter) ByteSize() uint {
+	a.regMu.RLock()
+	defer a.regMu.RUnlock()
+	a.mu.RLock()
+	size := a.main.ByteSize()
+	a.mu.RUnlock()
+	for s := range a.shards {
+		size += s.shard.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the AggregatingBloomFilter for logging
+// and debugging.
+func (a *AggregatingBloomFilter) String() string {
+	shards := a.Shards()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return fmt.Sprintf("AggregatingBloomFilter{m=%d k=%d shards=%d main=%d}",
+		a.main.m, a.main.k, shards, a.main.count)
+}
+
+// Add will add the data to the shard. It returns the shard to allow for
+// chaining.
+func (s *LocalShard) Add(data []byte) Filter {
+	sum := fnv64(data)
+	return s.AddHash(uint32(sum), uint32(sum>>32))
+}
+
+// AddHash is equivalent to Add for data whose 64-bit FNV-1 hash has the lower
+// and upper 32 bits provided. It returns the shard to allow for chaining.
+func (s *LocalShard) AddHash(lower, upper uint32) Filter {
+	s.mu.Lock()
+	s.shard.addKernel(lower, upper)
+	s.mu.Unlock()
+	return s
+}
+
+// AddString is equivalent to Add for the bytes of the string, without
+// allocating. It returns the shard to allow for chaining.
+func (s *LocalShard) AddString(data string) Filter {
+	sum := fnv64String(data)
+	return s.AddHash(uint32(sum), uint32(sum>>32))
+}
+
+// AddMany will add each element of data to the shard, taking its lock once.
+// It returns the shard to allow for chaining.
+func (s *LocalShard) AddMany(data [][]byte) Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, element := range data {
+		sum := fnv64(element)
+		s.shard.addKernel(uint32(sum), uint32(sum>>32))
+	}
+	return s
+}
+
+// Test will test for membership of the data in the AggregatingBloomFilter the
+// shard belongs to.
+func (s *LocalShard) Test(data []byte) bool {
+	return s.parent.Test(data)
+}
+
+// TestMany tests the membership of each element of data in the
+// AggregatingBloomFilter the shard belongs to.
+func (s *LocalShard) TestMany(data [][]byte) []bool {
+	return s.parent.TestMany(data)
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (s *LocalShard) TestAndAdd(data []byte) bool {
+	sum := fnv64(data)
+	lower, upper := uint32(sum), uint32(sum>>32)
+	member := s.parent.TestHash(lower, upper)
+	s.AddHash(lower, upper)
+	return member
+}
+
+// Close folds the shard into the main filter and unregisters it. The shard
+// must not be used afterward.
+func (s *LocalShard) Close() {
+	a := s.parent
+	a.regMu.Lock()
+	defer a.regMu.Unlock()
+	s.fold()
+	delete(a.shards, s)
+}
+
+// fold merges the shard into the main filter and clears it, returning the
+// number of items folded.
+func (s *LocalShard) fold() uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := s.shard.count
+	if count == 0 {
+		return 0
+	}
+
+	a := s.parent
+	a.mu.Lock()
+	a.main.Merge(s.shard)
+	a.mu.Unlock()
+
+	s.shard.Reset()
+	return count
+}
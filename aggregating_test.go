@@ -0,0 +1,125 @@
+package boom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Ensures that elements added to shards are members before and after they are
+// folded into the main filter.
+func TestAggregatingTestAndAdd(t *testing.T) {
+	f := NewAggregatingBloomFilter(100, 0.01)
+	s1, s2 := f.Shard(), f.Shard()
+
+	if shards := f.Shards(); shards != 2 {
+		t.Errorf("Expected 2, got %d", shards)
+	}
+
+	if s1.Add([]byte(`a`)) != s1 {
+		t.Error("Returned LocalShard should be the same instance")
+	}
+
+	if s2.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	for _, data := range []string{"a", "b"} {
+		if !f.Test([]byte(data)) || !s1.Test([]byte(data)) {
+			t.Errorf("`%s` should be a member", data)
+		}
+	}
+
+	if f.Test([]byte(`c`)) {
+		t.Error("`c` should not be a member")
+	}
+
+	if folded := f.Fold(); folded != 2 {
+		t.Errorf("Expected 2, got %d", folded)
+	}
+
+	if !f.main.Test([]byte(`a`)) || !f.main.Test([]byte(`b`)) {
+		t.Error("Expected shards to be folded into the main filter")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	s1.Add([]byte(`c`))
+	s1.Close()
+	if shards := f.Shards(); shards != 1 {
+		t.Errorf("Expected 1, got %d", shards)
+	}
+	if !f.main.Test([]byte(`c`)) {
+		t.Error("Expected a closed shard to be folded into the main filter")
+	}
+}
+
+// Ensures that NewAggregatingBloomFilterE returns an error for invalid
+// parameters.
+func TestNewAggregatingBloomFilterE(t *testing.T) {
+	if f, err := NewAggregatingBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a AggregatingBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewAggregatingBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewAggregatingBloomFilterE(100, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewAggregatingBloomFilterE(100, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that shards can be added to concurrently with tests and folds.
+func TestAggregatingConcurrent(t *testing.T) {
+	f := NewAggregatingBloomFilter(10000, 0.01)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			s := f.Shard()
+			defer s.Close()
+			for i := 0; i < 1000; i++ {
+				s.Add([]byte(strconv.Itoa(w*1000 + i)))
+				if i%100 == 0 {
+					f.Fold()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	if count := f.Count(); count != 4000 {
+		t.Errorf("Expected 4000, got %d", count)
+	}
+}
+
+func BenchmarkAggregatingAdd(b *testing.B) {
+	f := NewAggregatingBloomFilter(100000, 0.1)
+	b.RunParallel(func(pb *testing.PB) {
+		s := f.Shard()
+		defer s.Close()
+		data := []byte("data")
+		for pb.Next() {
+			s.Add(data)
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package boom
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Autosaver wraps a Filter so that it's safe for concurrent use, like a
+// SynchronizedFilter, and periodically saves a snapshot of it to a file in the
+// background, so that services get a crash-resilient filter without writing
+// their own persistence loop. Snapshots are written by WriteSnapshot and can
+// be restored with ReadSnapshot.
+//
+// A snapshot is saved on each tick of an interval and once a number of
+// mutations have been made since the last one, whichever comes first, but
+// only if the filter changed. Each is written to a temporary file in the same
+// directory, synced, and renamed over the previous one, so a crash leaves
+// either the old or the new snapshot in full.
+type Autosaver struct {
+	mu      sync.Mutex // guards filter and pending
+	filter  Filter     // wrapped filter
+	pending uint       // mutations since the last snapshot
+
+	path      string        // file snapshots are saved to
+	mutations uint          // mutations which trigger a save, or zero
+	saveMu    sync.Mutex    // serializes saves, guards err
+	err       error         // error of the most recent save
+	trigger   chan struct{} // signals that mutations reached the threshold
+	stop      chan struct{} // closed by Close to stop the background loop
+	done      chan struct{} // closed once the background loop has stopped
+	closeOnce sync.Once
+}
+
+// Autosave returns an Autosaver wrapping the filter, which saves a snapshot of
+// it to the file at path every interval and after the provided number of
+// mutations. A zero interval or number of mutations disables that trigger. It
+// returns an error if the filter can't be written with WriteTo. The filter
+// must not be used directly afterward, other than through Do, and Close must
+// be called to stop the background saves.
+func Autosave(path string, filter Filter, interval time.Duration, mutations uint) (*Autosaver, error) {
+	if _, ok := filter.(io.WriterTo); !ok {
+		return nil, fmt.Errorf("%T can't be saved, it has no WriteTo method", filter)
+	}
+	a := &Autosaver{
+		filter:    filter,
+		path:      path,
+		mutations: mutations,
+		trigger:   make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go a.loop(interval)
+	return a, nil
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. It's safe to call concurrently.
+func (a *Autosaver) Test(data []byte) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.filter.Test(data)
+}
+
+// Add will add the data to the filter. It returns the Autosaver to allow for
+// chaining. It's safe to call concurrently.
+func (a *Autosaver) Add(data []byte) Filter {
+	a.mu.Lock()
+	a.filter.Add(data)
+	a.mutated(1)
+	a.mu.Unlock()
+	return a
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not. It's safe to call
+// concurrently.
+func (a *Autosaver) TestAndAdd(data []byte) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	member := a.filter.TestAndAdd(data)
+	a.mutated(1)
+	return member
+}
+
+// AddMany will add each element of data to the filter, taking the lock once.
+// It returns the Autosaver to allow for chaining. It's safe to call
+// concurrently.
+func (a *Autosaver) AddMany(data [][]byte) Filter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if many, ok := a.filter.(interface{ AddMany([][]byte) Filter }); ok {
+		many.AddMany(data)
+	} else {
+		for _, element := range data {
+			a.filter.Add(element)
+		}
+	}
+	a.mutated(uint(len(data)))
+	return a
+}
+
+// Do calls fn with the wrapped filter while holding the lock, so that any of
+// its other methods, such as TestAndRemove or Reset, can be called safely.
+// The call counts as one mutation. The filter must not be retained after fn
+// returns.
+func (a *Autosaver) Do(fn func(filter Filter)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fn(a.filter)
+	a.mutated(1)
+}
+
+// Save saves a snapshot of the filter to the file now, even if it hasn't
+// changed, and returns an error if it fails.
+func (a *Autosaver) Save() error {
+	return a.save(true)
+}
+
+// Err returns the error of the most recent save, or nil if it succeeded. The
+// mutations of a failed save are kept, so it's retried on the next trigger.
+func (a *Autosaver) Err() error {
+	a.saveMu.Lock()
+	defer a.saveMu.Unlock()
+	return a.err
+}
+
+// Close stops the background saves and saves a final snapshot if the filter
+// changed since the last one. It returns an error if that save fails. The
+// filter can still be used afterward, but is no longer saved automatically.
+func (a *Autosaver) Close() error {
+	a.closeOnce.Do(func() {
+		close(a.stop)
+		<-a.done
+	})
+	return a.save(false)
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// wrapped filter's data, or zero if it doesn't report its size.
+func (a *Autosaver) ByteSize() uint {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return byteSize(a.filter)
+}
+
+// Stats returns the Stats of the wrapped filter, or zero Stats if it doesn't
+// report them.
+func (a *Autosaver) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return filterStats(a.filter)
+}
+
+// String returns a one-line summary of the Autosaver for logging and debugging.
+func (a *Autosaver) String() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return fmt.Sprintf("Autosaver{path=%s pending=%d filter=%v}", a.path, a.pending, a.filter)
+}
+
+// mutated records n mutations and signals the background loop once they reach
+// the threshold. The lock must be held.
+func (a *Autosaver) mutated(n uint) {
+	a.pending += n
+	if a.mutations > 0 && a.pending >= a.mutations {
+		select {
+		case a.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop saves snapshots on each tick of the interval and trigger until Close
+// is called.
+func (a *Autosaver) loop(interval time.Duration) {
+	defer close(a.done)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			a.save(false)
+		case <-a.trigger:
+			a.save(false)
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// save writes a snapshot of the filter to the file if it changed since the
+// last one, or if force is set. The filter is only locked while it's
+// serialized, not while the file is written.
+func (a *Autosaver) save(force bool) error {
+	a.saveMu.Lock()
+	defer a.saveMu.Unlock()
+
+	a.mu.Lock()
+	if !force && a.pending == 0 {
+		a.mu.Unlock()
+		return a.err
+	}
+	var snapshot bytes.Buffer
+	_, err := WriteSnapshot(&snapshot, a.filter.(io.WriterTo))
+	pending := a.pending
+	a.pending = 0
+	a.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(a.path, func(w io.Writer) error {
+			_, err := w.Write(snapshot.Bytes())
+			return err
+		})
+	}
+	if err != nil {
+		a.mu.Lock()
+		a.pending += pending
+		a.mu.Unlock()
+	}
+	a.err = err
+	return err
+}
+
+// writeFileAtomic calls write with a temporary file in the same directory as
+// path, syncs it, and renames it over the file at path, so readers and crashes
+// see either the old or the new contents in full. The directory is then
+// synced so the rename is durable, where the platform supports it.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
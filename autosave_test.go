@@ -0,0 +1,150 @@
+package boom
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// waitForSnapshot polls until a snapshot with count items is saved at path,
+// failing the test if none is within a second.
+func waitForSnapshot(t *testing.T, path string, count uint) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if loaded, err := loadSnapshotFile(path); err == nil && loaded.Count() == count {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Expected a snapshot of %d items at %s", count, path)
+}
+
+func loadSnapshotFile(path string) (*BloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	loaded := &BloomFilter{}
+	if _, err := ReadSnapshot(f, loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// Ensures that an Autosaver saves a snapshot once the number of mutations is
+// reached.
+func TestAutosaveMutations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.snap")
+	a, err := Autosave(path, NewBloomFilter(100, 0.01), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for i := 0; i < 9; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no snapshot before 10 mutations, got %v", err)
+	}
+
+	a.Add([]byte("9"))
+	waitForSnapshot(t, path, 10)
+
+	loaded, err := loadSnapshotFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if !loaded.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be in the snapshot", i)
+		}
+	}
+	if err := a.Err(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+// Ensures that an Autosaver saves a snapshot on each tick if the filter
+// changed.
+func TestAutosaveInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.snap")
+	a, err := Autosave(path, NewBloomFilter(100, 0.01), 5*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.AddMany([][]byte{[]byte("a"), []byte("b")})
+	waitForSnapshot(t, path, 2)
+	a.TestAndAdd([]byte("c"))
+	waitForSnapshot(t, path, 3)
+}
+
+// Ensures that Close saves the mutations made since the last snapshot and
+// stops the background saves.
+func TestAutosaveClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.snap")
+	a, err := Autosave(path, NewBloomFilter(100, 0.01), time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add([]byte("a"))
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadSnapshotFile(path); err != nil || !loaded.Test([]byte("a")) {
+		t.Errorf("Expected a snapshot containing a, got %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, got %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot in the directory, got %d entries", len(entries))
+	}
+}
+
+// Ensures that a failed save is reported and its mutations are kept for the
+// next save.
+func TestAutosaveError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "missing", "filter.snap")
+	a, err := Autosave(path, NewBloomFilter(100, 0.01), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add([]byte("a"))
+	if err := a.Save(); err == nil {
+		t.Error("Expected an error saving to a missing directory")
+	}
+	if a.Err() == nil {
+		t.Error("Expected Err to report the failed save")
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "missing"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadSnapshotFile(path); err != nil || !loaded.Test([]byte("a")) {
+		t.Errorf("Expected the retried snapshot to contain a, got %v", err)
+	}
+	if a.Err() != nil {
+		t.Errorf("Expected no error after a successful save, got %v", a.Err())
+	}
+
+	if _, err := Autosave(path, Synchronized(NewBloomFilter(100, 0.01)), 0, 0); err == nil {
+		t.Error("Expected an error for a filter without WriteTo")
+	}
+}
@@ -0,0 +1,344 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// BIP37MaxFilterBytes is the maximum size of a BIP-37 filter in bytes.
+	BIP37MaxFilterBytes = 36000
+
+	// BIP37MaxHashFuncs is the maximum number of hash functions of a BIP-37
+	// filter.
+	BIP37MaxHashFuncs = 50
+
+	// bip37SeedMultiplier is multiplied by the hash function number to derive
+	// the seed of each hash function.
+	bip37SeedMultiplier = 0xfba4c795
+)
+
+// BIP37Flags controls how a node matching transactions against a BIP-37
+// filter updates it with the outpoints of matched outputs.
+type BIP37Flags uint8
+
+const (
+	// BIP37UpdateNone never updates the filter.
+	BIP37UpdateNone BIP37Flags = iota
+
+	// BIP37UpdateAll adds the outpoint of every matched output.
+	BIP37UpdateAll
+
+	// BIP37UpdateP2PubKeyOnly adds the outpoints of matched pay-to-pubkey
+	// and multisig outputs only.
+	BIP37UpdateP2PubKeyOnly
+)
+
+// BIP37BloomFilter implements the Bloom filter used by Bitcoin's simplified
+// payment verification clients as specified by BIP-37:
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0037.mediawiki
+//
+// The filter is sized following Bitcoin Core, capped at BIP37MaxFilterBytes
+// bytes and BIP37MaxHashFuncs hash functions. Hash function i is the 32-bit
+// MurmurHash3 seeded with i * 0xfba4c795 plus a tweak chosen by the client.
+// WriteTo and ReadFrom use the encoding of the filterload message, so filters
+// built with this package can be sent to Bitcoin nodes and filters received
+// from clients can be parsed. The update flags are carried along for the node
+// doing the matching, but don't affect the filter itself.
+type BIP37BloomFilter struct {
+	data  []byte     // filter data
+	k     uint32     // number of hash functions
+	tweak uint32     // random value added to the seed of each hash function
+	flags BIP37Flags // how matching nodes update the filter
+	count uint       // number of items added
+}
+
+// NewBIP37BloomFilter creates a new BIP-37 Bloom filter optimized to store n
+// items with a specified target false-positive rate, tweak, and update flags.
+func NewBIP37BloomFilter(n uint, fpRate float64, tweak uint32, flags BIP37Flags) *BIP37BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+
+	// Follow Bitcoin Core's integer truncation so the sizes match exactly.
+	bits := uint(-1 / (math.Ln2 * math.Ln2) * float64(n) * math.Log(fpRate))
+	if bits > BIP37MaxFilterBytes*8 {
+		bits = BIP37MaxFilterBytes * 8
+	}
+	size := bits / 8
+
+	k := uint(float64(size*8/n) * math.Ln2)
+	if k > BIP37MaxHashFuncs {
+		k = BIP37MaxHashFuncs
+	}
+
+	return &BIP37BloomFilter{
+		data:  make([]byte, size),
+		k:     uint32(k),
+		tweak: tweak,
+		flags: flags,
+	}
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (b *BIP37BloomFilter) Capacity() uint {
+	return uint(len(b.data)) * 8
+}
+
+// K returns the number of hash functions.
+func (b *BIP37BloomFilter) K() uint {
+	return uint(b.k)
+}
+
+// Tweak returns the value added to the seed of each hash function.
+func (b *BIP37BloomFilter) Tweak() uint32 {
+	return b.tweak
+}
+
+// Flags returns the filter's update flags.
+func (b *BIP37BloomFilter) Flags() BIP37Flags {
+	return b.flags
+}
+
+// Count returns the number of items added to the filter. It's zero for
+// filters read with ReadFrom.
+func (b *BIP37BloomFilter) Count() uint {
+	return b.count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives. As in Bitcoin Core, everything is a member of an empty filter.
+func (b *BIP37BloomFilter) Test(data []byte) bool {
+	if len(b.data) == 0 {
+		return true
+	}
+
+	// If any of the K bits are not set, then it's not a member.
+	for i := uint32(0); i < b.k; i++ {
+		idx := b.index(i, data)
+		if b.data[idx>>3]&(1<<(idx&7)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (b *BIP37BloomFilter) Add(data []byte) Filter {
+	if len(b.data) == 0 {
+		return b
+	}
+
+	// Set the K bits.
+	for i := uint32(0); i < b.k; i++ {
+		idx := b.index(i, data)
+		b.data[idx>>3] |= 1 << (idx & 7)
+	}
+
+	b.count++
+	return b
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (b *BIP37BloomFilter) TestAndAdd(data []byte) bool {
+	if len(b.data) == 0 {
+		return true
+	}
+
+	// Set the K bits, noting whether any weren't set already.
+	member := true
+	for i := uint32(0); i < b.k; i++ {
+		idx := b.index(i, data)
+		if b.data[idx>>3]&(1<<(idx&7)) == 0 {
+			member = false
+			b.data[idx>>3] |= 1 << (idx & 7)
+		}
+	}
+
+	b.count++
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (b *BIP37BloomFilter) ByteSize() uint {
+	return uint(len(b.data))
+}
+
+// String returns a one-line summary of the BIP37BloomFilter for logging and
+// debugging.
+func (b *BIP37BloomFilter) String() string {
+	return fmt.Sprintf("BIP37BloomFilter{m=%d k=%d tweak=%d flags=%d count=%d fp=%.4g}",
+		b.Capacity(), b.k, b.tweak, b.flags, b.count, estimatedFPRate(b.Capacity(), uint(b.k), b.count))
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (b *BIP37BloomFilter) Reset() *BIP37BloomFilter {
+	for i := range b.data {
+		b.data[i] = 0
+	}
+	b.count = 0
+	return b
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (b *BIP37BloomFilter) Clear() {
+	b.Reset()
+}
+
+// WriteTo writes the filter to an i/o stream in the encoding of the payload
+// of a filterload message. It returns the number of bytes written.
+func (b *BIP37BloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	written, err := writeCompactSize(stream, uint64(len(b.data)))
+	if err != nil {
+		return written, err
+	}
+
+	n, err := stream.Write(b.data)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+
+	trailer := make([]byte, 9)
+	binary.LittleEndian.PutUint32(trailer, b.k)
+	binary.LittleEndian.PutUint32(trailer[4:], b.tweak)
+	trailer[8] = byte(b.flags)
+	n, err = stream.Write(trailer)
+	return written + int64(n), err
+}
+
+// ReadFrom reads a filter in the encoding of the payload of a filterload
+// message (such as might have been written by WriteTo()) from an i/o stream.
+// It returns the number of bytes read. Returns an error if the filter exceeds
+// the BIP-37 size limits.
+func (b *BIP37BloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	size, read, err := readCompactSize(stream)
+	if err != nil {
+		return read, err
+	}
+	if size > BIP37MaxFilterBytes {
+		return read, errors.New("bip37 filter exceeds maximum size")
+	}
+
+	data := make([]byte, size)
+	n, err := io.ReadFull(stream, data)
+	read += int64(n)
+	if err != nil {
+		return read, err
+	}
+
+	trailer := make([]byte, 9)
+	n, err = io.ReadFull(stream, trailer)
+	read += int64(n)
+	if err != nil {
+		return read, err
+	}
+
+	k := binary.LittleEndian.Uint32(trailer)
+	if k > BIP37MaxHashFuncs {
+		return read, errors.New("bip37 filter exceeds maximum hash functions")
+	}
+
+	b.data = data
+	b.k = k
+	b.tweak = binary.LittleEndian.Uint32(trailer[4:])
+	b.flags = BIP37Flags(trailer[8])
+	b.count = 0
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (b *BIP37BloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (b *BIP37BloomFilter) GobDecode(data []byte) error {
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// index returns the bit index of hash function i for the data.
+func (b *BIP37BloomFilter) index(i uint32, data []byte) uint32 {
+	return murmur3Sum32(i*bip37SeedMultiplier+b.tweak, data) % uint32(len(b.data)*8)
+}
+
+// writeCompactSize writes a Bitcoin variable-length integer to the stream.
+func writeCompactSize(stream io.Writer, v uint64) (int64, error) {
+	var buf [9]byte
+	size := 1
+	switch {
+	case v < 0xfd:
+		buf[0] = byte(v)
+	case v <= math.MaxUint16:
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(v))
+		size = 3
+	case v <= math.MaxUint32:
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+		size = 5
+	default:
+		buf[0] = 0xff
+		binary.LittleEndian.PutUint64(buf[1:], v)
+		size = 9
+	}
+	n, err := stream.Write(buf[:size])
+	return int64(n), err
+}
+
+// readCompactSize reads a Bitcoin variable-length integer from the stream.
+func readCompactSize(stream io.Reader) (uint64, int64, error) {
+	var buf [9]byte
+	n, err := io.ReadFull(stream, buf[:1])
+	read := int64(n)
+	if err != nil {
+		return 0, read, err
+	}
+
+	size := 0
+	switch buf[0] {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(buf[0]), read, nil
+	}
+
+	n, err = io.ReadFull(stream, buf[1:1+size])
+	read += int64(n)
+	if err != nil {
+		return 0, read, err
+	}
+
+	var v uint64
+	switch size {
+	case 2:
+		v = uint64(binary.LittleEndian.Uint16(buf[1:]))
+	case 4:
+		v = uint64(binary.LittleEndian.Uint32(buf[1:]))
+	default:
+		v = binary.LittleEndian.Uint64(buf[1:])
+	}
+	return v, read, nil
+}
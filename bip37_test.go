@@ -0,0 +1,137 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Ensures that filters match the reference serializations from Bitcoin Core.
+func TestBIP37Compatibility(t *testing.T) {
+	vectors := []struct {
+		tweak    uint32
+		expected string
+	}{
+		{0, "03614e9b050000000000000001"},
+		{2147483649, "03ce4299050000000100008001"},
+	}
+
+	for _, v := range vectors {
+		f := NewBIP37BloomFilter(3, 0.01, v.tweak, BIP37UpdateAll)
+
+		data, _ := hex.DecodeString("99108ad8ed9bb6274d3980bab5a85c048f0950c8")
+		f.Add(data)
+		if !f.Test(data) {
+			t.Error("Expected data to be a member")
+		}
+
+		// One bit changed.
+		data[len(data)-1] ^= 0x01
+		if v.tweak == 0 && f.Test(data) {
+			t.Error("Expected modified data not to be a member")
+		}
+
+		for _, s := range []string{
+			"b5a2c786d9ef4658287ced5914b37a1b4aa32eee",
+			"b9300670b4c5366e95b2699e8b18bc75e5f729c5",
+		} {
+			data, _ := hex.DecodeString(s)
+			f.Add(data)
+		}
+
+		var buf bytes.Buffer
+		if _, err := f.WriteTo(&buf); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != v.expected {
+			t.Errorf("Expected %s, got %s", v.expected, got)
+		}
+	}
+}
+
+// Ensures that the filter is sized within the BIP-37 limits.
+func TestBIP37Limits(t *testing.T) {
+	f := NewBIP37BloomFilter(1000000, 0.0001, 0, BIP37UpdateNone)
+
+	if capacity := f.Capacity(); capacity != BIP37MaxFilterBytes*8 {
+		t.Errorf("Expected %d, got %d", BIP37MaxFilterBytes*8, capacity)
+	}
+
+	f = NewBIP37BloomFilter(1, 0.0000001, 0, BIP37UpdateNone)
+	if k := f.K(); k > BIP37MaxHashFuncs {
+		t.Errorf("Expected at most %d, got %d", BIP37MaxHashFuncs, k)
+	}
+}
+
+// Ensures that filters can be serialized and deserialized, and that oversized
+// filters are rejected.
+func TestBIP37WriteToReadFrom(t *testing.T) {
+	f := NewBIP37BloomFilter(10000, 0.001, 42, BIP37UpdateP2PubKeyOnly)
+	f.Add([]byte(`a`))
+
+	var buf bytes.Buffer
+	written, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var other BIP37BloomFilter
+	read, err := other.ReadFrom(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if read != written {
+		t.Errorf("Expected %d, got %d", written, read)
+	}
+
+	if other.K() != f.K() || other.Capacity() != f.Capacity() ||
+		other.Tweak() != 42 || other.Flags() != BIP37UpdateP2PubKeyOnly {
+		t.Error("Expected parameters to match")
+	}
+
+	if !other.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	// The size is encoded as 0xfd 0xa1 0x8c (36001 bytes).
+	if _, err := other.ReadFrom(bytes.NewReader([]byte{0xfd, 0xa1, 0x8c})); err == nil {
+		t.Error("Expected error for oversized filter")
+	}
+}
+
+// Ensures that Test, Add, TestAndAdd, and Reset behave correctly.
+func TestBIP37TestAndAdd(t *testing.T) {
+	f := NewBIP37BloomFilter(100, 0.01, 0, BIP37UpdateNone)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned BIP37BloomFilter should be the same instance")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned BIP37BloomFilter should be the same instance")
+	}
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+}
+
+func BenchmarkBIP37Add(b *testing.B) {
+	f := NewBIP37BloomFilter(100000, 0.001, 0, BIP37UpdateNone)
+	data := []byte(`99108ad8ed9bb6274d3980bab5a85c048f0950c8`)
+	for n := 0; n < b.N; n++ {
+		f.Add(data)
+	}
+}
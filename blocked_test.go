@@ -0,0 +1,228 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Capacity returns the number of bits, m, rounded up to whole
+// blocks.
+func TestBlockedCapacity(t *testing.T) {
+	f := NewBlockedBloomFilter(100, 0.1)
+
+	if capacity := f.Capacity(); capacity != 512 {
+		t.Errorf("Expected 512, got %d", capacity)
+	}
+
+	if blocks := f.Blocks(); blocks != 1 {
+		t.Errorf("Expected 1, got %d", blocks)
+	}
+
+	if k := f.K(); k != 4 {
+		t.Errorf("Expected 4, got %d", k)
+	}
+
+	if size := f.ByteSize(); size != 64 {
+		t.Errorf("Expected 64, got %d", size)
+	}
+
+	if capacity := NewBlockedBloomFilter(10000, 0.01).Capacity(); capacity%512 != 0 ||
+		capacity < OptimalM(10000, 0.01) {
+		t.Errorf("Expected a multiple of 512 of at least %d, got %d", OptimalM(10000, 0.01), capacity)
+	}
+}
+
+// Ensures that NewBlockedBloomFilterE returns an error for invalid parameters.
+func TestNewBlockedBloomFilterE(t *testing.T) {
+	if f, err := NewBlockedBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a BlockedBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewBlockedBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewBlockedBloomFilterE(100, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewBlockedBloomFilterE(100, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that TestAndAdd behaves correctly.
+func TestBlockedTestAndAdd(t *testing.T) {
+	f := NewBlockedBloomFilter(100, 0.01)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.Add([]byte(`b`)) != f {
+		t.Error("Returned BlockedBloomFilter should be the same instance")
+	}
+
+	if !f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if f.TestString("c") {
+		t.Error("`c` should not be a member")
+	}
+
+	f.AddString("c")
+	if !f.Test([]byte(`c`)) {
+		t.Error("`c` should be a member")
+	}
+
+	if count := f.Count(); count != 4 {
+		t.Errorf("Expected 4, got %d", count)
+	}
+
+	f.Reset()
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member after Reset")
+	}
+}
+
+// Ensures that each element's bits are confined to a single block.
+func TestBlockedSingleBlock(t *testing.T) {
+	f := NewBlockedBloomFilter(10000, 0.01)
+	f.Add([]byte(`a`))
+
+	blocks := 0
+	for i := uint(0); i < f.Blocks(); i++ {
+		for _, word := range f.words[i*blockWords : (i+1)*blockWords] {
+			if word != 0 {
+				blocks++
+				break
+			}
+		}
+	}
+	if blocks != 1 {
+		t.Errorf("Expected 1 block to be set, got %d", blocks)
+	}
+}
+
+// Ensures that the false-positive rate stays close to the target when the
+// filter is filled to capacity.
+func TestBlockedFalsePositives(t *testing.T) {
+	f := NewBlockedBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 10000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Fatalf("Expected `%d` to be a member", i)
+		}
+	}
+
+	fp := 0
+	for i := 10000; i < 110000; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 100000; rate > 0.02 {
+		t.Errorf("Expected false-positive rate below 0.02, got %f", rate)
+	}
+
+	if ratio := f.FillRatio(); ratio < 0.4 || ratio > 0.6 {
+		t.Errorf("Expected fill ratio near 0.5, got %f", ratio)
+	}
+}
+
+// Ensures that a BlockedBloomFilter round-trips through WriteTo and ReadFrom
+// and through gob.
+func TestBlockedSerialization(t *testing.T) {
+	f := NewBlockedBloomFilter(1000, 0.01)
+	for i := 0; i < 500; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), n)
+	}
+
+	read := &BlockedBloomFilter{}
+	if m, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	} else if m != n {
+		t.Errorf("Expected %d bytes read, got %d", n, m)
+	}
+
+	if read.Count() != f.Count() || read.Capacity() != f.Capacity() || read.K() != f.K() {
+		t.Errorf("Expected %s, got %s", f, read)
+	}
+	for i := 0; i < 1000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if read.Test(data) != f.Test(data) {
+			t.Errorf("Expected read filter to agree for `%s`", data)
+		}
+	}
+
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+		t.Fatal(err)
+	}
+	decoded := &BlockedBloomFilter{}
+	if err := gob.NewDecoder(&buf).Decode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Test([]byte(`1`)) {
+		t.Error("`1` should be a member")
+	}
+
+	if _, err := read.ReadFrom(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("Expected error for zero hash functions")
+	}
+	for _, header := range [][]uint64{{0, 0, 3}, {0, 1 << 40, 3}} {
+		var forged bytes.Buffer
+		binary.Write(&forged, binary.BigEndian, header)
+		if _, err := read.ReadFrom(&forged); err == nil {
+			t.Errorf("Expected error for %d blocks", header[1])
+		}
+	}
+}
+
+func BenchmarkBlockedAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewBlockedBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkBlockedTest(b *testing.B) {
+	b.StopTimer()
+	f := NewBlockedBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
@@ -0,0 +1,198 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// BlockIndex maintains a small Bloom filter for each block of a data file, as
+// in the filter blocks of an SSTable. Looking up a key returns the blocks
+// which may contain it, so only those need to be read. Every block's filter
+// has the same parameters, so a key is hashed once no matter how many blocks
+// are checked, and the index serializes compactly as a single header followed
+// by the raw filter bits.
+type BlockIndex struct {
+	blocks []*BloomFilter // filter for each block
+	hash   hash.Hash64    // hash function (kernel for all k functions)
+	m      uint           // size of each filter
+	k      uint           // number of hash functions
+}
+
+// NewBlockIndex creates a new BlockIndex with no blocks whose filters are
+// optimized to store n keys per block with a specified target false-positive
+// rate.
+func NewBlockIndex(n uint, fpRate float64) *BlockIndex {
+	return &BlockIndex{
+		hash: newDefaultHash(),
+		m:    OptimalM(n, fpRate),
+		k:    OptimalK(fpRate),
+	}
+}
+
+// Blocks returns the number of blocks in the index.
+func (b *BlockIndex) Blocks() uint {
+	return uint(len(b.blocks))
+}
+
+// NewBlock adds an empty block to the index and returns its number. Blocks
+// are numbered consecutively from zero.
+func (b *BlockIndex) NewBlock() uint {
+	b.blocks = append(b.blocks, &BloomFilter{
+		buckets: NewBuckets(b.m, 1),
+		hash:    b.hash,
+		m:       b.m,
+		k:       b.k,
+	})
+	return uint(len(b.blocks) - 1)
+}
+
+// Add will add the key to the filter of the block. It returns the index to
+// allow for chaining.
+func (b *BlockIndex) Add(block uint, key []byte) *BlockIndex {
+	b.blocks[block].Add(key)
+	return b
+}
+
+// Test will test whether the block may contain the key and returns true if
+// it may, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (b *BlockIndex) Test(block uint, key []byte) bool {
+	return b.blocks[block].Test(key)
+}
+
+// Candidates returns the numbers of the blocks which may contain the key in
+// ascending order.
+func (b *BlockIndex) Candidates(key []byte) []uint {
+	lower, upper := hashKernel(key, b.hash)
+	candidates := []uint{}
+
+blocks:
+	for i, filter := range b.blocks {
+		for j := uint(0); j < b.k; j++ {
+			if filter.buckets.Get(DoubleHashing.index(lower, upper, j, b.m)) == 0 {
+				continue blocks
+			}
+		}
+		candidates = append(candidates, uint(i))
+	}
+
+	return candidates
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// index's data, the sum of its block filters.
+func (b *BlockIndex) ByteSize() uint {
+	size := uint(0)
+	for _, block := range b.blocks {
+		size += block.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the BlockIndex for logging and
+// debugging.
+func (b *BlockIndex) String() string {
+	return fmt.Sprintf("BlockIndex{blocks=%d m=%d k=%d}", len(b.blocks), b.m, b.k)
+}
+
+// Reset removes every block from the index. It returns the index to allow
+// for chaining.
+func (b *BlockIndex) Reset() *BlockIndex {
+	b.blocks = nil
+	return b
+}
+
+// WriteTo writes a binary representation of the BlockIndex to an i/o stream.
+// It returns the number of bytes written.
+func (b *BlockIndex) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(b.m), uint64(b.k), uint64(len(b.blocks))}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, filter := range b.blocks {
+		if err := binary.Write(stream, binary.BigEndian, uint64(filter.count)); err != nil {
+			return written, err
+		}
+		written += 8
+
+		n, err := stream.Write(filter.buckets.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a BlockIndex (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (b *BlockIndex) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[0] == 0 || header[0] > uint64(maxBits) || header[1] == 0 || header[1] > maxK {
+		return read, errors.New("invalid block index dimensions")
+	}
+	m, k := uint(header[0]), uint(header[1])
+	if b.hash == nil {
+		b.hash = newDefaultHash()
+	}
+
+	var blocks []*BloomFilter
+	for i := uint64(0); i < header[2]; i++ {
+		var count uint64
+		if err := binary.Read(stream, binary.BigEndian, &count); err != nil {
+			return read, err
+		}
+		read += 8
+
+		// The bits are read as they arrive, like Buckets.ReadFrom, so a forged
+		// m can't allocate more memory than the stream holds.
+		data, n, err := readBytes(stream, (header[0]+7)/8)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		buckets := &Buckets{data: data, bucketSize: 1, max: 1, count: m}
+
+		blocks = append(blocks, &BloomFilter{
+			buckets: buckets,
+			hash:    b.hash,
+			m:       m,
+			k:       k,
+			count:   uint(count),
+		})
+	}
+
+	b.blocks = blocks
+	b.m = m
+	b.k = k
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (b *BlockIndex) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (b *BlockIndex) GobDecode(data []byte) error {
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,140 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Ensures that NewBlock, Add, Test, and Candidates behave correctly.
+func TestBlockIndexCandidates(t *testing.T) {
+	b := NewBlockIndex(100, 0.01)
+
+	if candidates := b.Candidates([]byte(`a`)); len(candidates) != 0 {
+		t.Errorf("Expected no candidates, got %v", candidates)
+	}
+
+	for i := uint(0); i < 10; i++ {
+		if block := b.NewBlock(); block != i {
+			t.Errorf("Expected %d, got %d", i, block)
+		}
+		for j := 0; j < 100; j++ {
+			if b.Add(i, []byte(strconv.Itoa(int(i)*100+j))) != b {
+				t.Error("Returned BlockIndex should be the same instance")
+			}
+		}
+	}
+
+	if blocks := b.Blocks(); blocks != 10 {
+		t.Errorf("Expected 10, got %d", blocks)
+	}
+
+	if !b.Test(3, []byte(`350`)) {
+		t.Error("`350` should be in block 3")
+	}
+
+	if b.Test(4, []byte(`350`)) {
+		t.Error("`350` should not be in block 4")
+	}
+
+	for i := 0; i < 1000; i++ {
+		found := false
+		for _, block := range b.Candidates([]byte(strconv.Itoa(i))) {
+			if block == uint(i/100) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected block %d to be a candidate for `%d`", i/100, i)
+		}
+	}
+
+	if candidates := b.Candidates([]byte(`missing`)); len(candidates) > 1 {
+		t.Errorf("Expected at most one candidate, got %v", candidates)
+	}
+}
+
+// Ensures that the index can be serialized and deserialized.
+func TestBlockIndexWriteToReadFrom(t *testing.T) {
+	b := NewBlockIndex(100, 0.01)
+	for i := uint(0); i < 5; i++ {
+		b.NewBlock()
+		for j := 0; j < 50; j++ {
+			b.Add(i, []byte(strconv.Itoa(int(i)*100+j)))
+		}
+	}
+
+	var buf bytes.Buffer
+	written, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d, got %d", buf.Len(), written)
+	}
+
+	var other BlockIndex
+	read, err := other.ReadFrom(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if read != written {
+		t.Errorf("Expected %d, got %d", written, read)
+	}
+
+	if blocks := other.Blocks(); blocks != 5 {
+		t.Errorf("Expected 5, got %d", blocks)
+	}
+
+	for i := 0; i < 500; i++ {
+		data := []byte(strconv.Itoa(i))
+		if !reflect.DeepEqual(b.Candidates(data), other.Candidates(data)) {
+			t.Errorf("Expected candidates for `%d` to match", i)
+		}
+	}
+
+	if count := other.blocks[2].Count(); count != 50 {
+		t.Errorf("Expected 50, got %d", count)
+	}
+
+	// Forged headers are rejected without allocating the blocks up front.
+	for _, header := range [][]uint64{{0, 3, 1}, {100, 0, 1}, {1 << 62, 3, 1, 0}} {
+		buf.Reset()
+		binary.Write(&buf, binary.BigEndian, header)
+		if _, err := other.ReadFrom(&buf); err == nil {
+			t.Errorf("Expected error for header %v", header)
+		}
+	}
+}
+
+// Ensures that Reset removes every block.
+func TestBlockIndexReset(t *testing.T) {
+	b := NewBlockIndex(100, 0.01)
+	b.NewBlock()
+
+	if b.Reset() != b {
+		t.Error("Returned BlockIndex should be the same instance")
+	}
+
+	if blocks := b.Blocks(); blocks != 0 {
+		t.Errorf("Expected 0, got %d", blocks)
+	}
+}
+
+func BenchmarkBlockIndexCandidates(b *testing.B) {
+	b.StopTimer()
+	index := NewBlockIndex(1000, 0.01)
+	for i := uint(0); i < 100; i++ {
+		index.NewBlock()
+		for j := 0; j < 1000; j++ {
+			index.Add(i, []byte(strconv.Itoa(int(i)*1000+j)))
+		}
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		index.Candidates([]byte(strconv.Itoa(n)))
+	}
+}
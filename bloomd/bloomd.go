@@ -0,0 +1,364 @@
+// Package bloomd speaks the ASCII protocol of bloomd, a network daemon
+// serving named Bloom filters:
+//
+// https://github.com/armon/bloomd
+//
+// Server answers the protocol with ScalableBloomFilters, so existing bloomd
+// clients can be pointed at a Go process which also uses the filters
+// directly, and Client talks to either bloomd or a Server, so programs can
+// migrate incrementally in either direction. It's a separate package so that
+// programs using boom don't link net unless they opt in.
+//
+// Commands and responses are single lines. Keys and filter names are
+// whitespace-separated tokens, so they can't contain whitespace:
+//
+//	create users capacity=1000000 prob=0.001
+//	Done
+//	bulk users alice bob
+//	Yes Yes
+//	multi users alice carol
+//	Yes No
+//
+// The list and info commands answer with several lines between START and END.
+package bloomd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+const (
+	// DefaultCapacity is the initial capacity of filters created without one,
+	// as in bloomd.
+	DefaultCapacity = 100000
+
+	// DefaultProbability is the false-positive probability of filters created
+	// without one, as in bloomd.
+	DefaultProbability = 0.0001
+
+	// tighteningRatio is the ratio by which the false-positive probability of
+	// each filter added to a ScalableBloomFilter is tightened.
+	tighteningRatio = 0.9
+
+	// maxLineBytes is the longest command line the Server accepts.
+	maxLineBytes = 32 << 20
+
+	// maxFilterBits is the largest number of bits the first Bloom filter of a
+	// filter created by a client may have, 4 GiB.
+	maxFilterBits = 1 << 35
+)
+
+// Responses of the bloomd protocol.
+const (
+	responseDone         = "Done"
+	responseExists       = "Exists"
+	responseNotExist     = "Filter does not exist"
+	responseBadArguments = "Client Error: Bad arguments"
+	responseNotSupported = "Client Error: Command not supported"
+	responseYes          = "Yes"
+	responseNo           = "No"
+	responseStart        = "START"
+	responseEnd          = "END"
+)
+
+var (
+	// ErrFilterExists is returned when creating a filter which already exists.
+	ErrFilterExists = errors.New("bloomd: filter already exists")
+
+	// ErrNoFilter is returned by commands on a filter which doesn't exist.
+	ErrNoFilter = errors.New("bloomd: filter does not exist")
+)
+
+// filter is a named filter served by a Server along with its statistics.
+type filter struct {
+	sbf         *boom.ScalableBloomFilter
+	capacity    uint
+	probability float64
+	checkHits   uint64
+	checkMisses uint64
+	setHits     uint64
+	setMisses   uint64
+}
+
+// info returns the filter's statistics in the order bloomd reports them.
+func (f *filter) info() []string {
+	return []string{
+		"capacity " + strconv.FormatUint(uint64(f.capacity), 10),
+		"checks " + strconv.FormatUint(f.checkHits+f.checkMisses, 10),
+		"check_hits " + strconv.FormatUint(f.checkHits, 10),
+		"check_misses " + strconv.FormatUint(f.checkMisses, 10),
+		"page_ins 0",
+		"page_outs 0",
+		"probability " + strconv.FormatFloat(f.probability, 'g', -1, 64),
+		"sets " + strconv.FormatUint(f.setHits+f.setMisses, 10),
+		"set_hits " + strconv.FormatUint(f.setHits, 10),
+		"set_misses " + strconv.FormatUint(f.setMisses, 10),
+		"size " + strconv.FormatUint(uint64(f.sbf.Count()), 10),
+		"storage " + strconv.FormatUint(uint64(f.sbf.ByteSize()), 10),
+	}
+}
+
+// Server serves named ScalableBloomFilters over the bloomd protocol. Filters
+// are held in memory, so flush and close succeed without doing anything, and
+// clear removes a filter like drop. Connections are served concurrently, so
+// it locks the filters for each command, and a command's keys are handled
+// atomically.
+type Server struct {
+	mu      sync.Mutex         // guards filters
+	filters map[string]*filter // filters by name
+}
+
+// NewServer returns a Server with no filters.
+func NewServer() *Server {
+	return &Server{filters: make(map[string]*filter)}
+}
+
+// Create creates a filter with the initial capacity and false-positive
+// probability, as the create command does. It returns ErrFilterExists if a
+// filter with the name exists, and an error if the parameters are invalid or
+// the filter would use more than 4 GiB of memory.
+func (s *Server) Create(name string, capacity uint, probability float64) error {
+	if capacity > 0 && float64(boom.OptimalM(capacity, probability)) > maxFilterBits {
+		return errors.New("bloomd: filter too large")
+	}
+	sbf, err := boom.NewScalableBloomFilterE(capacity, probability, tighteningRatio)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.filters[name]; ok {
+		return ErrFilterExists
+	}
+	s.filters[name] = &filter{sbf: sbf, capacity: capacity, probability: probability}
+	return nil
+}
+
+// Do calls fn with the named filter while holding the lock, so that it can be
+// used directly while it's being served. It returns false without calling fn
+// if the filter doesn't exist. The filter must not be retained after fn
+// returns.
+func (s *Server) Do(name string, fn func(filter *boom.ScalableBloomFilter)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.filters[name]
+	if !ok {
+		return false
+	}
+	fn(f.sbf)
+	return true
+}
+
+// Serve accepts connections on the listener and serves each in a new
+// goroutine. It returns the error from Accept, such as when the listener is
+// closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves commands read from the connection until it's closed or a
+// line is too long, and then closes it.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, maxLineBytes)
+	w := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		for _, line := range s.execute(strings.ToLower(fields[0]), fields[1:]) {
+			w.WriteString(line)
+			w.WriteString("\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// execute runs the command with the arguments and returns the lines of its
+// response.
+func (s *Server) execute(command string, args []string) []string {
+	switch command {
+	case "create":
+		return []string{s.create(args)}
+	case "list":
+		if len(args) > 1 {
+			return []string{responseBadArguments}
+		}
+		return s.list(args)
+	case "drop", "clear":
+		return s.withFilter(args, 0, func(name string, _ *filter) []string {
+			delete(s.filters, name)
+			return []string{responseDone}
+		})
+	case "close":
+		return s.withFilter(args, 0, func(string, *filter) []string {
+			return []string{responseDone}
+		})
+	case "flush":
+		if len(args) == 0 {
+			return []string{responseDone}
+		}
+		return s.withFilter(args, 0, func(string, *filter) []string {
+			return []string{responseDone}
+		})
+	case "info":
+		return s.withFilter(args, 0, func(_ string, f *filter) []string {
+			return append(append([]string{responseStart}, f.info()...), responseEnd)
+		})
+	case "check", "c":
+		return s.withFilter(args, 1, func(_ string, f *filter) []string {
+			return []string{f.check(args[1:])}
+		})
+	case "multi", "m":
+		return s.withFilter(args, -1, func(_ string, f *filter) []string {
+			return []string{f.check(args[1:])}
+		})
+	case "set", "s":
+		return s.withFilter(args, 1, func(_ string, f *filter) []string {
+			return []string{f.set(args[1:])}
+		})
+	case "bulk", "b":
+		return s.withFilter(args, -1, func(_ string, f *filter) []string {
+			return []string{f.set(args[1:])}
+		})
+	default:
+		return []string{responseNotSupported}
+	}
+}
+
+// withFilter calls fn with the filter named by the first argument while
+// holding the lock. The filter name must be followed by exactly keys
+// arguments, or at least one if keys is negative.
+func (s *Server) withFilter(args []string, keys int, fn func(name string, f *filter) []string) []string {
+	if len(args) == 0 || (keys >= 0 && len(args) != 1+keys) || (keys < 0 && len(args) < 2) {
+		return []string{responseBadArguments}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.filters[args[0]]
+	if !ok {
+		return []string{responseNotExist}
+	}
+	return fn(args[0], f)
+}
+
+// create creates the filter named by the first argument with the capacity
+// and prob options which follow it.
+func (s *Server) create(args []string) string {
+	if len(args) == 0 {
+		return responseBadArguments
+	}
+	var (
+		capacity    uint = DefaultCapacity
+		probability      = DefaultProbability
+	)
+	for _, arg := range args[1:] {
+		key, value, _ := strings.Cut(arg, "=")
+		var err error
+		switch key {
+		case "capacity":
+			var c uint64
+			c, err = strconv.ParseUint(value, 10, 0)
+			capacity = uint(c)
+		case "prob":
+			probability, err = strconv.ParseFloat(value, 64)
+		case "in_memory":
+			// Every filter is held in memory.
+		default:
+			err = errors.New("unknown option")
+		}
+		if err != nil {
+			return responseBadArguments
+		}
+	}
+
+	switch err := s.Create(args[0], capacity, probability); err {
+	case nil:
+		return responseDone
+	case ErrFilterExists:
+		return responseExists
+	default:
+		return responseBadArguments
+	}
+}
+
+// list returns the lines describing each filter whose name has the optional
+// prefix, in order of name.
+func (s *Server) list(args []string) []string {
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.filters))
+	for name := range s.filters {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	lines := []string{responseStart}
+	for _, name := range names {
+		f := s.filters[name]
+		lines = append(lines, fmt.Sprintf("%s %s %d %d %d", name,
+			strconv.FormatFloat(f.probability, 'g', -1, 64), f.sbf.ByteSize(), f.capacity, f.sbf.Count()))
+	}
+	return append(lines, responseEnd)
+}
+
+// check answers whether each key is a member of the filter.
+func (f *filter) check(keys []string) string {
+	results := make([]string, len(keys))
+	for i, key := range keys {
+		if f.sbf.TestString(key) {
+			f.checkHits++
+			results[i] = responseYes
+		} else {
+			f.checkMisses++
+			results[i] = responseNo
+		}
+	}
+	return strings.Join(results, " ")
+}
+
+// set adds each key which isn't a member to the filter and answers whether it
+// was added, as bloomd does. Members aren't added again, so the filter's
+// count is the number of keys added, which bloomd reports as its size.
+func (f *filter) set(keys []string) string {
+	results := make([]string, len(keys))
+	for i, key := range keys {
+		if f.sbf.TestString(key) {
+			f.setMisses++
+			results[i] = responseNo
+		} else {
+			f.sbf.AddString(key)
+			f.setHits++
+			results[i] = responseYes
+		}
+	}
+	return strings.Join(results, " ")
+}
@@ -0,0 +1,258 @@
+package bloomd
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// newPipe returns a Client connected to the Server over an in-memory pipe.
+func newPipe(s *Server) *Client {
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	return NewClient(client)
+}
+
+// Ensures that the Server answers raw protocol commands as bloomd does.
+func TestServerProtocol(t *testing.T) {
+	client, server := net.Pipe()
+	go NewServer().ServeConn(server)
+	defer client.Close()
+	r := bufio.NewReader(client)
+
+	storage := strconv.FormatUint(uint64(boom.NewScalableBloomFilter(1000, 0.001, tighteningRatio).ByteSize()), 10)
+	for _, test := range []struct {
+		command  string
+		response string
+	}{
+		{"create users capacity=1000 prob=0.001 in_memory=1", "Done"},
+		{"create users", "Exists"},
+		{"create bad capacity=x", "Client Error: Bad arguments"},
+		{"create bad prob=2", "Client Error: Bad arguments"},
+		{"create bad size=2", "Client Error: Bad arguments"},
+		{"create bad capacity=18446744073709551615", "Client Error: Bad arguments"},
+		{"create bad capacity=1125899906842624", "Client Error: Bad arguments"},
+		{"create bad capacity=1000000000 prob=1e-300", "Client Error: Bad arguments"},
+		{"create", "Client Error: Bad arguments"},
+		{"bulk users alice bob", "Yes Yes"},
+		{"b users alice carol", "No Yes"},
+		{"set users dave", "Yes"},
+		{"s users dave", "No"},
+		{"check users alice", "Yes"},
+		{"c users erin", "No"},
+		{"multi users alice erin bob", "Yes No Yes"},
+		{"m users", "Client Error: Bad arguments"},
+		{"check users", "Client Error: Bad arguments"},
+		{"check missing alice", "Filter does not exist"},
+		{"list", "START\nusers 0.001 " + storage + " 1000 4\nEND"},
+		{"list x", "START\nEND"},
+		{"info users", "START\ncapacity 1000\nchecks 5\ncheck_hits 3\ncheck_misses 2\n" +
+			"page_ins 0\npage_outs 0\nprobability 0.001\nsets 6\nset_hits 4\nset_misses 2\n" +
+			"size 4\nstorage " + storage + "\nEND"},
+		{"flush", "Done"},
+		{"flush users", "Done"},
+		{"close users", "Done"},
+		{"FROB users", "Client Error: Command not supported"},
+		{"   ", ""},
+		{"drop users", "Done"},
+		{"drop users", "Filter does not exist"},
+	} {
+		if _, err := client.Write([]byte(test.command + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		if test.response == "" {
+			// Blank lines are ignored.
+			continue
+		}
+		for i, expected := range strings.Split(test.response, "\n") {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line = strings.TrimSuffix(line, "\n"); line != expected {
+				t.Errorf("%q: Expected line %d to be %q, got %q", test.command, i, expected, line)
+			}
+		}
+	}
+}
+
+// Ensures that a Client can manage filters and add and check keys.
+func TestClient(t *testing.T) {
+	s := NewServer()
+	client := newPipe(s)
+	defer client.Close()
+
+	if err := client.CreateFilter("users", 1000, 0.001); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFilter("users", 0, 0); err != ErrFilterExists {
+		t.Errorf("Expected ErrFilterExists, got %v", err)
+	}
+	if err := client.CreateFilter("events", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := client.Bulk("users", "alice", "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 3 || !added[0] || !added[1] || added[2] {
+		t.Errorf("Expected [true true false], got %v", added)
+	}
+	if added, err := client.Set("users", "carol"); err != nil || !added {
+		t.Errorf("Expected carol to be added, got %v", err)
+	}
+	if member, err := client.Check("users", "carol"); err != nil || !member {
+		t.Errorf("Expected carol to be a member, got %v", err)
+	}
+	members, err := client.Multi("users", "alice", "dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || !members[0] || members[1] {
+		t.Errorf("Expected [true false], got %v", members)
+	}
+
+	filters, err := client.ListFilters("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 2 || filters[0].Name != "events" || filters[1].Name != "users" {
+		t.Fatalf("Expected events and users, got %v", filters)
+	}
+	if f := filters[0]; f.Capacity != DefaultCapacity || f.Probability != DefaultProbability || f.Size != 0 {
+		t.Errorf("Expected default parameters, got %+v", f)
+	}
+	if f := filters[1]; f.Capacity != 1000 || f.Probability != 0.001 || f.Size != 3 || f.Storage == 0 {
+		t.Errorf("Expected the users filter, got %+v", f)
+	}
+	if filters, err := client.ListFilters("us"); err != nil || len(filters) != 1 {
+		t.Errorf("Expected 1 filter, got %v, %v", filters, err)
+	}
+
+	info, err := client.Info("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info["size"] != "3" || info["set_hits"] != "3" || info["checks"] != "3" {
+		t.Errorf("Expected the users filter's statistics, got %v", info)
+	}
+
+	// The filter can be used directly while it's being served.
+	if !s.Do("users", func(filter *boom.ScalableBloomFilter) { filter.Add([]byte(`erin`)) }) {
+		t.Error("Expected the users filter to exist")
+	}
+	if member, err := client.Check("users", "erin"); err != nil || !member {
+		t.Errorf("Expected erin to be a member, got %v", err)
+	}
+
+	for _, err := range []error{client.Flush(""), client.Flush("users"), client.CloseFilter("users"), client.DropFilter("events")} {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if err := client.ClearFilter("users"); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Check("users", "alice"); err != ErrNoFilter {
+		t.Errorf("Expected ErrNoFilter, got %v", err)
+	}
+	if s.Do("users", func(*boom.ScalableBloomFilter) {}) {
+		t.Error("Expected the users filter to be removed")
+	}
+}
+
+// Ensures that the Client rejects keys and names which can't be sent and
+// reports server errors.
+func TestClientErrors(t *testing.T) {
+	client := newPipe(NewServer())
+	defer client.Close()
+
+	for _, err := range []error{
+		client.CreateFilter("two words", 0, 0),
+		client.DropFilter(""),
+	} {
+		if err == nil || !strings.Contains(err.Error(), "invalid token") {
+			t.Errorf("Expected an invalid token error, got %v", err)
+		}
+	}
+	if _, err := client.Bulk("users", "a", "b\nc"); err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Errorf("Expected an invalid token error, got %v", err)
+	}
+
+	err := client.CreateFilter("users", 0, 2)
+	if err == nil || !strings.Contains(err.Error(), "Client Error: Bad arguments") {
+		t.Errorf("Expected a bad arguments error, got %v", err)
+	}
+	if results, err := client.Multi("users"); err != nil || results != nil {
+		t.Errorf("Expected no results for no keys, got %v, %v", results, err)
+	}
+}
+
+// Ensures that Serve serves concurrent clients over TCP.
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer()
+	done := make(chan error)
+	go func() { done <- s.Serve(listener) }()
+	if err := s.Create("events", 10000, 0.01); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		client, err := Dial(listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := strconv.Itoa(c*100 + i)
+				if added, err := client.Set("events", key); err != nil || !added {
+					t.Errorf("Expected %s to be added, got %v", key, err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	s.Do("events", func(filter *boom.ScalableBloomFilter) {
+		if count := filter.Count(); count != 400 {
+			t.Errorf("Expected 400, got %d", count)
+		}
+	})
+
+	listener.Close()
+	if err := <-done; err == nil {
+		t.Error("Expected Serve to return an error once the listener is closed")
+	}
+}
+
+func BenchmarkClientBulk(b *testing.B) {
+	b.StopTimer()
+	s := NewServer()
+	s.Create("events", 1000000, 0.001)
+	client := newPipe(s)
+	defer client.Close()
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		client.Bulk("events", keys...)
+	}
+}
@@ -0,0 +1,288 @@
+package bloomd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FilterInfo describes a filter as reported by the list command.
+type FilterInfo struct {
+	Name        string
+	Probability float64
+	Storage     uint64 // bytes of memory or disk used
+	Capacity    uint64
+	Size        uint64 // number of keys added
+}
+
+// Client is a client for bloomd or a Server. Commands are sent one at a time
+// over a single connection, so it's safe for concurrent use but commands
+// don't run in parallel.
+type Client struct {
+	mu   sync.Mutex    // serializes commands
+	conn net.Conn      // connection to the server
+	r    *bufio.Reader // buffered reader of conn
+}
+
+// Dial connects to the bloomd server at the TCP address, such as
+// "localhost:8673", and returns a Client for it.
+func Dial(address string) (*Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client sending commands over the connection, which can
+// have deadlines set on it to bound commands.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// CreateFilter creates a filter with the initial capacity and false-positive
+// probability. A zero capacity or probability uses the server's default. It
+// returns ErrFilterExists if a filter with the name exists.
+func (c *Client) CreateFilter(name string, capacity uint, probability float64) error {
+	command := "create " + name
+	if capacity > 0 {
+		command += " capacity=" + strconv.FormatUint(uint64(capacity), 10)
+	}
+	if probability > 0 {
+		command += " prob=" + strconv.FormatFloat(probability, 'g', -1, 64)
+	}
+	lines, err := c.do(command, false, name)
+	if err != nil {
+		return err
+	}
+	switch lines[0] {
+	case responseDone:
+		return nil
+	case responseExists:
+		return ErrFilterExists
+	default:
+		return unexpected(lines[0])
+	}
+}
+
+// DropFilter deletes the filter.
+func (c *Client) DropFilter(name string) error {
+	return c.done("drop", name)
+}
+
+// CloseFilter unloads the filter from the server's memory, keeping it on
+// disk.
+func (c *Client) CloseFilter(name string) error {
+	return c.done("close", name)
+}
+
+// ClearFilter removes the filter from the server's management, keeping it on
+// disk. bloomd only clears filters which are closed.
+func (c *Client) ClearFilter(name string) error {
+	return c.done("clear", name)
+}
+
+// Flush writes the filter to disk, or every filter if name is empty.
+func (c *Client) Flush(name string) error {
+	if name == "" {
+		return c.done("flush")
+	}
+	return c.done("flush", name)
+}
+
+// ListFilters returns the filters whose names have the prefix, or every
+// filter if it's empty.
+func (c *Client) ListFilters(prefix string) ([]FilterInfo, error) {
+	command, tokens := "list", []string(nil)
+	if prefix != "" {
+		command, tokens = command+" "+prefix, []string{prefix}
+	}
+	lines, err := c.do(command, true, tokens...)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make([]FilterInfo, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			return nil, unexpected(line)
+		}
+		probability, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, unexpected(line)
+		}
+		var counts [3]uint64
+		for i := range counts {
+			if counts[i], err = strconv.ParseUint(fields[2+i], 10, 64); err != nil {
+				return nil, unexpected(line)
+			}
+		}
+		filters = append(filters, FilterInfo{
+			Name:        fields[0],
+			Probability: probability,
+			Storage:     counts[0],
+			Capacity:    counts[1],
+			Size:        counts[2],
+		})
+	}
+	return filters, nil
+}
+
+// Info returns the statistics the server reports for the filter, such as
+// "capacity", "size", and "check_hits", by name.
+func (c *Client) Info(name string) (map[string]string, error) {
+	lines, err := c.do("info "+name, true, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]string, len(lines))
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, unexpected(line)
+		}
+		info[key] = value
+	}
+	return info, nil
+}
+
+// Check returns whether the key is a member of the filter.
+func (c *Client) Check(name string, key string) (bool, error) {
+	results, err := c.keys("c", name, []string{key})
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// Multi returns whether each of the keys is a member of the filter, in the
+// same order.
+func (c *Client) Multi(name string, keys ...string) ([]bool, error) {
+	return c.keys("m", name, keys)
+}
+
+// Set adds the key to the filter and returns true if it was newly added,
+// false if it was already a member.
+func (c *Client) Set(name string, key string) (bool, error) {
+	results, err := c.keys("s", name, []string{key})
+	if err != nil {
+		return false, err
+	}
+	return results[0], nil
+}
+
+// Bulk adds each of the keys to the filter and returns whether each was newly
+// added, in the same order.
+func (c *Client) Bulk(name string, keys ...string) ([]bool, error) {
+	return c.keys("b", name, keys)
+}
+
+// keys sends a command taking keys and parses its Yes or No for each key.
+func (c *Client) keys(command, name string, keys []string) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	lines, err := c.do(command+" "+name+" "+strings.Join(keys, " "), false, append([]string{name}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(lines[0])
+	if len(fields) != len(keys) {
+		return nil, unexpected(lines[0])
+	}
+	results := make([]bool, len(fields))
+	for i, field := range fields {
+		switch field {
+		case responseYes:
+			results[i] = true
+		case responseNo:
+		default:
+			return nil, unexpected(lines[0])
+		}
+	}
+	return results, nil
+}
+
+// done sends a command and returns an error unless its response is Done.
+func (c *Client) done(command string, args ...string) error {
+	lines, err := c.do(strings.Join(append([]string{command}, args...), " "), false, args...)
+	if err != nil {
+		return err
+	}
+	if lines[0] != responseDone {
+		return unexpected(lines[0])
+	}
+	return nil
+}
+
+// do sends the command line and returns the lines of its response, which are
+// those between START and END if multiline is true. It returns an error if
+// any of the tokens are empty or contain whitespace, if the filter doesn't
+// exist, or if the server reports an error.
+func (c *Client) do(command string, multiline bool, tokens ...string) ([]string, error) {
+	for _, token := range tokens {
+		if token == "" || strings.ContainsAny(token, " \t\r\n\v\f") {
+			return nil, fmt.Errorf("bloomd: invalid token %q", token)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write([]byte(command + "\n")); err != nil {
+		return nil, err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == responseNotExist {
+		return nil, ErrNoFilter
+	}
+	if strings.Contains(line, "Error") {
+		return nil, fmt.Errorf("bloomd: %s", line)
+	}
+	if !multiline {
+		return []string{line}, nil
+	}
+	if line != responseStart {
+		return nil, unexpected(line)
+	}
+
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == responseEnd {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// readLine reads a line of the response without its line ending.
+func (c *Client) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// unexpected returns an error for an unexpected response line.
+func unexpected(line string) error {
+	return fmt.Errorf("bloomd: unexpected response %q", line)
+}
@@ -30,17 +30,38 @@ to estimate event frequency for data streams.
 MinHash is a probabilistic algorithm to approximate the similarity between two
 sets. This can be used to cluster or compare documents by splitting the corpus
 into a bag of words.
+
+An Invertible Bloom Lookup Table can list the elements it holds as long as it
+isn't too full. Subtracting one from another leaves only the elements which
+differ between them, making it useful for reconciling replicated sets.
+
+The package builds with TinyGo and for WebAssembly, so filters built and
+serialized on a server can be checked in a browser or on a microcontroller.
+Features which depend on the Go runtime, such as NewMapHash, are excluded from
+TinyGo builds by the tinygo build tag.
 */
 package boom
 
 import (
-	"encoding/binary"
+	"errors"
 	"hash"
+	"hash/fnv"
 	"math"
+	"reflect"
 )
 
 const fillRatio = 0.5
 
+const (
+	// maxBits is the largest number of bits Buckets can hold without the
+	// byte count overflowing.
+	maxBits = ^uint(0) - 7
+
+	// maxK is the number of hash functions needed for the smallest positive
+	// float64 false-positive rate.
+	maxK = 1075
+)
+
 // Filter is a probabilistic data structure which is used to test the
 // membership of an element in a set.
 type Filter interface {
@@ -58,23 +79,346 @@ type Filter interface {
 }
 
 // OptimalM calculates the optimal Bloom filter size, m, based on the number of
-// items and the desired rate of false positives.
+// items and the desired rate of false positives. The size is capped at the
+// largest number of bits a filter can hold rather than wrapping around for
+// extreme parameters.
 func OptimalM(n uint, fpRate float64) uint {
-	return uint(math.Ceil(float64(n) / ((math.Log(fillRatio) *
-		math.Log(1-fillRatio)) / math.Abs(math.Log(fpRate)))))
+	m := optimalM(n, fpRate)
+	switch {
+	case math.IsNaN(m) || m < 1:
+		// A filter needs at least one bit to index into.
+		return 1
+	case m >= float64(maxBits):
+		return maxBits
+	}
+	return uint(m)
 }
 
 // OptimalK calculates the optimal number of hash functions to use for a Bloom
-// filter based on the desired rate of false positives.
+// filter based on the desired rate of false positives. The result is at least
+// one and capped at the number needed for the smallest positive rate.
 func OptimalK(fpRate float64) uint {
-	return uint(math.Ceil(math.Log2(1 / fpRate)))
+	k := math.Ceil(math.Log2(1 / fpRate))
+	switch {
+	case math.IsNaN(k) || k < 1:
+		return 1
+	case k > maxK:
+		return maxK
+	}
+	return uint(k)
+}
+
+// OptimalFractionalK calculates the optimal, generally non-integer, number of
+// hash functions for a Bloom filter of m bits storing n items, ln(2) * m / n.
+// The result is at least one and capped at the number needed for the smallest
+// positive rate.
+func OptimalFractionalK(m, n uint) float64 {
+	k := math.Ln2 * float64(m) / float64(n)
+	switch {
+	case math.IsNaN(k) || k < 1:
+		return 1
+	case k > maxK:
+		return maxK
+	}
+	return k
+}
+
+// EstimateParameters returns the size, m, and number of hash functions, k, of
+// a Bloom filter optimized to store n items with a specified target
+// false-positive rate. They're the parameters NewBloomFilter uses, so a filter
+// can be sized, for example against a memory budget, before it's created.
+func EstimateParameters(n uint, fpRate float64) (m, k uint) {
+	return OptimalM(n, fpRate), OptimalK(fpRate)
+}
+
+// AchievableFPRate returns the lowest false-positive rate a Bloom filter of m
+// bits can achieve when storing n items, which it does with the whole number
+// of hash functions closest to optimal. A memory budget of b bytes is 8 * b
+// bits.
+func AchievableFPRate(m, n uint) float64 {
+	if n == 0 {
+		return 0
+	}
+	k := math.Max(math.Floor(OptimalFractionalK(m, n)), 1)
+	return math.Min(ExpectedFPRate(m, uint(k), n), ExpectedFPRate(m, uint(k)+1, n))
+}
+
+// ExpectedFPRate returns the expected false-positive rate of a Bloom filter of
+// m bits and k hash functions holding n items, such as a filter's Capacity, K,
+// and Count. Unlike the EstimateFPRate methods, it assumes the items are
+// distinct, since it can't observe the filter's fill ratio.
+func ExpectedFPRate(m, k, n uint) float64 {
+	if m == 0 {
+		return 1
+	}
+	return estimatedFPRate(m, k, n)
+}
+
+// optimalM calculates the optimal Bloom filter size in float64 so that it can
+// be checked for overflow.
+func optimalM(n uint, fpRate float64) float64 {
+	return math.Ceil(float64(n) / ((math.Log(fillRatio) *
+		math.Log(1-fillRatio)) / math.Abs(math.Log(fpRate))))
+}
+
+// OptimalStableCells calculates the number of cells a Stable Bloom Filter
+// with d bits per cell needs so that an element is expected to survive n
+// subsequent additions before being evicted, while maintaining the desired
+// rate of false positives.
+func OptimalStableCells(n uint, d uint8, fpRate float64) uint {
+	var (
+		k        = stableK(fpRate)
+		max      = math.Pow(2, float64(d)) - 1
+		subDenom = math.Pow(1-math.Pow(fpRate, 1/float64(k)), 1/max)
+		p        = float64(k) / (1/subDenom - 1)
+	)
+
+	// Every addition decrements p of the m cells, so a cell set to max is
+	// expected to reach zero after m * max / p additions.
+	m := uint(math.Ceil(float64(n) * p / max))
+	if m < k {
+		m = k
+	}
+
+	return m
+}
+
+// OptimalCMSWidthDepth calculates the width and depth of a Count-Min Sketch
+// matrix whose relative accuracy is within a factor of epsilon with
+// probability delta.
+func OptimalCMSWidthDepth(epsilon, delta float64) (uint, uint) {
+	return uint(math.Ceil(math.E / epsilon)), uint(math.Ceil(math.Log(1 / delta)))
+}
+
+// OptimalHLLPrecision calculates the precision, p, for a HyperLogLog with the
+// desired standard error. The HyperLogLog should use 2^p registers.
+func OptimalHLLPrecision(stdErr float64) uint {
+	return uint(math.Ceil(math.Log2(math.Pow(1.04/stdErr, 2))))
+}
+
+// estimatedFPRate returns the expected false-positive rate of a Bloom filter
+// with m bits and k hash functions holding n items.
+func estimatedFPRate(m, k, n uint) float64 {
+	return estimatedFractionalFPRate(m, float64(k), n)
+}
+
+// estimatedFractionalFPRate is like estimatedFPRate for a possibly non-integer
+// number of hash functions.
+func estimatedFractionalFPRate(m uint, k float64, n uint) float64 {
+	return math.Pow(1-math.Exp(-k*float64(n)/float64(m)), k)
+}
+
+// validateN returns an error if the number of items, n, is zero.
+func validateN(n uint) error {
+	if n == 0 {
+		return errors.New("n must be positive")
+	}
+	return nil
+}
+
+// validateRate returns an error if the named rate isn't strictly between zero
+// and one.
+func validateRate(name string, rate float64) error {
+	if !(rate > 0 && rate < 1) {
+		return errors.New(name + " must be between 0 and 1")
+	}
+	return nil
+}
+
+// validateBucketSize returns an error if the named bucket size can't be
+// stored by Buckets.
+func validateBucketSize(name string, b uint8) error {
+	if b == 0 || b > 32 {
+		return errors.New(name + " must be between 1 and 32")
+	}
+	return nil
+}
+
+// validateSize returns an error if a filter optimized for n items and the
+// false-positive rate with b-bit buckets needs more bits than it can hold.
+func validateSize(n uint, fpRate float64, b uint8) error {
+	if optimalM(n, fpRate)*float64(b) >= float64(maxBits) {
+		return errors.New("filter size overflows")
+	}
+	return nil
+}
+
+// Indexing is the scheme a BloomFilter uses to derive the indices of an item's
+// bits from the lower and upper 32 bits of its hash. Filters with more than
+// 2^32 bits derive them from the whole 64-bit hash instead, so their bits are
+// spread over the entire filter.
+type Indexing uint8
+
+const (
+	// DoubleHashing derives the ith index as lower + upper * i, per Kirsch and
+	// Mitzenmacher. It's the default and the fastest, but the indices of
+	// items whose hashes collide modulo m collide entirely, so the realized
+	// false-positive rate exceeds the theoretical one, increasingly so at
+	// high fill and large K.
+	DoubleHashing Indexing = iota
+
+	// EnhancedDoubleHashing adds (i^3 - i) / 6 to the ith index, per
+	// Dillinger and Manolios, so that items which collide in one index
+	// rarely collide in the rest.
+	EnhancedDoubleHashing
+
+	// TripleHashing adds i * (i - 1) / 2 times a third hash, mixed from the
+	// other two, to the ith index, per Dillinger and Manolios. It tracks the
+	// theoretical false-positive rate most closely.
+	TripleHashing
+)
+
+// index returns the ith of the indices, modulo m, derived from the base hash
+// values. Indices derived from 32-bit values only reach about k * 2^32, so
+// filters with more than 2^32 cells use index64 instead.
+func (x Indexing) index(lower, upper uint32, i, m uint) uint {
+	if uint64(m) > math.MaxUint32 {
+		return x.index64(lower, upper, i, m)
+	}
+	idx := uint(lower) + uint(upper)*i
+	switch x {
+	case EnhancedDoubleHashing:
+		idx += (i*i*i - i) / 6
+	case TripleHashing:
+		third := uint(fmix64(uint64(upper)<<32|uint64(lower)) >> 32)
+		idx += i * (i - 1) / 2 * third
+	}
+	return idx % m
+}
+
+// index64 is index with 64-bit base hash values, so that indices are spread
+// uniformly over filters of any size. The first is the full 64-bit hash, and
+// the second is the hash mixed with MurmurHash3's fmix64 finalizer and made
+// odd. The third hash for TripleHashing is the second mixed again.
+func (x Indexing) index64(lower, upper uint32, i, m uint) uint {
+	var (
+		h1 = uint64(upper)<<32 | uint64(lower)
+		h2 = fmix64(h1) | 1
+		j  = uint64(i)
+	)
+	idx := h1 + h2*j
+	switch x {
+	case EnhancedDoubleHashing:
+		idx += (j*j*j - j) / 6
+	case TripleHashing:
+		idx += j * (j - 1) / 2 * fmix64(h2)
+	}
+	return uint(idx % uint64(m))
+}
+
+// newDefaultHash returns a new instance of the default hashing function, which
+// is FNV-1 unless changed with SetDefaultHash.
+var newDefaultHash = fnv.New64
+
+// SetDefaultHash sets the function creating the hashing function used by the
+// filters and sketches created or decoded afterward, such as NewXXHash, in
+// place of 64-bit FNV-1, which is slower for long keys. A nil function
+// restores FNV-1. It isn't safe to call concurrently with creating filters,
+// so it should be called during initialization. Filters hashed differently
+// answer differently, so every process sharing serialized filters must use
+// the same default.
+//
+// InverseBloomFilter, HyperLogLog, and SuRF hash with 32-bit FNV, and
+// AggregatingBloomFilter with FNV-1 since its AddHash and TestHash take FNV-1
+// hashes, so they ignore the default. ShardedFilter, ConsistentShardedFilter,
+// and StrataEstimator also route keys with a fixed hash, so keys are routed
+// the same in every process, but the structures they route to use the
+// default.
+func SetDefaultHash(newHash func() hash.Hash64) {
+	if newHash == nil {
+		newHash = fnv.New64
+	}
+	newDefaultHash = newHash
 }
 
 // hashKernel returns the upper and lower base hash values from which the k
-// hashes are derived.
+// hashes are derived. It uses Sum64 rather than Sum, which would allocate the
+// digest on every call, so Add and Test don't allocate.
 func hashKernel(data []byte, hash hash.Hash64) (uint32, uint32) {
 	hash.Write(data)
-	sum := hash.Sum(nil)
+	sum := sum64(hash)
 	hash.Reset()
-	return binary.BigEndian.Uint32(sum[4:8]), binary.BigEndian.Uint32(sum[0:4])
+	return uint32(sum), uint32(sum >> 32)
+}
+
+// pointerSize is the size of a pointer or machine word in bytes.
+const pointerSize = 4 << (^uint(0) >> 63)
+
+// byteSize returns the ByteSize of the structure, or zero if it doesn't report
+// its size.
+func byteSize(structure interface{}) uint {
+	if sized, ok := structure.(interface{ ByteSize() uint }); ok {
+		return sized.ByteSize()
+	}
+	return 0
+}
+
+// ErrHashNotCloneable is returned when copying a structure whose hashing
+// function, set with SetHash, doesn't implement hash.Cloner. Sharing the hash
+// would make the copy unsafe to use concurrently with the original.
+var ErrHashNotCloneable = errors.New("hash can't be cloned")
+
+// copyHash64 returns a new instance of the hashing function for a copy of a
+// structure, so that the copy and the original can be used concurrently. The
+// structures reset their hashes after every use, so the clone's state is the
+// initial one. Returns ErrHashNotCloneable if the hash can't be cloned.
+func copyHash64(h hash.Hash64) (hash.Hash64, error) {
+	if h == nil {
+		return nil, nil
+	}
+	if cloner, ok := h.(hash.Cloner); ok {
+		if clone, err := cloner.Clone(); err == nil {
+			if h64, ok := clone.(hash.Hash64); ok {
+				return h64, nil
+			}
+		}
+	}
+	return nil, ErrHashNotCloneable
+}
+
+// copyHash32 is like copyHash64 for 32-bit hashes.
+func copyHash32(h hash.Hash32) (hash.Hash32, error) {
+	if h == nil {
+		return nil, nil
+	}
+	if cloner, ok := h.(hash.Cloner); ok {
+		if clone, err := cloner.Clone(); err == nil {
+			if h32, ok := clone.(hash.Hash32); ok {
+				return h32, nil
+			}
+		}
+	}
+	return nil, ErrHashNotCloneable
+}
+
+// sameHash returns whether two hashes are the same hashing function, judged by
+// their types and, for NewSipHash, their keys, so that filters using them can
+// be combined. Hashes returned by NewMapHash share a seed, so they're the same
+// function.
+func sameHash(a, b interface{}) bool {
+	if sa, ok := a.(*sipHash); ok {
+		sb, ok := b.(*sipHash)
+		return ok && sa.k0 == sb.k0 && sa.k1 == sb.k1
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+// hashKernelString is equivalent to hashKernel for the bytes of the string.
+// It doesn't allocate for the default FNV-1 hash, NewXXHash, NewSipHash, or
+// NewMapHash, which can be computed without converting the string to a byte
+// slice.
+func hashKernelString(data string, hash hash.Hash64) (uint32, uint32) {
+	var sum uint64
+	if reflect.TypeOf(hash) == fnv64Type {
+		sum = fnv64String(data)
+	} else if _, ok := hash.(*xxHash); ok {
+		sum = xxHash64(data)
+	} else if sip, ok := hash.(*sipHash); ok {
+		sum = sipHash24(sip.k0, sip.k1, data)
+	} else if mapSum, ok := mapHashString(hash, data); ok {
+		sum = mapSum
+	} else {
+		return hashKernel([]byte(data), hash)
+	}
+	return uint32(sum), uint32(sum >> 32)
 }
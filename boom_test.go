@@ -0,0 +1,1201 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Ensures that indices are unchanged for filters of up to 2^32 cells and are
+// spread over the whole filter for larger ones.
+func TestIndex64(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		sum := fnv64([]byte(strconv.Itoa(i)))
+		lower, upper := uint32(sum), uint32(sum>>32)
+		for j := uint(0); j < 7; j++ {
+			if idx := DoubleHashing.index(lower, upper, j, 1000); idx != (uint(lower)+uint(upper)*j)%1000 {
+				t.Errorf("Expected %d, got %d", (uint(lower)+uint(upper)*j)%1000, idx)
+			}
+		}
+	}
+
+	if bits.UintSize < 64 {
+		t.Skip("filters of more than 2^32 cells need 64-bit indices")
+	}
+	var (
+		size  = uint64(40e9)
+		m     = uint(size)
+		limit = uint64(7) << 32
+	)
+	for _, indexing := range []Indexing{DoubleHashing, EnhancedDoubleHashing, TripleHashing} {
+		high := 0
+		for i := 0; i < 10000; i++ {
+			sum := fnv64([]byte(strconv.Itoa(i)))
+			for j := uint(0); j < 7; j++ {
+				idx := indexing.index(uint32(sum), uint32(sum>>32), j, m)
+				if idx >= m {
+					t.Fatalf("Expected index below %d, got %d", m, idx)
+				}
+				if uint64(idx) >= limit {
+					high++
+				}
+			}
+		}
+
+		// 32-bit indices never exceed about 7 * 2^32 with 7 hash functions.
+		expected := 1 - float64(limit)/float64(m)
+		if ratio := float64(high) / 70000; math.Abs(ratio-expected) > 0.02 {
+			t.Errorf("%d: Expected %f of indices above 7 * 2^32, got %f", indexing, expected, ratio)
+		}
+	}
+}
+
+// Ensures that OptimalStableCells grows with the number of additions an
+// element must survive and never returns fewer cells than hash functions.
+func TestOptimalStableCells(t *testing.T) {
+	small := OptimalStableCells(1000, 1, 0.01)
+	large := OptimalStableCells(100000, 1, 0.01)
+
+	if small >= large {
+		t.Errorf("Expected %d to be less than %d", small, large)
+	}
+
+	if m := OptimalStableCells(0, 1, 0.01); m != stableK(0.01) {
+		t.Errorf("Expected %d, got %d", stableK(0.01), m)
+	}
+}
+
+// Ensures that OptimalM never returns zero.
+func TestOptimalMNonZero(t *testing.T) {
+	if m := OptimalM(0, 0.01); m != 1 {
+		t.Errorf("Expected 1, got %d", m)
+	}
+
+	if m := OptimalM(100, 1); m != 1 {
+		t.Errorf("Expected 1, got %d", m)
+	}
+}
+
+// Ensures that OptimalM and OptimalK are capped rather than wrapping around
+// for extreme parameters.
+func TestOptimalMKOverflow(t *testing.T) {
+	if m := OptimalM(^uint(0), 1e-300); m != maxBits {
+		t.Errorf("Expected %d, got %d", maxBits, m)
+	}
+
+	if m := OptimalM(100, 0); m != maxBits {
+		t.Errorf("Expected %d, got %d", maxBits, m)
+	}
+
+	if k := OptimalK(0); k != maxK {
+		t.Errorf("Expected %d, got %d", maxK, k)
+	}
+
+	if k := OptimalK(1); k != 1 {
+		t.Errorf("Expected 1, got %d", k)
+	}
+
+	if _, err := NewBloomFilterE(^uint(0), 1e-300); err == nil {
+		t.Error("Expected error for filter size overflow")
+	}
+
+	if _, err := NewCountingBloomFilterE(^uint(0)/16, 32, 0.01); err == nil {
+		t.Error("Expected error for filter size overflow")
+	}
+}
+
+// Ensures that OptimalCMSWidthDepth returns the expected matrix dimensions.
+func TestOptimalCMSWidthDepth(t *testing.T) {
+	width, depth := OptimalCMSWidthDepth(0.001, 0.01)
+
+	if width != 2719 {
+		t.Errorf("Expected 2719, got %d", width)
+	}
+
+	if depth != 5 {
+		t.Errorf("Expected 5, got %d", depth)
+	}
+}
+
+// Ensures that OptimalHLLPrecision returns the expected precision.
+func TestOptimalHLLPrecision(t *testing.T) {
+	if p := OptimalHLLPrecision(0.1); p != 7 {
+		t.Errorf("Expected 7, got %d", p)
+	}
+
+	if p := OptimalHLLPrecision(0.01); p != 14 {
+		t.Errorf("Expected 14, got %d", p)
+	}
+}
+
+// Ensures that OptimalFractionalK computes ln(2) * m / n, clamped to at least
+// one.
+func TestOptimalFractionalK(t *testing.T) {
+	if k := OptimalFractionalK(1000, 100); k < 6.93 || k > 6.94 {
+		t.Errorf("Expected 6.93, got %f", k)
+	}
+
+	if k := OptimalFractionalK(10, 100); k != 1 {
+		t.Errorf("Expected 1, got %f", k)
+	}
+}
+
+// Ensures that filters round-trip through WriteTo and ReadFrom.
+func TestFilterWriteToReadFrom(t *testing.T) {
+	counting := NewCountingBloomFilter(100, 2, 0.01)
+	counting.EnableSpill()
+	tests := []struct {
+		filter interface {
+			Filter
+			io.WriterTo
+		}
+		decoded interface {
+			Filter
+			io.ReaderFrom
+		}
+	}{
+		{counting, &CountingBloomFilter{}},
+		{NewPartitionedBloomFilter(100, 0.01), &PartitionedBloomFilter{}},
+		{NewScalableBloomFilter(10, 0.01, 0.8), &ScalableBloomFilter{}},
+		{NewDefaultStableBloomFilter(1000, 0.01), &StableBloomFilter{}},
+		{NewInverseBloomFilter(100), &InverseBloomFilter{}},
+		{NewRetouchedBloomFilter(100, 0.01), &RetouchedBloomFilter{}},
+		{NewYesNoBloomFilter(100, 0.01, 10, 0.01), &YesNoBloomFilter{}},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			test.filter.Add([]byte(strconv.Itoa(i % 50)))
+		}
+
+		var buf bytes.Buffer
+		written, err := test.filter.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != int64(buf.Len()) {
+			t.Errorf("%T: Expected %d bytes written, got %d", test.filter, buf.Len(), written)
+		}
+		data := buf.Bytes()
+
+		read, err := test.decoded.ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%T: %v", test.decoded, err)
+		}
+		if read != written {
+			t.Errorf("%T: Expected %d bytes read, got %d", test.decoded, written, read)
+		}
+		for i := 0; i < 200; i++ {
+			data := []byte(strconv.Itoa(i))
+			if test.decoded.Test(data) != test.filter.Test(data) {
+				t.Errorf("%T: Expected decoded filter to agree for `%s`", test.decoded, data)
+			}
+		}
+
+		// Decoded filters can still be added to.
+		test.decoded.Add([]byte(`a`))
+		if !test.decoded.Test([]byte(`a`)) {
+			t.Errorf("%T: `a` should be a member", test.decoded)
+		}
+
+		if _, err := test.decoded.ReadFrom(bytes.NewReader(data[:len(data)-1])); err == nil {
+			t.Errorf("%T: Expected error for truncated data", test.decoded)
+		}
+	}
+
+	// Spilled excess is preserved.
+	decoded := tests[0].decoded.(*CountingBloomFilter)
+	if decoded.Spilled() != counting.Spilled() || counting.Spilled() == 0 {
+		t.Errorf("Expected %d spilled buckets, got %d", counting.Spilled(), decoded.Spilled())
+	}
+}
+
+// Ensures that structures can be embedded in values encoded with encoding/gob.
+func TestGob(t *testing.T) {
+	type snapshot struct {
+		Name     string
+		Bloom    *BloomFilter
+		Counting *CountingBloomFilter
+		Scalable *ScalableBloomFilter
+		CMS      *CountMinSketch
+		Buckets  *Buckets
+	}
+	before := snapshot{
+		Name:     "users",
+		Bloom:    NewBloomFilter(100, 0.01),
+		Counting: NewDefaultCountingBloomFilter(100, 0.01),
+		Scalable: NewDefaultScalableBloomFilter(0.01),
+		CMS:      NewCountMinSketch(0.01, 0.99),
+		Buckets:  NewBuckets(10, 4),
+	}
+	for i := 0; i < 100; i++ {
+		data := []byte(strconv.Itoa(i))
+		before.Bloom.Add(data)
+		before.Counting.Add(data)
+		before.Scalable.Add(data)
+		before.CMS.Add(data)
+	}
+	before.Buckets.Set(3, 9)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(before); err != nil {
+		t.Fatal(err)
+	}
+	var after snapshot
+	if err := gob.NewDecoder(&buf).Decode(&after); err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Name != "users" || after.Buckets.Get(3) != 9 || after.CMS.TotalCount() != 100 {
+		t.Errorf("Unexpected snapshot %+v", after)
+	}
+	for i := 0; i < 100; i++ {
+		data := []byte(strconv.Itoa(i))
+		if !after.Bloom.Test(data) || !after.Counting.Test(data) || !after.Scalable.Test(data) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+}
+
+// recordingHash is a hash.Hash64 which counts the data written to it.
+type recordingHash struct {
+	hash.Hash64
+	writes int
+}
+
+func (r *recordingHash) Write(p []byte) (int, error) {
+	r.writes++
+	return r.Hash64.Write(p)
+}
+
+// recordingHash32 is a hash.Hash32 which counts the data written to it.
+type recordingHash32 struct {
+	hash.Hash32
+	writes int
+}
+
+func (r *recordingHash32) Write(p []byte) (int, error) {
+	r.writes++
+	return r.Hash32.Write(p)
+}
+
+// Ensures that filters use the hash provided to SetHash, including the
+// filters a ScalableBloomFilter adds as it grows.
+func TestSetHash(t *testing.T) {
+	tests := []struct {
+		filter interface {
+			Filter
+			SetHash(hash.Hash64)
+		}
+	}{
+		{NewCountingBloomFilter(100, 4, 0.01)},
+		{NewPartitionedBloomFilter(100, 0.01)},
+		{NewScalableBloomFilter(10, 0.01, 0.8)},
+		{NewDefaultStableBloomFilter(10000, 0.01)},
+		{NewRetouchedBloomFilter(100, 0.01)},
+	}
+
+	for _, test := range tests {
+		h := &recordingHash{Hash64: fnv.New64a()}
+		test.filter.SetHash(h)
+		for i := 0; i < 100; i++ {
+			test.filter.Add([]byte(strconv.Itoa(i)))
+		}
+		if h.writes < 100 {
+			t.Errorf("%T: Expected at least 100 writes, got %d", test.filter, h.writes)
+		}
+
+		writes := h.writes
+		if !test.filter.Test([]byte(`99`)) {
+			t.Errorf("%T: `99` should be a member", test.filter)
+		}
+		if h.writes == writes {
+			t.Errorf("%T: Expected Test to use the hash", test.filter)
+		}
+	}
+
+	if s := tests[2].filter.(*ScalableBloomFilter); len(s.filters) < 2 {
+		t.Errorf("Expected the filter to grow, got %d filters", len(s.filters))
+	}
+
+	h := &recordingHash{Hash64: fnv.New64a()}
+	cms := NewCountMinSketch(0.001, 0.99)
+	cms.SetHash(h)
+	cms.Add([]byte(`a`)).Add([]byte(`a`))
+	if h.writes == 0 || cms.Count([]byte(`a`)) != 2 {
+		t.Errorf("Expected the sketch to use the hash, got %d writes", h.writes)
+	}
+
+	h = &recordingHash{Hash64: fnv.New64a()}
+	odd := NewOddSketch(1024)
+	odd.SetHash(h)
+	odd.Add([]byte(`a`))
+	if h.writes == 0 {
+		t.Error("Expected the odd sketch to use the hash")
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h32 := &recordingHash32{Hash32: fnv.New32a()}
+	hll.SetHash(h32)
+	hll.Add([]byte(`a`))
+	if h32.writes == 0 || hll.Count() != 1 {
+		t.Errorf("Expected the HyperLogLog to use the hash, got %d writes", h32.writes)
+	}
+
+	h32 = &recordingHash32{Hash32: fnv.New32a()}
+	inverse := NewInverseBloomFilter(100)
+	inverse.SetHash(h32)
+	if !inverse.Add([]byte(`a`)).Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	if h32.writes == 0 {
+		t.Error("Expected the inverse filter to use the hash")
+	}
+}
+
+// Ensures that AddHash and TestHash agree with Add and Test for data with the
+// same hash.
+func TestAddHashTestHash(t *testing.T) {
+	tests := []struct {
+		filter interface {
+			Filter
+			AddHash(lower, upper uint32) Filter
+			TestHash(lower, upper uint32) bool
+		}
+	}{
+		{NewBloomFilter(100, 0.01)},
+		{NewDefaultCountingBloomFilter(100, 0.01)},
+		{NewPartitionedBloomFilter(100, 0.01)},
+		{NewScalableBloomFilter(10, 0.01, 0.8)},
+		{NewStableBloomFilter(10000, 8, 0.01)},
+		{NewRetouchedBloomFilter(100, 0.01)},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			data := []byte(strconv.Itoa(i))
+			sum := fnv64(data)
+			if i%2 == 0 {
+				if test.filter.AddHash(uint32(sum), uint32(sum>>32)) != test.filter {
+					t.Errorf("%T: Returned filter should be the same instance", test.filter)
+				}
+			} else {
+				test.filter.Add(data)
+			}
+		}
+
+		for i := 0; i < 100; i++ {
+			data := []byte(strconv.Itoa(i))
+			sum := fnv64(data)
+			if !test.filter.Test(data) || !test.filter.TestHash(uint32(sum), uint32(sum>>32)) {
+				t.Errorf("%T: `%s` should be a member", test.filter, data)
+			}
+		}
+	}
+
+	a := NewAggregatingBloomFilter(100, 0.01)
+	sum := fnv64([]byte(`a`))
+	a.Shard().AddHash(uint32(sum), uint32(sum>>32))
+	if !a.Test([]byte(`a`)) || !a.TestHash(uint32(sum), uint32(sum>>32)) {
+		t.Error("`a` should be a member")
+	}
+}
+
+// Ensures that AddMany and TestMany agree with Add and Test.
+func TestAddManyTestMany(t *testing.T) {
+	tests := []struct {
+		filter interface {
+			Filter
+			AddMany([][]byte) Filter
+			TestMany([][]byte) []bool
+		}
+	}{
+		{NewBloomFilter(100, 0.01)},
+		{NewDefaultCountingBloomFilter(100, 0.01)},
+		{NewPartitionedBloomFilter(100, 0.01)},
+		{NewScalableBloomFilter(10, 0.01, 0.8)},
+		{NewStableBloomFilter(10000, 8, 0.01)},
+		{NewRetouchedBloomFilter(100, 0.01)},
+		{Synchronized(NewBloomFilter(100, 0.01))},
+		{Synchronized(NewInverseBloomFilter(1000))},
+		{NewAggregatingBloomFilter(100, 0.01).Shard()},
+	}
+
+	data := make([][]byte, 200)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+
+	for _, test := range tests {
+		if test.filter.AddMany(data[:100]) != test.filter {
+			t.Errorf("%T: Returned filter should be the same instance", test.filter)
+		}
+
+		results := test.filter.TestMany(data)
+		if len(results) != len(data) {
+			t.Fatalf("%T: Expected %d results, got %d", test.filter, len(data), len(results))
+		}
+		for i, member := range results {
+			if member != test.filter.Test(data[i]) {
+				t.Errorf("%T: Expected TestMany to agree with Test for `%s`", test.filter, data[i])
+			}
+			if i < 100 && !member {
+				t.Errorf("%T: `%s` should be a member", test.filter, data[i])
+			}
+		}
+	}
+}
+
+// Ensures that AddString, TestString, and TestAndAddString agree with Add,
+// Test, and TestAndAdd, and don't allocate with the default hash.
+func TestAddStringTestString(t *testing.T) {
+	customHashed := NewPartitionedBloomFilter(100, 0.01)
+	customHashed.SetHash(fnv.New64a())
+	tests := []struct {
+		filter interface {
+			Filter
+			AddString(string) Filter
+			TestString(string) bool
+			TestAndAddString(string) bool
+		}
+		allocates bool
+	}{
+		{NewBloomFilter(100, 0.01), false},
+		{NewDefaultCountingBloomFilter(100, 0.01), false},
+		{NewPartitionedBloomFilter(100, 0.01), false},
+		{customHashed, true},
+		{NewScalableBloomFilter(1000, 0.01, 0.8), false},
+		{NewStableBloomFilter(10000, 8, 0.01), false},
+		{NewRetouchedBloomFilter(100, 0.01), false},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if i%2 == 0 {
+				test.filter.AddString(strconv.Itoa(i))
+			} else {
+				test.filter.Add([]byte(strconv.Itoa(i)))
+			}
+		}
+		for i := 0; i < 100; i++ {
+			data := strconv.Itoa(i)
+			if !test.filter.TestString(data) || !test.filter.Test([]byte(data)) {
+				t.Errorf("%T: `%s` should be a member", test.filter, data)
+			}
+		}
+		// Whether absent data is a false positive depends on the hash, so
+		// only agreement with Test is checked.
+		for i := 100; i < 1000; i++ {
+			data := strconv.Itoa(i)
+			if test.filter.TestString(data) != test.filter.Test([]byte(data)) {
+				t.Errorf("%T: Expected TestString to agree with Test for `%s`", test.filter, data)
+			}
+		}
+		member := test.filter.Test([]byte(`a`))
+		if test.filter.TestAndAddString(`a`) != member {
+			t.Errorf("%T: Expected TestAndAddString to agree with Test for `a`", test.filter)
+		}
+		if !test.filter.Test([]byte(`a`)) {
+			t.Errorf("%T: `a` should be a member", test.filter)
+		}
+
+		if test.allocates {
+			continue
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			test.filter.TestAndAddString("user-1234")
+			test.filter.TestString("user-5678")
+		})
+		if allocs != 0 {
+			t.Errorf("%T: Expected no allocations, got %.0f", test.filter, allocs)
+		}
+	}
+
+	a := NewAggregatingBloomFilter(100, 0.01)
+	a.Shard().AddString(`a`)
+	if !a.TestString(`a`) || !a.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+}
+
+// Ensures that Add, Test, and TestAndAdd don't allocate, including with a
+// hash which is hashed through hashKernel.
+func TestAddTestNoAllocs(t *testing.T) {
+	data := []byte(`user-1234`)
+	for _, newHash := range []func() hash.Hash64{fnv.New64, fnv.New64a, NewXXHash} {
+		customHashed := NewPartitionedBloomFilter(100, 0.01)
+		customHashed.SetHash(newHash())
+		counting := NewDefaultCountingBloomFilter(100, 0.01)
+		counting.SetHash(newHash())
+		stable := NewStableBloomFilter(10000, 8, 0.01)
+		stable.SetHash(newHash())
+		for _, f := range []Filter{customHashed, counting, stable} {
+			allocs := testing.AllocsPerRun(100, func() {
+				f.Add(data)
+				f.Test(data)
+				f.TestAndAdd(data)
+			})
+			if allocs != 0 {
+				t.Errorf("%T: Expected no allocations, got %.0f", f, allocs)
+			}
+		}
+	}
+}
+
+// Ensures that TestAndAdd reports membership as Test followed by Add would
+// for every deterministic filter, including filters which hash the data only
+// once.
+func TestTestAndAddAgrees(t *testing.T) {
+	newFilters := []func() Filter{
+		func() Filter { return NewBloomFilter(100, 0.1) },
+		func() Filter { return NewBlockedBloomFilter(100, 0.1) },
+		func() Filter { return NewConcurrentBloomFilter(100, 0.1) },
+		func() Filter { return NewDefaultCountingBloomFilter(100, 0.1) },
+		func() Filter { return NewPartitionedBloomFilter(100, 0.1) },
+		func() Filter { return NewScalableBloomFilter(10, 0.1, 0.8) },
+		func() Filter { return NewRetouchedBloomFilter(100, 0.1) },
+		func() Filter { return NewInverseBloomFilter(100) },
+		func() Filter { return NewYesNoBloomFilter(100, 0.1, 10, 0.1) },
+		func() Filter { return NewGuavaBloomFilter(100, 0.1) },
+		func() Filter { return NewCassandraBloomFilter(100, 0.1, CassandraCurrentFormat) },
+		func() Filter { return NewEthereumBloom() },
+		func() Filter { return NewBIP37BloomFilter(100, 0.1, 0, BIP37UpdateNone) },
+		func() Filter { return NewRocksDBBloomFilter(100, 5) },
+		func() Filter { return NewRedisBloomChain(10, 0.1, 2) },
+		func() Filter { return NewAggregatingBloomFilter(100, 0.1).Shard() },
+	}
+
+	for _, newFilter := range newFilters {
+		f, expected := newFilter(), newFilter()
+		for i := 0; i < 500; i++ {
+			data := []byte(strconv.Itoa(i % 400))
+			member := expected.Test(data)
+			expected.Add(data)
+			if f.TestAndAdd(data) != member {
+				t.Errorf("%T: Expected %v for `%s`", f, member, data)
+			}
+		}
+		if !f.Test([]byte(`99`)) {
+			t.Errorf("%T: `99` should be a member", f)
+		}
+	}
+}
+
+// Ensures that EstimateParameters matches the filters it sizes and that the
+// achievable and expected false-positive rates agree with it.
+func TestEstimateParameters(t *testing.T) {
+	m, k := EstimateParameters(1000, 0.01)
+	f := NewBloomFilter(1000, 0.01)
+	if m != f.Capacity() || k != f.K() {
+		t.Errorf("Expected (%d, %d), got (%d, %d)", f.Capacity(), f.K(), m, k)
+	}
+
+	achievable := AchievableFPRate(m, 1000)
+	if math.Abs(achievable-0.01) > 0.001 {
+		t.Errorf("Expected about 0.01, got %f", achievable)
+	}
+	for k := uint(1); k < 20; k++ {
+		if rate := ExpectedFPRate(m, k, 1000); rate < achievable {
+			t.Errorf("Expected at least %f with %d hash functions, got %f", achievable, k, rate)
+		}
+	}
+
+	if rate := AchievableFPRate(m, 0); rate != 0 {
+		t.Errorf("Expected 0, got %f", rate)
+	}
+	if rate := AchievableFPRate(m, 10000); rate <= achievable {
+		t.Errorf("Expected more than %f when overfilled, got %f", achievable, rate)
+	}
+
+	if rate := ExpectedFPRate(m, k, 0); rate != 0 {
+		t.Errorf("Expected 0, got %f", rate)
+	}
+	if rate := ExpectedFPRate(m, k, 1000); math.Abs(rate-0.01) > 0.002 {
+		t.Errorf("Expected about 0.01, got %f", rate)
+	}
+	if rate := ExpectedFPRate(0, k, 1000); rate != 1 {
+		t.Errorf("Expected 1, got %f", rate)
+	}
+}
+
+// Ensures that EstimateFPRate is zero for empty filters, close to the target
+// at capacity, and grows past it as filters are overfilled.
+func TestEstimateFPRate(t *testing.T) {
+	tests := []struct {
+		filter interface {
+			Filter
+			EstimateFPRate() float64
+		}
+		bounded bool
+	}{
+		{NewBloomFilter(1000, 0.01), false},
+		{NewCountingBloomFilter(1000, 4, 0.01), false},
+		{NewPartitionedBloomFilter(1000, 0.01), false},
+		{NewScalableBloomFilter(1000, 0.01, 0.8), true},
+		{NewRetouchedBloomFilter(1000, 0.01), false},
+	}
+
+	for _, test := range tests {
+		if rate := test.filter.EstimateFPRate(); rate != 0 {
+			t.Errorf("%T: Expected 0, got %f", test.filter, rate)
+		}
+
+		for i := 0; i < 1000; i++ {
+			test.filter.Add([]byte(strconv.Itoa(i)))
+		}
+		if rate := test.filter.EstimateFPRate(); rate < 0.002 || rate > 0.03 {
+			t.Errorf("%T: Expected about 0.01, got %f", test.filter, rate)
+		}
+
+		for i := 1000; i < 5000; i++ {
+			test.filter.Add([]byte(strconv.Itoa(i)))
+		}
+		rate := test.filter.EstimateFPRate()
+		if test.bounded && rate > 0.03 {
+			t.Errorf("%T: Expected at most 0.03, got %f", test.filter, rate)
+		}
+		if !test.bounded && rate < 0.1 {
+			t.Errorf("%T: Expected at least 0.1, got %f", test.filter, rate)
+		}
+	}
+
+	s := NewStableBloomFilter(10000, 1, 0.01)
+	for i := 0; i < 100000; i++ {
+		s.Add([]byte(strconv.Itoa(i)))
+	}
+	if rate := s.EstimateFPRate(); math.Abs(rate-s.FalsePositiveRate()) > 0.01 {
+		t.Errorf("Expected about %f once stable, got %f", s.FalsePositiveRate(), rate)
+	}
+}
+
+// Ensures that copies are independent of the original filters and can be used
+// concurrently with them.
+func TestCopy(t *testing.T) {
+	var (
+		bloom       = NewBloomFilter(1000, 0.001)
+		counting    = NewCountingBloomFilter(1000, 4, 0.001)
+		partitioned = NewPartitionedBloomFilter(1000, 0.001)
+		scalable    = NewScalableBloomFilter(50, 0.001, 0.8)
+		stable      = NewStableBloomFilter(100000, 8, 0.001)
+		inverse     = NewInverseBloomFilter(1000)
+		retouched   = NewRetouchedBloomFilter(1000, 0.001)
+		yesno       = NewYesNoBloomFilter(1000, 0.001, 10, 0.001)
+	)
+	counting.EnableSpill()
+	scalable.SetHash(fnv.New64())
+
+	tests := []struct {
+		filter Filter
+		copy   func() (Filter, error)
+	}{
+		{bloom, func() (Filter, error) { c, err := bloom.Copy(); return c, err }},
+		{counting, func() (Filter, error) { c, err := counting.Copy(); return c, err }},
+		{partitioned, func() (Filter, error) { c, err := partitioned.Copy(); return c, err }},
+		{scalable, func() (Filter, error) { c, err := scalable.Copy(); return c, err }},
+		{stable, func() (Filter, error) { c, err := stable.Copy(); return c, err }},
+		{inverse, func() (Filter, error) { c, err := inverse.Copy(); return c, err }},
+		{retouched, func() (Filter, error) { c, err := retouched.Copy(); return c, err }},
+		{yesno, func() (Filter, error) { c, err := yesno.Copy(); return c, err }},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			test.filter.Add([]byte(strconv.Itoa(i)))
+		}
+		copied, err := test.copy()
+		if err != nil {
+			t.Fatalf("%T: %v", test.filter, err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 100; i < 200; i++ {
+				test.filter.Add([]byte(strconv.Itoa(i)))
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			if !copied.Test([]byte(strconv.Itoa(i))) {
+				t.Errorf("%T: `%d` should be a member of the copy", copied, i)
+			}
+		}
+		copied.Add([]byte(`copy`))
+		wg.Wait()
+
+		if copied.Test([]byte(`150`)) {
+			t.Errorf("%T: `150` should not be a member of the copy", copied)
+		}
+		if test.filter.Test([]byte(`copy`)) {
+			t.Errorf("%T: `copy` should not be a member of the original", test.filter)
+		}
+	}
+
+	if copied, err := counting.Copy(); err != nil || copied.Spilled() != counting.Spilled() {
+		t.Error("Expected spilled buckets to be copied")
+	}
+	// A hash which can't be cloned would be shared with the copy, so it's an
+	// error.
+	bloom.SetHash(struct{ hash.Hash64 }{fnv.New64()})
+	if _, err := bloom.Copy(); err != ErrHashNotCloneable {
+		t.Errorf("Expected ErrHashNotCloneable, got %v", err)
+	}
+	scalable.SetHash(struct{ hash.Hash64 }{fnv.New64()})
+	if _, err := scalable.Copy(); err != ErrHashNotCloneable {
+		t.Errorf("Expected ErrHashNotCloneable, got %v", err)
+	}
+}
+
+// Ensures that copies of sketches are independent of the originals.
+func TestCopySketches(t *testing.T) {
+	cms := NewCountMinSketch(0.001, 0.99)
+	cms.Add([]byte(`a`))
+	cmsCopy, err := cms.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cms.Add([]byte(`a`))
+	if count := cmsCopy.Count([]byte(`a`)); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hll.Add([]byte(`a`))
+	hllCopy, err := hll.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hll.Add([]byte(`b`))
+	if count := hllCopy.Count(); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+
+	topk := NewDecayedTopK(0.001, 0.99, 5, time.Hour)
+	topk.Add([]byte(`a`))
+	topkCopy, err := topk.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topk.Add([]byte(`a`))
+	if elements := topkCopy.Elements(); len(elements) != 1 || elements[0].Score > 1.01 {
+		t.Errorf("Expected one element with a score of 1, got %v", elements)
+	}
+
+	odd := NewOddSketch(1024)
+	odd.Add([]byte(`a`))
+	oddCopy, err := odd.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd.Add([]byte(`b`))
+	if diff, err := odd.SymmetricDifference(oddCopy); err != nil || diff == 0 {
+		t.Errorf("Expected the copy to be independent, got %f, %v", diff, err)
+	}
+}
+
+// Ensures that structures equal their copies and round-tripped encodings, but
+// not once they diverge.
+func TestEqual(t *testing.T) {
+	bloom := NewBloomFilter(100, 0.01)
+	counting := NewCountingBloomFilter(100, 2, 0.01)
+	counting.EnableSpill()
+	partitioned := NewPartitionedBloomFilter(100, 0.01)
+	scalable := NewScalableBloomFilter(10, 0.01, 0.8)
+	stable := NewDefaultStableBloomFilter(1000, 0.01)
+	inverse := NewInverseBloomFilter(100)
+	retouched := NewRetouchedBloomFilter(100, 0.01)
+	yesno := NewYesNoBloomFilter(100, 0.01, 10, 0.01)
+	cms := NewCountMinSketch(0.01, 0.99)
+	hll, err := NewHyperLogLog(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topk := NewDecayedTopK(0.01, 0.99, 5, time.Hour)
+	odd := NewOddSketch(1024)
+
+	tests := []struct {
+		name  string
+		add   func(data []byte)
+		equal func(diverge bool) bool
+	}{
+		{"bloom", func(d []byte) { bloom.Add(d) }, func(diverge bool) bool {
+			other := &BloomFilter{}
+			roundTrip(t, bloom, other)
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return bloom.Equal(other)
+		}},
+		{"counting", func(d []byte) { counting.Add(d) }, func(diverge bool) bool {
+			other, err := counting.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.TestAndRemove([]byte(`0`))
+			}
+			return counting.Equal(other)
+		}},
+		{"partitioned", func(d []byte) { partitioned.Add(d) }, func(diverge bool) bool {
+			other := &PartitionedBloomFilter{}
+			roundTrip(t, partitioned, other)
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return partitioned.Equal(other)
+		}},
+		{"scalable", func(d []byte) { scalable.Add(d) }, func(diverge bool) bool {
+			other := &ScalableBloomFilter{}
+			roundTrip(t, scalable, other)
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return scalable.Equal(other)
+		}},
+		{"stable", func(d []byte) { stable.Add(d) }, func(diverge bool) bool {
+			other, err := stable.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return stable.Equal(other)
+		}},
+		{"inverse", func(d []byte) { inverse.Add(d) }, func(diverge bool) bool {
+			other := &InverseBloomFilter{}
+			roundTrip(t, inverse, other)
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return inverse.Equal(other)
+		}},
+		{"retouched", func(d []byte) { retouched.Add(d) }, func(diverge bool) bool {
+			other, err := retouched.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return retouched.Equal(other)
+		}},
+		{"yesno", func(d []byte) { yesno.Add(d) }, func(diverge bool) bool {
+			other, err := yesno.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return yesno.Equal(other)
+		}},
+		{"cms", func(d []byte) { cms.Add(d) }, func(diverge bool) bool {
+			other, err := cms.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return cms.Equal(other)
+		}},
+		{"hll", func(d []byte) { hll.Add(d) }, func(diverge bool) bool {
+			other := &HyperLogLog{}
+			roundTrip(t, hll, other)
+			if diverge {
+				other.SetHash(fnv.New32a())
+			}
+			return hll.Equal(other)
+		}},
+		{"topk", func(d []byte) { topk.Add(d) }, func(diverge bool) bool {
+			other, err := topk.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return topk.Equal(other)
+		}},
+		{"odd", func(d []byte) { odd.Add(d) }, func(diverge bool) bool {
+			other, err := odd.Copy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diverge {
+				other.Add([]byte(`x`))
+			}
+			return odd.Equal(other)
+		}},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 50; i++ {
+			test.add([]byte(strconv.Itoa(i % 25)))
+		}
+		if !test.equal(false) {
+			t.Errorf("%s: Expected equal", test.name)
+		}
+		if test.equal(true) {
+			t.Errorf("%s: Expected not equal", test.name)
+		}
+	}
+}
+
+// roundTrip writes the structure with WriteTo and reads it into decoded.
+func roundTrip(t *testing.T, structure io.WriterTo, decoded io.ReaderFrom) {
+	var buf bytes.Buffer
+	if _, err := structure.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensures that ByteSize reports the size of the structures' data.
+func TestByteSize(t *testing.T) {
+	bloom := NewBloomFilter(1000, 0.01)
+	if size := bloom.ByteSize(); size != (bloom.Capacity()+7)/8 {
+		t.Errorf("Expected %d, got %d", (bloom.Capacity()+7)/8, size)
+	}
+	if size := Synchronized(bloom).ByteSize(); size != bloom.ByteSize() {
+		t.Errorf("Expected %d, got %d", bloom.ByteSize(), size)
+	}
+
+	counting := NewCountingBloomFilter(1000, 4, 0.01)
+	if size := counting.ByteSize(); size != (counting.Capacity()*4+7)/8 {
+		t.Errorf("Expected %d, got %d", (counting.Capacity()*4+7)/8, size)
+	}
+
+	cms := NewCountMinSketch(0.01, 0.99)
+	if size := cms.ByteSize(); size != cms.width*cms.depth*8 {
+		t.Errorf("Expected %d, got %d", cms.width*cms.depth*8, size)
+	}
+
+	scalable := NewScalableBloomFilter(10, 0.01, 0.8)
+	before := scalable.ByteSize()
+	for i := 0; i < 1000; i++ {
+		scalable.Add([]byte(strconv.Itoa(i)))
+	}
+	if size := scalable.ByteSize(); size <= before {
+		t.Errorf("Expected more than %d as the filter grows, got %d", before, size)
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yesno := NewYesNoBloomFilter(100, 0.01, 10, 0.01)
+	for _, structure := range []interface{ ByteSize() uint }{
+		NewPartitionedBloomFilter(100, 0.01),
+		NewDefaultStableBloomFilter(1000, 0.01),
+		NewInverseBloomFilter(100),
+		NewRetouchedBloomFilter(100, 0.01),
+		yesno,
+		hll,
+		NewDecayedTopK(0.01, 0.99, 5, time.Hour),
+		NewOddSketch(1024),
+		NewEthereumBloom(),
+		NewAggregatingBloomFilter(100, 0.01),
+		Typed(yesno, StringEncoder),
+	} {
+		if structure.ByteSize() == 0 {
+			t.Errorf("%T: Expected a non-zero size", structure)
+		}
+	}
+}
+
+// Ensures that every structure's String starts with its name and includes its
+// fields.
+func TestString(t *testing.T) {
+	bloom := NewBloomFilter(100, 0.01)
+	bloom.Add([]byte(`a`))
+	divergence, err := NewDivergenceDetector(0.01, 0.99, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hll, err := NewHyperLogLog(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	surf, err := NewSuccinctRangeFilter([][]byte{[]byte(`a`), []byte(`b`)}, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	autosaver, err := Autosave(filepath.Join(t.TempDir(), "filter"), NewBloomFilter(100, 0.01), time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer autosaver.Close()
+
+	for _, test := range []struct {
+		name   string
+		value  fmt.Stringer
+		fields []string
+	}{
+		{"AggregatingBloomFilter", NewAggregatingBloomFilter(100, 0.01), []string{"m", "k", "shards", "main"}},
+		{"Autosaver", autosaver, []string{"path", "pending", "filter"}},
+		{"BIP37BloomFilter", NewBIP37BloomFilter(100, 0.01, 5, BIP37UpdateNone), []string{"m", "k", "tweak", "flags", "count", "fp"}},
+		{"BlockedBloomFilter", NewBlockedBloomFilter(100, 0.01), []string{"m", "k", "blocks", "count", "fill"}},
+		{"BlockIndex", NewBlockIndex(100, 0.01), []string{"blocks", "m", "k"}},
+		{"CassandraBloomFilter", NewCassandraBloomFilter(100, 0.01, CassandraLegacyFormat), []string{"m", "k", "count", "fp"}},
+		{"BloomFilter", bloom, []string{"m", "k", "count", "fill", "fp"}},
+		{"CompositeFilter", NewCompositeFilter(10, NewBloomFilter(100, 0.01)), []string{"front", "absorbed", "back"}},
+		{"ConcurrentBloomFilter", NewConcurrentBloomFilter(100, 0.01), []string{"m", "k", "count", "fp"}},
+		{"ConsistentShardedFilter", NewConsistentShardedFilter(16), []string{"shards", "replicas"}},
+		{"CountingBloomFilter", NewCountingBloomFilter(100, 4, 0.01), []string{"m", "k", "b", "count", "fp"}},
+		{"CountMinSketch", NewCountMinSketch(0.01, 0.99), []string{"width", "depth", "epsilon", "delta", "count"}},
+		{"BloomFilterDiff", DiffBloomFilters(bloom, NewBloomFilter(100, 0.01)), []string{"compatible"}},
+		{"DivergenceDetector", divergence, []string{"baseline", "window", "cardinality", "similarity"}},
+		{"EthereumBloom", NewEthereumBloom(), []string{"m", "k", "count", "fp"}},
+		{"Evaluation", Evaluate(NewBloomFilter(100, 0.01), nil, nil), []string{"inserted", "probed", "fp", "fn", "fill"}},
+		{"FrequencySketch", NewFrequencySketch(100), []string{"counters", "sample", "size"}},
+		{"FrozenBloomFilter", bloom.Freeze(), []string{"m", "k", "count", "fp"}},
+		{"GCSFilter", NewGCSFilter(19, 1<<19, [16]byte{}, [][]byte{[]byte(`a`)}), []string{"n", "p", "m", "bytes", "fp"}},
+		{"GuavaBloomFilter", NewGuavaBloomFilter(100, 0.01), []string{"m", "k", "count", "strategy"}},
+		{"HierarchicalCountMinSketch", NewHierarchicalCountMinSketch(0.01, 0.99, 16), []string{"bits", "levels", "count"}},
+		{"HybridFilter", NewDefaultHybridFilter(10, 1000, 0.01), []string{"capacity", "front", "back"}},
+		{"HyperLogLog", hll, []string{"m", "b", "count", "stderr"}},
+		{"IBLT", NewIBLT(12, 3), []string{"m", "k"}},
+		{"InstrumentedFilter", Instrumented(NewBloomFilter(100, 0.01), newFakeRegisterer()), []string{"m", "k"}},
+		{"InverseBloomFilter", NewInverseBloomFilter(100), []string{"capacity"}},
+		{"OddSketch", NewOddSketch(1024), []string{"m", "k"}},
+		{"ParquetBloomFilter", NewParquetBloomFilter(100, 0.01), []string{"m", "k", "count", "fp"}},
+		{"PartitionedBloomFilter", NewPartitionedBloomFilter(100, 0.01), []string{"m", "k", "count", "fill", "fp"}},
+		{"BloomFilterPool", NewBloomFilterPool(100, 0.01), []string{"m", "k", "inUse", "bytes"}},
+		{"PrefixBloomFilter", NewPrefixBloomFilter(100, 0.01, FixedPrefix(2)), []string{"m", "k", "count", "fp"}},
+		{"RangeBloomFilter", NewRangeBloomFilter(100, 0.01, 8), []string{"levels", "count"}},
+		{"RedisBloomFilter", NewRedisBloomFilter(newFakeRedis(), "f", 100, 0.01), []string{"key", "m", "k"}},
+		{"RedisCountingBloomFilter", NewRedisCountingBloomFilter(newFakeRedis(), "f", 100, 4, 0.01), []string{"key", "m", "k", "b"}},
+		{"RedisBloomChain", NewRedisBloomChain(100, 0.01, 2), []string{"filters", "count", "expansion"}},
+		{"RetouchedBloomFilter", NewRetouchedBloomFilter(100, 0.01), []string{"m", "k", "count", "fp"}},
+		{"RocksDBBloomFilter", NewRocksDBBloomFilter(100, 10), []string{"m", "k", "lines", "count"}},
+		{"ScalableBloomFilter", NewDefaultScalableBloomFilter(0.01), []string{"filters", "m", "k", "r", "count", "fill", "fp"}},
+		{"ShardedFilter", NewShardedBloomFilter(100, 0.01, 4), []string{"shards", "count"}},
+		{"StableBloomFilter", NewDefaultStableBloomFilter(1000, 0.01), []string{"m", "k", "d", "p", "fp"}},
+		{"Stats", bloom.Stats(), []string{"m", "k", "count", "set", "fill"}},
+		{"StrataEstimator", NewStrataEstimator(), []string{"strata"}},
+		{"SuccinctRangeFilter", surf, []string{"count", "labels", "hashBits", "realBytes"}},
+		{"SwappableBloomFilter", NewSwappableBloomFilter(bloom.Freeze()), []string{"current"}},
+		{"SynchronizedFilter", Synchronized(NewBloomFilter(100, 0.01)), []string{"m", "k"}},
+		{"TinyLFU", NewTinyLFU(100), []string{"sample", "accesses", "doorkeeper", "sketch"}},
+		{"DecayedTopK", NewDecayedTopK(0.01, 0.99, 5, time.Hour), []string{"k", "halfLife", "width", "depth", "tracked"}},
+		{"TypedFilter", Typed(NewBloomFilter(100, 0.01), StringEncoder), []string{"m", "k"}},
+		{"YesNoBloomFilter", NewYesNoBloomFilter(100, 0.01, 10, 0.01), []string{"count", "falsePositives", "yes", "no"}},
+	} {
+		str := test.value.String()
+		if !strings.HasPrefix(str, test.name+"{") || !strings.HasSuffix(str, "}") || strings.Contains(str, "\n") {
+			t.Errorf("Expected a one-line %s summary, got %q", test.name, str)
+		}
+		for _, field := range test.fields {
+			if !strings.Contains(str, field+"=") {
+				t.Errorf("Expected %q to include %s", str, field)
+			}
+		}
+	}
+}
+
+// Ensures that String doesn't panic on structures which are zero values or
+// which failed to be read with ReadFrom.
+func TestStringZero(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value interface {
+			fmt.Stringer
+			io.ReaderFrom
+		}
+	}{
+		{"BIP37BloomFilter", &BIP37BloomFilter{}},
+		{"BlockedBloomFilter", &BlockedBloomFilter{}},
+		{"BlockIndex", &BlockIndex{}},
+		{"CassandraBloomFilter", &CassandraBloomFilter{}},
+		{"BloomFilter", &BloomFilter{}},
+		{"CountingBloomFilter", &CountingBloomFilter{}},
+		{"CountMinSketch", &CountMinSketch{}},
+		{"GuavaBloomFilter", &GuavaBloomFilter{}},
+		{"HierarchicalCountMinSketch", &HierarchicalCountMinSketch{}},
+		{"HyperLogLog", &HyperLogLog{}},
+		{"IBLT", &IBLT{}},
+		{"InverseBloomFilter", &InverseBloomFilter{}},
+		{"OddSketch", &OddSketch{}},
+		{"ParquetBloomFilter", &ParquetBloomFilter{}},
+		{"PartitionedBloomFilter", &PartitionedBloomFilter{}},
+		{"RangeBloomFilter", &RangeBloomFilter{}},
+		{"RetouchedBloomFilter", &RetouchedBloomFilter{}},
+		{"ScalableBloomFilter", &ScalableBloomFilter{}},
+		{"StableBloomFilter", &StableBloomFilter{}},
+		{"StrataEstimator", &StrataEstimator{}},
+		{"DecayedTopK", &DecayedTopK{}},
+		{"YesNoBloomFilter", &YesNoBloomFilter{}},
+	} {
+		if str := test.value.String(); !strings.HasPrefix(str, test.name+"{") {
+			t.Errorf("Expected a %s summary, got %q", test.name, str)
+		}
+		if _, err := test.value.ReadFrom(bytes.NewReader(nil)); err == nil {
+			t.Errorf("%s: Expected error for empty data", test.name)
+		}
+		if str := test.value.String(); !strings.HasPrefix(str, test.name+"{") {
+			t.Errorf("Expected a %s summary, got %q", test.name, str)
+		}
+	}
+}
+
+// Ensures that ReadFrom rejects forged headers, and reads data sized by them
+// as it arrives rather than allocating it up front.
+func TestReadFromForgedHeader(t *testing.T) {
+	forge := func(parts ...interface{}) *bytes.Buffer {
+		var buf bytes.Buffer
+		for _, part := range parts {
+			if b, ok := part.(*Buckets); ok {
+				b.WriteTo(&buf)
+				continue
+			}
+			binary.Write(&buf, binary.BigEndian, part)
+		}
+		return &buf
+	}
+
+	for _, test := range []struct {
+		name    string
+		decoded io.ReaderFrom
+		stream  *bytes.Buffer
+	}{
+		{"count-min overflow", &CountMinSketch{}, forge(cmsHeader{1 << 40, 1 << 20, 0, 0.1, 0.1})},
+		{"count-min truncated", &CountMinSketch{}, forge(cmsHeader{1 << 40, 1, 0, 0.1, 0.1})},
+		{"inverse zero capacity", &InverseBloomFilter{}, forge(uint64(0))},
+		{"inverse truncated", &InverseBloomFilter{}, forge(uint64(1), uint64(1<<40))},
+		{"top-k truncated", &DecayedTopK{}, forge(topKHeader{1 << 40, 1, 10, 1, 0, 0})},
+		{"top-k elements", &DecayedTopK{}, forge(topKHeader{1, 1, 1 << 62, 1, 0, 1 << 62}, 0.0)},
+		{"top-k element length", &DecayedTopK{}, forge(topKHeader{1, 1, 1, 1, 0, 1}, 0.0, uint64(1<<40))},
+		{"hierarchical truncated", &HierarchicalCountMinSketch{}, forge([]uint64{40, 0, 1 << 40})},
+		{"hyperloglog truncated", &HyperLogLog{}, forge([]uint64{1 << 32, 32, 0})},
+		{"partitioned zero size", &PartitionedBloomFilter{}, forge([]uint64{0, 100, 3, 0})},
+		{"scalable ratio", &ScalableBloomFilter{}, forge(scalableHeader{2, 0.01, 0.5, 10, 1})},
+		{"retouched k", &RetouchedBloomFilter{}, forge([]uint64{0, 8, 9}, NewBuckets(8, 1), NewBuckets(8, 4))},
+		{"stable p", &StableBloomFilter{}, forge([]uint64{8, 9, 1}, NewBuckets(8, 3))},
+	} {
+		if _, err := test.decoded.ReadFrom(test.stream); err == nil {
+			t.Errorf("%s: Expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package boomexpvar publishes the metrics of instrumented filters with
+// expvar, so that existing scrapers of /debug/vars pick up filter health
+// without a metrics library. It's a separate package since importing expvar
+// registers /debug/vars with http.DefaultServeMux, which programs using boom
+// shouldn't get unless they opt in.
+package boomexpvar
+
+import (
+	"expvar"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// Registerer is a boom.MetricsRegisterer which publishes metrics as the
+// entries of an expvar.Map. Counters are expvar.Ints and gauges are
+// expvar.Funcs evaluated whenever the variables are read.
+type Registerer struct {
+	vars *expvar.Map
+}
+
+// NewRegisterer returns a Registerer publishing metrics in the expvar.Map with
+// the name, creating and publishing it unless it already exists, such as when
+// a filter is replaced and published again. It panics if a variable which
+// isn't an expvar.Map is already published with the name.
+func NewRegisterer(name string) *Registerer {
+	vars, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		vars = expvar.NewMap(name)
+	}
+	return &Registerer{vars: vars}
+}
+
+// RegisterCounter publishes an expvar.Int with the name and returns a function
+// which increments it. The help text isn't published.
+func (r *Registerer) RegisterCounter(name, help string) func() {
+	counter := new(expvar.Int)
+	r.vars.Set(name, counter)
+	return func() {
+		counter.Add(1)
+	}
+}
+
+// RegisterGauge publishes an expvar.Func with the name which returns value.
+// The help text isn't published.
+func (r *Registerer) RegisterGauge(name, help string, value func() float64) {
+	r.vars.Set(name, expvar.Func(func() any {
+		return value()
+	}))
+}
+
+// Publish wraps the filter with boom.Instrumented and publishes its metrics
+// in an expvar.Map with the name, such as:
+//
+//	"users": {"boom_filter_adds_total": 1000, "boom_filter_fill_ratio": 0.42, ...}
+//
+// The filter must not be used directly afterward.
+func Publish(name string, filter boom.Filter) *boom.InstrumentedFilter {
+	return boom.Instrumented(filter, NewRegisterer(name))
+}
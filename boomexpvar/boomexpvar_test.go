@@ -0,0 +1,40 @@
+package boomexpvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// Ensures that Publish exposes the filter's counters and gauges as an expvar
+// map.
+func TestPublish(t *testing.T) {
+	f := Publish("test_filter", boom.NewBloomFilter(100, 0.01))
+	f.Add([]byte(`a`))
+	f.Test([]byte(`a`))
+	f.Reset()
+
+	var vars map[string]float64
+	if err := json.Unmarshal([]byte(expvar.Get("test_filter").String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]float64{
+		"boom_filter_adds_total":   1,
+		"boom_filter_tests_total":  1,
+		"boom_filter_hits_total":   1,
+		"boom_filter_resets_total": 1,
+		"boom_filter_fill_ratio":   0,
+	} {
+		if value, ok := vars[name]; !ok || value != expected {
+			t.Errorf("Expected %s of %v, got %v", name, expected, vars[name])
+		}
+	}
+
+	// Publishing again under the same name replaces the metrics.
+	Publish("test_filter", boom.NewBloomFilter(100, 0.01))
+	if adds := expvar.Get("test_filter").(*expvar.Map).Get("boom_filter_adds_total"); adds.String() != "0" {
+		t.Errorf("Expected 0, got %s", adds)
+	}
+}
@@ -0,0 +1,266 @@
+// Package boomhttp serves a filter over HTTP and provides a thin client for
+// it, so that a fleet of stateless frontends can consult one authoritative
+// filter, such as for deduplication. It's a separate package so that programs
+// using boom don't link net/http unless they opt in.
+//
+// The server accepts POST requests to /add, /test, and /test-and-add with a
+// JSON body holding the keys as base64 strings, and answers /test and
+// /test-and-add with whether each key is a member:
+//
+//	POST /test {"keys": ["YQ==", "Yg=="]}
+//	200 OK     {"results": [true, false]}
+//
+// GET /count answers with the number of items added, if the filter counts
+// them:
+//
+//	GET /count
+//	200 OK     {"count": 1000}
+package boomhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// maxRequestBytes is the largest request body the Handler accepts.
+const maxRequestBytes = 32 << 20
+
+// keysRequest is the body of requests to /add, /test, and /test-and-add.
+type keysRequest struct {
+	Keys [][]byte `json:"keys"`
+}
+
+// resultsResponse is the body of responses from /test and /test-and-add.
+type resultsResponse struct {
+	Results []bool `json:"results"`
+}
+
+// countResponse is the body of responses from /count.
+type countResponse struct {
+	Count uint `json:"count"`
+}
+
+// Handler is an http.Handler serving a filter. Requests are served
+// concurrently, so it locks the filter for each one, and a request's keys are
+// handled atomically. It serves the paths from the root, so it should be
+// wrapped with http.StripPrefix to serve it under a prefix.
+type Handler struct {
+	mu     sync.Mutex  // guards filter
+	filter boom.Filter // filter being served
+}
+
+// NewHandler returns a Handler serving the filter. The filter must not be used
+// directly afterward, other than through Do.
+func NewHandler(filter boom.Filter) *Handler {
+	return &Handler{filter: filter}
+}
+
+// ServeHTTP serves a request to the filter.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		method = http.MethodPost
+		handle func(http.ResponseWriter, *http.Request)
+	)
+	switch r.URL.Path {
+	case "/add":
+		handle = h.add
+	case "/test":
+		handle = h.test
+	case "/test-and-add":
+		handle = h.testAndAdd
+	case "/count":
+		method, handle = http.MethodGet, h.count
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	handle(w, r)
+}
+
+// Do calls fn with the filter while holding the lock, so that any of its other
+// methods, such as Reset or WriteTo, can be called safely while it's being
+// served. The filter must not be retained after fn returns.
+func (h *Handler) Do(fn func(filter boom.Filter)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn(h.filter)
+}
+
+// add adds the request's keys to the filter.
+func (h *Handler) add(w http.ResponseWriter, r *http.Request) {
+	keys, ok := readKeys(w, r)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	if many, ok := h.filter.(interface{ AddMany([][]byte) boom.Filter }); ok {
+		many.AddMany(keys)
+	} else {
+		for _, key := range keys {
+			h.filter.Add(key)
+		}
+	}
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// test answers whether each of the request's keys is a member.
+func (h *Handler) test(w http.ResponseWriter, r *http.Request) {
+	keys, ok := readKeys(w, r)
+	if !ok {
+		return
+	}
+	results := make([]bool, len(keys))
+	h.mu.Lock()
+	for i, key := range keys {
+		results[i] = h.filter.Test(key)
+	}
+	h.mu.Unlock()
+	writeJSON(w, resultsResponse{Results: results})
+}
+
+// testAndAdd answers whether each of the request's keys is a member and adds
+// it.
+func (h *Handler) testAndAdd(w http.ResponseWriter, r *http.Request) {
+	keys, ok := readKeys(w, r)
+	if !ok {
+		return
+	}
+	results := make([]bool, len(keys))
+	h.mu.Lock()
+	for i, key := range keys {
+		results[i] = h.filter.TestAndAdd(key)
+	}
+	h.mu.Unlock()
+	writeJSON(w, resultsResponse{Results: results})
+}
+
+// count answers with the number of items added to the filter.
+func (h *Handler) count(w http.ResponseWriter, r *http.Request) {
+	counter, ok := h.filter.(interface{ Count() uint })
+	if !ok {
+		http.Error(w, "filter doesn't count items", http.StatusNotImplemented)
+		return
+	}
+	h.mu.Lock()
+	count := counter.Count()
+	h.mu.Unlock()
+	writeJSON(w, countResponse{Count: count})
+}
+
+// readKeys decodes the keys of a request, writing an error response and
+// returning false if it's invalid.
+func readKeys(w http.ResponseWriter, r *http.Request) ([][]byte, bool) {
+	var req keysRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "invalid request: "+err.Error(), status)
+		return nil, false
+	}
+	return req.Keys, true
+}
+
+// writeJSON writes the value as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Client is a thin client for a filter served by a Handler. It's safe for
+// concurrent use.
+type Client struct {
+	url    string       // base URL of the Handler
+	client *http.Client // client requests are made with
+}
+
+// NewClient returns a Client for the Handler served at the base URL, such as
+// "http://dedup:8080", making requests with the http.Client, or
+// http.DefaultClient if it's nil.
+func NewClient(url string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{url: strings.TrimSuffix(url, "/"), client: client}
+}
+
+// Add adds the keys to the filter.
+func (c *Client) Add(ctx context.Context, keys ...[]byte) error {
+	return c.do(ctx, http.MethodPost, "/add", keysRequest{Keys: keys}, nil)
+}
+
+// Test returns whether each of the keys is a member of the filter, in the same
+// order.
+func (c *Client) Test(ctx context.Context, keys ...[]byte) ([]bool, error) {
+	var resp resultsResponse
+	err := c.do(ctx, http.MethodPost, "/test", keysRequest{Keys: keys}, &resp)
+	return resp.Results, err
+}
+
+// TestAndAdd returns whether each of the keys is a member of the filter, in
+// the same order, and adds them, atomically.
+func (c *Client) TestAndAdd(ctx context.Context, keys ...[]byte) ([]bool, error) {
+	var resp resultsResponse
+	err := c.do(ctx, http.MethodPost, "/test-and-add", keysRequest{Keys: keys}, &resp)
+	return resp.Results, err
+}
+
+// Count returns the number of items added to the filter. It returns an error
+// if the filter doesn't count them.
+func (c *Client) Count(ctx context.Context) (uint, error) {
+	var resp countResponse
+	err := c.do(ctx, http.MethodGet, "/count", nil, &resp)
+	return resp.Count, err
+}
+
+// do makes a request to the path with the body encoded as JSON, if it isn't
+// nil, and decodes the response into resp, if it isn't nil. It returns an
+// error if the request fails or the response has an error status.
+func (c *Client) do(ctx context.Context, method, path string, body, resp any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("boomhttp: %s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(msg)))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
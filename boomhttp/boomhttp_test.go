@@ -0,0 +1,113 @@
+package boomhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// Ensures that a Client can add, test, and count keys in a served filter.
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewHandler(boom.NewBloomFilter(1000, 0.01)))
+	defer server.Close()
+	client := NewClient(server.URL+"/", server.Client())
+	ctx := context.Background()
+
+	if err := client.Add(ctx, []byte(`a`), []byte("\x00\xff")); err != nil {
+		t.Fatal(err)
+	}
+	results, err := client.Test(ctx, []byte(`a`), []byte("\x00\xff"), []byte(`c`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || !results[0] || !results[1] || results[2] {
+		t.Errorf("Expected [true true false], got %v", results)
+	}
+
+	results, err = client.TestAndAdd(ctx, []byte(`c`), []byte(`c`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0] || !results[1] {
+		t.Errorf("Expected [false true], got %v", results)
+	}
+
+	if count, err := client.Count(ctx); err != nil || count != 4 {
+		t.Errorf("Expected 4, got %d, %v", count, err)
+	}
+}
+
+// Ensures that concurrent requests are served safely.
+func TestClientConcurrent(t *testing.T) {
+	handler := NewHandler(boom.NewBloomFilter(10000, 0.01))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := NewClient(server.URL, server.Client())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := []byte(strconv.Itoa(i*50 + j))
+				if err := client.Add(context.Background(), key); err != nil {
+					t.Error(err)
+					return
+				}
+				if results, err := client.Test(context.Background(), key); err != nil || !results[0] {
+					t.Errorf("Expected %s to be a member, got %v", key, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	handler.Do(func(filter boom.Filter) {
+		if count := filter.(*boom.BloomFilter).Count(); count != 400 {
+			t.Errorf("Expected 400, got %d", count)
+		}
+	})
+}
+
+// Ensures that invalid requests are rejected with an error.
+func TestHandlerErrors(t *testing.T) {
+	handler := NewHandler(boom.NewInverseBloomFilter(100))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/add", "not json", http.StatusBadRequest},
+		{http.MethodPost, "/test", `{"keys": ["not base64!"]}`, http.StatusBadRequest},
+		{http.MethodGet, "/add", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/count", "", http.StatusNotImplemented},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, res.StatusCode)
+		}
+	}
+
+	client := NewClient(server.URL, nil)
+	if _, err := client.Count(context.Background()); err == nil || !strings.Contains(err.Error(), "501") {
+		t.Errorf("Expected a 501 error, got %v", err)
+	}
+}
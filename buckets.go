@@ -1,5 +1,15 @@
 package boom
 
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"runtime"
+)
+
 // Buckets is a fast, space-efficient array of buckets where each bucket can
 // store up to a configured maximum value.
 type Buckets struct {
@@ -7,6 +17,7 @@ type Buckets struct {
 	bucketSize uint8
 	max        uint8
 	count      uint
+	dirty      []uint64 // pages changed since the last delta, nil if untracked
 }
 
 // NewBuckets creates a new Buckets with the provided number of buckets where
@@ -30,6 +41,11 @@ func (b *Buckets) Count() uint {
 	return b.count
 }
 
+// ByteSize returns the number of bytes used to store the buckets.
+func (b *Buckets) ByteSize() uint {
+	return uint(len(b.data))
+}
+
 // Increment will increment the value in the specified bucket by the provided
 // delta. A bucket can be decremented by providing a negative delta. The value
 // is clamped to zero and the maximum bucket value. Returns itself to allow for
@@ -42,7 +58,7 @@ func (b *Buckets) Increment(bucket uint, delta int32) *Buckets {
 		val = 0
 	}
 
-	b.setBits(uint32(bucket)*uint32(b.bucketSize), uint32(b.bucketSize), uint32(val))
+	b.setBits(bucket*uint(b.bucketSize), uint(b.bucketSize), uint32(val))
 	return b
 }
 
@@ -53,7 +69,7 @@ func (b *Buckets) Set(bucket uint, value uint8) *Buckets {
 		value = b.max
 	}
 
-	b.setBits(uint32(bucket)*uint32(b.bucketSize), uint32(b.bucketSize), uint32(value))
+	b.setBits(bucket*uint(b.bucketSize), uint(b.bucketSize), uint32(value))
 	return b
 }
 
@@ -62,13 +78,156 @@ func (b *Buckets) Get(bucket uint) uint32 {
 	return b.getBits(bucket*uint(b.bucketSize), uint(b.bucketSize))
 }
 
-// Reset restores the Buckets to the original state. Returns itself to allow
-// for chaining.
+// prefetch loads the bytes holding the specified buckets so they're cached
+// before they're read. Go has no prefetch instruction, but the loads are
+// independent of each other, so the processor issues them in parallel.
+func (b *Buckets) prefetch(buckets []uint) {
+	var touched byte
+	for _, bucket := range buckets {
+		touched |= b.data[bucket*uint(b.bucketSize)/8]
+	}
+	runtime.KeepAlive(touched)
+}
+
+// Reset restores the Buckets to the original state. The underlying storage is
+// cleared in place rather than reallocated. Returns itself to allow for
+// chaining.
 func (b *Buckets) Reset() *Buckets {
-	b.data = make([]byte, (b.count*uint(b.bucketSize)+7)/8)
+	for i := range b.data {
+		b.data[i] = 0
+	}
+	b.markDirty(0, uint(len(b.data)))
 	return b
 }
 
+// Copy returns a deep copy of the Buckets held in memory, whatever the
+// storage backing the original. Changes to the copy aren't tracked.
+func (b *Buckets) Copy() *Buckets {
+	copied := *b
+	copied.data = append([]byte(nil), b.data...)
+	copied.dirty = nil
+	return &copied
+}
+
+// Equal returns whether the other Buckets have the same number and size of
+// buckets and the same values.
+func (b *Buckets) Equal(other *Buckets) bool {
+	return b.count == other.count && b.bucketSize == other.bucketSize &&
+		bytes.Equal(b.data, other.data)
+}
+
+// nonZeroRatio returns the ratio of buckets with a non-zero value.
+func (b *Buckets) nonZeroRatio() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	return float64(b.nonZero()) / float64(b.count)
+}
+
+// WriteTo writes a binary representation of Buckets to an i/o stream. It
+// returns the number of bytes written.
+func (b *Buckets) WriteTo(stream io.Writer) (int64, error) {
+	header := struct {
+		BucketSize uint8
+		Max        uint8
+		Count      uint64
+		Len        uint64
+	}{b.bucketSize, b.max, uint64(b.count), uint64(len(b.data))}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := stream.Write(b.data)
+	return written + int64(n), err
+}
+
+// ReadFrom reads a binary representation of Buckets (such as might have been
+// written by WriteTo()) from an i/o stream. It returns the number of bytes
+// read.
+func (b *Buckets) ReadFrom(stream io.Reader) (int64, error) {
+	var header struct {
+		BucketSize uint8
+		Max        uint8
+		Count      uint64
+		Len        uint64
+	}
+	if err := binary.Read(stream, binary.BigEndian, &header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	// The number of bits is checked for overflow before it's used to check
+	// the length, so a forged count can't wrap around to a short length.
+	hi, size := bits.Mul64(header.Count, uint64(header.BucketSize))
+	if header.BucketSize == 0 || header.BucketSize > 32 || hi != 0 ||
+		size > uint64(maxBits) || header.Len != (size+7)/8 ||
+		header.Max != uint8((1<<uint(header.BucketSize))-1) {
+		return read, errors.New("invalid buckets dimensions")
+	}
+
+	data, n, err := readBytes(stream, header.Len)
+	read += n
+	if err != nil {
+		return read, err
+	}
+
+	b.data = data
+	b.bucketSize = header.BucketSize
+	b.max = header.Max
+	b.count = uint(header.Count)
+	b.dirty = nil
+	return read, nil
+}
+
+// readBytes reads n bytes from an i/o stream as they arrive rather than
+// allocating them up front, so a forged length can't allocate more memory
+// than the stream holds. It returns the number of bytes read.
+func readBytes(stream io.Reader, n uint64) ([]byte, int64, error) {
+	if n > math.MaxInt64 {
+		return nil, 0, errors.New("length overflows")
+	}
+	var data bytes.Buffer
+	read, err := io.CopyN(&data, stream, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return data.Bytes(), read, err
+}
+
+// readWords reads n big-endian 64-bit words from an i/o stream as they arrive,
+// like readBytes. It returns the number of bytes read.
+func readWords(stream io.Reader, n uint64) ([]uint64, int64, error) {
+	hi, size := bits.Mul64(n, 8)
+	if hi != 0 {
+		return nil, 0, errors.New("length overflows")
+	}
+	data, read, err := readBytes(stream, size)
+	if err != nil {
+		return nil, read, err
+	}
+	words := make([]uint64, n)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	return words, read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (b *Buckets) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (b *Buckets) GobDecode(data []byte) error {
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
 // getBits returns the bits at the specified offset and length.
 func (b *Buckets) getBits(offset, length uint) uint32 {
 	byteIndex := offset / 8
@@ -82,7 +241,7 @@ func (b *Buckets) getBits(offset, length uint) uint32 {
 }
 
 // setBits sets bits at the specified offset and length.
-func (b *Buckets) setBits(offset, length, bits uint32) {
+func (b *Buckets) setBits(offset, length uint, bits uint32) {
 	byteIndex := offset / 8
 	byteOffset := offset % 8
 	if byteOffset+length > 8 {
@@ -94,4 +253,8 @@ func (b *Buckets) setBits(offset, length, bits uint32) {
 	bitMask := uint32((1 << length) - 1)
 	b.data[byteIndex] = byte(uint32(b.data[byteIndex]) & ^(bitMask << byteOffset))
 	b.data[byteIndex] = byte(uint32(b.data[byteIndex]) | ((bits & bitMask) << byteOffset))
+	if b.dirty != nil {
+		page := byteIndex / deltaPageSize
+		b.dirty[page/64] |= 1 << (page % 64)
+	}
 }
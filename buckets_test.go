@@ -1,6 +1,10 @@
 package boom
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
 
 // Ensures that MaxBucketValue returns the correct maximum based on the bucket
 // size.
@@ -99,3 +103,80 @@ func BenchmarkBucketsGet(b *testing.B) {
 		buckets.Get(uint(n) % 10000)
 	}
 }
+
+// Ensures that Buckets round-trip through WriteTo and ReadFrom.
+func TestBucketsWriteToReadFrom(t *testing.T) {
+	b := NewBuckets(10, 3)
+	for i := uint(0); i < 10; i++ {
+		b.Set(i, uint8(i%8))
+	}
+
+	var buf bytes.Buffer
+	written, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), written)
+	}
+
+	other := &Buckets{}
+	read, err := other.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != written {
+		t.Errorf("Expected %d bytes read, got %d", written, read)
+	}
+
+	if other.Count() != 10 || other.MaxBucketValue() != 7 {
+		t.Errorf("Expected 10 buckets with max 7, got %d with max %d", other.Count(), other.MaxBucketValue())
+	}
+	for i := uint(0); i < 10; i++ {
+		if v := other.Get(i); v != uint32(i%8) {
+			t.Errorf("Expected %d, got %d", i%8, v)
+		}
+	}
+
+	if _, err := other.ReadFrom(bytes.NewReader([]byte{0, 0})); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+}
+
+// Ensures that ReadFrom rejects headers whose count overflows, whose maximum
+// doesn't match the bucket size, or whose data is missing.
+func TestBucketsReadFromInvalid(t *testing.T) {
+	type header struct {
+		BucketSize uint8
+		Max        uint8
+		Count      uint64
+		Len        uint64
+	}
+	for _, test := range []struct {
+		name   string
+		header header
+	}{
+		{"overflowing count", header{1, 1, 1<<64 - 1, 0}},
+		{"wrapping count", header{8, 255, 1 << 61, 0}},
+		{"too many bits", header{1, 1, 1<<64 - 7, 1 << 61}},
+		{"truncated data", header{1, 1, 1<<64 - 8, 1<<61 - 1}},
+		{"wrong max", header{3, 255, 8, 3}},
+		{"zero bucket size", header{0, 0, 0, 0}},
+	} {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, test.header)
+		if _, err := (&Buckets{}).ReadFrom(&buf); err == nil {
+			t.Errorf("%s: Expected an error", test.name)
+		}
+	}
+
+	// A Bloom filter read from a forged header would otherwise index past
+	// its data.
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint64{0, 1<<64 - 1, 3})
+	binary.Write(&buf, binary.BigEndian, []uint8{1, 1})
+	binary.Write(&buf, binary.BigEndian, []uint64{1<<64 - 1, 0})
+	if _, err := (&BloomFilter{}).ReadFrom(&buf); err == nil {
+		t.Error("Expected an error for a forged Bloom filter")
+	}
+}
@@ -0,0 +1,54 @@
+package boom
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BuildBloomFilter creates a new Bloom filter optimized to store n items with
+// a specified target false-positive rate and adds the data to it in parallel.
+// The data is split across GOMAXPROCS workers, each of which adds its share to
+// a filter of its own, and the workers' filters are merged once they finish.
+// This is useful for one-shot builds of large filters where ingest would
+// otherwise be limited to a single core.
+func BuildBloomFilter(n uint, fpRate float64, data [][]byte) *BloomFilter {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(data) {
+		workers = len(data)
+	}
+	if workers <= 1 {
+		filter := NewBloomFilter(n, fpRate)
+		for _, d := range data {
+			filter.Add(d)
+		}
+		return filter
+	}
+
+	var (
+		filters = make([]*BloomFilter, workers)
+		chunk   = (len(data) + workers - 1) / workers
+		wg      sync.WaitGroup
+	)
+	for w := range filters {
+		filters[w] = NewBloomFilter(n, fpRate)
+		start, end := w*chunk, (w+1)*chunk
+		if end > len(data) {
+			end = len(data)
+		}
+
+		wg.Add(1)
+		go func(filter *BloomFilter, data [][]byte) {
+			defer wg.Done()
+			for _, d := range data {
+				filter.Add(d)
+			}
+		}(filters[w], data[start:end])
+	}
+	wg.Wait()
+
+	// The filters share the same parameters, so merging can't fail.
+	for _, filter := range filters[1:] {
+		filters[0].Merge(filter)
+	}
+	return filters[0]
+}
@@ -0,0 +1,56 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that BuildBloomFilter produces the same filter as adding the data
+// sequentially.
+func TestBuildBloomFilter(t *testing.T) {
+	data := make([][]byte, 10000)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+
+	f := BuildBloomFilter(10000, 0.01, data)
+	expected := NewBloomFilter(10000, 0.01)
+	for _, d := range data {
+		expected.Add(d)
+	}
+
+	if count := f.Count(); count != 10000 {
+		t.Errorf("Expected 10000, got %d", count)
+	}
+
+	for i := uint(0); i < f.Capacity(); i++ {
+		if f.buckets.Get(i) != expected.buckets.Get(i) {
+			t.Fatalf("Expected bit %d to match", i)
+		}
+	}
+}
+
+// Ensures that BuildBloomFilter handles less data than workers.
+func TestBuildBloomFilterSmall(t *testing.T) {
+	f := BuildBloomFilter(100, 0.01, [][]byte{[]byte(`a`)})
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f := BuildBloomFilter(100, 0.01, nil); f.Count() != 0 {
+		t.Errorf("Expected 0, got %d", f.Count())
+	}
+}
+
+func BenchmarkBuildBloomFilter(b *testing.B) {
+	data := make([][]byte, 100000)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		BuildBloomFilter(100000, 0.01, data)
+	}
+}
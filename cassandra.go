@@ -0,0 +1,298 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// cassandraExcessBits is the number of bits Cassandra adds to every filter
+// beyond those needed for its elements.
+const cassandraExcessBits = 20
+
+// CassandraFormat is the on-disk layout of a Cassandra Bloom filter
+// component (Filter.db).
+type CassandraFormat uint8
+
+const (
+	// CassandraLegacyFormat is the layout used by SSTable versions before
+	// Cassandra 4.0, where the bits are written as an array of big-endian
+	// longs, each assembled from eight bytes of the bit set in little-endian
+	// order.
+	CassandraLegacyFormat CassandraFormat = iota
+
+	// CassandraCurrentFormat is the layout used by Cassandra 4.0 and later,
+	// where the bytes of the bit set are written as they are.
+	CassandraCurrentFormat
+)
+
+// CassandraBloomFilter implements the Bloom filter Apache Cassandra stores
+// alongside each SSTable, so Go tooling can inspect existing Filter.db
+// components or generate new ones.
+//
+// Keys are hashed with Cassandra's variant of the 128-bit x64 MurmurHash3,
+// which sign-extends the trailing bytes of the key, and the K indices are
+// derived from the two halves of the hash using Java's signed arithmetic. The
+// bit set is a whole number of 64-bit words. Filters are sized with the usual
+// optimal parameters plus Cassandra's excess bits, so they may differ in size
+// from those Cassandra builds from its precomputed tables, but any filter
+// read with ReadFrom answers exactly as Cassandra would.
+type CassandraBloomFilter struct {
+	data   []byte          // filter data, eight bytes per word
+	k      uint            // number of hash functions
+	count  uint            // number of items added
+	format CassandraFormat // on-disk layout
+}
+
+// NewCassandraBloomFilter creates a new Cassandra Bloom filter optimized to
+// store n items with a specified target false-positive rate, which is written
+// in the provided on-disk layout.
+func NewCassandraBloomFilter(n uint, fpRate float64, format CassandraFormat) *CassandraBloomFilter {
+	bits := OptimalM(n, fpRate) + cassandraExcessBits
+	return &CassandraBloomFilter{
+		data:   make([]byte, (bits+63)/64*8),
+		k:      OptimalK(fpRate),
+		format: format,
+	}
+}
+
+// NewCassandraBloomFilterE is like NewCassandraBloomFilter, but returns an
+// error if n is zero, fpRate isn't between 0 and 1, or the filter would be too
+// large for Cassandra, whose Filter.db stores the number of words as an int.
+func NewCassandraBloomFilterE(n uint, fpRate float64, format CassandraFormat) (*CassandraBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if (optimalM(n, fpRate)+cassandraExcessBits)/64 > math.MaxInt32 {
+		return nil, errors.New("filter size overflows")
+	}
+	return NewCassandraBloomFilter(n, fpRate, format), nil
+}
+
+// ReadCassandraBloomFilter reads a Cassandra Bloom filter in the provided
+// on-disk layout, such as the contents of a Filter.db component, from an i/o
+// stream.
+func ReadCassandraBloomFilter(stream io.Reader, format CassandraFormat) (*CassandraBloomFilter, error) {
+	c := &CassandraBloomFilter{format: format}
+	if _, err := c.ReadFrom(stream); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (c *CassandraBloomFilter) Capacity() uint {
+	return uint(len(c.data)) * 8
+}
+
+// K returns the number of hash functions.
+func (c *CassandraBloomFilter) K() uint {
+	return c.k
+}
+
+// Format returns the on-disk layout of the filter.
+func (c *CassandraBloomFilter) Format() CassandraFormat {
+	return c.format
+}
+
+// Count returns the number of items added to the filter. It's zero for
+// filters read with ReadFrom.
+func (c *CassandraBloomFilter) Count() uint {
+	return c.count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (c *CassandraBloomFilter) Test(data []byte) bool {
+	if len(c.data) == 0 {
+		return true
+	}
+
+	base, inc := c.hashKernel(data)
+	max := int64(len(c.data)) * 8
+
+	// If any of the K bits are not set, then it's not a member.
+	for i := uint(0); i < c.k; i++ {
+		idx := cassandraIndex(base, max)
+		if c.data[idx>>3]&(1<<(idx&7)) == 0 {
+			return false
+		}
+		base += inc
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (c *CassandraBloomFilter) Add(data []byte) Filter {
+	if len(c.data) == 0 {
+		return c
+	}
+
+	base, inc := c.hashKernel(data)
+	max := int64(len(c.data)) * 8
+
+	// Set the K bits.
+	for i := uint(0); i < c.k; i++ {
+		idx := cassandraIndex(base, max)
+		c.data[idx>>3] |= 1 << (idx & 7)
+		base += inc
+	}
+
+	c.count++
+	return c
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (c *CassandraBloomFilter) TestAndAdd(data []byte) bool {
+	if len(c.data) == 0 {
+		return true
+	}
+
+	base, inc := c.hashKernel(data)
+	max := int64(len(c.data)) * 8
+	member := true
+
+	// Set the K bits, noting whether any weren't set already.
+	for i := uint(0); i < c.k; i++ {
+		idx := cassandraIndex(base, max)
+		if c.data[idx>>3]&(1<<(idx&7)) == 0 {
+			member = false
+			c.data[idx>>3] |= 1 << (idx & 7)
+		}
+		base += inc
+	}
+
+	c.count++
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (c *CassandraBloomFilter) ByteSize() uint {
+	return uint(len(c.data))
+}
+
+// String returns a one-line summary of the CassandraBloomFilter for logging and
+// debugging.
+func (c *CassandraBloomFilter) String() string {
+	return fmt.Sprintf("CassandraBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		c.Capacity(), c.k, c.count, estimatedFPRate(c.Capacity(), c.k, c.count))
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (c *CassandraBloomFilter) Reset() *CassandraBloomFilter {
+	for i := range c.data {
+		c.data[i] = 0
+	}
+	c.count = 0
+	return c
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (c *CassandraBloomFilter) Clear() {
+	c.Reset()
+}
+
+// WriteTo writes the filter to an i/o stream in its Filter.db layout: the
+// number of hash functions and the number of words as big-endian ints
+// followed by the words. It returns the number of bytes written.
+func (c *CassandraBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []int32{int32(c.k), int32(len(c.data) / 8)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+
+	data := c.data
+	if c.format == CassandraLegacyFormat {
+		data = swapWords(c.data)
+	}
+
+	n, err := stream.Write(data)
+	return int64(binary.Size(header)) + int64(n), err
+}
+
+// ReadFrom reads a filter in the filter's Filter.db layout (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number
+// of bytes read.
+func (c *CassandraBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]int32, 2)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[0] <= 0 || header[0] > maxK || header[1] <= 0 {
+		return read, errors.New("invalid cassandra filter dimensions")
+	}
+
+	data, n, err := readBytes(stream, uint64(header[1])*8)
+	read += n
+	if err != nil {
+		return read, err
+	}
+
+	if c.format == CassandraLegacyFormat {
+		data = swapWords(data)
+	}
+
+	c.data = data
+	c.k = uint(header[0])
+	c.count = 0
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CassandraBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CassandraBloomFilter) GobDecode(data []byte) error {
+	_, err := c.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// hashKernel returns the base and increment from which the K indices are
+// derived, which are the second and first halves of Cassandra's MurmurHash3.
+func (c *CassandraBloomFilter) hashKernel(data []byte) (int64, int64) {
+	h1, h2 := murmur3Sum128(0, data, true)
+	return int64(h2), int64(h1)
+}
+
+// cassandraIndex returns the absolute value of the Java remainder of base
+// divided by max.
+func cassandraIndex(base, max int64) uint64 {
+	idx := base % max
+	if idx < 0 {
+		idx = -idx
+	}
+	return uint64(idx)
+}
+
+// swapWords returns a copy of the data with the byte order of every eight
+// bytes reversed, converting between the bytes of a bit set and its
+// big-endian longs.
+func swapWords(data []byte) []byte {
+	swapped := make([]byte, len(data))
+	for i := 0; i+8 <= len(data); i += 8 {
+		binary.BigEndian.PutUint64(swapped[i:], binary.LittleEndian.Uint64(data[i:]))
+	}
+	return swapped
+}
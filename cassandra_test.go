@@ -0,0 +1,169 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Capacity is a whole number of words including the excess bits.
+func TestCassandraCapacity(t *testing.T) {
+	f := NewCassandraBloomFilter(100, 0.1, CassandraCurrentFormat)
+
+	if capacity := f.Capacity(); capacity != 512 {
+		t.Errorf("Expected 512, got %d", capacity)
+	}
+
+	if k := f.K(); k != 4 {
+		t.Errorf("Expected 4, got %d", k)
+	}
+}
+
+// Ensures that NewCassandraBloomFilterE returns errors for invalid parameters
+// and filters too large for Filter.db.
+func TestNewCassandraBloomFilterE(t *testing.T) {
+	if _, err := NewCassandraBloomFilterE(0, 0.01, CassandraCurrentFormat); err == nil {
+		t.Error("Expected an error for n of zero")
+	}
+	if _, err := NewCassandraBloomFilterE(100, 0, CassandraCurrentFormat); err == nil {
+		t.Error("Expected an error for a rate of zero")
+	}
+	if _, err := NewCassandraBloomFilterE(1<<31, 1e-300, CassandraCurrentFormat); err == nil {
+		t.Error("Expected an error for a filter of more than 2^31 words")
+	}
+	f, err := NewCassandraBloomFilterE(100, 0.1, CassandraLegacyFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Capacity() != 512 || f.Format() != CassandraLegacyFormat {
+		t.Errorf("Unexpected filter %s", f)
+	}
+}
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestCassandraTestAndAdd(t *testing.T) {
+	f := NewCassandraBloomFilter(100, 0.01, CassandraCurrentFormat)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned CassandraBloomFilter should be the same instance")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that the filter sets the bits Cassandra would for a key whose hash
+// halves are negative, exercising Java's signed remainder.
+func TestCassandraIndices(t *testing.T) {
+	f := NewCassandraBloomFilter(10, 0.1, CassandraCurrentFormat)
+	key := []byte("\xff\xfe\xfd")
+	f.Add(key)
+
+	h1, h2 := murmur3Sum128(0, key, true)
+	base, inc, max := int64(h2), int64(h1), int64(f.Capacity())
+	for i := uint(0); i < f.K(); i++ {
+		idx := base % max
+		if idx < 0 {
+			idx = -idx
+		}
+		if f.data[idx/8]&(1<<uint(idx%8)) == 0 {
+			t.Errorf("Expected bit %d to be set", idx)
+		}
+		base += inc
+	}
+}
+
+// Ensures that Cassandra's MurmurHash3 only differs from the reference one for
+// keys with trailing bytes of 0x80 or more.
+func TestCassandraMurmur3(t *testing.T) {
+	a1, a2 := murmur3Sum128(0, []byte(`hello`), true)
+	b1, b2 := murmur3Sum128(0, []byte(`hello`), false)
+	if a1 != b1 || a2 != b2 {
+		t.Error("Expected hashes of ASCII keys to match")
+	}
+
+	a1, a2 = murmur3Sum128(0, []byte("hell\xf6"), true)
+	b1, b2 = murmur3Sum128(0, []byte("hell\xf6"), false)
+	if a1 == b1 && a2 == b2 {
+		t.Error("Expected hashes of keys with high tail bytes to differ")
+	}
+}
+
+// Ensures that filters can be written and read in both layouts.
+func TestCassandraWriteToReadFrom(t *testing.T) {
+	for _, format := range []CassandraFormat{CassandraLegacyFormat, CassandraCurrentFormat} {
+		f := NewCassandraBloomFilter(1000, 0.01, format)
+		for i := 0; i < 1000; i++ {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+
+		var buf bytes.Buffer
+		written, err := f.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if written != int64(8+len(f.data)) {
+			t.Errorf("Expected %d, got %d", 8+len(f.data), written)
+		}
+
+		other := &CassandraBloomFilter{format: format}
+		read, err := other.ReadFrom(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if read != written {
+			t.Errorf("Expected %d, got %d", written, read)
+		}
+
+		if !bytes.Equal(other.data, f.data) || other.K() != f.K() {
+			t.Error("Expected filters to match")
+		}
+
+		other, err = ReadCassandraBloomFilter(bytes.NewReader(buf.Bytes()), format)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if other.Format() != format || !bytes.Equal(other.data, f.data) {
+			t.Error("Expected filters to match")
+		}
+	}
+
+	// In the legacy layout, bit 0 is the lowest bit of the first long.
+	g := &CassandraBloomFilter{data: make([]byte, 8), k: 1}
+	g.data[0] = 1
+	var buf bytes.Buffer
+	g.WriteTo(&buf)
+	if word := binary.BigEndian.Uint64(buf.Bytes()[8:]); word != 1 {
+		t.Errorf("Expected 1, got %d", word)
+	}
+
+	// Forged headers are rejected without allocating the words up front.
+	for _, header := range [][]int32{{0, 1}, {3, 0}, {3, 1<<31 - 1}} {
+		buf.Reset()
+		binary.Write(&buf, binary.BigEndian, header)
+		if _, err := g.ReadFrom(&buf); err == nil {
+			t.Errorf("Expected error for header %v", header)
+		}
+	}
+}
+
+func BenchmarkCassandraAdd(b *testing.B) {
+	f := NewCassandraBloomFilter(100000, 0.01, CassandraCurrentFormat)
+	for n := 0; n < b.N; n++ {
+		f.Add([]byte(strconv.Itoa(n)))
+	}
+}
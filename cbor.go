@@ -0,0 +1,652 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+// CBOR tags identifying each structure. Every structure is encoded as a CBOR
+// array (major type 4) wrapped in its tag (major type 6), using only unsigned
+// integers, byte strings, float64s, null, and nested arrays. Buckets are
+// encoded untagged as [bucketSize, count, data]. The arrays wrapped in each
+// structure's tag are:
+//
+//	BloomFilter:            [m, k, count, buckets]
+//	PartitionedBloomFilter: [m, k, s, count, [buckets...]]
+//	CountingBloomFilter:    [m, k, count, buckets]
+//	ScalableBloomFilter:    [r, fp, p, hint, [PartitionedBloomFilter...]]
+//	StableBloomFilter:      [m, k, p, max, cells]
+//	CountMinSketch:         [width, depth, epsilon, delta, count, [row...]]
+//	HyperLogLog:            [m, b, alpha, registers]
+//	InverseBloomFilter:     [capacity, [data or null...]]
+//
+// The k of a BloomFilter holds the number of hash functions in bits 0-23, the
+// Indexing scheme in bits 24-31, and the fractional part of the number of hash
+// functions, scaled to 2^32, in bits 32-63. A CountingBloomFilter with
+// spilling enabled has a fifth element, an array of alternating bucket
+// indices and spilled excesses. Each CountMinSketch row is an array of its
+// counters. HyperLogLog registers are a byte string of 6-bit registers packed
+// little-endian. The tags are in the first-come, first-served range and spell
+// "boo" followed by the structure number.
+const (
+	CBORTagBloomFilter uint64 = 0x626f6f00 + iota
+	CBORTagPartitionedBloomFilter
+	CBORTagCountingBloomFilter
+	CBORTagScalableBloomFilter
+	CBORTagStableBloomFilter
+	CBORTagCountMinSketch
+	CBORTagHyperLogLog
+	CBORTagInverseBloomFilter
+)
+
+// CBOR major types and simple values.
+const (
+	cborUint    = 0
+	cborBytes   = 2
+	cborArray   = 4
+	cborTag     = 6
+	cborNull    = 0xf6
+	cborFloat64 = 0xfb
+)
+
+var errCBORMalformed = errors.New("malformed CBOR")
+
+// cborEncoder writes CBOR data items to a buffer.
+type cborEncoder struct {
+	buf bytes.Buffer
+}
+
+// head writes the initial byte and argument of a data item.
+func (e *cborEncoder) head(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		e.buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		e.buf.WriteByte(major | 25)
+		binary.Write(&e.buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		e.buf.WriteByte(major | 26)
+		binary.Write(&e.buf, binary.BigEndian, uint32(arg))
+	default:
+		e.buf.WriteByte(major | 27)
+		binary.Write(&e.buf, binary.BigEndian, arg)
+	}
+}
+
+func (e *cborEncoder) uint(v uint64) {
+	e.head(cborUint, v)
+}
+
+func (e *cborEncoder) bytes(data []byte) {
+	e.head(cborBytes, uint64(len(data)))
+	e.buf.Write(data)
+}
+
+func (e *cborEncoder) array(n int) {
+	e.head(cborArray, uint64(n))
+}
+
+func (e *cborEncoder) tag(tag uint64) {
+	e.head(cborTag, tag)
+}
+
+func (e *cborEncoder) float(v float64) {
+	e.buf.WriteByte(cborFloat64)
+	binary.Write(&e.buf, binary.BigEndian, math.Float64bits(v))
+}
+
+func (e *cborEncoder) null() {
+	e.buf.WriteByte(cborNull)
+}
+
+func (e *cborEncoder) buckets(b *Buckets) {
+	e.array(3)
+	e.uint(uint64(b.bucketSize))
+	e.uint(uint64(b.count))
+	e.bytes(b.data)
+}
+
+// cborDecoder reads CBOR data items from a byte slice.
+type cborDecoder struct {
+	data []byte
+	err  error
+}
+
+// head reads the initial byte and argument of a data item, which must be of
+// the major type.
+func (d *cborDecoder) head(major byte) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 || d.data[0]>>5 != major {
+		d.err = errCBORMalformed
+		return 0
+	}
+
+	var (
+		info = d.data[0] & 0x1f
+		size = 0
+	)
+	switch {
+	case info < 24:
+		d.data = d.data[1:]
+		return uint64(info)
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		d.err = errCBORMalformed
+		return 0
+	}
+
+	if len(d.data) < 1+size {
+		d.err = errCBORMalformed
+		return 0
+	}
+	arg := uint64(0)
+	for _, c := range d.data[1 : 1+size] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.data = d.data[1+size:]
+	return arg
+}
+
+func (d *cborDecoder) uint() uint64 {
+	return d.head(cborUint)
+}
+
+func (d *cborDecoder) bytes() []byte {
+	n := d.head(cborBytes)
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < n {
+		d.err = errCBORMalformed
+		return nil
+	}
+	data := append([]byte(nil), d.data[:n]...)
+	d.data = d.data[n:]
+	return data
+}
+
+// array reads the header of an array, which must have n elements.
+func (d *cborDecoder) array(n int) {
+	if d.head(cborArray) != uint64(n) && d.err == nil {
+		d.err = errCBORMalformed
+	}
+}
+
+// arrayLen reads the header of an array of any length.
+func (d *cborDecoder) arrayLen() int {
+	n := d.head(cborArray)
+	if n > uint64(len(d.data)) {
+		// Every element takes at least a byte.
+		d.err = errCBORMalformed
+		return 0
+	}
+	return int(n)
+}
+
+// tag reads a tag, which must be the expected tag.
+func (d *cborDecoder) tag(tag uint64) {
+	if d.head(cborTag) != tag && d.err == nil {
+		d.err = errors.New("unexpected CBOR tag")
+	}
+}
+
+func (d *cborDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 9 || d.data[0] != cborFloat64 {
+		d.err = errCBORMalformed
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.data[1:9]))
+	d.data = d.data[9:]
+	return v
+}
+
+// null returns true and consumes the item if the next item is null.
+func (d *cborDecoder) null() bool {
+	if d.err == nil && len(d.data) > 0 && d.data[0] == cborNull {
+		d.data = d.data[1:]
+		return true
+	}
+	return false
+}
+
+func (d *cborDecoder) buckets() *Buckets {
+	d.array(3)
+	var (
+		bucketSize = d.uint()
+		count      = d.uint()
+		data       = d.bytes()
+	)
+	if d.err != nil {
+		return nil
+	}
+	// The number of bits is checked for overflow before it's used to check
+	// the length, so a forged count can't wrap around to a short length.
+	hi, size := bits.Mul64(count, bucketSize)
+	if bucketSize == 0 || bucketSize > 32 || hi != 0 || size > uint64(maxBits) ||
+		uint64(len(data)) != (size+7)/8 {
+		d.err = errCBORMalformed
+		return nil
+	}
+	return &Buckets{
+		data:       data,
+		bucketSize: uint8(bucketSize),
+		max:        (1 << bucketSize) - 1,
+		count:      uint(count),
+	}
+}
+
+// finish returns the first error encountered, or an error if there's data
+// left over.
+func (d *cborDecoder) finish() error {
+	if d.err == nil && len(d.data) != 0 {
+		d.err = errCBORMalformed
+	}
+	return d.err
+}
+
+// MarshalCBOR returns the CBOR encoding of the BloomFilter.
+func (b *BloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagBloomFilter)
+	e.array(4)
+	e.uint(uint64(b.m))
+	e.uint(b.packedK())
+	e.uint(uint64(b.count))
+	e.buckets(b.buckets)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the BloomFilter from its CBOR encoding.
+func (b *BloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagBloomFilter)
+	d.array(4)
+	var (
+		m       = d.uint()
+		k       = d.uint()
+		count   = d.uint()
+		buckets = d.buckets()
+	)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if buckets.bucketSize != 1 || uint64(buckets.count) != m || !validPackedK(k) {
+		return errCBORMalformed
+	}
+
+	b.buckets = buckets
+	b.hash = newDefaultHash()
+	b.m = uint(m)
+	b.unpackK(k)
+	b.count = uint(count)
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the PartitionedBloomFilter.
+func (p *PartitionedBloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	p.encodeCBOR(e)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the PartitionedBloomFilter from its CBOR encoding.
+func (p *PartitionedBloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	p.decodeCBOR(d)
+	return d.finish()
+}
+
+func (p *PartitionedBloomFilter) encodeCBOR(e *cborEncoder) {
+	e.tag(CBORTagPartitionedBloomFilter)
+	e.array(5)
+	e.uint(uint64(p.m))
+	e.uint(uint64(p.k))
+	e.uint(uint64(p.s))
+	e.uint(uint64(p.count))
+	e.array(len(p.partitions))
+	for _, partition := range p.partitions {
+		e.buckets(partition)
+	}
+}
+
+func (p *PartitionedBloomFilter) decodeCBOR(d *cborDecoder) {
+	d.tag(CBORTagPartitionedBloomFilter)
+	d.array(5)
+	var (
+		m          = d.uint()
+		k          = d.uint()
+		s          = d.uint()
+		count      = d.uint()
+		partitions = make([]*Buckets, d.arrayLen())
+	)
+	for i := range partitions {
+		partitions[i] = d.buckets()
+		if d.err == nil && (partitions[i].bucketSize != 1 || uint64(partitions[i].count) != s) {
+			d.err = errCBORMalformed
+		}
+	}
+	if d.err == nil && (uint64(len(partitions)) != k || !validPartitionedDimensions(m, k, s)) {
+		d.err = errCBORMalformed
+	}
+	if d.err != nil {
+		return
+	}
+
+	p.partitions = partitions
+	p.hash = newDefaultHash()
+	p.m = uint(m)
+	p.k = uint(k)
+	p.s = uint(s)
+	p.count = uint(count)
+}
+
+// MarshalCBOR returns the CBOR encoding of the CountingBloomFilter.
+func (c *CountingBloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagCountingBloomFilter)
+	if c.spill == nil {
+		e.array(4)
+	} else {
+		e.array(5)
+	}
+	e.uint(uint64(c.m))
+	e.uint(uint64(c.k))
+	e.uint(uint64(c.count))
+	e.buckets(c.buckets)
+	if c.spill != nil {
+		spilled := c.spilledBuckets()
+		e.array(2 * len(spilled))
+		for _, idx := range spilled {
+			e.uint(uint64(idx))
+			e.uint(uint64(c.spill[idx]))
+		}
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the CountingBloomFilter from its CBOR encoding.
+func (c *CountingBloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagCountingBloomFilter)
+	var (
+		fields  = d.arrayLen()
+		m       = d.uint()
+		k       = d.uint()
+		count   = d.uint()
+		buckets = d.buckets()
+		spill   map[uint]uint32
+	)
+	if fields == 5 {
+		spill = make(map[uint]uint32)
+		n := d.arrayLen()
+		for i := 0; i+1 < n; i += 2 {
+			idx := d.uint()
+			spill[uint(idx)] = uint32(d.uint())
+		}
+		if n%2 != 0 {
+			d.err = errCBORMalformed
+		}
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if (fields != 4 && fields != 5) || uint64(buckets.count) != m || k == 0 || k > m {
+		return errCBORMalformed
+	}
+
+	c.buckets = buckets
+	c.hash = newDefaultHash()
+	c.m = uint(m)
+	c.k = uint(k)
+	c.count = uint(count)
+	c.indexBuffer = make([]uint, k)
+	c.spill = spill
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the ScalableBloomFilter.
+func (s *ScalableBloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagScalableBloomFilter)
+	e.array(5)
+	e.float(s.r)
+	e.float(s.fp)
+	e.float(s.p)
+	e.uint(uint64(s.hint))
+	e.array(len(s.filters))
+	for _, filter := range s.filters {
+		filter.encodeCBOR(e)
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the ScalableBloomFilter from its CBOR encoding.
+func (s *ScalableBloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagScalableBloomFilter)
+	d.array(5)
+	var (
+		r       = d.float()
+		fp      = d.float()
+		p       = d.float()
+		hint    = d.uint()
+		filters = make([]*PartitionedBloomFilter, d.arrayLen())
+	)
+	for i := range filters {
+		filters[i] = &PartitionedBloomFilter{}
+		filters[i].decodeCBOR(d)
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if len(filters) == 0 || validateScalable(uint(hint), fp, r, p) != nil {
+		return errCBORMalformed
+	}
+
+	s.filters = filters
+	s.r = r
+	s.fp = fp
+	s.p = p
+	s.hint = uint(hint)
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the StableBloomFilter.
+func (s *StableBloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagStableBloomFilter)
+	e.array(5)
+	e.uint(uint64(s.m))
+	e.uint(uint64(s.k))
+	e.uint(uint64(s.p))
+	e.uint(uint64(s.max))
+	e.buckets(s.cells)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the StableBloomFilter from its CBOR encoding.
+func (s *StableBloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagStableBloomFilter)
+	d.array(5)
+	var (
+		m     = d.uint()
+		k     = d.uint()
+		p     = d.uint()
+		max   = d.uint()
+		cells = d.buckets()
+	)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if uint64(cells.count) != m || max != uint64(cells.max) || k == 0 || k > m || p > m {
+		return errCBORMalformed
+	}
+
+	s.cells = cells
+	s.hash = newDefaultHash()
+	s.m = uint(m)
+	s.k = uint(k)
+	s.p = uint(p)
+	s.max = uint8(max)
+	s.indexBuffer = make([]uint, k)
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the CountMinSketch.
+func (c *CountMinSketch) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagCountMinSketch)
+	e.array(6)
+	e.uint(uint64(c.width))
+	e.uint(uint64(c.depth))
+	e.float(c.epsilon)
+	e.float(c.delta)
+	e.uint(c.count)
+	e.array(len(c.matrix))
+	for _, row := range c.matrix {
+		e.array(len(row))
+		for _, counter := range row {
+			e.uint(counter)
+		}
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the CountMinSketch from its CBOR encoding.
+func (c *CountMinSketch) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagCountMinSketch)
+	d.array(6)
+	var (
+		width   = d.uint()
+		depth   = d.uint()
+		epsilon = d.float()
+		delta   = d.float()
+		count   = d.uint()
+		matrix  = make([][]uint64, d.arrayLen())
+	)
+	if d.err == nil && (width == 0 || depth == 0 || uint64(len(matrix)) != depth) {
+		d.err = errCBORMalformed
+	}
+	for i := range matrix {
+		matrix[i] = make([]uint64, d.arrayLen())
+		if d.err == nil && uint64(len(matrix[i])) != width {
+			d.err = errCBORMalformed
+		}
+		for j := range matrix[i] {
+			matrix[i][j] = d.uint()
+		}
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	c.matrix = matrix
+	c.width = uint(width)
+	c.depth = uint(depth)
+	c.epsilon = epsilon
+	c.delta = delta
+	c.count = count
+	c.hash = newDefaultHash()
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the HyperLogLog.
+func (h *HyperLogLog) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagHyperLogLog)
+	e.array(4)
+	e.uint(uint64(h.m))
+	e.uint(uint64(h.b))
+	e.float(h.alpha)
+	e.bytes(h.registers)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the HyperLogLog from its CBOR encoding.
+func (h *HyperLogLog) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagHyperLogLog)
+	d.array(4)
+	var (
+		m         = d.uint()
+		b         = d.uint()
+		alpha     = d.float()
+		registers = d.bytes()
+	)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if b > maxHLLPrecision || m != 1<<b || uint64(len(registers)) != hllRegistersSize(m) {
+		return errCBORMalformed
+	}
+
+	h.registers = registers
+	h.m = uint(m)
+	h.b = uint32(b)
+	h.alpha = alpha
+	h.hash = fnv.New32()
+	return nil
+}
+
+// MarshalCBOR returns the CBOR encoding of the InverseBloomFilter. Data added
+// concurrently may or may not be included.
+func (i *InverseBloomFilter) MarshalCBOR() ([]byte, error) {
+	e := &cborEncoder{}
+	e.tag(CBORTagInverseBloomFilter)
+	e.array(2)
+	e.uint(uint64(i.capacity))
+	e.array(len(i.array))
+	for j := range i.array {
+		if data := i.array[j].Load(); data == nil {
+			e.null()
+		} else {
+			e.bytes(*data)
+		}
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalCBOR restores the InverseBloomFilter from its CBOR encoding.
+func (i *InverseBloomFilter) UnmarshalCBOR(data []byte) error {
+	d := &cborDecoder{data: data}
+	d.tag(CBORTagInverseBloomFilter)
+	d.array(2)
+	var (
+		capacity = d.uint()
+		array    = make([]atomic.Pointer[[]byte], d.arrayLen())
+	)
+	for j := range array {
+		if d.null() {
+			continue
+		}
+		data := d.bytes()
+		array[j].Store(&data)
+	}
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if uint64(len(array)) != capacity || capacity == 0 {
+		return errCBORMalformed
+	}
+
+	i.array = array
+	i.capacity = uint(capacity)
+	i.hash = fnv.New32()
+	return nil
+}
@@ -0,0 +1,274 @@
+package boom
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Ensures that the CBOR encoder writes the shortest head for each argument and
+// the decoder reads it back.
+func TestCBORHead(t *testing.T) {
+	tests := []struct {
+		arg      uint64
+		expected []byte
+	}{
+		{0, []byte{0x00}},
+		{23, []byte{0x17}},
+		{24, []byte{0x18, 0x18}},
+		{1000, []byte{0x19, 0x03, 0xe8}},
+		{1000000, []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{1000000000000, []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}},
+	}
+
+	for _, test := range tests {
+		e := &cborEncoder{}
+		e.uint(test.arg)
+		if !bytes.Equal(e.buf.Bytes(), test.expected) {
+			t.Errorf("Expected %x, got %x", test.expected, e.buf.Bytes())
+		}
+
+		d := &cborDecoder{data: test.expected}
+		if arg := d.uint(); arg != test.arg || d.finish() != nil {
+			t.Errorf("Expected %d, got %d", test.arg, arg)
+		}
+	}
+}
+
+// Ensures that a BloomFilter is encoded with the documented layout and
+// round-trips through CBOR.
+func TestBloomCBOR(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	data, err := f.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tag 0x626f6f00 followed by a four element array.
+	if !bytes.HasPrefix(data, []byte{0xda, 0x62, 0x6f, 0x6f, 0x00, 0x84}) {
+		t.Errorf("Unexpected header %x", data[:6])
+	}
+
+	other := &BloomFilter{}
+	if err := other.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Capacity() != f.Capacity() || other.K() != f.K() || other.Count() != f.Count() {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	if err := other.UnmarshalCBOR(data[:len(data)-1]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+
+	if err := (&CountingBloomFilter{}).UnmarshalCBOR(data); err == nil {
+		t.Error("Expected error for mismatched tag")
+	}
+}
+
+// Ensures that the remaining structures round-trip through CBOR.
+func TestCBORRoundTrip(t *testing.T) {
+	partitioned := NewPartitionedBloomFilter(100, 0.01)
+	counting := NewCountingBloomFilter(100, 4, 0.01)
+	scalable := NewScalableBloomFilter(10, 0.01, 0.8)
+	stable := NewDefaultStableBloomFilter(1000, 0.01)
+	inverse := NewInverseBloomFilter(100)
+	for i := 0; i < 100; i++ {
+		data := []byte(strconv.Itoa(i))
+		partitioned.Add(data)
+		counting.Add(data)
+		scalable.Add(data)
+		stable.Add(data)
+		inverse.Add(data)
+	}
+
+	tests := []struct {
+		filter interface {
+			Filter
+			MarshalCBOR() ([]byte, error)
+		}
+		decoded interface {
+			Filter
+			UnmarshalCBOR([]byte) error
+		}
+	}{
+		{partitioned, &PartitionedBloomFilter{}},
+		{counting, &CountingBloomFilter{}},
+		{scalable, &ScalableBloomFilter{}},
+		{stable, &StableBloomFilter{}},
+		{inverse, &InverseBloomFilter{}},
+	}
+
+	for _, test := range tests {
+		data, err := test.filter.MarshalCBOR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.decoded.UnmarshalCBOR(data); err != nil {
+			t.Fatalf("%T: %v", test.decoded, err)
+		}
+		for i := 0; i < 200; i++ {
+			data := []byte(strconv.Itoa(i))
+			if test.decoded.Test(data) != test.filter.Test(data) {
+				t.Errorf("%T: Expected decoded filter to agree for `%s`", test.decoded, data)
+			}
+		}
+	}
+
+	// Decoded filters can still be added to.
+	for _, test := range tests {
+		test.decoded.Add([]byte(`a`))
+		if !test.decoded.Test([]byte(`a`)) {
+			t.Errorf("%T: `a` should be a member", test.decoded)
+		}
+	}
+}
+
+// Ensures that decoding rejects a number of hash functions which is zero or
+// larger than the filter.
+func TestCBORInvalidK(t *testing.T) {
+	for _, k := range []uint{0, 1001, 1 << 31} {
+		counting := NewCountingBloomFilter(100, 4, 0.01)
+		counting.m, counting.k = 1000, k
+		counting.buckets = NewBuckets(1000, 4)
+		stable := NewDefaultStableBloomFilter(1000, 0.01)
+		stable.k = k
+
+		for _, test := range []struct {
+			filter  interface{ MarshalCBOR() ([]byte, error) }
+			decoded interface{ UnmarshalCBOR([]byte) error }
+		}{
+			{counting, &CountingBloomFilter{}},
+			{stable, &StableBloomFilter{}},
+		} {
+			data, err := test.filter.MarshalCBOR()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := test.decoded.UnmarshalCBOR(data); err == nil {
+				t.Errorf("%T: Expected error for k = %d", test.decoded, k)
+			}
+		}
+	}
+}
+
+// Ensures that decoding rejects dimensions which would make the structure
+// panic or loop when used.
+func TestCBORInvalidDimensions(t *testing.T) {
+	// A Bloom filter whose bit count overflows to zero bytes.
+	e := &cborEncoder{}
+	e.tag(CBORTagBloomFilter)
+	e.array(4)
+	e.uint(math.MaxUint64)
+	e.uint(1)
+	e.uint(0)
+	e.array(3)
+	e.uint(1)
+	e.uint(math.MaxUint64)
+	e.bytes(nil)
+	if err := (&BloomFilter{}).UnmarshalCBOR(e.buf.Bytes()); err == nil {
+		t.Error("Expected error for overflowing buckets")
+	}
+
+	partitioned := NewPartitionedBloomFilter(100, 0.01)
+	partitioned.s = 0
+	for i := range partitioned.partitions {
+		partitioned.partitions[i] = NewBuckets(0, 1)
+	}
+	scalable := NewDefaultScalableBloomFilter(0.01)
+	scalable.r = 2
+	stable := NewDefaultStableBloomFilter(1000, 0.01)
+	stable.p = 1001
+	cms := NewCountMinSketch(0.01, 0.99)
+	cms.width = 0
+	for i := range cms.matrix {
+		cms.matrix[i] = nil
+	}
+	hll, err := NewHyperLogLog(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hll.b = 40
+
+	for _, test := range []struct {
+		filter  interface{ MarshalCBOR() ([]byte, error) }
+		decoded interface{ UnmarshalCBOR([]byte) error }
+	}{
+		{partitioned, &PartitionedBloomFilter{}},
+		{scalable, &ScalableBloomFilter{}},
+		{stable, &StableBloomFilter{}},
+		{cms, &CountMinSketch{}},
+		{hll, &HyperLogLog{}},
+	} {
+		data, err := test.filter.MarshalCBOR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.decoded.UnmarshalCBOR(data); err == nil {
+			t.Errorf("%T: Expected error", test.decoded)
+		}
+	}
+}
+
+// Ensures that a CountMinSketch round-trips through CBOR.
+func TestCMSCBOR(t *testing.T) {
+	cms := NewCountMinSketch(0.01, 0.99)
+	for i := 0; i < 100; i++ {
+		cms.Add([]byte(strconv.Itoa(i % 10)))
+	}
+
+	data, err := cms.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &CountMinSketch{}
+	if err := other.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.TotalCount() != 100 || other.Epsilon() != 0.01 || other.Delta() != 0.99 {
+		t.Errorf("Expected %s, got %s", cms, other)
+	}
+
+	if count := other.Count([]byte(`3`)); count != cms.Count([]byte(`3`)) {
+		t.Errorf("Expected %d, got %d", cms.Count([]byte(`3`)), count)
+	}
+}
+
+// Ensures that a HyperLogLog round-trips through CBOR.
+func TestHyperLogLogCBOR(t *testing.T) {
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range dictionary(1000) {
+		hll.Add([]byte(word))
+	}
+
+	data, err := hll.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &HyperLogLog{}
+	if err := other.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := other.Count(); count != hll.Count() {
+		t.Errorf("Expected %d, got %d", hll.Count(), count)
+	}
+}
@@ -1,19 +1,31 @@
 package boom
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
-	"hash/fnv"
+	"io"
 	"math"
 )
 
+// batchTestSize is the number of queries TestAll prefetches at a time. It's
+// large enough to keep many cache misses in flight while the probe addresses
+// stay in registers and L1.
+const batchTestSize = 16
+
 // BloomFilter implements a classic Bloom filter. A Bloom filter has a non-zero
 // probability of false positives and a zero probability of false negatives.
 type BloomFilter struct {
-	buckets *Buckets    // filter data
-	hash    hash.Hash64 // hash function (kernel for all k functions)
-	m       uint        // filter size
-	k       uint        // number of hash functions
-	count   uint        // number of items added
+	buckets  *Buckets    // filter data
+	hash     hash.Hash64 // hash function (kernel for all k functions)
+	m        uint        // filter size
+	k        uint        // number of hash functions
+	extra    uint32      // probability of an extra hash function, of 2^32
+	indexing Indexing    // index derivation scheme
+	count    uint        // number of items added
 }
 
 // NewBloomFilter creates a new Bloom filter optimized to store n items with a
@@ -22,12 +34,49 @@ func NewBloomFilter(n uint, fpRate float64) *BloomFilter {
 	m := OptimalM(n, fpRate)
 	return &BloomFilter{
 		buckets: NewBuckets(m, 1),
-		hash:    fnv.New64(),
+		hash:    newDefaultHash(),
 		m:       m,
 		k:       OptimalK(fpRate),
 	}
 }
 
+// NewBloomFilterE is like NewBloomFilter but returns an error if n is zero,
+// fpRate isn't between 0 and 1, or the filter would be too large to address.
+func NewBloomFilterE(n uint, fpRate float64) (*BloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+	return NewBloomFilter(n, fpRate), nil
+}
+
+// NewFractionalBloomFilter creates a new Bloom filter optimized to store n
+// items with a specified target false-positive rate, using the exact optimal
+// number of hash functions for its size rather than rounding it up to an
+// integer. See SetFractionalK.
+func NewFractionalBloomFilter(n uint, fpRate float64) *BloomFilter {
+	b := NewBloomFilter(n, fpRate)
+	b.SetFractionalK(OptimalFractionalK(b.m, n))
+	return b
+}
+
+// NewKeyedBloomFilter creates a new Bloom filter optimized to store n items
+// with a specified target false-positive rate, which hashes with SipHash keyed
+// with a random key. Items from untrusted clients can't be crafted to collide
+// in it, which would inflate its false-positive rate. The key is only known
+// to the filter, so it can't be merged with other filters or read back from
+// its serialization; use SetHash with NewSipHash and a stored key for that.
+func NewKeyedBloomFilter(n uint, fpRate float64) *BloomFilter {
+	b := NewBloomFilter(n, fpRate)
+	b.SetHash(newRandomSipHash())
+	return b
+}
+
 // Capacity returns the Bloom filter capacity, m.
 func (b *BloomFilter) Capacity() uint {
 	return b.m
@@ -38,6 +87,30 @@ func (b *BloomFilter) K() uint {
 	return b.k
 }
 
+// EffectiveK returns the average number of hash functions used per item, which
+// is K unless the filter uses a fractional number of hash functions.
+func (b *BloomFilter) EffectiveK() float64 {
+	return float64(b.k) + float64(b.extra)/(1<<32)
+}
+
+// SetFractionalK sets a non-integer number of hash functions, such as 6.4,
+// which is clamped to between 1 and the maximum. Each item uses the integer
+// part, and one more hash function with probability of the fractional part,
+// chosen deterministically from the item's hash. This lets the filter hit the
+// theoretical optimum of ln(2) * m / n hash functions, which rounding loses
+// accuracy against. It must be called before any items are added.
+func (b *BloomFilter) SetFractionalK(k float64) {
+	switch {
+	case math.IsNaN(k) || k < 1:
+		k = 1
+	case k > maxK:
+		k = maxK
+	}
+	whole := math.Floor(k)
+	b.k = uint(whole)
+	b.extra = uint32((k - whole) * (1 << 32))
+}
+
 // Count returns the number of items added to the filter.
 func (b *BloomFilter) Count() uint {
 	return b.count
@@ -45,16 +118,27 @@ func (b *BloomFilter) Count() uint {
 
 // EstimatedFillRatio returns the current estimated ratio of set bits.
 func (b *BloomFilter) EstimatedFillRatio() float64 {
-	return 1 - math.Exp((-float64(b.count)*float64(b.k))/float64(b.m))
+	return 1 - math.Exp((-float64(b.count)*b.EffectiveK())/float64(b.m))
 }
 
 // FillRatio returns the ratio of set bits.
 func (b *BloomFilter) FillRatio() float64 {
-	sum := uint32(0)
-	for i := uint(0); i < b.buckets.Count(); i++ {
-		sum += b.buckets.Get(i)
-	}
-	return float64(sum) / float64(b.m)
+	return float64(b.buckets.nonZero()) / float64(b.m)
+}
+
+// EstimateFPRate returns the current expected false-positive rate, derived
+// from the ratio of set bits and the number of hash functions. It grows as
+// the filter fills, so it can be monitored to detect when a long-lived filter
+// has degraded past its target.
+func (b *BloomFilter) EstimateFPRate() float64 {
+	return math.Pow(b.FillRatio(), b.EffectiveK())
+}
+
+// SetHash sets the hashing function used in the filter. Filters must use the
+// same hashing function to be merged. For in-memory filters, NewMapHash
+// provides a fast, randomly seeded alternative to the default FNV-1 hash.
+func (b *BloomFilter) SetHash(h hash.Hash64) {
+	b.hash = h
 }
 
 // Test will test for membership of the data and returns true if it is a
@@ -62,29 +146,28 @@ func (b *BloomFilter) FillRatio() float64 {
 // non-zero probability of false positives but a zero probability of false
 // negatives.
 func (b *BloomFilter) Test(data []byte) bool {
-	lower, upper := hashKernel(data, b.hash)
-
-	// If any of the K bits are not set, then it's not a member.
-	for i := uint(0); i < b.k; i++ {
-		if b.buckets.Get((uint(lower)+uint(upper)*i)%b.m) == 0 {
-			return false
-		}
-	}
-
-	return true
+	return b.testKernel(hashKernel(data, b.hash))
 }
 
 // Add will add the data to the Bloom filter. It returns the filter to allow
 // for chaining.
 func (b *BloomFilter) Add(data []byte) Filter {
-	lower, upper := hashKernel(data, b.hash)
+	b.addKernel(hashKernel(data, b.hash))
+	return b
+}
 
-	// Set the K bits.
-	for i := uint(0); i < b.k; i++ {
-		b.buckets.Set((uint(lower)+uint(upper)*i)%b.m, 1)
-	}
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (b *BloomFilter) TestHash(lower, upper uint32) bool {
+	return b.testKernel(lower, upper)
+}
 
-	b.count++
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (b *BloomFilter) AddHash(lower, upper uint32) Filter {
+	b.addKernel(lower, upper)
 	return b
 }
 
@@ -95,8 +178,8 @@ func (b *BloomFilter) TestAndAdd(data []byte) bool {
 	member := true
 
 	// If any of the K bits are not set, then it's not a member.
-	for i := uint(0); i < b.k; i++ {
-		idx := (uint(lower) + uint(upper)*i) % b.m
+	for i, k := uint(0), b.probes(lower, upper); i < k; i++ {
+		idx := b.indexing.index(lower, upper, i, b.m)
 		if b.buckets.Get(idx) == 0 {
 			member = false
 		}
@@ -107,9 +190,367 @@ func (b *BloomFilter) TestAndAdd(data []byte) bool {
 	return member
 }
 
+// TestAll tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element,
+// but faster for large filters: queries are processed in batches, and the
+// probe addresses of a batch are computed and loaded before any are tested, so
+// the cache misses overlap rather than occurring one at a time.
+func (b *BloomFilter) TestAll(data [][]byte) []bool {
+	var (
+		results = make([]bool, len(data))
+		probes  = make([]uint, 0, batchTestSize*(b.k+1))
+		ends    [batchTestSize]int
+	)
+	for start := 0; start < len(data); start += batchTestSize {
+		batch := data[start:]
+		if len(batch) > batchTestSize {
+			batch = batch[:batchTestSize]
+		}
+
+		// Compute every probe address of the batch and prefetch them.
+		probes = probes[:0]
+		for j, element := range batch {
+			lower, upper := hashKernel(element, b.hash)
+			for i, k := uint(0), b.probes(lower, upper); i < k; i++ {
+				probes = append(probes, b.indexing.index(lower, upper, i, b.m))
+			}
+			ends[j] = len(probes)
+		}
+		b.buckets.prefetch(probes)
+
+		for j := range batch {
+			member, begin := true, 0
+			if j > 0 {
+				begin = ends[j-1]
+			}
+			for _, idx := range probes[begin:ends[j]] {
+				if b.buckets.Get(idx) == 0 {
+					member = false
+					break
+				}
+			}
+			results[start+j] = member
+		}
+	}
+
+	return results
+}
+
+// TestMany is equivalent to TestAll.
+func (b *BloomFilter) TestMany(data [][]byte) []bool {
+	return b.TestAll(data)
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (b *BloomFilter) TestString(data string) bool {
+	return b.TestHash(hashKernelString(data, b.hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (b *BloomFilter) AddString(data string) Filter {
+	return b.AddHash(hashKernelString(data, b.hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (b *BloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, b.hash)
+	member := b.TestHash(lower, upper)
+	b.AddHash(lower, upper)
+	return member
+}
+
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (b *BloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		b.addKernel(hashKernel(element, b.hash))
+	}
+	return b
+}
+
+// Indexing returns the scheme the filter derives the indices of items' bits
+// with.
+func (b *BloomFilter) Indexing() Indexing {
+	return b.indexing
+}
+
+// SetIndexing sets the scheme the filter derives the indices of items' bits
+// with. EnhancedDoubleHashing and TripleHashing keep the realized
+// false-positive rate closer to the theoretical one at high fill, at a small
+// cost in speed. Filters must use the same scheme to be merged. It must be
+// called before any items are added.
+func (b *BloomFilter) SetIndexing(indexing Indexing) {
+	b.indexing = indexing
+}
+
+// Merge combines this filter with another by ORing their bits, so the result
+// contains the items added to either. The count becomes the sum of the
+// counts, which overestimates it if the filters share items. Returns an error
+// if the filter sizes, number of hash functions, or indexing schemes are not
+// equal.
+func (b *BloomFilter) Merge(other *BloomFilter) error {
+	return b.MergeContext(context.Background(), other, nil)
+}
+
+// MergeContext is like Merge, but stops with the context's error once the
+// context is done, so that merging filters of many gigabytes can be
+// cancelled. The bits are merged 1 MiB at a time, and progress, if not nil, is
+// called with the number of bytes merged and the total after each chunk. If
+// it's cancelled, the filter holds some of the other's bits and its count is
+// unchanged, so it's still a valid filter of its own items.
+func (b *BloomFilter) MergeContext(ctx context.Context, other *BloomFilter,
+	progress func(merged, total uint64)) error {
+
+	if err := b.mergeable(other); err != nil {
+		return err
+	}
+
+	data, total := other.buckets.data, uint64(len(other.buckets.data))
+	for offset := 0; offset < len(data); offset += contextChunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(offset+contextChunk, len(data))
+		for i, bits := range data[offset:end] {
+			b.buckets.data[offset+i] |= bits
+		}
+		b.buckets.markDirty(uint(offset), uint(end))
+		if progress != nil {
+			progress(uint64(end), total)
+		}
+	}
+	b.count += other.count
+	return nil
+}
+
+// mergeable returns an error if the other filter can't be merged into this
+// one because their sizes, numbers of hash functions, or indexing schemes
+// differ.
+func (b *BloomFilter) mergeable(other *BloomFilter) error {
+	if b.m != other.m {
+		return errors.New("filter size must match")
+	}
+
+	if b.k != other.k || b.extra != other.extra {
+		return errors.New("number of hash functions must match")
+	}
+
+	if b.indexing != other.indexing {
+		return errors.New("indexing scheme must match")
+	}
+	return nil
+}
+
+// Union combines this filter with another built independently, such as on
+// another shard, so the result contains the items added to either. It's
+// equivalent to Merge, but also returns an error if the filters use different
+// hashing functions, in which case their bits can't be combined.
+func (b *BloomFilter) Union(other *BloomFilter) error {
+	if !sameHash(b.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+	return b.Merge(other)
+}
+
+// Intersect combines this filter with another by ANDing their bits, so the
+// result contains the items added to both. The result can have more false
+// positives than a filter built from the common items alone, since bits set by
+// different items in each filter survive. The count becomes the estimated
+// number of items in the intersection. Returns an error if the filter sizes,
+// number of hash functions, indexing schemes, or hashing functions are not
+// equal.
+func (b *BloomFilter) Intersect(other *BloomFilter) error {
+	if b.m != other.m {
+		return errors.New("filter size must match")
+	}
+	if b.k != other.k || b.extra != other.extra {
+		return errors.New("number of hash functions must match")
+	}
+	if b.indexing != other.indexing {
+		return errors.New("indexing scheme must match")
+	}
+	if !sameHash(b.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+
+	for i, bits := range other.buckets.data {
+		b.buckets.data[i] &= bits
+	}
+	b.buckets.markDirty(0, uint(len(b.buckets.data)))
+	count := uint(math.Round(b.EstimatedCardinality()))
+	if count > b.count {
+		count = b.count
+	}
+	if count > other.count {
+		count = other.count
+	}
+	b.count = count
+	return nil
+}
+
+// WriteTo writes a binary representation of the BloomFilter to an i/o stream.
+// It returns the number of bytes written.
+func (b *BloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(b.count), uint64(b.m), b.packedK()}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := b.buckets.WriteTo(stream)
+	return written + n, err
+}
+
+// ReadFrom reads a binary representation of a BloomFilter (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (b *BloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	buckets := &Buckets{}
+	n, err := buckets.ReadFrom(stream)
+	read += n
+	if err != nil {
+		return read, err
+	}
+	if buckets.bucketSize != 1 || uint64(buckets.count) != header[1] || !validPackedK(header[2]) {
+		return read, errors.New("invalid bloom filter dimensions")
+	}
+
+	b.buckets = buckets
+	if b.hash == nil {
+		b.hash = newDefaultHash()
+	}
+	b.count = uint(header[0])
+	b.m = uint(header[1])
+	b.unpackK(header[2])
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (b *BloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (b *BloomFilter) GobDecode(data []byte) error {
+	_, err := b.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the Bloom
+// filter's data.
+func (b *BloomFilter) ByteSize() uint {
+	return b.buckets.ByteSize()
+}
+
+// String returns a one-line summary of the BloomFilter for logging and
+// debugging.
+func (b *BloomFilter) String() string {
+	k := b.EffectiveK()
+	return fmt.Sprintf("BloomFilter{m=%d k=%.4g count=%d fill=%.4f fp=%.4g}",
+		b.m, k, b.count, b.EstimatedFillRatio(), estimatedFractionalFPRate(b.m, k, b.count))
+}
+
 // Reset restores the Bloom filter to its original state. It returns the filter
 // to allow for chaining.
 func (b *BloomFilter) Reset() *BloomFilter {
 	b.buckets.Reset()
+	b.count = 0
 	return b
 }
+
+// Copy returns a deep copy of the BloomFilter, which can be used
+// independently of it, such as to serialize a snapshot while the original
+// continues to accept writes. Returns ErrHashNotCloneable if the filter's hash
+// can't be cloned.
+func (b *BloomFilter) Copy() (*BloomFilter, error) {
+	hash, err := copyHash64(b.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *b
+	copied.buckets = b.buckets.Copy()
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other BloomFilter has the same parameters, hashing
+// function, and bits and count, such as a replica or one decoded from this
+// one's serialization.
+func (b *BloomFilter) Equal(other *BloomFilter) bool {
+	return b.m == other.m && b.k == other.k && b.extra == other.extra &&
+		b.indexing == other.indexing && b.count == other.count && sameHash(b.hash, other.hash) &&
+		b.buckets.Equal(other.buckets)
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (b *BloomFilter) Clear() {
+	b.Reset()
+}
+
+// testKernel tests for membership of the data with the base hash values.
+func (b *BloomFilter) testKernel(lower, upper uint32) bool {
+	// If any of the K bits are not set, then it's not a member.
+	for i, k := uint(0), b.probes(lower, upper); i < k; i++ {
+		if b.buckets.Get(b.indexing.index(lower, upper, i, b.m)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addKernel adds the data with the base hash values.
+func (b *BloomFilter) addKernel(lower, upper uint32) {
+	// Set the K bits.
+	for i, k := uint(0), b.probes(lower, upper); i < k; i++ {
+		b.buckets.Set(b.indexing.index(lower, upper, i, b.m), 1)
+	}
+
+	b.count++
+}
+
+// probes returns the number of hash functions to use for the base hash values.
+// This is K, plus one with the probability of the fractional part of K.
+func (b *BloomFilter) probes(lower, upper uint32) uint {
+	if b.extra != 0 && uint32(fmix64(uint64(upper)<<32|uint64(lower))) < b.extra {
+		return b.k + 1
+	}
+	return b.k
+}
+
+// packedK returns the number of hash functions encoded for serialization, with
+// the fractional part in the upper 32 bits and the indexing scheme in the top
+// byte of the lower 32 bits, so that integer K with double hashing is
+// unchanged.
+func (b *BloomFilter) packedK() uint64 {
+	return uint64(b.extra)<<32 | uint64(b.indexing)<<24 | uint64(b.k)
+}
+
+// unpackK sets the number of hash functions and indexing scheme from the
+// encoding of packedK.
+func (b *BloomFilter) unpackK(k uint64) {
+	b.k = uint(uint32(k) & 0xffffff)
+	b.extra = uint32(k >> 32)
+	b.indexing = Indexing(uint32(k) >> 24)
+}
+
+// validPackedK returns whether the encoding of packedK has a non-zero K and a
+// known indexing scheme.
+func validPackedK(k uint64) bool {
+	return uint32(k)&0xffffff != 0 && Indexing(uint32(k)>>24) <= TripleHashing
+}
@@ -1,6 +1,10 @@
 package boom
 
 import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"math"
 	"strconv"
 	"testing"
 )
@@ -14,6 +18,35 @@ func TestBloomCapacity(t *testing.T) {
 	}
 }
 
+// Ensures that NewBloomFilterE returns an error for invalid parameters.
+func TestNewBloomFilterE(t *testing.T) {
+	if f, err := NewBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a BloomFilter, got error %v", err)
+	}
+
+	if _, err := NewBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewBloomFilterE(100, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewBloomFilterE(100, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that String summarizes the filter.
+func TestBloomString(t *testing.T) {
+	f := NewBloomFilter(100, 0.1)
+	expected := "BloomFilter{m=480 k=4 count=0 fill=0.0000 fp=0}"
+
+	if s := f.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
+
 // Ensures that K returns the number of hash functions in the Bloom Filter.
 func TestBloomK(t *testing.T) {
 	f := NewBloomFilter(100, 0.1)
@@ -112,6 +145,164 @@ func TestBloomTestAndAdd(t *testing.T) {
 	}
 }
 
+// Ensures that Merge combines the members of both filters and returns an
+// error if the filters are incompatible.
+func TestBloomMerge(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	other := NewBloomFilter(100, 0.01)
+	f.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+	other.Add([]byte(`c`))
+
+	if err := f.Merge(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, data := range []string{"a", "b", "c"} {
+		if !f.Test([]byte(data)) {
+			t.Errorf("`%s` should be a member", data)
+		}
+	}
+
+	if count := f.Count(); count != 3 {
+		t.Errorf("Expected 3, got %d", count)
+	}
+
+	if err := f.Merge(NewBloomFilter(1000, 0.01)); err == nil {
+		t.Error("Expected error for mismatched size")
+	}
+}
+
+// Ensures that MergeContext merges in chunks, reporting progress, and stops
+// once the context is cancelled, leaving the count unchanged.
+func TestBloomMergeContext(t *testing.T) {
+	f := NewBloomFilter(2000000, 0.01)
+	other := NewBloomFilter(2000000, 0.01)
+	f.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+
+	var reports []uint64
+	err := f.MergeContext(context.Background(), other, func(merged, total uint64) {
+		if total != uint64(len(other.buckets.data)) {
+			t.Errorf("Expected total of %d, got %d", len(other.buckets.data), total)
+		}
+		reports = append(reports, merged)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) < 2 || reports[0] != contextChunk || reports[len(reports)-1] != uint64(len(f.buckets.data)) {
+		t.Errorf("Expected progress for each chunk, got %v", reports)
+	}
+	if !f.Test([]byte(`b`)) || f.Count() != 2 {
+		t.Errorf("Expected `b` to be merged, got %s", f)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = f.MergeContext(ctx, other, func(merged, total uint64) { cancel() })
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if f.Count() != 2 {
+		t.Errorf("Expected 2, got %d", f.Count())
+	}
+}
+
+// Ensures that Union combines filters and checks their compatibility.
+func TestBloomUnion(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	other := NewBloomFilter(100, 0.01)
+	f.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+
+	if err := f.Union(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !f.Test([]byte(`a`)) || !f.Test([]byte(`b`)) {
+		t.Error("`a` and `b` should be members")
+	}
+
+	if err := f.Union(NewBloomFilter(1000, 0.01)); err == nil {
+		t.Error("Expected error for mismatched size")
+	}
+	other.SetHash(fnv.New64a())
+	if err := f.Union(other); err == nil {
+		t.Error("Expected error for mismatched hash")
+	}
+}
+
+// Ensures that Intersect keeps only the common items and checks the filters'
+// compatibility.
+func TestBloomIntersect(t *testing.T) {
+	f := NewBloomFilter(1000, 0.001)
+	other := NewBloomFilter(1000, 0.001)
+	for i := 0; i < 200; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		other.Add([]byte(strconv.Itoa(i + 100)))
+	}
+
+	if err := f.Intersect(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 100; i < 200; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+	fp := 0
+	for i := 0; i < 100; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) || f.Test([]byte(strconv.Itoa(i+200))) {
+			fp++
+		}
+	}
+	if fp > 10 {
+		t.Errorf("Expected few false positives, got %d", fp)
+	}
+	if count := f.Count(); count < 90 || count > 110 {
+		t.Errorf("Expected about 100, got %d", count)
+	}
+
+	if err := f.Intersect(NewBloomFilter(100, 0.01)); err == nil {
+		t.Error("Expected error for mismatched size")
+	}
+	other.SetHash(fnv.New64a())
+	if err := f.Intersect(other); err == nil {
+		t.Error("Expected error for mismatched hash")
+	}
+}
+
+// Ensures that a BloomFilter round-trips through WriteTo and ReadFrom.
+func TestBloomWriteToReadFrom(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	written, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &BloomFilter{}
+	read, err := other.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != written {
+		t.Errorf("Expected %d bytes read, got %d", written, read)
+	}
+
+	if other.Capacity() != f.Capacity() || other.K() != f.K() || other.Count() != 100 {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+	for i := 0; i < 100; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+}
+
 // Ensures that Reset sets every bit to zero.
 func TestBloomReset(t *testing.T) {
 	f := NewBloomFilter(100, 0.1)
@@ -128,6 +319,169 @@ func TestBloomReset(t *testing.T) {
 			t.Error("Expected all bits to be unset")
 		}
 	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that TestAll agrees with Test for batches of any length.
+func TestBloomTestAll(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i += 2 {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for _, n := range []int{0, 1, batchTestSize, 1000} {
+		data := make([][]byte, n)
+		for i := range data {
+			data[i] = []byte(strconv.Itoa(i))
+		}
+
+		results := f.TestAll(data)
+		if len(results) != n {
+			t.Fatalf("Expected %d results, got %d", n, len(results))
+		}
+		for i, member := range results {
+			if member != f.Test(data[i]) {
+				t.Errorf("Expected TestAll to agree with Test for `%d`", i)
+			}
+			if i%2 == 0 && !member {
+				t.Errorf("`%d` should be a member", i)
+			}
+		}
+	}
+}
+
+// Ensures that a fractional number of hash functions uses the extra hash
+// function for about the fractional part of items, has no false negatives, and
+// survives serialization and freezing.
+func TestBloomFractionalK(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	f.SetFractionalK(6.4)
+	if f.K() != 6 || math.Abs(f.EffectiveK()-6.4) > 1e-9 {
+		t.Errorf("Expected 6.4, got %d, %f", f.K(), f.EffectiveK())
+	}
+
+	extra := 0
+	for i := 0; i < 10000; i++ {
+		lower, upper := hashKernel([]byte(strconv.Itoa(i)), f.hash)
+		if f.probes(lower, upper) == 7 {
+			extra++
+		}
+	}
+	if extra < 3800 || extra > 4200 {
+		t.Errorf("Expected about 4000 items with an extra hash function, got %d", extra)
+	}
+
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read := &BloomFilter{}
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if read.EffectiveK() != f.EffectiveK() {
+		t.Errorf("Expected %f, got %f", f.EffectiveK(), read.EffectiveK())
+	}
+
+	frozen := f.Freeze()
+	for i := 0; i < 2000; i++ {
+		data := []byte(strconv.Itoa(i))
+		member := f.Test(data)
+		if i < 1000 && !member {
+			t.Errorf("`%d` should be a member", i)
+		}
+		if read.Test(data) != member || frozen.Test(data) != member {
+			t.Errorf("Expected copies to agree for `%d`", i)
+		}
+	}
+
+	f.SetFractionalK(0)
+	if f.EffectiveK() != 1 {
+		t.Errorf("Expected 1, got %f", f.EffectiveK())
+	}
+}
+
+// Ensures that each indexing scheme has no false negatives, survives
+// serialization and freezing, and must match to merge.
+func TestBloomIndexing(t *testing.T) {
+	for _, indexing := range []Indexing{DoubleHashing, EnhancedDoubleHashing, TripleHashing} {
+		f := NewBloomFilter(1000, 0.01)
+		f.SetIndexing(indexing)
+		if f.Indexing() != indexing {
+			t.Errorf("Expected %d, got %d", indexing, f.Indexing())
+		}
+		for i := 0; i < 1000; i++ {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+
+		var buf bytes.Buffer
+		if _, err := f.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read := &BloomFilter{}
+		if _, err := read.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		data, err := f.MarshalProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &BloomFilter{}
+		if err := decoded.UnmarshalProto(data); err != nil {
+			t.Fatal(err)
+		}
+		if read.Indexing() != indexing || decoded.Indexing() != indexing || read.K() != f.K() {
+			t.Errorf("Expected indexing %d, got %d and %d", indexing, read.Indexing(), decoded.Indexing())
+		}
+
+		frozen := f.Freeze()
+		fp := 0
+		for i := 0; i < 2000; i++ {
+			data := []byte(strconv.Itoa(i))
+			member := f.Test(data)
+			if i < 1000 && !member {
+				t.Errorf("%d: `%d` should be a member", indexing, i)
+			}
+			if i >= 1000 && member {
+				fp++
+			}
+			if read.Test(data) != member || frozen.Test(data) != member {
+				t.Errorf("%d: Expected copies to agree for `%d`", indexing, i)
+			}
+		}
+		if fp > 30 {
+			t.Errorf("%d: Expected few false positives, got %d", indexing, fp)
+		}
+	}
+
+	a := NewBloomFilter(100, 0.01)
+	b := NewBloomFilter(100, 0.01)
+	b.SetIndexing(EnhancedDoubleHashing)
+	if err := a.Merge(b); err == nil {
+		t.Error("Expected error merging filters with different indexing")
+	}
+	if DiffBloomFilters(a, b).Compatible {
+		t.Error("Expected filters with different indexing to be incompatible")
+	}
+}
+
+// Ensures that NewFractionalBloomFilter uses the optimal number of hash
+// functions for its size.
+func TestNewFractionalBloomFilter(t *testing.T) {
+	f := NewFractionalBloomFilter(100, 0.01)
+	if k := OptimalFractionalK(f.Capacity(), 100); f.EffectiveK() < k-1e-9 || f.EffectiveK() > k {
+		t.Errorf("Expected %f, got %f", k, f.EffectiveK())
+	}
+	if f.K() != 6 {
+		t.Errorf("Expected 6, got %d", f.K())
+	}
 }
 
 func BenchmarkBloomAdd(b *testing.B) {
@@ -158,6 +512,18 @@ func BenchmarkBloomTest(b *testing.B) {
 	}
 }
 
+func BenchmarkBloomTestAll(b *testing.B) {
+	b.StopTimer()
+	f := NewBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	f.TestAll(data)
+}
+
 func BenchmarkBloomTestAndAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewBloomFilter(100000, 0.1)
@@ -171,3 +537,15 @@ func BenchmarkBloomTestAndAdd(b *testing.B) {
 		f.TestAndAdd(data[n])
 	}
 }
+
+func BenchmarkBloomAddMany(b *testing.B) {
+	b.StopTimer()
+	f := NewBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	f.AddMany(data)
+}
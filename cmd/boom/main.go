@@ -0,0 +1,338 @@
+/*
+Command boom builds, queries, merges, inspects, and compares serialized filter
+snapshots, so that filters like blocklists can be prepared offline and loaded
+with boom.ReadSnapshot, and drift between replicas can be debugged. Snapshots
+are written with boom.WriteSnapshot, and the output of BloomFilter.WriteTo can
+be read as well.
+
+Usage:
+
+	boom build [-format FORMAT] [-n N] [-p RATE] FILE [KEYS]
+	boom query [-format FORMAT] FILE [KEY...]
+	boom merge FILE INPUT...
+	boom inspect [-format FORMAT] FILE
+	boom diff FILE1 FILE2
+
+build reads newline-delimited keys from KEYS, or standard input, and writes a
+Bloom filter containing them to FILE. The filter is sized for N items, or the
+number of keys if N is zero, with a false-positive rate of RATE. query tests
+each KEY, or each line of standard input if there are none, and prints it with
+whether it's a member. merge writes the union of the INPUT snapshots, which
+must have the same parameters, to FILE. inspect prints a snapshot's parameters,
+fill, and estimated number of distinct items. diff checks that two snapshots
+have compatible parameters and prints the difference in count, the bits set or
+cleared in the second, and the estimated number of items added and removed.
+
+FORMAT is the layout of the file built, queried, or inspected: snapshot, the
+default, or cassandra or cassandra-legacy for the Filter.db component of an
+SSTable of Cassandra 4.0 and later or of earlier versions, so that operators
+can inspect SSTable filters or pre-build them. Filter.db doesn't record the
+number of items, so inspect reports a count of zero for it.
+*/
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+const usage = `usage:
+	boom build [-format FORMAT] [-n N] [-p RATE] FILE [KEYS]
+	boom query [-format FORMAT] FILE [KEY...]
+	boom merge FILE INPUT...
+	boom inspect [-format FORMAT] FILE
+	boom diff FILE1 FILE2`
+
+// filter is a filter read from a file, in any of the formats.
+type filter interface {
+	boom.Filter
+	boom.StatsProvider
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "boom:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes the command with the arguments, reading keys from stdin and
+// writing its output to stdout.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "build":
+		return build(args, stdin)
+	case cmd == "query":
+		return query(args, stdin, stdout)
+	case cmd == "merge" && len(args) >= 2:
+		return merge(args[0], args[1:])
+	case cmd == "inspect":
+		return inspect(args, stdout)
+	case cmd == "diff" && len(args) == 2:
+		return diff(args[0], args[1], stdout)
+	default:
+		return errors.New(usage)
+	}
+}
+
+// build writes a Bloom filter containing the keys to a snapshot.
+func build(args []string, stdin io.Reader) error {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "snapshot", "file format")
+	n := flags.Uint("n", 0, "number of items")
+	fpRate := flags.Float64("p", 0.01, "false-positive rate")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		return errors.New(usage)
+	}
+
+	input := stdin
+	if flags.NArg() == 2 {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	keys, err := readKeys(input)
+	if err != nil {
+		return err
+	}
+
+	capacity := *n
+	if capacity == 0 {
+		capacity = uint(len(keys))
+	}
+	if *format != "snapshot" {
+		cassandraFormat, err := parseCassandraFormat(*format)
+		if err != nil {
+			return err
+		}
+		f, err := boom.NewCassandraBloomFilterE(capacity, *fpRate, cassandraFormat)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			f.Add(key)
+		}
+		return writeFile(flags.Arg(0), f)
+	}
+
+	f, err := boom.NewBloomFilterE(capacity, *fpRate)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		f.Add(key)
+	}
+	return writeSnapshot(flags.Arg(0), f)
+}
+
+// query prints whether each of the keys, or each line of stdin if there are
+// none, is a member of a filter.
+func query(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "snapshot", "file format")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 {
+		return errors.New(usage)
+	}
+
+	f, err := readFilter(flags.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+	keys := flags.Args()[1:]
+
+	if len(keys) > 0 {
+		for _, key := range keys {
+			fmt.Fprintf(stdout, "%s\t%t\n", key, f.Test([]byte(key)))
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		fmt.Fprintf(stdout, "%s\t%t\n", scanner.Text(), f.Test(scanner.Bytes()))
+	}
+	return scanner.Err()
+}
+
+// merge writes the union of the snapshots to a new snapshot.
+func merge(path string, inputs []string) error {
+	f, err := readSnapshot(inputs[0])
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs[1:] {
+		other, err := readSnapshot(input)
+		if err != nil {
+			return err
+		}
+		if err := f.Union(other); err != nil {
+			return fmt.Errorf("%s: %v", input, err)
+		}
+	}
+	return writeSnapshot(path, f)
+}
+
+// inspect prints the parameters and statistics of a filter.
+func inspect(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	format := flags.String("format", "snapshot", "file format")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errors.New(usage)
+	}
+
+	f, err := readFilter(flags.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+
+	stats := f.Stats()
+	k := float64(stats.K)
+	if bloom, ok := f.(*boom.BloomFilter); ok {
+		k = bloom.EffectiveK()
+	}
+	fmt.Fprintf(stdout, "m:                     %d\n", stats.M)
+	fmt.Fprintf(stdout, "k:                     %g\n", k)
+	fmt.Fprintf(stdout, "count:                 %d\n", stats.Count)
+	fmt.Fprintf(stdout, "fill ratio:            %.4f\n", stats.FillRatio)
+	fmt.Fprintf(stdout, "estimated cardinality: %.0f\n", stats.EstimatedCardinality)
+	return nil
+}
+
+// diff prints how the second snapshot differs from the first.
+func diff(path1, path2 string, stdout io.Writer) error {
+	a, err := readSnapshot(path1)
+	if err != nil {
+		return err
+	}
+	b, err := readSnapshot(path2)
+	if err != nil {
+		return err
+	}
+
+	d := boom.DiffBloomFilters(a, b)
+	fmt.Fprintf(stdout, "compatible:        %t\n", d.Compatible)
+	if !d.Compatible {
+		fmt.Fprintf(stdout, "parameters:        m=%d k=%g vs m=%d k=%g\n",
+			a.Capacity(), a.EffectiveK(), b.Capacity(), b.EffectiveK())
+	}
+	fmt.Fprintf(stdout, "count delta:       %+d\n", d.CountDelta)
+	if d.Compatible {
+		fmt.Fprintf(stdout, "changed bits:      %d\n", d.ChangedBits)
+		fmt.Fprintf(stdout, "set bits:          %d\n", d.SetBits)
+		fmt.Fprintf(stdout, "cleared bits:      %d\n", d.ClearedBits)
+		fmt.Fprintf(stdout, "estimated added:   %.0f\n", d.EstimatedAdded)
+		fmt.Fprintf(stdout, "estimated removed: %.0f\n", d.EstimatedRemoved)
+	}
+	return nil
+}
+
+// readFilter reads a filter in the format from the file.
+func readFilter(path, format string) (filter, error) {
+	if format == "snapshot" {
+		return readSnapshot(path)
+	}
+	cassandraFormat, err := parseCassandraFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f, err := boom.ReadCassandraBloomFilter(file, cassandraFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+// parseCassandraFormat returns the Cassandra layout with the name.
+func parseCassandraFormat(format string) (boom.CassandraFormat, error) {
+	switch format {
+	case "cassandra":
+		return boom.CassandraCurrentFormat, nil
+	case "cassandra-legacy":
+		return boom.CassandraLegacyFormat, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// readSnapshot reads a Bloom filter written by boom.WriteSnapshot, or by
+// BloomFilter.WriteTo, from the file.
+func readSnapshot(path string) (*boom.BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f := &boom.BloomFilter{}
+	_, err = boom.ReadSnapshot(file, f)
+	if errors.Is(err, boom.ErrNotSnapshot) {
+		// Filters written with BloomFilter.WriteTo have no envelope.
+		if _, err = file.Seek(0, io.SeekStart); err == nil {
+			_, err = f.ReadFrom(file)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+// writeSnapshot writes a Bloom filter to the file with boom.WriteSnapshot.
+func writeSnapshot(path string, f *boom.BloomFilter) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := boom.WriteSnapshot(file, f); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeFile writes a filter to the file with its WriteTo method.
+func writeFile(path string, f io.WriterTo) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readKeys reads newline-delimited keys, skipping empty lines.
+func readKeys(r io.Reader) ([][]byte, error) {
+	var keys [][]byte
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			keys = append(keys, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	return keys, scanner.Err()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+func snapshot(t *testing.T, f *boom.BloomFilter) string {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := f.WriteTo(file); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Ensures that inspect prints a snapshot's parameters.
+func TestInspect(t *testing.T) {
+	f := boom.NewBloomFilter(100, 0.1)
+	f.Add([]byte(`a`))
+	path := snapshot(t, f)
+
+	var out bytes.Buffer
+	if err := run([]string{"inspect", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"m:                     480", "count:                 1"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in output %q", line, out.String())
+		}
+	}
+}
+
+// Ensures that diff prints the difference between snapshots and reports
+// incompatible parameters.
+func TestDiff(t *testing.T) {
+	a := boom.NewBloomFilter(100, 0.1)
+	b := boom.NewBloomFilter(100, 0.1)
+	b.Add([]byte(`a`))
+	c := boom.NewBloomFilter(10, 0.1)
+
+	var out bytes.Buffer
+	if err := run([]string{"diff", snapshot(t, a), snapshot(t, b)}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "count delta:       +1") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"diff", snapshot(t, a), snapshot(t, c)}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "compatible:        false") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+// Ensures that build writes a filter containing the keys, which query reports.
+func TestBuildQuery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocklist")
+	keys := filepath.Join(dir, "keys")
+	if err := os.WriteFile(keys, []byte("a\nb\n\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"build", "-p", "0.001", path, keys}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if !bytes.HasPrefix(data, []byte("BOOMSNAP")) {
+		t.Error("Expected build to write a versioned snapshot")
+	}
+	var out bytes.Buffer
+	if err := run([]string{"inspect", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "count:                 3") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"query", path, "a", "d"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\ttrue\nd\tfalse\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"query", path}, strings.NewReader("c\ne\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "c\ttrue\ne\tfalse\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	// Keys can also be read from stdin.
+	if err := run([]string{"build", "-n", "100", path}, strings.NewReader("x\n"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"inspect", path}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "count:                 1") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
+
+// Ensures that merge writes the union of the snapshots and rejects
+// incompatible ones.
+func TestMerge(t *testing.T) {
+	a := boom.NewBloomFilter(100, 0.01)
+	a.Add([]byte(`a`))
+	b := boom.NewBloomFilter(100, 0.01)
+	b.Add([]byte(`b`))
+	path := filepath.Join(t.TempDir(), "merged")
+
+	if err := run([]string{"merge", path, snapshot(t, a), snapshot(t, b)}, nil, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"query", path, "a", "b"}, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a\ttrue\nb\ttrue\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	c := boom.NewBloomFilter(10, 0.01)
+	if err := run([]string{"merge", path, snapshot(t, a), snapshot(t, c)}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Expected error merging incompatible snapshots")
+	}
+}
+
+// Ensures that build, query, and inspect handle Cassandra's Filter.db layouts.
+func TestCassandraFormat(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{"cassandra", "cassandra-legacy"} {
+		path := filepath.Join(dir, format+"-Filter.db")
+		if err := run([]string{"build", "-format", format, "-p", "0.001", path}, strings.NewReader("a\nb\n"), &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+
+		cassandraFormat := boom.CassandraCurrentFormat
+		if format == "cassandra-legacy" {
+			cassandraFormat = boom.CassandraLegacyFormat
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := boom.ReadCassandraBloomFilter(file, cassandraFormat)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Test([]byte(`a`)) || !f.Test([]byte(`b`)) {
+			t.Errorf("%s: expected the built filter to contain the keys", format)
+		}
+
+		var out bytes.Buffer
+		if err := run([]string{"query", "-format", format, path, "a", "c"}, nil, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "a\ttrue\nc\tfalse\n" {
+			t.Errorf("%s: unexpected output %q", format, out.String())
+		}
+
+		out.Reset()
+		if err := run([]string{"inspect", "-format", format, path}, nil, &out); err != nil {
+			t.Fatal(err)
+		}
+		if line := fmt.Sprintf("m:                     %d", f.Capacity()); !strings.Contains(out.String(), line) {
+			t.Errorf("%s: expected %q in output %q", format, line, out.String())
+		}
+	}
+
+	if err := run([]string{"inspect", "-format", "parquet", "a"}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// Ensures that invalid arguments return the usage.
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"inspect"}, {"diff", "a"}, {"unknown", "a"},
+		{"build"}, {"build", "-x", "a"}, {"query"}, {"query", "-x", "a"}, {"inspect", "a", "b"},
+		{"merge", "a"}} {
+		if err := run(args, nil, &bytes.Buffer{}); err == nil || err.Error() != usage {
+			t.Errorf("Expected usage for %v, got %v", args, err)
+		}
+	}
+}
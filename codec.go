@@ -0,0 +1,79 @@
+package boom
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// Codec compresses the payloads of snapshots written by
+// WriteCompressedSnapshot. Sparse bit arrays and low-fill bucket arrays
+// compress well, often by 5 to 20 times. The package provides GzipCodec, and
+// others, such as Snappy or Zstandard, can be plugged in by implementing Codec
+// and registering it with RegisterCodec so that ReadSnapshot can decompress
+// them.
+type Codec interface {
+	// Name identifies the codec in snapshots, such as "gzip" or "zstd". It
+	// must be at most 255 bytes.
+	Name() string
+
+	// NewWriter returns a writer which compresses data to the stream. Closing
+	// it must flush the compressed data without closing the stream.
+	NewWriter(stream io.Writer) (io.WriteCloser, error)
+
+	// NewReader returns a reader which decompresses data from the stream.
+	NewReader(stream io.Reader) (io.Reader, error)
+}
+
+// GzipCodec compresses snapshots with gzip, using the default compression
+// level. It's registered as "gzip".
+var GzipCodec Codec = gzipCodec{}
+
+// gzipCodec implements GzipCodec.
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) NewWriter(stream io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(stream), nil
+}
+
+func (gzipCodec) NewReader(stream io.Reader) (io.Reader, error) {
+	return gzip.NewReader(stream)
+}
+
+// codecs is the codecs ReadSnapshot can decompress, by name.
+var (
+	codecsMu sync.RWMutex // guards codecs
+	codecs   = map[string]Codec{GzipCodec.Name(): GzipCodec}
+)
+
+// RegisterCodec makes the codec available to ReadSnapshot for decompressing
+// snapshots written with it, such as in an init function. It panics if the
+// codec is nil, its name is empty or longer than 255 bytes, or a codec is
+// already registered with its name.
+func RegisterCodec(codec Codec) {
+	if codec == nil {
+		panic("boom: RegisterCodec codec is nil")
+	}
+	name := codec.Name()
+	if name == "" || len(name) > 255 {
+		panic("boom: RegisterCodec name must be 1 to 255 bytes")
+	}
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, dup := codecs[name]; dup {
+		panic("boom: RegisterCodec called twice for codec " + name)
+	}
+	codecs[name] = codec
+}
+
+// lookupCodec returns the codec registered with the name, if any.
+func lookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
@@ -0,0 +1,139 @@
+package boom
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// identityCodec is a Codec which doesn't compress, for testing custom codecs.
+type identityCodec struct {
+	name string
+}
+
+func (c identityCodec) Name() string {
+	return c.name
+}
+
+func (identityCodec) NewWriter(stream io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{stream}, nil
+}
+
+func (identityCodec) NewReader(stream io.Reader) (io.Reader, error) {
+	return stream, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Ensures that compressed snapshots are smaller for sparse filters and are
+// decompressed transparently by ReadSnapshot.
+func TestCompressedSnapshot(t *testing.T) {
+	f := NewBloomFilter(100000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var plain, compressed bytes.Buffer
+	if _, err := WriteSnapshot(&plain, f); err != nil {
+		t.Fatal(err)
+	}
+	n, err := WriteCompressedSnapshot(&compressed, f, GzipCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(compressed.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", compressed.Len(), n)
+	}
+	if compressed.Len()*5 > plain.Len() {
+		t.Errorf("Expected at least 5x compression, got %d of %d bytes", compressed.Len(), plain.Len())
+	}
+	if version := compressed.Bytes()[8]; version != snapshotCompressedVersion {
+		t.Errorf("Expected version %d, got %d", snapshotCompressedVersion, version)
+	}
+	if version := plain.Bytes()[8]; version != snapshotVersion {
+		t.Errorf("Expected uncompressed snapshots to remain version %d, got %d", snapshotVersion, version)
+	}
+
+	loaded := &BloomFilter{}
+	if n, err := ReadSnapshot(bytes.NewReader(compressed.Bytes()), loaded); err != nil || n != int64(compressed.Len()) {
+		t.Fatalf("Expected %d bytes read, got %d, %v", compressed.Len(), n, err)
+	}
+	if loaded.Count() != 1000 || !bytes.Equal(loaded.buckets.data, f.buckets.data) {
+		t.Error("Expected the decompressed filter to match")
+	}
+}
+
+// Ensures that registered codecs can be used and that snapshots compressed
+// with unregistered codecs are rejected.
+func TestRegisterCodec(t *testing.T) {
+	f := NewCountingBloomFilter(100, 4, 0.01)
+	f.Add([]byte(`a`))
+
+	var buf bytes.Buffer
+	if _, err := WriteCompressedSnapshot(&buf, f, identityCodec{"unregistered"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadSnapshot(bytes.NewReader(buf.Bytes()), &CountingBloomFilter{})
+	if err == nil || !strings.Contains(err.Error(), `unregistered codec "unregistered"`) {
+		t.Errorf("Expected an unregistered codec error, got %v", err)
+	}
+
+	RegisterCodec(identityCodec{"identity"})
+	buf.Reset()
+	if _, err := WriteCompressedSnapshot(&buf, f, identityCodec{"identity"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &CountingBloomFilter{}
+	if _, err := ReadSnapshot(&buf, loaded); err != nil || !loaded.Test([]byte(`a`)) {
+		t.Errorf("Expected the filter to round-trip, got %v", err)
+	}
+
+	for _, codec := range []Codec{nil, identityCodec{""}, identityCodec{"identity"}, GzipCodec} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected RegisterCodec(%v) to panic", codec)
+				}
+			}()
+			RegisterCodec(codec)
+		}()
+	}
+	if _, err := WriteCompressedSnapshot(&buf, f, identityCodec{strings.Repeat("x", 256)}); err == nil {
+		t.Error("Expected an error for a codec name longer than 255 bytes")
+	}
+}
+
+// Ensures that compressed payloads with trailing data are rejected.
+func TestCompressedSnapshotTrailingData(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	var buf bytes.Buffer
+	if _, err := WriteCompressedSnapshot(&buf, &trailingWriter{f}, GzipCodec); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadSnapshot(&buf, &trailingWriter{&BloomFilter{}})
+	if err == nil || !strings.Contains(err.Error(), "trailing data") {
+		t.Errorf("Expected a trailing data error, got %v", err)
+	}
+}
+
+// trailingWriter writes a byte after the filter.
+type trailingWriter struct {
+	*BloomFilter
+}
+
+func (w *trailingWriter) WriteTo(stream io.Writer) (int64, error) {
+	n, err := w.BloomFilter.WriteTo(stream)
+	if err != nil {
+		return n, err
+	}
+	m, err := stream.Write([]byte{0})
+	return n + int64(m), err
+}
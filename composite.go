@@ -0,0 +1,105 @@
+package boom
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// CompositeFilter fronts an expensive filter, such as a ScalableBloomFilter or
+// one backed by a remote service, with a cheap InverseBloomFilter which
+// absorbs repeated keys, the pattern used by most high-volume deduplication.
+// Keys added are written through to the back filter unless the front has
+// already seen them, so the back filter is only consulted for keys not seen
+// recently.
+//
+// The front has no false positives, so its answers are exact, and everything
+// in it is also in the back filter. Unlike a HybridFilter's exact LRU front,
+// its memory is fixed by its capacity. The InverseBloomFilter shares its hash
+// between calls, so the CompositeFilter isn't safe for concurrent use; wrap
+// it with Synchronized to share it between goroutines.
+type CompositeFilter struct {
+	front    *InverseBloomFilter // recently added keys
+	back     Filter              // filter of every key added
+	absorbed atomic.Uint64       // additions answered by the front
+}
+
+// NewCompositeFilter creates a new CompositeFilter fronting the back filter
+// with an InverseBloomFilter of the provided capacity.
+func NewCompositeFilter(frontCapacity uint, back Filter) *CompositeFilter {
+	return &CompositeFilter{front: NewInverseBloomFilter(frontCapacity), back: back}
+}
+
+// NewCompositeFilterE is like NewCompositeFilter, but returns an error if the
+// front capacity is zero.
+func NewCompositeFilterE(frontCapacity uint, back Filter) (*CompositeFilter, error) {
+	front, err := NewInverseBloomFilterE(frontCapacity)
+	if err != nil {
+		return nil, err
+	}
+	return &CompositeFilter{front: front, back: back}, nil
+}
+
+// Front returns the InverseBloomFilter of recently added keys.
+func (c *CompositeFilter) Front() *InverseBloomFilter {
+	return c.front
+}
+
+// Back returns the filter of every key added.
+func (c *CompositeFilter) Back() Filter {
+	return c.back
+}
+
+// Absorbed returns the number of additions the front answered without
+// consulting the back filter.
+func (c *CompositeFilter) Absorbed() uint64 {
+	return c.absorbed.Load()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. The back filter is only tested if the front hasn't
+// seen the data recently, so the error rates are those of the back filter.
+func (c *CompositeFilter) Test(data []byte) bool {
+	return c.front.Test(data) || c.back.Test(data)
+}
+
+// Add will add the data to the filter, writing it through to the back filter
+// unless the front has seen it recently. It returns the CompositeFilter to
+// allow for chaining.
+func (c *CompositeFilter) Add(data []byte) Filter {
+	if c.front.TestAndAdd(data) {
+		c.absorbed.Add(1)
+	} else {
+		c.back.Add(data)
+	}
+	return c
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not. Data the front has seen recently is
+// answered without consulting the back filter.
+func (c *CompositeFilter) TestAndAdd(data []byte) bool {
+	if c.front.TestAndAdd(data) {
+		c.absorbed.Add(1)
+		return true
+	}
+	return c.back.TestAndAdd(data)
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including the back filter if it reports its size.
+func (c *CompositeFilter) ByteSize() uint {
+	return c.front.ByteSize() + byteSize(c.back)
+}
+
+// Stats returns the Stats of the back filter, which holds every key added, or
+// zero Stats if it doesn't report them.
+func (c *CompositeFilter) Stats() Stats {
+	return filterStats(c.back)
+}
+
+// String returns a one-line summary of the CompositeFilter for logging and
+// debugging.
+func (c *CompositeFilter) String() string {
+	return fmt.Sprintf("CompositeFilter{front=%d absorbed=%d back=%v}",
+		c.front.Capacity(), c.absorbed.Load(), c.back)
+}
@@ -0,0 +1,97 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// spyFilter counts the calls made to the filter it wraps.
+type spyFilter struct {
+	Filter
+	tests, adds, testAndAdds int
+}
+
+func (s *spyFilter) Test(data []byte) bool {
+	s.tests++
+	return s.Filter.Test(data)
+}
+
+func (s *spyFilter) Add(data []byte) Filter {
+	s.adds++
+	s.Filter.Add(data)
+	return s
+}
+
+func (s *spyFilter) TestAndAdd(data []byte) bool {
+	s.testAndAdds++
+	return s.Filter.TestAndAdd(data)
+}
+
+// Ensures that the front absorbs repeated keys and everything added reaches
+// the back filter.
+func TestCompositeFilter(t *testing.T) {
+	back := &spyFilter{Filter: NewScalableBloomFilter(1000, 0.01, 0.8)}
+	f := NewCompositeFilter(1000, back)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned CompositeFilter should be the same instance")
+	}
+	f.Add([]byte(`a`))
+	if back.adds != 1 || f.Absorbed() != 1 {
+		t.Errorf("Expected 1 add to the back filter and 1 absorbed, got %d and %d", back.adds, f.Absorbed())
+	}
+
+	if !f.Test([]byte(`a`)) || back.tests != 0 {
+		t.Error("Expected `a` to be answered by the front")
+	}
+	if f.Test([]byte(`b`)) || back.tests != 1 {
+		t.Error("Expected `b` to be tested in the back filter")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+	if !f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+	if back.testAndAdds != 1 || f.Absorbed() != 2 {
+		t.Errorf("Expected 1 TestAndAdd on the back filter and 2 absorbed, got %d and %d", back.testAndAdds, f.Absorbed())
+	}
+
+	// Keys evicted from the front are still found in the back filter.
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	for _, key := range []string{"a", "b", "0"} {
+		if !f.Test([]byte(key)) {
+			t.Errorf("Expected %s to be a member", key)
+		}
+	}
+	if !back.Filter.Test([]byte(`9999`)) {
+		t.Error("Expected additions to reach the back filter")
+	}
+}
+
+// Ensures that NewCompositeFilterE returns an error for a zero capacity.
+func TestNewCompositeFilterE(t *testing.T) {
+	if _, err := NewCompositeFilterE(0, NewBloomFilter(100, 0.01)); err == nil {
+		t.Error("Expected an error for a capacity of zero")
+	}
+	if f, err := NewCompositeFilterE(10, NewBloomFilter(100, 0.01)); err != nil || f.Front().Capacity() != 10 {
+		t.Errorf("Expected a filter, got %v", err)
+	}
+}
+
+func BenchmarkCompositeTestAndAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewCompositeFilter(1000, NewScalableBloomFilter(100000, 0.01, 0.8))
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 500))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.TestAndAdd(data[n])
+	}
+}
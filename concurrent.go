@@ -0,0 +1,183 @@
+package boom
+
+import (
+	"fmt"
+	"hash"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentBloomFilter is a classic Bloom filter which is safe for concurrent
+// use without locking. Its bits are packed into 64-bit words which Add sets
+// with atomic OR, so any number of goroutines can add at once, and Test reads
+// them with atomic loads, so it's wait-free. It hashes without shared state,
+// using the default hash directly if it can, or a pool of default hashes if
+// SetDefaultHash was given a hash which can't be.
+//
+// Since setting a bit can't be undone by another writer, an item is a member
+// once its Add returns, no matter what else is added concurrently.
+type ConcurrentBloomFilter struct {
+	words []uint64                 // filter data, one bit per index
+	sum   func(data []byte) uint64 // stateless hash function
+	m     uint                     // filter size
+	k     uint                     // number of hash functions
+	count atomic.Uint64            // number of items added
+}
+
+// NewConcurrentBloomFilter creates a new ConcurrentBloomFilter optimized to
+// store n items with a specified target false-positive rate.
+func NewConcurrentBloomFilter(n uint, fpRate float64) *ConcurrentBloomFilter {
+	sum := statelessSum(newDefaultHash())
+	if sum == nil {
+		sum = pooledSum(newDefaultHash)
+	}
+	m := OptimalM(n, fpRate)
+	return &ConcurrentBloomFilter{
+		words: make([]uint64, (m+63)/64),
+		sum:   sum,
+		m:     m,
+		k:     OptimalK(fpRate),
+	}
+}
+
+// NewConcurrentBloomFilterE is like NewConcurrentBloomFilter but returns an
+// error if n is zero, fpRate isn't between 0 and 1, or the filter would be too
+// large to address.
+func NewConcurrentBloomFilterE(n uint, fpRate float64) (*ConcurrentBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+	return NewConcurrentBloomFilter(n, fpRate), nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (c *ConcurrentBloomFilter) Capacity() uint {
+	return c.m
+}
+
+// K returns the number of hash functions.
+func (c *ConcurrentBloomFilter) K() uint {
+	return c.k
+}
+
+// Count returns the number of items added to the filter.
+func (c *ConcurrentBloomFilter) Count() uint {
+	return uint(c.count.Load())
+}
+
+// FillRatio returns the ratio of set bits. Bits set by concurrent adds may or
+// may not be counted.
+func (c *ConcurrentBloomFilter) FillRatio() float64 {
+	set := 0
+	for i := range c.words {
+		set += bits.OnesCount64(atomic.LoadUint64(&c.words[i]))
+	}
+	return float64(set) / float64(c.m)
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives. It's wait-free and safe to call concurrently with Add.
+func (c *ConcurrentBloomFilter) Test(data []byte) bool {
+	sum := c.sum(data)
+	lower, upper := uint32(sum), uint32(sum>>32)
+
+	// If any of the K bits are not set, then it's not a member.
+	for i := uint(0); i < c.k; i++ {
+		idx := DoubleHashing.index(lower, upper, i, c.m)
+		if atomic.LoadUint64(&c.words[idx/64])&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining. It's safe to call concurrently with other adds and tests.
+func (c *ConcurrentBloomFilter) Add(data []byte) Filter {
+	c.add(data)
+	return c
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not. Each bit is tested as it's set, so of
+// several goroutines concurrently adding the same new item, at least one sees
+// it isn't a member unless it's a false positive. Several may, since each can
+// be the one to set a different bit, so it can't be used to deduplicate.
+func (c *ConcurrentBloomFilter) TestAndAdd(data []byte) bool {
+	return c.add(data)
+}
+
+// add sets the K bits of the data and returns true if they were all already
+// set.
+func (c *ConcurrentBloomFilter) add(data []byte) bool {
+	sum := c.sum(data)
+	lower, upper := uint32(sum), uint32(sum>>32)
+
+	member := true
+	for i := uint(0); i < c.k; i++ {
+		idx := DoubleHashing.index(lower, upper, i, c.m)
+		bit := uint64(1) << (idx % 64)
+		if atomic.OrUint64(&c.words[idx/64], bit)&bit == 0 {
+			member = false
+		}
+	}
+
+	c.count.Add(1)
+	return member
+}
+
+// pooledSum returns a function which computes the 64-bit sum of a hash created
+// by newHash, taking one from a pool for each call so that it's safe for
+// concurrent use.
+func pooledSum(newHash func() hash.Hash64) func(data []byte) uint64 {
+	pool := &sync.Pool{New: func() interface{} { return newHash() }}
+	return func(data []byte) uint64 {
+		h := pool.Get().(hash.Hash64)
+		h.Write(data)
+		sum := sum64(h)
+		h.Reset()
+		pool.Put(h)
+		return sum
+	}
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining. Items added concurrently with Reset may be partially
+// cleared, so it should only be called while the filter isn't being added to.
+func (c *ConcurrentBloomFilter) Reset() *ConcurrentBloomFilter {
+	for i := range c.words {
+		atomic.StoreUint64(&c.words[i], 0)
+	}
+	c.count.Store(0)
+	return c
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (c *ConcurrentBloomFilter) Clear() {
+	c.Reset()
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (c *ConcurrentBloomFilter) ByteSize() uint {
+	return uint(len(c.words)) * 8
+}
+
+// String returns a one-line summary of the ConcurrentBloomFilter for logging
+// and debugging.
+func (c *ConcurrentBloomFilter) String() string {
+	count := c.Count()
+	return fmt.Sprintf("ConcurrentBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		c.m, c.k, count, estimatedFPRate(c.m, c.k, count))
+}
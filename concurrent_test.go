@@ -0,0 +1,187 @@
+package boom
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Ensures that Capacity returns the number of bits, m, in the filter.
+func TestConcurrentCapacity(t *testing.T) {
+	f := NewConcurrentBloomFilter(100, 0.1)
+
+	if capacity := f.Capacity(); capacity != 480 {
+		t.Errorf("Expected 480, got %d", capacity)
+	}
+
+	if k := f.K(); k != 4 {
+		t.Errorf("Expected 4, got %d", k)
+	}
+
+	if size := f.ByteSize(); size != 64 {
+		t.Errorf("Expected 64, got %d", size)
+	}
+}
+
+// Ensures that NewConcurrentBloomFilterE returns an error for invalid
+// parameters.
+func TestNewConcurrentBloomFilterE(t *testing.T) {
+	if f, err := NewConcurrentBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a ConcurrentBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewConcurrentBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewConcurrentBloomFilterE(100, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewConcurrentBloomFilterE(100, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that the filter hashes with a default hash set with SetDefaultHash
+// even if it can't be used without shared state.
+func TestConcurrentDefaultHash(t *testing.T) {
+	SetDefaultHash(fnv.New64a)
+	defer SetDefaultHash(nil)
+
+	f := NewConcurrentBloomFilter(1000, 0.01)
+	h := fnv.New64a()
+	h.Write([]byte(`a`))
+	if sum := f.sum([]byte(`a`)); sum != h.Sum64() {
+		t.Errorf("Expected %d, got %d", h.Sum64(), sum)
+	}
+}
+
+// Ensures that TestAndAdd behaves correctly and that the filter answers the
+// same as a BloomFilter with the same items.
+func TestConcurrentTestAndAdd(t *testing.T) {
+	f := NewConcurrentBloomFilter(1000, 0.01)
+	b := NewBloomFilter(1000, 0.01)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if !f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.Add([]byte(`b`)) != f {
+		t.Error("Returned ConcurrentBloomFilter should be the same instance")
+	}
+
+	if f.Test([]byte(`c`)) {
+		t.Error("`c` should not be a member")
+	}
+
+	b.Add([]byte(`a`)).Add([]byte(`b`))
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 5000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if f.Test(data) != b.Test(data) {
+			t.Errorf("Expected filter to agree with BloomFilter for `%s`", data)
+		}
+	}
+
+	if count := f.Count(); count != 1003 {
+		t.Errorf("Expected 1003, got %d", count)
+	}
+
+	if ratio := f.FillRatio(); ratio != b.FillRatio() {
+		t.Errorf("Expected %f, got %f", b.FillRatio(), ratio)
+	}
+
+	f.Reset()
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member after Reset")
+	}
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that items added concurrently without locking are all members, and
+// that of several goroutines adding the same item at least one sees it's new.
+func TestConcurrentAddConcurrently(t *testing.T) {
+	var (
+		f       = NewConcurrentBloomFilter(10000, 0.01)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		newAdds = make(map[int]int)
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if !f.TestAndAdd([]byte(strconv.Itoa(i))) {
+					mu.Lock()
+					newAdds[i]++
+					mu.Unlock()
+				}
+				f.Test([]byte(strconv.Itoa(i + 1000)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected `%d` to be a member", i)
+		}
+		if newAdds[i] < 1 {
+			t.Errorf("Expected at least one new add of `%d`, got %d", i, newAdds[i])
+		}
+	}
+
+	if count := f.Count(); count != 8000 {
+		t.Errorf("Expected 8000, got %d", count)
+	}
+}
+
+func BenchmarkConcurrentAdd(b *testing.B) {
+	f := NewConcurrentBloomFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkConcurrentAddParallel(b *testing.B) {
+	f := NewConcurrentBloomFilter(100000, 0.01)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			f.Add([]byte(strconv.Itoa(i)))
+			i++
+		}
+	})
+}
+
+func BenchmarkConcurrentTestParallel(b *testing.B) {
+	f := NewConcurrentBloomFilter(100000, 0.01)
+	for i := 0; i < 100000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			f.Test([]byte(strconv.Itoa(i)))
+			i++
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ringPointSize is the size of a ringPoint in bytes, excluding the shard name,
+// which is shared with the shards map.
+const ringPointSize = 8 + 2*pointerSize
+
+// ringPoint is a point on the hash ring owned by a shard.
+type ringPoint struct {
+	hash  uint64
+	shard string
+}
+
+// ConsistentShardedFilter routes data to one of several named filters by
+// consistent hashing as described by Karger et al. in Consistent Hashing and
+// Random Trees:
+//
+// https://www.cs.princeton.edu/courses/archive/fall09/cos518/papers/chash.pdf
+//
+// Each shard is placed at several points on a hash ring, and data belongs to
+// the shard owning the first point at or after its hash. Adding or removing a
+// shard only moves the data belonging to it, so shards can be added as the
+// filter grows. Shards can be any Filter, including ones backed by remote
+// storage, which allows a single logical filter to exceed one machine's
+// memory.
+//
+// Because data is only added to the shard it routes to, removing a shard or
+// adding one after data has been added introduces false negatives for the
+// data that moves.
+type ConsistentShardedFilter struct {
+	shards   map[string]Filter // filter for each shard
+	ring     []ringPoint       // points sorted by hash
+	replicas uint              // number of points per shard
+	hash     hash.Hash64       // hash function used to route data
+}
+
+// NewConsistentShardedFilter creates a new ConsistentShardedFilter with no
+// shards, placing each shard at the provided number of points on the ring.
+// More points spread data more evenly across shards.
+func NewConsistentShardedFilter(replicas uint) *ConsistentShardedFilter {
+	if replicas == 0 {
+		replicas = 1
+	}
+	return &ConsistentShardedFilter{
+		shards:   make(map[string]Filter),
+		replicas: replicas,
+		hash:     fnv.New64a(),
+	}
+}
+
+// AddShard adds a named shard to the filter, replacing any existing shard
+// with the same name. It returns the filter to allow for chaining.
+func (c *ConsistentShardedFilter) AddShard(name string, filter Filter) *ConsistentShardedFilter {
+	if _, ok := c.shards[name]; !ok {
+		for i := uint(0); i < c.replicas; i++ {
+			c.ring = append(c.ring, ringPoint{
+				hash:  c.sum([]byte(name + "#" + strconv.FormatUint(uint64(i), 10))),
+				shard: name,
+			})
+		}
+		sort.Slice(c.ring, func(i, j int) bool {
+			return c.ring[i].hash < c.ring[j].hash
+		})
+	}
+	c.shards[name] = filter
+	return c
+}
+
+// RemoveShard removes the named shard from the filter. Its data is not moved
+// to the remaining shards. It returns the filter to allow for chaining.
+func (c *ConsistentShardedFilter) RemoveShard(name string) *ConsistentShardedFilter {
+	if _, ok := c.shards[name]; !ok {
+		return c
+	}
+	delete(c.shards, name)
+
+	ring := c.ring[:0]
+	for _, point := range c.ring {
+		if point.shard != name {
+			ring = append(ring, point)
+		}
+	}
+	c.ring = ring
+	return c
+}
+
+// Shards returns the names of the shards in sorted order.
+func (c *ConsistentShardedFilter) Shards() []string {
+	names := make([]string, 0, len(c.shards))
+	for name := range c.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shard returns the name and filter of the shard the data routes to. The
+// filter is nil if there are no shards.
+func (c *ConsistentShardedFilter) Shard(data []byte) (string, Filter) {
+	if len(c.ring) == 0 {
+		return "", nil
+	}
+
+	sum := c.sum(data)
+	i := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i].hash >= sum
+	})
+	if i == len(c.ring) {
+		i = 0
+	}
+
+	name := c.ring[i].shard
+	return name, c.shards[name]
+}
+
+// Test will test for membership of the data in the shard it routes to and
+// returns true if it is a member, false if not. Data is never a member of a
+// filter without shards.
+func (c *ConsistentShardedFilter) Test(data []byte) bool {
+	_, filter := c.Shard(data)
+	return filter != nil && filter.Test(data)
+}
+
+// Add will add the data to the shard it routes to. It returns the filter to
+// allow for chaining. It panics if the filter has no shards.
+func (c *ConsistentShardedFilter) Add(data []byte) Filter {
+	_, filter := c.Shard(data)
+	if filter == nil {
+		panic("boom: no shards to add to")
+	}
+	filter.Add(data)
+	return c
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not. It panics if the filter has no shards.
+func (c *ConsistentShardedFilter) TestAndAdd(data []byte) bool {
+	_, filter := c.Shard(data)
+	if filter == nil {
+		panic("boom: no shards to add to")
+	}
+	return filter.TestAndAdd(data)
+}
+
+// ShardCounts returns the number of items in each shard which reports it,
+// keyed by shard name, for monitoring how evenly data is spread.
+func (c *ConsistentShardedFilter) ShardCounts() map[string]uint {
+	counts := make(map[string]uint, len(c.shards))
+	for name, filter := range c.shards {
+		if counter, ok := filter.(interface{ Count() uint }); ok {
+			counts[name] = counter.Count()
+		}
+	}
+	return counts
+}
+
+// Merge combines each shard of this filter with the shard of the same name in
+// another, so the result contains the items added to either. Returns an error
+// if the shard names don't match or the shards can't be merged, in which case
+// no shard is changed. Only BloomFilter shards can currently be merged.
+func (c *ConsistentShardedFilter) Merge(other *ConsistentShardedFilter) error {
+	if len(c.shards) != len(other.shards) {
+		return errors.New("shards must match")
+	}
+
+	pairs := make([][2]*BloomFilter, 0, len(c.shards))
+	for name, filter := range c.shards {
+		otherFilter, ok := other.shards[name]
+		if !ok {
+			return errors.New("shards must match")
+		}
+		b, ok := filter.(*BloomFilter)
+		otherB, otherOk := otherFilter.(*BloomFilter)
+		if !ok || !otherOk {
+			return errors.New("shards must be Bloom filters to merge")
+		}
+		if err := b.mergeable(otherB); err != nil {
+			return fmt.Errorf("shard %s: %v", name, err)
+		}
+		pairs = append(pairs, [2]*BloomFilter{b, otherB})
+	}
+
+	for _, pair := range pairs {
+		if err := pair[0].Merge(pair[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sum returns the mixed hash of the data used to place it on the ring.
+func (c *ConsistentShardedFilter) sum(data []byte) uint64 {
+	c.hash.Write(data)
+	sum := c.hash.Sum64()
+	c.hash.Reset()
+
+	// Mix the bits so routing is independent of the shards' own hashing.
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+	return sum
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including the ring and the shards which report their size.
+func (c *ConsistentShardedFilter) ByteSize() uint {
+	size := uint(len(c.ring)) * ringPointSize
+	for _, shard := range c.shards {
+		size += byteSize(shard)
+	}
+	return size
+}
+
+// String returns a one-line summary of the ConsistentShardedFilter for logging
+// and debugging.
+func (c *ConsistentShardedFilter) String() string {
+	return fmt.Sprintf("ConsistentShardedFilter{shards=%d replicas=%d}", len(c.shards), c.replicas)
+}
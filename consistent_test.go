@@ -0,0 +1,161 @@
+package boom
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Ensures that data is routed to a consistent shard and only moves when its
+// shard is removed.
+func TestConsistentShardedRouting(t *testing.T) {
+	f := NewConsistentShardedFilter(64)
+
+	if name, filter := f.Shard([]byte(`a`)); name != "" || filter != nil {
+		t.Error("Expected no shard")
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if f.AddShard(name, NewBloomFilter(1000, 0.01)) != f {
+			t.Error("Returned ConsistentShardedFilter should be the same instance")
+		}
+	}
+
+	if shards := f.Shards(); !reflect.DeepEqual(shards, []string{"a", "b", "c"}) {
+		t.Errorf("Expected [a b c], got %v", shards)
+	}
+
+	before := make(map[int]string)
+	for i := 0; i < 3000; i++ {
+		before[i], _ = f.Shard([]byte(strconv.Itoa(i)))
+	}
+
+	counts := make(map[string]int)
+	for _, name := range before {
+		counts[name]++
+	}
+	for name, count := range counts {
+		if count < 500 {
+			t.Errorf("Expected shard %s to get at least 500 keys, got %d", name, count)
+		}
+	}
+
+	if f.RemoveShard("b") != f {
+		t.Error("Returned ConsistentShardedFilter should be the same instance")
+	}
+
+	for i, old := range before {
+		name, _ := f.Shard([]byte(strconv.Itoa(i)))
+		if old != "b" && name != old {
+			t.Errorf("Expected `%d` to stay on shard %s, got %s", i, old, name)
+		}
+	}
+}
+
+// Ensures that Test, Add, TestAndAdd, and ShardCounts behave correctly.
+func TestConsistentShardedTestAndAdd(t *testing.T) {
+	f := NewConsistentShardedFilter(16)
+	f.AddShard("a", NewBloomFilter(1000, 0.01))
+	f.AddShard("b", NewBloomFilter(1000, 0.01))
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned ConsistentShardedFilter should be the same instance")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	counts := f.ShardCounts()
+	if counts["a"]+counts["b"] != 2 {
+		t.Errorf("Expected 2 items across shards, got %v", counts)
+	}
+}
+
+// Ensures that Merge combines shards of the same name.
+func TestConsistentShardedMerge(t *testing.T) {
+	f := NewConsistentShardedFilter(16)
+	other := NewConsistentShardedFilter(16)
+	for _, name := range []string{"a", "b"} {
+		f.AddShard(name, NewBloomFilter(1000, 0.01))
+		other.AddShard(name, NewBloomFilter(1000, 0.01))
+	}
+
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		other.Add([]byte(strconv.Itoa(i + 100)))
+	}
+
+	if err := f.Merge(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	other.RemoveShard("b")
+	if err := f.Merge(other); err == nil {
+		t.Error("Expected error for mismatched shards")
+	}
+}
+
+// Ensures that Merge checks every shard before merging any, so shards with
+// different hash functions or indexing schemes leave the filter unchanged.
+func TestConsistentShardedMergeIncompatible(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(b *BloomFilter)
+	}{
+		{"fractional k", func(b *BloomFilter) { b.SetFractionalK(float64(b.K()) + 0.5) }},
+		{"indexing", func(b *BloomFilter) { b.SetIndexing(TripleHashing) }},
+	} {
+		f := NewConsistentShardedFilter(16)
+		other := NewConsistentShardedFilter(16)
+		for _, name := range []string{"a", "b", "c"} {
+			f.AddShard(name, NewBloomFilter(1000, 0.01))
+			shard := NewBloomFilter(1000, 0.01)
+			if name == "b" {
+				test.modify(shard)
+			}
+			shard.Add([]byte(name))
+			other.AddShard(name, shard)
+		}
+
+		if err := f.Merge(other); err == nil {
+			t.Errorf("%s: Expected error for incompatible shards", test.name)
+		}
+		for name, count := range f.ShardCounts() {
+			if count != 0 {
+				t.Errorf("%s: Expected shard %s to be unchanged, got count %d", test.name, name, count)
+			}
+		}
+	}
+}
+
+func BenchmarkConsistentShardedAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewConsistentShardedFilter(64)
+	for i := 0; i < 8; i++ {
+		f.AddShard(strconv.Itoa(i), NewBloomFilter(100000, 0.1))
+	}
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
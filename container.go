@@ -0,0 +1,224 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// containerMagic identifies a container file.
+var containerMagic = [8]byte{'B', 'O', 'O', 'M', 'C', 'T', 'R', '1'}
+
+// maxContainerName is the longest name of a container entry.
+const maxContainerName = 1<<16 - 1
+
+var errContainerMalformed = errors.New("malformed container")
+
+// CBORMarshaler is implemented by the structures which can be encoded as
+// CBOR, and so stored in a container.
+type CBORMarshaler interface {
+	MarshalCBOR() ([]byte, error)
+}
+
+// CBORUnmarshaler is implemented by the structures which can be decoded from
+// CBOR, and so loaded from a container.
+type CBORUnmarshaler interface {
+	UnmarshalCBOR(data []byte) error
+}
+
+// containerEntry is the directory entry of a section of a container.
+type containerEntry struct {
+	offset uint64 // offset of the section from the start of the container
+	length uint64 // length of the section
+	crc    uint32 // CRC-32 (IEEE) of the section
+}
+
+// WriteContainer writes the named structures to the stream as a single
+// container and returns the number of bytes written. A container holds many
+// filters and sketches, such as one per category, so that they can be
+// snapshotted and restored as a unit, while any one of them can be loaded
+// without reading the rest.
+//
+// The container starts with the magic "BOOMCTR1" and the number of entries as
+// a big-endian uint32. A directory follows, sorted by name, with an entry for
+// each structure of the name's length as a uint16, the name, and the offset
+// from the start of the container, length, and CRC-32 (IEEE) of its section as
+// a uint64, uint64, and uint32. The sections follow the directory, each the
+// structure's CBOR encoding.
+func WriteContainer(stream io.Writer, entries map[string]CBORMarshaler) (int64, error) {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		if len(name) > maxContainerName {
+			return 0, errors.New("container entry name too long")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sections := make([][]byte, len(names))
+	offset := uint64(len(containerMagic) + 4)
+	for i, name := range names {
+		data, err := entries[name].MarshalCBOR()
+		if err != nil {
+			return 0, err
+		}
+		sections[i] = data
+		offset += 2 + uint64(len(name)) + 8 + 8 + 4
+	}
+
+	var dir bytes.Buffer
+	dir.Write(containerMagic[:])
+	binary.Write(&dir, binary.BigEndian, uint32(len(names)))
+	for i, name := range names {
+		binary.Write(&dir, binary.BigEndian, uint16(len(name)))
+		dir.WriteString(name)
+		binary.Write(&dir, binary.BigEndian, offset)
+		binary.Write(&dir, binary.BigEndian, uint64(len(sections[i])))
+		binary.Write(&dir, binary.BigEndian, crc32.ChecksumIEEE(sections[i]))
+		offset += uint64(len(sections[i]))
+	}
+
+	w := &countingWriter{w: stream}
+	if _, err := w.Write(dir.Bytes()); err != nil {
+		return w.n, err
+	}
+	for _, section := range sections {
+		if _, err := w.Write(section); err != nil {
+			return w.n, err
+		}
+	}
+	return w.n, nil
+}
+
+// SaveContainer atomically writes the named structures as a container to the
+// file at path. The container is written to a temporary file in the same
+// directory which then replaces the file, so readers see either the old or
+// the new container in full.
+func SaveContainer(path string, entries map[string]CBORMarshaler) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := WriteContainer(w, entries)
+		return err
+	})
+}
+
+// ContainerReader reads the structures in a container written by
+// WriteContainer. Only the directory is read when it's opened, and each
+// section is read when it's loaded.
+type ContainerReader struct {
+	r       io.ReaderAt               // container data
+	closer  io.Closer                 // closes the underlying data, or nil
+	names   []string                  // entry names, sorted
+	entries map[string]containerEntry // directory
+}
+
+// NewContainerReader reads the directory of the container in r.
+func NewContainerReader(r io.ReaderAt) (*ContainerReader, error) {
+	sr := io.NewSectionReader(r, 0, 1<<63-1)
+	var (
+		magic [8]byte
+		count uint32
+	)
+	if _, err := io.ReadFull(sr, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != containerMagic {
+		return nil, errors.New("not a container")
+	}
+	if err := binary.Read(sr, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+
+	c := &ContainerReader{r: r, entries: make(map[string]containerEntry)}
+	for i := uint32(0); i < count; i++ {
+		var length uint16
+		if err := binary.Read(sr, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		name := make([]byte, length)
+		if _, err := io.ReadFull(sr, name); err != nil {
+			return nil, err
+		}
+		var entry containerEntry
+		for _, field := range []interface{}{&entry.offset, &entry.length, &entry.crc} {
+			if err := binary.Read(sr, binary.BigEndian, field); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := c.entries[string(name)]; ok || entry.offset > math.MaxInt64 ||
+			entry.length > math.MaxInt64-entry.offset {
+			return nil, errContainerMalformed
+		}
+		c.names = append(c.names, string(name))
+		c.entries[string(name)] = entry
+	}
+	sort.Strings(c.names)
+	return c, nil
+}
+
+// OpenContainer opens the container file at path, reading sections from the
+// file as they're loaded. The reader must be closed once it's no longer used.
+func OpenContainer(path string) (*ContainerReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewContainerReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.closer = f
+	return c, nil
+}
+
+// Names returns the names of the structures in the container, sorted.
+func (c *ContainerReader) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Section returns the CBOR encoding of the named structure, after checking its
+// CRC.
+func (c *ContainerReader) Section(name string) ([]byte, error) {
+	entry, ok := c.entries[name]
+	if !ok {
+		return nil, errors.New("no container entry named " + name)
+	}
+
+	// The section is read as it arrives, so a forged length which extends
+	// past the end of the data fails rather than allocating it up front.
+	section := io.NewSectionReader(c.r, int64(entry.offset), int64(entry.length))
+	data, _, err := readBytes(section, entry.length)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errContainerMalformed
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != entry.crc {
+		return nil, errors.New("container entry " + name + " is corrupt")
+	}
+	return data, nil
+}
+
+// Load decodes the named structure into the provided one, such as an empty
+// BloomFilter.
+func (c *ContainerReader) Load(name string, into CBORUnmarshaler) error {
+	data, err := c.Section(name)
+	if err != nil {
+		return err
+	}
+	return into.UnmarshalCBOR(data)
+}
+
+// Close releases the file or mapping underlying the reader, if any.
+func (c *ContainerReader) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
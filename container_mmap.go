@@ -0,0 +1,50 @@
+//go:build unix && !tinygo
+
+package boom
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// MmapContainer opens the container file at path by mapping it into memory,
+// so sections are paged in by the operating system as they're loaded rather
+// than read with system calls. Loaded structures are copied out of the
+// mapping. The reader must be closed once it's no longer used, which unmaps
+// the file.
+func MmapContainer(path string) (*ContainerReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 || int64(int(info.Size())) != info.Size() {
+		return nil, errors.New("can't map container " + info.Name())
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewContainerReader(bytes.NewReader(data))
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	c.closer = mapping(data)
+	return c, nil
+}
+
+// mapping is a memory-mapped file which is unmapped when closed.
+type mapping []byte
+
+func (m mapping) Close() error {
+	return syscall.Munmap(m)
+}
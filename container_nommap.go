@@ -0,0 +1,18 @@
+//go:build !unix || tinygo
+
+package boom
+
+import (
+	"bytes"
+	"os"
+)
+
+// MmapContainer opens the container file at path. Memory mapping isn't
+// supported on this platform, so the file is read into memory instead.
+func MmapContainer(path string) (*ContainerReader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewContainerReader(bytes.NewReader(data))
+}
@@ -0,0 +1,146 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Ensures that structures written to a container can be loaded individually.
+func TestContainerRoundTrip(t *testing.T) {
+	bloom := NewBloomFilter(100, 0.01)
+	cms := NewCountMinSketch(0.01, 0.99)
+	for i := 0; i < 100; i++ {
+		bloom.Add([]byte(strconv.Itoa(i)))
+		cms.Add([]byte(strconv.Itoa(i % 10)))
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteContainer(&buf, map[string]CBORMarshaler{"users": bloom, "clicks": cms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d, got %d", buf.Len(), n)
+	}
+
+	c, err := NewContainerReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := c.Names(); len(names) != 2 || names[0] != "clicks" || names[1] != "users" {
+		t.Errorf("Expected [clicks users], got %v", names)
+	}
+
+	users := &BloomFilter{}
+	if err := c.Load("users", users); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if !users.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	clicks := &CountMinSketch{}
+	if err := c.Load("clicks", clicks); err != nil {
+		t.Fatal(err)
+	}
+	if count := clicks.Count([]byte(`3`)); count != cms.Count([]byte(`3`)) {
+		t.Errorf("Expected %d, got %d", cms.Count([]byte(`3`)), count)
+	}
+
+	if err := c.Load("missing", &BloomFilter{}); err == nil {
+		t.Error("Expected error for missing entry")
+	}
+	if err := c.Load("clicks", &BloomFilter{}); err == nil {
+		t.Error("Expected error for mismatched structure")
+	}
+}
+
+// Ensures that corrupt and truncated containers are detected.
+func TestContainerCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := WriteContainer(&buf, map[string]CBORMarshaler{"a": NewBloomFilter(100, 0.01)}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := NewContainerReader(bytes.NewReader(data[:10])); err == nil {
+		t.Error("Expected error for truncated directory")
+	}
+
+	c, err := NewContainerReader(bytes.NewReader(data[:len(data)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Section("a"); err == nil {
+		t.Error("Expected error for truncated section")
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-1] ^= 1
+	if c, err = NewContainerReader(bytes.NewReader(corrupt)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Section("a"); err == nil {
+		t.Error("Expected error for corrupt section")
+	}
+
+	// A forged length extending far past the end of the data is rejected
+	// rather than allocated.
+	forged := append([]byte(nil), data...)
+	binary.BigEndian.PutUint64(forged[23:], 1<<40)
+	if c, err = NewContainerReader(bytes.NewReader(forged)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Section("a"); err == nil {
+		t.Error("Expected error for forged section length")
+	}
+
+	if _, err := NewContainerReader(bytes.NewReader([]byte("not a container"))); err == nil {
+		t.Error("Expected error for bad magic")
+	}
+}
+
+// Ensures that containers saved to a file can be opened and mapped.
+func TestContainerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters")
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range dictionary(1000) {
+		hll.Add([]byte(word))
+	}
+
+	if err := SaveContainer(path, map[string]CBORMarshaler{"visitors": hll}); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again replaces the container.
+	if err := SaveContainer(path, map[string]CBORMarshaler{"visitors": hll, "users": NewBloomFilter(100, 0.01)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, open := range []func(string) (*ContainerReader, error){OpenContainer, MmapContainer} {
+		c, err := open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Names()) != 2 {
+			t.Errorf("Expected 2 entries, got %v", c.Names())
+		}
+		visitors := &HyperLogLog{}
+		if err := c.Load("visitors", visitors); err != nil {
+			t.Fatal(err)
+		}
+		if visitors.Count() != hll.Count() {
+			t.Errorf("Expected %d, got %d", hll.Count(), visitors.Count())
+		}
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package boom
+
+import (
+	"context"
+	"io"
+)
+
+// contextChunk is the most bytes read, written, or merged between checks of
+// a context, so that cancelling a long-running operation on a large filter
+// takes effect promptly.
+const contextChunk = 1 << 20
+
+// WriteToContext writes the structure to the stream like its WriteTo method,
+// but stops with the context's error once the context is done, so that
+// serializing a filter of many gigabytes can be cancelled. Writes are split
+// into chunks of at most 1 MiB, and progress, if not nil, is called with the
+// total number of bytes written after each one. It returns the number of
+// bytes written. The stream holds a partial structure if it's cancelled.
+func WriteToContext(ctx context.Context, stream io.Writer, structure io.WriterTo,
+	progress func(written int64)) (int64, error) {
+
+	w := &contextWriter{ctx: ctx, w: stream, progress: progress}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := structure.WriteTo(w)
+	if w.err != nil {
+		err = w.err
+	}
+	return n, err
+}
+
+// ReadFromContext reads the structure from the stream like its ReadFrom
+// method, but stops with the context's error once the context is done. Reads
+// are at most 1 MiB, and progress, if not nil, is called with the total number
+// of bytes read after each one. It returns the number of bytes read. The
+// structure must not be used if it's cancelled.
+func ReadFromContext(ctx context.Context, stream io.Reader, structure io.ReaderFrom,
+	progress func(read int64)) (int64, error) {
+
+	r := &contextReader{ctx: ctx, r: stream, progress: progress}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := structure.ReadFrom(r)
+	if r.err != nil {
+		err = r.err
+	}
+	return n, err
+}
+
+// contextWriter splits writes into chunks, checking the context before each
+// and reporting progress after.
+type contextWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	progress func(written int64)
+	written  int64
+	err      error // context error which stopped the write
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if c.err = c.ctx.Err(); c.err != nil {
+			return n, c.err
+		}
+		chunk := p[:min(len(p), contextChunk)]
+		written, err := c.w.Write(chunk)
+		n += written
+		c.written += int64(written)
+		if err != nil {
+			return n, err
+		}
+		if c.progress != nil {
+			c.progress(c.written)
+		}
+		p = p[written:]
+	}
+	return n, nil
+}
+
+// contextReader limits reads to a chunk, checking the context before each
+// and reporting progress after.
+type contextReader struct {
+	ctx      context.Context
+	r        io.Reader
+	progress func(read int64)
+	read     int64
+	err      error // context error which stopped the read
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if c.err = c.ctx.Err(); c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.r.Read(p[:min(len(p), contextChunk)])
+	c.read += int64(n)
+	if n > 0 && c.progress != nil {
+		c.progress(c.read)
+	}
+	return n, err
+}
@@ -0,0 +1,55 @@
+package boom
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// Ensures that WriteToContext and ReadFromContext round-trip a filter in
+// chunks, reporting progress, and stop once the context is cancelled.
+func TestWriteToReadFromContext(t *testing.T) {
+	f := NewBloomFilter(2000000, 0.01)
+	f.Add([]byte(`a`))
+
+	var (
+		buf     bytes.Buffer
+		reports []int64
+	)
+	n, err := WriteToContext(context.Background(), &buf, f, func(written int64) {
+		reports = append(reports, written)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || reports[len(reports)-1] != n {
+		t.Errorf("Expected %d bytes written, got %d and progress %v", buf.Len(), n, reports)
+	}
+	if len(reports) < 2 {
+		t.Errorf("Expected progress for each chunk, got %v", reports)
+	}
+	data := buf.Bytes()
+
+	other := &BloomFilter{}
+	read, err := ReadFromContext(context.Background(), bytes.NewReader(data), other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != n || !other.Equal(f) {
+		t.Errorf("Expected %d bytes of %s, got %d of %s", n, f, read, other)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	buf.Reset()
+	_, err = WriteToContext(ctx, &buf, f, func(written int64) { cancel() })
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if buf.Len() >= int(n) {
+		t.Errorf("Expected fewer than %d bytes written before cancelling, got %d", n, buf.Len())
+	}
+
+	if _, err := ReadFromContext(ctx, bytes.NewReader(data), &BloomFilter{}, nil); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
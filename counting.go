@@ -1,10 +1,20 @@
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
-	"hash/fnv"
+	"io"
+	"math"
+	"sort"
 )
 
+// spillEntrySize is the approximate memory used by each entry of the spill map
+// in bytes.
+const spillEntrySize = 16
+
 // CountingBloomFilter implement a Counting Bloom Filter as described by Fan,
 // Cao, Almeida, and Broder in Summary Cache: A Scalable Wide-Area Web Cache
 // Sharing Protocol:
@@ -22,12 +32,13 @@ import (
 // and removed from the data set. Since they use n-bit buckets, CBFs use
 // roughly n-times more memory than traditional Bloom filters.
 type CountingBloomFilter struct {
-	buckets     *Buckets    // filter data
-	hash        hash.Hash64 // hash function (kernel for all k functions)
-	m           uint        // number of buckets
-	k           uint        // number of hash functions
-	count       uint        // number of items in the filter
-	indexBuffer []uint      // buffer used to cache indices
+	buckets     *Buckets        // filter data
+	hash        hash.Hash64     // hash function (kernel for all k functions)
+	m           uint            // number of buckets
+	k           uint            // number of hash functions
+	count       uint            // number of items in the filter
+	indexBuffer []uint          // buffer used to cache indices
+	spill       map[uint]uint32 // excess of saturated buckets, nil if disabled
 }
 
 // NewCountingBloomFilter creates a new Counting Bloom Filter optimized to
@@ -41,7 +52,7 @@ func NewCountingBloomFilter(n uint, b uint8, fpRate float64) *CountingBloomFilte
 	)
 	return &CountingBloomFilter{
 		buckets:     NewBuckets(m, b),
-		hash:        fnv.New64(),
+		hash:        newDefaultHash(),
 		m:           m,
 		k:           k,
 		indexBuffer: make([]uint, k),
@@ -55,6 +66,43 @@ func NewDefaultCountingBloomFilter(n uint, fpRate float64) *CountingBloomFilter
 	return NewCountingBloomFilter(n, 4, fpRate)
 }
 
+// NewCountingBloomFilterE is like NewCountingBloomFilter but returns an error
+// if n is zero, b isn't between 1 and 32, fpRate isn't between 0 and 1, or the
+// filter would be too large to address.
+func NewCountingBloomFilterE(n uint, b uint8, fpRate float64) (*CountingBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateBucketSize("b", b); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, b); err != nil {
+		return nil, err
+	}
+	return NewCountingBloomFilter(n, b, fpRate), nil
+}
+
+// EnableSpill enables spilling the excess of saturated buckets into a small
+// exact map keyed by bucket index. Without it, a bucket stops counting at its
+// maximum value, so removing a key added more times than that, such as a heavy
+// hitter, decrements buckets that were never incremented and causes false
+// negatives. Spilling keeps removals correct for such keys without raising the
+// bucket size for the whole filter, using memory only for the few buckets
+// which saturate. It must be called before any items are added.
+func (c *CountingBloomFilter) EnableSpill() {
+	if c.spill == nil {
+		c.spill = make(map[uint]uint32)
+	}
+}
+
+// Spilled returns the number of buckets with excess spilled to the side map.
+func (c *CountingBloomFilter) Spilled() int {
+	return len(c.spill)
+}
+
 // Capacity returns the Bloom filter capacity, m.
 func (c *CountingBloomFilter) Capacity() uint {
 	return c.m
@@ -70,15 +118,34 @@ func (c *CountingBloomFilter) Count() uint {
 	return c.count
 }
 
+// EstimateFPRate returns the current expected false-positive rate, derived
+// from the ratio of non-zero buckets and the number of hash functions. It
+// grows as the filter fills, so it can be monitored to detect when a
+// long-lived filter has degraded past its target.
+func (c *CountingBloomFilter) EstimateFPRate() float64 {
+	return math.Pow(c.buckets.nonZeroRatio(), float64(c.k))
+}
+
+// SetHash sets the hashing function used in the filter. Filters must use the
+// same hashing function to be merged or compared.
+func (c *CountingBloomFilter) SetHash(h hash.Hash64) {
+	c.hash = h
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives and false negatives.
 func (c *CountingBloomFilter) Test(data []byte) bool {
-	lower, upper := hashKernel(data, c.hash)
+	return c.TestHash(hashKernel(data, c.hash))
+}
 
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (c *CountingBloomFilter) TestHash(lower, upper uint32) bool {
 	// If any of the K bits are not set, then it's not a member.
 	for i := uint(0); i < c.k; i++ {
-		if c.buckets.Get((uint(lower)+uint(upper)*i)%c.m) == 0 {
+		if c.buckets.Get(DoubleHashing.index(lower, upper, i, c.m)) == 0 {
 			return false
 		}
 	}
@@ -89,11 +156,17 @@ func (c *CountingBloomFilter) Test(data []byte) bool {
 // Add will add the data to the Bloom filter. It returns the filter to allow
 // for chaining.
 func (c *CountingBloomFilter) Add(data []byte) Filter {
-	lower, upper := hashKernel(data, c.hash)
+	c.AddHash(hashKernel(data, c.hash))
+	return c
+}
 
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (c *CountingBloomFilter) AddHash(lower, upper uint32) Filter {
 	// Set the K bits.
 	for i := uint(0); i < c.k; i++ {
-		c.buckets.Increment((uint(lower)+uint(upper)*i)%c.m, 1)
+		c.increment(DoubleHashing.index(lower, upper, i, c.m))
 	}
 
 	c.count++
@@ -108,17 +181,79 @@ func (c *CountingBloomFilter) TestAndAdd(data []byte) bool {
 
 	// If any of the K bits are not set, then it's not a member.
 	for i := uint(0); i < c.k; i++ {
-		idx := (uint(lower) + uint(upper)*i) % c.m
+		idx := DoubleHashing.index(lower, upper, i, c.m)
 		if c.buckets.Get(idx) == 0 {
 			member = false
 		}
-		c.buckets.Increment(idx, 1)
+		c.increment(idx)
 	}
 
 	c.count++
 	return member
 }
 
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (c *CountingBloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		c.AddHash(hashKernel(element, c.hash))
+	}
+	return c
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element.
+func (c *CountingBloomFilter) TestMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = c.TestHash(hashKernel(element, c.hash))
+	}
+	return results
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (c *CountingBloomFilter) TestString(data string) bool {
+	return c.TestHash(hashKernelString(data, c.hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (c *CountingBloomFilter) AddString(data string) Filter {
+	return c.AddHash(hashKernelString(data, c.hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (c *CountingBloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, c.hash)
+	member := c.TestHash(lower, upper)
+	c.AddHash(lower, upper)
+	return member
+}
+
+// TestAtLeast will test whether the data has been added at least t times and
+// returns true if its estimated multiplicity, the minimum of its K buckets, is
+// at least t. Like Test, there is a non-zero probability of false positives
+// and false negatives. Unless spilling is enabled, buckets saturate at their
+// maximum value, so a saturated estimate is treated as meeting any threshold.
+func (c *CountingBloomFilter) TestAtLeast(data []byte, t uint32) bool {
+	lower, upper := hashKernel(data, c.hash)
+	max := uint32(c.buckets.MaxBucketValue())
+
+	// If any of the K buckets is below the threshold, then it's not.
+	for i := uint(0); i < c.k; i++ {
+		idx := DoubleHashing.index(lower, upper, i, c.m)
+		count := c.buckets.Get(idx) + c.spill[idx]
+		if count < t && (count < max || c.spill != nil) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // TestAndRemove will test for membership of the data and remove it from the
 // filter if it exists. Returns true if the data was a member, false if not.
 func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
@@ -127,7 +262,7 @@ func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
 
 	// Set the K bits.
 	for i := uint(0); i < c.k; i++ {
-		c.indexBuffer[i] = (uint(lower) + uint(upper)*i) % c.m
+		c.indexBuffer[i] = DoubleHashing.index(lower, upper, i, c.m)
 		if c.buckets.Get(c.indexBuffer[i]) == 0 {
 			member = false
 		}
@@ -135,7 +270,7 @@ func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
 
 	if member {
 		for _, idx := range c.indexBuffer {
-			c.buckets.Increment(idx, -1)
+			c.decrement(idx)
 		}
 		c.count--
 	}
@@ -143,10 +278,227 @@ func (c *CountingBloomFilter) TestAndRemove(data []byte) bool {
 	return member
 }
 
+// WriteTo writes a binary representation of the CountingBloomFilter to an i/o
+// stream, including any spilled excess. It returns the number of bytes
+// written.
+func (c *CountingBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	// The last field is zero if spilling is disabled, else one more than the
+	// number of spilled buckets.
+	spilled := uint64(0)
+	if c.spill != nil {
+		spilled = uint64(len(c.spill)) + 1
+	}
+	header := []uint64{uint64(c.count), uint64(c.m), uint64(c.k), spilled}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := c.buckets.WriteTo(stream)
+	written += n
+	if err != nil {
+		return written, err
+	}
+
+	for _, idx := range c.spilledBuckets() {
+		pair := []uint64{uint64(idx), uint64(c.spill[idx])}
+		if err := binary.Write(stream, binary.BigEndian, pair); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(pair))
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a CountingBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (c *CountingBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	buckets := &Buckets{}
+	n, err := buckets.ReadFrom(stream)
+	read += n
+	if err != nil {
+		return read, err
+	}
+	if uint64(buckets.count) != header[1] || header[2] == 0 || header[2] > header[1] {
+		return read, errors.New("invalid counting bloom filter dimensions")
+	}
+
+	var spill map[uint]uint32
+	if header[3] > 0 {
+		spill = make(map[uint]uint32)
+		pair := make([]uint64, 2)
+		for i := uint64(1); i < header[3]; i++ {
+			if err := binary.Read(stream, binary.BigEndian, pair); err != nil {
+				return read, err
+			}
+			read += int64(binary.Size(pair))
+			spill[uint(pair[0])] = uint32(pair[1])
+		}
+	}
+
+	c.buckets = buckets
+	if c.hash == nil {
+		c.hash = newDefaultHash()
+	}
+	c.count = uint(header[0])
+	c.m = uint(header[1])
+	c.k = uint(header[2])
+	c.indexBuffer = make([]uint, c.k)
+	c.spill = spill
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CountingBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CountingBloomFilter) GobDecode(data []byte) error {
+	_, err := c.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including spilled excess.
+func (c *CountingBloomFilter) ByteSize() uint {
+	return c.buckets.ByteSize() + uint(len(c.spill))*spillEntrySize
+}
+
+// String returns a one-line summary of the CountingBloomFilter for logging and
+// debugging.
+func (c *CountingBloomFilter) String() string {
+	var b uint8
+	if c.buckets != nil {
+		b = c.buckets.bucketSize
+	}
+	return fmt.Sprintf("CountingBloomFilter{m=%d k=%d b=%d count=%d fp=%.4g}",
+		c.m, c.k, b, c.count, estimatedFPRate(c.m, c.k, c.count))
+}
+
 // Reset restores the Bloom filter to its original state. It returns the filter
 // to allow for chaining.
 func (c *CountingBloomFilter) Reset() *CountingBloomFilter {
 	c.buckets.Reset()
+	if c.spill != nil {
+		c.spill = make(map[uint]uint32)
+	}
 	c.count = 0
 	return c
 }
+
+// Copy returns a deep copy of the CountingBloomFilter. Returns
+// ErrHashNotCloneable if the filter's hash can't be cloned.
+func (c *CountingBloomFilter) Copy() (*CountingBloomFilter, error) {
+	hash, err := copyHash64(c.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *c
+	copied.buckets = c.buckets.Copy()
+	copied.hash = hash
+	copied.indexBuffer = make([]uint, len(c.indexBuffer))
+	if c.spill != nil {
+		copied.spill = make(map[uint]uint32, len(c.spill))
+		for idx, excess := range c.spill {
+			copied.spill[idx] = excess
+		}
+	}
+	return &copied, nil
+}
+
+// ToBloomFilter returns a classic BloomFilter with a bit set for each non-zero
+// bucket, which tests membership exactly as this filter does in 1/b of the
+// memory for b-bit buckets. It suits building a filter with removals and then
+// distributing a compact, read-optimized artifact, which can be frozen with
+// Freeze. The BloomFilter uses a copy of this filter's hashing function and
+// can't remove items. Later changes to either filter don't affect the other.
+// Returns ErrHashNotCloneable if the filter's hash can't be cloned.
+func (c *CountingBloomFilter) ToBloomFilter() (*BloomFilter, error) {
+	hash, err := copyHash64(c.hash)
+	if err != nil {
+		return nil, err
+	}
+	buckets := NewBuckets(c.m, 1)
+	for i := uint(0); i < c.m; i++ {
+		if c.buckets.Get(i) != 0 {
+			buckets.Set(i, 1)
+		}
+	}
+	return &BloomFilter{
+		buckets: buckets,
+		hash:    hash,
+		m:       c.m,
+		k:       c.k,
+		count:   c.count,
+	}, nil
+}
+
+// Equal returns whether the other CountingBloomFilter has the same parameters,
+// hashing function, and buckets, spilled excess, and count.
+func (c *CountingBloomFilter) Equal(other *CountingBloomFilter) bool {
+	if c.m != other.m || c.k != other.k || c.count != other.count ||
+		!sameHash(c.hash, other.hash) || !c.buckets.Equal(other.buckets) {
+		return false
+	}
+	if (c.spill == nil) != (other.spill == nil) || len(c.spill) != len(other.spill) {
+		return false
+	}
+	for idx, excess := range c.spill {
+		if other.spill[idx] != excess {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (c *CountingBloomFilter) Clear() {
+	c.Reset()
+}
+
+// increment increments the bucket, spilling to the side map if it's saturated
+// and spilling is enabled.
+func (c *CountingBloomFilter) increment(idx uint) {
+	if c.spill != nil && c.buckets.Get(idx) == uint32(c.buckets.MaxBucketValue()) {
+		c.spill[idx]++
+		return
+	}
+	c.buckets.Increment(idx, 1)
+}
+
+// spilledBuckets returns the indices of the buckets with spilled excess, in
+// order.
+func (c *CountingBloomFilter) spilledBuckets() []uint {
+	spilled := make([]uint, 0, len(c.spill))
+	for idx := range c.spill {
+		spilled = append(spilled, idx)
+	}
+	sort.Slice(spilled, func(i, j int) bool { return spilled[i] < spilled[j] })
+	return spilled
+}
+
+// decrement decrements the bucket, taking from its spilled excess first.
+func (c *CountingBloomFilter) decrement(idx uint) {
+	if excess, ok := c.spill[idx]; ok {
+		if excess <= 1 {
+			delete(c.spill, idx)
+		} else {
+			c.spill[idx] = excess - 1
+		}
+		return
+	}
+	c.buckets.Increment(idx, -1)
+}
@@ -1,6 +1,8 @@
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
 	"strconv"
 	"testing"
 )
@@ -14,6 +16,39 @@ func TestCountingCapacity(t *testing.T) {
 	}
 }
 
+// Ensures that NewCountingBloomFilterE returns an error for invalid parameters.
+func TestNewCountingBloomFilterE(t *testing.T) {
+	if f, err := NewCountingBloomFilterE(100, 4, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a CountingBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewCountingBloomFilterE(0, 4, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewCountingBloomFilterE(100, 0, 0.01); err == nil {
+		t.Error("Expected error for b = 0")
+	}
+
+	if _, err := NewCountingBloomFilterE(100, 33, 0.01); err == nil {
+		t.Error("Expected error for b > 32")
+	}
+
+	if _, err := NewCountingBloomFilterE(100, 4, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that String summarizes the filter.
+func TestCountingString(t *testing.T) {
+	f := NewCountingBloomFilter(100, 4, 0.1)
+	expected := "CountingBloomFilter{m=480 k=4 b=4 count=0 fp=0}"
+
+	if s := f.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
+
 // Ensures that K returns the number of hash functions in the Bloom Filter.
 func TestCountingK(t *testing.T) {
 	f := NewDefaultCountingBloomFilter(100, 0.1)
@@ -114,6 +149,75 @@ func TestCountingTestAndRemove(t *testing.T) {
 	}
 }
 
+// Ensures that TestAtLeast compares the estimated multiplicity to the
+// Ensures that ToBloomFilter returns a BloomFilter with the same members as
+// the filter after removals.
+func TestCountingToBloomFilter(t *testing.T) {
+	f := NewDefaultCountingBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 500; i++ {
+		f.TestAndRemove([]byte(strconv.Itoa(i)))
+	}
+
+	b, err := f.ToBloomFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Capacity() != f.Capacity() || b.K() != f.K() || b.Count() != f.Count() {
+		t.Errorf("Expected parameters of %s, got %s", f, b)
+	}
+	for i := 0; i < 2000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if b.Test(data) != f.Test(data) {
+			t.Errorf("Expected %v for `%d`", f.Test(data), i)
+		}
+	}
+	if size := (f.Capacity() + 7) / 8; b.ByteSize() != size {
+		t.Errorf("Expected %d, got %d", size, b.ByteSize())
+	}
+
+	b.Add([]byte(`a`))
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member of the counting filter")
+	}
+}
+
+// threshold.
+func TestCountingTestAtLeast(t *testing.T) {
+	f := NewDefaultCountingBloomFilter(100, 0.01)
+
+	if !f.TestAtLeast([]byte(`a`), 0) {
+		t.Error("`a` should occur at least 0 times")
+	}
+
+	if f.TestAtLeast([]byte(`a`), 1) {
+		t.Error("`a` should not occur at least once")
+	}
+
+	for i := 0; i < 5; i++ {
+		f.Add([]byte(`a`))
+	}
+
+	if !f.TestAtLeast([]byte(`a`), 5) {
+		t.Error("`a` should occur at least 5 times")
+	}
+
+	if f.TestAtLeast([]byte(`a`), 6) {
+		t.Error("`a` should not occur at least 6 times")
+	}
+
+	// Buckets saturate at 15, so larger thresholds can't be ruled out.
+	for i := 0; i < 20; i++ {
+		f.Add([]byte(`a`))
+	}
+
+	if !f.TestAtLeast([]byte(`a`), 100) {
+		t.Error("Saturated `a` should meet any threshold")
+	}
+}
+
 // Ensures that Reset sets every bit to zero and the count is zero.
 func TestCountingReset(t *testing.T) {
 	f := NewDefaultCountingBloomFilter(100, 0.1)
@@ -136,6 +240,81 @@ func TestCountingReset(t *testing.T) {
 	}
 }
 
+// Ensures that spilling keeps removals of heavy hitters correct once their
+// buckets saturate.
+func TestCountingBloomSpill(t *testing.T) {
+	f := NewCountingBloomFilter(100, 2, 0.01)
+	f.EnableSpill()
+	heavy, other := []byte(`heavy`), []byte(`other`)
+
+	for i := 0; i < 10; i++ {
+		f.Add(heavy)
+	}
+	f.Add(other)
+	if f.Spilled() == 0 {
+		t.Error("Expected saturated buckets to spill")
+	}
+	if !f.TestAtLeast(heavy, 10) || f.TestAtLeast(heavy, 11) {
+		t.Error("Expected `heavy` to be counted exactly 10 times")
+	}
+
+	data, err := f.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &CountingBloomFilter{}
+	if err := decoded.UnmarshalCBOR(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*CountingBloomFilter{f, decoded} {
+		for i := 0; i < 10; i++ {
+			if !f.TestAndRemove(heavy) {
+				t.Fatalf("`heavy` should be a member after %d removals", i)
+			}
+		}
+		if f.Test(heavy) {
+			t.Error("`heavy` should not be a member")
+		}
+		if !f.Test(other) {
+			t.Error("`other` should be a member")
+		}
+		if f.Spilled() != 0 {
+			t.Errorf("Expected no spilled buckets, got %d", f.Spilled())
+		}
+	}
+
+	// Without spilling, removing a heavy hitter clears its buckets early.
+	f = NewCountingBloomFilter(100, 2, 0.01)
+	for i := 0; i < 10; i++ {
+		f.Add(heavy)
+	}
+	for i := 0; i < 3; i++ {
+		f.TestAndRemove(heavy)
+	}
+	if f.Test(heavy) {
+		t.Error("Expected `heavy` to be lost without spilling")
+	}
+}
+
+// Ensures that ReadFrom rejects a number of hash functions which is zero or
+// larger than the filter.
+func TestCountingReadFromInvalid(t *testing.T) {
+	f := NewCountingBloomFilter(100, 4, 0.01)
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []uint64{0, uint64(f.Capacity()) + 1, 1<<64 - 1} {
+		data := append([]byte(nil), buf.Bytes()...)
+		binary.BigEndian.PutUint64(data[16:], k)
+		if _, err := (&CountingBloomFilter{}).ReadFrom(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected error for k = %d", k)
+		}
+	}
+}
+
 func BenchmarkCountingAdd(b *testing.B) {
 	b.StopTimer()
 	f := NewDefaultCountingBloomFilter(100000, 0.1)
@@ -1,10 +1,15 @@
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash"
-	"hash/fnv"
+	"io"
 	"math"
+	"math/bits"
+	"sort"
 )
 
 // CountMinSketch implements a Count-Min Sketch as described by Cormode and
@@ -41,9 +46,8 @@ type CountMinSketch struct {
 // affect the space and time complexity.
 func NewCountMinSketch(epsilon, delta float64) *CountMinSketch {
 	var (
-		width  = uint(math.Ceil(math.E / epsilon))
-		depth  = uint(math.Ceil(math.Log(1 / delta)))
-		matrix = make([][]uint64, depth)
+		width, depth = OptimalCMSWidthDepth(epsilon, delta)
+		matrix       = make([][]uint64, depth)
 	)
 
 	for i := uint(0); i < depth; i++ {
@@ -56,10 +60,22 @@ func NewCountMinSketch(epsilon, delta float64) *CountMinSketch {
 		depth:   depth,
 		epsilon: epsilon,
 		delta:   delta,
-		hash:    fnv.New64(),
+		hash:    newDefaultHash(),
 	}
 }
 
+// NewCountMinSketchE is like NewCountMinSketch but returns an error if either
+// epsilon or delta isn't between 0 and 1.
+func NewCountMinSketchE(epsilon, delta float64) (*CountMinSketch, error) {
+	if err := validateRate("epsilon", epsilon); err != nil {
+		return nil, err
+	}
+	if err := validateRate("delta", delta); err != nil {
+		return nil, err
+	}
+	return NewCountMinSketch(epsilon, delta), nil
+}
+
 // Epsilon returns the relative-accuracy factor, epsilon.
 func (c *CountMinSketch) Epsilon() float64 {
 	return c.epsilon
@@ -75,6 +91,12 @@ func (c *CountMinSketch) TotalCount() uint64 {
 	return c.count
 }
 
+// SetHash sets the hashing function used in the sketch. Sketches must use the
+// same hashing function to be merged.
+func (c *CountMinSketch) SetHash(h hash.Hash64) {
+	c.hash = h
+}
+
 // Add will add the data to the set. Returns the CountMinSketch to allow for
 // chaining.
 func (c *CountMinSketch) Add(data []byte) *CountMinSketch {
@@ -82,13 +104,22 @@ func (c *CountMinSketch) Add(data []byte) *CountMinSketch {
 
 	// Increment count in each row.
 	for i := uint(0); i < c.depth; i++ {
-		c.matrix[i][(uint(lower)+uint(upper)*i)%c.width]++
+		c.matrix[i][DoubleHashing.index(lower, upper, i, c.width)]++
 	}
 
 	c.count++
 	return c
 }
 
+// AddMany will add each element of data to the set. It's equivalent to calling
+// Add on each element. Returns the CountMinSketch to allow for chaining.
+func (c *CountMinSketch) AddMany(data [][]byte) *CountMinSketch {
+	for _, element := range data {
+		c.Add(element)
+	}
+	return c
+}
+
 // Count returns the approximate count for the specified item, correct within
 // epsilon * total count with a probability of delta.
 func (c *CountMinSketch) Count(data []byte) uint64 {
@@ -99,12 +130,92 @@ func (c *CountMinSketch) Count(data []byte) uint64 {
 
 	for i := uint(0); i < c.depth; i++ {
 		count = uint64(math.Min(float64(count),
-			float64(c.matrix[i][(uint(lower)+uint(upper)*i)%c.width])))
+			float64(c.matrix[i][DoubleHashing.index(lower, upper, i, c.width)])))
 	}
 
 	return count
 }
 
+// CountMany returns the approximate count of each element of data in the same
+// order. It's equivalent to calling Count on each element.
+func (c *CountMinSketch) CountMany(data [][]byte) []uint64 {
+	counts := make([]uint64, len(data))
+	for i, element := range data {
+		counts[i] = c.Count(element)
+	}
+	return counts
+}
+
+// CountMeanMin returns the approximate count for the specified item using the
+// Count-Mean-Min estimator described by Deng and Rafiei in New Estimation
+// Algorithms for Streaming Data: Count-min Can Do More. Each row's counter is
+// corrected by subtracting the expected noise from the other items hashing to
+// it, and the median of the corrected counters is returned, bounded above by
+// Count. This is far more accurate than Count for low-frequency items in
+// skewed data, at the cost of possibly underestimating.
+func (c *CountMinSketch) CountMeanMin(data []byte) uint64 {
+	var (
+		lower, upper = hashKernel(data, c.hash)
+		min          = uint64(math.MaxUint64)
+		estimates    = make([]float64, c.depth)
+	)
+
+	for i := uint(0); i < c.depth; i++ {
+		counter := c.matrix[i][DoubleHashing.index(lower, upper, i, c.width)]
+		if counter < min {
+			min = counter
+		}
+
+		noise := 0.0
+		if c.width > 1 {
+			noise = float64(c.count-counter) / float64(c.width-1)
+		}
+		estimates[i] = float64(counter) - noise
+	}
+
+	sort.Float64s(estimates)
+	median := estimates[len(estimates)/2]
+	if len(estimates)%2 == 0 {
+		median = (estimates[len(estimates)/2-1] + median) / 2
+	}
+
+	if median <= 0 {
+		return 0
+	}
+	if estimate := uint64(math.Round(median)); estimate < min {
+		return estimate
+	}
+	return min
+}
+
+// Histogram returns an approximate frequency histogram, or count-of-counts,
+// of the items added to the sketch. It maps each frequency to the approximate
+// number of distinct items seen that many times. Each row of the sketch is a
+// histogram of its counters, so the histogram is the average over the rows,
+// rounded to the nearest item. Collisions merge low-frequency items into
+// higher-frequency counters, so the histogram is most accurate when the
+// number of distinct items is small relative to the sketch width. This is
+// useful for estimating the skew of a stream and tuning epsilon.
+func (c *CountMinSketch) Histogram() map[uint64]uint64 {
+	totals := make(map[uint64]uint64)
+	for i := uint(0); i < c.depth; i++ {
+		for _, count := range c.matrix[i] {
+			if count > 0 {
+				totals[count]++
+			}
+		}
+	}
+
+	histogram := make(map[uint64]uint64, len(totals))
+	for count, total := range totals {
+		if items := (total + uint64(c.depth)/2) / uint64(c.depth); items > 0 {
+			histogram[count] = items
+		}
+	}
+
+	return histogram
+}
+
 // Merge combines this CountMinSketch with another. Returns an error if the
 // matrix width and depth are not equal.
 func (c *CountMinSketch) Merge(other *CountMinSketch) error {
@@ -126,6 +237,123 @@ func (c *CountMinSketch) Merge(other *CountMinSketch) error {
 	return nil
 }
 
+// InnerProduct estimates the inner product of the frequency vectors of this
+// CountMinSketch and another, the sum over every item of the product of its
+// counts. Each row gives an overestimate, so the minimum is returned. The
+// inner product of a sketch with itself estimates the second frequency
+// moment. Returns an error if the matrix width and depth are not equal.
+func (c *CountMinSketch) InnerProduct(other *CountMinSketch) (float64, error) {
+	if c.depth != other.depth {
+		return 0, errors.New("matrix depth must match")
+	}
+
+	if c.width != other.width {
+		return 0, errors.New("matrix width must match")
+	}
+
+	product := math.Inf(1)
+	for i := uint(0); i < c.depth; i++ {
+		row := 0.0
+		for j := uint(0); j < c.width; j++ {
+			row += float64(c.matrix[i][j]) * float64(other.matrix[i][j])
+		}
+		product = math.Min(product, row)
+	}
+
+	return product, nil
+}
+
+// WriteTo writes a binary representation of the CountMinSketch to an i/o
+// stream. It returns the number of bytes written.
+func (c *CountMinSketch) WriteTo(stream io.Writer) (int64, error) {
+	header := cmsHeader{uint64(c.width), uint64(c.depth), c.count, c.epsilon, c.delta}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, row := range c.matrix {
+		if err := binary.Write(stream, binary.BigEndian, row); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(row))
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a CountMinSketch (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (c *CountMinSketch) ReadFrom(stream io.Reader) (int64, error) {
+	var header cmsHeader
+	if err := binary.Read(stream, binary.BigEndian, &header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	hi, size := bits.Mul64(header.Width, header.Depth)
+	if header.Width == 0 || header.Depth == 0 || hi != 0 || size > math.MaxInt64/8 {
+		return read, errors.New("invalid count-min sketch dimensions")
+	}
+	matrix := make([][]uint64, 0, 1)
+	for i := uint64(0); i < header.Depth; i++ {
+		row, n, err := readWords(stream, header.Width)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		matrix = append(matrix, row)
+	}
+
+	c.matrix = matrix
+	c.width = uint(header.Width)
+	c.depth = uint(header.Depth)
+	c.count = header.Count
+	c.epsilon = header.Epsilon
+	c.delta = header.Delta
+	if c.hash == nil {
+		c.hash = newDefaultHash()
+	}
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (c *CountMinSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (c *CountMinSketch) GobDecode(data []byte) error {
+	_, err := c.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// cmsHeader is the header of the binary representation of a CountMinSketch.
+type cmsHeader struct {
+	Width   uint64
+	Depth   uint64
+	Count   uint64
+	Epsilon float64
+	Delta   float64
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's data.
+func (c *CountMinSketch) ByteSize() uint {
+	return c.width * c.depth * 8
+}
+
+// String returns a one-line summary of the CountMinSketch for logging and
+// debugging.
+func (c *CountMinSketch) String() string {
+	return fmt.Sprintf("CountMinSketch{width=%d depth=%d epsilon=%g delta=%g count=%d}",
+		c.width, c.depth, c.epsilon, c.delta, c.count)
+}
+
 // Reset restores the CountMinSketch to its original state. It returns itself
 // to allow for chaining.
 func (c *CountMinSketch) Reset() *CountMinSketch {
@@ -138,3 +366,47 @@ func (c *CountMinSketch) Reset() *CountMinSketch {
 	c.count = 0
 	return c
 }
+
+// halve divides every counter and the total count by two, rounding down, so
+// that older occurrences carry half the weight of new ones.
+func (c *CountMinSketch) halve() {
+	for _, row := range c.matrix {
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	c.count >>= 1
+}
+
+// Copy returns a deep copy of the CountMinSketch. Returns ErrHashNotCloneable
+// if the sketch's hash can't be cloned.
+func (c *CountMinSketch) Copy() (*CountMinSketch, error) {
+	hash, err := copyHash64(c.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *c
+	copied.matrix = make([][]uint64, len(c.matrix))
+	for i, row := range c.matrix {
+		copied.matrix[i] = append([]uint64(nil), row...)
+	}
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other CountMinSketch has the same parameters,
+// hashing function, and counters.
+func (c *CountMinSketch) Equal(other *CountMinSketch) bool {
+	if c.width != other.width || c.depth != other.depth || c.count != other.count ||
+		c.epsilon != other.epsilon || c.delta != other.delta || !sameHash(c.hash, other.hash) {
+		return false
+	}
+	for i, row := range c.matrix {
+		for j, counter := range row {
+			if other.matrix[i][j] != counter {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,10 +1,37 @@
 package boom
 
 import (
+	"bytes"
 	"strconv"
 	"testing"
 )
 
+// Ensures that NewCountMinSketchE returns an error for invalid parameters.
+func TestNewCountMinSketchE(t *testing.T) {
+	if cms, err := NewCountMinSketchE(0.001, 0.99); err != nil || cms == nil {
+		t.Errorf("Expected a CountMinSketch, got error %v", err)
+	}
+
+	if _, err := NewCountMinSketchE(0, 0.99); err == nil {
+		t.Error("Expected error for epsilon = 0")
+	}
+
+	if _, err := NewCountMinSketchE(0.001, 1); err == nil {
+		t.Error("Expected error for delta = 1")
+	}
+}
+
+// Ensures that String summarizes the sketch.
+func TestCMSString(t *testing.T) {
+	cms := NewCountMinSketch(0.01, 0.5)
+	cms.Add([]byte(`a`))
+	expected := "CountMinSketch{width=272 depth=1 epsilon=0.01 delta=0.5 count=1}"
+
+	if s := cms.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
+
 // Ensures that TotalCount returns the number of items added to the sketch.
 func TestCMSTotalCount(t *testing.T) {
 	cms := NewCountMinSketch(0.001, 0.99)
@@ -54,6 +81,76 @@ func TestCMSAddAndCount(t *testing.T) {
 	}
 }
 
+// Ensures that CountMeanMin is more accurate than Count for low-frequency
+// items in skewed data.
+func TestCMSCountMeanMin(t *testing.T) {
+	cms := NewCountMinSketch(0.01, 0.99)
+
+	// A few heavy items followed by a long tail of items seen once.
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 1000; j++ {
+			cms.Add([]byte("heavy" + strconv.Itoa(i)))
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		cms.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var cmErr, cmmErr uint64
+	for i := 0; i < 10000; i++ {
+		data := []byte(strconv.Itoa(i))
+		cmErr += cms.Count(data) - 1
+		if estimate := cms.CountMeanMin(data); estimate > 1 {
+			cmmErr += estimate - 1
+		} else {
+			cmmErr += 1 - estimate
+		}
+	}
+
+	if cmmErr >= cmErr {
+		t.Errorf("Expected Count-Mean-Min error %d to be less than Count-Min error %d",
+			cmmErr, cmErr)
+	}
+
+	if count := cms.CountMeanMin([]byte(`heavy0`)); count < 950 || count > 1000 {
+		t.Errorf("Expected about 1000, got %d", count)
+	}
+}
+
+// Ensures that Histogram returns the number of items seen at each frequency.
+func TestCMSHistogram(t *testing.T) {
+	cms := NewCountMinSketch(0.0001, 0.99)
+	for i := 0; i < 10; i++ {
+		cms.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 10; i < 15; i++ {
+		for j := 0; j < 3; j++ {
+			cms.Add([]byte(strconv.Itoa(i)))
+		}
+	}
+	for j := 0; j < 100; j++ {
+		cms.Add([]byte(`heavy`))
+	}
+
+	histogram := cms.Histogram()
+	if len(histogram) != 3 {
+		t.Errorf("Expected 3 frequencies, got %v", histogram)
+	}
+	if histogram[1] != 10 {
+		t.Errorf("Expected 10, got %d", histogram[1])
+	}
+	if histogram[3] != 5 {
+		t.Errorf("Expected 5, got %d", histogram[3])
+	}
+	if histogram[100] != 1 {
+		t.Errorf("Expected 1, got %d", histogram[100])
+	}
+
+	if histogram := cms.Reset().Histogram(); len(histogram) != 0 {
+		t.Errorf("Expected empty histogram, got %v", histogram)
+	}
+}
+
 // Ensures that Merge combines the two sketches.
 func TestCMSMerge(t *testing.T) {
 	cms := NewCountMinSketch(0.001, 0.99)
@@ -115,6 +212,81 @@ func TestCMSReset(t *testing.T) {
 	}
 }
 
+// Ensures that InnerProduct estimates the sum of the products of counts and
+// returns an error for mismatched sketches.
+func TestCMSInnerProduct(t *testing.T) {
+	a := NewCountMinSketch(0.001, 0.99)
+	b := NewCountMinSketch(0.001, 0.99)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			a.Add([]byte(strconv.Itoa(i)))
+		}
+		b.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+
+	// a has i+1 of each i, b has 2, so the product is 2 * (1 + ... + 10).
+	product, err := a.InnerProduct(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product != 110 {
+		t.Errorf("Expected 110, got %f", product)
+	}
+
+	if _, err := a.InnerProduct(NewCountMinSketch(0.01, 0.99)); err == nil {
+		t.Error("Expected error for mismatched width")
+	}
+}
+
+// Ensures that a CountMinSketch round-trips through WriteTo and ReadFrom.
+func TestCMSWriteToReadFrom(t *testing.T) {
+	cms := NewCountMinSketch(0.01, 0.99)
+	for i := 0; i < 100; i++ {
+		cms.Add([]byte(strconv.Itoa(i % 10)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := cms.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &CountMinSketch{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.TotalCount() != 100 || other.Epsilon() != 0.01 || other.Delta() != 0.99 {
+		t.Errorf("Expected %s, got %s", cms, other)
+	}
+	if count := other.Count([]byte(`3`)); count != cms.Count([]byte(`3`)) {
+		t.Errorf("Expected %d, got %d", cms.Count([]byte(`3`)), count)
+	}
+}
+
+// Ensures that AddMany and CountMany agree with Add and Count.
+func TestCMSAddManyCountMany(t *testing.T) {
+	cms := NewCountMinSketch(0.001, 0.99)
+	other := NewCountMinSketch(0.001, 0.99)
+	data := make([][]byte, 100)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i % 10))
+		other.Add(data[i])
+	}
+
+	if cms.AddMany(data) != cms {
+		t.Error("Returned CountMinSketch should be the same instance")
+	}
+	if count := cms.TotalCount(); count != 100 {
+		t.Errorf("Expected 100, got %d", count)
+	}
+	counts := cms.CountMany(data[:10])
+	for i, count := range counts {
+		if count != other.Count(data[i]) {
+			t.Errorf("Expected %d, got %d", other.Count(data[i]), count)
+		}
+	}
+}
+
 func BenchmarkCMSAdd(b *testing.B) {
 	b.StopTimer()
 	cms := NewCountMinSketch(0.001, 0.99)
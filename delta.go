@@ -0,0 +1,149 @@
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// deltaPageSize is the number of bytes of buckets tracked as a unit for
+// deltas. Bloom filters are updated at random positions, so small pages keep
+// deltas compact, while the tracking costs one bit per page.
+const deltaPageSize = 64
+
+// EnableDeltas starts recording which parts of the filter change, so that
+// WriteDelta can write only those rather than the whole filter, such as to
+// replicate a large, frequently-updated filter to a standby. Changes are
+// tracked in pages of 64 bytes, at a cost of one bit of memory per page and a
+// check on every bit set. The filter's current contents are the first
+// checkpoint, so the standby must start from a full copy of it, such as one
+// written by WriteTo. ReadFrom and GobDecode stop the tracking.
+func (b *BloomFilter) EnableDeltas() {
+	b.buckets.trackChanges()
+}
+
+// WriteDelta writes the parts of the filter which changed since the last
+// checkpoint to the stream and makes the filter's current contents the next
+// checkpoint. ApplyDelta applies it to a copy of the filter as of the last
+// checkpoint. It returns the number of bytes written and an error if deltas
+// aren't enabled. If writing fails, the changes remain recorded, so the next
+// delta includes them.
+//
+// The delta starts with the filter's count, size, number of hash functions
+// encoded as by WriteTo, and number of changed pages as big-endian uint64s.
+// The index of each changed page follows as a big-endian uint64 with the
+// page's 64 bytes, or fewer for the last page of the filter.
+func (b *BloomFilter) WriteDelta(stream io.Writer) (int64, error) {
+	if b.buckets.dirty == nil {
+		return 0, errors.New("deltas aren't enabled")
+	}
+	pages := b.buckets.dirtyPages()
+	header := []uint64{uint64(b.count), uint64(b.m), b.packedK(), uint64(len(pages))}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	var index [8]byte
+	for _, page := range pages {
+		binary.BigEndian.PutUint64(index[:], uint64(page))
+		n, err := stream.Write(index[:])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		n, err = stream.Write(b.buckets.page(page))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	clear(b.buckets.dirty)
+	return written, nil
+}
+
+// ApplyDelta reads a delta written by WriteDelta from the stream and applies
+// it to the filter, which must be a copy of the writer's filter as of the
+// checkpoint the delta follows. Deltas must be applied in the order they were
+// written. It returns the number of bytes read and an error if the delta is
+// for a filter of a different size, number of hash functions, or indexing
+// scheme. If an error occurs part way, the filter is left partially updated.
+func (b *BloomFilter) ApplyDelta(stream io.Reader) (int64, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+	if header[1] != uint64(b.m) || header[2] != b.packedK() {
+		return read, errors.New("delta is for a different filter")
+	}
+
+	pages := uint64(b.buckets.pages())
+	if header[3] > pages {
+		return read, errors.New("invalid delta page count")
+	}
+	var index [8]byte
+	for i := uint64(0); i < header[3]; i++ {
+		n, err := io.ReadFull(stream, index[:])
+		read += int64(n)
+		if err != nil {
+			return read, err
+		}
+		page := binary.BigEndian.Uint64(index[:])
+		if page >= pages {
+			return read, errors.New("invalid delta page index")
+		}
+		n, err = io.ReadFull(stream, b.buckets.page(uint(page)))
+		read += int64(n)
+		if err != nil {
+			return read, err
+		}
+		b.buckets.markDirty(uint(page)*deltaPageSize, uint(page+1)*deltaPageSize)
+	}
+
+	b.count = uint(header[0])
+	return read, nil
+}
+
+// trackChanges starts recording which pages of the buckets change.
+func (b *Buckets) trackChanges() {
+	if b.dirty == nil {
+		b.dirty = make([]uint64, (b.pages()+63)/64)
+	}
+}
+
+// pages returns the number of pages of buckets tracked for deltas.
+func (b *Buckets) pages() uint {
+	return (uint(len(b.data)) + deltaPageSize - 1) / deltaPageSize
+}
+
+// page returns the bytes of the page of buckets.
+func (b *Buckets) page(page uint) []byte {
+	start := page * deltaPageSize
+	return b.data[start:min(start+deltaPageSize, uint(len(b.data)))]
+}
+
+// markDirty records that the bytes of buckets from start up to end changed,
+// if changes are being tracked.
+func (b *Buckets) markDirty(start, end uint) {
+	if b.dirty == nil || start >= end {
+		return
+	}
+	for page := start / deltaPageSize; page <= (end-1)/deltaPageSize; page++ {
+		b.dirty[page/64] |= 1 << (page % 64)
+	}
+}
+
+// dirtyPages returns the indices of the pages which changed, in order.
+func (b *Buckets) dirtyPages() []uint {
+	var pages []uint
+	for i, word := range b.dirty {
+		for word != 0 {
+			pages = append(pages, uint(i)*64+uint(bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+	return pages
+}
@@ -0,0 +1,86 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// Ensures that applying deltas to a standby copy keeps it equal to the
+// primary, and that deltas only hold the changed pages.
+func TestBloomDelta(t *testing.T) {
+	primary := NewBloomFilter(100000, 0.01)
+	for i := 0; i < 1000; i++ {
+		primary.Add([]byte(strconv.Itoa(i)))
+	}
+	var buf bytes.Buffer
+	if _, err := primary.WriteDelta(&buf); err == nil {
+		t.Error("Expected error when deltas aren't enabled")
+	}
+
+	primary.EnableDeltas()
+	standby, err := primary.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			primary.Add([]byte("round" + strconv.Itoa(round*10+i)))
+		}
+		buf.Reset()
+		n, err := primary.WriteDelta(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if max := int64(32 + 10*int(primary.k)*(8+deltaPageSize)); n > max {
+			t.Errorf("Expected at most %d bytes, got %d", max, n)
+		}
+		if _, err := standby.ApplyDelta(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !standby.Equal(primary) {
+			t.Fatalf("Round %d: expected %s, got %s", round, primary, standby)
+		}
+	}
+
+	// Nothing changed since the last checkpoint.
+	buf.Reset()
+	if n, _ := primary.WriteDelta(&buf); n != 32 {
+		t.Errorf("Expected an empty delta of 32 bytes, got %d", n)
+	}
+
+	// Bulk changes are tracked too.
+	other := NewBloomFilter(100000, 0.01)
+	other.Add([]byte(`merged`))
+	primary.Merge(other)
+	primary.Reset()
+	buf.Reset()
+	primary.WriteDelta(&buf)
+	if _, err := standby.ApplyDelta(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !standby.Equal(primary) {
+		t.Errorf("Expected %s, got %s", primary, standby)
+	}
+
+	buf.Reset()
+	primary.WriteDelta(&buf)
+	if _, err := NewBloomFilter(1000, 0.01).ApplyDelta(&buf); err == nil {
+		t.Error("Expected error for a different filter")
+	}
+}
+
+func BenchmarkBloomWriteDelta(b *testing.B) {
+	f := NewBloomFilter(10000000, 0.01)
+	f.EnableDeltas()
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 100; i++ {
+			f.Add([]byte(strconv.Itoa(n*100 + i)))
+		}
+		buf.Reset()
+		f.WriteDelta(&buf)
+	}
+}
@@ -0,0 +1,106 @@
+package boom
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// BloomFilterDiff describes how one snapshot of a Bloom filter differs from
+// another, such as the same filter on two replicas. It's useful for debugging
+// drift: whether the snapshots can be compared at all, how far apart their
+// counts are, how many bits differ, and roughly how many items each has which
+// the other doesn't.
+type BloomFilterDiff struct {
+	// Compatible is whether the filters have the same size and number of hash
+	// functions. The bit statistics and estimates are only set if they do.
+	Compatible bool
+
+	// CountDelta is the count of the second filter less that of the first.
+	CountDelta int64
+
+	// ChangedBits is the number of bits which differ, SetBits the number set
+	// only in the second filter, and ClearedBits the number set only in the
+	// first.
+	ChangedBits uint
+	SetBits     uint
+	ClearedBits uint
+
+	// EstimatedAdded and EstimatedRemoved are the estimated number of
+	// distinct items in the second filter but not the first, and in the first
+	// but not the second, derived from the number of bits set in each filter
+	// and their union.
+	EstimatedAdded   float64
+	EstimatedRemoved float64
+}
+
+// DiffBloomFilters compares two Bloom filters, typically snapshots of the same
+// filter, and returns how the second differs from the first.
+func DiffBloomFilters(a, b *BloomFilter) *BloomFilterDiff {
+	diff := &BloomFilterDiff{
+		Compatible: a.m == b.m && a.k == b.k && a.extra == b.extra && a.indexing == b.indexing,
+		CountDelta: int64(b.count) - int64(a.count),
+	}
+	if !diff.Compatible {
+		return diff
+	}
+
+	var setA, setB, union uint
+	for i, x := range a.buckets.data {
+		y := b.buckets.data[i]
+		setA += uint(bits.OnesCount8(x))
+		setB += uint(bits.OnesCount8(y))
+		union += uint(bits.OnesCount8(x | y))
+		diff.SetBits += uint(bits.OnesCount8(y &^ x))
+		diff.ClearedBits += uint(bits.OnesCount8(x &^ y))
+	}
+	diff.ChangedBits = diff.SetBits + diff.ClearedBits
+
+	k := a.EffectiveK()
+	nUnion := estimatedCardinality(a.m, k, union)
+	diff.EstimatedAdded = math.Max(0, nUnion-estimatedCardinality(a.m, k, setA))
+	diff.EstimatedRemoved = math.Max(0, nUnion-estimatedCardinality(a.m, k, setB))
+	return diff
+}
+
+// DiffBloomFilterSnapshots reads two Bloom filters in the format written by
+// BloomFilter.WriteTo and compares them with DiffBloomFilters.
+func DiffBloomFilterSnapshots(a, b io.Reader) (*BloomFilterDiff, error) {
+	first := &BloomFilter{}
+	if _, err := first.ReadFrom(a); err != nil {
+		return nil, err
+	}
+	second := &BloomFilter{}
+	if _, err := second.ReadFrom(b); err != nil {
+		return nil, err
+	}
+	return DiffBloomFilters(first, second), nil
+}
+
+// String returns a one-line summary of the BloomFilterDiff for logging and
+// debugging.
+func (d *BloomFilterDiff) String() string {
+	if !d.Compatible {
+		return fmt.Sprintf("BloomFilterDiff{compatible=false count=%+d}", d.CountDelta)
+	}
+	return fmt.Sprintf("BloomFilterDiff{compatible=true count=%+d changed=%d set=%d cleared=%d added~%.0f removed~%.0f}",
+		d.CountDelta, d.ChangedBits, d.SetBits, d.ClearedBits, d.EstimatedAdded, d.EstimatedRemoved)
+}
+
+// EstimatedCardinality returns an estimate of the number of distinct items
+// added to the filter, derived from the number of bits set. Unlike Count, it
+// isn't inflated by duplicate additions or merges of overlapping filters.
+func (b *BloomFilter) EstimatedCardinality() float64 {
+	return estimatedCardinality(b.m, b.EffectiveK(), b.buckets.nonZero())
+}
+
+// estimatedCardinality estimates the number of distinct items in a Bloom
+// filter of m bits and k hash functions with the given number of bits set,
+// -m / k * ln(1 - set / m). A full filter is estimated as holding m items.
+func estimatedCardinality(m uint, k float64, set uint) float64 {
+	if set >= m {
+		return float64(m)
+	}
+	return -float64(m) / k * math.Log1p(-float64(set)/float64(m))
+}
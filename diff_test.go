@@ -0,0 +1,81 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// Ensures that DiffBloomFilters reports the bits which changed and estimates
+// the items added to and removed from each snapshot.
+func TestDiffBloomFilters(t *testing.T) {
+	a := NewBloomFilter(10000, 0.01)
+	b := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 100; i < 1500; i++ {
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+
+	diff := DiffBloomFilters(a, b)
+	if !diff.Compatible {
+		t.Fatal("Expected filters to be compatible")
+	}
+	if diff.CountDelta != 400 {
+		t.Errorf("Expected 400, got %d", diff.CountDelta)
+	}
+	if diff.ChangedBits != diff.SetBits+diff.ClearedBits || diff.SetBits == 0 || diff.ClearedBits == 0 {
+		t.Errorf("Unexpected bit counts %s", diff)
+	}
+	if diff.EstimatedAdded < 450 || diff.EstimatedAdded > 550 {
+		t.Errorf("Expected about 500 added, got %f", diff.EstimatedAdded)
+	}
+	if diff.EstimatedRemoved < 80 || diff.EstimatedRemoved > 120 {
+		t.Errorf("Expected about 100 removed, got %f", diff.EstimatedRemoved)
+	}
+
+	if diff := DiffBloomFilters(a, a); diff.ChangedBits != 0 || diff.EstimatedAdded != 0 {
+		t.Errorf("Expected no difference, got %s", diff)
+	}
+
+	other := NewBloomFilter(100, 0.01)
+	if diff := DiffBloomFilters(a, other); diff.Compatible || diff.ChangedBits != 0 {
+		t.Errorf("Expected incompatible filters, got %s", diff)
+	}
+}
+
+// Ensures that DiffBloomFilterSnapshots compares serialized filters.
+func TestDiffBloomFilterSnapshots(t *testing.T) {
+	a := NewBloomFilter(100, 0.01)
+	b := NewBloomFilter(100, 0.01)
+	b.Add([]byte(`a`))
+
+	var bufA, bufB bytes.Buffer
+	a.WriteTo(&bufA)
+	b.WriteTo(&bufB)
+
+	diff, err := DiffBloomFilterSnapshots(&bufA, &bufB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.CountDelta != 1 || diff.SetBits != b.K() {
+		t.Errorf("Unexpected difference %s", diff)
+	}
+
+	if _, err := DiffBloomFilterSnapshots(&bytes.Buffer{}, &bufB); err == nil {
+		t.Error("Expected error for empty snapshot")
+	}
+}
+
+// Ensures that EstimatedCardinality ignores duplicate additions.
+func TestBloomEstimatedCardinality(t *testing.T) {
+	f := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 3000; i++ {
+		f.Add([]byte(strconv.Itoa(i % 1000)))
+	}
+
+	if n := f.EstimatedCardinality(); n < 950 || n > 1050 {
+		t.Errorf("Expected about 1000, got %f", n)
+	}
+}
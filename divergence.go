@@ -0,0 +1,157 @@
+package boom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Divergence is a key whose frequency in the current window diverges from
+// the baseline.
+type Divergence struct {
+	Data     []byte  // the key
+	Baseline uint64  // estimated count in the baseline
+	Window   uint64  // estimated count in the current window
+	Ratio    float64 // ratio of the key's share of the window to the baseline
+}
+
+// DivergenceDetector detects anomalies in a stream by comparing a current
+// window against a baseline. Items are added to Count-Min Sketches of their
+// frequency and HyperLogLogs of the cardinality for the current window, and
+// Rotate makes the window the baseline for the next one, such as every hour.
+// It then reports keys whose share of the traffic has changed by more than a
+// threshold, the change in cardinality, and the similarity of the windows'
+// overall frequency distributions.
+type DivergenceDetector struct {
+	baseline    *CountMinSketch // frequencies in the baseline
+	window      *CountMinSketch // frequencies in the current window
+	baselineHLL *HyperLogLog    // cardinality of the baseline
+	windowHLL   *HyperLogLog    // cardinality of the current window
+}
+
+// NewDivergenceDetector creates a new DivergenceDetector whose Count-Min
+// Sketches have relative accuracy epsilon with probability delta and whose
+// HyperLogLogs have m registers. Returns an error if m isn't a power of two.
+func NewDivergenceDetector(epsilon, delta float64, m uint) (*DivergenceDetector, error) {
+	baselineHLL, err := NewHyperLogLog(m)
+	if err != nil {
+		return nil, err
+	}
+	windowHLL, err := NewHyperLogLog(m)
+	if err != nil {
+		return nil, err
+	}
+	return &DivergenceDetector{
+		baseline:    NewCountMinSketch(epsilon, delta),
+		window:      NewCountMinSketch(epsilon, delta),
+		baselineHLL: baselineHLL,
+		windowHLL:   windowHLL,
+	}, nil
+}
+
+// Add will add the data to the current window. Returns the DivergenceDetector
+// to allow for chaining.
+func (d *DivergenceDetector) Add(data []byte) *DivergenceDetector {
+	d.window.Add(data)
+	d.windowHLL.Add(data)
+	return d
+}
+
+// Rotate makes the current window the baseline and starts a new, empty
+// window. Returns the DivergenceDetector to allow for chaining.
+func (d *DivergenceDetector) Rotate() *DivergenceDetector {
+	d.baseline, d.window = d.window, d.baseline.Reset()
+	d.baselineHLL, d.windowHLL = d.windowHLL, d.baselineHLL.Reset()
+	return d
+}
+
+// Ratio returns the ratio of the key's share of the current window to its
+// share of the baseline. One means no change, and larger or smaller values
+// mean the key has become more or less frequent relative to the rest of the
+// traffic. Counts are smoothed by one so that keys new to either window give
+// a finite ratio.
+func (d *DivergenceDetector) Ratio(data []byte) float64 {
+	return d.ratio(d.baseline.Count(data), d.window.Count(data))
+}
+
+// Divergent returns the keys whose Ratio is at least threshold or at most its
+// reciprocal, ordered from the most divergent. Keys are checked individually,
+// so candidates, such as the keys seen in the current window or the heavy
+// hitters of either, must be provided.
+func (d *DivergenceDetector) Divergent(keys [][]byte, threshold float64) []*Divergence {
+	divergent := make([]*Divergence, 0)
+	for _, key := range keys {
+		var (
+			baseline = d.baseline.Count(key)
+			window   = d.window.Count(key)
+			ratio    = d.ratio(baseline, window)
+		)
+		if ratio >= threshold || ratio <= 1/threshold {
+			divergent = append(divergent, &Divergence{
+				Data:     key,
+				Baseline: baseline,
+				Window:   window,
+				Ratio:    ratio,
+			})
+		}
+	}
+
+	sort.SliceStable(divergent, func(i, j int) bool {
+		return math.Abs(math.Log(divergent[i].Ratio)) > math.Abs(math.Log(divergent[j].Ratio))
+	})
+	return divergent
+}
+
+// CardinalityRatio returns the ratio of the estimated number of distinct items
+// in the current window to the baseline, or +Inf if the baseline is empty and
+// the window isn't.
+func (d *DivergenceDetector) CardinalityRatio() float64 {
+	baseline, window := d.baselineHLL.Count(), d.windowHLL.Count()
+	if baseline == 0 {
+		if window == 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	return float64(window) / float64(baseline)
+}
+
+// Similarity returns the cosine similarity of the frequency distributions of
+// the current window and the baseline, estimated from the inner products of
+// their Count-Min Sketches. It's near one when the windows have the same mix
+// of keys, whatever their totals, and falls toward zero as they diverge. Since
+// the inner products are overestimates, small differences can be hidden by
+// collisions. Returns zero if either window is empty.
+func (d *DivergenceDetector) Similarity() float64 {
+	// The sketches have the same dimensions, so these can't fail.
+	cross, _ := d.window.InnerProduct(d.baseline)
+	baseline, _ := d.baseline.InnerProduct(d.baseline)
+	window, _ := d.window.InnerProduct(d.window)
+	if baseline == 0 || window == 0 {
+		return 0
+	}
+	return math.Min(1, cross/math.Sqrt(baseline*window))
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// detector's data, the sum of its sketches.
+func (d *DivergenceDetector) ByteSize() uint {
+	return d.baseline.ByteSize() + d.window.ByteSize() + d.baselineHLL.ByteSize() + d.windowHLL.ByteSize()
+}
+
+// String returns a one-line summary of the DivergenceDetector for logging and
+// debugging.
+func (d *DivergenceDetector) String() string {
+	return fmt.Sprintf("DivergenceDetector{baseline=%d window=%d cardinality=%.4g similarity=%.4f}",
+		d.baseline.TotalCount(), d.window.TotalCount(), d.CardinalityRatio(), d.Similarity())
+}
+
+// ratio returns the ratio of the smoothed share of the window to that of the
+// baseline for a key with the specified counts.
+func (d *DivergenceDetector) ratio(baseline, window uint64) float64 {
+	var (
+		baselineShare = float64(baseline+1) / float64(d.baseline.TotalCount()+1)
+		windowShare   = float64(window+1) / float64(d.window.TotalCount()+1)
+	)
+	return windowShare / baselineShare
+}
@@ -0,0 +1,116 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that keys whose share of traffic changes are reported as divergent
+// and that the metrics reflect the change.
+func TestDivergenceDetector(t *testing.T) {
+	d, err := NewDivergenceDetector(0.001, 0.99, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+
+	// The baseline has every key equally often.
+	for n := 0; n < 10; n++ {
+		for _, key := range keys {
+			d.Add(key)
+		}
+	}
+	d.Rotate()
+
+	if ratio := d.CardinalityRatio(); ratio != 0 {
+		t.Errorf("Expected 0, got %f", ratio)
+	}
+
+	// The window is the same, except that `7` spikes and `42` disappears.
+	for n := 0; n < 10; n++ {
+		for _, key := range keys {
+			if string(key) != "42" {
+				d.Add(key)
+			}
+		}
+	}
+	for n := 0; n < 100; n++ {
+		d.Add([]byte(`7`))
+	}
+
+	if ratio := d.Ratio([]byte(`3`)); ratio < 0.8 || ratio > 1.2 {
+		t.Errorf("Expected about 1, got %f", ratio)
+	}
+
+	divergent := d.Divergent(keys, 3)
+	if len(divergent) != 2 {
+		t.Fatalf("Expected 2 divergent keys, got %d", len(divergent))
+	}
+	if string(divergent[0].Data) != "42" || divergent[0].Baseline != 10 || divergent[0].Window != 0 {
+		t.Errorf("Expected `42` to be most divergent, got %+v", divergent[0])
+	}
+	if string(divergent[1].Data) != "7" || divergent[1].Ratio < 3 || divergent[1].Window != 110 {
+		t.Errorf("Expected `7` to be divergent, got %+v", divergent[1])
+	}
+
+	if ratio := d.CardinalityRatio(); ratio < 0.9 || ratio > 1.1 {
+		t.Errorf("Expected about 1, got %f", ratio)
+	}
+
+	if similarity := d.Similarity(); similarity < 0.5 || similarity > 0.95 {
+		t.Errorf("Expected partial similarity, got %f", similarity)
+	}
+}
+
+// Ensures that identical windows are fully similar and nothing diverges.
+func TestDivergenceDetectorStable(t *testing.T) {
+	d, err := NewDivergenceDetector(0.001, 0.99, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if similarity := d.Similarity(); similarity != 0 {
+		t.Errorf("Expected 0 for empty windows, got %f", similarity)
+	}
+
+	keys := make([][]byte, 50)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+	for window := 0; window < 2; window++ {
+		d.Rotate()
+		for i, key := range keys {
+			for n := 0; n <= i; n++ {
+				d.Add(key)
+			}
+		}
+	}
+
+	if similarity := d.Similarity(); similarity < 0.999 {
+		t.Errorf("Expected 1, got %f", similarity)
+	}
+	if divergent := d.Divergent(keys, 1.5); len(divergent) != 0 {
+		t.Errorf("Expected no divergent keys, got %d", len(divergent))
+	}
+
+	if _, err := NewDivergenceDetector(0.001, 0.99, 1000); err == nil {
+		t.Error("Expected error for invalid m")
+	}
+}
+
+func BenchmarkDivergenceAdd(b *testing.B) {
+	b.StopTimer()
+	d, _ := NewDivergenceDetector(0.001, 0.99, 1024)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		d.Add(data[n])
+	}
+}
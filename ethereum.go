@@ -0,0 +1,150 @@
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// EthereumBloomBytes is the size of an Ethereum logs bloom in bytes.
+	EthereumBloomBytes = 256
+
+	// ethereumBloomBits is the size of an Ethereum logs bloom in bits.
+	ethereumBloomBits = EthereumBloomBytes * 8
+)
+
+// EthereumBloom implements the 2048-bit Bloom filter used for the logsBloom
+// field of Ethereum block headers and transaction receipts, as specified in
+// the Ethereum yellow paper:
+//
+// https://ethereum.github.io/yellowpaper/paper.pdf
+//
+// Each item, such as a log's contract address or topic, sets three bits
+// chosen from the first six bytes of its Keccak-256 hash. The filter has a
+// fixed size regardless of how many items are added, and its bits are laid
+// out big-endian so that Bytes returns the 256-byte representation found on
+// chain. This allows chain-indexing services to build blooms and match them
+// against those in block headers.
+type EthereumBloom struct {
+	bits  [EthereumBloomBytes]byte // filter data
+	count uint                     // number of items added
+}
+
+// NewEthereumBloom creates a new, empty Ethereum logs bloom.
+func NewEthereumBloom() *EthereumBloom {
+	return &EthereumBloom{}
+}
+
+// NewEthereumBloomFromBytes creates a new Ethereum logs bloom from its
+// 256-byte representation, such as the logsBloom of a block header. Returns
+// an error if the data isn't 256 bytes.
+func NewEthereumBloomFromBytes(data []byte) (*EthereumBloom, error) {
+	if len(data) != EthereumBloomBytes {
+		return nil, errors.New("ethereum bloom must be 256 bytes")
+	}
+	e := &EthereumBloom{}
+	copy(e.bits[:], data)
+	return e, nil
+}
+
+// Bytes returns the 256-byte representation of the bloom.
+func (e *EthereumBloom) Bytes() []byte {
+	data := make([]byte, EthereumBloomBytes)
+	copy(data, e.bits[:])
+	return data
+}
+
+// Count returns the number of items added to the bloom. It's zero for blooms
+// created from bytes.
+func (e *EthereumBloom) Count() uint {
+	return e.count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (e *EthereumBloom) Test(data []byte) bool {
+	sum := keccak256(data)
+	for i := 0; i < 6; i += 2 {
+		idx, bit := ethereumBloomBit(sum[i:])
+		if e.bits[idx]&bit == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add will add the data to the bloom. It returns the bloom to allow for
+// chaining.
+func (e *EthereumBloom) Add(data []byte) Filter {
+	sum := keccak256(data)
+	for i := 0; i < 6; i += 2 {
+		idx, bit := ethereumBloomBit(sum[i:])
+		e.bits[idx] |= bit
+	}
+	e.count++
+	return e
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (e *EthereumBloom) TestAndAdd(data []byte) bool {
+	sum := keccak256(data)
+	member := true
+	for i := 0; i < 6; i += 2 {
+		idx, bit := ethereumBloomBit(sum[i:])
+		if e.bits[idx]&bit == 0 {
+			member = false
+			e.bits[idx] |= bit
+		}
+	}
+	e.count++
+	return member
+}
+
+// Merge combines this bloom with another by ORing their bits, as when
+// building a block's logsBloom from those of its receipts.
+func (e *EthereumBloom) Merge(other *EthereumBloom) *EthereumBloom {
+	for i, b := range other.bits {
+		e.bits[i] |= b
+	}
+	e.count += other.count
+	return e
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (e *EthereumBloom) ByteSize() uint {
+	return EthereumBloomBytes
+}
+
+// String returns a one-line summary of the EthereumBloom for logging and
+// debugging.
+func (e *EthereumBloom) String() string {
+	return fmt.Sprintf("EthereumBloom{m=%d k=3 count=%d fp=%.4g}",
+		EthereumBloomBytes*8, e.count, estimatedFPRate(EthereumBloomBytes*8, 3, e.count))
+}
+
+// Reset restores the bloom to its original state. It returns the bloom to
+// allow for chaining.
+func (e *EthereumBloom) Reset() *EthereumBloom {
+	e.bits = [EthereumBloomBytes]byte{}
+	e.count = 0
+	return e
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (e *EthereumBloom) Clear() {
+	e.Reset()
+}
+
+// ethereumBloomBit returns the byte index and bit mask selected by the first
+// two bytes of the hash. The low 11 bits index into the filter, counting from
+// the least significant bit of the last byte.
+func ethereumBloomBit(sum []byte) (int, byte) {
+	bit := binary.BigEndian.Uint16(sum) & (ethereumBloomBits - 1)
+	return EthereumBloomBytes - 1 - int(bit/8), 1 << (bit % 8)
+}
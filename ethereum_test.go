@@ -0,0 +1,115 @@
+package boom
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestEthereumBloomTestAndAdd(t *testing.T) {
+	e := NewEthereumBloom()
+
+	if e.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if e.Add([]byte(`a`)) != e {
+		t.Error("Returned EthereumBloom should be the same instance")
+	}
+
+	if !e.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if e.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !e.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := e.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that blooms match the construction used by Ethereum clients.
+func TestEthereumBloomCompatibility(t *testing.T) {
+	e := NewEthereumBloom()
+	for i := 0; i < 100; i++ {
+		e.Add([]byte(fmt.Sprintf("xxxxxxxxxx data %d yyyyyyyyyyyyyy", i)))
+	}
+
+	sum := keccak256(e.Bytes())
+	expected := "c8d3ca65cdb4874300a9e39475508f23ed6da09fdbc487f89a2dcf50b09eb263"
+	if got := hex.EncodeToString(sum[:]); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+// Ensures that blooms can be exported and imported.
+func TestEthereumBloomBytes(t *testing.T) {
+	e := NewEthereumBloom()
+	e.Add([]byte(`a`))
+
+	data := e.Bytes()
+	if len(data) != EthereumBloomBytes {
+		t.Errorf("Expected %d, got %d", EthereumBloomBytes, len(data))
+	}
+
+	other, err := NewEthereumBloomFromBytes(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !other.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if _, err := NewEthereumBloomFromBytes(data[1:]); err == nil {
+		t.Error("Expected error for short data")
+	}
+}
+
+// Ensures that Merge combines the members of both blooms.
+func TestEthereumBloomMerge(t *testing.T) {
+	e := NewEthereumBloom()
+	other := NewEthereumBloom()
+	e.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+
+	if e.Merge(other) != e {
+		t.Error("Returned EthereumBloom should be the same instance")
+	}
+
+	if !e.Test([]byte(`a`)) || !e.Test([]byte(`b`)) {
+		t.Error("Expected `a` and `b` to be members")
+	}
+}
+
+// Ensures that Reset clears the bloom.
+func TestEthereumBloomReset(t *testing.T) {
+	e := NewEthereumBloom()
+	e.Add([]byte(`a`))
+
+	if e.Reset() != e {
+		t.Error("Returned EthereumBloom should be the same instance")
+	}
+
+	if e.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if count := e.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+func BenchmarkEthereumBloomAdd(b *testing.B) {
+	e := NewEthereumBloom()
+	for n := 0; n < b.N; n++ {
+		e.Add([]byte(fmt.Sprint(n)))
+	}
+}
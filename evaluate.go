@@ -0,0 +1,81 @@
+package boom
+
+import "fmt"
+
+// Evaluation is the realized accuracy of a filter over a dataset, as measured
+// by Evaluate.
+type Evaluation struct {
+	// Inserted is the number of keys added and Probed the number of probe
+	// keys tested which weren't among them.
+	Inserted uint
+	Probed   uint
+
+	// FalsePositives is the number of probe keys which tested as members and
+	// FalseNegatives the number of inserted keys which didn't, such as ones
+	// evicted from a StableBloomFilter.
+	FalsePositives uint
+	FalseNegatives uint
+
+	// FPRate and FNRate are the false positives and negatives as fractions of
+	// the keys probed and inserted.
+	FPRate float64
+	FNRate float64
+
+	// FillRatio is the filter's ratio of set bits or non-zero cells after the
+	// keys were added, and EstimatedFPRate its own estimate of its
+	// false-positive rate, or zero if it doesn't report them.
+	FillRatio       float64
+	EstimatedFPRate float64
+}
+
+// Evaluate measures the false-positive and false-negative rates a filter
+// realizes over a real key distribution, so that parameter choices can be
+// validated before they're used in production. It adds the inserted keys to
+// the filter, which should be empty, then tests each probe key which isn't
+// among them and each inserted key. Probe keys which were inserted are
+// skipped, so samples of production traffic can be used as probes as-is.
+func Evaluate(filter Filter, inserted, probes [][]byte) *Evaluation {
+	e := &Evaluation{Inserted: uint(len(inserted))}
+	keys := make(map[string]struct{}, len(inserted))
+	for _, key := range inserted {
+		filter.Add(key)
+		keys[string(key)] = struct{}{}
+	}
+
+	for _, key := range probes {
+		if _, ok := keys[string(key)]; ok {
+			continue
+		}
+		e.Probed++
+		if filter.Test(key) {
+			e.FalsePositives++
+		}
+	}
+	for _, key := range inserted {
+		if !filter.Test(key) {
+			e.FalseNegatives++
+		}
+	}
+
+	if e.Probed > 0 {
+		e.FPRate = float64(e.FalsePositives) / float64(e.Probed)
+	}
+	if e.Inserted > 0 {
+		e.FNRate = float64(e.FalseNegatives) / float64(e.Inserted)
+	}
+	if f, ok := filter.(interface{ FillRatio() float64 }); ok {
+		e.FillRatio = f.FillRatio()
+	}
+	if f, ok := filter.(interface{ EstimateFPRate() float64 }); ok {
+		e.EstimatedFPRate = f.EstimateFPRate()
+	}
+	return e
+}
+
+// String returns a one-line summary of the Evaluation for logging and
+// debugging.
+func (e *Evaluation) String() string {
+	return fmt.Sprintf("Evaluation{inserted=%d probed=%d fp=%d (%.4f) fn=%d (%.4f) fill=%.4f estimated_fp=%.4f}",
+		e.Inserted, e.Probed, e.FalsePositives, e.FPRate, e.FalseNegatives, e.FNRate,
+		e.FillRatio, e.EstimatedFPRate)
+}
@@ -0,0 +1,44 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Evaluate measures a filter's realized false-positive rate,
+// skipping probes which were inserted.
+func TestEvaluate(t *testing.T) {
+	var inserted, probes [][]byte
+	for i := 0; i < 10000; i++ {
+		inserted = append(inserted, []byte("user-"+strconv.Itoa(i)))
+	}
+	for i := 5000; i < 105000; i++ {
+		probes = append(probes, []byte("user-"+strconv.Itoa(i)))
+	}
+
+	e := Evaluate(NewBloomFilter(10000, 0.01), inserted, probes)
+	if e.Inserted != 10000 || e.Probed != 95000 {
+		t.Errorf("Expected 10000 inserted and 95000 probed, got %s", e)
+	}
+	if e.FalseNegatives != 0 || e.FNRate != 0 {
+		t.Errorf("Expected no false negatives, got %s", e)
+	}
+	if e.FPRate == 0 || e.FPRate > 0.02 {
+		t.Errorf("Expected a false-positive rate of about 0.01, got %s", e)
+	}
+	if e.FPRate != float64(e.FalsePositives)/95000 {
+		t.Errorf("Expected rate of %d/95000, got %f", e.FalsePositives, e.FPRate)
+	}
+	if e.FillRatio < 0.4 || e.FillRatio > 0.6 || e.EstimatedFPRate == 0 {
+		t.Errorf("Expected fill ratio of about 0.5 and an estimated rate, got %s", e)
+	}
+
+	// Evictions from a small stable filter show up as false negatives.
+	e = Evaluate(NewDefaultStableBloomFilter(1000, 0.01), inserted, probes)
+	if e.FalseNegatives == 0 {
+		t.Errorf("Expected false negatives, got %s", e)
+	}
+	if e.FillRatio != 0 {
+		t.Errorf("Expected no fill ratio, got %s", e)
+	}
+}
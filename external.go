@@ -0,0 +1,419 @@
+package boom
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// maxExternalChunkBits is the largest chunk of a Bloom filter built at once by
+// an ExternalBuilder, so that offsets within a chunk fit in 32 bits.
+const maxExternalChunkBits = 1 << 32
+
+// ExternalBuilder constructs static filters which are too large to build in
+// memory, such as a Bloom filter of tens of billions of keys. Keys are read
+// once and spilled to temporary files, which are then processed in chunks that
+// fit in a fixed memory budget, so the memory used is independent of the size
+// of the filter. The filter is written to an i/o stream rather than returned.
+//
+// Keys are provided by a function which returns the next key on each call and
+// io.EOF once there are no more.
+type ExternalBuilder struct {
+	dir    string // directory for temporary files
+	memory uint   // bytes of memory to use for chunks
+}
+
+// NewExternalBuilder creates a new ExternalBuilder which writes temporary
+// files to the directory, or the default temporary directory if empty, and
+// processes chunks of up to the specified number of bytes in memory.
+func NewExternalBuilder(dir string, memory uint) *ExternalBuilder {
+	if memory < 8 {
+		memory = 8
+	}
+	return &ExternalBuilder{dir: dir, memory: memory}
+}
+
+// BuildBloomFilter builds a Bloom filter optimized to store n keys with the
+// specified target false-positive rate and writes it to the stream in the
+// format read by BloomFilter.ReadFrom. Keys are hashed with the default hash,
+// which must be the same when the filter is read. It returns the number of
+// bytes written.
+//
+// The bit array is divided into chunks of the memory budget. Each key's bit
+// indices are spilled to the file of the chunk they fall in, and the chunks
+// are then built and written one at a time. The temporary files take four
+// bytes per key per hash function.
+func (e *ExternalBuilder) BuildBloomFilter(stream io.Writer, n uint, fpRate float64,
+	next func() ([]byte, error)) (int64, error) {
+
+	var (
+		m         = uint64(OptimalM(n, fpRate))
+		k         = uint64(OptimalK(fpRate))
+		chunkBits = uint64(e.memory) * 8
+	)
+	if chunkBits > maxExternalChunkBits {
+		chunkBits = maxExternalChunkBits
+	}
+	if chunkBits > m {
+		chunkBits = m
+	}
+
+	spills := make([]*spillFile, (m+chunkBits-1)/chunkBits)
+	defer func() {
+		for _, spill := range spills {
+			if spill != nil {
+				spill.close()
+			}
+		}
+	}()
+	for i := range spills {
+		spill, err := newSpillFile(e.dir)
+		if err != nil {
+			return 0, err
+		}
+		spills[i] = spill
+	}
+
+	// Spill the offset of every bit within its chunk.
+	var (
+		count  = uint64(0)
+		offset = make([]byte, 4)
+		hash   = newDefaultHash()
+	)
+	for {
+		data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		lower, upper := hashKernel(data, hash)
+		for i := uint(0); i < uint(k); i++ {
+			idx := uint64(DoubleHashing.index(lower, upper, i, uint(m)))
+			binary.BigEndian.PutUint32(offset, uint32(idx%chunkBits))
+			if _, err := spills[idx/chunkBits].w.Write(offset); err != nil {
+				return 0, err
+			}
+		}
+		count++
+	}
+
+	w := &countingWriter{w: stream}
+	header := []uint64{count, m, k}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return w.n, err
+	}
+	bucketsHeader := struct {
+		BucketSize uint8
+		Max        uint8
+		Count      uint64
+		Len        uint64
+	}{1, 1, m, (m + 7) / 8}
+	if err := binary.Write(w, binary.BigEndian, bucketsHeader); err != nil {
+		return w.n, err
+	}
+
+	// Build and write each chunk in turn.
+	chunk := make([]byte, (chunkBits+7)/8)
+	for i, spill := range spills {
+		bitCount := chunkBits
+		if rem := m - uint64(i)*chunkBits; rem < bitCount {
+			bitCount = rem
+		}
+		buf := chunk[:(bitCount+7)/8]
+		for j := range buf {
+			buf[j] = 0
+		}
+
+		r, err := spill.reader()
+		if err != nil {
+			return w.n, err
+		}
+		for {
+			if _, err := io.ReadFull(r, offset); err == io.EOF {
+				break
+			} else if err != nil {
+				return w.n, err
+			}
+			bit := binary.BigEndian.Uint32(offset)
+			buf[bit/8] |= 1 << (bit % 8)
+		}
+
+		if _, err := w.Write(buf); err != nil {
+			return w.n, err
+		}
+		spill.close()
+		spills[i] = nil
+	}
+
+	return w.n, nil
+}
+
+// BuildGCSFilter builds a Golomb-coded set of the keys with the provided
+// coding parameter, inverse false-positive rate, and SipHash key and writes it
+// to the stream in the format returned by GCSFilter.Bytes. It returns the
+// number of bytes written. Duplicate keys are only added once.
+//
+// The keys' SipHash values are sorted in runs of the memory budget, which are
+// spilled to temporary files and merged. The temporary files take eight bytes
+// per key, twice over.
+func (e *ExternalBuilder) BuildGCSFilter(stream io.Writer, p uint8, m uint64, key [16]byte,
+	next func() ([]byte, error)) (int64, error) {
+
+	var (
+		k0      = binary.LittleEndian.Uint64(key[:8])
+		k1      = binary.LittleEndian.Uint64(key[8:])
+		runSize = e.memory / 8
+		run     = make([]uint64, 0, runSize)
+		runs    []*spillFile
+	)
+	defer func() {
+		for _, spill := range runs {
+			spill.close()
+		}
+	}()
+
+	// Sort the hashes in runs which fit in memory.
+	flush := func() error {
+		sort.Slice(run, func(i, j int) bool { return run[i] < run[j] })
+		spill, err := newSpillFile(e.dir)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, spill)
+		for _, h := range run {
+			if err := binary.Write(spill.w, binary.BigEndian, h); err != nil {
+				return err
+			}
+		}
+		run = run[:0]
+		return nil
+	}
+	for {
+		data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		run = append(run, sipHash24(k0, k1, data))
+		if uint(len(run)) == runSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+
+	// Merge the runs, dropping duplicates. Mapping hashes onto [0, N*M) is
+	// monotonic, so merged hashes stay sorted once N is known.
+	merged, err := newSpillFile(e.dir)
+	if err != nil {
+		return 0, err
+	}
+	runs = append(runs, merged)
+	n, err := mergeRuns(runs[:len(runs)-1], merged.w)
+	if err != nil {
+		return 0, err
+	}
+
+	w := &countingWriter{w: stream}
+	if _, err := writeCompactSize(w, n); err != nil {
+		return w.n, err
+	}
+
+	r, err := merged.reader()
+	if err != nil {
+		return w.n, err
+	}
+	var (
+		bw   = &streamBitWriter{w: bufio.NewWriter(w)}
+		last = uint64(0)
+	)
+	for i := uint64(0); i < n; i++ {
+		var h uint64
+		if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+			return w.n, err
+		}
+
+		value, _ := bits.Mul64(h, n*m)
+		delta := value - last
+		for q := delta >> p; q > 0; q-- {
+			bw.writeBit(1)
+		}
+		bw.writeBit(0)
+		bw.writeBits(delta, uint(p))
+		last = value
+	}
+	if err := bw.flush(); err != nil {
+		return w.n, err
+	}
+
+	return w.n, nil
+}
+
+// mergeRuns merges the sorted runs of hashes into the writer, dropping
+// duplicates, and returns the number of distinct hashes.
+func mergeRuns(runs []*spillFile, w io.Writer) (uint64, error) {
+	h := &runHeap{}
+	for _, run := range runs {
+		r, err := run.reader()
+		if err != nil {
+			return 0, err
+		}
+		var value uint64
+		if err := binary.Read(r, binary.BigEndian, &value); err == io.EOF {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		heap.Push(h, runHead{value: value, r: r})
+	}
+
+	var (
+		n    = uint64(0)
+		last = uint64(0)
+	)
+	for h.Len() > 0 {
+		head := (*h)[0]
+		if n == 0 || head.value != last {
+			if err := binary.Write(w, binary.BigEndian, head.value); err != nil {
+				return n, err
+			}
+			last = head.value
+			n++
+		}
+
+		err := binary.Read(head.r, binary.BigEndian, &(*h)[0].value)
+		switch {
+		case err == io.EOF:
+			heap.Pop(h)
+		case err != nil:
+			return n, err
+		default:
+			heap.Fix(h, 0)
+		}
+	}
+
+	return n, nil
+}
+
+// runHead is the next hash of a sorted run being merged.
+type runHead struct {
+	value uint64
+	r     io.Reader
+}
+
+// runHeap is a min-heap of runs ordered by their next hash.
+type runHeap []runHead
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].value < h[j].value }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(runHead)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// spillFile is a temporary file which is written sequentially and then read
+// back.
+type spillFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// newSpillFile creates a new temporary file in the directory.
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "boom-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// reader flushes the data written and returns a reader from the start of the
+// file.
+func (s *spillFile) reader() (io.Reader, error) {
+	if err := s.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(s.f), nil
+}
+
+// close closes and removes the file.
+func (s *spillFile) close() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamBitWriter writes a stream of bits, most significant bit first, to a
+// buffered writer.
+type streamBitWriter struct {
+	w   *bufio.Writer
+	cur byte  // bits of the current byte
+	n   uint  // number of bits in the current byte
+	err error // first error writing
+}
+
+// writeBit appends a single bit.
+func (s *streamBitWriter) writeBit(bit uint64) {
+	if bit != 0 {
+		s.cur |= 0x80 >> s.n
+	}
+	s.n++
+	if s.n == 8 {
+		if err := s.w.WriteByte(s.cur); err != nil && s.err == nil {
+			s.err = err
+		}
+		s.cur, s.n = 0, 0
+	}
+}
+
+// writeBits appends the low count bits of the value, most significant first.
+func (s *streamBitWriter) writeBits(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		s.writeBit(value >> (i - 1) & 1)
+	}
+}
+
+// flush writes any partial byte, padded with zeros, and flushes the writer.
+func (s *streamBitWriter) flush() error {
+	if s.n > 0 {
+		if err := s.w.WriteByte(s.cur); err != nil && s.err == nil {
+			s.err = err
+		}
+		s.cur, s.n = 0, 0
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
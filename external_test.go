@@ -0,0 +1,141 @@
+package boom
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+// keySource returns a function which returns the keys in turn and then
+// io.EOF.
+func keySource(keys [][]byte) func() ([]byte, error) {
+	i := 0
+	return func() ([]byte, error) {
+		if i == len(keys) {
+			return nil, io.EOF
+		}
+		i++
+		return keys[i-1], nil
+	}
+}
+
+// Ensures that BuildBloomFilter writes the same filter as building it in
+// memory, across many chunks.
+func TestExternalBuildBloomFilter(t *testing.T) {
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+
+	expected := NewBloomFilter(uint(len(keys)), 0.01)
+	for _, key := range keys {
+		expected.Add(key)
+	}
+
+	var buf bytes.Buffer
+	builder := NewExternalBuilder(t.TempDir(), 1000)
+	written, err := builder.BuildBloomFilter(&buf, uint(len(keys)), 0.01, keySource(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), written)
+	}
+
+	f := &BloomFilter{}
+	if _, err := f.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Capacity() != expected.Capacity() || f.K() != expected.K() || f.Count() != expected.Count() {
+		t.Errorf("Expected %s, got %s", expected, f)
+	}
+
+	if !bytes.Equal(f.buckets.data, expected.buckets.data) {
+		t.Error("Expected filter data to match the in-memory filter")
+	}
+}
+
+// Ensures that BuildBloomFilter hashes with the default hash, so the filter
+// it writes has no false negatives when read after SetDefaultHash.
+func TestExternalBuildBloomFilterDefaultHash(t *testing.T) {
+	SetDefaultHash(NewXXHash)
+	defer SetDefaultHash(nil)
+
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+
+	var buf bytes.Buffer
+	builder := NewExternalBuilder(t.TempDir(), 800)
+	if _, err := builder.BuildBloomFilter(&buf, uint(len(keys)), 0.01, keySource(keys)); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &BloomFilter{}
+	if _, err := f.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if !f.Test(key) {
+			t.Errorf("Expected %s to be a member", key)
+		}
+	}
+}
+
+// Ensures that BuildGCSFilter writes the same filter as building it in
+// memory, merging many runs and dropping duplicates.
+func TestExternalBuildGCSFilter(t *testing.T) {
+	var key [16]byte
+	copy(key[:], "0123456789abcdef")
+
+	keys := make([][]byte, 5000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i % 4000))
+	}
+
+	expected := NewGCSFilter(BIP158P, BIP158M, key, keys)
+
+	var buf bytes.Buffer
+	builder := NewExternalBuilder(t.TempDir(), 800)
+	written, err := builder.BuildGCSFilter(&buf, BIP158P, BIP158M, key, keySource(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), written)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Error("Expected filter to match the in-memory filter")
+	}
+
+	f, err := NewGCSFilterFromBytes(BIP158P, BIP158M, key, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.N(); n != 4000 {
+		t.Errorf("Expected 4000, got %d", n)
+	}
+	if !f.Match([]byte(`42`)) {
+		t.Error("`42` should be a member")
+	}
+}
+
+// Ensures that BuildGCSFilter handles an empty set of keys.
+func TestExternalBuildGCSFilterEmpty(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		key [16]byte
+	)
+	builder := NewExternalBuilder(t.TempDir(), 800)
+	if _, err := builder.BuildGCSFilter(&buf, BIP158P, BIP158M, key, keySource(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), []byte{0}) {
+		t.Errorf("Expected 00, got %x", buf.Bytes())
+	}
+}
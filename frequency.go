@@ -0,0 +1,191 @@
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// maxFrequencySketchCapacity is the largest capacity of a
+	// FrequencySketch.
+	maxFrequencySketchCapacity = 1 << 30
+
+	// frequencyResetMask clears the high bit of each 4-bit counter after the
+	// counters are shifted right by one.
+	frequencyResetMask = 0x7777777777777777
+
+	// frequencyOneMask selects the low bit of each 4-bit counter.
+	frequencyOneMask = 0x1111111111111111
+
+	// maxFrequency is the value at which 4-bit counters saturate.
+	maxFrequency = 15
+)
+
+// FrequencySketch is a compact Count-Min Sketch of 4-bit counters which ages
+// its counts, as used by the Caffeine cache for TinyLFU admission:
+//
+// https://github.com/ben-manes/caffeine/wiki/Efficiency
+//
+// Each item is counted in four counters, packed sixteen to a 64-bit word, and
+// its frequency is estimated by the minimum of them. Counters saturate at 15,
+// which is enough to compare the popularity of cache entries. Once the number
+// of increments reaches the sample size, ten times the capacity, every
+// counter is halved, so the sketch reflects recent accesses rather than
+// all-time totals and popular items which fall out of use are forgotten.
+//
+// A FrequencySketch uses 8 bytes per entry of capacity, rounded up to a power
+// of two, far less than a CountMinSketch of 64-bit counters of the same
+// accuracy. It is not safe for concurrent use.
+type FrequencySketch struct {
+	table      []uint64    // 4-bit counters, sixteen to a word
+	sampleSize uint64      // increments between halvings
+	size       uint64      // increments since the last halving
+	hash       hash.Hash64 // hash function (kernel for all counters)
+}
+
+// NewFrequencySketch creates a new FrequencySketch sized for a cache of the
+// provided capacity. Its counters are halved every 10 * capacity increments.
+func NewFrequencySketch(capacity uint) *FrequencySketch {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if capacity > maxFrequencySketchCapacity {
+		capacity = maxFrequencySketchCapacity
+	}
+	return &FrequencySketch{
+		table:      make([]uint64, 1<<bits.Len(capacity-1)),
+		sampleSize: 10 * uint64(capacity),
+		hash:       newDefaultHash(),
+	}
+}
+
+// NewFrequencySketchE is like NewFrequencySketch but returns an error if
+// capacity is zero or greater than 2^30.
+func NewFrequencySketchE(capacity uint) (*FrequencySketch, error) {
+	if capacity == 0 {
+		return nil, errors.New("capacity must be positive")
+	}
+	if capacity > maxFrequencySketchCapacity {
+		return nil, fmt.Errorf("capacity must be at most %d", maxFrequencySketchCapacity)
+	}
+	return NewFrequencySketch(capacity), nil
+}
+
+// SampleSize returns the number of increments after which the counters are
+// halved.
+func (f *FrequencySketch) SampleSize() uint64 {
+	return f.sampleSize
+}
+
+// SetHash sets the hashing function used in the sketch.
+func (f *FrequencySketch) SetHash(h hash.Hash64) {
+	f.hash = h
+}
+
+// Increment counts an occurrence of the data, halving every counter if the
+// sample size has been reached. It returns the FrequencySketch to allow for
+// chaining.
+func (f *FrequencySketch) Increment(data []byte) *FrequencySketch {
+	base, start := f.base(data)
+
+	added := false
+	for i := uint32(0); i < 4; i++ {
+		if f.incrementAt(f.word(base, i), start+i) {
+			added = true
+		}
+	}
+
+	if added {
+		f.size++
+		if f.size >= f.sampleSize {
+			f.halve()
+		}
+	}
+	return f
+}
+
+// Frequency returns the estimated number of occurrences of the data, at most
+// 15. Occurrences before the counters were last halved count for half as
+// much. Like a Count-Min Sketch, it may overestimate but never
+// underestimates.
+func (f *FrequencySketch) Frequency(data []byte) uint8 {
+	base, start := f.base(data)
+
+	frequency := uint8(maxFrequency)
+	for i := uint32(0); i < 4; i++ {
+		count := uint8(f.table[f.word(base, i)]>>((start+i)<<2)) & maxFrequency
+		if count < frequency {
+			frequency = count
+		}
+	}
+	return frequency
+}
+
+// Reset restores the FrequencySketch to its original state. It returns itself
+// to allow for chaining.
+func (f *FrequencySketch) Reset() *FrequencySketch {
+	for i := range f.table {
+		f.table[i] = 0
+	}
+	f.size = 0
+	return f
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's counters.
+func (f *FrequencySketch) ByteSize() uint {
+	return uint(len(f.table)) * 8
+}
+
+// String returns a one-line summary of the FrequencySketch for logging and
+// debugging.
+func (f *FrequencySketch) String() string {
+	return fmt.Sprintf("FrequencySketch{counters=%d sample=%d size=%d}",
+		uint64(len(f.table))*16, f.sampleSize, f.size)
+}
+
+// base returns the base hash of the data and the offset within each word of
+// its first counter. Its four counters are at consecutive offsets, so each is
+// in a different position of its word.
+func (f *FrequencySketch) base(data []byte) (uint64, uint32) {
+	lower, upper := hashKernel(data, f.hash)
+	base := uint64(upper)<<32 | uint64(lower)
+	return base, uint32(fmix64(base)&3) << 2
+}
+
+// word returns the index of the word holding the ith counter of an item. Each
+// word is picked by mixing the base hash with a per-counter offset, rather
+// than the linear combination used by filters, since the hashes of similar
+// short keys are correlated and would otherwise share most of their counters.
+func (f *FrequencySketch) word(base uint64, i uint32) uint64 {
+	return fmix64(base+uint64(i+1)*0x9e3779b97f4a7c15) & uint64(len(f.table)-1)
+}
+
+// incrementAt increments the counter at the offset within the word, unless
+// it's saturated. It returns whether the counter was incremented.
+func (f *FrequencySketch) incrementAt(word uint64, offset uint32) bool {
+	shift := offset << 2
+	if (f.table[word]>>shift)&maxFrequency == maxFrequency {
+		return false
+	}
+	f.table[word] += 1 << shift
+	return true
+}
+
+// halve divides every counter by two. The size is reduced by the increments
+// lost to rounding as well as halved, so the next halving happens after
+// roughly half a sample.
+func (f *FrequencySketch) halve() {
+	odd := 0
+	for i, word := range f.table {
+		odd += bits.OnesCount64(word & frequencyOneMask)
+		f.table[i] = (word >> 1) & frequencyResetMask
+	}
+	if lost := uint64(odd >> 2); lost < f.size {
+		f.size = (f.size - lost) >> 1
+	} else {
+		f.size = 0
+	}
+}
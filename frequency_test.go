@@ -0,0 +1,130 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Frequency estimates the number of increments and saturates at
+// 15.
+func TestFrequencySketchFrequency(t *testing.T) {
+	f := NewFrequencySketch(1000)
+	if len(f.table) != 1024 || f.SampleSize() != 10000 {
+		t.Errorf("Expected 1024 words and a sample size of 10000, got %d and %d", len(f.table), f.SampleSize())
+	}
+
+	if freq := f.Frequency([]byte(`a`)); freq != 0 {
+		t.Errorf("Expected frequency 0, got %d", freq)
+	}
+	for i := 1; i <= 20; i++ {
+		if f.Increment([]byte(`a`)) != f {
+			t.Error("Returned FrequencySketch should be the same instance")
+		}
+		expected := uint8(i)
+		if i > maxFrequency {
+			expected = maxFrequency
+		}
+		if freq := f.Frequency([]byte(`a`)); freq != expected {
+			t.Errorf("Expected frequency %d, got %d", expected, freq)
+		}
+	}
+	if f.size != maxFrequency {
+		t.Errorf("Expected saturated increments not to count, got size %d", f.size)
+	}
+
+	f.Reset()
+	if freq := f.Frequency([]byte(`a`)); freq != 0 || f.size != 0 {
+		t.Errorf("Expected frequency 0 after Reset, got %d", freq)
+	}
+}
+
+// Ensures that every counter is halved once the sample size is reached.
+func TestFrequencySketchAging(t *testing.T) {
+	f := NewFrequencySketch(64)
+	for i := 0; i < 10; i++ {
+		f.Increment([]byte(`hot`))
+	}
+	for i := 0; i < 3; i++ {
+		f.Increment([]byte(`warm`))
+	}
+
+	for i := 0; f.size < f.SampleSize()-1; i++ {
+		f.Increment([]byte(strconv.Itoa(i)))
+	}
+	hot, warm := f.Frequency([]byte(`hot`)), f.Frequency([]byte(`warm`))
+	f.Increment([]byte(`trigger`))
+
+	if freq := f.Frequency([]byte(`hot`)); freq != hot/2 {
+		t.Errorf("Expected frequency %d after aging, got %d", hot/2, freq)
+	}
+	if freq := f.Frequency([]byte(`warm`)); freq != warm/2 {
+		t.Errorf("Expected frequency %d after aging, got %d", warm/2, freq)
+	}
+	if f.size >= f.SampleSize()/2 {
+		t.Errorf("Expected the size to be at most halved, got %d", f.size)
+	}
+}
+
+// Ensures that frequent items are estimated as more frequent than rare ones
+// despite collisions.
+func TestFrequencySketchAccuracy(t *testing.T) {
+	f := NewFrequencySketch(512)
+	for i := 0; i < 5000; i++ {
+		key := []byte(strconv.Itoa(i % 1000))
+		f.Increment(key)
+		if i%1000 < 10 {
+			for j := 0; j < 4; j++ {
+				f.Increment(key)
+			}
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		hot := f.Frequency([]byte(strconv.Itoa(i)))
+		cold := f.Frequency([]byte(strconv.Itoa(500 + i)))
+		if hot <= cold {
+			t.Errorf("Expected %d to be more frequent than %d, got %d and %d", i, 500+i, hot, cold)
+		}
+	}
+}
+
+// Ensures that NewFrequencySketchE returns an error for invalid capacities.
+func TestNewFrequencySketchE(t *testing.T) {
+	for _, capacity := range []uint{0, maxFrequencySketchCapacity + 1} {
+		if _, err := NewFrequencySketchE(capacity); err == nil {
+			t.Errorf("Expected an error for capacity %d", capacity)
+		}
+	}
+	if f, err := NewFrequencySketchE(100); err != nil || len(f.table) != 128 {
+		t.Errorf("Expected a sketch of 128 words, got %v", err)
+	}
+}
+
+func BenchmarkFrequencySketchIncrement(b *testing.B) {
+	b.StopTimer()
+	f := NewFrequencySketch(10000)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 50000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Increment(data[n])
+	}
+}
+
+func BenchmarkFrequencySketchFrequency(b *testing.B) {
+	b.StopTimer()
+	f := NewFrequencySketch(10000)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 50000))
+		f.Increment(data[i])
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Frequency(data[n])
+	}
+}
@@ -0,0 +1,184 @@
+package boom
+
+import (
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// fnv64Type is the type of the hash returned by fnv.New64.
+var fnv64Type = reflect.TypeOf(fnv.New64())
+
+// FrozenBloomFilter is an immutable, read-optimized snapshot of a BloomFilter
+// created with Freeze. Its bits are packed into 64-bit words and it hashes
+// without any shared state, so it's safe for any number of concurrent readers
+// without locking. This suits filters which are built offline and then served.
+type FrozenBloomFilter struct {
+	words    []uint64                 // filter data, one bit per index
+	sum      func(data []byte) uint64 // stateless hash function
+	m        uint                     // filter size
+	k        uint                     // number of hash functions
+	extra    uint32                   // probability of an extra hash function
+	indexing Indexing                 // index derivation scheme
+	count    uint                     // number of items added
+}
+
+// Freeze returns an immutable FrozenBloomFilter with the contents of the
+// filter. Later changes to the filter don't affect the frozen copy. FNV-1 and
+// hashes returned by NewXXHash, NewSipHash, or NewMapHash are computed without
+// shared state. Other hashes set with SetHash are cloned for each concurrent
+// reader, or if they can't be cloned, shared with the filter under a lock, in
+// which case the filter mustn't be used concurrently with the frozen copy.
+func (b *BloomFilter) Freeze() *FrozenBloomFilter {
+	sum := frozenSum(b.hash)
+	words := make([]uint64, (b.m+63)/64)
+	for i := uint(0); i < b.m; i++ {
+		if b.buckets.Get(i) != 0 {
+			words[i/64] |= 1 << (i % 64)
+		}
+	}
+	return &FrozenBloomFilter{
+		words:    words,
+		sum:      sum,
+		m:        b.m,
+		k:        b.k,
+		extra:    b.extra,
+		indexing: b.indexing,
+		count:    b.count,
+	}
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (f *FrozenBloomFilter) Capacity() uint {
+	return f.m
+}
+
+// K returns the number of hash functions.
+func (f *FrozenBloomFilter) K() uint {
+	return f.k
+}
+
+// Count returns the number of items added to the filter before it was frozen.
+func (f *FrozenBloomFilter) Count() uint {
+	return f.count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives. It's safe to call concurrently.
+func (f *FrozenBloomFilter) Test(data []byte) bool {
+	sum := f.sum(data)
+	lower, upper := uint32(sum), uint32(sum>>32)
+	k := f.k
+	if f.extra != 0 && uint32(fmix64(sum)) < f.extra {
+		k++
+	}
+
+	// If any of the K bits are not set, then it's not a member.
+	for i := uint(0); i < k; i++ {
+		idx := f.indexing.index(lower, upper, i, f.m)
+		if f.words[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// frozenSum returns a function which computes the same 64-bit sum as the hash
+// and is safe to call concurrently. Sums without shared state are used where
+// possible, then a pool of clones of the hash, then the hash under a lock.
+func frozenSum(h hash.Hash64) func(data []byte) uint64 {
+	if sum := statelessSum(h); sum != nil {
+		return sum
+	}
+
+	// The pool clones its own copy, which is never written to, so that cloning
+	// is safe while the filter's hash is in use.
+	if clone, err := copyHash64(h); err == nil {
+		if _, err := copyHash64(clone); err == nil {
+			pool := &sync.Pool{New: func() interface{} {
+				hasher, _ := copyHash64(clone)
+				return hasher
+			}}
+			return func(data []byte) uint64 {
+				hasher := pool.Get().(hash.Hash64)
+				lower, upper := hashKernel(data, hasher)
+				pool.Put(hasher)
+				return uint64(upper)<<32 | uint64(lower)
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	return func(data []byte) uint64 {
+		mu.Lock()
+		defer mu.Unlock()
+		lower, upper := hashKernel(data, h)
+		return uint64(upper)<<32 | uint64(lower)
+	}
+}
+
+// statelessSum returns a function which computes the same 64-bit sum as the
+// hash without sharing any state between calls, or nil if there's none.
+func statelessSum(h hash.Hash64) func(data []byte) uint64 {
+	if sum := mapHashSum(h); sum != nil {
+		return sum
+	}
+	if reflect.TypeOf(h) == fnv64Type {
+		return fnv64
+	}
+	if _, ok := h.(*xxHash); ok {
+		return xxHash64[[]byte]
+	}
+	if sip, ok := h.(*sipHash); ok {
+		k0, k1 := sip.k0, sip.k1
+		return func(data []byte) uint64 {
+			return sipHash24(k0, k1, data)
+		}
+	}
+	return nil
+}
+
+// fnv64 returns the 64-bit FNV-1 hash of the data. It matches the hash.Hash64
+// returned by fnv.New64 without allocating or sharing state between calls.
+func fnv64(data []byte) uint64 {
+	hash := uint64(fnvOffset64)
+	for _, c := range data {
+		hash *= fnvPrime64
+		hash ^= uint64(c)
+	}
+	return hash
+}
+
+// fnv64String returns the 64-bit FNV-1 hash of the string, as fnv64 would for
+// its bytes, without converting it to a byte slice.
+func fnv64String(data string) uint64 {
+	hash := uint64(fnvOffset64)
+	for i := 0; i < len(data); i++ {
+		hash *= fnvPrime64
+		hash ^= uint64(data[i])
+	}
+	return hash
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (f *FrozenBloomFilter) ByteSize() uint {
+	return uint(len(f.words)) * 8
+}
+
+// String returns a one-line summary of the FrozenBloomFilter for logging and
+// debugging.
+func (f *FrozenBloomFilter) String() string {
+	return fmt.Sprintf("FrozenBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		f.m, f.k, f.count, estimatedFPRate(f.m, f.k, f.count))
+}
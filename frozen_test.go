@@ -0,0 +1,92 @@
+package boom
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Ensures that fnv64 matches the hash/fnv implementation.
+func TestFNV64(t *testing.T) {
+	for _, data := range []string{"", "a", "foobar", "the quick brown fox"} {
+		h := fnv.New64()
+		h.Write([]byte(data))
+		if sum := fnv64([]byte(data)); sum != h.Sum64() {
+			t.Errorf("Expected %d, got %d", h.Sum64(), sum)
+		}
+	}
+}
+
+// Ensures that a frozen filter answers the same as the filter it was created
+// from and doesn't change with it.
+func TestBloomFreeze(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	frozen := f.Freeze()
+
+	if capacity := frozen.Capacity(); capacity != f.Capacity() {
+		t.Errorf("Expected %d, got %d", f.Capacity(), capacity)
+	}
+
+	if k := frozen.K(); k != f.K() {
+		t.Errorf("Expected %d, got %d", f.K(), k)
+	}
+
+	if count := frozen.Count(); count != 1000 {
+		t.Errorf("Expected 1000, got %d", count)
+	}
+
+	for i := 0; i < 5000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if frozen.Test(data) != f.Test(data) {
+			t.Errorf("Expected frozen filter to agree for `%s`", data)
+		}
+	}
+
+	f.Add([]byte(`a`))
+	if frozen.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+}
+
+// Ensures that a frozen filter can be tested concurrently.
+func TestBloomFreezeConcurrent(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	frozen := f.Freeze()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if !frozen.Test([]byte(strconv.Itoa(i))) {
+					t.Errorf("`%d` should be a member", i)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkFrozenBloomTest(b *testing.B) {
+	b.StopTimer()
+	f := NewBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	frozen := f.Freeze()
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		frozen.Test(data[n])
+	}
+}
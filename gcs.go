@@ -0,0 +1,283 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// BIP158P is the Golomb-Rice coding parameter of BIP-158 basic filters.
+	BIP158P = 19
+
+	// BIP158M is the inverse false-positive rate of BIP-158 basic filters.
+	BIP158M = 784931
+)
+
+// GCSFilter implements a Golomb-coded set as used by Bitcoin's compact block
+// filters, specified by BIP-158:
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0158.mediawiki
+//
+// Each element is hashed with SipHash-2-4 under a 128-bit key and mapped
+// uniformly onto [0, N*M), where N is the number of elements and 1/M is the
+// false-positive rate. The sorted hashes are delta encoded and the deltas are
+// Golomb-Rice coded with parameter P, which takes close to the theoretical
+// minimum of space for a static set. Filters are immutable once built, and
+// queries decode the set sequentially.
+//
+// BIP-158 basic filters use P = 19 and M = 784931, and are keyed with the
+// first 16 bytes of the block hash. Bytes returns the serialized filter found
+// in cfilter messages, so filters are interoperable with Bitcoin nodes.
+type GCSFilter struct {
+	data []byte // Golomb-Rice coded deltas
+	n    uint64 // number of elements
+	p    uint8  // Golomb-Rice coding parameter
+	m    uint64 // inverse false-positive rate
+	k0   uint64 // first half of the SipHash key
+	k1   uint64 // second half of the SipHash key
+}
+
+// NewGCSFilter creates a new Golomb-coded set of the elements with the
+// provided coding parameter, inverse false-positive rate, and SipHash key.
+// Duplicate elements are only added once.
+func NewGCSFilter(p uint8, m uint64, key [16]byte, elements [][]byte) *GCSFilter {
+	g := &GCSFilter{
+		p:  p,
+		m:  m,
+		k0: binary.LittleEndian.Uint64(key[:8]),
+		k1: binary.LittleEndian.Uint64(key[8:]),
+	}
+
+	unique := make(map[string]struct{}, len(elements))
+	for _, element := range elements {
+		unique[string(element)] = struct{}{}
+	}
+	g.n = uint64(len(unique))
+
+	hashes := make([]uint64, 0, len(unique))
+	for element := range unique {
+		hashes = append(hashes, g.hashToRange([]byte(element)))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+
+	w := &bitWriter{}
+	last := uint64(0)
+	for _, h := range hashes {
+		delta := h - last
+		for q := delta >> p; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		w.writeBits(delta, uint(p))
+		last = h
+	}
+	g.data = w.bytes()
+
+	return g
+}
+
+// NewBIP158Filter creates a new BIP-158 basic filter of the elements keyed
+// with the first 16 bytes of the block hash, in internal byte order.
+func NewBIP158Filter(key [16]byte, elements [][]byte) *GCSFilter {
+	return NewGCSFilter(BIP158P, BIP158M, key, elements)
+}
+
+// NewGCSFilterFromBytes creates a Golomb-coded set from its serialized form,
+// as returned by Bytes, with the provided coding parameter, inverse
+// false-positive rate, and SipHash key. Returns an error if the data is
+// malformed.
+func NewGCSFilterFromBytes(p uint8, m uint64, key [16]byte, data []byte) (*GCSFilter, error) {
+	r := bytes.NewReader(data)
+	n, _, err := readCompactSize(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(data))*8 {
+		return nil, errors.New("invalid gcs element count")
+	}
+
+	return &GCSFilter{
+		data: data[len(data)-r.Len():],
+		n:    n,
+		p:    p,
+		m:    m,
+		k0:   binary.LittleEndian.Uint64(key[:8]),
+		k1:   binary.LittleEndian.Uint64(key[8:]),
+	}, nil
+}
+
+// N returns the number of elements in the set.
+func (g *GCSFilter) N() uint {
+	return uint(g.n)
+}
+
+// Bytes returns the serialized filter, which is the number of elements as a
+// Bitcoin variable-length integer followed by the coded deltas.
+func (g *GCSFilter) Bytes() []byte {
+	var buf bytes.Buffer
+	writeCompactSize(&buf, g.n)
+	buf.Write(g.data)
+	return buf.Bytes()
+}
+
+// Match will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (g *GCSFilter) Match(data []byte) bool {
+	target := g.hashToRange(data)
+	r := &bitReader{data: g.data}
+	value := uint64(0)
+	for i := uint64(0); i < g.n; i++ {
+		delta, err := g.readDelta(r)
+		if err != nil {
+			return false
+		}
+		value += delta
+		if value == target {
+			return true
+		}
+		if value > target {
+			return false
+		}
+	}
+	return false
+}
+
+// MatchAny will test whether any of the data is a member and returns true if
+// one is, false if not. It decodes the set once, so it's faster than calling
+// Match for each query.
+func (g *GCSFilter) MatchAny(data [][]byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	targets := make([]uint64, len(data))
+	for i, d := range data {
+		targets[i] = g.hashToRange(d)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	r := &bitReader{data: g.data}
+	value, t := uint64(0), 0
+	for i := uint64(0); i < g.n; i++ {
+		delta, err := g.readDelta(r)
+		if err != nil {
+			return false
+		}
+		value += delta
+
+		for targets[t] < value {
+			t++
+			if t == len(targets) {
+				return false
+			}
+		}
+		if targets[t] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hashToRange maps the data uniformly onto [0, N*M).
+func (g *GCSFilter) hashToRange(data []byte) uint64 {
+	hi, _ := bits.Mul64(sipHash24(g.k0, g.k1, data), g.n*g.m)
+	return hi
+}
+
+// readDelta decodes the next Golomb-Rice coded delta.
+func (g *GCSFilter) readDelta(r *bitReader) (uint64, error) {
+	q := uint64(0)
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			break
+		}
+		q++
+	}
+
+	rem, err := r.readBits(uint(g.p))
+	if err != nil {
+		return 0, err
+	}
+	return q<<g.p | rem, nil
+}
+
+// bitWriter writes a stream of bits, most significant bit first.
+type bitWriter struct {
+	data []byte
+	n    uint // number of bits written
+}
+
+// writeBit appends a single bit.
+func (w *bitWriter) writeBit(bit uint64) {
+	if w.n%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	if bit != 0 {
+		w.data[len(w.data)-1] |= 0x80 >> (w.n % 8)
+	}
+	w.n++
+}
+
+// writeBits appends the low count bits of the value, most significant first.
+func (w *bitWriter) writeBits(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit(value >> (i - 1) & 1)
+	}
+}
+
+// bytes returns the bits written, padded with zeros to a whole byte.
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+// bitReader reads a stream of bits, most significant bit first.
+type bitReader struct {
+	data []byte
+	n    uint // number of bits read
+}
+
+// readBit returns the next bit.
+func (r *bitReader) readBit() (uint64, error) {
+	if r.n/8 >= uint(len(r.data)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	bit := uint64(r.data[r.n/8]>>(7-r.n%8)) & 1
+	r.n++
+	return bit, nil
+}
+
+// readBits returns the next count bits as an integer.
+func (r *bitReader) readBits(count uint) (uint64, error) {
+	value := uint64(0)
+	for i := uint(0); i < count; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | bit
+	}
+	return value, nil
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (g *GCSFilter) ByteSize() uint {
+	return uint(len(g.data))
+}
+
+// String returns a one-line summary of the GCSFilter for logging and debugging.
+func (g *GCSFilter) String() string {
+	return fmt.Sprintf("GCSFilter{n=%d p=%d m=%d bytes=%d fp=%.4g}",
+		g.n, g.p, g.m, len(g.data), 1/float64(g.m))
+}
@@ -0,0 +1,108 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"testing"
+)
+
+// Ensures that filters match the BIP-158 test vector for the testnet genesis
+// block.
+func TestBIP158Genesis(t *testing.T) {
+	var key [16]byte
+	hash, _ := hex.DecodeString("43497fd7f826957108f4a30fd9cec3aeba79972084e90ead01ea330900000000")
+	copy(key[:], hash)
+
+	script, _ := hex.DecodeString("4104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac")
+	g := NewBIP158Filter(key, [][]byte{script})
+
+	if got := hex.EncodeToString(g.Bytes()); got != "019dfca8" {
+		t.Errorf("Expected 019dfca8, got %s", got)
+	}
+
+	if !g.Match(script) {
+		t.Error("Expected script to match")
+	}
+
+	parsed, err := NewGCSFilterFromBytes(BIP158P, BIP158M, key, g.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !parsed.Match(script) {
+		t.Error("Expected script to match parsed filter")
+	}
+}
+
+// Ensures that Match and MatchAny find every element and few others.
+func TestGCSMatch(t *testing.T) {
+	key := [16]byte{1, 2, 3}
+	elements := make([][]byte, 1000)
+	for i := range elements {
+		elements[i] = []byte(strconv.Itoa(i))
+	}
+	// Duplicates are only added once.
+	g := NewGCSFilter(10, 1000, key, append(elements, elements[0]))
+
+	if n := g.N(); n != 1000 {
+		t.Errorf("Expected 1000, got %d", n)
+	}
+
+	for _, element := range elements {
+		if !g.Match(element) {
+			t.Errorf("Expected `%s` to match", element)
+		}
+	}
+
+	fp := 0
+	for i := 1000; i < 11000; i++ {
+		if g.Match([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if fp > 30 {
+		t.Errorf("Expected at most 30 false positives, got %d", fp)
+	}
+
+	if !g.MatchAny([][]byte{[]byte(`x`), []byte(`500`), []byte(`y`)}) {
+		t.Error("Expected `500` to match")
+	}
+
+	if g.MatchAny([][]byte{[]byte(`x`), []byte(`y`)}) {
+		t.Error("Expected no match")
+	}
+
+	if g.MatchAny(nil) {
+		t.Error("Expected no match")
+	}
+
+	empty := NewGCSFilter(10, 1000, key, nil)
+	if !bytes.Equal(empty.Bytes(), []byte{0}) || empty.Match([]byte(`a`)) {
+		t.Error("Expected empty filter to match nothing")
+	}
+}
+
+// Ensures that malformed filters are rejected.
+func TestGCSFromBytesInvalid(t *testing.T) {
+	if _, err := NewGCSFilterFromBytes(BIP158P, BIP158M, [16]byte{}, nil); err == nil {
+		t.Error("Expected error for empty data")
+	}
+
+	if _, err := NewGCSFilterFromBytes(BIP158P, BIP158M, [16]byte{}, []byte{0x50}); err == nil {
+		t.Error("Expected error for invalid element count")
+	}
+}
+
+func BenchmarkGCSMatch(b *testing.B) {
+	b.StopTimer()
+	elements := make([][]byte, 1000)
+	for i := range elements {
+		elements[i] = []byte(strconv.Itoa(i))
+	}
+	g := NewBIP158Filter([16]byte{}, elements)
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		g.Match([]byte(strconv.Itoa(n)))
+	}
+}
@@ -0,0 +1,268 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// GuavaStrategy is the strategy a Guava Bloom filter uses to derive its
+// indices from an item's hash, which is the ordinal of Guava's
+// BloomFilterStrategies enum.
+type GuavaStrategy int8
+
+const (
+	// GuavaMurmur128Mitz32 derives the indices from the first 64 bits of the
+	// hash using 32-bit arithmetic. It's only used by filters created before
+	// Guava 13.
+	GuavaMurmur128Mitz32 GuavaStrategy = iota
+
+	// GuavaMurmur128Mitz64 derives the indices from both halves of the hash
+	// using 64-bit arithmetic. It's the default.
+	GuavaMurmur128Mitz64
+)
+
+// GuavaBloomFilter implements Google Guava's BloomFilter, so Go services can
+// load filters produced by JVM batch jobs with BloomFilter.writeTo, or produce
+// filters for them to read with BloomFilter.readFrom.
+//
+// Items are hashed with the 128-bit x64 MurmurHash3 of the bytes Guava's
+// funnel writes, so the data must be those bytes: the bytes themselves for
+// Funnels.byteArrayFunnel, the UTF-8 encoding for Funnels.stringFunnel with
+// UTF-8, or eight little-endian bytes for Funnels.longFunnel. Filters are
+// sized as Guava sizes them, and the bit set is a whole number of 64-bit
+// words.
+type GuavaBloomFilter struct {
+	data     []uint64      // filter data
+	k        uint          // number of hash functions
+	count    uint          // number of items added
+	strategy GuavaStrategy // index derivation
+}
+
+// NewGuavaBloomFilter creates a new Guava Bloom filter optimized to store n
+// items with a specified target false-positive rate, as BloomFilter.create
+// does, using the default strategy.
+func NewGuavaBloomFilter(n uint, fpRate float64) *GuavaBloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	if fpRate == 0 {
+		fpRate = math.SmallestNonzeroFloat64
+	}
+	bits := uint(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := uint(math.Round(float64(bits) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &GuavaBloomFilter{
+		data:     make([]uint64, (bits+63)/64),
+		k:        k,
+		strategy: GuavaMurmur128Mitz64,
+	}
+}
+
+// ReadGuavaBloomFilter reads a Guava Bloom filter, such as one written by
+// BloomFilter.writeTo, from an i/o stream.
+func ReadGuavaBloomFilter(stream io.Reader) (*GuavaBloomFilter, error) {
+	g := &GuavaBloomFilter{}
+	if _, err := g.ReadFrom(stream); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (g *GuavaBloomFilter) Capacity() uint {
+	return uint(len(g.data)) * 64
+}
+
+// K returns the number of hash functions.
+func (g *GuavaBloomFilter) K() uint {
+	return g.k
+}
+
+// Strategy returns the strategy the filter derives its indices with.
+func (g *GuavaBloomFilter) Strategy() GuavaStrategy {
+	return g.strategy
+}
+
+// Count returns the number of items added to the filter. It's zero for
+// filters read with ReadFrom.
+func (g *GuavaBloomFilter) Count() uint {
+	return g.count
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (g *GuavaBloomFilter) Test(data []byte) bool {
+	member := true
+	g.locations(data, func(idx uint64) {
+		if g.data[idx>>6]&(1<<(idx&63)) == 0 {
+			member = false
+		}
+	})
+	return member
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (g *GuavaBloomFilter) Add(data []byte) Filter {
+	g.locations(data, func(idx uint64) {
+		g.data[idx>>6] |= 1 << (idx & 63)
+	})
+	g.count++
+	return g
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (g *GuavaBloomFilter) TestAndAdd(data []byte) bool {
+	member := true
+	g.locations(data, func(idx uint64) {
+		if g.data[idx>>6]&(1<<(idx&63)) == 0 {
+			member = false
+			g.data[idx>>6] |= 1 << (idx & 63)
+		}
+	})
+	g.count++
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (g *GuavaBloomFilter) ByteSize() uint {
+	return uint(len(g.data)) * 8
+}
+
+// String returns a one-line summary of the GuavaBloomFilter for logging and
+// debugging.
+func (g *GuavaBloomFilter) String() string {
+	return fmt.Sprintf("GuavaBloomFilter{m=%d k=%d count=%d strategy=%d}",
+		g.Capacity(), g.k, g.count, g.strategy)
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (g *GuavaBloomFilter) Reset() *GuavaBloomFilter {
+	for i := range g.data {
+		g.data[i] = 0
+	}
+	g.count = 0
+	return g
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (g *GuavaBloomFilter) Clear() {
+	g.Reset()
+}
+
+// WriteTo writes the filter to an i/o stream in Guava's serialized form: the
+// strategy and number of hash functions as bytes and the number of words as a
+// big-endian int followed by the words as big-endian longs. It returns the
+// number of bytes written.
+func (g *GuavaBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	buf := make([]byte, 6, 6+len(g.data)*8)
+	buf[0] = byte(g.strategy)
+	buf[1] = byte(g.k)
+	binary.BigEndian.PutUint32(buf[2:], uint32(len(g.data)))
+	for _, word := range g.data {
+		buf = binary.BigEndian.AppendUint64(buf, word)
+	}
+	n, err := stream.Write(buf)
+	return int64(n), err
+}
+
+// ReadFrom reads a filter in Guava's serialized form (such as might have been
+// written by WriteTo() or BloomFilter.writeTo) from an i/o stream. It returns
+// the number of bytes read.
+func (g *GuavaBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]byte, 6)
+	n, err := io.ReadFull(stream, header)
+	read := int64(n)
+	if err != nil {
+		return read, err
+	}
+
+	var (
+		strategy = GuavaStrategy(header[0])
+		k        = uint(header[1])
+		words    = int32(binary.BigEndian.Uint32(header[2:]))
+	)
+	if strategy != GuavaMurmur128Mitz32 && strategy != GuavaMurmur128Mitz64 {
+		return read, fmt.Errorf("unknown guava strategy %d", strategy)
+	}
+	if words < 0 {
+		return read, errors.New("invalid guava filter dimensions")
+	}
+
+	// The words are read as they arrive rather than allocated up front, so a
+	// forged count can't allocate more memory than the stream holds.
+	var buf bytes.Buffer
+	copied, err := io.CopyN(&buf, stream, int64(words)*8)
+	read += copied
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return read, err
+	}
+
+	data := make([]uint64, words)
+	for i := range data {
+		data[i] = binary.BigEndian.Uint64(buf.Bytes()[i*8:])
+	}
+	g.data = data
+	g.k = k
+	g.strategy = strategy
+	g.count = 0
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (g *GuavaBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := g.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (g *GuavaBloomFilter) GobDecode(data []byte) error {
+	_, err := g.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// locations calls fn with each of the K indices of the data, derived with the
+// filter's strategy using Java's signed arithmetic.
+func (g *GuavaBloomFilter) locations(data []byte, fn func(idx uint64)) {
+	if len(g.data) == 0 {
+		return
+	}
+	h1, h2 := murmur3Sum128(0, data, false)
+	bits := int64(len(g.data)) * 64
+
+	if g.strategy == GuavaMurmur128Mitz32 {
+		hash1, hash2 := int32(h1), int32(h1>>32)
+		for i := int32(1); i <= int32(g.k); i++ {
+			combined := hash1 + i*hash2
+			if combined < 0 {
+				combined = ^combined
+			}
+			fn(uint64(int64(combined) % bits))
+		}
+		return
+	}
+
+	combined := int64(h1)
+	for i := uint(0); i < g.k; i++ {
+		fn(uint64((combined & math.MaxInt64) % bits))
+		combined += int64(h2)
+	}
+}
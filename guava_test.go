@@ -0,0 +1,138 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// Ensures that filters are sized as Guava sizes them.
+func TestGuavaCapacity(t *testing.T) {
+	f := NewGuavaBloomFilter(100, 0.01)
+
+	if capacity := f.Capacity(); capacity != 960 {
+		t.Errorf("Expected 960, got %d", capacity)
+	}
+
+	if k := f.K(); k != 7 {
+		t.Errorf("Expected 7, got %d", k)
+	}
+}
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestGuavaTestAndAdd(t *testing.T) {
+	f := NewGuavaBloomFilter(100, 0.01)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned GuavaBloomFilter should be the same instance")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that the filter sets the bits Guava would, using Guava's
+// murmur3_128 of "hello", 029bbd41b3a7d8cb191dae486a901e5b.
+func TestGuavaIndices(t *testing.T) {
+	var (
+		h1 = int64(-0x3427584cbe4264fe) // 0xcbd8a7b341bd9b02
+		h2 = int64(0x5b1e906a48ae1d19)
+	)
+
+	f := NewGuavaBloomFilter(10, 0.1)
+	f.Add([]byte("hello"))
+	bits := int64(f.Capacity())
+	combined := h1
+	for i := uint(0); i < f.K(); i++ {
+		idx := (combined & 0x7fffffffffffffff) % bits
+		if f.data[idx/64]&(1<<uint(idx%64)) == 0 {
+			t.Errorf("Expected bit %d to be set", idx)
+		}
+		combined += h2
+	}
+
+	f = &GuavaBloomFilter{data: make([]uint64, 2), k: 3, strategy: GuavaMurmur128Mitz32}
+	f.Add([]byte("hello"))
+	hash1, hash2 := int32(h1), int32(h1>>32)
+	for i := int32(1); i <= 3; i++ {
+		combined := hash1 + i*hash2
+		if combined < 0 {
+			combined = ^combined
+		}
+		idx := combined % 128
+		if f.data[idx/64]&(1<<uint(idx%64)) == 0 {
+			t.Errorf("Expected bit %d to be set", idx)
+		}
+	}
+}
+
+// Ensures that filters round-trip through Guava's serialized form.
+func TestGuavaWriteToReadFrom(t *testing.T) {
+	f := NewGuavaBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || n != 6+15*8 {
+		t.Errorf("Expected %d bytes, got %d", 6+15*8, n)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte{1, 7, 0, 0, 0, 15}) {
+		t.Errorf("Unexpected header %x", buf.Bytes()[:6])
+	}
+
+	other, err := ReadGuavaBloomFilter(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Capacity() != f.Capacity() || other.K() != f.K() || other.Strategy() != GuavaMurmur128Mitz64 {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+	for i := 0; i < 100; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	if _, err := ReadGuavaBloomFilter(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+	data := append([]byte{2}, buf.Bytes()[1:]...)
+	if _, err := ReadGuavaBloomFilter(bytes.NewReader(data)); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+	if _, err := ReadGuavaBloomFilter(bytes.NewReader([]byte{1, 7, 0x7f, 0xff, 0xff, 0xff})); err == nil {
+		t.Error("Expected error for a word count larger than the data")
+	}
+}
+
+func BenchmarkGuavaAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewGuavaBloomFilter(100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
@@ -0,0 +1,334 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// HierarchicalCountMinSketch implements a dyadic hierarchy of Count-Min
+// Sketches over integer keys as described by Cormode and Muthukrishnan in An
+// Improved Data Stream Summary: The Count-Min Sketch and its Applications:
+//
+// http://dimacs.rutgers.edu/~graham/pubs/papers/cm-full.pdf
+//
+// Level l of the hierarchy counts the prefixes of keys with their low l bits
+// removed, so it answers point queries for the dyadic ranges of size 2^l. Any
+// range of keys is the union of at most two dyadic ranges per level, which
+// makes range counts, such as the hits for an IP prefix or a time range,
+// cost O(log U) point queries. Levels with no more distinct prefixes than a
+// sketch row has counters are counted exactly.
+//
+// The hierarchy also finds heavy hitters by drilling down from the top level,
+// only expanding prefixes whose count meets the threshold.
+type HierarchicalCountMinSketch struct {
+	sketches []*CountMinSketch // sketch for each level, nil if exact
+	exact    [][]uint64        // exact counts for each level, nil if sketched
+	bits     uint              // number of bits in a key
+	count    uint64            // number of items added
+	buffer   []byte            // buffer used to encode prefixes
+}
+
+// NewHierarchicalCountMinSketch creates a new HierarchicalCountMinSketch for
+// keys of the provided number of bits, at most 64, whose levels have a
+// relative accuracy within a factor of epsilon with probability delta.
+func NewHierarchicalCountMinSketch(epsilon, delta float64, bits uint8) *HierarchicalCountMinSketch {
+	if bits > 64 {
+		bits = 64
+	}
+
+	width, _ := OptimalCMSWidthDepth(epsilon, delta)
+	h := &HierarchicalCountMinSketch{
+		sketches: make([]*CountMinSketch, bits+1),
+		exact:    make([][]uint64, bits+1),
+		bits:     uint(bits),
+		buffer:   make([]byte, 8),
+	}
+	for l := uint(0); l <= h.bits; l++ {
+		if h.bits-l < 64 && uint64(1)<<(h.bits-l) <= uint64(width) {
+			h.exact[l] = make([]uint64, 1<<(h.bits-l))
+		} else {
+			h.sketches[l] = NewCountMinSketch(epsilon, delta)
+		}
+	}
+	return h
+}
+
+// TotalCount returns the number of items added to the sketch.
+func (h *HierarchicalCountMinSketch) TotalCount() uint64 {
+	return h.count
+}
+
+// Add will add the key to the sketch. Bits of the key beyond the configured
+// number are ignored. Returns the HierarchicalCountMinSketch to allow for
+// chaining.
+func (h *HierarchicalCountMinSketch) Add(key uint64) *HierarchicalCountMinSketch {
+	key = h.mask(key)
+	for l := uint(0); l <= h.bits; l++ {
+		prefix := key >> l
+		if h.exact[l] != nil {
+			h.exact[l][prefix]++
+		} else {
+			h.sketches[l].Add(h.encode(prefix))
+		}
+	}
+	h.count++
+	return h
+}
+
+// Count returns the approximate count for the key.
+func (h *HierarchicalCountMinSketch) Count(key uint64) uint64 {
+	return h.prefixCount(h.mask(key), 0)
+}
+
+// RangeCount returns the approximate total count of the keys in the range
+// [lo, hi].
+func (h *HierarchicalCountMinSketch) RangeCount(lo, hi uint64) uint64 {
+	lo, hi = h.mask(lo), h.mask(hi)
+	if lo > hi {
+		return 0
+	}
+
+	// Cover the range with maximal dyadic intervals, starting from lo.
+	count := uint64(0)
+	for {
+		l := uint(0)
+		for l < h.bits && lo&(1<<(l+1)-1) == 0 && hi-lo >= 1<<(l+1)-1 {
+			l++
+		}
+		count += h.prefixCount(lo>>l, l)
+
+		end := lo + (1<<l - 1)
+		if l == 64 || end >= hi {
+			return count
+		}
+		lo = end + 1
+	}
+}
+
+// HeavyHitters returns the prefixes at the provided level whose approximate
+// count is at least the threshold, in ascending order. Level zero returns
+// keys, and level l returns keys with their low l bits removed, such as /24
+// networks for IPv4 addresses at level 8.
+func (h *HierarchicalCountMinSketch) HeavyHitters(threshold uint64, level uint) []uint64 {
+	hitters := []uint64{}
+	if level > h.bits || threshold == 0 || h.count < threshold {
+		return hitters
+	}
+
+	// Drill down from the top, only expanding heavy prefixes.
+	candidates := []uint64{0}
+	for l := h.bits; l > level; l-- {
+		next := []uint64{}
+		for _, prefix := range candidates {
+			for _, child := range []uint64{prefix << 1, prefix<<1 | 1} {
+				if h.prefixCount(child, l-1) >= threshold {
+					next = append(next, child)
+				}
+			}
+		}
+		candidates = next
+	}
+
+	hitters = append(hitters, candidates...)
+	sort.Slice(hitters, func(i, j int) bool { return hitters[i] < hitters[j] })
+	return hitters
+}
+
+// Merge combines this HierarchicalCountMinSketch with another. Returns an
+// error if the key sizes or sketch dimensions are not equal.
+func (h *HierarchicalCountMinSketch) Merge(other *HierarchicalCountMinSketch) error {
+	if h.bits != other.bits {
+		return errors.New("key size must match")
+	}
+
+	for l := uint(0); l <= h.bits; l++ {
+		if len(h.exact[l]) != len(other.exact[l]) {
+			return errors.New("matrix width must match")
+		}
+		if h.sketches[l] != nil {
+			if h.sketches[l].width != other.sketches[l].width {
+				return errors.New("matrix width must match")
+			}
+			if h.sketches[l].depth != other.sketches[l].depth {
+				return errors.New("matrix depth must match")
+			}
+		}
+	}
+
+	for l := uint(0); l <= h.bits; l++ {
+		if h.exact[l] != nil {
+			for i, c := range other.exact[l] {
+				h.exact[l][i] += c
+			}
+		} else {
+			h.sketches[l].Merge(other.sketches[l])
+		}
+	}
+
+	h.count += other.count
+	return nil
+}
+
+// WriteTo writes a binary representation of the HierarchicalCountMinSketch to
+// an i/o stream. It returns the number of bytes written.
+func (h *HierarchicalCountMinSketch) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(h.bits), h.count}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	// Each level is the number of exact counts followed by them, or zero
+	// followed by its sketch.
+	for l, sketch := range h.sketches {
+		exact := h.exact[l]
+		if err := binary.Write(stream, binary.BigEndian, uint64(len(exact))); err != nil {
+			return written, err
+		}
+		written += 8
+
+		if sketch != nil {
+			n, err := sketch.WriteTo(stream)
+			written += n
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+		if err := binary.Write(stream, binary.BigEndian, exact); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(exact))
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a HierarchicalCountMinSketch (such
+// as might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (h *HierarchicalCountMinSketch) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 2)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[0] > 64 {
+		return read, errors.New("invalid hierarchical count-min sketch dimensions")
+	}
+	var (
+		sketches = make([]*CountMinSketch, header[0]+1)
+		exact    = make([][]uint64, header[0]+1)
+	)
+	for l := range sketches {
+		var length uint64
+		if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+			return read, err
+		}
+		read += 8
+
+		if length == 0 {
+			sketches[l] = &CountMinSketch{}
+			n, err := sketches[l].ReadFrom(stream)
+			read += n
+			if err != nil {
+				return read, err
+			}
+			continue
+		}
+		if bits := header[0] - uint64(l); bits >= 64 || length != 1<<bits {
+			return read, errors.New("invalid hierarchical count-min sketch dimensions")
+		}
+		counts, n, err := readWords(stream, length)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		exact[l] = counts
+	}
+
+	h.sketches = sketches
+	h.exact = exact
+	h.bits = uint(header[0])
+	h.count = header[1]
+	h.buffer = make([]byte, 8)
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (h *HierarchicalCountMinSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (h *HierarchicalCountMinSketch) GobDecode(data []byte) error {
+	_, err := h.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's data, the sum of its levels.
+func (h *HierarchicalCountMinSketch) ByteSize() uint {
+	size := uint(0)
+	for i, sketch := range h.sketches {
+		if sketch != nil {
+			size += sketch.ByteSize()
+		} else {
+			size += uint(len(h.exact[i])) * 8
+		}
+	}
+	return size
+}
+
+// String returns a one-line summary of the HierarchicalCountMinSketch for
+// logging and debugging.
+func (h *HierarchicalCountMinSketch) String() string {
+	return fmt.Sprintf("HierarchicalCountMinSketch{bits=%d levels=%d count=%d}",
+		h.bits, len(h.sketches), h.count)
+}
+
+// Reset restores the HierarchicalCountMinSketch to its original state. It
+// returns itself to allow for chaining.
+func (h *HierarchicalCountMinSketch) Reset() *HierarchicalCountMinSketch {
+	for l := uint(0); l <= h.bits; l++ {
+		if h.exact[l] != nil {
+			for i := range h.exact[l] {
+				h.exact[l][i] = 0
+			}
+		} else {
+			h.sketches[l].Reset()
+		}
+	}
+	h.count = 0
+	return h
+}
+
+// prefixCount returns the approximate count for the prefix at the level.
+func (h *HierarchicalCountMinSketch) prefixCount(prefix uint64, level uint) uint64 {
+	if h.exact[level] != nil {
+		return h.exact[level][prefix]
+	}
+	return h.sketches[level].Count(h.encode(prefix))
+}
+
+// mask returns the key with bits beyond the configured number cleared.
+func (h *HierarchicalCountMinSketch) mask(key uint64) uint64 {
+	if h.bits == 64 {
+		return key
+	}
+	return key & (1<<h.bits - 1)
+}
+
+// encode returns the byte representation of the prefix.
+func (h *HierarchicalCountMinSketch) encode(prefix uint64) []byte {
+	binary.BigEndian.PutUint64(h.buffer, prefix)
+	return h.buffer
+}
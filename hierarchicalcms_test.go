@@ -0,0 +1,191 @@
+package boom
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Ensures that Add, Count, and TotalCount behave correctly.
+func TestHierarchicalCMSAddAndCount(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+
+	if h.Add(1) != h {
+		t.Error("Returned HierarchicalCountMinSketch should be the same instance")
+	}
+	h.Add(1).Add(2).Add(1 << 31)
+
+	if count := h.Count(1); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	if count := h.Count(3); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	// Bits beyond the key size are ignored.
+	if count := h.Count(1<<32 | 1); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	if count := h.TotalCount(); count != 4 {
+		t.Errorf("Expected 4, got %d", count)
+	}
+}
+
+// Ensures that RangeCount approximates the total count of keys in a range.
+func TestHierarchicalCMSRangeCount(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+	rng := rand.New(rand.NewSource(1))
+	keys := make([]uint64, 10000)
+	for i := range keys {
+		keys[i] = uint64(rng.Uint32())
+		h.Add(keys[i])
+	}
+
+	if count := h.RangeCount(0, 1<<32-1); count != 10000 {
+		t.Errorf("Expected 10000, got %d", count)
+	}
+
+	if count := h.RangeCount(10, 5); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	for i := 0; i < 20; i++ {
+		lo := uint64(rng.Uint32())
+		hi := lo + uint64(rng.Intn(1<<30))
+		if hi >= 1<<32 {
+			hi = 1<<32 - 1
+		}
+
+		actual := uint64(0)
+		for _, key := range keys {
+			if key >= lo && key <= hi {
+				actual++
+			}
+		}
+
+		// Each of the up to 64 intervals overestimates by at most
+		// epsilon * total count with high probability.
+		count := h.RangeCount(lo, hi)
+		if count < actual || count > actual+640 {
+			t.Errorf("Expected about %d for [%d, %d], got %d", actual, lo, hi, count)
+		}
+	}
+
+	full := NewHierarchicalCountMinSketch(0.01, 0.99, 64)
+	full.Add(1 << 63).Add(5)
+	if count := full.RangeCount(0, 1<<64-1); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that HeavyHitters finds the keys and prefixes meeting a threshold.
+func TestHierarchicalCMSHeavyHitters(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		h.Add(uint64(rng.Uint32()))
+	}
+	for i := 0; i < 500; i++ {
+		h.Add(0x0a000001)
+		h.Add(0x0a000002)
+		h.Add(0xc0a80101)
+	}
+
+	if hitters := h.HeavyHitters(400, 0); !reflect.DeepEqual(hitters, []uint64{0x0a000001, 0x0a000002, 0xc0a80101}) {
+		t.Errorf("Expected three heavy hitters, got %x", hitters)
+	}
+
+	if hitters := h.HeavyHitters(900, 8); !reflect.DeepEqual(hitters, []uint64{0x0a0000}) {
+		t.Errorf("Expected one heavy /24, got %x", hitters)
+	}
+
+	if hitters := h.HeavyHitters(1000000, 0); len(hitters) != 0 {
+		t.Errorf("Expected no heavy hitters, got %x", hitters)
+	}
+}
+
+// Ensures that Merge combines the two sketches.
+func TestHierarchicalCMSMerge(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 16)
+	other := NewHierarchicalCountMinSketch(0.001, 0.99, 16)
+	h.Add(1).Add(2)
+	other.Add(2).Add(3)
+
+	if err := h.Merge(other); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if count := h.RangeCount(1, 3); count != 4 {
+		t.Errorf("Expected 4, got %d", count)
+	}
+
+	if err := h.Merge(NewHierarchicalCountMinSketch(0.001, 0.99, 32)); err == nil {
+		t.Error("Expected error for mismatched key size")
+	}
+}
+
+// Ensures that Reset restores the sketch to its original state.
+func TestHierarchicalCMSReset(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+	h.Add(1).Add(1 << 20)
+
+	if h.Reset() != h {
+		t.Error("Returned HierarchicalCountMinSketch should be the same instance")
+	}
+
+	if count := h.RangeCount(0, 1<<32-1); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	if count := h.TotalCount(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that a HierarchicalCountMinSketch round-trips through WriteTo and
+// ReadFrom.
+func TestHierarchicalCMSWriteToReadFrom(t *testing.T) {
+	h := NewHierarchicalCountMinSketch(0.01, 0.99, 16)
+	for key := uint64(0); key < 1000; key++ {
+		h.Add(key % 100)
+	}
+
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &HierarchicalCountMinSketch{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.TotalCount() != h.TotalCount() {
+		t.Errorf("Expected %d, got %d", h.TotalCount(), other.TotalCount())
+	}
+	if count := other.RangeCount(10, 50); count != h.RangeCount(10, 50) {
+		t.Errorf("Expected %d, got %d", h.RangeCount(10, 50), count)
+	}
+}
+
+func BenchmarkHierarchicalCMSAdd(b *testing.B) {
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+	for n := 0; n < b.N; n++ {
+		h.Add(uint64(n))
+	}
+}
+
+func BenchmarkHierarchicalCMSRangeCount(b *testing.B) {
+	b.StopTimer()
+	h := NewHierarchicalCountMinSketch(0.001, 0.99, 32)
+	for i := 0; i < 100000; i++ {
+		h.Add(uint64(i) * 40000)
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		h.RangeCount(uint64(n), uint64(n)+1<<20)
+	}
+}
@@ -0,0 +1,134 @@
+package boom
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// hybridEntrySize is the approximate memory used by each front element in
+// bytes, excluding the element itself: a map entry and a list element.
+const hybridEntrySize = 8 * pointerSize
+
+// HybridFilter combines a small exact set of the most recently seen elements
+// with a probabilistic filter for the long tail. The front is an LRU set, so
+// hot elements are answered exactly, with no false positives or false
+// negatives. When the front is full, the least recently seen element is
+// demoted to the backstop filter, and an element found in the backstop is
+// promoted back to the front.
+//
+// Since the front absorbs repeated additions of hot elements, the backstop
+// only holds the tail of the distribution and fills more slowly. For Zipfian
+// workloads, such as deduplicating events where a few keys dominate, this
+// gives better practical accuracy than either an exact set of the same size or
+// the backstop alone. A Stable Bloom Filter backstop bounds memory for
+// unbounded streams, while a classic Bloom filter avoids false negatives.
+type HybridFilter struct {
+	front    map[string]*list.Element // exact set of recent elements
+	recency  *list.List               // front elements, most recent first
+	capacity uint                     // maximum number of front elements
+	back     Filter                   // filter of demoted elements
+}
+
+// NewHybridFilter creates a new HybridFilter which holds up to capacity
+// elements exactly and demotes the rest to the backstop filter.
+func NewHybridFilter(capacity uint, back Filter) *HybridFilter {
+	return &HybridFilter{
+		front:    make(map[string]*list.Element, capacity),
+		recency:  list.New(),
+		capacity: capacity,
+		back:     back,
+	}
+}
+
+// NewDefaultHybridFilter creates a new HybridFilter which holds up to capacity
+// elements exactly, backed by a Stable Bloom Filter with m cells and the
+// target false-positive rate.
+func NewDefaultHybridFilter(capacity, m uint, fpRate float64) *HybridFilter {
+	return NewHybridFilter(capacity, NewDefaultStableBloomFilter(m, fpRate))
+}
+
+// Capacity returns the maximum number of elements held exactly.
+func (h *HybridFilter) Capacity() uint {
+	return h.capacity
+}
+
+// FrontLen returns the number of elements currently held exactly.
+func (h *HybridFilter) FrontLen() uint {
+	return uint(h.recency.Len())
+}
+
+// Back returns the backstop filter.
+func (h *HybridFilter) Back() Filter {
+	return h.back
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. Elements held exactly are always reported correctly,
+// while the rest are subject to the backstop's error rates. Testing an
+// element doesn't change its recency.
+func (h *HybridFilter) Test(data []byte) bool {
+	if _, ok := h.front[string(data)]; ok {
+		return true
+	}
+	return h.back.Test(data)
+}
+
+// Add will add the data to the front, demoting the least recently seen
+// element to the backstop if the front is full. It returns the filter to
+// allow for chaining.
+func (h *HybridFilter) Add(data []byte) Filter {
+	h.promote(data)
+	return h
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not. An element found in the backstop is
+// promoted to the front.
+func (h *HybridFilter) TestAndAdd(data []byte) bool {
+	return h.promote(data)
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including the front elements and the backstop if it reports
+// its size.
+func (h *HybridFilter) ByteSize() uint {
+	size := byteSize(h.back)
+	for data := range h.front {
+		size += uint(len(data)) + hybridEntrySize
+	}
+	return size
+}
+
+// String returns a one-line summary of the HybridFilter for logging and
+// debugging.
+func (h *HybridFilter) String() string {
+	return fmt.Sprintf("HybridFilter{capacity=%d front=%d back=%v}",
+		h.capacity, h.recency.Len(), h.back)
+}
+
+// promote moves the data to the front of the recency list, demoting the least
+// recent element if the front is full. It returns true if the data was
+// already a member.
+func (h *HybridFilter) promote(data []byte) bool {
+	if e, ok := h.front[string(data)]; ok {
+		h.recency.MoveToFront(e)
+		return true
+	}
+
+	member := h.back.Test(data)
+	if h.capacity == 0 {
+		h.back.Add(data)
+		return member
+	}
+
+	if uint(h.recency.Len()) >= h.capacity {
+		oldest := h.recency.Back()
+		key := h.recency.Remove(oldest).(string)
+		delete(h.front, key)
+		h.back.Add([]byte(key))
+	}
+
+	key := string(data)
+	h.front[key] = h.recency.PushFront(key)
+	return member
+}
@@ -0,0 +1,97 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Test, Add, and TestAndAdd behave correctly and that the least
+// recently seen elements are demoted to the backstop.
+func TestHybridTestAndAdd(t *testing.T) {
+	back := NewBloomFilter(100, 0.01)
+	f := NewHybridFilter(2, back)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned HybridFilter should be the same instance")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	// Seeing `a` again makes `b` the least recent.
+	if !f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	f.Add([]byte(`c`))
+	if n := f.FrontLen(); n != 2 {
+		t.Errorf("Expected 2, got %d", n)
+	}
+
+	if !back.Test([]byte(`b`)) {
+		t.Error("`b` should have been demoted")
+	}
+	if back.Test([]byte(`a`)) || back.Test([]byte(`c`)) {
+		t.Error("`a` and `c` should not have been demoted")
+	}
+
+	for _, data := range []string{"a", "b", "c"} {
+		if !f.Test([]byte(data)) {
+			t.Errorf("`%s` should be a member", data)
+		}
+	}
+
+	// Finding `b` in the backstop promotes it, demoting `a`.
+	if !f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+	if _, ok := f.front["b"]; !ok {
+		t.Error("`b` should have been promoted")
+	}
+	if !back.Test([]byte(`a`)) {
+		t.Error("`a` should have been demoted")
+	}
+}
+
+// Ensures that hot elements are never false negatives with a lossy backstop.
+func TestHybridHotElements(t *testing.T) {
+	f := NewDefaultHybridFilter(10, 100, 0.01)
+
+	for i := 0; i < 10000; i++ {
+		f.Add([]byte(`hot` + strconv.Itoa(i%5)))
+		f.Add([]byte(strconv.Itoa(i)))
+		for j := 0; j < 5; j++ {
+			if i >= 5 && !f.Test([]byte(`hot`+strconv.Itoa(j))) {
+				t.Fatalf("`hot%d` should be a member", j)
+			}
+		}
+	}
+}
+
+// Ensures that a zero capacity passes every element to the backstop.
+func TestHybridZeroCapacity(t *testing.T) {
+	back := NewBloomFilter(100, 0.01)
+	f := NewHybridFilter(0, back)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+	if !back.Test([]byte(`a`)) || f.FrontLen() != 0 {
+		t.Error("`a` should have been added to the backstop")
+	}
+}
+
+func BenchmarkHybridAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewDefaultHybridFilter(1000, 100000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 5000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
@@ -17,14 +17,22 @@ included in all copies or substantial portions of the Software.
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash"
 	"hash/fnv"
+	"io"
 	"math"
 )
 
 var exp32 = math.Pow(2, 32)
 
+// maxHLLPrecision is the largest precision, b, of a HyperLogLog, since the
+// register is chosen by the upper b bits of a 32-bit hash.
+const maxHLLPrecision = 32
+
 // HyperLogLog implements the HyperLogLog cardinality estimation algorithm as
 // described by Flajolet, Fusy, Gandouet, and Meunier in HyperLogLog: the
 // analysis of a near-optimal cardinality estimation algorithm:
@@ -44,12 +52,16 @@ var exp32 = math.Pow(2, 32)
 // impractical. HyperLogLog uses a fraction of the memory while providing an
 // accurate approximation. For counting element frequency, refer to the
 // Count-Min Sketch.
+//
+// Registers are packed at 6 bits each, which is enough for any number of
+// leading zeros in a 32-bit hash and uses a quarter less memory than a byte
+// per register.
 type HyperLogLog struct {
-	registers []uint8     // counter registers
-	m         uint        // number of registers
-	b         uint32      // number of bits to calculate register
-	alpha     float64     // bias-correction constant
-	hash      hash.Hash32 // hash function
+	registers hllRegisters // counter registers
+	m         uint         // number of registers
+	b         uint32       // number of bits to calculate register
+	alpha     float64      // bias-correction constant
+	hash      hash.Hash32  // hash function
 }
 
 // NewHyperLogLog creates a new HyperLogLog with m registers. Returns an error
@@ -60,7 +72,7 @@ func NewHyperLogLog(m uint) (*HyperLogLog, error) {
 	}
 
 	return &HyperLogLog{
-		registers: make([]uint8, m),
+		registers: newHLLRegisters(m),
 		m:         m,
 		b:         uint32(math.Ceil(math.Log2(float64(m)))),
 		alpha:     calculateAlpha(m),
@@ -72,8 +84,13 @@ func NewHyperLogLog(m uint) (*HyperLogLog, error) {
 // standard error. Returns an error if the number of registers can't be
 // calculated for the provided accuracy.
 func NewDefaultHyperLogLog(e float64) (*HyperLogLog, error) {
-	m := math.Pow(1.04/e, 2)
-	return NewHyperLogLog(uint(math.Pow(2, math.Ceil(math.Log2(m)))))
+	return NewHyperLogLog(1 << OptimalHLLPrecision(e))
+}
+
+// SetHash sets the hashing function used in the sketch. Sketches must use the
+// same hashing function to be merged.
+func (h *HyperLogLog) SetHash(hasher hash.Hash32) {
+	h.hash = hasher
 }
 
 // Add will add the data to the set. Returns the HyperLogLog to allow for
@@ -86,26 +103,35 @@ func (h *HyperLogLog) Add(data []byte) *HyperLogLog {
 		j    = hash >> uint(k)
 	)
 
-	if r > h.registers[j] {
-		h.registers[j] = r
+	if r > h.registers.get(uint(j)) {
+		h.registers.set(uint(j), r)
 	}
 
 	return h
 }
 
+// AddMany will add each element of data to the set. It's equivalent to calling
+// Add on each element. Returns the HyperLogLog to allow for chaining.
+func (h *HyperLogLog) AddMany(data [][]byte) *HyperLogLog {
+	for _, element := range data {
+		h.Add(element)
+	}
+	return h
+}
+
 // Count returns the approximated cardinality of the set.
 func (h *HyperLogLog) Count() uint64 {
 	sum := 0.0
 	m := float64(h.m)
-	for _, val := range h.registers {
-		sum += 1.0 / math.Pow(2.0, float64(val))
+	for j := uint(0); j < h.m; j++ {
+		sum += 1.0 / math.Pow(2.0, float64(h.registers.get(j)))
 	}
 	estimate := h.alpha * m * m / sum
 	if estimate <= 5.0/2.0*m {
 		// Small range correction
 		v := 0
-		for _, r := range h.registers {
-			if r == 0 {
+		for j := uint(0); j < h.m; j++ {
+			if h.registers.get(j) == 0 {
 				v++
 			}
 		}
@@ -119,6 +145,21 @@ func (h *HyperLogLog) Count() uint64 {
 	return uint64(estimate)
 }
 
+// StandardError returns the relative standard error of estimates for the
+// configured number of registers, 1.04/sqrt(m).
+func (h *HyperLogLog) StandardError() float64 {
+	return 1.04 / math.Sqrt(float64(h.m))
+}
+
+// Estimate returns the approximated cardinality of the set along with its
+// standard error in absolute terms, so that consumers can propagate the
+// uncertainty of the estimate. Roughly 68% of estimates are within one
+// standard error of the true cardinality and 95% within two.
+func (h *HyperLogLog) Estimate() (uint64, float64) {
+	count := h.Count()
+	return count, float64(count) * h.StandardError()
+}
+
 // Merge combines this HyperLogLog with another. Returns an error if the number
 // of registers in the two HyperLogLogs are not equal.
 func (h *HyperLogLog) Merge(other *HyperLogLog) error {
@@ -126,22 +167,114 @@ func (h *HyperLogLog) Merge(other *HyperLogLog) error {
 		return errors.New("number of registers must match")
 	}
 
-	for j, r := range other.registers {
-		if r > h.registers[j] {
-			h.registers[j] = r
+	for j := uint(0); j < h.m; j++ {
+		if r := other.registers.get(j); r > h.registers.get(j) {
+			h.registers.set(j, r)
 		}
 	}
 
 	return nil
 }
 
+// WriteTo writes a binary representation of the HyperLogLog to an i/o stream.
+// It returns the number of bytes written.
+func (h *HyperLogLog) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(h.m), uint64(h.b), math.Float64bits(h.alpha)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := stream.Write(h.registers)
+	return written + int64(n), err
+}
+
+// ReadFrom reads a binary representation of a HyperLogLog (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (h *HyperLogLog) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[1] > maxHLLPrecision || header[0] != 1<<header[1] {
+		return read, errors.New("invalid hyperloglog dimensions")
+	}
+	registers, n, err := readBytes(stream, hllRegistersSize(header[0]))
+	read += n
+	if err != nil {
+		return read, err
+	}
+
+	h.registers = registers
+	h.m = uint(header[0])
+	h.b = uint32(header[1])
+	h.alpha = math.Float64frombits(header[2])
+	if h.hash == nil {
+		h.hash = fnv.New32()
+	}
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (h *HyperLogLog) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := h.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (h *HyperLogLog) GobDecode(data []byte) error {
+	_, err := h.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's data.
+func (h *HyperLogLog) ByteSize() uint {
+	return uint(len(h.registers))
+}
+
+// String returns a one-line summary of the HyperLogLog for logging and
+// debugging.
+func (h *HyperLogLog) String() string {
+	return fmt.Sprintf("HyperLogLog{m=%d b=%d count=%d stderr=%.4f}",
+		h.m, h.b, h.Count(), h.StandardError())
+}
+
 // Reset restores the HyperLogLog to its original state. It returns itself to
 // allow for chaining.
 func (h *HyperLogLog) Reset() *HyperLogLog {
-	h.registers = make([]uint8, h.m)
+	for i := range h.registers {
+		h.registers[i] = 0
+	}
 	return h
 }
 
+// Copy returns a deep copy of the HyperLogLog. Returns ErrHashNotCloneable if
+// the sketch's hash can't be cloned.
+func (h *HyperLogLog) Copy() (*HyperLogLog, error) {
+	hash, err := copyHash32(h.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *h
+	copied.registers = append(hllRegisters(nil), h.registers...)
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other HyperLogLog has the same parameters, hashing
+// function, and registers.
+func (h *HyperLogLog) Equal(other *HyperLogLog) bool {
+	return h.m == other.m && h.b == other.b && sameHash(h.hash, other.hash) &&
+		bytes.Equal(h.registers, other.registers)
+}
+
 // calculateHash calculates the 32-bit hash value for the provided data.
 func (h *HyperLogLog) calculateHash(data []byte) uint32 {
 	h.hash.Write(data)
@@ -175,3 +308,36 @@ func calculateRho(val, max uint32) uint8 {
 	}
 	return uint8(r)
 }
+
+// hllRegisters is an array of 6-bit HyperLogLog registers packed
+// little-endian into bytes. It has a byte of padding at the end so that every
+// register can be read and written as a 16-bit window.
+type hllRegisters []byte
+
+// newHLLRegisters returns m zeroed registers.
+func newHLLRegisters(m uint) hllRegisters {
+	return make(hllRegisters, hllRegistersSize(uint64(m)))
+}
+
+// hllRegistersSize returns the number of bytes holding m registers, including
+// the padding.
+func hllRegistersSize(m uint64) uint64 {
+	return (m*6+7)/8 + 1
+}
+
+// get returns the value of register j.
+func (r hllRegisters) get(j uint) uint8 {
+	bit := j * 6
+	window := uint16(r[bit/8]) | uint16(r[bit/8+1])<<8
+	return uint8(window>>(bit%8)) & 0x3f
+}
+
+// set sets register j to the value, which must fit in 6 bits.
+func (r hllRegisters) set(j uint, value uint8) {
+	bit := j * 6
+	shift := bit % 8
+	window := uint16(r[bit/8]) | uint16(r[bit/8+1])<<8
+	window = window&^(0x3f<<shift) | uint16(value&0x3f)<<shift
+	r[bit/8] = byte(window)
+	r[bit/8+1] = byte(window >> 8)
+}
@@ -18,6 +18,7 @@ package boom
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"math"
@@ -107,6 +108,74 @@ func TestNewDefaultHyperLogLog(t *testing.T) {
 	}
 }
 
+// Ensures that Estimate reports the count with its standard error, and that
+// the true cardinality usually falls within a few standard errors.
+func TestHyperLogLogEstimate(t *testing.T) {
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatalf("can't make NewHyperLogLog(1024): %v", err)
+	}
+
+	if stdErr := hll.StandardError(); math.Abs(stdErr-0.0325) > 1e-9 {
+		t.Errorf("expected 0.0325, got %f", stdErr)
+	}
+
+	words := dictionary(0)
+	for _, word := range words {
+		hll.Add([]byte(word))
+	}
+
+	count, stdErr := hll.Estimate()
+	if count != hll.Count() {
+		t.Errorf("expected %d, got %d", hll.Count(), count)
+	}
+
+	if math.Abs(stdErr-float64(count)*0.0325) > 1e-6 {
+		t.Errorf("expected %f, got %f", float64(count)*0.0325, stdErr)
+	}
+
+	if actual := float64(len(words)); math.Abs(float64(count)-actual) > 3*stdErr {
+		t.Errorf("expected %d within %f, got %d", len(words), 3*stdErr, count)
+	}
+}
+
+// Ensures that String summarizes the HyperLogLog.
+func TestHyperLogLogString(t *testing.T) {
+	hll, err := NewHyperLogLog(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "HyperLogLog{m=16 b=4 count=0 stderr=0.2600}"
+
+	if s := hll.String(); s != expected {
+		t.Errorf("Expected %s, got %s", expected, s)
+	}
+}
+
+// Ensures that packed registers are read and written independently of their
+// neighbors.
+func TestHLLRegisters(t *testing.T) {
+	r := newHLLRegisters(16)
+	if len(r) != 13 {
+		t.Errorf("Expected 13 bytes, got %d", len(r))
+	}
+
+	for j := uint(0); j < 16; j++ {
+		r.set(j, uint8(j*4+3))
+	}
+	for j := uint(0); j < 16; j++ {
+		if v := r.get(j); v != uint8(j*4+3) {
+			t.Errorf("Expected %d, got %d", j*4+3, v)
+		}
+	}
+
+	r.set(5, 0)
+	r.set(6, 63)
+	if r.get(4) != 19 || r.get(5) != 0 || r.get(6) != 63 || r.get(7) != 31 {
+		t.Error("Expected setting a register to leave its neighbors unchanged")
+	}
+}
+
 func benchmarkCount(b *testing.B, registers int) {
 	words := dictionary(0)
 	m := uint(math.Pow(2, float64(registers)))
@@ -126,6 +195,60 @@ func benchmarkCount(b *testing.B, registers int) {
 	}
 }
 
+// Ensures that a HyperLogLog round-trips through WriteTo and ReadFrom.
+func TestHLLWriteToReadFrom(t *testing.T) {
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range dictionary(1000) {
+		hll.Add([]byte(word))
+	}
+
+	var buf bytes.Buffer
+	if _, err := hll.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &HyperLogLog{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := other.Count(); count != hll.Count() {
+		t.Errorf("Expected %d, got %d", hll.Count(), count)
+	}
+	other.Add([]byte(`a`))
+
+	if _, err := other.ReadFrom(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Error("Expected error for invalid dimensions")
+	}
+}
+
+// Ensures that AddMany agrees with Add.
+func TestHLLAddMany(t *testing.T) {
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := dictionary(1000)
+	data := make([][]byte, len(words))
+	for i, word := range words {
+		data[i] = []byte(word)
+		other.Add(data[i])
+	}
+
+	if hll.AddMany(data) != hll {
+		t.Error("Returned HyperLogLog should be the same instance")
+	}
+	if count := hll.Count(); count != other.Count() {
+		t.Errorf("Expected %d, got %d", other.Count(), count)
+	}
+}
+
 func BenchmarkHLLCount4(b *testing.B) {
 	benchmarkCount(b, 4)
 }
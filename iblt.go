@@ -0,0 +1,428 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+)
+
+// IBLT implements an Invertible Bloom Lookup Table as described by Goodrich
+// and Mitzenmacher in Invertible Bloom Lookup Tables:
+//
+// http://arxiv.org/pdf/1101.2245v2.pdf
+//
+// An IBLT is similar to a Counting Bloom Filter, but in addition to a count,
+// each cell keeps the XOR of every key hashed to it along with the XOR of a
+// checksum of those keys. A cell which holds exactly one key is "pure," and
+// its key can be read back out. Removing the key from its other cells may
+// make more cells pure, so as long as the table isn't too full, every entry
+// can be recovered by repeatedly peeling pure cells.
+//
+// IBLTs are useful for set reconciliation. Two replicas each build an IBLT of
+// their set and one is subtracted from the other. Elements present in both
+// sets cancel out, so the difference can be decoded with a table sized to
+// the number of differing elements rather than the size of the sets.
+type IBLT struct {
+	cells    []ibltCell  // table cells (divided into k partitions)
+	hash     hash.Hash64 // hash function (kernel for all k functions)
+	checksum hash.Hash64 // hash function used to verify pure cells
+	m        uint        // number of cells
+	k        uint        // number of hash functions (and partitions)
+	s        uint        // partition size (m / k)
+}
+
+// ibltCellSize is the size of an ibltCell in bytes, excluding the key sum.
+const ibltCellSize = 8 + 3*pointerSize + 8 + 8
+
+// ibltCell is a single IBLT cell.
+type ibltCell struct {
+	count   int64  // number of keys added minus number removed
+	keySum  []byte // XOR of every key
+	lenSum  uint64 // XOR of every key length
+	hashSum uint64 // XOR of every key checksum
+}
+
+// NewIBLT creates a new IBLT with the specified number of cells and hash
+// functions. The cells are evenly partitioned across the k hash functions so
+// that every key maps to k distinct cells. Use NewDefaultIBLT if you don't
+// want to calculate these parameters.
+func NewIBLT(m, k uint) *IBLT {
+	if k == 0 {
+		k = 1
+	}
+	s := uint(math.Ceil(float64(m) / float64(k)))
+	if s == 0 {
+		s = 1
+	}
+
+	return &IBLT{
+		cells:    make([]ibltCell, s*k),
+		hash:     newDefaultHash(),
+		checksum: fnv.New64a(),
+		m:        s * k,
+		k:        k,
+		s:        s,
+	}
+}
+
+// NewDefaultIBLT creates a new IBLT which is able to decode a difference of
+// up to d elements with high probability. It uses four hash functions and
+// twice as many cells as expected differences.
+func NewDefaultIBLT(d uint) *IBLT {
+	return NewIBLT(OptimalIBLTCells(d), 4)
+}
+
+// OptimalIBLTCells calculates the number of cells an IBLT with four hash
+// functions needs in order to decode d entries with high probability.
+func OptimalIBLTCells(d uint) uint {
+	// The asymptotic overhead for k=4 is about 1.3d, but small tables need a
+	// lot more slack to decode reliably.
+	m := 2 * d
+	if m < 32 {
+		m = 32
+	}
+	return m
+}
+
+// Cells returns the number of cells in the IBLT.
+func (t *IBLT) Cells() uint {
+	return t.m
+}
+
+// K returns the number of hash functions.
+func (t *IBLT) K() uint {
+	return t.k
+}
+
+// Add will insert the data into the IBLT. Returns the IBLT to allow for
+// chaining.
+func (t *IBLT) Add(data []byte) *IBLT {
+	t.update(data, 1)
+	return t
+}
+
+// Remove will delete the data from the IBLT. The data does not need to have
+// been added, in which case it is recorded with a negative count. Returns the
+// IBLT to allow for chaining.
+func (t *IBLT) Remove(data []byte) *IBLT {
+	t.update(data, -1)
+	return t
+}
+
+// Subtract removes the contents of the other IBLT from this one. Keys present
+// in both tables cancel out, leaving keys only in this table with a positive
+// count and keys only in the other table with a negative count. Returns an
+// error if the number of cells and hash functions are not equal.
+func (t *IBLT) Subtract(other *IBLT) error {
+	if t.m != other.m {
+		return errors.New("number of cells must match")
+	}
+
+	if t.k != other.k {
+		return errors.New("number of hash functions must match")
+	}
+
+	if !sameHash(t.hash, other.hash) {
+		return errors.New("hash functions must match")
+	}
+
+	for i := range t.cells {
+		cell := &t.cells[i]
+		cell.count -= other.cells[i].count
+		cell.keySum = xorBytes(cell.keySum, other.cells[i].keySum)
+		cell.lenSum ^= other.cells[i].lenSum
+		cell.hashSum ^= other.cells[i].hashSum
+	}
+
+	return nil
+}
+
+// Decode peels the IBLT and returns the keys with a positive count, which
+// were added (or are only in this table after a Subtract), and the keys with
+// a negative count, which were removed (or are only in the other table).
+// Returns an error if the table is too full to be completely decoded, in
+// which case the entries recovered so far are still returned. The IBLT itself
+// is left unmodified.
+func (t *IBLT) Decode() (added, removed [][]byte, err error) {
+	cells := t.copy().cells
+
+	// Seed the queue with every pure cell. Peeling a key may make more
+	// cells pure, which are appended as they are found.
+	queue := make([]uint, 0, len(cells))
+	for i := range cells {
+		if t.pure(&cells[i]) {
+			queue = append(queue, uint(i))
+		}
+	}
+
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+
+		cell := &cells[idx]
+		if !t.pure(cell) {
+			// Already peeled through another cell.
+			continue
+		}
+
+		var (
+			sign = cell.count
+			key  = append([]byte(nil), cell.keySum[:cell.lenSum]...)
+		)
+		if sign > 0 {
+			added = append(added, key)
+		} else {
+			removed = append(removed, key)
+		}
+
+		for _, i := range t.indices(key) {
+			t.updateCell(&cells[i], key, -sign)
+			if t.pure(&cells[i]) {
+				queue = append(queue, i)
+			}
+		}
+	}
+
+	for i := range cells {
+		if !cells[i].empty() {
+			return added, removed, errors.New("iblt could not be fully decoded")
+		}
+	}
+
+	return added, removed, nil
+}
+
+// ListEntries returns every key in the IBLT. This is intended for tables
+// which have only been added to. Returns an error if the table contains
+// removed keys or is too full to be completely decoded.
+func (t *IBLT) ListEntries() ([][]byte, error) {
+	added, removed, err := t.Decode()
+	if err != nil {
+		return added, err
+	}
+	if len(removed) > 0 {
+		return added, errors.New("iblt contains removed entries")
+	}
+	return added, nil
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// table's data, including the key sums.
+func (t *IBLT) ByteSize() uint {
+	size := uint(len(t.cells)) * ibltCellSize
+	for _, cell := range t.cells {
+		size += uint(len(cell.keySum))
+	}
+	return size
+}
+
+// String returns a one-line summary of the IBLT for logging and debugging.
+func (t *IBLT) String() string {
+	return fmt.Sprintf("IBLT{m=%d k=%d}", t.m, t.k)
+}
+
+// Reset restores the IBLT to its original state. It returns itself to allow
+// for chaining.
+func (t *IBLT) Reset() *IBLT {
+	t.cells = make([]ibltCell, t.m)
+	return t
+}
+
+// WriteTo writes a binary representation of the IBLT to an i/o stream. It
+// returns the number of bytes written.
+func (t *IBLT) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(t.m), uint64(t.k)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, cell := range t.cells {
+		fields := []uint64{uint64(cell.count), cell.lenSum, cell.hashSum,
+			uint64(len(cell.keySum))}
+		if err := binary.Write(stream, binary.BigEndian, fields); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(fields))
+
+		n, err := stream.Write(cell.keySum)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of an IBLT (such as might have been
+// written by WriteTo()) from an i/o stream. It returns the number of bytes
+// read.
+func (t *IBLT) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 2)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[0] == 0 || header[1] == 0 || header[1] > header[0] ||
+		header[0]%header[1] != 0 || header[0] > uint64(^uint(0)>>1) {
+		return read, errors.New("invalid iblt dimensions")
+	}
+	m, k := uint(header[0]), uint(header[1])
+
+	// Cells and keys are read as they arrive rather than allocated up front,
+	// so forged dimensions or key lengths can't exhaust memory.
+	cells := make([]ibltCell, 0, min(m, 1<<16))
+	fields := make([]uint64, 4)
+	for uint(len(cells)) < m {
+		if err := binary.Read(stream, binary.BigEndian, fields); err != nil {
+			return read, err
+		}
+		read += int64(binary.Size(fields))
+
+		if fields[3] > 1<<63-1 {
+			return read, errors.New("invalid iblt key length")
+		}
+		var key bytes.Buffer
+		n, err := io.CopyN(&key, stream, int64(fields[3]))
+		read += n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return read, err
+		}
+		cells = append(cells, ibltCell{
+			count:   int64(fields[0]),
+			keySum:  key.Bytes(),
+			lenSum:  fields[1],
+			hashSum: fields[2],
+		})
+	}
+
+	if t.hash == nil {
+		t.hash = newDefaultHash()
+	}
+	if t.checksum == nil {
+		t.checksum = fnv.New64a()
+	}
+	t.cells = cells
+	t.m = m
+	t.k = k
+	t.s = m / k
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (t *IBLT) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := t.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (t *IBLT) GobDecode(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// copy returns a deep copy of the IBLT.
+func (t *IBLT) copy() *IBLT {
+	cells := make([]ibltCell, len(t.cells))
+	for i, cell := range t.cells {
+		cells[i] = cell
+		cells[i].keySum = append([]byte(nil), cell.keySum...)
+	}
+
+	return &IBLT{
+		cells:    cells,
+		hash:     newDefaultHash(),
+		checksum: fnv.New64a(),
+		m:        t.m,
+		k:        t.k,
+		s:        t.s,
+	}
+}
+
+// update adds the data to each of its k cells with the given count delta.
+func (t *IBLT) update(data []byte, delta int64) {
+	for _, i := range t.indices(data) {
+		t.updateCell(&t.cells[i], data, delta)
+	}
+}
+
+// updateCell adds the data to the cell with the given count delta.
+func (t *IBLT) updateCell(cell *ibltCell, data []byte, delta int64) {
+	cell.count += delta
+	cell.keySum = xorBytes(cell.keySum, data)
+	cell.lenSum ^= uint64(len(data))
+	cell.hashSum ^= t.checksumOf(data)
+}
+
+// indices returns the cell index in each of the k partitions for the data.
+func (t *IBLT) indices(data []byte) []uint {
+	var (
+		lower, upper = hashKernel(data, t.hash)
+		indices      = make([]uint, t.k)
+	)
+	for i := uint(0); i < t.k; i++ {
+		indices[i] = i*t.s + DoubleHashing.index(lower, upper, i, t.s)
+	}
+	return indices
+}
+
+// pure indicates if the cell holds exactly one key, either added or removed.
+func (t *IBLT) pure(cell *ibltCell) bool {
+	if cell.count != 1 && cell.count != -1 {
+		return false
+	}
+	if cell.lenSum > uint64(len(cell.keySum)) {
+		return false
+	}
+	for _, b := range cell.keySum[cell.lenSum:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return t.checksumOf(cell.keySum[:cell.lenSum]) == cell.hashSum
+}
+
+// checksumOf returns the checksum used to verify that a cell is pure.
+func (t *IBLT) checksumOf(data []byte) uint64 {
+	t.checksum.Write(data)
+	sum := t.checksum.Sum64()
+	t.checksum.Reset()
+	return sum
+}
+
+// empty indicates if the cell holds no keys.
+func (c *ibltCell) empty() bool {
+	if c.count != 0 || c.lenSum != 0 || c.hashSum != 0 {
+		return false
+	}
+	for _, b := range c.keySum {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// xorBytes XORs b into a, growing a as needed, and returns the result.
+func xorBytes(a, b []byte) []byte {
+	if len(b) > len(a) {
+		a = append(a, make([]byte, len(b)-len(a))...)
+	}
+	for i, x := range b {
+		a[i] ^= x
+	}
+	return a
+}
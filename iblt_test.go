@@ -0,0 +1,233 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Ensures that Cells returns the number of cells rounded up to a multiple of
+// the number of hash functions.
+func TestIBLTCells(t *testing.T) {
+	table := NewIBLT(10, 4)
+
+	if cells := table.Cells(); cells != 12 {
+		t.Errorf("Expected 12, got %d", cells)
+	}
+
+	if k := table.K(); k != 4 {
+		t.Errorf("Expected 4, got %d", k)
+	}
+}
+
+// Ensures that ListEntries returns every key added to the IBLT.
+func TestIBLTListEntries(t *testing.T) {
+	table := NewDefaultIBLT(50)
+	for i := 0; i < 50; i++ {
+		table.Add([]byte(strconv.Itoa(i)))
+	}
+
+	entries, err := table.ListEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 50 {
+		t.Fatalf("Expected 50 entries, got %d", len(entries))
+	}
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = string(entry)
+	}
+	sort.Strings(keys)
+	for i := 0; i < 50; i++ {
+		if idx := sort.SearchStrings(keys, strconv.Itoa(i)); keys[idx] != strconv.Itoa(i) {
+			t.Errorf("Expected %d to be listed", i)
+		}
+	}
+
+	// The table itself is left unmodified.
+	if entries, _ := table.ListEntries(); len(entries) != 50 {
+		t.Errorf("Expected 50 entries, got %d", len(entries))
+	}
+}
+
+// Ensures that Remove deletes keys from the IBLT and that removed keys which
+// were never added are decoded separately.
+func TestIBLTRemove(t *testing.T) {
+	table := NewDefaultIBLT(10)
+	table.Add([]byte(`a`)).Add([]byte(`b`)).Add([]byte(`c`))
+
+	if table.Remove([]byte(`b`)) != table {
+		t.Error("Returned IBLT should be the same instance")
+	}
+	table.Remove([]byte(`x`))
+
+	added, removed, err := table.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 2 {
+		t.Errorf("Expected 2 added entries, got %d", len(added))
+	}
+
+	if len(removed) != 1 || string(removed[0]) != "x" {
+		t.Errorf("Expected [x] removed, got %q", removed)
+	}
+
+	if _, err := table.ListEntries(); err == nil {
+		t.Error("Expected error listing entries with removed keys")
+	}
+}
+
+// Ensures that Subtract leaves only the symmetric difference of the two sets.
+func TestIBLTSubtract(t *testing.T) {
+	var (
+		a = NewDefaultIBLT(20)
+		b = NewDefaultIBLT(20)
+	)
+	for i := 0; i < 10000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	a.Add([]byte(`only-a`)).Add([]byte(`also-only-a`))
+	b.Add([]byte(`only-b`))
+
+	if err := a.Subtract(b); err != nil {
+		t.Fatal(err)
+	}
+
+	added, removed, err := a.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 2 {
+		t.Errorf("Expected 2 added entries, got %q", added)
+	}
+
+	if len(removed) != 1 || string(removed[0]) != "only-b" {
+		t.Errorf("Expected [only-b] removed, got %q", removed)
+	}
+
+	if err := a.Subtract(NewIBLT(10, 3)); err == nil {
+		t.Error("Expected error subtracting incompatible IBLT")
+	}
+
+	other := NewIBLT(a.Cells(), a.K())
+	other.hash = NewXXHash()
+	if err := a.Subtract(other); err == nil {
+		t.Error("Expected error subtracting IBLT with a different hash function")
+	}
+}
+
+// Ensures that Decode returns an error when the table is overloaded.
+func TestIBLTDecodeOverloaded(t *testing.T) {
+	table := NewIBLT(8, 4)
+	for i := 0; i < 100; i++ {
+		table.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if _, _, err := table.Decode(); err == nil {
+		t.Error("Expected error decoding overloaded IBLT")
+	}
+}
+
+// Ensures that Reset empties the IBLT.
+func TestIBLTReset(t *testing.T) {
+	table := NewDefaultIBLT(10)
+	table.Add([]byte(`a`))
+
+	if table.Reset() != table {
+		t.Error("Returned IBLT should be the same instance")
+	}
+
+	if entries, err := table.ListEntries(); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries, got %q (%v)", entries, err)
+	}
+}
+
+// Ensures that an IBLT can be written to and read from a stream.
+func TestIBLTWriteToReadFrom(t *testing.T) {
+	table := NewDefaultIBLT(10)
+	table.Add([]byte(`a`)).Add([]byte(`bb`)).Remove([]byte(`ccc`))
+
+	var buf bytes.Buffer
+	written, err := table.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), written)
+	}
+
+	var restored IBLT
+	read, err := restored.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != written {
+		t.Errorf("Expected %d bytes read, got %d", written, read)
+	}
+
+	if restored.Cells() != table.Cells() || restored.K() != table.K() {
+		t.Errorf("Expected %d cells and k=%d, got %d and %d",
+			table.Cells(), table.K(), restored.Cells(), restored.K())
+	}
+
+	added, removed, err := restored.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 2 || len(removed) != 1 {
+		t.Errorf("Expected 2 added and 1 removed, got %q and %q", added, removed)
+	}
+
+	if _, err := restored.ReadFrom(bytes.NewReader([]byte{0, 1})); err == nil {
+		t.Error("Expected error reading truncated stream")
+	}
+}
+
+// Ensures that ReadFrom rejects invalid dimensions and key lengths without
+// allocating for them.
+func TestIBLTReadFromInvalid(t *testing.T) {
+	cell := func(keyLen uint64) []uint64 { return []uint64{1, 0, 0, keyLen} }
+	for _, test := range []struct {
+		name  string
+		words []uint64
+		error string
+	}{
+		{"zero cells", []uint64{0, 1}, "invalid iblt dimensions"},
+		{"zero hash functions", []uint64{4, 0}, "invalid iblt dimensions"},
+		{"k > m", []uint64{2, 4}, "invalid iblt dimensions"},
+		{"huge m", []uint64{1 << 30, 1}, "EOF"},
+		{"huge key", append([]uint64{1, 1}, cell(1<<62)...), "unexpected EOF"},
+		{"invalid key length", append([]uint64{1, 1}, cell(1<<63)...), "invalid iblt key length"},
+	} {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, test.words)
+		var restored IBLT
+		if _, err := restored.ReadFrom(&buf); err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: Expected error containing %q, got %v", test.name, test.error, err)
+		}
+	}
+}
+
+func BenchmarkIBLTAdd(b *testing.B) {
+	b.StopTimer()
+	table := NewDefaultIBLT(1000)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		table.Add(data[n])
+	}
+}
@@ -0,0 +1,154 @@
+package boom
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MetricsRegisterer registers metrics with a monitoring system such as
+// Prometheus. It's an interface so that the package doesn't depend on any
+// client library. With the Prometheus client, RegisterCounter can create and
+// register a prometheus.Counter and return its Inc method, and RegisterGauge
+// can register a prometheus.GaugeFunc calling value. Several filters can be
+// instrumented with registerers which add distinguishing labels, such as with
+// prometheus.WrapRegistererWith.
+type MetricsRegisterer interface {
+	// RegisterCounter registers a counter with the name and help text and
+	// returns a function which increments it.
+	RegisterCounter(name, help string) func()
+
+	// RegisterGauge registers a gauge with the name and help text whose
+	// value is returned by value when it's collected.
+	RegisterGauge(name, help string, value func() float64)
+}
+
+// InstrumentedFilter wraps a Filter to export its activity and health as
+// metrics, so that they're visible in production dashboards. It counts adds,
+// tests, hits, and resets and, if the filter provides them, reports its
+// estimated false-positive rate and fill ratio as gauges. Since gauges are
+// collected from other goroutines, every operation takes a lock, so like
+// SynchronizedFilter, it's safe for concurrent use.
+type InstrumentedFilter struct {
+	mu     sync.Mutex // guards filter
+	filter Filter     // wrapped filter
+	adds   func()     // increments the adds counter
+	tests  func()     // increments the tests counter
+	hits   func()     // increments the hits counter
+	resets func()     // increments the resets counter
+}
+
+// Instrumented returns an InstrumentedFilter wrapping the filter and registers
+// its metrics with the registerer:
+//
+//	boom_filter_adds_total         items added
+//	boom_filter_tests_total        items tested
+//	boom_filter_hits_total         tests which reported membership
+//	boom_filter_resets_total       times the filter was reset
+//	boom_filter_estimated_fp_rate  if the filter has EstimateFPRate
+//	boom_filter_fill_ratio         if the filter has FillRatio
+//	boom_filter_partitions         if the filter has Filters, as a
+//	                               ScalableBloomFilter does
+//
+// TestAndAdd counts as both a test and an add. The filter must not be used
+// directly afterward.
+func Instrumented(filter Filter, registerer MetricsRegisterer) *InstrumentedFilter {
+	i := &InstrumentedFilter{
+		filter: filter,
+		adds:   registerer.RegisterCounter("boom_filter_adds_total", "Number of items added to the filter."),
+		tests:  registerer.RegisterCounter("boom_filter_tests_total", "Number of items tested for membership."),
+		hits:   registerer.RegisterCounter("boom_filter_hits_total", "Number of tests which reported membership."),
+		resets: registerer.RegisterCounter("boom_filter_resets_total", "Number of times the filter was reset."),
+	}
+	if f, ok := filter.(interface{ EstimateFPRate() float64 }); ok {
+		registerer.RegisterGauge("boom_filter_estimated_fp_rate",
+			"Estimated false-positive rate of the filter.", func() float64 {
+				i.mu.Lock()
+				defer i.mu.Unlock()
+				return f.EstimateFPRate()
+			})
+	}
+	if f, ok := filter.(interface{ FillRatio() float64 }); ok {
+		registerer.RegisterGauge("boom_filter_fill_ratio",
+			"Ratio of set bits in the filter.", func() float64 {
+				i.mu.Lock()
+				defer i.mu.Unlock()
+				return f.FillRatio()
+			})
+	}
+	if f, ok := filter.(interface{ Filters() uint }); ok {
+		registerer.RegisterGauge("boom_filter_partitions",
+			"Number of filters the filter has grown to.", func() float64 {
+				i.mu.Lock()
+				defer i.mu.Unlock()
+				return float64(f.Filters())
+			})
+	}
+	return i
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not.
+func (i *InstrumentedFilter) Test(data []byte) bool {
+	i.mu.Lock()
+	member := i.filter.Test(data)
+	i.mu.Unlock()
+	i.tests()
+	if member {
+		i.hits()
+	}
+	return member
+}
+
+// Add will add the data to the filter. It returns the InstrumentedFilter to
+// allow for chaining.
+func (i *InstrumentedFilter) Add(data []byte) Filter {
+	i.mu.Lock()
+	i.filter.Add(data)
+	i.mu.Unlock()
+	i.adds()
+	return i
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not.
+func (i *InstrumentedFilter) TestAndAdd(data []byte) bool {
+	i.mu.Lock()
+	member := i.filter.TestAndAdd(data)
+	i.mu.Unlock()
+	i.tests()
+	i.adds()
+	if member {
+		i.hits()
+	}
+	return member
+}
+
+// Reset restores the wrapped filter to its original state, if it has a Clear
+// method, and counts the reset. It returns the InstrumentedFilter to allow for
+// chaining.
+func (i *InstrumentedFilter) Reset() *InstrumentedFilter {
+	i.mu.Lock()
+	if f, ok := i.filter.(interface{ Clear() }); ok {
+		f.Clear()
+	}
+	i.mu.Unlock()
+	i.resets()
+	return i
+}
+
+// Do calls fn with the wrapped filter while holding the lock, so that any of
+// its other methods can be called safely. Operations in fn aren't counted. The
+// filter must not be retained after fn returns.
+func (i *InstrumentedFilter) Do(fn func(filter Filter)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	fn(i.filter)
+}
+
+// String returns a one-line summary of the InstrumentedFilter for logging and
+// debugging.
+func (i *InstrumentedFilter) String() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return fmt.Sprintf("InstrumentedFilter{%v}", i.filter)
+}
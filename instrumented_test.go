@@ -0,0 +1,114 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// fakeRegisterer records registered metrics in memory.
+type fakeRegisterer struct {
+	counters map[string]int
+	gauges   map[string]func() float64
+}
+
+func newFakeRegisterer() *fakeRegisterer {
+	return &fakeRegisterer{counters: make(map[string]int), gauges: make(map[string]func() float64)}
+}
+
+func (f *fakeRegisterer) RegisterCounter(name, help string) func() {
+	f.counters[name] = 0
+	return func() { f.counters[name]++ }
+}
+
+func (f *fakeRegisterer) RegisterGauge(name, help string, value func() float64) {
+	f.gauges[name] = value
+}
+
+// Ensures that an InstrumentedFilter counts operations and reports gauges.
+func TestInstrumented(t *testing.T) {
+	registerer := newFakeRegisterer()
+	f := Instrumented(NewBloomFilter(100, 0.01), registerer)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned InstrumentedFilter should be the same instance")
+	}
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	if f.Test([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	expected := map[string]int{
+		"boom_filter_adds_total":   2,
+		"boom_filter_tests_total":  3,
+		"boom_filter_hits_total":   1,
+		"boom_filter_resets_total": 0,
+	}
+	for name, count := range expected {
+		if registerer.counters[name] != count {
+			t.Errorf("Expected %s to be %d, got %d", name, count, registerer.counters[name])
+		}
+	}
+
+	fill := registerer.gauges["boom_filter_fill_ratio"]
+	fpRate := registerer.gauges["boom_filter_estimated_fp_rate"]
+	if fill == nil || fpRate == nil {
+		t.Fatal("Expected fill ratio and false-positive rate gauges")
+	}
+	if fill() == 0 || fpRate() == 0 {
+		t.Error("Expected non-zero gauges")
+	}
+
+	f.Reset()
+	if registerer.counters["boom_filter_resets_total"] != 1 {
+		t.Error("Expected the reset to be counted")
+	}
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member after reset")
+	}
+	if fill() != 0 {
+		t.Errorf("Expected an empty filter, got fill ratio %f", fill())
+	}
+}
+
+// Ensures that gauges aren't registered for filters which don't provide them.
+func TestInstrumentedGauges(t *testing.T) {
+	registerer := newFakeRegisterer()
+	Instrumented(NewInverseBloomFilter(100), registerer)
+	if len(registerer.gauges) != 0 {
+		t.Errorf("Expected no gauges, got %d", len(registerer.gauges))
+	}
+
+	registerer = newFakeRegisterer()
+	Instrumented(NewDefaultStableBloomFilter(100, 0.01), registerer)
+	if _, ok := registerer.gauges["boom_filter_estimated_fp_rate"]; !ok {
+		t.Error("Expected a false-positive rate gauge")
+	}
+
+	registerer = newFakeRegisterer()
+	f := Instrumented(NewScalableBloomFilter(10, 0.01, 0.8), registerer)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	if partitions := registerer.gauges["boom_filter_partitions"]; partitions == nil || partitions() < 2 {
+		t.Error("Expected a partitions gauge reporting the grown filters")
+	}
+}
+
+func BenchmarkInstrumentedAdd(b *testing.B) {
+	b.StopTimer()
+	f := Instrumented(NewBloomFilter(100000, 0.1), newFakeRegisterer())
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
@@ -33,10 +33,13 @@ package boom
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
 	"hash/fnv"
+	"io"
 	"sync/atomic"
-	"unsafe"
 )
 
 // InverseBloomFilter is a concurrent "inverse" Bloom filter, which is
@@ -54,7 +57,7 @@ import (
 // An example use case is deduplicating events while processing a stream of
 // data. Ideally, duplicate events are relatively close together.
 type InverseBloomFilter struct {
-	array    []*[]byte
+	array    []atomic.Pointer[[]byte]
 	hash     hash.Hash32
 	capacity uint
 }
@@ -63,12 +66,26 @@ type InverseBloomFilter struct {
 // specified capacity.
 func NewInverseBloomFilter(capacity uint) *InverseBloomFilter {
 	return &InverseBloomFilter{
-		array:    make([]*[]byte, capacity),
+		array:    make([]atomic.Pointer[[]byte], capacity),
 		hash:     fnv.New32(),
 		capacity: capacity,
 	}
 }
 
+// NewInverseBloomFilterE is like NewInverseBloomFilter but returns an error
+// if capacity is zero.
+func NewInverseBloomFilterE(capacity uint) (*InverseBloomFilter, error) {
+	if capacity == 0 {
+		return nil, errors.New("capacity must be positive")
+	}
+	return NewInverseBloomFilter(capacity), nil
+}
+
+// SetHash sets the hashing function used in the filter.
+func (i *InverseBloomFilter) SetHash(h hash.Hash32) {
+	i.hash = h
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false negatives but a zero probability of false
@@ -76,8 +93,7 @@ func NewInverseBloomFilter(capacity uint) *InverseBloomFilter {
 // it will never return true for data that hasn't been added.
 func (i *InverseBloomFilter) Test(data []byte) bool {
 	index := i.index(data)
-	indexPtr := (*unsafe.Pointer)(unsafe.Pointer(&i.array[index]))
-	val := (*[]byte)(atomic.LoadPointer(indexPtr))
+	val := i.array[index].Load()
 	if val == nil {
 		return false
 	}
@@ -104,23 +120,56 @@ func (i *InverseBloomFilter) Capacity() uint {
 	return i.capacity
 }
 
+// Copy returns a copy of the InverseBloomFilter, which can be used
+// independently of it. The stored elements are shared since they're never
+// modified. It's safe to call concurrently with other operations, though the
+// copy may not reflect a single point in time. Returns ErrHashNotCloneable if
+// the filter's hash can't be cloned.
+func (i *InverseBloomFilter) Copy() (*InverseBloomFilter, error) {
+	hash, err := copyHash32(i.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := &InverseBloomFilter{
+		array:    make([]atomic.Pointer[[]byte], len(i.array)),
+		hash:     hash,
+		capacity: i.capacity,
+	}
+	for j := range i.array {
+		copied.array[j].Store(i.array[j].Load())
+	}
+	return copied, nil
+}
+
+// Equal returns whether the other InverseBloomFilter has the same parameters,
+// hashing function, and elements.
+func (i *InverseBloomFilter) Equal(other *InverseBloomFilter) bool {
+	if i.capacity != other.capacity || !sameHash(i.hash, other.hash) {
+		return false
+	}
+	for j := range i.array {
+		var a, b []byte
+		if ptr := i.array[j].Load(); ptr != nil {
+			a = *ptr
+		}
+		if ptr := other.array[j].Load(); ptr != nil {
+			b = *ptr
+		}
+		if !bytes.Equal(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
 // getAndSet returns the data that was in the slice at the given index after
 // putting the new data in the slice at that index, atomically.
 func (i *InverseBloomFilter) getAndSet(index uint32, data []byte) []byte {
-	indexPtr := (*unsafe.Pointer)(unsafe.Pointer(&i.array[index]))
-	keyUnsafe := unsafe.Pointer(&data)
-	var oldKey []byte
-	for {
-		oldKeyUnsafe := atomic.LoadPointer(indexPtr)
-		if atomic.CompareAndSwapPointer(indexPtr, oldKeyUnsafe, keyUnsafe) {
-			oldKeyPtr := (*[]byte)(oldKeyUnsafe)
-			if oldKeyPtr != nil {
-				oldKey = *oldKeyPtr
-			}
-			break
-		}
+	oldKeyPtr := i.array[index].Swap(&data)
+	if oldKeyPtr == nil {
+		return nil
 	}
-	return oldKey
+	return *oldKeyPtr
 }
 
 // index returns the array index for the given data.
@@ -130,3 +179,119 @@ func (i *InverseBloomFilter) index(data []byte) uint32 {
 	i.hash.Reset()
 	return index
 }
+
+// WriteTo writes a binary representation of the InverseBloomFilter to an i/o
+// stream. It returns the number of bytes written. It's safe to call
+// concurrently with other operations, though the result may not reflect a
+// single point in time.
+func (i *InverseBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	if err := binary.Write(stream, binary.BigEndian, uint64(i.capacity)); err != nil {
+		return 0, err
+	}
+	written := int64(8)
+
+	// Each slot is the length of its data plus one, or zero if it's empty,
+	// followed by the data.
+	for j := range i.array {
+		data := i.array[j].Load()
+		length := uint64(0)
+		if data != nil {
+			length = uint64(len(*data)) + 1
+		}
+		if err := binary.Write(stream, binary.BigEndian, length); err != nil {
+			return written, err
+		}
+		written += 8
+		if data == nil {
+			continue
+		}
+		n, err := stream.Write(*data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of an InverseBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (i *InverseBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var capacity uint64
+	if err := binary.Read(stream, binary.BigEndian, &capacity); err != nil {
+		return 0, err
+	}
+	read := int64(8)
+
+	if capacity == 0 {
+		return read, errors.New("invalid inverse bloom filter capacity")
+	}
+	slots := make([][]byte, 0, 1)
+	for j := uint64(0); j < capacity; j++ {
+		slots = append(slots, nil)
+		var length uint64
+		if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+			return read, err
+		}
+		read += 8
+		if length == 0 {
+			continue
+		}
+		data, n, err := readBytes(stream, length-1)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if data == nil {
+			data = []byte{}
+		}
+		slots[j] = data
+	}
+
+	array := make([]atomic.Pointer[[]byte], capacity)
+	for j := range slots {
+		if slots[j] != nil {
+			array[j].Store(&slots[j])
+		}
+	}
+	i.array = array
+	i.capacity = uint(capacity)
+	if i.hash == nil {
+		i.hash = fnv.New32()
+	}
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (i *InverseBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := i.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (i *InverseBloomFilter) GobDecode(data []byte) error {
+	_, err := i.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including the stored elements.
+func (i *InverseBloomFilter) ByteSize() uint {
+	size := uint(len(i.array)) * pointerSize
+	for j := range i.array {
+		if ptr := i.array[j].Load(); ptr != nil {
+			size += uint(len(*ptr))
+		}
+	}
+	return size
+}
+
+// String returns a one-line summary of the InverseBloomFilter for logging and
+// debugging.
+func (i *InverseBloomFilter) String() string {
+	return fmt.Sprintf("InverseBloomFilter{capacity=%d}", i.capacity)
+}
@@ -14,6 +14,17 @@ func TestInverseCapacity(t *testing.T) {
 	}
 }
 
+// Ensures that NewInverseBloomFilterE returns an error for a zero capacity.
+func TestNewInverseBloomFilterE(t *testing.T) {
+	if f, err := NewInverseBloomFilterE(100); err != nil || f == nil {
+		t.Errorf("Expected an InverseBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewInverseBloomFilterE(0); err == nil {
+		t.Error("Expected error for capacity = 0")
+	}
+}
+
 // Ensures that TestAndAdd behaves correctly.
 func TestInverseTestAndAdd(t *testing.T) {
 	f := NewInverseBloomFilter(3)
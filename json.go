@@ -0,0 +1,218 @@
+package boom
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+)
+
+var errJSONMalformed = errors.New("malformed filter JSON")
+
+// bloomJSON is the JSON form of a BloomFilter. Its bits are packed as Buckets
+// packs them, least-significant bit first, and encoded in base64.
+type bloomJSON struct {
+	M        uint     `json:"m"`
+	K        uint     `json:"k"`
+	KExtra   uint32   `json:"k_extra,omitempty"`
+	Indexing Indexing `json:"indexing,omitempty"`
+	Count    uint     `json:"count"`
+	Data     []byte   `json:"data"`
+}
+
+// countingJSON is the JSON form of a CountingBloomFilter. Its buckets are
+// packed least-significant bit first and encoded in base64, and the excess of
+// saturated buckets is listed in the same order as the buckets if spilling is
+// enabled.
+type countingJSON struct {
+	M              uint     `json:"m"`
+	K              uint     `json:"k"`
+	BucketSize     uint8    `json:"bucket_size"`
+	Count          uint     `json:"count"`
+	Data           []byte   `json:"data"`
+	Spill          bool     `json:"spill,omitempty"`
+	SpilledBuckets []uint   `json:"spilled_buckets,omitempty"`
+	SpilledExcess  []uint32 `json:"spilled_excess,omitempty"`
+}
+
+// countMinJSON is the JSON form of a CountMinSketch, with a row of counters
+// for each of its hash functions.
+type countMinJSON struct {
+	Width    uint       `json:"width"`
+	Depth    uint       `json:"depth"`
+	Epsilon  float64    `json:"epsilon"`
+	Delta    float64    `json:"delta"`
+	Count    uint64     `json:"count"`
+	Counters [][]uint64 `json:"counters"`
+}
+
+// hyperLogLogJSON is the JSON form of a HyperLogLog. Its 6-bit registers are
+// packed least-significant bit first and encoded in base64.
+type hyperLogLogJSON struct {
+	B         uint32  `json:"b"`
+	Alpha     float64 `json:"alpha"`
+	Registers []byte  `json:"registers"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding the BloomFilter's
+// parameters as fields and its bits in base64, so that small filters can be
+// embedded in JSON documents. Unless SetHash was called, the filter hashes
+// with the default hash, which the reader must also use.
+func (b *BloomFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bloomJSON{
+		M:        b.m,
+		K:        b.k,
+		KExtra:   b.extra,
+		Indexing: b.indexing,
+		Count:    b.count,
+		Data:     b.buckets.data,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring the BloomFilter from
+// the form written by MarshalJSON.
+func (b *BloomFilter) UnmarshalJSON(data []byte) error {
+	var v bloomJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.M == 0 || v.M > maxBits || uint(len(v.Data)) != (v.M+7)/8 ||
+		v.K == 0 || v.K > maxK || v.Indexing > TripleHashing {
+		return errJSONMalformed
+	}
+
+	b.buckets = &Buckets{data: v.Data, bucketSize: 1, max: 1, count: v.M}
+	b.hash = newDefaultHash()
+	b.m = v.M
+	b.k = v.K
+	b.extra = v.KExtra
+	b.indexing = v.Indexing
+	b.count = v.Count
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the CountingBloomFilter's
+// parameters as fields and its buckets in base64.
+func (c *CountingBloomFilter) MarshalJSON() ([]byte, error) {
+	v := countingJSON{
+		M:          c.m,
+		K:          c.k,
+		BucketSize: c.buckets.bucketSize,
+		Count:      c.count,
+		Data:       c.buckets.data,
+		Spill:      c.spill != nil,
+	}
+	if c.spill != nil {
+		v.SpilledBuckets = c.spilledBuckets()
+		v.SpilledExcess = make([]uint32, len(v.SpilledBuckets))
+		for i, idx := range v.SpilledBuckets {
+			v.SpilledExcess[i] = c.spill[idx]
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring the CountingBloomFilter
+// from the form written by MarshalJSON.
+func (c *CountingBloomFilter) UnmarshalJSON(data []byte) error {
+	var v countingJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if validateBucketSize("bucket_size", v.BucketSize) != nil || v.M > maxBits/uint(v.BucketSize) ||
+		uint(len(v.Data)) != (v.M*uint(v.BucketSize)+7)/8 || v.M == 0 || v.K == 0 ||
+		v.K > v.M || v.K > maxK || len(v.SpilledBuckets) != len(v.SpilledExcess) {
+		return errJSONMalformed
+	}
+
+	var spill map[uint]uint32
+	if v.Spill {
+		spill = make(map[uint]uint32, len(v.SpilledBuckets))
+		for i, idx := range v.SpilledBuckets {
+			if idx >= v.M {
+				return errJSONMalformed
+			}
+			spill[idx] = v.SpilledExcess[i]
+		}
+	}
+	c.spill = spill
+	c.buckets = &Buckets{
+		data:       v.Data,
+		bucketSize: v.BucketSize,
+		max:        (1 << v.BucketSize) - 1,
+		count:      v.M,
+	}
+	c.hash = newDefaultHash()
+	c.m = v.M
+	c.k = v.K
+	c.count = v.Count
+	c.indexBuffer = make([]uint, v.K)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the CountMinSketch's
+// parameters as fields and its counters as an array of rows.
+func (c *CountMinSketch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(countMinJSON{
+		Width:    c.width,
+		Depth:    c.depth,
+		Epsilon:  c.epsilon,
+		Delta:    c.delta,
+		Count:    c.count,
+		Counters: c.matrix,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring the CountMinSketch from
+// the form written by MarshalJSON.
+func (c *CountMinSketch) UnmarshalJSON(data []byte) error {
+	var v countMinJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Width == 0 || v.Depth == 0 || uint(len(v.Counters)) != v.Depth {
+		return errJSONMalformed
+	}
+	for _, row := range v.Counters {
+		if uint(len(row)) != v.Width {
+			return errJSONMalformed
+		}
+	}
+
+	c.matrix = v.Counters
+	c.width = v.Width
+	c.depth = v.Depth
+	c.epsilon = v.Epsilon
+	c.delta = v.Delta
+	c.count = v.Count
+	c.hash = newDefaultHash()
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding the HyperLogLog's
+// parameters as fields and its registers in base64.
+func (h *HyperLogLog) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hyperLogLogJSON{
+		B:         h.b,
+		Alpha:     h.alpha,
+		Registers: h.registers,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, restoring the HyperLogLog from
+// the form written by MarshalJSON.
+func (h *HyperLogLog) UnmarshalJSON(data []byte) error {
+	var v hyperLogLogJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.B > maxHLLPrecision || uint64(len(v.Registers)) != hllRegistersSize(1<<v.B) {
+		return errJSONMalformed
+	}
+
+	h.registers = v.Registers
+	h.m = 1 << v.B
+	h.b = v.B
+	h.alpha = v.Alpha
+	h.hash = fnv.New32()
+	return nil
+}
@@ -0,0 +1,140 @@
+package boom
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Ensures that a BloomFilter is encoded with its parameters as fields and its
+// bits in base64, and round-trips through JSON.
+func TestBloomJSON(t *testing.T) {
+	f := NewBloomFilter(10, 0.01)
+	f.Add([]byte(`a`))
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `{"m":96,"k":7,"count":1,"data":"`) {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+
+	other := &BloomFilter{}
+	if err := json.Unmarshal(data, other); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Equal(f) || !other.Test([]byte(`a`)) {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+
+	// The filter can be embedded in other JSON documents.
+	var config struct {
+		Name    string       `json:"name"`
+		Blocked *BloomFilter `json:"blocked"`
+	}
+	doc := `{"name":"blocklist","blocked":` + string(data) + `}`
+	if err := json.Unmarshal([]byte(doc), &config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.Blocked.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	for _, malformed := range []string{
+		`{"m":96,"k":7,"count":1,"data":"AAAA"}`,
+		`{"m":96,"k":0,"count":1,"data":"AAAAAAAAAAAAAAAA"}`,
+		`{"m":96,"k":7,"indexing":3,"count":1,"data":"AAAAAAAAAAAAAAAA"}`,
+		`{"m":96,"k":7,"count":1,"data":"not base64"}`,
+	} {
+		if err := other.UnmarshalJSON([]byte(malformed)); err == nil {
+			t.Errorf("Expected error for %s", malformed)
+		}
+	}
+}
+
+// Ensures that the remaining structures round-trip through JSON.
+func TestJSONRoundTrip(t *testing.T) {
+	counting := NewCountingBloomFilter(100, 2, 0.01)
+	counting.EnableSpill()
+	for i := 0; i < 10; i++ {
+		counting.Add([]byte(`a`))
+		counting.Add([]byte(strconv.Itoa(i)))
+	}
+	other := &CountingBloomFilter{}
+	data, err := json.Marshal(counting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, other); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Equal(counting) {
+		t.Errorf("Expected %s, got %s", counting, other)
+	}
+	for i := 0; i < 10; i++ {
+		other.TestAndRemove([]byte(`a`))
+	}
+	if !other.Test([]byte(`5`)) || other.Test([]byte(`a`)) {
+		t.Error("Expected spilled counts to be restored")
+	}
+
+	cms := NewCountMinSketch(0.01, 0.99)
+	cms.Add([]byte(`a`)).Add([]byte(`a`)).Add([]byte(`b`))
+	otherCMS := &CountMinSketch{}
+	data, _ = json.Marshal(cms)
+	if err := json.Unmarshal(data, otherCMS); err != nil {
+		t.Fatal(err)
+	}
+	if !otherCMS.Equal(cms) || otherCMS.Count([]byte(`a`)) != 2 {
+		t.Errorf("Expected %s, got %s", cms, otherCMS)
+	}
+	if err := otherCMS.UnmarshalJSON([]byte(`{"width":2,"depth":1,"counters":[[1]]}`)); err == nil {
+		t.Error("Expected error for a short row")
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	otherHLL := &HyperLogLog{}
+	data, _ = json.Marshal(hll)
+	if err := json.Unmarshal(data, otherHLL); err != nil {
+		t.Fatal(err)
+	}
+	if !otherHLL.Equal(hll) || otherHLL.Count() != hll.Count() {
+		t.Errorf("Expected %s, got %s", hll, otherHLL)
+	}
+	if err := otherHLL.UnmarshalJSON([]byte(`{"b":10,"alpha":0.7,"registers":"AAAA"}`)); err == nil {
+		t.Error("Expected error for missing registers")
+	}
+	if err := otherHLL.UnmarshalJSON([]byte(`{"b":33,"alpha":0.7,"registers":"AAAA"}`)); err == nil {
+		t.Error("Expected error for too many registers")
+	}
+
+	for _, malformed := range []string{
+		`{"m":0,"k":1,"bucket_size":4,"count":0,"data":""}`,
+		`{"m":2,"k":0,"bucket_size":4,"count":0,"data":"AA=="}`,
+		`{"m":2,"k":3,"bucket_size":4,"count":0,"data":"AA=="}`,
+	} {
+		if err := (&CountingBloomFilter{}).UnmarshalJSON([]byte(malformed)); err == nil {
+			t.Errorf("Expected error for %s", malformed)
+		}
+	}
+}
+
+func BenchmarkBloomMarshalJSON(b *testing.B) {
+	f := NewBloomFilter(100000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		json.Marshal(f)
+	}
+}
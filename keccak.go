@@ -0,0 +1,102 @@
+package boom
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// keccakRate is the number of bytes absorbed per permutation by Keccak-256.
+const keccakRate = 136
+
+// keccakRoundConstants are the round constants of the Keccak-f[1600]
+// permutation.
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var (
+	// keccakRotations are the lane rotations of the rho step, in the order
+	// lanes are visited by the pi step.
+	keccakRotations = [24]int{
+		1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14,
+		27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44,
+	}
+
+	// keccakLanes is the order lanes are visited by the pi step.
+	keccakLanes = [24]int{
+		10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4,
+		15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1,
+	}
+)
+
+// keccak256 returns the Keccak-256 hash of the data as used by Ethereum. This
+// is the original Keccak submission, which differs from the standardized
+// SHA3-256 in its padding.
+func keccak256(data []byte) [32]byte {
+	var state [25]uint64
+
+	for len(data) >= keccakRate {
+		keccakAbsorb(&state, data[:keccakRate])
+		data = data[keccakRate:]
+	}
+
+	var block [keccakRate]byte
+	copy(block[:], data)
+	block[len(data)] = 0x01
+	block[keccakRate-1] |= 0x80
+	keccakAbsorb(&state, block[:])
+
+	var sum [32]byte
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(sum[i*8:], state[i])
+	}
+	return sum
+}
+
+// keccakAbsorb XORs a block into the state and applies the permutation.
+func keccakAbsorb(state *[25]uint64, block []byte) {
+	for i := 0; i < keccakRate/8; i++ {
+		state[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+	}
+	keccakF1600(state)
+}
+
+// keccakF1600 applies the Keccak-f[1600] permutation to the state.
+func keccakF1600(state *[25]uint64) {
+	var c [5]uint64
+	for round := 0; round < 24; round++ {
+		// Theta.
+		for i := 0; i < 5; i++ {
+			c[i] = state[i] ^ state[i+5] ^ state[i+10] ^ state[i+15] ^ state[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := c[(i+4)%5] ^ bits.RotateLeft64(c[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				state[j+i] ^= t
+			}
+		}
+
+		// Rho and pi.
+		t := state[1]
+		for i := 0; i < 24; i++ {
+			j := keccakLanes[i]
+			t, state[j] = state[j], bits.RotateLeft64(t, keccakRotations[i])
+		}
+
+		// Chi.
+		for j := 0; j < 25; j += 5 {
+			copy(c[:], state[j:j+5])
+			for i := 0; i < 5; i++ {
+				state[j+i] ^= ^c[(i+1)%5] & c[(i+2)%5]
+			}
+		}
+
+		// Iota.
+		state[0] ^= keccakRoundConstants[round]
+	}
+}
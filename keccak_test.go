@@ -0,0 +1,34 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Ensures that keccak256 matches known test vectors, including inputs that
+// span multiple blocks.
+func TestKeccak256(t *testing.T) {
+	vectors := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte(``), "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{[]byte(`abc`), "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{bytes.Repeat([]byte(`a`), 200), "96ea54061def936c4be90b518992fdc6f12f535068a256229aca54267b4d084d"},
+	}
+
+	for _, v := range vectors {
+		sum := keccak256(v.data)
+		if got := hex.EncodeToString(sum[:]); got != v.expected {
+			t.Errorf("Expected %s, got %s", v.expected, got)
+		}
+	}
+}
+
+func BenchmarkKeccak256(b *testing.B) {
+	data := []byte(`the quick brown fox jumps over the lazy dog`)
+	for n := 0; n < b.N; n++ {
+		keccak256(data)
+	}
+}
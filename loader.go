@@ -0,0 +1,191 @@
+package boom
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+const (
+	// defaultLoaderBatch is the number of keys a Loader adds at a time unless
+	// set with SetBatchSize.
+	defaultLoaderBatch = 1024
+
+	// loaderBufferSize is the size of the buffers a Loader copies keys into.
+	loaderBufferSize = 64 * 1024
+
+	// maxLoaderLine is the longest line a Loader reads from an i/o stream.
+	maxLoaderLine = 1 << 20
+)
+
+// Loader bulk-loads keys into a Filter, such as when initializing a filter
+// from a dump of many gigabytes of keys. Keys are gathered into batches which
+// are added with a single AddMany call if the filter has one, so that filters
+// like SynchronizedFilter take their lock once per batch rather than once per
+// key. A progress function can be set to be called after every batch.
+//
+// A Loader isn't safe for concurrent use, but any number of loaders can load
+// into the same filter if the filter is.
+type Loader struct {
+	filter   Filter              // filter being loaded
+	batch    [][]byte            // keys waiting to be added
+	buf      []byte              // storage for copied keys
+	size     int                 // number of keys per batch
+	progress func(loaded uint64) // called after each batch
+	loaded   uint64              // number of keys added
+}
+
+// NewLoader creates a new Loader which adds keys to the filter.
+func NewLoader(filter Filter) *Loader {
+	return &Loader{filter: filter, size: defaultLoaderBatch}
+}
+
+// SetBatchSize sets the number of keys added at a time, which defaults to
+// 1024. Sizes below one are treated as one.
+func (l *Loader) SetBatchSize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	l.size = size
+}
+
+// SetProgress sets a function which is called with the total number of keys
+// loaded after each batch is added, such as to log progress.
+func (l *Loader) SetProgress(progress func(loaded uint64)) {
+	l.progress = progress
+}
+
+// Loaded returns the total number of keys the Loader has added.
+func (l *Loader) Loaded() uint64 {
+	return l.loaded
+}
+
+// LoadReader adds each line of the stream as a key until it's exhausted.
+// Lines may end with "\n" or "\r\n", and empty lines are skipped. Lines longer
+// than 1 MiB are an error. It returns the number of keys added.
+func (l *Loader) LoadReader(stream io.Reader) (uint64, error) {
+	return l.LoadReaderContext(context.Background(), stream)
+}
+
+// LoadReaderContext is like LoadReader, but stops with the context's error
+// once the context is done. The context is checked after each batch, and the
+// keys added before it's cancelled remain in the filter.
+func (l *Loader) LoadReaderContext(ctx context.Context, stream io.Reader) (uint64, error) {
+	start := l.loaded
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, loaderBufferSize), maxLoaderLine)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if l.add(scanner.Bytes(), true) {
+			if err := ctx.Err(); err != nil {
+				return l.loaded - start, err
+			}
+		}
+	}
+	l.flush()
+	return l.loaded - start, scanner.Err()
+}
+
+// LoadFunc adds the keys returned by calling next until it returns io.EOF,
+// which isn't treated as an error. Keys are copied, so next may reuse its
+// buffer. It returns the number of keys added.
+func (l *Loader) LoadFunc(next func() ([]byte, error)) (uint64, error) {
+	return l.LoadFuncContext(context.Background(), next)
+}
+
+// LoadFuncContext is like LoadFunc, but stops with the context's error once
+// the context is done. The context is checked after each batch, and the keys
+// added before it's cancelled remain in the filter.
+func (l *Loader) LoadFuncContext(ctx context.Context, next func() ([]byte, error)) (uint64, error) {
+	start := l.loaded
+	for {
+		key, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			l.flush()
+			return l.loaded - start, err
+		}
+		if l.add(key, true) {
+			if err := ctx.Err(); err != nil {
+				return l.loaded - start, err
+			}
+		}
+	}
+	l.flush()
+	return l.loaded - start, nil
+}
+
+// LoadChannel adds the keys received from the channel until it's closed. The
+// keys aren't copied, so they must not be modified after they're sent. It
+// returns the number of keys added.
+func (l *Loader) LoadChannel(keys <-chan []byte) uint64 {
+	n, _ := l.LoadChannelContext(context.Background(), keys)
+	return n
+}
+
+// LoadChannelContext is like LoadChannel, but stops with the context's error
+// once the context is done, even if no keys are being sent. The keys received
+// before it's cancelled are added to the filter.
+func (l *Loader) LoadChannelContext(ctx context.Context, keys <-chan []byte) (uint64, error) {
+	start := l.loaded
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				l.flush()
+				return l.loaded - start, nil
+			}
+			l.add(key, false)
+		case <-ctx.Done():
+			l.flush()
+			return l.loaded - start, ctx.Err()
+		}
+	}
+}
+
+// add adds the key to the batch, copying it if the caller may reuse it, and
+// adds the batch once it's full. It returns true if the batch was added.
+func (l *Loader) add(key []byte, copied bool) bool {
+	if copied {
+		// Keys are copied into shared buffers rather than allocated
+		// individually. Buffers are never reused, since filters such as
+		// InverseBloomFilter retain the keys added to them.
+		if len(l.buf)+len(key) > cap(l.buf) {
+			l.buf = make([]byte, 0, max(len(key), loaderBufferSize))
+		}
+		offset := len(l.buf)
+		l.buf = append(l.buf, key...)
+		key = l.buf[offset:len(l.buf):len(l.buf)]
+	}
+	l.batch = append(l.batch, key)
+	if len(l.batch) < l.size {
+		return false
+	}
+	l.flush()
+	return true
+}
+
+// flush adds the batch to the filter and reports progress.
+func (l *Loader) flush() {
+	if len(l.batch) == 0 {
+		return
+	}
+	if many, ok := l.filter.(interface{ AddMany([][]byte) Filter }); ok {
+		many.AddMany(l.batch)
+	} else {
+		for _, key := range l.batch {
+			l.filter.Add(key)
+		}
+	}
+	l.loaded += uint64(len(l.batch))
+
+	clear(l.batch)
+	l.batch = l.batch[:0]
+	if l.progress != nil {
+		l.progress(l.loaded)
+	}
+}
@@ -0,0 +1,192 @@
+package boom
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// batchFilter is a Filter which records the batches added with AddMany.
+type batchFilter struct {
+	*BloomFilter
+	batches []int
+}
+
+func (b *batchFilter) AddMany(data [][]byte) Filter {
+	b.batches = append(b.batches, len(data))
+	return b.BloomFilter.AddMany(data)
+}
+
+// Ensures that LoadReader adds each non-empty line in batches and reports
+// progress after each batch.
+func TestLoaderLoadReader(t *testing.T) {
+	var (
+		f        = &batchFilter{BloomFilter: NewBloomFilter(100, 0.01)}
+		l        = NewLoader(f)
+		progress []uint64
+	)
+	l.SetBatchSize(2)
+	l.SetProgress(func(loaded uint64) {
+		progress = append(progress, loaded)
+	})
+
+	n, err := l.LoadReader(strings.NewReader("a\nb\r\n\nc\nd\ne"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("Expected 5, got %d", n)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if !f.Test([]byte(key)) {
+			t.Errorf("`%s` should be a member", key)
+		}
+	}
+	if f.Test([]byte("b\r")) {
+		t.Error("Expected line endings to be trimmed")
+	}
+
+	if len(f.batches) != 3 || f.batches[0] != 2 || f.batches[2] != 1 {
+		t.Errorf("Expected batches of 2, 2, and 1, got %v", f.batches)
+	}
+	if len(progress) != 3 || progress[2] != 5 {
+		t.Errorf("Expected progress of 2, 4, and 5, got %v", progress)
+	}
+
+	if _, err := l.LoadReader(strings.NewReader("f\ng")); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := l.Loaded(); loaded != 7 {
+		t.Errorf("Expected 7, got %d", loaded)
+	}
+
+	long := strings.Repeat("x", maxLoaderLine+1)
+	if _, err := l.LoadReader(strings.NewReader(long)); err == nil {
+		t.Error("Expected error for a line longer than the maximum")
+	}
+}
+
+// Ensures that LoadFunc copies keys, so that filters which retain them are
+// unaffected by the function reusing its buffer.
+func TestLoaderLoadFunc(t *testing.T) {
+	var (
+		f   = NewInverseBloomFilter(1000)
+		buf = make([]byte, 0, 8)
+		i   = 0
+	)
+	next := func() ([]byte, error) {
+		if i == 100 {
+			return nil, io.EOF
+		}
+		buf = strconv.AppendInt(buf[:0], int64(i), 10)
+		i++
+		return buf, nil
+	}
+
+	l := NewLoader(f)
+	l.SetBatchSize(16)
+	n, err := l.LoadFunc(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Errorf("Expected 100, got %d", n)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	fail := func() ([]byte, error) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := l.LoadFunc(fail); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+// Ensures that LoadChannel adds the keys received until the channel is closed.
+func TestLoaderLoadChannel(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	keys := make(chan []byte)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			keys <- []byte(strconv.Itoa(i))
+		}
+		close(keys)
+	}()
+
+	if n := NewLoader(f).LoadChannel(keys); n != 1000 {
+		t.Errorf("Expected 1000, got %d", n)
+	}
+	if count := f.Count(); count != 1000 {
+		t.Errorf("Expected 1000, got %d", count)
+	}
+	if !f.Test([]byte(`999`)) {
+		t.Error("`999` should be a member")
+	}
+}
+
+// Ensures that the context variants stop once the context is cancelled,
+// keeping the keys already added.
+func TestLoaderContext(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	l := NewLoader(f)
+	l.SetBatchSize(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	l.SetProgress(func(loaded uint64) {
+		if loaded == 4 {
+			cancel()
+		}
+	})
+
+	n, err := l.LoadReaderContext(ctx, strings.NewReader("a\nb\nc\nd\ne\nf"))
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if n != 4 || !f.Test([]byte(`d`)) || f.Test([]byte(`e`)) {
+		t.Errorf("Expected 4 keys up to `d`, got %d", n)
+	}
+
+	i := 0
+	next := func() ([]byte, error) {
+		i++
+		return []byte(strconv.Itoa(i)), nil
+	}
+	if _, err := l.LoadFuncContext(ctx, next); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if i != 2 {
+		t.Errorf("Expected to stop after a batch, got %d keys", i)
+	}
+
+	keys := make(chan []byte, 1)
+	keys <- []byte(`g`)
+	n, err = l.LoadChannelContext(ctx, keys)
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if n == 1 && !f.Test([]byte(`g`)) {
+		t.Error("`g` should be a member")
+	}
+}
+
+func BenchmarkLoaderLoadReader(b *testing.B) {
+	var keys strings.Builder
+	for i := 0; i < 100000; i++ {
+		keys.WriteString(strconv.Itoa(i))
+		keys.WriteByte('\n')
+	}
+	data := keys.String()
+	f := NewBloomFilter(100000, 0.01)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		NewLoader(f).LoadReader(strings.NewReader(data))
+	}
+}
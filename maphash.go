@@ -0,0 +1,63 @@
+//go:build !tinygo
+
+package boom
+
+import (
+	"hash"
+	"hash/maphash"
+	"math/bits"
+)
+
+// newMapHash is NewMapHash, or nil when it isn't available, for NewFromConfig.
+var newMapHash = NewMapHash
+
+// mapHashSeed is the seed shared by every hash returned by NewMapHash, so
+// filters in the same process hash data identically and can be merged.
+var mapHashSeed = maphash.MakeSeed()
+
+// NewMapHash returns a hash.Hash64 backed by hash/maphash for use as a filter's
+// hash kernel with SetHash. maphash is considerably faster than FNV, especially
+// for strings, and resists hash flooding since it's seeded randomly when the
+// process starts. As a result, its values differ between processes, so filters
+// using it must only be used in memory and never serialized or shared with
+// another process. It isn't available when building with TinyGo.
+func NewMapHash() hash.Hash64 {
+	h := new(maphash.Hash)
+	h.SetSeed(mapHashSeed)
+	return h
+}
+
+// mapHashSum returns a stateless equivalent of the hash if it's a maphash, or
+// nil if not.
+func mapHashSum(h hash.Hash64) func(data []byte) uint64 {
+	mh, ok := h.(*maphash.Hash)
+	if !ok {
+		return nil
+	}
+
+	// maphash's Sum is little-endian, so swap the bytes to split the sum the
+	// same way hashKernel does.
+	seed := mh.Seed()
+	return func(data []byte) uint64 {
+		return bits.ReverseBytes64(maphash.Bytes(seed, data))
+	}
+}
+
+// sum64 returns the hash's sum as Sum would encode it in big-endian order.
+// maphash's Sum is little-endian, so its Sum64 is byte-swapped.
+func sum64(h hash.Hash64) uint64 {
+	if _, ok := h.(*maphash.Hash); ok {
+		return bits.ReverseBytes64(h.Sum64())
+	}
+	return h.Sum64()
+}
+
+// mapHashString returns the sum of the string as split by hashKernel if the
+// hash is a maphash, without converting it to a byte slice, and false if not.
+func mapHashString(h hash.Hash64, data string) (uint64, bool) {
+	mh, ok := h.(*maphash.Hash)
+	if !ok {
+		return 0, false
+	}
+	return bits.ReverseBytes64(maphash.String(mh.Seed(), data)), true
+}
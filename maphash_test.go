@@ -0,0 +1,100 @@
+//go:build !tinygo
+
+package boom
+
+import (
+	"hash"
+	"hash/fnv"
+	"strconv"
+	"testing"
+)
+
+// Ensures that filters using NewMapHash have no false negatives and agree with
+// each other within a process.
+func TestMapHash(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	f.SetHash(NewMapHash())
+	other := NewBloomFilter(1000, 0.01)
+	other.SetHash(NewMapHash())
+
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		other.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	for i := uint(0); i < f.buckets.Count(); i++ {
+		if f.buckets.Get(i) != other.buckets.Get(i) {
+			t.Fatal("Expected filters using NewMapHash to be identical")
+		}
+	}
+
+	fps := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Test([]byte(strconv.Itoa(i))) {
+			fps++
+		}
+	}
+	if fps > 200 {
+		t.Errorf("Expected at most 200 false positives, got %d", fps)
+	}
+}
+
+// Ensures that filters using NewMapHash or other custom hashes can be frozen
+// and agree with the filter.
+func TestBloomFreezeHash(t *testing.T) {
+	// FNV-1a can be cloned, while the wrapped hash can only be shared.
+	for _, h := range []hash.Hash64{NewMapHash(), fnv.New64a(), struct{ hash.Hash64 }{fnv.New64a()}} {
+		f := NewBloomFilter(1000, 0.01)
+		f.SetHash(h)
+		for i := 0; i < 1000; i++ {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+
+		frozen := f.Freeze()
+		for i := 0; i < 5000; i++ {
+			data := []byte(strconv.Itoa(i))
+			if frozen.Test(data) != f.Test(data) {
+				t.Errorf("%T: Expected frozen filter to agree for `%s`", h, data)
+			}
+		}
+	}
+}
+
+func BenchmarkMapHashBloomAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewBloomFilter(100000, 0.1)
+	f.SetHash(NewMapHash())
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+// Ensures that strings are hashed with NewMapHash as their bytes would be,
+// without allocating.
+func TestMapHashString(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	f.SetHash(NewMapHash())
+	f.AddString(`a`)
+	if !f.Test([]byte(`a`)) || !f.TestString(`a`) {
+		t.Error("`a` should be a member")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.TestAndAddString("user-1234")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %.0f", allocs)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build tinygo
+
+package boom
+
+import "hash"
+
+// newMapHash is nil since NewMapHash isn't available with TinyGo.
+var newMapHash func() hash.Hash64
+
+// mapHashSum returns nil since NewMapHash isn't available with TinyGo.
+func mapHashSum(h hash.Hash64) func(data []byte) uint64 {
+	return nil
+}
+
+// mapHashString returns false since NewMapHash isn't available with TinyGo.
+func mapHashString(h hash.Hash64, data string) (uint64, bool) {
+	return 0, false
+}
+
+// sum64 returns the hash's Sum64, which matches Sum without maphash.
+func sum64(h hash.Hash64) uint64 {
+	return h.Sum64()
+}
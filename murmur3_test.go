@@ -0,0 +1,44 @@
+package boom
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Ensures that murmur3Sum32 matches the reference test vectors.
+func TestMurmur3Sum32(t *testing.T) {
+	vectors := []struct {
+		expected uint32
+		seed     uint32
+		data     string
+	}{
+		{0x00000000, 0x00000000, ""},
+		{0x6a396f08, 0xfba4c795, ""},
+		{0x81f16f39, 0xffffffff, ""},
+		{0x514e28b7, 0x00000000, "00"},
+		{0xea3f0b17, 0xfba4c795, "00"},
+		{0xfd6cf10d, 0x00000000, "ff"},
+		{0x16c6b7ab, 0x00000000, "0011"},
+		{0x8eb51c3d, 0x00000000, "001122"},
+		{0xb4471bf8, 0x00000000, "00112233"},
+		{0xe2301fa8, 0x00000000, "0011223344"},
+		{0xfc2e4a15, 0x00000000, "001122334455"},
+		{0xb074502c, 0x00000000, "00112233445566"},
+		{0x8034d2a0, 0x00000000, "0011223344556677"},
+		{0xb4698def, 0x00000000, "001122334455667788"},
+	}
+
+	for _, v := range vectors {
+		data, _ := hex.DecodeString(v.data)
+		if sum := murmur3Sum32(v.seed, data); sum != v.expected {
+			t.Errorf("Expected %#08x for %q, got %#08x", v.expected, v.data, sum)
+		}
+	}
+}
+
+func BenchmarkMurmur3Sum32(b *testing.B) {
+	data := []byte(`the quick brown fox jumps over the lazy dog`)
+	for n := 0; n < b.N; n++ {
+		murmur3Sum32(0, data)
+	}
+}
@@ -0,0 +1,277 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// OddSketch implements an Odd Sketch as described by Mitzenmacher, Pagh, and
+// Pham in Efficient Estimation for High Similarities using Odd Sketches:
+//
+// http://www.itu.dk/people/pagh/papers/oddsketch.pdf
+//
+// An Odd Sketch is a bit array where each element flips the bit it hashes to,
+// so a bit is set if an odd number of elements hashed to it. The XOR of two
+// sketches is the sketch of the symmetric difference of the two sets, and the
+// number of set bits in it is used to estimate the size of the difference.
+//
+// Odd Sketches are most useful in combination with MinHash. Sketching the k
+// minimum hash values of each set rather than the sets themselves estimates
+// the Jaccard similarity of near-identical sets far more accurately than
+// comparing the MinHash signatures directly, using only a few bits per
+// signature value.
+type OddSketch struct {
+	bits *Buckets    // sketch data
+	hash hash.Hash64 // hash function
+	m    uint        // sketch size
+	k    uint        // number of MinHash values sketched, zero if not MinHash
+}
+
+// minOddSketchBits is the smallest sketch size for which the symmetric
+// difference can be estimated, since each element flips one of m bits and the
+// estimate divides by log(1 - 2/m).
+const minOddSketchBits = 3
+
+// NewOddSketch creates a new Odd Sketch with m bits, or three bits if m is
+// smaller.
+func NewOddSketch(m uint) *OddSketch {
+	if m < minOddSketchBits {
+		m = minOddSketchBits
+	}
+	return &OddSketch{
+		bits: NewBuckets(m, 1),
+		hash: newDefaultHash(),
+		m:    m,
+	}
+}
+
+// NewOddSketchE is like NewOddSketch but returns an error if m is less than
+// three.
+func NewOddSketchE(m uint) (*OddSketch, error) {
+	if m < minOddSketchBits {
+		return nil, errors.New("m must be at least 3")
+	}
+	return NewOddSketch(m), nil
+}
+
+// NewMinHashOddSketch creates a new Odd Sketch with m bits of the k minimum
+// hash values of the bag. Sketches created this way can be compared with
+// Similarity.
+func NewMinHashOddSketch(bag []string, k, m uint) *OddSketch {
+	o := NewOddSketch(m)
+	o.k = k
+
+	signature := make([]uint64, k)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for _, element := range bag {
+		lower, upper := hashKernel([]byte(element), o.hash)
+		base := uint64(upper)<<32 | uint64(lower)
+		for i := uint64(0); i < uint64(k); i++ {
+			// Derive each hash function by mixing the base hash with a
+			// per-function offset. Unlike the linear combination used to
+			// pick filter indices, this keeps the minimums independent.
+			h := base + i*0x9e3779b97f4a7c15
+			h ^= h >> 33
+			h *= 0xff51afd7ed558ccd
+			h ^= h >> 33
+			h *= 0xc4ceb9fe1a85ec53
+			h ^= h >> 33
+			if h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+
+	// Each signature value is sketched along with its position so that equal
+	// values from different hash functions are distinct elements.
+	value := make([]byte, 16)
+	for i, min := range signature {
+		binary.BigEndian.PutUint64(value, uint64(i))
+		binary.BigEndian.PutUint64(value[8:], min)
+		o.Add(value)
+	}
+
+	return o
+}
+
+// Size returns the number of bits in the sketch.
+func (o *OddSketch) Size() uint {
+	return o.m
+}
+
+// SetHash sets the hashing function used in the sketch. Sketches must use the
+// same hashing function to be compared.
+func (o *OddSketch) SetHash(h hash.Hash64) {
+	o.hash = h
+}
+
+// Add will flip the bit the data hashes to. Adding the same data twice
+// cancels out. Returns the OddSketch to allow for chaining.
+func (o *OddSketch) Add(data []byte) *OddSketch {
+	lower, upper := hashKernel(data, o.hash)
+	idx := DoubleHashing.index(lower, upper, 1, o.m)
+	o.bits.Set(idx, uint8(1-o.bits.Get(idx)))
+	return o
+}
+
+// Merge combines this OddSketch with another by XORing them, which results in
+// the sketch of the symmetric difference of the two sets. Returns an error if
+// the sketch sizes are not equal.
+func (o *OddSketch) Merge(other *OddSketch) error {
+	if o.m != other.m {
+		return errors.New("sketch size must match")
+	}
+
+	for i := uint(0); i < o.m; i++ {
+		o.bits.Set(i, uint8(o.bits.Get(i)^other.bits.Get(i)))
+	}
+
+	return nil
+}
+
+// SymmetricDifference returns the estimated size of the symmetric difference
+// between the set summarized by this sketch and the set summarized by the
+// other. Returns an error if the sketch sizes are not equal.
+func (o *OddSketch) SymmetricDifference(other *OddSketch) (float64, error) {
+	if o.m != other.m {
+		return 0, errors.New("sketch size must match")
+	}
+
+	odd := 0
+	for i := uint(0); i < o.m; i++ {
+		odd += int(o.bits.Get(i) ^ other.bits.Get(i))
+	}
+
+	// Each element of the difference flips a random bit, so the expected
+	// fraction of odd bits after d elements is (1 - (1 - 2/m)^d) / 2.
+	ratio := 1 - 2*float64(odd)/float64(o.m)
+	if ratio <= 0 {
+		return math.Inf(1), nil
+	}
+	return math.Log(ratio) / math.Log(1-2/float64(o.m)), nil
+}
+
+// Similarity returns the estimated Jaccard similarity between the bags
+// summarized by two sketches created with NewMinHashOddSketch. Returns an
+// error if the sketches weren't created from the same number of MinHash
+// values or their sizes are not equal.
+func (o *OddSketch) Similarity(other *OddSketch) (float64, error) {
+	if o.k == 0 || o.k != other.k {
+		return 0, errors.New("number of MinHash values must match")
+	}
+
+	diff, err := o.SymmetricDifference(other)
+	if err != nil {
+		return 0, err
+	}
+
+	// Each differing MinHash value contributes two elements to the symmetric
+	// difference of the signatures.
+	similarity := 1 - diff/float64(2*o.k)
+	if similarity < 0 {
+		similarity = 0
+	}
+	return similarity, nil
+}
+
+// WriteTo writes a binary representation of the OddSketch to an i/o stream.
+// It returns the number of bytes written.
+func (o *OddSketch) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(o.m), uint64(o.k)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := o.bits.WriteTo(stream)
+	return written + n, err
+}
+
+// ReadFrom reads a binary representation of an OddSketch (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (o *OddSketch) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 2)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	bits := &Buckets{}
+	n, err := bits.ReadFrom(stream)
+	read += n
+	if err != nil {
+		return read, err
+	}
+	if bits.bucketSize != 1 || uint64(bits.count) != header[0] || header[0] < minOddSketchBits {
+		return read, errors.New("invalid odd sketch dimensions")
+	}
+
+	o.bits = bits
+	if o.hash == nil {
+		o.hash = newDefaultHash()
+	}
+	o.m = uint(header[0])
+	o.k = uint(header[1])
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (o *OddSketch) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := o.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (o *OddSketch) GobDecode(data []byte) error {
+	_, err := o.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's data.
+func (o *OddSketch) ByteSize() uint {
+	return o.bits.ByteSize()
+}
+
+// String returns a one-line summary of the OddSketch for logging and debugging.
+func (o *OddSketch) String() string {
+	return fmt.Sprintf("OddSketch{m=%d k=%d}", o.m, o.k)
+}
+
+// Reset restores the OddSketch to its original state. It returns itself to
+// allow for chaining.
+func (o *OddSketch) Reset() *OddSketch {
+	o.bits.Reset()
+	return o
+}
+
+// Copy returns a deep copy of the OddSketch. Returns ErrHashNotCloneable if
+// the sketch's hash can't be cloned.
+func (o *OddSketch) Copy() (*OddSketch, error) {
+	hash, err := copyHash64(o.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *o
+	copied.bits = o.bits.Copy()
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other OddSketch has the same parameters, hashing
+// function, and bits.
+func (o *OddSketch) Equal(other *OddSketch) bool {
+	return o.m == other.m && o.k == other.k && sameHash(o.hash, other.hash) &&
+		o.bits.Equal(other.bits)
+}
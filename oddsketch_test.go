@@ -0,0 +1,172 @@
+package boom
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Add flips bits so adding the same data twice cancels out.
+func TestOddSketchAdd(t *testing.T) {
+	o := NewOddSketch(128)
+
+	if o.Add([]byte(`a`)) != o {
+		t.Error("Returned OddSketch should be the same instance")
+	}
+	o.Add([]byte(`a`))
+
+	for i := uint(0); i < o.Size(); i++ {
+		if o.bits.Get(i) != 0 {
+			t.Error("Expected all bits to be unset")
+		}
+	}
+}
+
+// Ensures that NewOddSketchE rejects sizes below three and that NewOddSketch
+// uses three bits instead, so that the symmetric difference is a number.
+func TestNewOddSketchE(t *testing.T) {
+	if o, err := NewOddSketchE(128); err != nil || o.Size() != 128 {
+		t.Errorf("Expected an OddSketch of 128 bits, got error %v", err)
+	}
+
+	for m := uint(0); m < 3; m++ {
+		if _, err := NewOddSketchE(m); err == nil {
+			t.Errorf("Expected error for m = %d", m)
+		}
+
+		o, other := NewOddSketch(m), NewOddSketch(m)
+		if o.Size() != 3 {
+			t.Errorf("Expected 3, got %d", o.Size())
+		}
+		o.Add([]byte(`a`))
+		if diff, err := o.SymmetricDifference(other); err != nil || math.IsNaN(diff) || diff <= 0 {
+			t.Errorf("Expected a positive difference, got %f, %v", diff, err)
+		}
+	}
+}
+
+// Ensures that SymmetricDifference approximates the size of the difference.
+func TestOddSketchSymmetricDifference(t *testing.T) {
+	var (
+		a = NewOddSketch(4096)
+		b = NewOddSketch(4096)
+	)
+	for i := 0; i < 10000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 10000; i < 10200; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+	}
+
+	diff, err := a.SymmetricDifference(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(diff-200) > 40 {
+		t.Errorf("Expected approximately 200, got %f", diff)
+	}
+
+	if _, err := a.SymmetricDifference(NewOddSketch(10)); err == nil {
+		t.Error("Expected error for mismatched sketch sizes")
+	}
+}
+
+// Ensures that Merge produces the sketch of the symmetric difference.
+func TestOddSketchMerge(t *testing.T) {
+	var (
+		a = NewOddSketch(1024)
+		b = NewOddSketch(1024)
+	)
+	a.Add([]byte(`a`)).Add([]byte(`b`))
+	b.Add([]byte(`b`)).Add([]byte(`c`))
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NewOddSketch(1024).Add([]byte(`a`)).Add([]byte(`c`))
+	if diff, _ := a.SymmetricDifference(expected); diff != 0 {
+		t.Errorf("Expected 0, got %f", diff)
+	}
+
+	if err := a.Merge(NewOddSketch(10)); err == nil {
+		t.Error("Expected error for mismatched sketch sizes")
+	}
+}
+
+// Ensures that Similarity approximates the Jaccard similarity of bags.
+func TestOddSketchSimilarity(t *testing.T) {
+	bag1 := make([]string, 1000)
+	bag2 := make([]string, 1000)
+	for i := range bag1 {
+		bag1[i] = strconv.Itoa(i)
+		bag2[i] = strconv.Itoa(i)
+	}
+	// 990 shared out of 1010 total elements.
+	for i := 0; i < 10; i++ {
+		bag2[i] = "other" + strconv.Itoa(i)
+	}
+
+	var (
+		a = NewMinHashOddSketch(bag1, 1000, 512)
+		b = NewMinHashOddSketch(bag2, 1000, 512)
+	)
+
+	similarity, err := a.Similarity(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(similarity-990.0/1010.0) > 0.02 {
+		t.Errorf("Expected approximately 0.98, got %f", similarity)
+	}
+
+	if _, err := a.Similarity(NewOddSketch(512)); err == nil {
+		t.Error("Expected error comparing with a non-MinHash sketch")
+	}
+}
+
+// Ensures that Reset unsets every bit.
+func TestOddSketchReset(t *testing.T) {
+	o := NewOddSketch(128).Add([]byte(`a`))
+
+	if o.Reset() != o {
+		t.Error("Returned OddSketch should be the same instance")
+	}
+
+	for i := uint(0); i < o.Size(); i++ {
+		if o.bits.Get(i) != 0 {
+			t.Error("Expected all bits to be unset")
+		}
+	}
+}
+
+// Ensures that an OddSketch round-trips through WriteTo and ReadFrom.
+func TestOddSketchWriteToReadFrom(t *testing.T) {
+	o := NewOddSketch(1024)
+	for i := 0; i < 100; i++ {
+		o.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := o.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &OddSketch{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if d, err := o.SymmetricDifference(other); err != nil || d != 0 {
+		t.Errorf("Expected 0, got %f, %v", d, err)
+	}
+
+	empty := &OddSketch{bits: NewBuckets(0, 1)}
+	if _, err := empty.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.ReadFrom(&buf); err == nil {
+		t.Error("Expected error for a zero size")
+	}
+}
@@ -0,0 +1,543 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+const (
+	// parquetBlockWords is the number of 32-bit words in each 256-bit block
+	// of a split-block Bloom filter, one per hash function.
+	parquetBlockWords = 8
+
+	// parquetBlockBytes is the size of each block in bytes.
+	parquetBlockBytes = parquetBlockWords * 4
+
+	// parquetMaxBytes is the largest bitset Parquet writers produce, which
+	// is also the largest ReadFrom accepts.
+	parquetMaxBytes = 128 << 20
+)
+
+// parquetSalt is the odd constants which each block's word is multiplied by
+// to derive the bit set in it.
+var parquetSalt = [parquetBlockWords]uint32{
+	0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+	0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+}
+
+// ParquetBloomFilter implements the split-block Bloom filter Apache Parquet
+// stores for column chunks, so that the filters produced by data-lake tooling
+// can be queried in-process and filters built in Go can be written into
+// Parquet files.
+//
+// The bitset is split into 256-bit blocks of eight 32-bit words. Data is
+// hashed with the 64-bit xxHash, whose upper half picks a block and whose
+// lower half, multiplied by a different salt for each word, sets one bit in
+// each of the block's words, so testing touches a single 32-byte block.
+// Parquet hashes the plain encoding of each value, such as the eight
+// little-endian bytes of an INT64 or the bytes of a BYTE_ARRAY without its
+// length, so data should be encoded the same way to match filters written by
+// other tools.
+type ParquetBloomFilter struct {
+	words []uint32 // bitset, eight words per block
+	count uint     // number of items added
+}
+
+// NewParquetBloomFilter creates a new Parquet split-block Bloom filter
+// optimized to store n items with a specified target false-positive rate,
+// sized as Parquet writers do: the optimal size is rounded up to a power of
+// two bytes, between 32 bytes and 128 MiB.
+func NewParquetBloomFilter(n uint, fpRate float64) *ParquetBloomFilter {
+	return &ParquetBloomFilter{words: make([]uint32, parquetOptimalBytes(n, fpRate)/4)}
+}
+
+// NewParquetBloomFilterE is like NewParquetBloomFilter, but returns an error
+// if n is zero or fpRate isn't between 0 and 1.
+func NewParquetBloomFilterE(n uint, fpRate float64) (*ParquetBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	return NewParquetBloomFilter(n, fpRate), nil
+}
+
+// NewParquetBloomFilterFromBytes creates a Parquet split-block Bloom filter
+// from its bitset, without the header ReadFrom expects, such as when the
+// header was parsed by a Parquet library. The data is copied. Returns an error
+// if the bitset isn't a positive whole number of 32-byte blocks.
+func NewParquetBloomFilterFromBytes(bitset []byte) (*ParquetBloomFilter, error) {
+	if len(bitset) == 0 || len(bitset)%parquetBlockBytes != 0 {
+		return nil, errors.New("parquet bloom filter bitset must be a positive multiple of 32 bytes")
+	}
+	p := &ParquetBloomFilter{words: make([]uint32, len(bitset)/4)}
+	for i := range p.words {
+		p.words[i] = binary.LittleEndian.Uint32(bitset[i*4:])
+	}
+	return p, nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (p *ParquetBloomFilter) Capacity() uint {
+	return uint(len(p.words)) * 32
+}
+
+// K returns the number of hash functions, which is always eight.
+func (p *ParquetBloomFilter) K() uint {
+	return parquetBlockWords
+}
+
+// Count returns the number of items added to the filter. It's zero for
+// filters read with ReadFrom or created from bytes.
+func (p *ParquetBloomFilter) Count() uint {
+	return p.count
+}
+
+// Bytes returns the filter's bitset, the words in little-endian order, as
+// stored in a Parquet file after the header.
+func (p *ParquetBloomFilter) Bytes() []byte {
+	bitset := make([]byte, len(p.words)*4)
+	for i, word := range p.words {
+		binary.LittleEndian.PutUint32(bitset[i*4:], word)
+	}
+	return bitset
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (p *ParquetBloomFilter) Test(data []byte) bool {
+	return p.TestHash(xxHash64(data))
+}
+
+// TestHash is like Test, but takes the data's 64-bit xxHash with a seed of
+// zero, such as one computed by a Parquet library.
+func (p *ParquetBloomFilter) TestHash(hash uint64) bool {
+	block := p.block(hash)
+	key := uint32(hash)
+
+	// If any of the block's words doesn't have its bit set, then it's not a
+	// member.
+	for i, salt := range parquetSalt {
+		if block[i]&(1<<((key*salt)>>27)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (p *ParquetBloomFilter) Add(data []byte) Filter {
+	return p.AddHash(xxHash64(data))
+}
+
+// AddHash is like Add, but takes the data's 64-bit xxHash with a seed of zero,
+// such as one computed by a Parquet library.
+func (p *ParquetBloomFilter) AddHash(hash uint64) Filter {
+	block := p.block(hash)
+	key := uint32(hash)
+
+	// Set a bit in each of the block's words.
+	for i, salt := range parquetSalt {
+		block[i] |= 1 << ((key * salt) >> 27)
+	}
+
+	p.count++
+	return p
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (p *ParquetBloomFilter) TestAndAdd(data []byte) bool {
+	hash := xxHash64(data)
+	block := p.block(hash)
+	key := uint32(hash)
+	member := true
+
+	// Set a bit in each of the block's words, noting whether any weren't set
+	// already.
+	for i, salt := range parquetSalt {
+		bit := uint32(1) << ((key * salt) >> 27)
+		if block[i]&bit == 0 {
+			member = false
+			block[i] |= bit
+		}
+	}
+
+	p.count++
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (p *ParquetBloomFilter) ByteSize() uint {
+	return uint(len(p.words)) * 4
+}
+
+// String returns a one-line summary of the ParquetBloomFilter for logging and
+// debugging.
+func (p *ParquetBloomFilter) String() string {
+	return fmt.Sprintf("ParquetBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		p.Capacity(), parquetBlockWords, p.count, estimatedFPRate(p.Capacity(), parquetBlockWords, p.count))
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (p *ParquetBloomFilter) Reset() *ParquetBloomFilter {
+	clear(p.words)
+	p.count = 0
+	return p
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (p *ParquetBloomFilter) Clear() {
+	p.Reset()
+}
+
+// WriteTo writes the filter to an i/o stream as it's stored in a Parquet file
+// at a column chunk's bloom_filter_offset: a BloomFilterHeader, encoded with
+// Thrift's compact protocol, declaring the size of the bitset and the
+// split-block algorithm, xxHash, and no compression, followed by the bitset.
+// It returns the number of bytes written.
+func (p *ParquetBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	numBytes := int32(len(p.words) * 4)
+
+	// Field 1, numBytes, is a zigzag-encoded i32, and fields 2 to 4 are
+	// unions whose first member, an empty struct, is set.
+	header := []byte{0x15}
+	header = binary.AppendUvarint(header, uint64(uint32(numBytes<<1^numBytes>>31)))
+	for i := 0; i < 3; i++ {
+		header = append(header, 0x1c, 0x1c, 0x00, 0x00)
+	}
+	header = append(header, 0x00)
+
+	n, err := stream.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	n, err = stream.Write(p.Bytes())
+	return written + int64(n), err
+}
+
+// ReadFrom reads a filter as it's stored in a Parquet file (such as might have
+// been written by WriteTo()) from an i/o stream. Fields of the header added
+// in later versions of Parquet are skipped. It returns the number of bytes
+// read and an error if the filter uses an algorithm, hash, or compression
+// other than the split-block algorithm, xxHash, and none, or its bitset is
+// larger than 128 MiB.
+func (p *ParquetBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	r := &thriftReader{r: stream}
+	numBytes, err := readParquetHeader(r)
+	if err != nil {
+		return r.n, err
+	}
+
+	bitset := make([]byte, numBytes)
+	n, err := io.ReadFull(stream, bitset)
+	read := r.n + int64(n)
+	if err != nil {
+		return read, err
+	}
+
+	filter, err := NewParquetBloomFilterFromBytes(bitset)
+	if err != nil {
+		return read, err
+	}
+	*p = *filter
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (p *ParquetBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (p *ParquetBloomFilter) GobDecode(data []byte) error {
+	_, err := p.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// block returns the words of the block the hash picks, from its upper half.
+func (p *ParquetBloomFilter) block(hash uint64) []uint32 {
+	blocks := uint64(len(p.words) / parquetBlockWords)
+	i := ((hash >> 32) * blocks) >> 32
+	return p.words[i*parquetBlockWords : (i+1)*parquetBlockWords]
+}
+
+// parquetOptimalBytes returns the size in bytes Parquet writers give a filter
+// for n items with the false-positive rate: the optimal number of bits for
+// eight hash functions in 32-bit words, rounded up to a power of two bytes
+// between 32 and 128 MiB.
+func parquetOptimalBytes(n uint, fpRate float64) uint {
+	m := -8 * float64(n) / math.Log(1-math.Pow(fpRate, 1.0/parquetBlockWords))
+	size := uint(parquetBlockBytes)
+	if !(m/8 > parquetBlockBytes) {
+		return size
+	}
+	if m/8 >= parquetMaxBytes {
+		return parquetMaxBytes
+	}
+	return 1 << bits.Len(uint(math.Ceil(m/8))-1)
+}
+
+// readParquetHeader reads a Parquet BloomFilterHeader encoded with Thrift's
+// compact protocol and returns the size of the bitset which follows.
+func readParquetHeader(r *thriftReader) (int, error) {
+	var (
+		numBytes int64 = -1
+		unions   [5]bool
+		id       int64
+	)
+	for {
+		fieldType, fieldID, err := r.readFieldHeader(id)
+		if err != nil {
+			return 0, err
+		}
+		if fieldType == thriftStop {
+			break
+		}
+		id = fieldID
+
+		switch {
+		case id == 1 && fieldType == thriftI32:
+			if numBytes, err = r.readZigzag(); err != nil {
+				return 0, err
+			}
+		case id >= 2 && id <= 4 && fieldType == thriftStruct:
+			// The algorithm, hash, and compression are unions whose first
+			// members are the split-block algorithm, xxHash, and none.
+			member, err := r.readUnion()
+			if err != nil {
+				return 0, err
+			}
+			if member != 1 {
+				names := [...]string{2: "algorithm", 3: "hash", 4: "compression"}
+				return 0, fmt.Errorf("unsupported parquet bloom filter %s %d", names[id], member)
+			}
+			unions[id] = true
+		default:
+			if err := r.skip(fieldType, 0); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if numBytes < 0 || !unions[2] || !unions[3] || !unions[4] {
+		return 0, errors.New("parquet bloom filter header is missing fields")
+	}
+	if numBytes == 0 || numBytes%parquetBlockBytes != 0 || numBytes > parquetMaxBytes {
+		return 0, fmt.Errorf("invalid parquet bloom filter size %d", numBytes)
+	}
+	return int(numBytes), nil
+}
+
+// Thrift compact protocol field types.
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+
+	// thriftMaxDepth is the deepest nesting of structs and containers
+	// skipped, so that malformed data can't exhaust the stack.
+	thriftMaxDepth = 64
+)
+
+// thriftReader reads values encoded with Thrift's compact protocol a byte at a
+// time, so that it doesn't read past them, and counts the bytes read.
+type thriftReader struct {
+	r   io.Reader
+	n   int64
+	buf [8]byte
+}
+
+// readByte reads a single byte.
+func (t *thriftReader) readByte() (byte, error) {
+	n, err := io.ReadFull(t.r, t.buf[:1])
+	t.n += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return t.buf[0], err
+}
+
+// readVarint reads an unsigned LEB128 varint.
+func (t *thriftReader) readVarint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := t.readByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("thrift varint overflows")
+}
+
+// readZigzag reads a zigzag-encoded varint, used for i16, i32, and i64.
+func (t *thriftReader) readZigzag() (int64, error) {
+	v, err := t.readVarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// readFieldHeader reads the header of a struct's field and returns its type
+// and id, which is encoded as a delta from the previous field's id unless it's
+// too far from it.
+func (t *thriftReader) readFieldHeader(previous int64) (byte, int64, error) {
+	b, err := t.readByte()
+	if err != nil || b == thriftStop {
+		return thriftStop, 0, err
+	}
+	fieldType := b & 0x0f
+	if delta := int64(b >> 4); delta != 0 {
+		return fieldType, previous + delta, nil
+	}
+	id, err := t.readZigzag()
+	return fieldType, id, err
+}
+
+// readUnion reads a union of structs and returns the id of its member, or zero
+// if it's empty. The member's contents are skipped.
+func (t *thriftReader) readUnion() (int64, error) {
+	var member, id int64
+	for {
+		fieldType, fieldID, err := t.readFieldHeader(id)
+		if err != nil {
+			return 0, err
+		}
+		if fieldType == thriftStop {
+			return member, nil
+		}
+		id = fieldID
+		if member == 0 {
+			member = id
+		}
+		if err := t.skip(fieldType, 1); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// skip reads and discards a value of the type, nested at the depth.
+func (t *thriftReader) skip(fieldType byte, depth int) error {
+	if depth > thriftMaxDepth {
+		return errors.New("thrift data is nested too deeply")
+	}
+	switch fieldType {
+	case thriftTrue, thriftFalse:
+		return nil
+	case thriftByte:
+		_, err := t.readByte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := t.readVarint()
+		return err
+	case thriftDouble:
+		n, err := io.ReadFull(t.r, t.buf[:8])
+		t.n += int64(n)
+		return err
+	case thriftBinary:
+		length, err := t.readVarint()
+		if err != nil {
+			return err
+		}
+		if length > math.MaxInt64 {
+			return errors.New("thrift binary length overflows")
+		}
+		n, err := io.CopyN(io.Discard, t.r, int64(length))
+		t.n += n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	case thriftList, thriftSet:
+		b, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		size := uint64(b >> 4)
+		if size == 15 {
+			if size, err = t.readVarint(); err != nil {
+				return err
+			}
+		}
+		return t.skipElements(size, b&0x0f, depth)
+	case thriftMap:
+		size, err := t.readVarint()
+		if err != nil || size == 0 {
+			return err
+		}
+		types, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < size; i++ {
+			if err := t.skipElements(1, types>>4, depth); err != nil {
+				return err
+			}
+			if err := t.skipElements(1, types&0x0f, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftStruct:
+		var id int64
+		for {
+			fieldType, fieldID, err := t.readFieldHeader(id)
+			if err != nil || fieldType == thriftStop {
+				return err
+			}
+			id = fieldID
+			if err := t.skip(fieldType, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid thrift type %d", fieldType)
+	}
+}
+
+// skipElements reads and discards size elements of a container, whose
+// booleans, unlike those of fields, are encoded as a byte each.
+func (t *thriftReader) skipElements(size uint64, elementType byte, depth int) error {
+	for i := uint64(0); i < size; i++ {
+		var err error
+		if elementType == thriftTrue || elementType == thriftFalse {
+			_, err = t.readByte()
+		} else {
+			err = t.skip(elementType, depth+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+// parquetHeader is the BloomFilterHeader Parquet writers produce for a 32-byte
+// bitset.
+var parquetHeader = []byte{
+	0x15, 0x40, // numBytes: 32
+	0x1c, 0x1c, 0x00, 0x00, // algorithm: BLOCK
+	0x1c, 0x1c, 0x00, 0x00, // hash: XXHASH
+	0x1c, 0x1c, 0x00, 0x00, // compression: UNCOMPRESSED
+	0x00,
+}
+
+// Ensures that filters are sized as Parquet writers size them.
+func TestParquetSize(t *testing.T) {
+	tests := []struct {
+		n        uint
+		fpRate   float64
+		expected uint
+	}{
+		{1000, 0.01, 2048},
+		{1, 0.01, 32},
+		{100000, 0.001, 256 << 10},
+		{1 << 31, 0.001, 128 << 20},
+	}
+	for _, test := range tests {
+		if size := parquetOptimalBytes(test.n, test.fpRate); size != test.expected {
+			t.Errorf("Expected %d bytes for n=%d fp=%g, got %d", test.expected, test.n, test.fpRate, size)
+		}
+	}
+
+	f := NewParquetBloomFilter(1000, 0.01)
+	if capacity := f.Capacity(); capacity != 2048*8 {
+		t.Errorf("Expected %d, got %d", 2048*8, capacity)
+	}
+	if k := f.K(); k != 8 {
+		t.Errorf("Expected 8, got %d", k)
+	}
+}
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestParquetTestAndAdd(t *testing.T) {
+	f := NewParquetBloomFilter(100, 0.01)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned ParquetBloomFilter should be the same instance")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if !f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if !f.TestHash(xxHash64([]byte(`b`))) {
+		t.Error("`b` should be a member by its hash")
+	}
+
+	if count := f.Count(); count != 3 {
+		t.Errorf("Expected 3, got %d", count)
+	}
+
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 100; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("Expected %d to be a member", i)
+		}
+	}
+
+	f.Reset()
+	if f.Test([]byte(`a`)) || f.Count() != 0 {
+		t.Error("Expected the filter to be empty after Reset")
+	}
+}
+
+// Ensures that the filter sets the bits the Parquet specification describes.
+func TestParquetBits(t *testing.T) {
+	f := NewParquetBloomFilter(1000, 0.01)
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, 42)
+	f.Add(value)
+
+	hash := xxHash64(value)
+	blocks := uint64(f.Capacity() / 256)
+	block := (hash >> 32) * blocks >> 32
+	salt := []uint32{
+		0x47b6137b, 0x44974d91, 0x8824ad5b, 0xa2b7289d,
+		0x705495c7, 0x2df1424b, 0x9efc4947, 0x5c6bfb31,
+	}
+	bitset := f.Bytes()
+	for i, s := range salt {
+		bit := uint32(hash) * s >> 27
+		word := binary.LittleEndian.Uint32(bitset[block*32+uint64(i)*4:])
+		if word&(1<<bit) == 0 {
+			t.Errorf("Expected bit %d of word %d of block %d to be set", bit, i, block)
+		}
+	}
+	if set := popCountBytes(bitset); set != 8 {
+		t.Errorf("Expected 8 bits set, got %d", set)
+	}
+}
+
+// Ensures that WriteTo writes the header Parquet expects and ReadFrom reads it
+// back.
+func TestParquetWriteReadFrom(t *testing.T) {
+	f := NewParquetBloomFilter(1, 0.01)
+	f.Add([]byte(`a`))
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || n != int64(len(parquetHeader)+32) {
+		t.Errorf("Expected %d bytes, got %d", len(parquetHeader)+32, n)
+	}
+	if !bytes.Equal(buf.Bytes()[:len(parquetHeader)], parquetHeader) {
+		t.Errorf("Unexpected header % x", buf.Bytes()[:len(parquetHeader)])
+	}
+
+	buf.WriteString("trailing")
+	read := &ParquetBloomFilter{}
+	if n, err := read.ReadFrom(&buf); err != nil || n != int64(len(parquetHeader)+32) {
+		t.Fatalf("Expected %d bytes read, got %d, %v", len(parquetHeader)+32, n, err)
+	}
+	if buf.String() != "trailing" {
+		t.Error("Expected ReadFrom not to read past the filter")
+	}
+	if !read.Test([]byte(`a`)) || !bytes.Equal(read.Bytes(), f.Bytes()) {
+		t.Error("Expected the read filter to match")
+	}
+
+	data, err := f.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ParquetBloomFilter{}
+	if err := decoded.GobDecode(data); err != nil || !decoded.Test([]byte(`a`)) {
+		t.Errorf("Expected the decoded filter to match, got %v", err)
+	}
+}
+
+// Ensures that ReadFrom skips header fields it doesn't know, including ones
+// with long-form ids.
+func TestParquetReadFromUnknownFields(t *testing.T) {
+	var data []byte
+	data = append(data, parquetHeader[:len(parquetHeader)-1]...)
+	data = append(data, 0x18, 0x03, 'a', 'b', 'c') // field 5: binary
+	data = append(data, 0x09, 0xc8, 0x01)          // field 100: list
+	data = append(data, 0x25, 0x02, 0x04)          // of two i32s
+	data = append(data, 0x00)
+	data = append(data, make([]byte, 32)...)
+
+	f := &ParquetBloomFilter{}
+	if n, err := f.ReadFrom(bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("Expected %d bytes read, got %d, %v", len(data), n, err)
+	}
+	if f.Capacity() != 256 {
+		t.Errorf("Expected 256, got %d", f.Capacity())
+	}
+}
+
+// Ensures that ReadFrom rejects filters it can't query and malformed data.
+func TestParquetReadFromErrors(t *testing.T) {
+	unsupported := append([]byte(nil), parquetHeader...)
+	unsupported[7] = 0x2c // hash: a second member
+	truncated := append(append([]byte(nil), parquetHeader...), make([]byte, 16)...)
+	missing := []byte{0x15, 0x40, 0x00}
+	invalid := append([]byte(nil), parquetHeader...)
+	invalid[1] = 0x3e // numBytes: 31
+
+	for name, data := range map[string][]byte{
+		"unsupported": unsupported,
+		"truncated":   truncated,
+		"missing":     missing,
+		"invalid":     invalid,
+		"empty":       nil,
+		"header":      parquetHeader[:5],
+	} {
+		if _, err := (&ParquetBloomFilter{}).ReadFrom(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := NewParquetBloomFilterFromBytes(make([]byte, 31)); err == nil {
+		t.Error("Expected an error for a partial block")
+	}
+}
+
+// Ensures that NewParquetBloomFilterE returns errors for invalid parameters.
+func TestNewParquetBloomFilterE(t *testing.T) {
+	if _, err := NewParquetBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected an error for n of zero")
+	}
+	if _, err := NewParquetBloomFilterE(100, 1); err == nil {
+		t.Error("Expected an error for a rate of one")
+	}
+	if f, err := NewParquetBloomFilterE(100, 0.01); err != nil || f.Capacity() == 0 {
+		t.Errorf("Expected a filter, got %v", err)
+	}
+}
+
+func BenchmarkParquetAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewParquetBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkParquetTest(b *testing.B) {
+	b.StopTimer()
+	f := NewParquetBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
@@ -16,8 +16,12 @@ copies or substantial portions of the Software.
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
-	"hash/fnv"
+	"io"
 	"math"
 )
 
@@ -56,13 +60,29 @@ func NewPartitionedBloomFilter(n uint, fpRate float64) *PartitionedBloomFilter {
 
 	return &PartitionedBloomFilter{
 		partitions: partitions,
-		hash:       fnv.New64(),
+		hash:       newDefaultHash(),
 		m:          m,
 		k:          k,
 		s:          s,
 	}
 }
 
+// NewPartitionedBloomFilterE is like NewPartitionedBloomFilter but returns an
+// error if n is zero, fpRate isn't between 0 and 1, or the filter would be too
+// large to address.
+func NewPartitionedBloomFilterE(n uint, fpRate float64) (*PartitionedBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+	return NewPartitionedBloomFilter(n, fpRate), nil
+}
+
 // Capacity returns the Bloom filter capacity, m.
 func (p *PartitionedBloomFilter) Capacity() uint {
 	return p.m
@@ -87,26 +107,44 @@ func (p *PartitionedBloomFilter) EstimatedFillRatio() float64 {
 func (p *PartitionedBloomFilter) FillRatio() float64 {
 	t := float64(0)
 	for i := uint(0); i < p.k; i++ {
-		sum := uint32(0)
-		for j := uint(0); j < p.partitions[i].Count(); j++ {
-			sum += p.partitions[i].Get(j)
-		}
-		t += (float64(sum) / float64(p.s))
+		t += float64(p.partitions[i].nonZero()) / float64(p.s)
 	}
 	return t / float64(p.k)
 }
 
+// EstimateFPRate returns the current expected false-positive rate, the product
+// of the ratios of set bits in each partition. It grows as the filter fills, so
+// it can be monitored to detect when a long-lived filter has degraded past its
+// target.
+func (p *PartitionedBloomFilter) EstimateFPRate() float64 {
+	rate := 1.0
+	for _, partition := range p.partitions {
+		rate *= partition.nonZeroRatio()
+	}
+	return rate
+}
+
+// SetHash sets the hashing function used in the filter.
+func (p *PartitionedBloomFilter) SetHash(h hash.Hash64) {
+	p.hash = h
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives but a zero probability of false
 // negatives. Due to the way the filter is partitioned, the probability of
 // false positives is uniformly distributed across all elements.
 func (p *PartitionedBloomFilter) Test(data []byte) bool {
-	lower, upper := hashKernel(data, p.hash)
+	return p.TestHash(hashKernel(data, p.hash))
+}
 
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (p *PartitionedBloomFilter) TestHash(lower, upper uint32) bool {
 	// If any of the K partition bits are not set, then it's not a member.
 	for i := uint(0); i < p.k; i++ {
-		if p.partitions[i].Get((uint(lower)+uint(upper)*i)%p.s) == 0 {
+		if p.partitions[i].Get(DoubleHashing.index(lower, upper, i, p.s)) == 0 {
 			return false
 		}
 	}
@@ -117,11 +155,17 @@ func (p *PartitionedBloomFilter) Test(data []byte) bool {
 // Add will add the data to the Bloom filter. It returns the filter to allow
 // for chaining.
 func (p *PartitionedBloomFilter) Add(data []byte) Filter {
-	lower, upper := hashKernel(data, p.hash)
+	p.AddHash(hashKernel(data, p.hash))
+	return p
+}
 
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (p *PartitionedBloomFilter) AddHash(lower, upper uint32) Filter {
 	// Set the K partition bits.
 	for i := uint(0); i < p.k; i++ {
-		p.partitions[i].Set((uint(lower)+uint(upper)*i)%p.s, 1)
+		p.partitions[i].Set(DoubleHashing.index(lower, upper, i, p.s), 1)
 	}
 
 	p.count++
@@ -136,7 +180,7 @@ func (p *PartitionedBloomFilter) TestAndAdd(data []byte) bool {
 
 	// If any of the K partition bits are not set, then it's not a member.
 	for i := uint(0); i < p.k; i++ {
-		idx := (uint(lower) + uint(upper)*i) % p.s
+		idx := DoubleHashing.index(lower, upper, i, p.s)
 		if p.partitions[i].Get(idx) == 0 {
 			member = false
 		}
@@ -147,11 +191,192 @@ func (p *PartitionedBloomFilter) TestAndAdd(data []byte) bool {
 	return member
 }
 
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (p *PartitionedBloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		p.AddHash(hashKernel(element, p.hash))
+	}
+	return p
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element.
+func (p *PartitionedBloomFilter) TestMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = p.TestHash(hashKernel(element, p.hash))
+	}
+	return results
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (p *PartitionedBloomFilter) TestString(data string) bool {
+	return p.TestHash(hashKernelString(data, p.hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (p *PartitionedBloomFilter) AddString(data string) Filter {
+	return p.AddHash(hashKernelString(data, p.hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (p *PartitionedBloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, p.hash)
+	member := p.TestHash(lower, upper)
+	p.AddHash(lower, upper)
+	return member
+}
+
+// WriteTo writes a binary representation of the PartitionedBloomFilter to an
+// i/o stream. It returns the number of bytes written.
+func (p *PartitionedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(p.count), uint64(p.m), uint64(p.k), uint64(p.s)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, partition := range p.partitions {
+		n, err := partition.WriteTo(stream)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a PartitionedBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (p *PartitionedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if !validPartitionedDimensions(header[1], header[2], header[3]) {
+		return read, errors.New("invalid partitioned bloom filter dimensions")
+	}
+	partitions := make([]*Buckets, header[2])
+	for i := range partitions {
+		partitions[i] = &Buckets{}
+		n, err := partitions[i].ReadFrom(stream)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if uint64(partitions[i].count) != header[3] {
+			return read, errors.New("invalid partitioned bloom filter dimensions")
+		}
+	}
+
+	p.partitions = partitions
+	if p.hash == nil {
+		p.hash = newDefaultHash()
+	}
+	p.count = uint(header[0])
+	p.m = uint(header[1])
+	p.k = uint(header[2])
+	p.s = uint(header[3])
+	return read, nil
+}
+
+// validPartitionedDimensions returns whether m bits split into k partitions of
+// s bits each are dimensions the constructor could have chosen, with at least
+// one bit in each partition and s the rounded-up share of m.
+func validPartitionedDimensions(m, k, s uint64) bool {
+	if k == 0 || k > maxK || s == 0 {
+		return false
+	}
+	share := m / k
+	if m%k != 0 {
+		share++
+	}
+	return s == share
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (p *PartitionedBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (p *PartitionedBloomFilter) GobDecode(data []byte) error {
+	_, err := p.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (p *PartitionedBloomFilter) ByteSize() uint {
+	size := uint(0)
+	for _, partition := range p.partitions {
+		size += partition.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the PartitionedBloomFilter for logging
+// and debugging.
+func (p *PartitionedBloomFilter) String() string {
+	return fmt.Sprintf("PartitionedBloomFilter{m=%d k=%d count=%d fill=%.4f fp=%.4g}",
+		p.m, p.k, p.count, p.EstimatedFillRatio(), estimatedFPRate(p.m, p.k, p.count))
+}
+
 // Reset restores the Bloom filter to its original state. It returns the filter
 // to allow for chaining.
 func (p *PartitionedBloomFilter) Reset() *PartitionedBloomFilter {
 	for _, partition := range p.partitions {
 		partition.Reset()
 	}
+	p.count = 0
 	return p
 }
+
+// Copy returns a deep copy of the PartitionedBloomFilter. Returns
+// ErrHashNotCloneable if the filter's hash can't be cloned.
+func (p *PartitionedBloomFilter) Copy() (*PartitionedBloomFilter, error) {
+	hash, err := copyHash64(p.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *p
+	copied.partitions = make([]*Buckets, len(p.partitions))
+	for i, partition := range p.partitions {
+		copied.partitions[i] = partition.Copy()
+	}
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other PartitionedBloomFilter has the same
+// parameters, hashing function, and partitions and count.
+func (p *PartitionedBloomFilter) Equal(other *PartitionedBloomFilter) bool {
+	if p.m != other.m || p.k != other.k || p.s != other.s || p.count != other.count ||
+		!sameHash(p.hash, other.hash) || len(p.partitions) != len(other.partitions) {
+		return false
+	}
+	for i, partition := range p.partitions {
+		if !partition.Equal(other.partitions[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (p *PartitionedBloomFilter) Clear() {
+	p.Reset()
+}
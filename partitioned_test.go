@@ -14,6 +14,26 @@ func TestPartitionedBloomCapacity(t *testing.T) {
 	}
 }
 
+// Ensures that NewPartitionedBloomFilterE returns an error for invalid
+// parameters.
+func TestNewPartitionedBloomFilterE(t *testing.T) {
+	if f, err := NewPartitionedBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a PartitionedBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewPartitionedBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewPartitionedBloomFilterE(100, -0.5); err == nil {
+		t.Error("Expected error for fpRate < 0")
+	}
+
+	if _, err := NewPartitionedBloomFilterE(100, 1.5); err == nil {
+		t.Error("Expected error for fpRate > 1")
+	}
+}
+
 // Ensures that K returns the number of hash functions in the Bloom Filter.
 func TestPartitionedBloomK(t *testing.T) {
 	f := NewPartitionedBloomFilter(100, 0.1)
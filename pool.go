@@ -0,0 +1,120 @@
+package boom
+
+import (
+	"fmt"
+	"hash"
+)
+
+// defaultSlabFilters is the number of filters allocated at once by a
+// BloomFilterPool.
+const defaultSlabFilters = 256
+
+// BloomFilterPool allocates many small Bloom filters with the same parameters,
+// such as per-user sets of seen items. Rather than allocating each filter's
+// storage separately, filters are carved out of large slabs and recycled when
+// returned with Put, which avoids the garbage collection pressure of millions
+// of small allocations.
+//
+// Filters allocated by a pool share a single hash function, so they must not
+// be used concurrently with one another. The pool itself is not safe for
+// concurrent use.
+type BloomFilterPool struct {
+	free    []*BloomFilter        // filters available for reuse
+	isFree  map[*BloomFilter]bool // whether a filter is on the free list
+	hash    hash.Hash64           // hash function shared by every filter
+	m       uint                  // filter size
+	k       uint                  // number of hash functions
+	size    uint                  // bytes of storage per filter
+	slabs   uint                  // number of slabs allocated
+	inUse   uint                  // number of filters handed out
+	perSlab uint                  // number of filters per slab
+}
+
+// NewBloomFilterPool creates a new BloomFilterPool of Bloom filters optimized
+// to store n items with a specified target false-positive rate.
+func NewBloomFilterPool(n uint, fpRate float64) *BloomFilterPool {
+	m := OptimalM(n, fpRate)
+	return &BloomFilterPool{
+		isFree:  make(map[*BloomFilter]bool),
+		hash:    newDefaultHash(),
+		m:       m,
+		k:       OptimalK(fpRate),
+		size:    (m + 7) / 8,
+		perSlab: defaultSlabFilters,
+	}
+}
+
+// Get returns an empty Bloom filter from the pool, allocating a new slab of
+// filters if none are available.
+func (p *BloomFilterPool) Get() *BloomFilter {
+	if len(p.free) == 0 {
+		p.allocate()
+	}
+
+	filter := p.free[len(p.free)-1]
+	p.free = p.free[:len(p.free)-1]
+	delete(p.isFree, filter)
+	p.inUse++
+	return filter
+}
+
+// Put resets the filter and returns it to the pool for reuse. The filter must
+// not be used after it has been returned. Filters which weren't allocated by
+// the pool, or which have already been returned, are ignored.
+func (p *BloomFilterPool) Put(filter *BloomFilter) {
+	if filter.hash != p.hash || filter.m != p.m || filter.k != p.k || p.isFree[filter] {
+		return
+	}
+
+	filter.Reset()
+	p.free = append(p.free, filter)
+	p.isFree[filter] = true
+	p.inUse--
+}
+
+// InUse returns the number of filters which have been handed out by Get and
+// not yet returned with Put.
+func (p *BloomFilterPool) InUse() uint {
+	return p.inUse
+}
+
+// allocate adds a new slab of filters to the free list.
+func (p *BloomFilterPool) allocate() {
+	var (
+		data    = make([]byte, p.perSlab*p.size)
+		buckets = make([]Buckets, p.perSlab)
+		filters = make([]BloomFilter, p.perSlab)
+	)
+
+	for i := uint(0); i < p.perSlab; i++ {
+		start, end := i*p.size, (i+1)*p.size
+		buckets[i] = Buckets{
+			data:       data[start:end:end],
+			bucketSize: 1,
+			max:        1,
+			count:      p.m,
+		}
+		filters[i] = BloomFilter{
+			buckets: &buckets[i],
+			hash:    p.hash,
+			m:       p.m,
+			k:       p.k,
+		}
+		p.free = append(p.free, &filters[i])
+		p.isFree[&filters[i]] = true
+	}
+	p.slabs++
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the pool's
+// data, including the filters handed out.
+func (p *BloomFilterPool) ByteSize() uint {
+	return p.slabs * p.perSlab * p.size
+}
+
+// String returns a one-line summary of the BloomFilterPool for logging and
+// debugging.
+func (p *BloomFilterPool) String() string {
+	return fmt.Sprintf("BloomFilterPool{m=%d k=%d inUse=%d bytes=%d}",
+		p.m, p.k, p.inUse, p.ByteSize())
+}
@@ -0,0 +1,84 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Get returns empty filters with the pool's parameters.
+func TestBloomFilterPoolGet(t *testing.T) {
+	p := NewBloomFilterPool(100, 0.01)
+	expected := NewBloomFilter(100, 0.01)
+
+	filters := make([]*BloomFilter, 300)
+	for i := range filters {
+		filters[i] = p.Get()
+		if filters[i].Capacity() != expected.Capacity() || filters[i].K() != expected.K() {
+			t.Fatal("Expected filter parameters to match")
+		}
+		filters[i].Add([]byte(strconv.Itoa(i)))
+	}
+
+	// Filters carved from the same slab must not share storage.
+	for i, f := range filters {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+		if count := f.Count(); count != 1 {
+			t.Errorf("Expected 1, got %d", count)
+		}
+	}
+
+	if inUse := p.InUse(); inUse != 300 {
+		t.Errorf("Expected 300, got %d", inUse)
+	}
+
+	// 300 filters need two slabs.
+	if bytes := p.ByteSize(); bytes != 2*defaultSlabFilters*((expected.Capacity()+7)/8) {
+		t.Errorf("Expected two slabs, got %d bytes", bytes)
+	}
+}
+
+// Ensures that Put resets filters and recycles them.
+func TestBloomFilterPoolPut(t *testing.T) {
+	p := NewBloomFilterPool(100, 0.01)
+	f := p.Get()
+	f.Add([]byte(`a`))
+	bytes := p.ByteSize()
+
+	p.Put(f)
+
+	if inUse := p.InUse(); inUse != 0 {
+		t.Errorf("Expected 0, got %d", inUse)
+	}
+
+	// Filters from elsewhere, and filters returned twice, are ignored.
+	p.Put(NewBloomFilter(100, 0.01))
+	p.Put(f)
+	if inUse := p.InUse(); inUse != 0 {
+		t.Errorf("Expected 0, got %d", inUse)
+	}
+
+	seen := make(map[*BloomFilter]bool)
+	for i := 0; i < defaultSlabFilters; i++ {
+		f := p.Get()
+		if f.Test([]byte(`a`)) {
+			t.Fatal("`a` should not be a member")
+		}
+		if seen[f] {
+			t.Fatal("Expected every filter to be handed out once")
+		}
+		seen[f] = true
+	}
+
+	if p.ByteSize() != bytes {
+		t.Errorf("Expected %d, got %d", bytes, p.ByteSize())
+	}
+}
+
+func BenchmarkBloomFilterPoolGet(b *testing.B) {
+	p := NewBloomFilterPool(100, 0.01)
+	for n := 0; n < b.N; n++ {
+		p.Get()
+	}
+}
@@ -0,0 +1,176 @@
+package boom
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PrefixExtractor returns the prefix of a key which is indexed by a
+// PrefixBloomFilter. It returns false if the key is outside of the
+// extractor's domain, i.e. it doesn't have a prefix.
+type PrefixExtractor func(key []byte) ([]byte, bool)
+
+// FixedPrefix returns a PrefixExtractor which extracts the first n bytes of
+// a key. Keys shorter than n bytes are outside of its domain.
+func FixedPrefix(n int) PrefixExtractor {
+	return func(key []byte) ([]byte, bool) {
+		if len(key) < n {
+			return nil, false
+		}
+		return key[:n], true
+	}
+}
+
+// DelimitedPrefix returns a PrefixExtractor which extracts the first fields
+// delimiter-separated fields of a key, including the trailing delimiter. For
+// example, DelimitedPrefix('|', 2) extracts "tenant|user|" from the composite
+// key "tenant|user|ts". Keys with fewer fields are outside of its domain.
+func DelimitedPrefix(delimiter byte, fields int) PrefixExtractor {
+	return func(key []byte) ([]byte, bool) {
+		end := 0
+		for i := 0; i < fields; i++ {
+			idx := bytes.IndexByte(key[end:], delimiter)
+			if idx < 0 {
+				return nil, false
+			}
+			end += idx + 1
+		}
+		return key[:end], true
+	}
+}
+
+// PrefixBloomFilter implements a prefix Bloom filter as used by RocksDB:
+//
+// https://github.com/facebook/rocksdb/wiki/Prefix-Seek
+//
+// Rather than the keys themselves, a prefix Bloom filter indexes a prefix of
+// each key chosen by a configurable PrefixExtractor. Testing a prefix
+// indicates whether any key sharing it may have been added, which lets a scan
+// over keys with a common prefix be skipped entirely when the filter says
+// none exist. Point lookups test the prefix of the key, so they have a higher
+// rate of false positives than a filter indexing whole keys.
+//
+// With whole-key filtering, the keys are indexed in the same filter as their
+// prefixes, so point lookups are screened by both the prefix and the key
+// while prefix scans are still screened by the prefix.
+//
+// Prefix Bloom filters are useful for composite keys, such as
+// "tenant|user|timestamp," where queries usually scan every key belonging to
+// a tenant or user.
+type PrefixBloomFilter struct {
+	filter    *BloomFilter    // filter of key prefixes and, optionally, keys
+	extractor PrefixExtractor // extracts the prefix of each key
+	wholeKey  bool            // whether whole keys are also indexed
+}
+
+// NewPrefixBloomFilter creates a new prefix Bloom filter optimized to store n
+// distinct prefixes with a specified target false-positive rate. Prefixes
+// are extracted from keys using the provided PrefixExtractor.
+func NewPrefixBloomFilter(n uint, fpRate float64, extractor PrefixExtractor) *PrefixBloomFilter {
+	return &PrefixBloomFilter{
+		filter:    NewBloomFilter(n, fpRate),
+		extractor: extractor,
+	}
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (p *PrefixBloomFilter) Capacity() uint {
+	return p.filter.Capacity()
+}
+
+// K returns the number of hash functions.
+func (p *PrefixBloomFilter) K() uint {
+	return p.filter.K()
+}
+
+// WholeKeyFiltering returns whether whole keys are indexed along with their
+// prefixes.
+func (p *PrefixBloomFilter) WholeKeyFiltering() bool {
+	return p.wholeKey
+}
+
+// SetWholeKeyFiltering sets whether whole keys are indexed along with their
+// prefixes, as RocksDB's whole_key_filtering option does. Point lookups then
+// have the false-positive rate of a filter of whole keys, and keys outside of
+// the PrefixExtractor's domain can be screened too. The filter should be
+// sized for the number of distinct keys plus prefixes. It must be called
+// before any keys are added.
+func (p *PrefixBloomFilter) SetWholeKeyFiltering(enabled bool) {
+	p.wholeKey = enabled
+}
+
+// Count returns the number of prefixes, and keys with whole-key filtering,
+// added to the filter.
+func (p *PrefixBloomFilter) Count() uint {
+	return p.filter.Count()
+}
+
+// TestPrefix will test whether any key with the prefix has been added and
+// returns true if one may have been, false if not. The prefix should be one
+// produced by the filter's PrefixExtractor. This is a probabilistic test,
+// meaning there is a non-zero probability of false positives but a zero
+// probability of false negatives.
+func (p *PrefixBloomFilter) TestPrefix(prefix []byte) bool {
+	return p.filter.Test(prefix)
+}
+
+// Test will test for membership of the key's prefix, and of the key itself
+// with whole-key filtering, and returns true if it is a member, false if not.
+// Without whole-key filtering, keys outside of the PrefixExtractor's domain
+// can't be screened, so they are always reported as members.
+func (p *PrefixBloomFilter) Test(key []byte) bool {
+	if prefix, ok := p.extractor(key); ok && !p.filter.Test(prefix) {
+		return false
+	}
+	if p.wholeKey {
+		return p.filter.Test(key)
+	}
+	return true
+}
+
+// Add will add the key's prefix to the filter, and the key itself with
+// whole-key filtering. Keys outside of the PrefixExtractor's domain have no
+// prefix to add. It returns the filter to allow for chaining.
+func (p *PrefixBloomFilter) Add(key []byte) Filter {
+	if prefix, ok := p.extractor(key); ok {
+		p.filter.Add(prefix)
+	}
+	if p.wholeKey {
+		p.filter.Add(key)
+	}
+	return p
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the key's prefix, and the key itself with whole-key filtering, is a member,
+// false if not.
+func (p *PrefixBloomFilter) TestAndAdd(key []byte) bool {
+	member := true
+	if prefix, ok := p.extractor(key); ok {
+		member = p.filter.TestAndAdd(prefix)
+	}
+	if p.wholeKey {
+		member = p.filter.TestAndAdd(key) && member
+	}
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (p *PrefixBloomFilter) ByteSize() uint {
+	return p.filter.ByteSize()
+}
+
+// String returns a one-line summary of the PrefixBloomFilter for logging and
+// debugging.
+func (p *PrefixBloomFilter) String() string {
+	return fmt.Sprintf("PrefixBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		p.filter.m, p.filter.k, p.filter.count, estimatedFPRate(p.filter.m, p.filter.k, p.filter.count))
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (p *PrefixBloomFilter) Reset() *PrefixBloomFilter {
+	p.filter.Reset()
+	return p
+}
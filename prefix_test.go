@@ -0,0 +1,130 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that FixedPrefix extracts the first n bytes of keys.
+func TestFixedPrefix(t *testing.T) {
+	extract := FixedPrefix(3)
+
+	if prefix, ok := extract([]byte(`abcdef`)); !ok || string(prefix) != "abc" {
+		t.Errorf("Expected abc, got %s", prefix)
+	}
+
+	if _, ok := extract([]byte(`ab`)); ok {
+		t.Error("Expected ab to be outside of the domain")
+	}
+}
+
+// Ensures that DelimitedPrefix extracts the leading fields of keys.
+func TestDelimitedPrefix(t *testing.T) {
+	extract := DelimitedPrefix('|', 2)
+
+	if prefix, ok := extract([]byte(`tenant|user|ts`)); !ok || string(prefix) != "tenant|user|" {
+		t.Errorf("Expected tenant|user|, got %s", prefix)
+	}
+
+	if _, ok := extract([]byte(`tenant|user`)); ok {
+		t.Error("Expected tenant|user to be outside of the domain")
+	}
+}
+
+// Ensures that TestPrefix, Test, Add, and TestAndAdd behave correctly.
+func TestPrefixBloomTestAndAdd(t *testing.T) {
+	f := NewPrefixBloomFilter(100, 0.01, DelimitedPrefix('|', 2))
+
+	if f.Add([]byte(`acme|alice|1`)) != f {
+		t.Error("Returned PrefixBloomFilter should be the same instance")
+	}
+	f.Add([]byte(`acme|alice|2`))
+
+	if !f.TestPrefix([]byte(`acme|alice|`)) {
+		t.Error("`acme|alice|` should be a member")
+	}
+
+	if f.TestPrefix([]byte(`acme|bob|`)) {
+		t.Error("`acme|bob|` should not be a member")
+	}
+
+	// Point lookups only check the prefix.
+	if !f.Test([]byte(`acme|alice|3`)) {
+		t.Error("`acme|alice|3` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`acme|bob|1`)) {
+		t.Error("`acme|bob|1` should not be a member")
+	}
+
+	if !f.TestPrefix([]byte(`acme|bob|`)) {
+		t.Error("`acme|bob|` should be a member")
+	}
+
+	// Keys without a prefix can't be screened.
+	if !f.Test([]byte(`acme`)) || !f.TestAndAdd([]byte(`acme`)) {
+		t.Error("`acme` should be a member")
+	}
+
+	if count := f.Count(); count != 3 {
+		t.Errorf("Expected 3, got %d", count)
+	}
+}
+
+// Ensures that Reset clears the filter.
+func TestPrefixBloomReset(t *testing.T) {
+	f := NewPrefixBloomFilter(100, 0.01, FixedPrefix(2))
+	for i := 10; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned PrefixBloomFilter should be the same instance")
+	}
+
+	if f.TestPrefix([]byte(`10`)) {
+		t.Error("`10` should not be a member")
+	}
+}
+
+// Ensures that whole-key filtering screens point lookups by the key as well
+// as its prefix.
+func TestPrefixBloomWholeKeyFiltering(t *testing.T) {
+	f := NewPrefixBloomFilter(100, 0.01, DelimitedPrefix('|', 2))
+	if f.WholeKeyFiltering() {
+		t.Error("Expected whole-key filtering to be disabled by default")
+	}
+	f.SetWholeKeyFiltering(true)
+
+	f.Add([]byte(`acme|alice|1`))
+	f.Add([]byte(`acme`))
+
+	if !f.TestPrefix([]byte(`acme|alice|`)) || !f.Test([]byte(`acme|alice|1`)) {
+		t.Error("`acme|alice|1` and its prefix should be members")
+	}
+	if f.Test([]byte(`acme|alice|2`)) {
+		t.Error("`acme|alice|2` should not be a member")
+	}
+	if f.Test([]byte(`acme|bob|1`)) {
+		t.Error("`acme|bob|1` should not be a member")
+	}
+
+	// Keys without a prefix are screened by the key.
+	if !f.Test([]byte(`acme`)) || f.Test([]byte(`initech`)) {
+		t.Error("Expected keys without a prefix to be screened")
+	}
+
+	if f.TestAndAdd([]byte(`acme|alice|2`)) {
+		t.Error("`acme|alice|2` should not be a member")
+	}
+	if !f.TestAndAdd([]byte(`acme|alice|2`)) {
+		t.Error("`acme|alice|2` should be a member")
+	}
+	if f.TestAndAdd([]byte(`initech`)) || !f.Test([]byte(`initech`)) {
+		t.Error("`initech` should have been added")
+	}
+
+	if count := f.Count(); count != 8 {
+		t.Errorf("Expected 8, got %d", count)
+	}
+}
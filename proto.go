@@ -0,0 +1,435 @@
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Protocol buffer wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+var errProtoMalformed = errors.New("malformed protocol buffer")
+
+// protoEncoder writes protocol buffer fields to a buffer. The MarshalProto
+// methods write the messages defined in boom.proto, omitting fields with zero
+// values as proto3 does.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) key(field int, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (e *protoEncoder) uint(field int, v uint64) {
+	if v != 0 {
+		e.key(field, protoVarint)
+		e.buf = binary.AppendUvarint(e.buf, v)
+	}
+}
+
+func (e *protoEncoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *protoEncoder) double(field int, v float64) {
+	if v != 0 {
+		e.key(field, protoFixed64)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+	}
+}
+
+func (e *protoEncoder) bytes(field int, data []byte) {
+	if len(data) != 0 {
+		e.key(field, protoBytes)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(data)))
+		e.buf = append(e.buf, data...)
+	}
+}
+
+// packed writes a repeated integer field in packed encoding.
+func (e *protoEncoder) packed(field int, values []uint64) {
+	if len(values) != 0 {
+		var p []byte
+		for _, v := range values {
+			p = binary.AppendUvarint(p, v)
+		}
+		e.bytes(field, p)
+	}
+}
+
+// message writes a nested message field, which is always present.
+func (e *protoEncoder) message(field int, encode func(e *protoEncoder)) {
+	nested := &protoEncoder{}
+	encode(nested)
+	e.key(field, protoBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(nested.buf)))
+	e.buf = append(e.buf, nested.buf...)
+}
+
+func (e *protoEncoder) buckets(field int, b *Buckets) {
+	e.message(field, func(e *protoEncoder) {
+		e.uint(1, uint64(b.bucketSize))
+		e.uint(2, uint64(b.count))
+		e.bytes(3, b.data)
+	})
+}
+
+// protoField is a field read by decodeProto. Varint and fixed64 values are in
+// v, and length-delimited values in data.
+type protoField struct {
+	number int
+	v      uint64
+	data   []byte
+}
+
+// decodeProto calls fn with each field of the message, in order. Fields of
+// unknown wire types are malformed.
+func decodeProto(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return errProtoMalformed
+		}
+		data = data[n:]
+
+		f := protoField{number: int(key >> 3)}
+		switch key & 7 {
+		case protoVarint:
+			if f.v, n = binary.Uvarint(data); n <= 0 {
+				return errProtoMalformed
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return errProtoMalformed
+			}
+			f.v = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return errProtoMalformed
+			}
+			f.data = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return errProtoMalformed
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// double returns the field's value as a float64.
+func (f protoField) double() float64 {
+	return math.Float64frombits(f.v)
+}
+
+// packed returns the values of a repeated integer field, accepting both packed
+// and unpacked encodings by appending to values.
+func (f protoField) packed(values []uint64) ([]uint64, error) {
+	if f.data == nil {
+		return append(values, f.v), nil
+	}
+	for data := f.data; len(data) > 0; {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProtoMalformed
+		}
+		values = append(values, v)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+// buckets decodes the field as a Buckets message.
+func (f protoField) buckets() (*Buckets, error) {
+	var bucketSize, count uint64
+	var data []byte
+	err := decodeProto(f.data, func(f protoField) error {
+		switch f.number {
+		case 1:
+			bucketSize = f.v
+		case 2:
+			count = f.v
+		case 3:
+			data = append([]byte(nil), f.data...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The number of bits is checked for overflow before it's used to check
+	// the length, so a forged count can't wrap around to a short length.
+	hi, size := bits.Mul64(count, bucketSize)
+	if bucketSize == 0 || bucketSize > 32 || hi != 0 || size > uint64(maxBits) ||
+		uint64(len(data)) != (size+7)/8 {
+		return nil, errProtoMalformed
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return &Buckets{
+		data:       data,
+		bucketSize: uint8(bucketSize),
+		max:        (1 << bucketSize) - 1,
+		count:      uint(count),
+	}, nil
+}
+
+// MarshalProto returns the BloomFilter encoded as the BloomFilter message of
+// boom.proto, so it can be read in other languages.
+func (b *BloomFilter) MarshalProto() ([]byte, error) {
+	e := &protoEncoder{}
+	e.uint(1, uint64(b.m))
+	e.uint(2, uint64(b.k))
+	e.uint(3, uint64(b.extra))
+	e.uint(4, uint64(b.count))
+	e.buckets(5, b.buckets)
+	e.uint(6, uint64(b.indexing))
+	return e.buf, nil
+}
+
+// UnmarshalProto restores the BloomFilter from the BloomFilter message of
+// boom.proto.
+func (b *BloomFilter) UnmarshalProto(data []byte) error {
+	var (
+		m, k, extra, count, indexing uint64
+		buckets                      *Buckets
+	)
+	err := decodeProto(data, func(f protoField) (err error) {
+		switch f.number {
+		case 1:
+			m = f.v
+		case 2:
+			k = f.v
+		case 3:
+			extra = f.v
+		case 4:
+			count = f.v
+		case 5:
+			buckets, err = f.buckets()
+		case 6:
+			indexing = f.v
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if buckets == nil || buckets.bucketSize != 1 || uint64(buckets.count) != m ||
+		k == 0 || k > maxK || extra > math.MaxUint32 || indexing > uint64(TripleHashing) {
+		return errProtoMalformed
+	}
+
+	b.buckets = buckets
+	b.hash = newDefaultHash()
+	b.m = uint(m)
+	b.k = uint(k)
+	b.extra = uint32(extra)
+	b.indexing = Indexing(indexing)
+	b.count = uint(count)
+	return nil
+}
+
+// MarshalProto returns the CountingBloomFilter encoded as the
+// CountingBloomFilter message of boom.proto, so it can be read in other
+// languages.
+func (c *CountingBloomFilter) MarshalProto() ([]byte, error) {
+	e := &protoEncoder{}
+	e.uint(1, uint64(c.m))
+	e.uint(2, uint64(c.k))
+	e.uint(3, uint64(c.count))
+	e.buckets(4, c.buckets)
+	e.bool(5, c.spill != nil)
+	if c.spill != nil {
+		var (
+			spilled = c.spilledBuckets()
+			buckets = make([]uint64, len(spilled))
+			excess  = make([]uint64, len(spilled))
+		)
+		for i, idx := range spilled {
+			buckets[i] = uint64(idx)
+			excess[i] = uint64(c.spill[idx])
+		}
+		e.packed(6, buckets)
+		e.packed(7, excess)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalProto restores the CountingBloomFilter from the CountingBloomFilter
+// message of boom.proto.
+func (c *CountingBloomFilter) UnmarshalProto(data []byte) error {
+	var (
+		m, k, count     uint64
+		buckets         *Buckets
+		spill           bool
+		spilled, excess []uint64
+	)
+	err := decodeProto(data, func(f protoField) (err error) {
+		switch f.number {
+		case 1:
+			m = f.v
+		case 2:
+			k = f.v
+		case 3:
+			count = f.v
+		case 4:
+			buckets, err = f.buckets()
+		case 5:
+			spill = f.v != 0
+		case 6:
+			spilled, err = f.packed(spilled)
+		case 7:
+			excess, err = f.packed(excess)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if buckets == nil || uint64(buckets.count) != m || k > maxK || len(spilled) != len(excess) {
+		return errProtoMalformed
+	}
+
+	var spillMap map[uint]uint32
+	if spill {
+		spillMap = make(map[uint]uint32, len(spilled))
+		for i, idx := range spilled {
+			if idx >= m || excess[i] > math.MaxUint32 {
+				return errProtoMalformed
+			}
+			spillMap[uint(idx)] = uint32(excess[i])
+		}
+	}
+	c.spill = spillMap
+	c.buckets = buckets
+	c.hash = newDefaultHash()
+	c.m = uint(m)
+	c.k = uint(k)
+	c.count = uint(count)
+	c.indexBuffer = make([]uint, k)
+	return nil
+}
+
+// MarshalProto returns the CountMinSketch encoded as the CountMinSketch
+// message of boom.proto, so it can be read in other languages.
+func (c *CountMinSketch) MarshalProto() ([]byte, error) {
+	e := &protoEncoder{}
+	e.uint(1, uint64(c.width))
+	e.uint(2, uint64(c.depth))
+	e.double(3, c.epsilon)
+	e.double(4, c.delta)
+	e.uint(5, c.count)
+	counters := make([]uint64, 0, c.width*c.depth)
+	for _, row := range c.matrix {
+		counters = append(counters, row...)
+	}
+	e.packed(6, counters)
+	return e.buf, nil
+}
+
+// UnmarshalProto restores the CountMinSketch from the CountMinSketch message
+// of boom.proto.
+func (c *CountMinSketch) UnmarshalProto(data []byte) error {
+	var (
+		width, depth, count uint64
+		epsilon, delta      float64
+		counters            []uint64
+	)
+	err := decodeProto(data, func(f protoField) (err error) {
+		switch f.number {
+		case 1:
+			width = f.v
+		case 2:
+			depth = f.v
+		case 3:
+			epsilon = f.double()
+		case 4:
+			delta = f.double()
+		case 5:
+			count = f.v
+		case 6:
+			counters, err = f.packed(counters)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if width == 0 || depth == 0 || uint64(len(counters))/width != depth ||
+		uint64(len(counters))%width != 0 {
+		return errProtoMalformed
+	}
+
+	matrix := make([][]uint64, depth)
+	for i := range matrix {
+		matrix[i] = counters[uint64(i)*width : uint64(i+1)*width : uint64(i+1)*width]
+	}
+	c.matrix = matrix
+	c.width = uint(width)
+	c.depth = uint(depth)
+	c.epsilon = epsilon
+	c.delta = delta
+	c.count = count
+	c.hash = newDefaultHash()
+	return nil
+}
+
+// MarshalProto returns the HyperLogLog encoded as the HyperLogLog message of
+// boom.proto, so it can be read in other languages.
+func (h *HyperLogLog) MarshalProto() ([]byte, error) {
+	e := &protoEncoder{}
+	e.uint(1, uint64(h.b))
+	e.double(2, h.alpha)
+	e.bytes(3, h.registers)
+	return e.buf, nil
+}
+
+// UnmarshalProto restores the HyperLogLog from the HyperLogLog message of
+// boom.proto.
+func (h *HyperLogLog) UnmarshalProto(data []byte) error {
+	var (
+		b         uint64
+		alpha     float64
+		registers []byte
+	)
+	err := decodeProto(data, func(f protoField) error {
+		switch f.number {
+		case 1:
+			b = f.v
+		case 2:
+			alpha = f.double()
+		case 3:
+			registers = append([]byte(nil), f.data...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if b > maxHLLPrecision || uint64(len(registers)) != hllRegistersSize(1<<b) {
+		return errProtoMalformed
+	}
+
+	h.registers = registers
+	h.m = 1 << b
+	h.b = uint32(b)
+	h.alpha = alpha
+	h.hash = fnv.New32()
+	return nil
+}
@@ -0,0 +1,141 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// Ensures that a BloomFilter is encoded with the fields of boom.proto and
+// round-trips through the protocol buffer encoding.
+func TestBloomProto(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	data, err := f.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// m = 959 as field 1, k = 7 as field 2, and count = 100 as field 4.
+	if !bytes.HasPrefix(data, []byte{0x08, 0xbf, 0x07, 0x10, 0x07, 0x20, 0x64, 0x2a}) {
+		t.Errorf("Unexpected header %x", data[:8])
+	}
+
+	other := &BloomFilter{}
+	if err := other.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Equal(f) {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+
+	for i := 0; i < 100; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	// Unknown fields are skipped, as they may be added to the schema.
+	extended := append(append([]byte(nil), data...), 0x78, 0x01, 0x82, 0x01, 0x01, 0xff)
+	if err := other.UnmarshalProto(extended); err != nil {
+		t.Errorf("Unexpected error for unknown fields: %v", err)
+	}
+
+	if err := other.UnmarshalProto(data[:len(data)-1]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+	if err := other.UnmarshalProto([]byte{0x08, 0x01}); err == nil {
+		t.Error("Expected error for missing buckets")
+	}
+}
+
+// Ensures that the remaining structures round-trip through the protocol
+// buffer encoding.
+func TestProtoRoundTrip(t *testing.T) {
+	counting := NewCountingBloomFilter(100, 2, 0.01)
+	counting.EnableSpill()
+	for i := 0; i < 10; i++ {
+		counting.Add([]byte(`a`))
+		counting.Add([]byte(strconv.Itoa(i)))
+	}
+	other := &CountingBloomFilter{}
+	data, _ := counting.MarshalProto()
+	if err := other.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Equal(counting) {
+		t.Errorf("Expected %s, got %s", counting, other)
+	}
+	for i := 0; i < 10; i++ {
+		other.TestAndRemove([]byte(`a`))
+	}
+	if !other.Test([]byte(`5`)) || other.Test([]byte(`a`)) {
+		t.Error("Expected spilled counts to be restored")
+	}
+
+	cms := NewCountMinSketch(0.01, 0.99)
+	cms.Add([]byte(`a`)).Add([]byte(`a`)).Add([]byte(`b`))
+	otherCMS := &CountMinSketch{}
+	data, _ = cms.MarshalProto()
+	if err := otherCMS.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !otherCMS.Equal(cms) || otherCMS.Count([]byte(`a`)) != 2 {
+		t.Errorf("Expected %s, got %s", cms, otherCMS)
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	otherHLL := &HyperLogLog{}
+	data, _ = hll.MarshalProto()
+	if err := otherHLL.UnmarshalProto(data); err != nil {
+		t.Fatal(err)
+	}
+	if !otherHLL.Equal(hll) || otherHLL.Count() != hll.Count() {
+		t.Errorf("Expected %s, got %s", hll, otherHLL)
+	}
+	if err := otherHLL.UnmarshalProto(data[:len(data)-1]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+	if err := otherHLL.UnmarshalProto([]byte{0x08, 0x1e}); err == nil {
+		t.Error("Expected error for missing registers")
+	}
+	if err := otherHLL.UnmarshalProto([]byte{0x08, 0x21}); err == nil {
+		t.Error("Expected error for too many registers")
+	}
+}
+
+// Ensures that decoding rejects buckets whose number of bits overflows, which
+// would otherwise index past their data.
+func TestProtoBucketsOverflow(t *testing.T) {
+	e := &protoEncoder{}
+	e.uint(1, 1<<62)
+	e.uint(2, 3)
+	e.message(4, func(e *protoEncoder) {
+		e.uint(1, 4)
+		e.uint(2, 1<<62)
+	})
+	if err := (&CountingBloomFilter{}).UnmarshalProto(e.buf); err == nil {
+		t.Error("Expected error for overflowing buckets")
+	}
+}
+
+func BenchmarkBloomMarshalProto(b *testing.B) {
+	f := NewBloomFilter(100000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.MarshalProto()
+	}
+}
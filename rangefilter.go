@@ -0,0 +1,226 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxRangeBlocks is the maximum number of top-level dyadic intervals a range
+// query is split into before the range is considered too large to screen.
+const maxRangeBlocks = 1024
+
+// RangeBloomFilter implements a range filter over integer keys as described
+// by Luo, Chatterjee, and Idreos in Rosetta: A Robust Space-Time Optimized
+// Range Filter for Key-Value Stores:
+//
+// https://stratos.seas.harvard.edu/files/stratos/files/rosetta.pdf
+//
+// A RangeBloomFilter is a stack of Bloom filters, one for each level of the
+// implicit binary trie over the key space. Level l holds the prefix of every
+// key with its low l bits removed, i.e. the dyadic interval of size 2^l
+// containing it. A range query is decomposed into the fewest dyadic intervals
+// covering it, and each interval which tests positive is verified by
+// descending through its sub-intervals to the individual keys. This way, the
+// false-positive rate of a range query is close to that of a point lookup.
+//
+// Range filters are useful for screening range scans over numeric keys, such
+// as timestamps, in storage engines where a Bloom filter can only help point
+// lookups. Ranges wider than 2^maxRangeBits are split into many intervals, so
+// the maximum range size should be chosen to cover typical queries.
+type RangeBloomFilter struct {
+	levels []*BloomFilter // filter for each level of dyadic intervals
+	top    uint           // highest level, log2 of the maximum range size
+	buffer []byte         // buffer used to encode prefixes
+	count  uint           // number of keys added
+}
+
+// NewRangeBloomFilter creates a new RangeBloomFilter optimized to store n
+// keys with a specified target false-positive rate for both point lookups
+// and range queries. Ranges of up to 2^maxRangeBits keys are screened
+// efficiently.
+func NewRangeBloomFilter(n uint, fpRate float64, maxRangeBits uint8) *RangeBloomFilter {
+	if maxRangeBits > 63 {
+		maxRangeBits = 63
+	}
+
+	// A range query descends through every level below the interval it
+	// starts at, so each level contributes to the false-positive rate.
+	levelFP := fpRate / float64(maxRangeBits+1)
+	levels := make([]*BloomFilter, maxRangeBits+1)
+	for i := range levels {
+		levels[i] = NewBloomFilter(n, levelFP)
+	}
+
+	return &RangeBloomFilter{
+		levels: levels,
+		top:    uint(maxRangeBits),
+		buffer: make([]byte, 9),
+	}
+}
+
+// Count returns the number of keys added to the filter.
+func (r *RangeBloomFilter) Count() uint {
+	return r.count
+}
+
+// Add will add the key to the filter. It returns the filter to allow for
+// chaining.
+func (r *RangeBloomFilter) Add(key uint64) *RangeBloomFilter {
+	for l := uint(0); l <= r.top; l++ {
+		r.levels[l].Add(r.encode(key>>l, l))
+	}
+	r.count++
+	return r
+}
+
+// Test will test for membership of the key and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (r *RangeBloomFilter) Test(key uint64) bool {
+	return r.levels[0].Test(r.encode(key, 0))
+}
+
+// TestRange will test whether any key in the range [lo, hi] is a member,
+// returning true if there may be one and false if there definitely isn't.
+// This is a probabilistic test, meaning there is a non-zero probability of
+// false positives but a zero probability of false negatives. Ranges too
+// large to be screened efficiently are always reported as non-empty.
+func (r *RangeBloomFilter) TestRange(lo, hi uint64) bool {
+	if lo > hi {
+		return false
+	}
+	if (hi-lo)>>r.top >= maxRangeBlocks {
+		return true
+	}
+
+	// Cover the range with maximal dyadic intervals, starting from lo.
+	for {
+		l := uint(0)
+		for l < r.top && lo&(1<<(l+1)-1) == 0 && hi-lo >= 1<<(l+1)-1 {
+			l++
+		}
+
+		if r.doubt(lo>>l, l) {
+			return true
+		}
+
+		end := lo + (1<<l - 1)
+		if end >= hi {
+			return false
+		}
+		lo = end + 1
+	}
+}
+
+// WriteTo writes a binary representation of the RangeBloomFilter to an i/o
+// stream. It returns the number of bytes written.
+func (r *RangeBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(r.count), uint64(r.top)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, level := range r.levels {
+		n, err := level.WriteTo(stream)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a RangeBloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (r *RangeBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 2)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header[1] > 63 {
+		return read, errors.New("invalid range bloom filter dimensions")
+	}
+	levels := make([]*BloomFilter, header[1]+1)
+	for i := range levels {
+		levels[i] = &BloomFilter{}
+		n, err := levels[i].ReadFrom(stream)
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+
+	r.levels = levels
+	r.top = uint(header[1])
+	r.count = uint(header[0])
+	r.buffer = make([]byte, 9)
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (r *RangeBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (r *RangeBloomFilter) GobDecode(data []byte) error {
+	_, err := r.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, the sum of its levels.
+func (r *RangeBloomFilter) ByteSize() uint {
+	size := uint(0)
+	for _, level := range r.levels {
+		size += level.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the RangeBloomFilter for logging and
+// debugging.
+func (r *RangeBloomFilter) String() string {
+	return fmt.Sprintf("RangeBloomFilter{levels=%d count=%d}", len(r.levels), r.count)
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (r *RangeBloomFilter) Reset() *RangeBloomFilter {
+	for _, level := range r.levels {
+		level.Reset()
+	}
+	r.count = 0
+	return r
+}
+
+// doubt returns true if the dyadic interval with the prefix at the level may
+// contain a key, verifying positives by descending to the individual keys.
+func (r *RangeBloomFilter) doubt(prefix uint64, level uint) bool {
+	if !r.levels[level].Test(r.encode(prefix, level)) {
+		return false
+	}
+	if level == 0 {
+		return true
+	}
+	return r.doubt(prefix<<1, level-1) || r.doubt(prefix<<1|1, level-1)
+}
+
+// encode returns the byte representation of the prefix at the level.
+func (r *RangeBloomFilter) encode(prefix uint64, level uint) []byte {
+	r.buffer[0] = byte(level)
+	binary.BigEndian.PutUint64(r.buffer[1:], prefix)
+	return r.buffer
+}
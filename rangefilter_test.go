@@ -0,0 +1,163 @@
+package boom
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// Ensures that Test, Add, and Count behave correctly.
+func TestRangeBloomTestAndAdd(t *testing.T) {
+	f := NewRangeBloomFilter(100, 0.01, 16)
+
+	if f.Add(42) != f {
+		t.Error("Returned RangeBloomFilter should be the same instance")
+	}
+
+	if !f.Test(42) {
+		t.Error("42 should be a member")
+	}
+
+	if f.Test(43) {
+		t.Error("43 should not be a member")
+	}
+
+	if count := f.Count(); count != 1 {
+		t.Errorf("Expected 1, got %d", count)
+	}
+}
+
+// Ensures that TestRange returns true for ranges containing a key and false
+// for most empty ranges.
+func TestRangeBloomTestRange(t *testing.T) {
+	f := NewRangeBloomFilter(1000, 0.01, 16)
+	for i := uint64(0); i < 1000; i++ {
+		f.Add(i * 1000000)
+	}
+
+	if !f.TestRange(1000000, 1000000) {
+		t.Error("[1000000, 1000000] should contain a member")
+	}
+
+	if !f.TestRange(999000, 1000001) {
+		t.Error("[999000, 1000001] should contain a member")
+	}
+
+	if !f.TestRange(0, ^uint64(0)) {
+		t.Error("[0, max] should contain a member")
+	}
+
+	if f.TestRange(1000001, 1000000) {
+		t.Error("Empty range should not contain a member")
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	fp := 0
+	for i := 0; i < 1000; i++ {
+		// Pick a range of up to 1000 keys strictly between two members.
+		lo := uint64(rng.Intn(999))*1000000 + 1 + uint64(rng.Intn(500000))
+		hi := lo + uint64(rng.Intn(1000))
+		if f.TestRange(lo, hi) {
+			fp++
+		}
+	}
+
+	if fp > 50 {
+		t.Errorf("Expected at most 50 false positives, got %d", fp)
+	}
+}
+
+// Ensures that TestRange never returns false for a range containing a key.
+func TestRangeBloomNoFalseNegatives(t *testing.T) {
+	f := NewRangeBloomFilter(500, 0.01, 12)
+	rng := rand.New(rand.NewSource(1))
+	keys := make([]uint64, 500)
+	for i := range keys {
+		keys[i] = rng.Uint64()
+		f.Add(keys[i])
+	}
+
+	for _, key := range keys {
+		lo := key - uint64(rng.Intn(5000))
+		if lo > key {
+			lo = 0
+		}
+		hi := key + uint64(rng.Intn(5000))
+		if hi < key {
+			hi = ^uint64(0)
+		}
+		if !f.TestRange(lo, hi) {
+			t.Errorf("[%d, %d] should contain %d", lo, hi, key)
+		}
+	}
+}
+
+// Ensures that Reset clears the filter.
+func TestRangeBloomReset(t *testing.T) {
+	f := NewRangeBloomFilter(100, 0.01, 8)
+	for i := uint64(0); i < 100; i++ {
+		f.Add(i)
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned RangeBloomFilter should be the same instance")
+	}
+
+	if f.TestRange(0, 99) {
+		t.Error("[0, 99] should not contain a member")
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+// Ensures that a RangeBloomFilter round-trips through WriteTo and ReadFrom.
+func TestRangeBloomWriteToReadFrom(t *testing.T) {
+	f := NewRangeBloomFilter(100, 0.01, 16)
+	for key := uint64(0); key < 1000; key += 10 {
+		f.Add(key)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &RangeBloomFilter{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if other.Count() != f.Count() {
+		t.Errorf("Expected %d, got %d", f.Count(), other.Count())
+	}
+	for lo := uint64(0); lo < 1000; lo += 7 {
+		if other.TestRange(lo, lo+5) != f.TestRange(lo, lo+5) {
+			t.Errorf("Expected decoded filter to agree for [%d, %d]", lo, lo+5)
+		}
+	}
+}
+
+func BenchmarkRangeBloomAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewRangeBloomFilter(100000, 0.01, 16)
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(uint64(n))
+	}
+}
+
+func BenchmarkRangeBloomTestRange(b *testing.B) {
+	b.StopTimer()
+	f := NewRangeBloomFilter(100000, 0.01, 16)
+	for i := uint64(0); i < 100000; i++ {
+		f.Add(i * 100000)
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		lo := uint64(n) * 7919
+		f.TestRange(lo, lo+1000)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Package reconcile implements a set reconciliation protocol on top of the
+Invertible Bloom Lookup Tables and Strata Estimators provided by package boom.
+
+Two peers each hold a set of elements and want to learn the elements the other
+has which they don't, exchanging data proportional to the size of the
+difference rather than the size of the sets. The protocol works as follows:
+
+ 1. The initiator sends a Strata Estimator of its set.
+ 2. The responder subtracts its own estimator to estimate the size of the
+    difference and replies with an IBLT of its set sized accordingly.
+ 3. The initiator builds an IBLT of its set with the same parameters,
+    subtracts the responder's, and decodes it. This yields both the
+    elements it is missing and the elements the responder is missing. It
+    replies with the latter. If the IBLT can't be decoded because the
+    difference was underestimated, it instead asks the responder to retry
+    with a larger IBLT.
+
+Either peer ends the exchange with an error message if it fails, such as when
+the difference can't be decoded after several retries, so the other peer
+doesn't wait for a reply which will never come.
+
+Peer produces and consumes the messages for each step so they can be carried
+over any transport. Reconcile runs the whole exchange over an io.ReadWriter.
+*/
+package reconcile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tylertreat/BoomFilters"
+)
+
+// MessageType identifies the contents of a Message.
+type MessageType uint8
+
+const (
+	// EstimateMessage carries the initiator's Strata Estimator.
+	EstimateMessage MessageType = iota + 1
+
+	// IBLTMessage carries the responder's IBLT.
+	IBLTMessage
+
+	// ElementsMessage carries the elements the responder is missing.
+	ElementsMessage
+
+	// RetryMessage asks the responder to send a larger IBLT.
+	RetryMessage
+
+	// ErrorMessage ends the exchange with the error which stopped the sender.
+	ErrorMessage
+)
+
+const (
+	// maxRetries is the number of times the responder will double the size
+	// of its IBLT before giving up.
+	maxRetries = 8
+
+	// maxEstimate bounds the estimated difference an IBLT is sized for, so
+	// the IBLT message fits in maxPayload.
+	maxEstimate = 1 << 22
+)
+
+// Message is a single step of the reconciliation protocol.
+type Message struct {
+	Type    MessageType
+	Payload []byte
+}
+
+// Peer is one side of a reconciliation. It is not safe for concurrent use.
+type Peer struct {
+	elements [][]byte
+	strata   *boom.StrataEstimator
+	estimate uint64
+	retries  int
+}
+
+// NewPeer creates a new Peer holding the provided set of elements.
+func NewPeer(elements [][]byte) *Peer {
+	p := &Peer{strata: boom.NewStrataEstimator()}
+	for _, element := range elements {
+		p.Add(element)
+	}
+	return p
+}
+
+// Add will add the element to the peer's set. Returns the Peer to allow for
+// chaining.
+func (p *Peer) Add(element []byte) *Peer {
+	p.elements = append(p.elements, element)
+	p.strata.Add(element)
+	return p
+}
+
+// Start returns the first message of the protocol, which the initiator sends
+// to the responder.
+func (p *Peer) Start() (*Message, error) {
+	var buf bytes.Buffer
+	if _, err := p.strata.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return &Message{Type: EstimateMessage, Payload: buf.Bytes()}, nil
+}
+
+// Handle processes a message received from the other peer. It returns the
+// reply to send back, if any, and the elements this peer is missing once they
+// are known. The exchange is complete once an ElementsMessage has been sent or
+// received. If it returns an error, the reply is an ErrorMessage, which should
+// be sent so the other peer stops waiting, unless the message handled was
+// itself an ErrorMessage.
+func (p *Peer) Handle(msg *Message) (reply *Message, missing [][]byte, err error) {
+	reply, missing, err = p.handle(msg)
+	if err != nil && msg.Type != ErrorMessage {
+		reply = &Message{Type: ErrorMessage, Payload: []byte(err.Error())}
+	}
+	return reply, missing, err
+}
+
+// handle processes a message received from the other peer without replying
+// to errors.
+func (p *Peer) handle(msg *Message) (*Message, [][]byte, error) {
+	switch msg.Type {
+	case EstimateMessage:
+		return p.handleEstimate(msg)
+	case IBLTMessage:
+		return p.handleIBLT(msg)
+	case ElementsMessage:
+		missing, err := decodeElements(msg.Payload)
+		return nil, missing, err
+	case RetryMessage:
+		return p.handleRetry()
+	case ErrorMessage:
+		return nil, nil, fmt.Errorf("peer failed: %s", msg.Payload)
+	default:
+		return nil, nil, fmt.Errorf("unknown message type %d", msg.Type)
+	}
+}
+
+// handleEstimate estimates the size of the difference from the initiator's
+// Strata Estimator and replies with an IBLT sized accordingly.
+func (p *Peer) handleEstimate(msg *Message) (*Message, [][]byte, error) {
+	remote := new(boom.StrataEstimator)
+	if _, err := remote.ReadFrom(bytes.NewReader(msg.Payload)); err != nil {
+		return nil, nil, err
+	}
+
+	estimate, err := p.strata.Estimate(remote)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.estimate = min(estimate, maxEstimate)
+	p.retries = 0
+	reply, err := p.ibltMessage()
+	return reply, nil, err
+}
+
+// handleRetry doubles the estimated difference and replies with a larger
+// IBLT.
+func (p *Peer) handleRetry() (*Message, [][]byte, error) {
+	if p.retries >= maxRetries {
+		return nil, nil, errors.New("difference could not be decoded")
+	}
+	p.retries++
+	p.estimate = min(2*p.estimate+1, maxEstimate)
+	reply, err := p.ibltMessage()
+	return reply, nil, err
+}
+
+// handleIBLT subtracts the responder's IBLT from an IBLT of this peer's set
+// and decodes the difference. It replies with the elements the responder is
+// missing or, if the difference can't be decoded, asks for a larger IBLT.
+func (p *Peer) handleIBLT(msg *Message) (*Message, [][]byte, error) {
+	remote := new(boom.IBLT)
+	if _, err := remote.ReadFrom(bytes.NewReader(msg.Payload)); err != nil {
+		return nil, nil, err
+	}
+
+	local := boom.NewIBLT(remote.Cells(), remote.K())
+	for _, element := range p.elements {
+		local.Add(element)
+	}
+	if err := local.Subtract(remote); err != nil {
+		return nil, nil, err
+	}
+
+	onlyLocal, onlyRemote, err := local.Decode()
+	if err != nil {
+		return &Message{Type: RetryMessage}, nil, nil
+	}
+
+	return &Message{Type: ElementsMessage, Payload: encodeElements(onlyLocal)},
+		onlyRemote, nil
+}
+
+// ibltMessage returns an IBLT of this peer's set sized for the current
+// estimated difference.
+func (p *Peer) ibltMessage() (*Message, error) {
+	// Strata estimates are rough, so leave some headroom.
+	table := boom.NewDefaultIBLT(uint(p.estimate + p.estimate/2))
+	for _, element := range p.elements {
+		table.Add(element)
+	}
+
+	var buf bytes.Buffer
+	if _, err := table.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return &Message{Type: IBLTMessage, Payload: buf.Bytes()}, nil
+}
+
+// encodeElements returns a length-prefixed encoding of the elements.
+func encodeElements(elements [][]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint64(len(elements)))
+	for _, element := range elements {
+		binary.Write(&buf, binary.BigEndian, uint64(len(element)))
+		buf.Write(element)
+	}
+	return buf.Bytes()
+}
+
+// decodeElements decodes elements encoded by encodeElements.
+func decodeElements(payload []byte) ([][]byte, error) {
+	r := bytes.NewReader(payload)
+	var count uint64
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	if count > uint64(r.Len()) {
+		return nil, errors.New("invalid element count")
+	}
+
+	elements := make([][]byte, count)
+	for i := range elements {
+		var size uint64
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		elements[i] = make([]byte, size)
+		if _, err := io.ReadFull(r, elements[i]); err != nil {
+			return nil, err
+		}
+	}
+	return elements, nil
+}
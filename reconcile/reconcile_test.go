@@ -0,0 +1,281 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func elements(lo, hi int) [][]byte {
+	elements := make([][]byte, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		elements = append(elements, []byte(strconv.Itoa(i)))
+	}
+	return elements
+}
+
+func sorted(elements [][]byte) []string {
+	strs := make([]string, len(elements))
+	for i, element := range elements {
+		strs[i] = string(element)
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Ensures that exchanging messages with Start and Handle lets each peer learn
+// the elements it is missing.
+func TestPeerHandle(t *testing.T) {
+	var (
+		initiator = NewPeer(elements(0, 1000)).Add([]byte(`only-initiator`))
+		responder = NewPeer(elements(0, 1000)).Add([]byte(`only-responder`))
+	)
+
+	msg, err := initiator.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, _, err := responder.Handle(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != IBLTMessage {
+		t.Fatalf("Expected IBLT message, got %d", reply.Type)
+	}
+
+	reply, missing, err := initiator.Handle(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != ElementsMessage {
+		t.Fatalf("Expected elements message, got %d", reply.Type)
+	}
+	if s := sorted(missing); !equal(s, []string{"only-responder"}) {
+		t.Errorf("Expected [only-responder], got %q", s)
+	}
+
+	reply, missing, err = responder.Handle(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != nil {
+		t.Errorf("Expected no reply, got %d", reply.Type)
+	}
+	if s := sorted(missing); !equal(s, []string{"only-initiator"}) {
+		t.Errorf("Expected [only-initiator], got %q", s)
+	}
+}
+
+// Ensures that an undersized IBLT results in a retry.
+func TestPeerRetry(t *testing.T) {
+	var (
+		initiator = NewPeer(elements(0, 500))
+		responder = NewPeer(elements(100, 600))
+	)
+
+	// Pretend the estimate was far too small.
+	responder.estimate = 1
+	msg, err := responder.ibltMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, _, err := initiator.Handle(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != RetryMessage {
+		t.Fatalf("Expected retry message, got %d", reply.Type)
+	}
+
+	if _, _, err := responder.Handle(&Message{Type: 42}); err == nil {
+		t.Error("Expected error for unknown message type")
+	}
+}
+
+// Ensures that Reconcile runs the protocol over a stream.
+func TestReconcile(t *testing.T) {
+	var (
+		a, b      = net.Pipe()
+		initiator = NewPeer(elements(0, 5000))
+		responder = NewPeer(elements(100, 5100))
+		result    = make(chan [][]byte)
+		errs      = make(chan error, 1)
+	)
+	defer a.Close()
+	defer b.Close()
+
+	go func() {
+		missing, err := Reconcile(b, responder, false)
+		if err != nil {
+			errs <- err
+		}
+		result <- missing
+	}()
+
+	missing, err := Reconcile(a, initiator, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responderMissing [][]byte
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	case responderMissing = <-result:
+	}
+
+	if s := sorted(missing); !equal(s, sorted(elements(5000, 5100))) {
+		t.Errorf("Expected initiator to miss 5000-5099, got %d elements", len(s))
+	}
+
+	if s := sorted(responderMissing); !equal(s, sorted(elements(0, 100))) {
+		t.Errorf("Expected responder to miss 0-99, got %d elements", len(s))
+	}
+}
+
+// Ensures that a responder which can't help decode the difference after
+// maxRetries retries sends an error message rather than leaving the initiator
+// waiting.
+func TestReconcileRetriesExhausted(t *testing.T) {
+	var (
+		a, b      = net.Pipe()
+		responder = NewPeer(elements(0, 100))
+		errs      = make(chan error, 1)
+	)
+	defer a.Close()
+	defer b.Close()
+
+	go func() {
+		_, err := Reconcile(b, responder, false)
+		errs <- err
+	}()
+
+	msg, err := NewPeer(elements(50, 150)).Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ibltMessages := 0
+	for {
+		if _, err := msg.WriteTo(a); err != nil {
+			t.Fatal(err)
+		}
+		msg = new(Message)
+		if _, err := msg.ReadFrom(a); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != IBLTMessage {
+			break
+		}
+		ibltMessages++
+
+		// Ask for a larger IBLT every time, as if none could be decoded.
+		msg = &Message{Type: RetryMessage}
+	}
+
+	if msg.Type != ErrorMessage {
+		t.Fatalf("Expected an error message, got %d", msg.Type)
+	}
+	if ibltMessages != maxRetries+1 {
+		t.Errorf("Expected %d IBLT messages, got %d", maxRetries+1, ibltMessages)
+	}
+	if !strings.Contains(string(msg.Payload), "could not be decoded") {
+		t.Errorf("Expected the error to be sent, got %q", msg.Payload)
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the responder to return an error")
+	}
+}
+
+// Ensures that Reconcile returns the error a peer sends rather than waiting,
+// and that Handle replies to invalid messages with an error message.
+func TestReconcileRemoteError(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go func() {
+		msg := new(Message)
+		if _, err := msg.ReadFrom(b); err != nil {
+			return
+		}
+		reply, _, _ := NewPeer(nil).Handle(&Message{Type: EstimateMessage, Payload: []byte{0xff}})
+		reply.WriteTo(b)
+	}()
+
+	_, err := Reconcile(a, NewPeer(elements(0, 10)), true)
+	if err == nil || !strings.Contains(err.Error(), "peer failed") {
+		t.Errorf("Expected the peer's error, got %v", err)
+	}
+
+	reply, _, err := NewPeer(nil).Handle(&Message{Type: ErrorMessage, Payload: []byte("boom")})
+	if err == nil || reply != nil {
+		t.Errorf("Expected an error and no reply to an error message, got %v, %v", reply, err)
+	}
+}
+
+// Ensures that crafted estimates and IBLTs from a peer are rejected with an
+// error reply rather than crashing the process.
+func TestPeerHandleInvalid(t *testing.T) {
+	payload := func(words ...uint64) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, words)
+		return buf.Bytes()
+	}
+	for _, msg := range []*Message{
+		{Type: EstimateMessage, Payload: payload(1, 1, 1, 1, 0, 0, 1<<62)},
+		{Type: EstimateMessage, Payload: payload(1, 0, 1)},
+		{Type: IBLTMessage, Payload: payload(0, 1)},
+		{Type: IBLTMessage, Payload: payload(1, 1, 1, 0, 0, 1<<62)},
+	} {
+		reply, _, err := NewPeer(elements(0, 10)).Handle(msg)
+		if err == nil {
+			t.Errorf("Expected an error for %x", msg.Payload)
+		}
+		if reply == nil || reply.Type != ErrorMessage {
+			t.Errorf("Expected an error message reply for %x", msg.Payload)
+		}
+	}
+}
+
+// Ensures that ReadFrom rejects a truncated message without allocating the
+// payload size it declares.
+func TestMessageReadFromTruncated(t *testing.T) {
+	header := make([]byte, 9)
+	header[0] = byte(EstimateMessage)
+	binary.BigEndian.PutUint64(header[1:], maxPayload)
+	stream := append(header, 1, 2, 3)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, err := new(Message).ReadFrom(bytes.NewReader(stream))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if n != int64(len(stream)) {
+		t.Errorf("Expected %d bytes read, got %d", len(stream), n)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Expected a small allocation, got %d bytes", allocated)
+	}
+}
@@ -0,0 +1,102 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxPayload bounds the size of a message read from a stream.
+const maxPayload = 1 << 30
+
+// WriteTo writes the message to an i/o stream as a type byte followed by a
+// length-prefixed payload. It returns the number of bytes written.
+func (m *Message) WriteTo(stream io.Writer) (int64, error) {
+	header := make([]byte, 9)
+	header[0] = byte(m.Type)
+	binary.BigEndian.PutUint64(header[1:], uint64(len(m.Payload)))
+
+	n, err := stream.Write(header)
+	if err != nil || len(m.Payload) == 0 {
+		// Empty writes block on synchronous streams such as net.Pipe, which
+		// the reader never consumes.
+		return int64(n), err
+	}
+	p, err := stream.Write(m.Payload)
+	return int64(n + p), err
+}
+
+// ReadFrom reads a message (such as might have been written by WriteTo())
+// from an i/o stream. It returns the number of bytes read.
+func (m *Message) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]byte, 9)
+	n, err := io.ReadFull(stream, header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	size := binary.BigEndian.Uint64(header[1:])
+	if size > maxPayload {
+		return int64(n), errors.New("message payload too large")
+	}
+
+	// The payload is read as it arrives rather than allocated up front, so a
+	// forged size can't allocate more memory than the stream provides.
+	var payload bytes.Buffer
+	p, err := io.CopyN(&payload, stream, int64(size))
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return int64(n) + p, err
+	}
+
+	m.Type = MessageType(header[0])
+	m.Payload = payload.Bytes()
+	return int64(n) + p, nil
+}
+
+// Reconcile runs the reconciliation protocol for the peer over the provided
+// stream and returns the elements the peer is missing. One side of the
+// stream must be the initiator and the other the responder. Both sides learn
+// the elements they are missing. If either side fails, it tells the other,
+// and both return an error.
+func Reconcile(stream io.ReadWriter, p *Peer, initiator bool) ([][]byte, error) {
+	if initiator {
+		msg, err := p.Start()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := msg.WriteTo(stream); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		msg := new(Message)
+		if _, err := msg.ReadFrom(stream); err != nil {
+			return nil, err
+		}
+
+		// An error reply is sent before giving up so the other peer doesn't
+		// wait for one.
+		reply, missing, err := p.Handle(msg)
+		if reply != nil {
+			if _, writeErr := reply.WriteTo(stream); err == nil && writeErr != nil {
+				err = writeErr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The initiator is done once it has decoded the difference and sent
+		// the responder its missing elements. The responder is done once it
+		// has received them.
+		if msg.Type == ElementsMessage ||
+			(reply != nil && reply.Type == ElementsMessage) {
+			return missing, nil
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// RedisCommander sends a command to a Redis server and returns its reply, with
+// integers as int64 and arrays as []interface{}. The Conn of the redigo client
+// implements it, and other clients can be adapted with a small wrapper, so
+// that the package doesn't depend on any of them.
+type RedisCommander interface {
+	Do(command string, args ...interface{}) (interface{}, error)
+}
+
+// redisBuckets is an array of buckets stored in a Redis string and accessed
+// with BITFIELD, so that many application instances can share it. Each
+// operation on an item's buckets is a single command, so it's atomic.
+type redisBuckets struct {
+	client     RedisCommander // Redis connection
+	key        string         // key of the string holding the buckets
+	bucketSize uint8          // bits per bucket
+	args       []interface{}  // buffer used to build commands
+	err        error          // first error since the last call to Err
+}
+
+// do runs BITFIELD with the operation on each of the buckets, each of the
+// operands following it, and returns the reply.
+func (r *redisBuckets) do(buckets []uint, ops ...string) []int64 {
+	if r.err != nil {
+		return nil
+	}
+	typ := fmt.Sprintf("u%d", r.bucketSize)
+	r.args = append(r.args[:0], r.key)
+	for _, op := range ops {
+		switch op {
+		case "GET":
+			for _, bucket := range buckets {
+				r.args = append(r.args, "GET", typ, bucket*uint(r.bucketSize))
+			}
+		case "SET":
+			for _, bucket := range buckets {
+				r.args = append(r.args, "SET", typ, bucket*uint(r.bucketSize), 1)
+			}
+		default:
+			r.args = append(r.args, "OVERFLOW", "SAT")
+			delta := 1
+			if op == "DECR" {
+				delta = -1
+			}
+			for _, bucket := range buckets {
+				r.args = append(r.args, "INCRBY", typ, bucket*uint(r.bucketSize), delta)
+			}
+		}
+	}
+
+	reply, err := r.client.Do("BITFIELD", r.args...)
+	if err != nil {
+		r.err = err
+		return nil
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != len(buckets)*len(ops) {
+		r.err = errors.New("unexpected reply to BITFIELD")
+		return nil
+	}
+	results := make([]int64, len(values))
+	for i, value := range values {
+		if results[i], ok = value.(int64); !ok {
+			r.err = errors.New("unexpected reply to BITFIELD")
+			return nil
+		}
+	}
+	return results
+}
+
+// reset deletes the buckets.
+func (r *redisBuckets) reset() {
+	if r.err != nil {
+		return
+	}
+	if _, err := r.client.Do("DEL", r.key); err != nil {
+		r.err = err
+	}
+}
+
+// takeErr returns and clears the first error since it was last called.
+func (r *redisBuckets) takeErr() error {
+	err := r.err
+	r.err = nil
+	return err
+}
+
+// allNonZero returns whether all the values are non-zero.
+func allNonZero(values []int64) bool {
+	for _, value := range values {
+		if value == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RedisBloomFilter is a classic Bloom filter whose bits are stored in Redis, so
+// that many application instances can share one filter, such as for
+// distributed deduplication. The bits are a Redis string accessed with
+// BITFIELD, so each operation is a single round trip and TestAndAdd is atomic
+// across instances. Its hashing matches BloomFilter's, so it agrees with a
+// local filter with the same parameters. It isn't safe for concurrent use.
+//
+// Since Filter's methods can't return errors, Test reports false, and the
+// other operations do nothing, once a command fails. The error is reported by
+// Err, after which commands are sent again.
+type RedisBloomFilter struct {
+	buckets *redisBuckets // filter data
+	hash    hash.Hash64   // hash function (kernel for all k functions)
+	m       uint          // filter size
+	k       uint          // number of hash functions
+	indices []uint        // buffer used to cache indices
+}
+
+// NewRedisBloomFilter creates a new Bloom filter stored at the key in Redis,
+// optimized to store n items with a specified target false-positive rate.
+// Instances sharing the filter must use the same key and parameters.
+func NewRedisBloomFilter(client RedisCommander, key string, n uint, fpRate float64) *RedisBloomFilter {
+	k := OptimalK(fpRate)
+	return &RedisBloomFilter{
+		buckets: &redisBuckets{client: client, key: key, bucketSize: 1},
+		hash:    newDefaultHash(),
+		m:       OptimalM(n, fpRate),
+		k:       k,
+		indices: make([]uint, k),
+	}
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (r *RedisBloomFilter) Capacity() uint {
+	return r.m
+}
+
+// K returns the number of hash functions.
+func (r *RedisBloomFilter) K() uint {
+	return r.k
+}
+
+// SetHash sets the hashing function used in the filter. Instances sharing the
+// filter must use the same hashing function.
+func (r *RedisBloomFilter) SetHash(h hash.Hash64) {
+	r.hash = h
+}
+
+// Err returns the first error since Err was last called, if any.
+func (r *RedisBloomFilter) Err() error {
+	return r.buckets.takeErr()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (r *RedisBloomFilter) Test(data []byte) bool {
+	values := r.buckets.do(r.locations(data), "GET")
+	return values != nil && allNonZero(values)
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (r *RedisBloomFilter) Add(data []byte) Filter {
+	r.buckets.do(r.locations(data), "SET")
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not.
+func (r *RedisBloomFilter) TestAndAdd(data []byte) bool {
+	values := r.buckets.do(r.locations(data), "GET", "SET")
+	return values != nil && allNonZero(values[:r.k])
+}
+
+// Reset restores the Bloom filter to its original state by deleting the key.
+// It returns the filter to allow for chaining.
+func (r *RedisBloomFilter) Reset() *RedisBloomFilter {
+	r.buckets.reset()
+	return r
+}
+
+// String returns a one-line summary of the RedisBloomFilter for logging and
+// debugging.
+func (r *RedisBloomFilter) String() string {
+	return fmt.Sprintf("RedisBloomFilter{key=%q m=%d k=%d}", r.buckets.key, r.m, r.k)
+}
+
+// locations returns the bits for the data.
+func (r *RedisBloomFilter) locations(data []byte) []uint {
+	lower, upper := hashKernel(data, r.hash)
+	for i := uint(0); i < r.k; i++ {
+		r.indices[i] = DoubleHashing.index(lower, upper, i, r.m)
+	}
+	return r.indices
+}
+
+// RedisCountingBloomFilter is a Counting Bloom Filter whose buckets are stored
+// in Redis, so that many application instances can share one filter. The
+// buckets are a Redis string accessed with BITFIELD, saturating at their
+// maximum value, so each operation is a single round trip. Test, Add, and
+// TestAndAdd are atomic across instances, while TestAndRemove tests and
+// removes in separate commands. Its hashing matches CountingBloomFilter's. It
+// isn't safe for concurrent use.
+//
+// Since Filter's methods can't return errors, Test reports false, and the
+// other operations do nothing, once a command fails. The error is reported by
+// Err, after which commands are sent again.
+type RedisCountingBloomFilter struct {
+	buckets *redisBuckets // filter data
+	hash    hash.Hash64   // hash function (kernel for all k functions)
+	m       uint          // number of buckets
+	k       uint          // number of hash functions
+	indices []uint        // buffer used to cache indices
+}
+
+// NewRedisCountingBloomFilter creates a new Counting Bloom Filter stored at
+// the key in Redis, optimized to store n items with a specified target
+// false-positive rate and bucket size of between 1 and 63 bits. Instances
+// sharing the filter must use the same key and parameters.
+func NewRedisCountingBloomFilter(client RedisCommander, key string, n uint, b uint8, fpRate float64) *RedisCountingBloomFilter {
+	k := OptimalK(fpRate)
+	return &RedisCountingBloomFilter{
+		buckets: &redisBuckets{client: client, key: key, bucketSize: b},
+		hash:    newDefaultHash(),
+		m:       OptimalM(n, fpRate),
+		k:       k,
+		indices: make([]uint, k),
+	}
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (r *RedisCountingBloomFilter) Capacity() uint {
+	return r.m
+}
+
+// K returns the number of hash functions.
+func (r *RedisCountingBloomFilter) K() uint {
+	return r.k
+}
+
+// SetHash sets the hashing function used in the filter. Instances sharing the
+// filter must use the same hashing function.
+func (r *RedisCountingBloomFilter) SetHash(h hash.Hash64) {
+	r.hash = h
+}
+
+// Err returns the first error since Err was last called, if any.
+func (r *RedisCountingBloomFilter) Err() error {
+	return r.buckets.takeErr()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives and false negatives.
+func (r *RedisCountingBloomFilter) Test(data []byte) bool {
+	values := r.buckets.do(r.locations(data), "GET")
+	return values != nil && allNonZero(values)
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (r *RedisCountingBloomFilter) Add(data []byte) Filter {
+	r.buckets.do(r.locations(data), "INCR")
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not.
+func (r *RedisCountingBloomFilter) TestAndAdd(data []byte) bool {
+	values := r.buckets.do(r.locations(data), "GET", "INCR")
+	return values != nil && allNonZero(values[:r.k])
+}
+
+// TestAndRemove will test for membership of the data and remove it from the
+// filter if it exists. Returns true if the data was a member, false if not.
+// The test and removal are separate commands, so another instance can remove
+// the data in between.
+func (r *RedisCountingBloomFilter) TestAndRemove(data []byte) bool {
+	indices := r.locations(data)
+	values := r.buckets.do(indices, "GET")
+	if values == nil || !allNonZero(values) {
+		return false
+	}
+	return r.buckets.do(indices, "DECR") != nil
+}
+
+// Reset restores the Bloom filter to its original state by deleting the key.
+// It returns the filter to allow for chaining.
+func (r *RedisCountingBloomFilter) Reset() *RedisCountingBloomFilter {
+	r.buckets.reset()
+	return r
+}
+
+// String returns a one-line summary of the RedisCountingBloomFilter for logging
+// and debugging.
+func (r *RedisCountingBloomFilter) String() string {
+	return fmt.Sprintf("RedisCountingBloomFilter{key=%q m=%d k=%d b=%d}",
+		r.buckets.key, r.m, r.k, r.buckets.bucketSize)
+}
+
+// locations returns the buckets for the data.
+func (r *RedisCountingBloomFilter) locations(data []byte) []uint {
+	lower, upper := hashKernel(data, r.hash)
+	for i := uint(0); i < r.k; i++ {
+		r.indices[i] = DoubleHashing.index(lower, upper, i, r.m)
+	}
+	return r.indices
+}
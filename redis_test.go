@@ -0,0 +1,194 @@
+package boom
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeRedis implements the subset of Redis used by the Redis filters in
+// memory.
+type fakeRedis struct {
+	strings  map[string][]byte
+	commands int
+	fail     bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{strings: make(map[string][]byte)}
+}
+
+func (f *fakeRedis) Do(command string, args ...interface{}) (interface{}, error) {
+	f.commands++
+	if f.fail {
+		return nil, errors.New("connection refused")
+	}
+	switch command {
+	case "DEL":
+		delete(f.strings, args[0].(string))
+		return int64(1), nil
+	case "BITFIELD":
+		key := args[0].(string)
+		replies := []interface{}{}
+		for i := 1; i < len(args); {
+			op := args[i].(string)
+			if op == "OVERFLOW" {
+				i += 2
+				continue
+			}
+			bits, _ := strconv.Atoi(strings.TrimPrefix(args[i+1].(string), "u"))
+			offset := args[i+2].(uint)
+			value := f.get(key, offset, uint(bits))
+			switch op {
+			case "GET":
+				i += 3
+			case "SET":
+				f.set(key, offset, uint(bits), int64(args[i+3].(int)))
+				i += 4
+			case "INCRBY":
+				updated := value + int64(args[i+3].(int))
+				if max := int64(1)<<uint(bits) - 1; updated > max {
+					updated = max
+				} else if updated < 0 {
+					updated = 0
+				}
+				f.set(key, offset, uint(bits), updated)
+				value = updated
+				i += 4
+			}
+			replies = append(replies, value)
+		}
+		return replies, nil
+	}
+	return nil, errors.New("unknown command " + command)
+}
+
+// get returns the unsigned integer of the bits at the offset, most significant
+// bit first, as Redis does.
+func (f *fakeRedis) get(key string, offset, bits uint) int64 {
+	data := f.strings[key]
+	value := int64(0)
+	for i := offset; i < offset+bits; i++ {
+		value <<= 1
+		if i/8 < uint(len(data)) && data[i/8]&(0x80>>(i%8)) != 0 {
+			value |= 1
+		}
+	}
+	return value
+}
+
+// set sets the bits at the offset to the unsigned integer, growing the string
+// as needed.
+func (f *fakeRedis) set(key string, offset, bits uint, value int64) {
+	data := f.strings[key]
+	for uint(len(data)) < (offset+bits+7)/8 {
+		data = append(data, 0)
+	}
+	for i := offset + bits; i > offset; i-- {
+		if value&1 != 0 {
+			data[(i-1)/8] |= 0x80 >> ((i - 1) % 8)
+		} else {
+			data[(i-1)/8] &^= 0x80 >> ((i - 1) % 8)
+		}
+		value >>= 1
+	}
+	f.strings[key] = data
+}
+
+// Ensures that a RedisBloomFilter agrees with a local BloomFilter and that
+// instances sharing a key share the filter.
+func TestRedisBloomFilter(t *testing.T) {
+	redis := newFakeRedis()
+	f := NewRedisBloomFilter(redis, "users", 100, 0.01)
+	other := NewRedisBloomFilter(redis, "users", 100, 0.01)
+	local := NewBloomFilter(100, 0.01)
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned RedisBloomFilter should be the same instance")
+	}
+	local.Add([]byte(`a`))
+	if !other.Test([]byte(`a`)) {
+		t.Error("`a` should be a member of the shared filter")
+	}
+	if other.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+	local.Add([]byte(`b`))
+	if !f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	for i := 0; i < 200; i++ {
+		data := []byte(strconv.Itoa(i))
+		if f.Test(data) != local.Test(data) {
+			t.Errorf("Expected the filters to agree for `%s`", data)
+		}
+	}
+
+	f.Reset()
+	if other.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member after reset")
+	}
+	if err := f.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Ensures that a RedisCountingBloomFilter counts and removes items.
+func TestRedisCountingBloomFilter(t *testing.T) {
+	redis := newFakeRedis()
+	f := NewRedisCountingBloomFilter(redis, "events", 100, 4, 0.01)
+
+	if f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+	if !f.TestAndAdd([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	f.Add([]byte(`b`))
+
+	if !f.TestAndRemove([]byte(`a`)) || !f.Test([]byte(`a`)) {
+		t.Error("`a` should still be a member after one removal")
+	}
+	if !f.TestAndRemove([]byte(`a`)) || f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member after two removals")
+	}
+	if f.TestAndRemove([]byte(`c`)) {
+		t.Error("`c` should not be a member")
+	}
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+	if err := f.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Ensures that errors are reported by Err and operations resume afterward.
+func TestRedisBloomFilterErr(t *testing.T) {
+	redis := newFakeRedis()
+	f := NewRedisBloomFilter(redis, "users", 100, 0.01)
+	f.Add([]byte(`a`))
+
+	redis.fail = true
+	if f.Test([]byte(`a`)) {
+		t.Error("Expected Test to report false on error")
+	}
+	commands := redis.commands
+	f.Add([]byte(`b`))
+	if redis.commands != commands {
+		t.Error("Expected no commands until the error is checked")
+	}
+	if err := f.Err(); err == nil {
+		t.Error("Expected error")
+	}
+
+	redis.fail = false
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	if err := f.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
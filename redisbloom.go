@@ -0,0 +1,399 @@
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// RedisBloom chain options, from the options field of the dump header.
+const (
+	redisBloomNoRound    = 1 // filters aren't rounded up to a power of two bits
+	redisBloomEntsIsBits = 2 // the capacity was given in bits
+	redisBloomForce64    = 4 // items are hashed with 64-bit MurmurHash64A
+	redisBloomNoScaling  = 8 // no filters are added once the chain is full
+)
+
+const (
+	// redisBloomHeaderSize is the size of the dump header before the links.
+	redisBloomHeaderSize = 20
+
+	// redisBloomLinkSize is the size of each link in the dump header.
+	redisBloomLinkSize = 53
+
+	// redisBloomTightening is the ratio of each filter's false-positive rate
+	// to the previous one's.
+	redisBloomTightening = 0.5
+
+	// redisBloomMaxChunk is the maximum size of the chunks returned by
+	// ScanDump.
+	redisBloomMaxChunk = 16 << 20
+)
+
+var errRedisBloomMalformed = errors.New("malformed RedisBloom dump")
+
+// redisBloomLink is one of the Bloom filters in a RedisBloomChain, with
+// RedisBloom's layout: bit x is bit x%8 of byte x/8.
+type redisBloomLink struct {
+	data    []byte  // filter data
+	bits    uint64  // number of bits used
+	entries uint64  // capacity
+	size    uint64  // number of items added
+	error   float64 // target false-positive rate
+	bpe     float64 // bits per entry
+	hashes  uint32  // number of hash functions
+	n2      uint8   // log2 of bits if rounded to a power of two, else zero
+}
+
+// newRedisBloomLink creates a filter for the number of entries with the
+// target false-positive rate, sized as RedisBloom sizes them.
+func newRedisBloomLink(entries uint64, errorRate float64, options uint32) *redisBloomLink {
+	var (
+		bpe    = -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+		bits   = uint64(float64(entries) * bpe)
+		n2     = uint8(0)
+		hashes = uint32(math.Ceil(math.Ln2 * bpe))
+	)
+	if options&redisBloomNoRound == 0 {
+		n2 = uint8(math.Ceil(math.Log2(float64(bits))))
+		bits = 1 << n2
+	}
+	if bits == 0 {
+		bits = 1
+	}
+	return &redisBloomLink{
+		data:    make([]byte, (bits+63)/64*8),
+		bits:    bits,
+		entries: entries,
+		error:   errorRate,
+		bpe:     bpe,
+		hashes:  hashes,
+		n2:      n2,
+	}
+}
+
+// modulus returns the number of bits the hash functions index.
+func (l *redisBloomLink) modulus() uint64 {
+	if l.n2 > 0 {
+		return 1 << l.n2
+	}
+	return l.bits
+}
+
+// test returns whether all of the item's bits are set.
+func (l *redisBloomLink) test(a, b uint64) bool {
+	mod := l.modulus()
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		x := (a + i*b) % mod
+		if l.data[x>>3]&(1<<(x&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add sets the item's bits.
+func (l *redisBloomLink) add(a, b uint64) {
+	mod := l.modulus()
+	for i := uint64(0); i < uint64(l.hashes); i++ {
+		x := (a + i*b) % mod
+		l.data[x>>3] |= 1 << (x & 7)
+	}
+	l.size++
+}
+
+// RedisBloomChain is a scalable Bloom filter which is bit-for-bit compatible
+// with a RedisBloom filter, such as one created with BF.RESERVE, so that
+// filters can be migrated between a RedisBloom deployment and the process
+// without rebuilding them from the source data. ScanDump returns the chunks of
+// BF.SCANDUMP, which BF.LOADCHUNK loads into Redis, and LoadChunk loads the
+// chunks returned by BF.SCANDUMP.
+//
+// Like RedisBloom, the chain is a sequence of Bloom filters hashed with
+// MurmurHash64A, each with the capacity of the last times the expansion and
+// half its false-positive rate, added when the last is full. It isn't safe for
+// concurrent use.
+type RedisBloomChain struct {
+	links   []*redisBloomLink // filters, newest last
+	size    uint64            // number of items added
+	options uint32            // RedisBloom options
+	growth  uint32            // ratio of each filter's capacity to the last
+}
+
+// NewRedisBloomChain creates a new chain like BF.RESERVE with the initial
+// capacity, target false-positive rate, and expansion. An expansion of zero
+// creates a non-scaling chain, like BF.RESERVE's NONSCALING.
+func NewRedisBloomChain(capacity uint, errorRate float64, expansion uint) *RedisBloomChain {
+	options := uint32(redisBloomNoRound | redisBloomForce64)
+	if expansion == 0 {
+		options |= redisBloomNoScaling
+	}
+	return &RedisBloomChain{
+		links:   []*redisBloomLink{newRedisBloomLink(uint64(capacity), errorRate, options)},
+		options: options,
+		growth:  uint32(expansion),
+	}
+}
+
+// Count returns the number of items added to the chain.
+func (r *RedisBloomChain) Count() uint {
+	return uint(r.size)
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (r *RedisBloomChain) Test(data []byte) bool {
+	a, b := r.hash(data)
+	return r.test(a, b)
+}
+
+// Add will add the data to the chain, unless it's already a member, as
+// BF.ADD does. A new filter is added if the last is full, unless the chain is
+// non-scaling, in which case the last filter's false-positive rate degrades
+// where RedisBloom would reject the item. It returns the chain to allow for
+// chaining.
+func (r *RedisBloomChain) Add(data []byte) Filter {
+	r.TestAndAdd(data)
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (r *RedisBloomChain) TestAndAdd(data []byte) bool {
+	a, b := r.hash(data)
+	if r.test(a, b) {
+		return true
+	}
+
+	last := r.links[len(r.links)-1]
+	if last.size >= last.entries && r.options&redisBloomNoScaling == 0 {
+		last = newRedisBloomLink(last.entries*uint64(r.growth), last.error*redisBloomTightening, r.options)
+		r.links = append(r.links, last)
+	}
+	last.add(a, b)
+	r.size++
+	return false
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// chain's data, the sum of its filters.
+func (r *RedisBloomChain) ByteSize() uint {
+	size := uint(0)
+	for _, link := range r.links {
+		size += uint(len(link.data))
+	}
+	return size
+}
+
+// String returns a one-line summary of the RedisBloomChain for logging and
+// debugging.
+func (r *RedisBloomChain) String() string {
+	return fmt.Sprintf("RedisBloomChain{filters=%d count=%d expansion=%d}",
+		len(r.links), r.size, r.growth)
+}
+
+// ScanDump returns the chunk of the chain's BF.SCANDUMP encoding following
+// the iterator, starting from zero, and the iterator of the next chunk, which
+// is zero after the last. Each chunk can be loaded into Redis with BF.LOADCHUNK
+// and the returned iterator. The first chunk is the header, which describes the
+// filters, and the rest are their data. The chain must not be modified until
+// the last chunk is returned.
+func (r *RedisBloomChain) ScanDump(iter int64) (int64, []byte) {
+	if iter == 0 {
+		return 1, r.header()
+	}
+
+	offset := uint64(iter - 1)
+	for _, link := range r.links {
+		if offset < uint64(len(link.data)) {
+			n := uint64(len(link.data)) - offset
+			if n > redisBloomMaxChunk {
+				n = redisBloomMaxChunk
+			}
+			chunk := append([]byte(nil), link.data[offset:offset+n]...)
+			return iter + int64(n), chunk
+		}
+		offset -= uint64(len(link.data))
+	}
+	return 0, nil
+}
+
+// LoadChunk loads a chunk returned by BF.SCANDUMP, with the iterator it was
+// returned with, replacing the chain's contents when the header is loaded.
+// The chunks must be loaded in order, starting with the header. Returns an
+// error if the chunk is malformed.
+func (r *RedisBloomChain) LoadChunk(iter int64, data []byte) error {
+	if iter == 1 {
+		return r.loadHeader(data)
+	}
+	if iter < 1 || len(r.links) == 0 || int64(len(data)) > iter-1 {
+		return errRedisBloomMalformed
+	}
+
+	offset := uint64(iter-1) - uint64(len(data))
+	for _, link := range r.links {
+		if offset < uint64(len(link.data)) {
+			if offset+uint64(len(data)) > uint64(len(link.data)) {
+				return errRedisBloomMalformed
+			}
+			copy(link.data[offset:], data)
+			return nil
+		}
+		offset -= uint64(len(link.data))
+	}
+	return errRedisBloomMalformed
+}
+
+// header returns the dump header: the number of items, the number of filters,
+// the options, and the expansion, followed by each filter's size in bytes and
+// bits, number of items, false-positive rate, bits per entry, number of hash
+// functions, capacity, and n2, packed little-endian.
+func (r *RedisBloomChain) header() []byte {
+	buf := make([]byte, 0, redisBloomHeaderSize+len(r.links)*redisBloomLinkSize)
+	buf = binary.LittleEndian.AppendUint64(buf, r.size)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(r.links)))
+	buf = binary.LittleEndian.AppendUint32(buf, r.options)
+	buf = binary.LittleEndian.AppendUint32(buf, r.growth)
+	for _, link := range r.links {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(link.data)))
+		buf = binary.LittleEndian.AppendUint64(buf, link.bits)
+		buf = binary.LittleEndian.AppendUint64(buf, link.size)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(link.error))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(link.bpe))
+		buf = binary.LittleEndian.AppendUint32(buf, link.hashes)
+		buf = binary.LittleEndian.AppendUint64(buf, link.entries)
+		buf = append(buf, link.n2)
+	}
+	return buf
+}
+
+// loadHeader replaces the chain with empty filters described by the header.
+func (r *RedisBloomChain) loadHeader(data []byte) error {
+	if len(data) < redisBloomHeaderSize {
+		return errRedisBloomMalformed
+	}
+	var (
+		size    = binary.LittleEndian.Uint64(data)
+		n       = binary.LittleEndian.Uint32(data[8:])
+		options = binary.LittleEndian.Uint32(data[12:])
+		growth  = binary.LittleEndian.Uint32(data[16:])
+	)
+	data = data[redisBloomHeaderSize:]
+	if n == 0 || uint64(len(data)) != uint64(n)*redisBloomLinkSize || options&redisBloomEntsIsBits != 0 {
+		return errRedisBloomMalformed
+	}
+
+	links := make([]*redisBloomLink, n)
+	for i := range links {
+		link := &redisBloomLink{
+			bits:    binary.LittleEndian.Uint64(data[8:]),
+			size:    binary.LittleEndian.Uint64(data[16:]),
+			error:   math.Float64frombits(binary.LittleEndian.Uint64(data[24:])),
+			bpe:     math.Float64frombits(binary.LittleEndian.Uint64(data[32:])),
+			hashes:  binary.LittleEndian.Uint32(data[40:]),
+			entries: binary.LittleEndian.Uint64(data[44:]),
+			n2:      data[52],
+		}
+		bytes := binary.LittleEndian.Uint64(data)
+		if link.bits == 0 || link.n2 > 63 || link.modulus() > bytes*8 || link.hashes > maxK || bytes > math.MaxInt32 {
+			return errRedisBloomMalformed
+		}
+		link.data = make([]byte, bytes)
+		links[i] = link
+		data = data[redisBloomLinkSize:]
+	}
+
+	r.links = links
+	r.size = size
+	r.options = options
+	r.growth = growth
+	return nil
+}
+
+// hash returns the two hashes of the data from which the hash functions are
+// derived, using 64-bit MurmurHash64A or, for chains created by older
+// versions of RedisBloom, 32-bit MurmurHash2.
+func (r *RedisBloomChain) hash(data []byte) (uint64, uint64) {
+	if r.options&redisBloomForce64 != 0 {
+		a := murmur2Sum64(0xc6a4a7935bd1e995, data)
+		return a, murmur2Sum64(a, data)
+	}
+	a := murmur2Sum32(0x9747b28c, data)
+	return uint64(a), uint64(murmur2Sum32(a, data))
+}
+
+// test returns whether the item is a member of any of the filters.
+func (r *RedisBloomChain) test(a, b uint64) bool {
+	for i := len(r.links) - 1; i >= 0; i-- {
+		if r.links[i].test(a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// murmur2Sum32 returns Austin Appleby's 32-bit MurmurHash2 of the data with
+// the provided seed.
+func murmur2Sum32(seed uint32, data []byte) uint32 {
+	const m = 0x5bd1e995
+
+	h := seed ^ uint32(len(data))
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	switch tail := data[n:]; len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// murmur2Sum64 returns MurmurHash64A, the 64-bit variant of MurmurHash2, of
+// the data with the provided seed.
+func murmur2Sum64(seed uint64, data []byte) uint64 {
+	const m = 0xc6a4a7935bd1e995
+
+	h := seed ^ uint64(len(data))*m
+	n := len(data) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(data[i:])
+		k *= m
+		k ^= k >> 47
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	if tail := data[n:]; len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> 47
+	h *= m
+	h ^= h >> 47
+	return h
+}
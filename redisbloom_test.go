@@ -0,0 +1,179 @@
+package boom
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Test, Add, and TestAndAdd behave correctly and that the chain
+// scales as filters fill.
+func TestRedisBloomChain(t *testing.T) {
+	r := NewRedisBloomChain(100, 0.01, 2)
+	if r.Add([]byte(`a`)) != r {
+		t.Error("Returned RedisBloomChain should be the same instance")
+	}
+	if !r.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	if r.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+	if !r.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+	if r.Count() != 2 {
+		t.Errorf("Expected count 2, got %d", r.Count())
+	}
+
+	for i := 0; i < 1000; i++ {
+		r.Add([]byte(strconv.Itoa(i)))
+	}
+	if len(r.links) != 4 {
+		t.Errorf("Expected 4 filters, got %d", len(r.links))
+	}
+	fp := 0
+	for i := 0; i < 1000; i++ {
+		if !r.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+		if r.Test([]byte(strconv.Itoa(i + 1000))) {
+			fp++
+		}
+	}
+	if fp > 30 {
+		t.Errorf("Expected few false positives, got %d", fp)
+	}
+
+	nonScaling := NewRedisBloomChain(10, 0.01, 0)
+	for i := 0; i < 100; i++ {
+		nonScaling.Add([]byte(strconv.Itoa(i)))
+	}
+	if len(nonScaling.links) != 1 {
+		t.Errorf("Expected 1 filter, got %d", len(nonScaling.links))
+	}
+}
+
+// Ensures that a chain round-trips through ScanDump and LoadChunk.
+func TestRedisBloomChainScanDump(t *testing.T) {
+	r := NewRedisBloomChain(100, 0.01, 2)
+	for i := 0; i < 500; i++ {
+		r.Add([]byte(strconv.Itoa(i)))
+	}
+
+	other := &RedisBloomChain{}
+	chunks := 0
+	for iter := int64(0); ; {
+		next, data := r.ScanDump(iter)
+		if next == 0 {
+			break
+		}
+		if err := other.LoadChunk(next, data); err != nil {
+			t.Fatal(err)
+		}
+		iter = next
+		chunks++
+	}
+	if chunks != len(r.links)+1 {
+		t.Errorf("Expected a chunk for the header and each filter, got %d", chunks)
+	}
+
+	if other.Count() != r.Count() || len(other.links) != len(r.links) {
+		t.Errorf("Expected %s, got %s", r, other)
+	}
+	for i := 0; i < 500; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	// The loaded chain keeps scaling like the original.
+	for i := 500; i < 1000; i++ {
+		other.Add([]byte(strconv.Itoa(i)))
+		r.Add([]byte(strconv.Itoa(i)))
+	}
+	if len(other.links) != len(r.links) {
+		t.Errorf("Expected %d filters, got %d", len(r.links), len(other.links))
+	}
+}
+
+// Ensures that chains from older versions of RedisBloom, which hash with
+// 32-bit MurmurHash2, can be loaded and queried.
+func TestRedisBloomChain32(t *testing.T) {
+	r := NewRedisBloomChain(100, 0.01, 2)
+	r.options &^= redisBloomForce64
+	r.Add([]byte(`a`))
+
+	_, header := r.ScanDump(0)
+	if options := binary.LittleEndian.Uint32(header[12:]); options&redisBloomForce64 != 0 {
+		t.Errorf("Unexpected options %d", options)
+	}
+	iter, data := r.ScanDump(1)
+
+	other := &RedisBloomChain{}
+	if err := other.LoadChunk(1, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.LoadChunk(iter, data); err != nil {
+		t.Fatal(err)
+	}
+	if !other.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+	a, b := r.hash([]byte(`a`))
+	if a>>32 != 0 || b>>32 != 0 {
+		t.Error("Expected 32-bit hashes")
+	}
+}
+
+// Ensures that malformed chunks are rejected.
+func TestRedisBloomChainMalformed(t *testing.T) {
+	r := NewRedisBloomChain(100, 0.01, 2)
+	_, header := r.ScanDump(0)
+	iter, data := r.ScanDump(1)
+
+	other := &RedisBloomChain{}
+	if err := other.LoadChunk(iter, data); err == nil {
+		t.Error("Expected error loading data before the header")
+	}
+	if err := other.LoadChunk(1, header[:len(header)-1]); err == nil {
+		t.Error("Expected error for truncated header")
+	}
+	if err := other.LoadChunk(1, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.LoadChunk(iter+1, data); err == nil {
+		t.Error("Expected error for chunk past the filter")
+	}
+}
+
+// Ensures that MurmurHash2 and MurmurHash64A mix every byte of the data.
+func TestMurmur2(t *testing.T) {
+	seen32 := make(map[uint32]bool)
+	seen64 := make(map[uint64]bool)
+	data := []byte("0123456789abcdef")
+	for n := 0; n <= len(data); n++ {
+		seen32[murmur2Sum32(0, data[:n])] = true
+		seen64[murmur2Sum64(0, data[:n])] = true
+	}
+	if len(seen32) != len(data)+1 || len(seen64) != len(data)+1 {
+		t.Error("Expected distinct hashes for each prefix")
+	}
+	if murmur2Sum32(0, nil) != 0 || murmur2Sum64(0, nil) != 0 {
+		t.Error("Expected the empty input with a zero seed to hash to zero")
+	}
+}
+
+func BenchmarkRedisBloomChainAdd(b *testing.B) {
+	b.StopTimer()
+	r := NewRedisBloomChain(100000, 0.01, 2)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		r.Add(data[n])
+	}
+}
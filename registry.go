@@ -0,0 +1,177 @@
+package boom
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// ResettableFilter is a Filter which counts the items added to it and can be
+// cleared, so that frameworks can manage any of the membership filters which
+// support it without knowing its type. Filters which evict data, such as
+// StableBloomFilter and InverseBloomFilter, don't keep a meaningful count and
+// don't implement it.
+type ResettableFilter interface {
+	Filter
+
+	// Count returns the number of items added to the filter.
+	Count() uint
+
+	// Clear restores the filter to its original state.
+	Clear()
+}
+
+// FilterConstructor creates a filter optimized to store n items with the
+// target false-positive rate.
+type FilterConstructor func(n uint, fpRate float64) (Filter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]FilterConstructor{
+		"bloom": func(n uint, fpRate float64) (Filter, error) {
+			return NewBloomFilterE(n, fpRate)
+		},
+		"counting": func(n uint, fpRate float64) (Filter, error) {
+			return NewCountingBloomFilterE(n, 4, fpRate)
+		},
+		"partitioned": func(n uint, fpRate float64) (Filter, error) {
+			return NewPartitionedBloomFilterE(n, fpRate)
+		},
+		"scalable": func(n uint, fpRate float64) (Filter, error) {
+			return NewScalableBloomFilterE(n, fpRate, 0.8)
+		},
+		"stable": func(n uint, fpRate float64) (Filter, error) {
+			return NewStableBloomFilterE(OptimalStableCells(n, 1, fpRate), 1, fpRate)
+		},
+		"inverse": func(n uint, fpRate float64) (Filter, error) {
+			return NewInverseBloomFilterE(n)
+		},
+	}
+)
+
+// RegisterFilter makes a filter implementation available to NewFilter by
+// name, replacing any registered with the same name. The built-in
+// implementations are "bloom", "counting" (4-bit buckets), "partitioned",
+// "scalable" (with n as the hint and a tightening ratio of 0.8), "stable"
+// (1-bit cells, sized so that items survive n additions), and "inverse" (with
+// a capacity of n, ignoring fpRate).
+func RegisterFilter(name string, constructor FilterConstructor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = constructor
+}
+
+// NewFilter creates a filter with the implementation registered by name, so
+// that it can be chosen by configuration. Returns an error if there's no such
+// implementation or the parameters are invalid for it.
+func NewFilter(name string, n uint, fpRate float64) (Filter, error) {
+	registryMu.RLock()
+	constructor, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unknown filter " + name)
+	}
+	return constructor(n, fpRate)
+}
+
+// FilterNames returns the names of the registered filter implementations,
+// sorted.
+func FilterNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FilterConfig describes a filter declaratively, such as in a service's JSON
+// configuration, so that NewFromConfig can create it. Switching between
+// implementations is then a configuration change rather than a code change.
+type FilterConfig struct {
+	// Type is the name of a registered implementation, such as "bloom",
+	// "counting", "stable", or "scalable".
+	Type string `json:"type"`
+
+	// N is the number of items the filter is optimized for.
+	N uint `json:"n"`
+
+	// FPRate is the target false-positive rate.
+	FPRate float64 `json:"fp_rate"`
+
+	// BucketBits is the number of bits per bucket of a "counting" filter or
+	// per cell of a "stable" filter, 4 and 1 respectively if zero.
+	BucketBits uint8 `json:"bucket_bits,omitempty"`
+
+	// Decay is the ratio by which the false-positive rate of each filter a
+	// "scalable" filter adds decays, 0.8 if zero.
+	Decay float64 `json:"decay,omitempty"`
+
+	// Hash is the name of the hashing function, one of "fnv", "xxhash",
+	// "siphash" (with a random key), or "maphash", or the default hash if
+	// empty.
+	Hash string `json:"hash,omitempty"`
+}
+
+// NewFromConfig creates the filter described by the configuration. Returns an
+// error if the type or hash is unknown, a parameter doesn't apply to the
+// type, or the parameters are invalid for it.
+func NewFromConfig(cfg FilterConfig) (Filter, error) {
+	if cfg.BucketBits != 0 && cfg.Type != "counting" && cfg.Type != "stable" {
+		return nil, fmt.Errorf("bucket_bits doesn't apply to %s filters", cfg.Type)
+	}
+	if cfg.Decay != 0 && cfg.Type != "scalable" {
+		return nil, fmt.Errorf("decay doesn't apply to %s filters", cfg.Type)
+	}
+
+	var (
+		f   Filter
+		err error
+	)
+	switch {
+	case cfg.Type == "counting" && cfg.BucketBits != 0:
+		f, err = NewCountingBloomFilterE(cfg.N, cfg.BucketBits, cfg.FPRate)
+	case cfg.Type == "stable" && cfg.BucketBits != 0:
+		f, err = NewStableBloomFilterE(OptimalStableCells(cfg.N, cfg.BucketBits, cfg.FPRate),
+			cfg.BucketBits, cfg.FPRate)
+	case cfg.Type == "scalable" && cfg.Decay != 0:
+		f, err = NewScalableBloomFilterE(cfg.N, cfg.FPRate, cfg.Decay)
+	default:
+		f, err = NewFilter(cfg.Type, cfg.N, cfg.FPRate)
+	}
+	if err != nil || cfg.Hash == "" {
+		return f, err
+	}
+
+	newHash := configHash(cfg.Hash)
+	if newHash == nil {
+		return nil, errors.New("unknown hash " + cfg.Hash)
+	}
+	hashed, ok := f.(interface{ SetHash(hash.Hash64) })
+	if !ok {
+		return nil, fmt.Errorf("%s filters don't support setting the hash", cfg.Type)
+	}
+	hashed.SetHash(newHash())
+	return f, nil
+}
+
+// configHash returns the function creating the named hash for NewFromConfig,
+// or nil if there's none.
+func configHash(name string) func() hash.Hash64 {
+	switch name {
+	case "fnv":
+		return fnv.New64
+	case "xxhash":
+		return NewXXHash
+	case "siphash":
+		return newRandomSipHash
+	case "maphash":
+		return newMapHash
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package boom
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Ensures that the built-in filters can be created by name.
+func TestNewFilter(t *testing.T) {
+	expected := []string{"bloom", "counting", "inverse", "partitioned", "scalable", "stable"}
+	if names := FilterNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	for _, name := range expected {
+		f, err := NewFilter(name, 1000, 0.01)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if f.TestAndAdd([]byte(`a`)) {
+			t.Errorf("%s: `a` should not be a member", name)
+		}
+		if !f.Test([]byte(`a`)) {
+			t.Errorf("%s: `a` should be a member", name)
+		}
+	}
+
+	if _, err := NewFilter("cuckoo", 1000, 0.01); err == nil {
+		t.Error("Expected error for unknown filter")
+	}
+	if _, err := NewFilter("bloom", 1000, 0); err == nil {
+		t.Error("Expected error for invalid false-positive rate")
+	}
+}
+
+// Ensures that RegisterFilter adds implementations available to NewFilter.
+func TestRegisterFilter(t *testing.T) {
+	RegisterFilter("test-retouched", func(n uint, fpRate float64) (Filter, error) {
+		return NewRetouchedBloomFilter(n, fpRate), nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test-retouched")
+		registryMu.Unlock()
+	}()
+
+	f, err := NewFilter("test-retouched", 100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*RetouchedBloomFilter); !ok {
+		t.Errorf("Expected *RetouchedBloomFilter, got %T", f)
+	}
+}
+
+// Ensures that ResettableFilters count additions and can be cleared.
+func TestResettableFilter(t *testing.T) {
+	filters := []ResettableFilter{
+		NewBloomFilter(100, 0.01),
+		NewDefaultCountingBloomFilter(100, 0.01),
+		NewPartitionedBloomFilter(100, 0.01),
+		NewScalableBloomFilter(10, 0.01, 0.8),
+		NewRetouchedBloomFilter(100, 0.01),
+		NewYesNoBloomFilter(100, 0.01, 10, 0.01),
+		NewBIP37BloomFilter(100, 0.01, 0, BIP37UpdateNone),
+		NewCassandraBloomFilter(100, 0.01, CassandraCurrentFormat),
+		NewRocksDBBloomFilter(100, 10),
+		NewEthereumBloom(),
+	}
+
+	for _, f := range filters {
+		for i := 0; i < 50; i++ {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+		if count := f.Count(); count != 50 {
+			t.Errorf("%T: Expected 50, got %d", f, count)
+		}
+
+		f.Clear()
+		if count := f.Count(); count != 0 {
+			t.Errorf("%T: Expected 0, got %d", f, count)
+		}
+		if f.Test([]byte(`0`)) {
+			t.Errorf("%T: `0` should not be a member", f)
+		}
+	}
+}
+
+// Ensures that NewFromConfig creates filters with the configured parameters
+// and rejects invalid configurations.
+func TestNewFromConfig(t *testing.T) {
+	var cfg FilterConfig
+	err := json.Unmarshal([]byte(`{"type":"counting","n":1000,"fp_rate":0.01,"bucket_bits":8,"hash":"xxhash"}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting, ok := f.(*CountingBloomFilter)
+	if !ok {
+		t.Fatalf("Expected *CountingBloomFilter, got %T", f)
+	}
+	if counting.buckets.bucketSize != 8 {
+		t.Errorf("Expected 8, got %d", counting.buckets.bucketSize)
+	}
+	counting.Add([]byte(`a`))
+	if !counting.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	f, err = NewFromConfig(FilterConfig{Type: "stable", N: 1000, FPRate: 0.01, BucketBits: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stable := f.(*StableBloomFilter); stable.max != 3 {
+		t.Errorf("Expected 3, got %d", stable.max)
+	}
+
+	f, err = NewFromConfig(FilterConfig{Type: "scalable", N: 100, FPRate: 0.01, Decay: 0.5, Hash: "siphash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scalable := f.(*ScalableBloomFilter); scalable.r != 0.5 {
+		t.Errorf("Expected 0.5, got %f", scalable.r)
+	}
+
+	for _, cfg := range []FilterConfig{
+		{Type: "cuckoo", N: 1000, FPRate: 0.01},
+		{Type: "bloom", N: 1000, FPRate: 0.01, BucketBits: 4},
+		{Type: "counting", N: 1000, FPRate: 0.01, Decay: 0.5},
+		{Type: "counting", N: 1000, FPRate: 0.01, BucketBits: 65},
+		{Type: "scalable", N: 100, FPRate: 0.01, Decay: 1.5},
+		{Type: "bloom", N: 0, FPRate: 0.01},
+		{Type: "bloom", N: 1000, FPRate: 0.01, Hash: "md5"},
+		{Type: "inverse", N: 1000, FPRate: 0.01, Hash: "fnv"},
+	} {
+		if _, err := NewFromConfig(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
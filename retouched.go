@@ -0,0 +1,372 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// RetouchedBloomFilter implements a Retouched Bloom Filter as described by
+// Donnet, Baynat, and Friedman in Retouched Bloom Filters: Allowing Networked
+// Applications to Trade Off Selected False Positives Against False Negatives:
+//
+// http://conferences.sigcomm.org/co-next/2006/papers/papers/co-next06-final00153.pdf
+//
+// A Retouched Bloom Filter (RBF) is a Bloom filter which allows bits to be
+// selectively reset in order to remove known false positives. Resetting a bit
+// may introduce false negatives for the elements which hashed to it, so each
+// false positive is removed by resetting the bit which the fewest added
+// elements and the most known false positives hash to. To make that choice,
+// the filter keeps a small saturating counter of the elements hashing to each
+// bit alongside the bits themselves.
+//
+// Retouched Bloom Filters are useful for applications which can identify
+// their most costly false positives, such as addresses which are queried
+// frequently, and prefer a few false negatives to repeatedly paying for them.
+type RetouchedBloomFilter struct {
+	buckets *Buckets    // filter data
+	counts  *Buckets    // number of added elements hashing to each bit
+	hash    hash.Hash64 // hash function (kernel for all k functions)
+	m       uint        // filter size
+	k       uint        // number of hash functions
+	count   uint        // number of items added
+}
+
+// NewRetouchedBloomFilter creates a new Retouched Bloom Filter optimized to
+// store n items with a specified target false-positive rate.
+func NewRetouchedBloomFilter(n uint, fpRate float64) *RetouchedBloomFilter {
+	m := OptimalM(n, fpRate)
+	return &RetouchedBloomFilter{
+		buckets: NewBuckets(m, 1),
+		counts:  NewBuckets(m, 4),
+		hash:    newDefaultHash(),
+		m:       m,
+		k:       OptimalK(fpRate),
+	}
+}
+
+// NewRetouchedBloomFilterE is like NewRetouchedBloomFilter but returns an error
+// if n is zero, fpRate isn't between 0 and 1, or the filter would be too large
+// to address.
+func NewRetouchedBloomFilterE(n uint, fpRate float64) (*RetouchedBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 4); err != nil {
+		return nil, err
+	}
+	return NewRetouchedBloomFilter(n, fpRate), nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (r *RetouchedBloomFilter) Capacity() uint {
+	return r.m
+}
+
+// K returns the number of hash functions.
+func (r *RetouchedBloomFilter) K() uint {
+	return r.k
+}
+
+// Count returns the number of items added to the filter.
+func (r *RetouchedBloomFilter) Count() uint {
+	return r.count
+}
+
+// EstimateFPRate returns the current expected false-positive rate, derived
+// from the ratio of set bits and the number of hash functions. It grows as
+// the filter fills, so it can be monitored to detect when a long-lived filter
+// has degraded past its target.
+func (r *RetouchedBloomFilter) EstimateFPRate() float64 {
+	return math.Pow(r.buckets.nonZeroRatio(), float64(r.k))
+}
+
+// SetHash sets the hashing function used in the filter.
+func (r *RetouchedBloomFilter) SetHash(h hash.Hash64) {
+	r.hash = h
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives and, once false positives have been
+// cleared, false negatives.
+func (r *RetouchedBloomFilter) Test(data []byte) bool {
+	return r.TestHash(hashKernel(data, r.hash))
+}
+
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (r *RetouchedBloomFilter) TestHash(lower, upper uint32) bool {
+	// If any of the K bits are not set, then it's not a member.
+	for i := uint(0); i < r.k; i++ {
+		if r.buckets.Get(DoubleHashing.index(lower, upper, i, r.m)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (r *RetouchedBloomFilter) Add(data []byte) Filter {
+	r.AddHash(hashKernel(data, r.hash))
+	return r
+}
+
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (r *RetouchedBloomFilter) AddHash(lower, upper uint32) Filter {
+	// Set the K bits.
+	for i := uint(0); i < r.k; i++ {
+		idx := DoubleHashing.index(lower, upper, i, r.m)
+		r.buckets.Set(idx, 1)
+		r.counts.Increment(idx, 1)
+	}
+
+	r.count++
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (r *RetouchedBloomFilter) TestAndAdd(data []byte) bool {
+	member := r.Test(data)
+	r.Add(data)
+	return member
+}
+
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (r *RetouchedBloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		r.AddHash(hashKernel(element, r.hash))
+	}
+	return r
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element.
+func (r *RetouchedBloomFilter) TestMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = r.TestHash(hashKernel(element, r.hash))
+	}
+	return results
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (r *RetouchedBloomFilter) TestString(data string) bool {
+	return r.TestHash(hashKernelString(data, r.hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (r *RetouchedBloomFilter) AddString(data string) Filter {
+	return r.AddHash(hashKernelString(data, r.hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (r *RetouchedBloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, r.hash)
+	member := r.TestHash(lower, upper)
+	r.AddHash(lower, upper)
+	return member
+}
+
+// ClearFalsePositives resets bits so that none of the known false positives
+// test as members. For each false positive, the bit with the lowest ratio of
+// added elements to known false positives hashing to it is reset, which
+// introduces false negatives for the elements sharing that bit. Returns the
+// number of bits reset.
+func (r *RetouchedBloomFilter) ClearFalsePositives(knownFPs [][]byte) uint {
+	var (
+		indices = make([][]uint, 0, len(knownFPs))
+		fpCount = make(map[uint]uint)
+	)
+
+	// Count the false positives still present hashing to each bit.
+	for _, data := range knownFPs {
+		if !r.Test(data) {
+			continue
+		}
+		idx := r.indices(data)
+		for _, i := range idx {
+			fpCount[i]++
+		}
+		indices = append(indices, idx)
+	}
+
+	cleared := uint(0)
+	for _, idx := range indices {
+		if r.cleared(idx) {
+			continue
+		}
+
+		// Reset the bit which costs the fewest false negatives per false
+		// positive removed.
+		best := idx[0]
+		for _, i := range idx[1:] {
+			if r.counts.Get(i)*uint32(fpCount[best]) < r.counts.Get(best)*uint32(fpCount[i]) {
+				best = i
+			}
+		}
+
+		r.buckets.Set(best, 0)
+		r.counts.Set(best, 0)
+		cleared++
+	}
+
+	return cleared
+}
+
+// WriteTo writes a binary representation of the RetouchedBloomFilter to an
+// i/o stream. It returns the number of bytes written.
+func (r *RetouchedBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(r.count), uint64(r.m), uint64(r.k)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := r.buckets.WriteTo(stream)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	n, err = r.counts.WriteTo(stream)
+	return written + n, err
+}
+
+// ReadFrom reads a binary representation of a RetouchedBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (r *RetouchedBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	buckets, counts := &Buckets{}, &Buckets{}
+	for _, b := range []*Buckets{buckets, counts} {
+		n, err := b.ReadFrom(stream)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if uint64(b.count) != header[1] {
+			return read, errors.New("invalid retouched bloom filter dimensions")
+		}
+	}
+	if buckets.bucketSize != 1 || header[2] == 0 || header[2] > header[1] {
+		return read, errors.New("invalid retouched bloom filter dimensions")
+	}
+
+	r.buckets = buckets
+	r.counts = counts
+	if r.hash == nil {
+		r.hash = newDefaultHash()
+	}
+	r.count = uint(header[0])
+	r.m = uint(header[1])
+	r.k = uint(header[2])
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (r *RetouchedBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (r *RetouchedBloomFilter) GobDecode(data []byte) error {
+	_, err := r.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, including the counts of elements per bit.
+func (r *RetouchedBloomFilter) ByteSize() uint {
+	return r.buckets.ByteSize() + r.counts.ByteSize()
+}
+
+// String returns a one-line summary of the RetouchedBloomFilter for logging and
+// debugging.
+func (r *RetouchedBloomFilter) String() string {
+	return fmt.Sprintf("RetouchedBloomFilter{m=%d k=%d count=%d fp=%.4g}",
+		r.m, r.k, r.count, estimatedFPRate(r.m, r.k, r.count))
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (r *RetouchedBloomFilter) Reset() *RetouchedBloomFilter {
+	r.buckets.Reset()
+	r.counts.Reset()
+	r.count = 0
+	return r
+}
+
+// Copy returns a deep copy of the RetouchedBloomFilter. Returns
+// ErrHashNotCloneable if the filter's hash can't be cloned.
+func (r *RetouchedBloomFilter) Copy() (*RetouchedBloomFilter, error) {
+	hash, err := copyHash64(r.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *r
+	copied.buckets = r.buckets.Copy()
+	copied.counts = r.counts.Copy()
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other RetouchedBloomFilter has the same parameters,
+// hashing function, and bits, counts, and count.
+func (r *RetouchedBloomFilter) Equal(other *RetouchedBloomFilter) bool {
+	return r.m == other.m && r.k == other.k && r.count == other.count &&
+		sameHash(r.hash, other.hash) && r.buckets.Equal(other.buckets) &&
+		r.counts.Equal(other.counts)
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (r *RetouchedBloomFilter) Clear() {
+	r.Reset()
+}
+
+// indices returns the K bit indices for the data.
+func (r *RetouchedBloomFilter) indices(data []byte) []uint {
+	lower, upper := hashKernel(data, r.hash)
+	idx := make([]uint, r.k)
+	for i := uint(0); i < r.k; i++ {
+		idx[i] = DoubleHashing.index(lower, upper, i, r.m)
+	}
+	return idx
+}
+
+// cleared returns true if any of the bits at the indices is unset.
+func (r *RetouchedBloomFilter) cleared(indices []uint) bool {
+	for _, i := range indices {
+		if r.buckets.Get(i) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Capacity returns the number of bits, m, in the filter.
+func TestRetouchedCapacity(t *testing.T) {
+	f := NewRetouchedBloomFilter(100, 0.1)
+
+	if capacity := f.Capacity(); capacity != 480 {
+		t.Errorf("Expected 480, got %d", capacity)
+	}
+}
+
+// Ensures that NewRetouchedBloomFilterE returns an error for invalid
+// parameters.
+func TestNewRetouchedBloomFilterE(t *testing.T) {
+	if f, err := NewRetouchedBloomFilterE(100, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a RetouchedBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewRetouchedBloomFilterE(0, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewRetouchedBloomFilterE(100, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewRetouchedBloomFilterE(100, 1); err == nil {
+		t.Error("Expected error for fpRate = 1")
+	}
+}
+
+// Ensures that K returns the number of hash functions in the filter.
+func TestRetouchedK(t *testing.T) {
+	f := NewRetouchedBloomFilter(100, 0.1)
+
+	if k := f.K(); k != 4 {
+		t.Errorf("Expected 4, got %d", k)
+	}
+}
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestRetouchedTestAndAdd(t *testing.T) {
+	f := NewRetouchedBloomFilter(100, 0.01)
+
+	// `a` isn't in the filter.
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned RetouchedBloomFilter should be the same instance")
+	}
+
+	// `a` is now in the filter.
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	// `b` isn't in the filter.
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	// `b` is now in the filter.
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that ClearFalsePositives removes the known false positives while
+// introducing few false negatives.
+func TestRetouchedClearFalsePositives(t *testing.T) {
+	f := NewRetouchedBloomFilter(1000, 0.1)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	fps := [][]byte{}
+	for i := 1000; i < 5000; i++ {
+		if data := []byte(strconv.Itoa(i)); f.Test(data) {
+			fps = append(fps, data)
+		}
+	}
+	if len(fps) == 0 {
+		t.Fatal("Expected false positives")
+	}
+
+	cleared := f.ClearFalsePositives(fps)
+	if cleared == 0 || cleared > uint(len(fps)) {
+		t.Errorf("Expected between 1 and %d bits cleared, got %d", len(fps), cleared)
+	}
+
+	for _, data := range fps {
+		if f.Test(data) {
+			t.Errorf("`%s` should not be a member", data)
+		}
+	}
+
+	fns := 0
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			fns++
+		}
+	}
+	if fns > 2*len(fps) {
+		t.Errorf("Expected at most %d false negatives, got %d", 2*len(fps), fns)
+	}
+
+	// Clearing again is a no-op.
+	if cleared := f.ClearFalsePositives(fps); cleared != 0 {
+		t.Errorf("Expected 0, got %d", cleared)
+	}
+}
+
+// Ensures that Reset sets every bit to zero.
+func TestRetouchedReset(t *testing.T) {
+	f := NewRetouchedBloomFilter(100, 0.1)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if f.Reset() != f {
+		t.Error("Returned RetouchedBloomFilter should be the same instance")
+	}
+
+	for i := uint(0); i < f.buckets.Count(); i++ {
+		if f.buckets.Get(i) != 0 || f.counts.Get(i) != 0 {
+			t.Error("Expected all bits to be unset")
+		}
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+}
+
+func BenchmarkRetouchedAdd(b *testing.B) {
+	b.StopTimer()
+	f := NewRetouchedBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
+
+func BenchmarkRetouchedTest(b *testing.B) {
+	b.StopTimer()
+	f := NewRetouchedBloomFilter(100000, 0.1)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}
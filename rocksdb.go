@@ -0,0 +1,272 @@
+package boom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// rocksDBHashSeed is the seed RocksDB hashes keys with for Bloom filters.
+	rocksDBHashSeed = 0xbc9f1d34
+
+	// rocksDBLog2CacheLine is the log2 of the cache line size in bytes RocksDB
+	// builds filters for.
+	rocksDBLog2CacheLine = 6
+
+	// rocksDBMetadataLen is the number of metadata bytes at the end of a
+	// filter: one for the number of probes and four for the number of lines.
+	rocksDBMetadataLen = 5
+
+	// rocksDBMaxProbes is the maximum number of probes RocksDB uses.
+	rocksDBMaxProbes = 30
+)
+
+// RocksDBBloomFilter implements the legacy full filter format of RocksDB's
+// built-in Bloom filter policy, which is used for block-based tables with a
+// format_version below 5:
+//
+// https://github.com/facebook/rocksdb/wiki/RocksDB-Bloom-Filter
+//
+// The filter is split into an odd number of 64-byte cache lines. A key's hash
+// selects a line, and all of its probes fall within that line, so a lookup
+// touches a single cache line. Bytes returns the contents of a full filter
+// block, which is the raw bits followed by the number of probes and the
+// number of lines, so filters built by this package can be consumed by
+// RocksDB and filters from RocksDB can be read with
+// NewRocksDBBloomFilterFromBytes.
+type RocksDBBloomFilter struct {
+	data     []byte // filter data
+	lines    uint32 // number of cache lines
+	probes   uint   // number of probes
+	log2Line uint   // log2 of the cache line size in bytes
+	count    uint   // number of items added
+}
+
+// NewRocksDBBloomFilter creates a new RocksDB Bloom filter sized to store n
+// keys with the provided number of bits per key, as configured with
+// NewBloomFilterPolicy in RocksDB.
+func NewRocksDBBloomFilter(n, bitsPerKey uint) *RocksDBBloomFilter {
+	lines := uint32(0)
+	if n > 0 {
+		const lineBits = 8 << rocksDBLog2CacheLine
+		lines = uint32((n*bitsPerKey + lineBits - 1) / lineBits)
+		// An odd number of lines involves more of the hash in choosing one.
+		if lines%2 == 0 {
+			lines++
+		}
+	}
+
+	probes := uint(float64(bitsPerKey) * 0.69)
+	if probes < 1 {
+		probes = 1
+	} else if probes > rocksDBMaxProbes {
+		probes = rocksDBMaxProbes
+	}
+
+	return &RocksDBBloomFilter{
+		data:     make([]byte, uint(lines)<<rocksDBLog2CacheLine),
+		lines:    lines,
+		probes:   probes,
+		log2Line: rocksDBLog2CacheLine,
+	}
+}
+
+// NewRocksDBBloomFilterFromBytes creates a RocksDB Bloom filter from the
+// contents of a legacy full filter block. Filters built for other cache line
+// sizes are supported. Returns an error if the block uses one of RocksDB's
+// newer filter implementations or is malformed.
+func NewRocksDBBloomFilterFromBytes(block []byte) (*RocksDBBloomFilter, error) {
+	if len(block) <= rocksDBMetadataLen {
+		// RocksDB treats this as a filter with no keys.
+		return &RocksDBBloomFilter{probes: 1, log2Line: rocksDBLog2CacheLine}, nil
+	}
+
+	size := len(block) - rocksDBMetadataLen
+	probes := int8(block[size])
+	if probes < 1 {
+		return nil, errors.New("unsupported rocksdb filter implementation")
+	}
+
+	lines := binary.LittleEndian.Uint32(block[size+1:])
+	if lines == 0 || uint64(size)%uint64(lines) != 0 {
+		return nil, errors.New("invalid rocksdb filter dimensions")
+	}
+
+	log2Line := uint(0)
+	for uint64(lines)<<log2Line < uint64(size) {
+		log2Line++
+	}
+	if uint64(lines)<<log2Line != uint64(size) {
+		return nil, errors.New("invalid rocksdb filter dimensions")
+	}
+
+	data := make([]byte, size)
+	copy(data, block)
+	return &RocksDBBloomFilter{
+		data:     data,
+		lines:    lines,
+		probes:   uint(probes),
+		log2Line: log2Line,
+	}, nil
+}
+
+// Capacity returns the Bloom filter capacity, m.
+func (r *RocksDBBloomFilter) Capacity() uint {
+	return uint(len(r.data)) * 8
+}
+
+// K returns the number of probes.
+func (r *RocksDBBloomFilter) K() uint {
+	return r.probes
+}
+
+// Count returns the number of items added to the filter. It's zero for
+// filters created from bytes.
+func (r *RocksDBBloomFilter) Count() uint {
+	return r.count
+}
+
+// Bytes returns the contents of the full filter block.
+func (r *RocksDBBloomFilter) Bytes() []byte {
+	block := make([]byte, len(r.data)+rocksDBMetadataLen)
+	copy(block, r.data)
+	block[len(r.data)] = byte(r.probes)
+	binary.LittleEndian.PutUint32(block[len(r.data)+1:], r.lines)
+	return block
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (r *RocksDBBloomFilter) Test(data []byte) bool {
+	if r.lines == 0 {
+		return false
+	}
+
+	h := rocksDBHash(data, rocksDBHashSeed)
+	line := r.data[(h%r.lines)<<r.log2Line:]
+	delta := h>>17 | h<<15
+	mask := uint32(1)<<(r.log2Line+3) - 1
+
+	// If any of the probed bits are not set, then it's not a member.
+	for i := uint(0); i < r.probes; i++ {
+		pos := h & mask
+		if line[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+
+	return true
+}
+
+// Add will add the data to the Bloom filter. It returns the filter to allow
+// for chaining.
+func (r *RocksDBBloomFilter) Add(data []byte) Filter {
+	if r.lines == 0 {
+		return r
+	}
+
+	h := rocksDBHash(data, rocksDBHashSeed)
+	line := r.data[(h%r.lines)<<r.log2Line:]
+	delta := h>>17 | h<<15
+	mask := uint32(1)<<(r.log2Line+3) - 1
+
+	// Set the probed bits.
+	for i := uint(0); i < r.probes; i++ {
+		pos := h & mask
+		line[pos/8] |= 1 << (pos % 8)
+		h += delta
+	}
+
+	r.count++
+	return r
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (r *RocksDBBloomFilter) TestAndAdd(data []byte) bool {
+	if r.lines == 0 {
+		return false
+	}
+
+	h := rocksDBHash(data, rocksDBHashSeed)
+	line := r.data[(h%r.lines)<<r.log2Line:]
+	delta := h>>17 | h<<15
+	mask := uint32(1)<<(r.log2Line+3) - 1
+	member := true
+
+	// Set the probed bits, noting whether any weren't set already.
+	for i := uint(0); i < r.probes; i++ {
+		pos := h & mask
+		if line[pos/8]&(1<<(pos%8)) == 0 {
+			member = false
+			line[pos/8] |= 1 << (pos % 8)
+		}
+		h += delta
+	}
+
+	r.count++
+	return member
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (r *RocksDBBloomFilter) ByteSize() uint {
+	return uint(len(r.data))
+}
+
+// String returns a one-line summary of the RocksDBBloomFilter for logging and
+// debugging.
+func (r *RocksDBBloomFilter) String() string {
+	return fmt.Sprintf("RocksDBBloomFilter{m=%d k=%d lines=%d count=%d}",
+		r.Capacity(), r.probes, r.lines, r.count)
+}
+
+// Reset restores the Bloom filter to its original state. It returns the filter
+// to allow for chaining.
+func (r *RocksDBBloomFilter) Reset() *RocksDBBloomFilter {
+	for i := range r.data {
+		r.data[i] = 0
+	}
+	r.count = 0
+	return r
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (r *RocksDBBloomFilter) Clear() {
+	r.Reset()
+}
+
+// rocksDBHash returns RocksDB's legacy 32-bit hash of the data, which is
+// similar to MurmurHash. Trailing bytes are sign-extended for compatibility
+// with existing filters.
+func rocksDBHash(data []byte, seed uint32) uint32 {
+	const m = 0xc6a4a793
+
+	h := seed ^ uint32(len(data))*m
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		h += binary.LittleEndian.Uint32(data[i:])
+		h *= m
+		h ^= h >> 16
+	}
+
+	switch tail := data[n:]; len(tail) {
+	case 3:
+		h += uint32(int32(int8(tail[2]))) << 16
+		fallthrough
+	case 2:
+		h += uint32(int32(int8(tail[1]))) << 8
+		fallthrough
+	case 1:
+		h += uint32(int32(int8(tail[0])))
+		h *= m
+		h ^= h >> 24
+	}
+
+	return h
+}
@@ -0,0 +1,163 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+// Ensures that rocksDBHash matches the reference test vectors.
+func TestRocksDBHash(t *testing.T) {
+	vectors := []struct {
+		data     []byte
+		expected uint32
+	}{
+		{[]byte{}, 0xbc9f1d34},
+		{[]byte{0x62}, 0xef1345c4},
+		{[]byte{0xe1, 0x80, 0xb9, 0x32}, 0xed21633a},
+	}
+
+	for _, v := range vectors {
+		if h := rocksDBHash(v.data, rocksDBHashSeed); h != v.expected {
+			t.Errorf("Expected %#08x, got %#08x", v.expected, h)
+		}
+	}
+
+	// Trailing bytes are sign-extended, so 0xff adds -1.
+	m := uint32(0xc6a4a793)
+	expected := (m - 1) * m
+	expected ^= expected >> 24
+	if h := rocksDBHash([]byte{0xff}, 0); h != expected {
+		t.Errorf("Expected %#08x, got %#08x", expected, h)
+	}
+}
+
+// Ensures that filters are laid out in an odd number of cache lines with the
+// RocksDB metadata trailer.
+func TestRocksDBLayout(t *testing.T) {
+	f := NewRocksDBBloomFilter(100, 10)
+
+	// 1000 bits round up to 2 lines of 512 bits, then to an odd number.
+	if capacity := f.Capacity(); capacity != 3*512 {
+		t.Errorf("Expected 1536, got %d", capacity)
+	}
+
+	if k := f.K(); k != 6 {
+		t.Errorf("Expected 6, got %d", k)
+	}
+
+	block := f.Bytes()
+	if len(block) != 3*64+5 {
+		t.Errorf("Expected %d, got %d", 3*64+5, len(block))
+	}
+
+	if block[3*64] != 6 || binary.LittleEndian.Uint32(block[3*64+1:]) != 3 {
+		t.Error("Expected metadata of 6 probes and 3 lines")
+	}
+}
+
+// Ensures that Test, Add, and TestAndAdd behave correctly and that probes
+// stay within a single cache line.
+func TestRocksDBTestAndAdd(t *testing.T) {
+	f := NewRocksDBBloomFilter(100, 10)
+
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned RocksDBBloomFilter should be the same instance")
+	}
+
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+
+	g := NewRocksDBBloomFilter(100, 10)
+	g.Add([]byte(`c`))
+	lines := 0
+	for line := 0; line < 3; line++ {
+		if !bytes.Equal(g.data[line*64:(line+1)*64], make([]byte, 64)) {
+			lines++
+		}
+	}
+	if lines != 1 {
+		t.Errorf("Expected 1 line to be touched, got %d", lines)
+	}
+}
+
+// Ensures that filters can be read from full filter blocks.
+func TestRocksDBFromBytes(t *testing.T) {
+	f := NewRocksDBBloomFilter(1000, 10)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	other, err := NewRocksDBBloomFilterFromBytes(f.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !other.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	fp := 0
+	for i := 1000; i < 11000; i++ {
+		if other.Test([]byte(strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if fp > 200 {
+		t.Errorf("Expected at most 200 false positives, got %d", fp)
+	}
+
+	// Empty blocks contain nothing.
+	empty, err := NewRocksDBBloomFilterFromBytes(nil)
+	if err != nil || empty.Test([]byte(`a`)) {
+		t.Error("Expected empty filter to contain nothing")
+	}
+
+	// Blocks built for a 128-byte cache line.
+	block := make([]byte, 3*128+5)
+	block[3*128] = 6
+	binary.LittleEndian.PutUint32(block[3*128+1:], 3)
+	wide, err := NewRocksDBBloomFilterFromBytes(block)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wide.Add([]byte(`a`))
+	if !wide.Test([]byte(`a`)) || wide.log2Line != 7 {
+		t.Error("Expected 128-byte cache lines")
+	}
+
+	// Newer implementations are marked with a negative number of probes.
+	block[3*128] = 0xff
+	if _, err := NewRocksDBBloomFilterFromBytes(block); err == nil {
+		t.Error("Expected error for unsupported implementation")
+	}
+
+	block[3*128] = 6
+	binary.LittleEndian.PutUint32(block[3*128+1:], 5)
+	if _, err := NewRocksDBBloomFilterFromBytes(block); err == nil {
+		t.Error("Expected error for invalid dimensions")
+	}
+}
+
+func BenchmarkRocksDBAdd(b *testing.B) {
+	f := NewRocksDBBloomFilter(100000, 10)
+	for n := 0; n < b.N; n++ {
+		f.Add([]byte(strconv.Itoa(n)))
+	}
+}
@@ -15,7 +15,31 @@ copies or substantial portions of the Software.
 
 package boom
 
-import "math"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// maxScalableGrowth is the largest growth factor auto-tuning uses.
+	maxScalableGrowth = 4
+
+	// scalableBurstFactor is how many times faster than the smoothed rate a
+	// partition must fill to be treated as a burst rather than sustained load.
+	scalableBurstFactor = 2
+
+	// scalableFillTolerance is the fraction of the target fill ratio a
+	// partition must measure when it's retired for auto-tuning to grow the
+	// next partition. A lower measured fill means many additions were
+	// duplicates and the partitions are larger than needed.
+	scalableFillTolerance = 0.8
+)
 
 // ScalableBloomFilter implements a Scalable Bloom Filter as described by
 // Almeida, Baquero, Preguica, and Hutchison in Scalable Bloom Filters:
@@ -39,6 +63,22 @@ type ScalableBloomFilter struct {
 	fp      float64                   // target false-positive rate
 	p       float64                   // partition fill ratio
 	hint    uint                      // filter size hint
+	hash    hash.Hash64               // hash function, nil for the default
+	tuner   *scalableTuner            // auto-tuning state, nil if disabled
+}
+
+// scalableTuner adapts the growth factor and tightening ratio of a
+// ScalableBloomFilter to the observed insertion rate.
+type scalableTuner struct {
+	target   time.Duration    // desired lifetime of a filter
+	now      func() time.Time // clock
+	started  time.Time        // when the last filter was added
+	rate     float64          // smoothed insertion rate, items per second
+	growth   float64          // growth factor of filter sizes
+	r        float64          // current tightening ratio
+	hint     uint             // smallest size hint of a new filter
+	lastHint uint             // size hint of the last filter
+	lastFP   float64          // false-positive rate of the last filter
 }
 
 // NewScalableBloomFilter creates a new Scalable Bloom Filter with the
@@ -58,12 +98,101 @@ func NewScalableBloomFilter(hint uint, fpRate, r float64) *ScalableBloomFilter {
 	return s
 }
 
+// NewScalableBloomFilterE is like NewScalableBloomFilter but returns an error
+// if hint is zero, either fpRate or r isn't between 0 and 1, or the first
+// filter's size overflows.
+func NewScalableBloomFilterE(hint uint, fpRate, r float64) (*ScalableBloomFilter, error) {
+	if err := validateScalable(hint, fpRate, r, fillRatio); err != nil {
+		return nil, err
+	}
+	return NewScalableBloomFilter(hint, fpRate, r), nil
+}
+
+// validateScalable returns an error if hint is zero, any of fpRate, r, or the
+// fill ratio p isn't between 0 and 1, or the first filter's size overflows.
+func validateScalable(hint uint, fpRate, r, p float64) error {
+	if hint == 0 {
+		return errors.New("hint must be positive")
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return err
+	}
+	if err := validateRate("r", r); err != nil {
+		return err
+	}
+	if err := validateRate("p", p); err != nil {
+		return err
+	}
+	return validateSize(hint, fpRate, 1)
+}
+
 // NewDefaultScalableBloomFilter creates a new Scalable Bloom Filter with the
 // specified target false-positive rate and an optimal tightening ratio.
 func NewDefaultScalableBloomFilter(fpRate float64) *ScalableBloomFilter {
 	return NewScalableBloomFilter(10000, fpRate, 0.8)
 }
 
+// SetAutoTuning enables auto-tuning of the growth factor and tightening ratio
+// for long-lived filters, aiming for each new Bloom filter to last about the
+// target duration. A zero target disables auto-tuning, after which new filters
+// are added with the original hint size.
+//
+// Without auto-tuning every filter is the size of the hint, so sustained high
+// insertion rates add many small filters, making tests slower. With it, the
+// insertion rate is measured as each filter fills, and the size of the next
+// filter doubles, up to four times the last, while filters fill in under half
+// the target, and halves, down to the hint, while they take over twice the
+// target. The band between the two provides hysteresis. A filter filling more
+// than twice as fast as the smoothed rate is treated as a burst which doesn't
+// grow the next filter, so bursty load doesn't over-allocate, and neither does
+// a filter whose measured fill shows most additions were duplicates.
+//
+// Larger filters mean fewer are needed, so the tightening ratio is lowered
+// from r as the growth factor rises. It's never raised above r, so the
+// compounded false-positive rate stays within the same bound. The tuning state
+// isn't serialized.
+func (s *ScalableBloomFilter) SetAutoTuning(target time.Duration) {
+	if target <= 0 {
+		s.tuner = nil
+		return
+	}
+	if s.tuner != nil {
+		s.tuner.target = target
+		return
+	}
+
+	last := len(s.filters) - 1
+	s.tuner = &scalableTuner{
+		target:   target,
+		now:      time.Now,
+		started:  time.Now(),
+		growth:   1,
+		r:        s.r,
+		hint:     s.hint,
+		lastHint: s.hint,
+		lastFP:   s.fp * math.Pow(s.r, float64(last)),
+	}
+}
+
+// Growth returns the factor by which each new Bloom filter's size grows over
+// the last, which is one unless auto-tuning is enabled. It's below one while
+// new filters shrink back toward the hint.
+func (s *ScalableBloomFilter) Growth() float64 {
+	if s.tuner == nil {
+		return 1
+	}
+	return s.tuner.growth
+}
+
+// TighteningRatio returns the ratio of each new Bloom filter's false-positive
+// rate to the last, which is r unless auto-tuning is enabled.
+func (s *ScalableBloomFilter) TighteningRatio() float64 {
+	if s.tuner == nil {
+		return s.r
+	}
+	return s.tuner.r
+}
+
 // Capacity returns the current Scalable Bloom Filter capacity, which is the
 // sum of the capacities for the contained series of Bloom filters.
 func (s *ScalableBloomFilter) Capacity() uint {
@@ -74,8 +203,17 @@ func (s *ScalableBloomFilter) Capacity() uint {
 	return capacity
 }
 
+// Filters returns the number of Bloom filters the Scalable Bloom Filter has
+// grown to, one more each time the last filled up.
+func (s *ScalableBloomFilter) Filters() uint {
+	return uint(len(s.filters))
+}
+
 // K returns the number of hash functions used in each Bloom filter.
 func (s *ScalableBloomFilter) K() uint {
+	if len(s.filters) == 0 {
+		return 0
+	}
 	// K is the same across every filter.
 	return s.filters[0].K()
 }
@@ -89,14 +227,51 @@ func (s *ScalableBloomFilter) FillRatio() float64 {
 	return sum / float64(len(s.filters))
 }
 
+// EstimateFPRate returns the current expected false-positive rate, the
+// probability that any of the Bloom filters reports a false positive. Unlike
+// the target rate, which the filter maintains by adding filters, it reflects
+// how full the filters actually are.
+func (s *ScalableBloomFilter) EstimateFPRate() float64 {
+	miss := 1.0
+	for _, filter := range s.filters {
+		miss *= 1 - filter.EstimateFPRate()
+	}
+	return 1 - miss
+}
+
+// Count returns the number of items added to the filter.
+func (s *ScalableBloomFilter) Count() uint {
+	count := uint(0)
+	for _, bf := range s.filters {
+		count += bf.Count()
+	}
+	return count
+}
+
+// SetHash sets the hashing function used in the filter. It applies to the
+// existing Bloom filters and those added later.
+func (s *ScalableBloomFilter) SetHash(h hash.Hash64) {
+	s.hash = h
+	for _, filter := range s.filters {
+		filter.SetHash(h)
+	}
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives but a zero probability of false
 // negatives.
 func (s *ScalableBloomFilter) Test(data []byte) bool {
+	return s.TestHash(hashKernel(data, s.filters[0].hash))
+}
+
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (s *ScalableBloomFilter) TestHash(lower, upper uint32) bool {
 	// Querying is made by testing for the presence in each filter.
 	for _, bf := range s.filters {
-		if bf.Test(data) {
+		if bf.TestHash(lower, upper) {
 			return true
 		}
 	}
@@ -107,37 +282,293 @@ func (s *ScalableBloomFilter) Test(data []byte) bool {
 // Add will add the data to the Bloom filter. It returns the filter to allow
 // for chaining.
 func (s *ScalableBloomFilter) Add(data []byte) Filter {
+	return s.AddHash(hashKernel(data, s.filters[0].hash))
+}
+
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (s *ScalableBloomFilter) AddHash(lower, upper uint32) Filter {
 	idx := len(s.filters) - 1
 
 	// If the last filter has reached its fill ratio, add a new one.
 	if s.filters[idx].EstimatedFillRatio() >= s.p {
+		if s.tuner != nil {
+			s.tuner.tune(s.filters[idx], s.p, s.r)
+		}
 		s.addFilter()
 		idx++
 	}
 
-	s.filters[idx].Add(data)
+	s.filters[idx].AddHash(lower, upper)
 	return s
 }
 
 // TestAndAdd is equivalent to calling Test followed by Add. It returns true if
-// the data is a member, false if not.
+// the data is a member, false if not. The data is only hashed once.
 func (s *ScalableBloomFilter) TestAndAdd(data []byte) bool {
-	member := s.Test(data)
-	s.Add(data)
+	lower, upper := hashKernel(data, s.filters[0].hash)
+	member := s.TestHash(lower, upper)
+	s.AddHash(lower, upper)
+	return member
+}
+
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (s *ScalableBloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		s.AddHash(hashKernel(element, s.filters[0].hash))
+	}
+	return s
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element.
+func (s *ScalableBloomFilter) TestMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = s.TestHash(hashKernel(element, s.filters[0].hash))
+	}
+	return results
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (s *ScalableBloomFilter) TestString(data string) bool {
+	return s.TestHash(hashKernelString(data, s.filters[0].hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (s *ScalableBloomFilter) AddString(data string) Filter {
+	return s.AddHash(hashKernelString(data, s.filters[0].hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (s *ScalableBloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, s.filters[0].hash)
+	member := s.TestHash(lower, upper)
+	s.AddHash(lower, upper)
 	return member
 }
 
+// WriteTo writes a binary representation of the ScalableBloomFilter to an i/o
+// stream. It returns the number of bytes written. The auto-tuning state isn't
+// written.
+func (s *ScalableBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := scalableHeader{s.r, s.fp, s.p, uint64(s.hint), uint64(len(s.filters))}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, filter := range s.filters {
+		n, err := filter.WriteTo(stream)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a ScalableBloomFilter (such as
+// might have been written by WriteTo()) from an i/o stream. It returns the
+// number of bytes read.
+func (s *ScalableBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	var header scalableHeader
+	if err := binary.Read(stream, binary.BigEndian, &header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	if header.Filters == 0 ||
+		validateScalable(uint(header.Hint), header.FP, header.R, header.P) != nil {
+		return read, errors.New("invalid scalable bloom filter dimensions")
+	}
+	filters := make([]*PartitionedBloomFilter, 0, 1)
+	for i := uint64(0); i < header.Filters; i++ {
+		filter := &PartitionedBloomFilter{}
+		n, err := filter.ReadFrom(stream)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		filters = append(filters, filter)
+	}
+
+	s.filters = filters
+	s.r = header.R
+	s.fp = header.FP
+	s.p = header.P
+	s.hint = uint(header.Hint)
+	s.tuner = nil
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *ScalableBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *ScalableBloomFilter) GobDecode(data []byte) error {
+	_, err := s.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// scalableHeader is the header of the binary representation of a
+// ScalableBloomFilter.
+type scalableHeader struct {
+	R       float64
+	FP      float64
+	P       float64
+	Hint    uint64
+	Filters uint64
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, the sum of its Bloom filters.
+func (s *ScalableBloomFilter) ByteSize() uint {
+	size := uint(0)
+	for _, filter := range s.filters {
+		size += filter.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the ScalableBloomFilter for logging and
+// debugging.
+func (s *ScalableBloomFilter) String() string {
+	return fmt.Sprintf("ScalableBloomFilter{filters=%d m=%d k=%d r=%g count=%d fill=%.4f fp=%.4g}",
+		len(s.filters), s.Capacity(), s.K(), s.r, s.Count(), s.FillRatio(), s.fp)
+}
+
 // Reset restores the Bloom filter to its original state. It returns the filter
 // to allow for chaining.
 func (s *ScalableBloomFilter) Reset() *ScalableBloomFilter {
 	s.filters = make([]*PartitionedBloomFilter, 0, 1)
+	if s.tuner != nil {
+		target := s.tuner.target
+		s.tuner = nil
+		s.SetAutoTuning(target)
+	}
 	s.addFilter()
 	return s
 }
 
+// Copy returns a deep copy of the ScalableBloomFilter, keeping the auto-tuning
+// state, if any. Returns ErrHashNotCloneable if the filter's hash can't be
+// cloned.
+func (s *ScalableBloomFilter) Copy() (*ScalableBloomFilter, error) {
+	copied := *s
+	copied.filters = make([]*PartitionedBloomFilter, len(s.filters))
+	for i, filter := range s.filters {
+		var err error
+		if copied.filters[i], err = filter.Copy(); err != nil {
+			return nil, err
+		}
+	}
+	if s.hash != nil {
+		copied.hash = copied.filters[0].hash
+		for _, filter := range copied.filters {
+			filter.hash = copied.hash
+		}
+	}
+	if s.tuner != nil {
+		tuner := *s.tuner
+		copied.tuner = &tuner
+	}
+	return &copied, nil
+}
+
+// Equal returns whether the other ScalableBloomFilter has the same parameters
+// and equal Bloom filters. The auto-tuning state isn't compared.
+func (s *ScalableBloomFilter) Equal(other *ScalableBloomFilter) bool {
+	if s.r != other.r || s.fp != other.fp || s.p != other.p || s.hint != other.hint ||
+		len(s.filters) != len(other.filters) {
+		return false
+	}
+	for i, filter := range s.filters {
+		if !filter.Equal(other.filters[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (s *ScalableBloomFilter) Clear() {
+	s.Reset()
+}
+
 // addFilter adds a new Bloom filter with a restricted false-positive rate to
 // the Scalable Bloom Filter
 func (s *ScalableBloomFilter) addFilter() {
+	if t := s.tuner; t != nil && len(s.filters) > 0 {
+		t.lastHint = uint(math.Round(float64(t.lastHint) * t.growth))
+		t.lastFP *= t.r
+		t.started = t.now()
+		s.appendFilter(NewPartitionedBloomFilter(t.lastHint, t.lastFP))
+		return
+	}
+
 	fpRate := s.fp * math.Pow(s.r, float64(len(s.filters)))
-	s.filters = append(s.filters, NewPartitionedBloomFilter(s.hint, fpRate))
+	s.appendFilter(NewPartitionedBloomFilter(s.hint, fpRate))
+}
+
+// appendFilter appends the Bloom filter to the series, setting its hashing
+// function if one was set with SetHash.
+func (s *ScalableBloomFilter) appendFilter(filter *PartitionedBloomFilter) {
+	if s.hash != nil {
+		filter.SetHash(s.hash)
+	}
+	s.filters = append(s.filters, filter)
+}
+
+// tune updates the growth factor and tightening ratio when the filter, which
+// was the last added, has reached the fill ratio p. The tightening ratio is
+// lowered from r as the growth factor rises.
+func (t *scalableTuner) tune(filled *PartitionedBloomFilter, p, r float64) {
+	elapsed := t.now().Sub(t.started)
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	rate := float64(filled.Count()) / elapsed.Seconds()
+
+	// Slowdowns are adopted immediately so that filters stop growing, while
+	// rises are averaged and bursts only move the smoothed rate as far as the
+	// burst threshold.
+	burst := t.rate > 0 && rate > scalableBurstFactor*t.rate
+	switch {
+	case t.rate == 0 || rate < t.rate:
+		t.rate = rate
+	case burst:
+		t.rate = (t.rate + scalableBurstFactor*t.rate) / 2
+	default:
+		t.rate = (t.rate + rate) / 2
+	}
+
+	// Expected lifetime of the next filter at the smoothed rate.
+	lifetime := time.Duration(float64(t.lastHint) * t.growth / t.rate * float64(time.Second))
+	duplicates := filled.FillRatio() < p*scalableFillTolerance
+	switch {
+	case lifetime < t.target/2 && !burst && !duplicates:
+		t.growth = math.Min(t.growth*2, maxScalableGrowth)
+	case lifetime > t.target*2 || duplicates:
+		t.growth = 0.5
+	}
+
+	// New filters shrink no further than the hint.
+	if float64(t.lastHint)*t.growth < float64(t.hint) {
+		t.growth = float64(t.hint) / float64(t.lastHint)
+	}
+	t.r = r * (1 - 0.05*math.Log2(math.Max(t.growth, 1)))
 }
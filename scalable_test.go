@@ -3,6 +3,7 @@ package boom
 import (
 	"strconv"
 	"testing"
+	"time"
 )
 
 // Ensures that NewDefaultScalableBloomFilter creates a Scalable Bloom Filter
@@ -35,6 +36,29 @@ func TestScalableBloomCapacity(t *testing.T) {
 	}
 }
 
+// Ensures that NewScalableBloomFilterE returns an error for invalid parameters.
+func TestNewScalableBloomFilterE(t *testing.T) {
+	if f, err := NewScalableBloomFilterE(100, 0.01, 0.8); err != nil || f == nil {
+		t.Errorf("Expected a ScalableBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewScalableBloomFilterE(0, 0.01, 0.8); err == nil {
+		t.Error("Expected error for hint = 0")
+	}
+
+	if _, err := NewScalableBloomFilterE(100, 0, 0.8); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+
+	if _, err := NewScalableBloomFilterE(100, 0.01, 1); err == nil {
+		t.Error("Expected error for r = 1")
+	}
+
+	if _, err := NewScalableBloomFilterE(^uint(0), 0.01, 0.8); err == nil {
+		t.Error("Expected error for a hint whose filter overflows")
+	}
+}
+
 // Ensures that K returns the number of hash functions used in each Bloom
 // filter.
 func TestScalableBloomK(t *testing.T) {
@@ -180,3 +204,111 @@ func BenchmarkScalableBloomTestAndAdd(b *testing.B) {
 		f.TestAndAdd(data[n])
 	}
 }
+
+// fillScalable adds distinct items to the filter until it adds a new Bloom
+// filter, advancing the clock by step for each, and returns the next item.
+func fillScalable(f *ScalableBloomFilter, clock *time.Time, step time.Duration, next int) int {
+	filters := len(f.filters)
+	for len(f.filters) == filters {
+		*clock = clock.Add(step)
+		f.Add([]byte(strconv.Itoa(next)))
+		next++
+	}
+	return next
+}
+
+// Ensures that auto-tuning grows new filters under sustained high insertion
+// rates and lowers the tightening ratio, but not past the limits.
+func TestScalableAutoTuningGrowth(t *testing.T) {
+	f := NewScalableBloomFilter(100, 0.01, 0.8)
+	f.SetAutoTuning(time.Hour)
+	clock := time.Unix(0, 0)
+	f.tuner.now = func() time.Time { return clock }
+	f.tuner.started = clock
+
+	next := 0
+	for i := 0; i < 4; i++ {
+		next = fillScalable(f, &clock, time.Millisecond, next)
+	}
+
+	if growth := f.Growth(); growth != 4 {
+		t.Errorf("Expected 4, got %f", growth)
+	}
+	if r := f.TighteningRatio(); r < 0.719 || r > 0.721 {
+		t.Errorf("Expected 0.72, got %f", r)
+	}
+	// The hint doubled, then grew fourfold for each new filter.
+	last := f.filters[len(f.filters)-1]
+	if expected := NewPartitionedBloomFilter(12800, f.tuner.lastFP).Capacity(); last.Capacity() != expected {
+		t.Errorf("Expected capacity %d, got %d", expected, last.Capacity())
+	}
+
+	for i := 0; i < next; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	// Slow insertion halves new filters until they're back down to the hint.
+	hint := f.tuner.lastHint
+	for hint > 100 {
+		next = fillScalable(f, &clock, time.Minute, next)
+		hint = max(hint/2, 100)
+		last = f.filters[len(f.filters)-1]
+		if expected := NewPartitionedBloomFilter(hint, f.tuner.lastFP).Capacity(); last.Capacity() != expected {
+			t.Errorf("Expected capacity %d, got %d", expected, last.Capacity())
+		}
+		if r := f.TighteningRatio(); r != 0.8 {
+			t.Errorf("Expected 0.8, got %f", r)
+		}
+	}
+	next = fillScalable(f, &clock, time.Minute, next)
+	last = f.filters[len(f.filters)-1]
+	if expected := NewPartitionedBloomFilter(100, f.tuner.lastFP).Capacity(); last.Capacity() != expected {
+		t.Errorf("Expected capacity %d, got %d", expected, last.Capacity())
+	}
+	if growth := f.Growth(); growth != 1 {
+		t.Errorf("Expected 1, got %f", growth)
+	}
+
+	f.SetAutoTuning(0)
+	if f.Growth() != 1 || f.TighteningRatio() != 0.8 {
+		t.Error("Expected auto-tuning to be disabled")
+	}
+}
+
+// Ensures that auto-tuning doesn't grow new filters for a burst or when most
+// additions are duplicates.
+func TestScalableAutoTuningHysteresis(t *testing.T) {
+	f := NewScalableBloomFilter(100, 0.01, 0.8)
+	f.SetAutoTuning(time.Second)
+	clock := time.Unix(0, 0)
+	f.tuner.now = func() time.Time { return clock }
+	f.tuner.started = clock
+
+	// Filters lasting about the target don't change the growth.
+	next := 0
+	for i := 0; i < 3; i++ {
+		next = fillScalable(f, &clock, 10*time.Millisecond, next)
+	}
+	if growth := f.Growth(); growth != 1 {
+		t.Errorf("Expected 1, got %f", growth)
+	}
+
+	// A burst doesn't either.
+	next = fillScalable(f, &clock, 0, next)
+	if growth := f.Growth(); growth != 1 {
+		t.Errorf("Expected 1, got %f", growth)
+	}
+
+	// Nor do fast duplicate additions.
+	filters := len(f.filters)
+	for len(f.filters) == filters {
+		clock = clock.Add(time.Millisecond)
+		f.Add([]byte(strconv.Itoa(next % 10)))
+		next++
+	}
+	if growth := f.Growth(); growth != 1 {
+		t.Errorf("Expected 1, got %f", growth)
+	}
+}
@@ -0,0 +1,187 @@
+package boom
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+// filterShard is one of a ShardedFilter's filters and its lock, padded to a
+// 64-byte cache line so that goroutines locking neighboring shards don't
+// contend on the same line.
+type filterShard struct {
+	mu     sync.Mutex // guards filter
+	filter Filter     // filter for the shard's data
+	_      [40]byte
+}
+
+// ShardedFilter splits data by hash across several filters, each with its own
+// lock, so that it's safe for concurrent use and adds from many goroutines
+// rarely contend, scaling write throughput on many-core machines. A
+// SynchronizedFilter serializes every operation on a single lock instead.
+//
+// Data is only added to and tested in the shard it routes to, so the shards
+// together behave as one filter with their combined capacity. Routing uses its
+// own hash of the data, independent of the shards' hashing functions.
+type ShardedFilter struct {
+	shards []filterShard
+}
+
+// NewShardedFilter creates a new ShardedFilter with the provided number of
+// shards, calling newFilter to create each. Each shard receives about 1/shards
+// of the data, so the filters should be sized accordingly. At least one shard
+// is created.
+func NewShardedFilter(shards uint, newFilter func() Filter) *ShardedFilter {
+	if shards == 0 {
+		shards = 1
+	}
+	s := &ShardedFilter{shards: make([]filterShard, shards)}
+	for i := range s.shards {
+		s.shards[i].filter = newFilter()
+	}
+	return s
+}
+
+// NewShardedBloomFilter creates a new ShardedFilter of Bloom filters, with the
+// provided number of shards, optimized to store n items in total with a
+// specified target false-positive rate.
+func NewShardedBloomFilter(n uint, fpRate float64, shards uint) *ShardedFilter {
+	perShard := n
+	if shards > 1 {
+		perShard = (n + shards - 1) / shards
+	}
+	return NewShardedFilter(shards, func() Filter {
+		return NewBloomFilter(perShard, fpRate)
+	})
+}
+
+// Shards returns the number of shards.
+func (s *ShardedFilter) Shards() uint {
+	return uint(len(s.shards))
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. It's safe to call concurrently.
+func (s *ShardedFilter) Test(data []byte) bool {
+	shard := s.shard(data)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.filter.Test(data)
+}
+
+// Add will add the data to the filter. It returns the ShardedFilter to allow
+// for chaining. It's safe to call concurrently.
+func (s *ShardedFilter) Add(data []byte) Filter {
+	shard := s.shard(data)
+	shard.mu.Lock()
+	shard.filter.Add(data)
+	shard.mu.Unlock()
+	return s
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not. It's safe to call
+// concurrently.
+func (s *ShardedFilter) TestAndAdd(data []byte) bool {
+	shard := s.shard(data)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.filter.TestAndAdd(data)
+}
+
+// AddMany will add each element of data to the filter, taking each shard's
+// lock once. It returns the ShardedFilter to allow for chaining. It's safe to
+// call concurrently.
+func (s *ShardedFilter) AddMany(data [][]byte) Filter {
+	groups := make([][][]byte, len(s.shards))
+	for _, element := range data {
+		i := s.index(element)
+		groups[i] = append(groups[i], element)
+	}
+	for i, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		if many, ok := shard.filter.(interface{ AddMany([][]byte) Filter }); ok {
+			many.AddMany(group)
+		} else {
+			for _, element := range group {
+				shard.filter.Add(element)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return s
+}
+
+// Count returns the number of items added to the filter, the sum of the
+// shards' counts. Shards which don't report a count are ignored. It's safe to
+// call concurrently.
+func (s *ShardedFilter) Count() uint {
+	var count uint
+	s.each(func(filter Filter) {
+		if counter, ok := filter.(interface{ Count() uint }); ok {
+			count += counter.Count()
+		}
+	})
+	return count
+}
+
+// Clear restores each shard which has a Clear method to its original state.
+// It's safe to call concurrently.
+func (s *ShardedFilter) Clear() {
+	s.each(func(filter Filter) {
+		if resettable, ok := filter.(interface{ Clear() }); ok {
+			resettable.Clear()
+		}
+	})
+}
+
+// Do calls fn with each shard's filter in turn while holding its lock, so
+// that any of their other methods can be called safely. The filters must not
+// be retained after fn returns.
+func (s *ShardedFilter) Do(fn func(shard uint, filter Filter)) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		fn(uint(i), shard.filter)
+		shard.mu.Unlock()
+	}
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// shards' data, counting only the shards which report their size.
+func (s *ShardedFilter) ByteSize() uint {
+	var size uint
+	s.each(func(filter Filter) {
+		size += byteSize(filter)
+	})
+	return size
+}
+
+// String returns a one-line summary of the ShardedFilter for logging and
+// debugging.
+func (s *ShardedFilter) String() string {
+	return fmt.Sprintf("ShardedFilter{shards=%d count=%d}", len(s.shards), s.Count())
+}
+
+// each calls fn with each shard's filter while holding its lock.
+func (s *ShardedFilter) each(fn func(filter Filter)) {
+	s.Do(func(shard uint, filter Filter) {
+		fn(filter)
+	})
+}
+
+// shard returns the shard the data routes to.
+func (s *ShardedFilter) shard(data []byte) *filterShard {
+	return &s.shards[s.index(data)]
+}
+
+// index returns the index of the shard the data routes to. The FNV hash is
+// mixed so that its high bits, which pick the shard, are well distributed.
+func (s *ShardedFilter) index(data []byte) int {
+	hi, _ := bits.Mul64(fmix64(fnv64(data)), uint64(len(s.shards)))
+	return int(hi)
+}
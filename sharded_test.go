@@ -0,0 +1,90 @@
+package boom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// Ensures that a ShardedFilter can be used from many goroutines and spreads
+// data across its shards.
+func TestShardedConcurrent(t *testing.T) {
+	s := NewShardedBloomFilter(10000, 0.01, 8)
+	if shards := s.Shards(); shards != 8 {
+		t.Errorf("Expected 8, got %d", shards)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				data := []byte(strconv.Itoa(w*500 + i))
+				s.Add(data)
+				s.Test(data)
+				if !s.TestAndAdd(data) {
+					t.Errorf("`%s` should be a member", data)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i := 0; i < 2000; i++ {
+		if !s.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+			break
+		}
+	}
+	if count := s.Count(); count != 4000 {
+		t.Errorf("Expected 4000, got %d", count)
+	}
+
+	s.Do(func(shard uint, filter Filter) {
+		if count := filter.(*BloomFilter).Count(); count < 300 || count > 700 {
+			t.Errorf("Expected about 500 items in shard %d, got %d", shard, count)
+		}
+	})
+}
+
+// Ensures that AddMany adds to the shards, that Clear clears each, and that
+// the shard size is a cache line.
+func TestShardedAddManyClear(t *testing.T) {
+	s := NewShardedFilter(4, func() Filter {
+		return NewDefaultCountingBloomFilter(100, 0.01)
+	})
+	s.AddMany([][]byte{[]byte(`a`), []byte(`b`), []byte(`c`)})
+	for _, data := range []string{"a", "b", "c"} {
+		if !s.Test([]byte(data)) {
+			t.Errorf("`%s` should be a member", data)
+		}
+	}
+	if count := s.Count(); count != 3 {
+		t.Errorf("Expected 3, got %d", count)
+	}
+
+	s.Clear()
+	if s.Count() != 0 || s.Test([]byte(`a`)) {
+		t.Errorf("Expected empty filter, got %s", s)
+	}
+
+	if size := unsafe.Sizeof(filterShard{}); unsafe.Sizeof(uintptr(0)) == 8 && size != 64 {
+		t.Errorf("Expected 64, got %d", size)
+	}
+}
+
+func BenchmarkShardedAddParallel(b *testing.B) {
+	s := NewShardedBloomFilter(100000, 0.01, 16)
+	data := make([][]byte, 1000)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			s.Add(data[i%len(data)])
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Ensures that signed snapshots round-trip with the key they were signed with,
+// compressed or not.
+func TestSignedSnapshot(t *testing.T) {
+	key := []byte("edge-distribution-key")
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	for _, codec := range []Codec{nil, GzipCodec} {
+		var buf bytes.Buffer
+		n, err := WriteSignedSnapshot(&buf, f, key, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("Expected %d bytes written, got %d", buf.Len(), n)
+		}
+
+		loaded := &BloomFilter{}
+		if n, err := ReadSignedSnapshot(bytes.NewReader(buf.Bytes()), loaded, key); err != nil || n != int64(buf.Len()) {
+			t.Fatalf("Expected %d bytes read, got %d, %v", buf.Len(), n, err)
+		}
+		if loaded.Count() != 100 || !bytes.Equal(loaded.buckets.data, f.buckets.data) {
+			t.Errorf("Expected the loaded filter to match with codec %v", codec)
+		}
+	}
+}
+
+// Ensures that tampered, truncated, unsigned, and wrongly-keyed snapshots are
+// rejected.
+func TestSignedSnapshotRejected(t *testing.T) {
+	key := []byte("edge-distribution-key")
+	f := NewBloomFilter(1000, 0.01)
+	f.Add([]byte(`blocked.example.com`))
+
+	var buf bytes.Buffer
+	if _, err := WriteSignedSnapshot(&buf, f, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Flipping a bit of the filter is detected before it's decoded.
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)/2] ^= 0x01
+	forgedLength := append([]byte(nil), data...)
+	forgedLength[9] = 0x7f
+
+	var unsigned bytes.Buffer
+	if _, err := WriteSnapshot(&unsigned, f); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		data  []byte
+		key   []byte
+		error string
+	}{
+		{"tampered", tampered, key, ErrSignatureMismatch.Error()},
+		{"wrong key", data, []byte("other-key"), ErrSignatureMismatch.Error()},
+		{"truncated", data[:len(data)-1], key, "truncated"},
+		{"forged length", forgedLength, key, "truncated"},
+		{"unsigned", unsigned.Bytes(), key, "not a signed boom snapshot"},
+		{"empty", nil, key, "not a signed boom snapshot"},
+		{"empty key", data, nil, "signing key is empty"},
+	} {
+		loaded := &BloomFilter{}
+		_, err := ReadSignedSnapshot(bytes.NewReader(test.data), loaded, test.key)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: Expected error containing %q, got %v", test.name, test.error, err)
+		}
+		if loaded.buckets != nil {
+			t.Errorf("%s: Expected nothing to be decoded", test.name)
+		}
+	}
+
+	if _, err := WriteSignedSnapshot(&buf, f, nil, nil); err == nil {
+		t.Error("Expected an error signing with an empty key")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader(data), &BloomFilter{}); err != ErrNotSnapshot {
+		t.Errorf("Expected ReadSnapshot to reject signed snapshots, got %v", err)
+	}
+}
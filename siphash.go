@@ -0,0 +1,124 @@
+package boom
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// sipHash is a hash.Hash64 computing the keyed SipHash-2-4 of the data written
+// to it. Filters write each item in one call, so it buffers the data and
+// hashes it in Sum64 rather than streaming.
+type sipHash struct {
+	k0, k1 uint64 // key
+	buf    []byte // data written since the last Reset
+}
+
+// NewSipHash returns a hash.Hash64 computing the SipHash-2-4 of the data with
+// the 128-bit key, for use as a filter's hash kernel with SetHash. Without the
+// key, an adversary can't craft items whose hashes collide, so filters using
+// it resist being flooded with false positives by untrusted input. Filters
+// must use the same key to be merged or to read each other's serializations,
+// which don't include the key, so it must be kept secret and stable for as
+// long as the filter is.
+func NewSipHash(key [16]byte) hash.Hash64 {
+	return &sipHash{
+		k0: binary.LittleEndian.Uint64(key[:8]),
+		k1: binary.LittleEndian.Uint64(key[8:]),
+	}
+}
+
+// newRandomSipHash returns a SipHash keyed with a random key.
+func newRandomSipHash() hash.Hash64 {
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		panic(err)
+	}
+	return NewSipHash(key)
+}
+
+func (s *sipHash) Write(data []byte) (int, error) {
+	s.buf = append(s.buf, data...)
+	return len(data), nil
+}
+
+func (s *sipHash) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, s.Sum64())
+}
+
+func (s *sipHash) Sum64() uint64 {
+	return sipHash24(s.k0, s.k1, s.buf)
+}
+
+func (s *sipHash) Reset() {
+	s.buf = s.buf[:0]
+}
+
+func (s *sipHash) Size() int {
+	return 8
+}
+
+func (s *sipHash) BlockSize() int {
+	return 8
+}
+
+// Clone returns an independent copy of the hash with the same key, so that it
+// satisfies hash.Cloner.
+func (s *sipHash) Clone() (hash.Cloner, error) {
+	return &sipHash{k0: s.k0, k1: s.k1, buf: append([]byte(nil), s.buf...)}, nil
+}
+
+// sipHash24 returns the SipHash-2-4 of the data keyed with k0 and k1, the
+// first and second halves of the 128-bit key read as little-endian integers.
+// It's generic so that strings can be hashed without converting them to a
+// byte slice.
+func sipHash24[T string | []byte](k0, k1 uint64, data T) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+
+	n := len(data) / 8 * 8
+	for i := 0; i < n; i += 8 {
+		m := xxUint64(data, i)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+
+	// The final word holds the remaining bytes and the length.
+	last := uint64(len(data)) << 56
+	for i := n; i < len(data); i++ {
+		last |= uint64(data[i]) << (8 * uint(i-n))
+	}
+	v3 ^= last
+	round()
+	round()
+	v0 ^= last
+
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
@@ -0,0 +1,91 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that sipHash24 matches the reference test vectors, which use the
+// key 00 01 .. 0f and messages 00 01 .. (n-1).
+func TestSipHash24(t *testing.T) {
+	vectors := []uint64{
+		0x726fdb47dd0e0e31, 0x74f839c593dc67fd, 0x0d6c8009d9a94f5a, 0x85676696d7fb7e2d,
+		0xcf2794e0277187b7, 0x18765564cd99a68d, 0xcbc9466e58fee3ce, 0xab0200f58b01d137,
+		0x93f5f5799a932462, 0x9e0082df0ba9e4b0,
+	}
+
+	k0, k1 := uint64(0x0706050403020100), uint64(0x0f0e0d0c0b0a0908)
+	data := make([]byte, len(vectors))
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for i, expected := range vectors {
+		if sum := sipHash24(k0, k1, data[:i]); sum != expected {
+			t.Errorf("Expected %#016x for length %d, got %#016x", expected, i, sum)
+		}
+	}
+}
+
+// Ensures that NewSipHash hashes with its key, whether the data is bytes or a
+// string.
+func TestNewSipHash(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	h := NewSipHash(key)
+	h.Write([]byte{0, 1})
+	h.Write([]byte{2})
+	if sum := h.Sum64(); sum != 0x85676696d7fb7e2d {
+		t.Errorf("Expected %#016x, got %#016x", uint64(0x85676696d7fb7e2d), sum)
+	}
+	if sum := sipHash24(0x0706050403020100, 0x0f0e0d0c0b0a0908, "\x00\x01\x02"); sum != 0x85676696d7fb7e2d {
+		t.Errorf("Expected %#016x, got %#016x", uint64(0x85676696d7fb7e2d), sum)
+	}
+}
+
+// Ensures that keyed filters have distinct keys, so they can't be combined,
+// and support the hash-dependent features.
+func TestKeyedBloomFilter(t *testing.T) {
+	f := NewKeyedBloomFilter(1000, 0.01)
+	other := NewKeyedBloomFilter(1000, 0.01)
+	if sameHash(f.hash, other.hash) {
+		t.Error("Expected keyed filters to have distinct keys")
+	}
+	if err := f.Union(other); err == nil {
+		t.Error("Expected error combining filters with different keys")
+	}
+
+	for i := 0; i < 1000; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+	copied, err := f.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copied.Union(f); err != nil {
+		t.Errorf("Unexpected error combining copies: %v", err)
+	}
+	frozen := f.Freeze()
+	for i := 0; i < 1000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if !f.Test(data) || !copied.Test(data) || !frozen.Test(data) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.TestString("hello")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkSipHash24(b *testing.B) {
+	data := []byte(`the quick brown fox jumps over the lazy dog`)
+	for n := 0; n < b.N; n++ {
+		sipHash24(0, 0, data)
+	}
+}
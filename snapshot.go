@@ -0,0 +1,276 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"slices"
+)
+
+// snapshotMagic identifies a snapshot written by WriteSnapshot.
+var snapshotMagic = [8]byte{'B', 'O', 'O', 'M', 'S', 'N', 'A', 'P'}
+
+const (
+	// snapshotVersion is the version of the snapshot format written by
+	// WriteSnapshot.
+	snapshotVersion = 1
+
+	// snapshotCompressedVersion is the version of the snapshot format
+	// written by WriteCompressedSnapshot, which records the codec after the
+	// parameter block. Readers reject snapshots of later versions.
+	snapshotCompressedVersion = 2
+)
+
+// snapshotTable is the CRC-32 (Castagnoli) table used to checksum snapshots.
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrNotSnapshot is returned by ReadSnapshot when the data doesn't start with
+// the snapshot magic, such as when it was written by WriteTo directly.
+var ErrNotSnapshot = errors.New("not a boom snapshot")
+
+// WriteSnapshot writes the structure to the stream wrapped in a versioned
+// envelope, so that ReadSnapshot can reject corrupt or incompatible snapshots
+// with a clear error rather than decoding a silently wrong filter. It returns
+// the number of bytes written.
+//
+// The snapshot starts with the magic "BOOMSNAP" and the format version as a
+// byte. A parameter block follows with the length of the structure's type
+// name as a byte, the name, and the number of parameters as a byte followed
+// by each as a big-endian uint64: the capacity and number of hash functions,
+// for structures with Capacity and K methods. The length of the payload, the
+// structure's WriteTo output, follows as a big-endian uint64, then the
+// payload, and finally the CRC-32 (Castagnoli) of everything before it as a
+// big-endian uint32.
+func WriteSnapshot(stream io.Writer, structure io.WriterTo) (int64, error) {
+	return writeSnapshot(stream, structure, nil)
+}
+
+// WriteCompressedSnapshot is like WriteSnapshot, but compresses the payload
+// with the codec, which ReadSnapshot decompresses transparently if the codec
+// is registered. The snapshot's version is 2, and the codec's name follows
+// the parameter block, preceded by its length as a byte. The payload length
+// and checksum cover the compressed payload.
+func WriteCompressedSnapshot(stream io.Writer, structure io.WriterTo, codec Codec) (int64, error) {
+	if name := codec.Name(); name == "" || len(name) > 255 {
+		return 0, errors.New("codec name must be 1 to 255 bytes")
+	}
+	return writeSnapshot(stream, structure, codec)
+}
+
+// writeSnapshot writes a snapshot of the structure with the payload
+// compressed with the codec, if it isn't nil.
+func writeSnapshot(stream io.Writer, structure io.WriterTo, codec Codec) (int64, error) {
+	var payload bytes.Buffer
+	if codec == nil {
+		if _, err := structure.WriteTo(&payload); err != nil {
+			return 0, err
+		}
+	} else {
+		w, err := codec.NewWriter(&payload)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := structure.WriteTo(w); err != nil {
+			w.Close()
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		name   = snapshotTypeName(structure)
+		params = snapshotParams(structure)
+		buf    bytes.Buffer
+	)
+	buf.Write(snapshotMagic[:])
+	if codec == nil {
+		buf.WriteByte(snapshotVersion)
+	} else {
+		buf.WriteByte(snapshotCompressedVersion)
+	}
+	buf.WriteByte(byte(len(name)))
+	buf.WriteString(name)
+	buf.WriteByte(byte(len(params)))
+	for _, param := range params {
+		binary.Write(&buf, binary.BigEndian, param)
+	}
+	if codec != nil {
+		buf.WriteByte(byte(len(codec.Name())))
+		buf.WriteString(codec.Name())
+	}
+	binary.Write(&buf, binary.BigEndian, uint64(payload.Len()))
+	buf.Write(payload.Bytes())
+	binary.Write(&buf, binary.BigEndian, crc32.Checksum(buf.Bytes(), snapshotTable))
+
+	n, err := stream.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot or
+// WriteCompressedSnapshot from the stream into the structure, which must be of
+// the same type, such as an empty BloomFilter. It returns ErrNotSnapshot if
+// the stream doesn't hold a snapshot, and an error if the snapshot is of a
+// later version or a different type, is compressed with a codec which isn't
+// registered, its checksum doesn't match, or the decoded structure's
+// parameters differ from those recorded. It returns the number of bytes read.
+func ReadSnapshot(stream io.Reader, structure io.ReaderFrom) (int64, error) {
+	var (
+		r      = &countingReader{r: stream}
+		digest = crc32.New(snapshotTable)
+		tee    = io.TeeReader(r, digest)
+		header [9]byte
+	)
+	if _, err := io.ReadFull(tee, header[:9]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrNotSnapshot
+		}
+		return r.n, err
+	}
+	if !bytes.Equal(header[:8], snapshotMagic[:]) {
+		return r.n, ErrNotSnapshot
+	}
+	version := header[8]
+	if version > snapshotCompressedVersion {
+		return r.n, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	if _, err := io.ReadFull(tee, header[:1]); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+	name := make([]byte, header[0])
+	if _, err := io.ReadFull(tee, name); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+	if expected := snapshotTypeName(structure); string(name) != expected {
+		return r.n, fmt.Errorf("snapshot holds a %s, not a %s", name, expected)
+	}
+
+	if _, err := io.ReadFull(tee, header[:1]); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+	params := make([]uint64, header[0])
+	if err := binary.Read(tee, binary.BigEndian, params); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+
+	var codec Codec
+	if version >= snapshotCompressedVersion {
+		if _, err := io.ReadFull(tee, header[:1]); err != nil {
+			return r.n, snapshotTruncated(err)
+		}
+		name := make([]byte, header[0])
+		if _, err := io.ReadFull(tee, name); err != nil {
+			return r.n, snapshotTruncated(err)
+		}
+		var ok bool
+		if codec, ok = lookupCodec(string(name)); !ok {
+			return r.n, fmt.Errorf("snapshot is compressed with unregistered codec %q", name)
+		}
+	}
+
+	var length uint64
+	if err := binary.Read(tee, binary.BigEndian, &length); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+	// The payload is copied as it arrives rather than allocated up front, so
+	// a corrupt length can't exhaust memory.
+	var payload bytes.Buffer
+	if length > 1<<63-1 {
+		return r.n, errors.New("snapshot payload length overflows")
+	}
+	if _, err := io.CopyN(&payload, tee, int64(length)); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+
+	var checksum uint32
+	if err := binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return r.n, snapshotTruncated(err)
+	}
+	if checksum != digest.Sum32() {
+		return r.n, errors.New("snapshot checksum mismatch, data is corrupt")
+	}
+
+	if codec != nil {
+		if err := readCompressedPayload(&payload, structure, codec); err != nil {
+			return r.n, err
+		}
+	} else if n, err := structure.ReadFrom(&payload); err != nil {
+		return r.n, fmt.Errorf("snapshot payload: %v", err)
+	} else if n != int64(length) {
+		return r.n, errors.New("snapshot payload has trailing data")
+	}
+	if decoded := snapshotParams(structure); !slices.Equal(decoded, params) {
+		return r.n, fmt.Errorf("snapshot parameters %v don't match payload %v", params, decoded)
+	}
+	return r.n, nil
+}
+
+// readCompressedPayload decompresses the payload with the codec into the
+// structure, checking that it's all decoded.
+func readCompressedPayload(payload io.Reader, structure io.ReaderFrom, codec Codec) error {
+	decompressed, err := codec.NewReader(payload)
+	if err != nil {
+		return fmt.Errorf("snapshot payload: %v", err)
+	}
+	if _, err := structure.ReadFrom(decompressed); err != nil {
+		return fmt.Errorf("snapshot payload: %v", err)
+	}
+	var trailing [1]byte
+	switch _, err := io.ReadFull(decompressed, trailing[:]); err {
+	case io.EOF:
+		return nil
+	case nil:
+		return errors.New("snapshot payload has trailing data")
+	default:
+		return fmt.Errorf("snapshot payload: %v", err)
+	}
+}
+
+// snapshotTypeName returns the name of the structure's type, without the
+// pointer.
+func snapshotTypeName(structure any) string {
+	t := reflect.TypeOf(structure)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// snapshotParams returns the parameters recorded for the structure in a
+// snapshot's parameter block.
+func snapshotParams(structure any) []uint64 {
+	var params []uint64
+	if c, ok := structure.(interface{ Capacity() uint }); ok {
+		params = append(params, uint64(c.Capacity()))
+	}
+	if k, ok := structure.(interface{ K() uint }); ok {
+		params = append(params, uint64(k.K()))
+	}
+	return params
+}
+
+// snapshotTruncated returns the error for a snapshot which ended early.
+func snapshotTruncated(err error) error {
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("snapshot is truncated")
+	}
+	return err
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
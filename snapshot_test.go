@@ -0,0 +1,100 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Ensures that structures round-trip through snapshots and that the envelope
+// records the type and parameters.
+func TestSnapshotRoundTrip(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	n, err := WriteSnapshot(&buf, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), n)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("BOOMSNAP\x01\x0bBloomFilter\x02")) {
+		t.Errorf("Unexpected header %q", buf.Bytes()[:24])
+	}
+
+	other := &BloomFilter{}
+	read, err := ReadSnapshot(bytes.NewReader(buf.Bytes()), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != n {
+		t.Errorf("Expected %d bytes read, got %d", n, read)
+	}
+	if !other.Equal(f) {
+		t.Errorf("Expected %s, got %s", f, other)
+	}
+
+	hll, err := NewHyperLogLog(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hll.Add([]byte(`a`))
+	buf.Reset()
+	if _, err := WriteSnapshot(&buf, hll); err != nil {
+		t.Fatal(err)
+	}
+	otherHLL := &HyperLogLog{}
+	if _, err := ReadSnapshot(&buf, otherHLL); err != nil {
+		t.Fatal(err)
+	}
+	if otherHLL.Count() != 1 {
+		t.Errorf("Expected 1, got %d", otherHLL.Count())
+	}
+}
+
+// Ensures that corrupt, truncated, and incompatible snapshots are rejected
+// with a clear error.
+func TestSnapshotRejected(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	f.Add([]byte(`a`))
+	var buf bytes.Buffer
+	if _, err := WriteSnapshot(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0x01
+	newer := append([]byte(nil), data...)
+	newer[8] = snapshotCompressedVersion + 1
+
+	var raw bytes.Buffer
+	f.WriteTo(&raw)
+
+	for _, test := range []struct {
+		name  string
+		data  []byte
+		error string
+	}{
+		{"corrupt", corrupt, "checksum mismatch"},
+		{"truncated", data[:len(data)-10], "truncated"},
+		{"newer", newer, "unsupported snapshot version 3"},
+		{"raw", raw.Bytes(), ErrNotSnapshot.Error()},
+		{"empty", nil, ErrNotSnapshot.Error()},
+	} {
+		_, err := ReadSnapshot(bytes.NewReader(test.data), &BloomFilter{})
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%s: Expected error containing %q, got %v", test.name, test.error, err)
+		}
+	}
+
+	_, err := ReadSnapshot(bytes.NewReader(data), &CountingBloomFilter{})
+	if err == nil || err.Error() != "snapshot holds a BloomFilter, not a CountingBloomFilter" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
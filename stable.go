@@ -1,8 +1,12 @@
 package boom
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
-	"hash/fnv"
+	"io"
 	"math"
 	"math/rand"
 )
@@ -38,23 +42,22 @@ type StableBloomFilter struct {
 	k           uint        // number of hash functions
 	max         uint8       // cell max value
 	indexBuffer []uint      // buffer used to cache indices
+	rand        *rand.Rand  // source of evictions, the global one if nil
 }
 
 // NewStableBloomFilter creates a new Stable Bloom Filter with m cells and d
 // bits allocated per cell optimized for the target false-positive rate. Use
 // NewDefaultStableFilter if you don't want to calculate d.
 func NewStableBloomFilter(m uint, d uint8, fpRate float64) *StableBloomFilter {
-	k := OptimalK(fpRate) / 2
+	k := stableK(fpRate)
 	if k > m {
 		k = m
-	} else if k <= 0 {
-		k = 1
 	}
 
 	cells := NewBuckets(m, d)
 
 	return &StableBloomFilter{
-		hash:        fnv.New64(),
+		hash:        newDefaultHash(),
 		m:           m,
 		k:           k,
 		p:           optimalStableP(m, k, d, fpRate),
@@ -64,6 +67,21 @@ func NewStableBloomFilter(m uint, d uint8, fpRate float64) *StableBloomFilter {
 	}
 }
 
+// NewStableBloomFilterE is like NewStableBloomFilter but returns an error if m
+// is zero, d isn't between 1 and 32, or fpRate isn't between 0 and 1.
+func NewStableBloomFilterE(m uint, d uint8, fpRate float64) (*StableBloomFilter, error) {
+	if m == 0 {
+		return nil, errors.New("m must be positive")
+	}
+	if err := validateBucketSize("d", d); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	return NewStableBloomFilter(m, d, fpRate), nil
+}
+
 // NewDefaultStableBloomFilter creates a new Stable Bloom Filter with m 1-bit
 // cells and which is optimized for cases where there is no prior knowledge of
 // the input data stream while maintaining an upper bound using the provided
@@ -83,7 +101,7 @@ func NewUnstableBloomFilter(m uint, fpRate float64) *StableBloomFilter {
 	)
 
 	return &StableBloomFilter{
-		hash:        fnv.New64(),
+		hash:        newDefaultHash(),
 		m:           m,
 		k:           k,
 		p:           0,
@@ -127,15 +145,44 @@ func (s *StableBloomFilter) FalsePositiveRate() float64 {
 	return math.Pow(1-s.StablePoint(), float64(s.k))
 }
 
+// EstimateFPRate returns the current expected false-positive rate, derived
+// from the ratio of non-zero cells and the number of hash functions. Unlike
+// FalsePositiveRate, which is the rate once the filter is stable, it reflects
+// the filter's current contents.
+func (s *StableBloomFilter) EstimateFPRate() float64 {
+	return math.Pow(s.cells.nonZeroRatio(), float64(s.k))
+}
+
+// SetHash sets the hashing function used in the filter.
+func (s *StableBloomFilter) SetHash(h hash.Hash64) {
+	s.hash = h
+}
+
+// SetRand sets the source of randomness used to pick the cells evicted on
+// each add, which is the global source by default. Filters with sources seeded
+// alike, such as with rand.New(rand.NewSource(seed)), which are given the same
+// adds reach exactly the same state, so simulations and tests can be
+// reproduced. The source isn't safe for concurrent use, so it mustn't be
+// shared with filters used concurrently, and copies made with Copy use the
+// global source.
+func (s *StableBloomFilter) SetRand(r *rand.Rand) {
+	s.rand = r
+}
+
 // Test will test for membership of the data and returns true if it is a
 // member, false if not. This is a probabilistic test, meaning there is a
 // non-zero probability of false positives and false negatives.
 func (s *StableBloomFilter) Test(data []byte) bool {
-	lower, upper := hashKernel(data, s.hash)
+	return s.TestHash(hashKernel(data, s.hash))
+}
 
+// TestHash is equivalent to Test for data whose 64-bit hash, as computed by
+// the filter's hashing function, has the lower and upper 32 bits provided. It
+// avoids hashing data twice when the hash has already been computed.
+func (s *StableBloomFilter) TestHash(lower, upper uint32) bool {
 	// If any of the K cells are 0, then it's not a member.
 	for i := uint(0); i < s.k; i++ {
-		if s.cells.Get((uint(lower)+uint(upper)*i)%s.m) == 0 {
+		if s.cells.Get(DoubleHashing.index(lower, upper, i, s.m)) == 0 {
 			return false
 		}
 	}
@@ -146,14 +193,19 @@ func (s *StableBloomFilter) Test(data []byte) bool {
 // Add will add the data to the Stable Bloom Filter. It returns the filter to
 // allow for chaining.
 func (s *StableBloomFilter) Add(data []byte) Filter {
+	return s.AddHash(hashKernel(data, s.hash))
+}
+
+// AddHash is equivalent to Add for data whose 64-bit hash, as computed by the
+// filter's hashing function, has the lower and upper 32 bits provided. It
+// returns the filter to allow for chaining.
+func (s *StableBloomFilter) AddHash(lower, upper uint32) Filter {
 	// Randomly decrement p cells to make room for new elements.
 	s.decrement()
 
-	lower, upper := hashKernel(data, s.hash)
-
 	// Set the K cells to max.
 	for i := uint(0); i < s.k; i++ {
-		s.cells.Set((uint(lower)+uint(upper)*i)%s.m, s.max)
+		s.cells.Set(DoubleHashing.index(lower, upper, i, s.m), s.max)
 	}
 
 	return s
@@ -167,7 +219,7 @@ func (s *StableBloomFilter) TestAndAdd(data []byte) bool {
 
 	// If any of the K cells are 0, then it's not a member.
 	for i := uint(0); i < s.k; i++ {
-		s.indexBuffer[i] = (uint(lower) + uint(upper)*i) % s.m
+		s.indexBuffer[i] = DoubleHashing.index(lower, upper, i, s.m)
 		if s.cells.Get(s.indexBuffer[i]) == 0 {
 			member = false
 		}
@@ -184,6 +236,125 @@ func (s *StableBloomFilter) TestAndAdd(data []byte) bool {
 	return member
 }
 
+// AddMany will add each element of data to the filter. It's equivalent to
+// calling Add on each element. It returns the filter to allow for chaining.
+func (s *StableBloomFilter) AddMany(data [][]byte) Filter {
+	for _, element := range data {
+		s.AddHash(hashKernel(element, s.hash))
+	}
+	return s
+}
+
+// TestMany tests the membership of each element of data, returning a slice of
+// results in the same order. It's equivalent to calling Test on each element.
+func (s *StableBloomFilter) TestMany(data [][]byte) []bool {
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = s.TestHash(hashKernel(element, s.hash))
+	}
+	return results
+}
+
+// TestString is equivalent to Test for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash.
+func (s *StableBloomFilter) TestString(data string) bool {
+	return s.TestHash(hashKernelString(data, s.hash))
+}
+
+// AddString is equivalent to Add for the bytes of the string. It doesn't
+// allocate with the default hash or NewMapHash. It returns the filter to allow
+// for chaining.
+func (s *StableBloomFilter) AddString(data string) Filter {
+	return s.AddHash(hashKernelString(data, s.hash))
+}
+
+// TestAndAddString is equivalent to TestAndAdd for the bytes of the string. It
+// doesn't allocate with the default hash or NewMapHash.
+func (s *StableBloomFilter) TestAndAddString(data string) bool {
+	lower, upper := hashKernelString(data, s.hash)
+	member := s.TestHash(lower, upper)
+	s.AddHash(lower, upper)
+	return member
+}
+
+// WriteTo writes a binary representation of the StableBloomFilter to an i/o
+// stream. It returns the number of bytes written.
+func (s *StableBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	header := []uint64{uint64(s.m), uint64(s.p), uint64(s.k)}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	n, err := s.cells.WriteTo(stream)
+	return written + n, err
+}
+
+// ReadFrom reads a binary representation of a StableBloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (s *StableBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	cells := &Buckets{}
+	n, err := cells.ReadFrom(stream)
+	read += n
+	if err != nil {
+		return read, err
+	}
+	if uint64(cells.count) != header[0] || header[2] == 0 || header[2] > header[0] ||
+		header[1] > header[0] {
+		return read, errors.New("invalid stable bloom filter dimensions")
+	}
+
+	s.cells = cells
+	if s.hash == nil {
+		s.hash = newDefaultHash()
+	}
+	s.m = uint(header[0])
+	s.p = uint(header[1])
+	s.k = uint(header[2])
+	s.max = cells.MaxBucketValue()
+	s.indexBuffer = make([]uint, s.k)
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *StableBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *StableBloomFilter) GobDecode(data []byte) error {
+	_, err := s.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (s *StableBloomFilter) ByteSize() uint {
+	return s.cells.ByteSize()
+}
+
+// String returns a one-line summary of the StableBloomFilter for logging and
+// debugging.
+func (s *StableBloomFilter) String() string {
+	var d uint8
+	if s.cells != nil {
+		d = s.cells.bucketSize
+	}
+	return fmt.Sprintf("StableBloomFilter{m=%d k=%d d=%d p=%d fp=%.4g}",
+		s.m, s.k, d, s.p, s.FalsePositiveRate())
+}
+
 // Reset restores the Stable Bloom Filter to its original state. It returns the
 // filter to allow for chaining.
 func (s *StableBloomFilter) Reset() *StableBloomFilter {
@@ -191,18 +362,55 @@ func (s *StableBloomFilter) Reset() *StableBloomFilter {
 	return s
 }
 
+// Copy returns a deep copy of the StableBloomFilter. Returns
+// ErrHashNotCloneable if the filter's hash can't be cloned.
+func (s *StableBloomFilter) Copy() (*StableBloomFilter, error) {
+	hash, err := copyHash64(s.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *s
+	copied.cells = s.cells.Copy()
+	copied.hash = hash
+	copied.indexBuffer = make([]uint, len(s.indexBuffer))
+	copied.rand = nil
+	return &copied, nil
+}
+
+// Equal returns whether the other StableBloomFilter has the same parameters,
+// hashing function, and cells.
+func (s *StableBloomFilter) Equal(other *StableBloomFilter) bool {
+	return s.m == other.m && s.p == other.p && s.k == other.k && s.max == other.max &&
+		sameHash(s.hash, other.hash) && s.cells.Equal(other.cells)
+}
+
 // decrement will decrement a random cell and (p-1) adjacent cells by 1. This
 // is faster than generating p random numbers. Although the processes of
 // picking the p cells are not independent, each cell has a probability of p/m
 // for being picked at each iteration, which means the properties still hold.
 func (s *StableBloomFilter) decrement() {
-	r := rand.Intn(int(s.m))
+	var r int
+	if s.rand != nil {
+		r = s.rand.Intn(int(s.m))
+	} else {
+		r = rand.Intn(int(s.m))
+	}
 	for i := uint(0); i < s.p; i++ {
 		idx := (r + int(i)) % int(s.m)
 		s.cells.Increment(uint(idx), -1)
 	}
 }
 
+// stableK returns the number of hash functions used by a Stable Bloom Filter
+// for the provided rate of false positives.
+func stableK(fpRate float64) uint {
+	k := OptimalK(fpRate) / 2
+	if k <= 0 {
+		k = 1
+	}
+	return k
+}
+
 // optimalStableP returns the optimal number of cells to decrement, p, per
 // iteration for the provided parameters of an SBF.
 func optimalStableP(m, k uint, d uint8, fpRate float64) uint {
@@ -2,6 +2,7 @@ package boom
 
 import (
 	"math"
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -13,7 +14,7 @@ func TestNewUnstableBloomFilter(t *testing.T) {
 	k := OptimalK(0.1)
 
 	if f.k != k {
-		t.Errorf("Expected %f, got %d", k, f.k)
+		t.Errorf("Expected %d, got %d", k, f.k)
 	}
 
 	if f.m != 100 {
@@ -39,6 +40,29 @@ func TestCells(t *testing.T) {
 	}
 }
 
+// Ensures that NewStableBloomFilterE returns an error for invalid parameters.
+func TestNewStableBloomFilterE(t *testing.T) {
+	if f, err := NewStableBloomFilterE(100, 1, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a StableBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewStableBloomFilterE(0, 1, 0.01); err == nil {
+		t.Error("Expected error for m = 0")
+	}
+
+	if _, err := NewStableBloomFilterE(100, 0, 0.01); err == nil {
+		t.Error("Expected error for d = 0")
+	}
+
+	if _, err := NewStableBloomFilterE(100, 33, 0.01); err == nil {
+		t.Error("Expected error for d > 32")
+	}
+
+	if _, err := NewStableBloomFilterE(100, 1, 0); err == nil {
+		t.Error("Expected error for fpRate = 0")
+	}
+}
+
 // Ensures that K returns the number of hash functions in the Stable Bloom
 // Filter.
 func TestK(t *testing.T) {
@@ -105,7 +129,9 @@ func TestTestAndAdd(t *testing.T) {
 // Ensures that StablePoint returns the expected fraction of zeros for large
 // iterations.
 func TestStablePoint(t *testing.T) {
+	// Eviction is random, so use a fixed seed to make the run reproducible.
 	f := NewStableBloomFilter(1000, 1, 0.1)
+	f.SetRand(rand.New(rand.NewSource(1)))
 	for i := 0; i < 1000000; i++ {
 		f.Add([]byte(strconv.Itoa(i)))
 	}
@@ -132,6 +158,31 @@ func TestStablePoint(t *testing.T) {
 	}
 }
 
+// Ensures that filters with sources of randomness seeded alike reach the same
+// state, and differently seeded ones don't.
+func TestStableSetRand(t *testing.T) {
+	filters := make([]*StableBloomFilter, 3)
+	for i := range filters {
+		filters[i] = NewStableBloomFilter(1000, 2, 0.1)
+		filters[i].SetRand(rand.New(rand.NewSource(int64(i / 2))))
+	}
+	for i := 0; i < 10000; i++ {
+		for _, f := range filters {
+			f.Add([]byte(strconv.Itoa(i)))
+		}
+	}
+
+	if !filters[0].Equal(filters[1]) {
+		t.Error("Expected filters seeded alike to be equal")
+	}
+	if filters[0].Equal(filters[2]) {
+		t.Error("Expected filters seeded differently to differ")
+	}
+	if copied, err := filters[0].Copy(); err != nil || copied.rand != nil {
+		t.Error("Expected copy to use the global source")
+	}
+}
+
 // Ensures that FalsePositiveRate returns the upper bound on false positives
 // for stable filters.
 func TestFalsePositiveRate(t *testing.T) {
@@ -0,0 +1,356 @@
+package boom
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Stats is a snapshot of a structure's size and health, in the same terms for
+// every kind of structure, so that monitoring code can report on any of them
+// without a type switch.
+type Stats struct {
+	// M is the number of bits, cells, counters, or registers, and K the
+	// number of hash functions, or the depth of a Count-Min Sketch.
+	M uint
+	K uint
+
+	// Count is the number of items added, or zero if the structure doesn't
+	// count them.
+	Count uint
+
+	// SetCells is the number of set bits or non-zero cells, and FillRatio
+	// their ratio to M.
+	SetCells  uint
+	FillRatio float64
+
+	// EstimatedCardinality is the estimated number of distinct items in the
+	// structure, derived from SetCells. Unlike Count, it isn't inflated by
+	// duplicates.
+	EstimatedCardinality float64
+
+	// EstimatedFPRate is the current expected false-positive rate, or zero
+	// for structures which don't have false positives.
+	EstimatedFPRate float64
+}
+
+// StatsProvider is implemented by the structures which report Stats.
+type StatsProvider interface {
+	// Stats returns a snapshot of the structure's size and health.
+	Stats() Stats
+}
+
+// String returns a one-line summary of the Stats for logging and debugging.
+func (s Stats) String() string {
+	return fmt.Sprintf("Stats{m=%d k=%d count=%d set=%d fill=%.4f cardinality~%.0f fp~%.4g}",
+		s.M, s.K, s.Count, s.SetCells, s.FillRatio, s.EstimatedCardinality, s.EstimatedFPRate)
+}
+
+// bitStats returns the Stats of a Bloom filter of m bits with set of them set
+// and k hash functions on average.
+func bitStats(m, k, count, set uint, effectiveK float64) Stats {
+	stats := Stats{M: m, K: k, Count: count, SetCells: set}
+	if m == 0 {
+		return stats
+	}
+	stats.FillRatio = float64(set) / float64(m)
+	stats.EstimatedCardinality = estimatedCardinality(m, effectiveK, set)
+	stats.EstimatedFPRate = math.Pow(stats.FillRatio, effectiveK)
+	return stats
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (b *BloomFilter) Stats() Stats {
+	return bitStats(b.m, b.k, b.count, b.buckets.nonZero(), b.EffectiveK())
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (b *BlockedBloomFilter) Stats() Stats {
+	return bitStats(b.Capacity(), b.k, b.count, popCount(b.words), float64(b.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (c *ConcurrentBloomFilter) Stats() Stats {
+	return bitStats(c.m, c.k, c.Count(), popCount(c.words), float64(c.k))
+}
+
+// Stats returns a snapshot of the filter's size and health. SetCells is the
+// number of non-zero buckets.
+func (c *CountingBloomFilter) Stats() Stats {
+	return bitStats(c.m, c.k, c.count, c.buckets.nonZero(), float64(c.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (r *RetouchedBloomFilter) Stats() Stats {
+	return bitStats(r.m, r.k, r.count, r.buckets.nonZero(), float64(r.k))
+}
+
+// Stats returns a snapshot of the filter's size and health. Count is zero,
+// since items are evicted, and EstimatedCardinality estimates the number of
+// items which haven't been.
+func (s *StableBloomFilter) Stats() Stats {
+	return bitStats(s.m, s.k, 0, s.cells.nonZero(), float64(s.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (f *FrozenBloomFilter) Stats() Stats {
+	effectiveK := float64(f.k) + float64(f.extra)/(1<<32)
+	return bitStats(f.m, f.k, f.count, popCount(f.words), effectiveK)
+}
+
+// Stats returns a snapshot of the filter's size and health. Each item sets
+// one bit in each partition, so the cardinality is estimated from the average
+// partition, and the false-positive rate is the product of the partitions'
+// fill ratios.
+func (p *PartitionedBloomFilter) Stats() Stats {
+	set := uint(0)
+	for _, partition := range p.partitions {
+		set += partition.nonZero()
+	}
+	stats := Stats{M: p.m, K: p.k, Count: p.count, SetCells: set, EstimatedFPRate: p.EstimateFPRate()}
+	if p.m > 0 {
+		stats.FillRatio = float64(set) / float64(p.m)
+		stats.EstimatedCardinality = estimatedCardinality(p.s, 1, set/p.k)
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the filter's size and health, combining its
+// Bloom filters. FillRatio is their average fill ratio.
+func (s *ScalableBloomFilter) Stats() Stats {
+	stats := Stats{K: s.K(), FillRatio: s.FillRatio(), EstimatedFPRate: s.EstimateFPRate()}
+	for _, filter := range s.filters {
+		filterStats := filter.Stats()
+		stats.M += filterStats.M
+		stats.Count += filterStats.Count
+		stats.SetCells += filterStats.SetCells
+		stats.EstimatedCardinality += filterStats.EstimatedCardinality
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the filter's size and health. M is the
+// capacity, SetCells the number of occupied cells, and EstimatedFPRate zero,
+// since the filter has false negatives rather than false positives.
+func (i *InverseBloomFilter) Stats() Stats {
+	set := uint(0)
+	for j := range i.array {
+		if i.array[j].Load() != nil {
+			set++
+		}
+	}
+	stats := bitStats(i.capacity, 1, 0, set, 1)
+	stats.EstimatedFPRate = 0
+	return stats
+}
+
+// Stats returns a snapshot of the sketch's size and health. M is the number of
+// counters, K the depth, and SetCells the number of non-zero counters. The
+// false-positive rate is the probability that an item which wasn't added has
+// a non-zero count.
+func (c *CountMinSketch) Stats() Stats {
+	set := uint(0)
+	for _, row := range c.matrix {
+		for _, counter := range row {
+			if counter != 0 {
+				set++
+			}
+		}
+	}
+	stats := bitStats(c.width*c.depth, c.depth, uint(c.count), set, float64(c.depth))
+	if c.depth > 0 {
+		stats.EstimatedCardinality = estimatedCardinality(c.width, 1, set/c.depth)
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the sketch's size and health. M is the number of
+// registers, SetCells the number of non-zero registers, and
+// EstimatedCardinality the sketch's Count.
+func (h *HyperLogLog) Stats() Stats {
+	set := uint(0)
+	for j := uint(0); j < h.m; j++ {
+		if h.registers.get(j) != 0 {
+			set++
+		}
+	}
+	stats := Stats{M: h.m, K: 1, SetCells: set, EstimatedCardinality: float64(h.Count())}
+	if h.m > 0 {
+		stats.FillRatio = float64(set) / float64(h.m)
+	}
+	return stats
+}
+
+// Stats returns the Stats of the wrapped filter, or zero Stats if it doesn't
+// report them.
+func (s *SynchronizedFilter) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filterStats(s.filter)
+}
+
+// Stats returns the Stats of the wrapped filter, or zero Stats if it doesn't
+// report them.
+func (i *InstrumentedFilter) Stats() Stats {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return filterStats(i.filter)
+}
+
+// Stats returns the combined Stats of the shards which report them. Data is
+// routed to a single shard, so EstimatedFPRate is the shards' average.
+func (s *ShardedFilter) Stats() Stats {
+	var sum statsSum
+	s.each(sum.add)
+	return sum.result()
+}
+
+// Stats returns the combined Stats of the shards which report them. Data is
+// routed to a single shard, so EstimatedFPRate is the shards' average.
+func (c *ConsistentShardedFilter) Stats() Stats {
+	var sum statsSum
+	for _, shard := range c.shards {
+		sum.add(shard)
+	}
+	return sum.result()
+}
+
+// Stats returns the Stats of the folded filter. Count includes the items
+// added to shards which haven't been folded yet.
+func (a *AggregatingBloomFilter) Stats() Stats {
+	a.mu.RLock()
+	stats := a.main.Stats()
+	a.mu.RUnlock()
+	stats.Count = a.Count()
+	return stats
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (c *CassandraBloomFilter) Stats() Stats {
+	return bitStats(c.Capacity(), c.k, c.count, popCountBytes(c.data), float64(c.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (g *GuavaBloomFilter) Stats() Stats {
+	return bitStats(g.Capacity(), g.k, g.count, popCount(g.data), float64(g.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (r *RocksDBBloomFilter) Stats() Stats {
+	return bitStats(r.Capacity(), r.probes, r.count, popCountBytes(r.data), float64(r.probes))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (b *BIP37BloomFilter) Stats() Stats {
+	return bitStats(b.Capacity(), uint(b.k), b.count, popCountBytes(b.data), float64(b.k))
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (e *EthereumBloom) Stats() Stats {
+	return bitStats(EthereumBloomBytes*8, 3, e.count, popCountBytes(e.bits[:]), 3)
+}
+
+// Stats returns a snapshot of the filter's size and health.
+func (p *ParquetBloomFilter) Stats() Stats {
+	return bitStats(p.Capacity(), parquetBlockWords, p.count, popCount32(p.words), parquetBlockWords)
+}
+
+// Stats returns the Stats of the filter of key prefixes.
+func (p *PrefixBloomFilter) Stats() Stats {
+	return p.filter.Stats()
+}
+
+// Stats returns the Stats of the filter of elements.
+func (y *YesNoBloomFilter) Stats() Stats {
+	return y.yes.Stats()
+}
+
+// Stats returns the Stats of the filter currently being served.
+func (s *SwappableBloomFilter) Stats() Stats {
+	return s.Current().Stats()
+}
+
+// statsSum combines the Stats of the shards of a filter.
+type statsSum struct {
+	stats  Stats
+	shards uint
+}
+
+// add adds the filter's Stats to the sum, if it reports them.
+func (s *statsSum) add(filter Filter) {
+	provider, ok := filter.(StatsProvider)
+	if !ok {
+		return
+	}
+	stats := provider.Stats()
+	s.stats.M += stats.M
+	s.stats.K = stats.K
+	s.stats.Count += stats.Count
+	s.stats.SetCells += stats.SetCells
+	s.stats.EstimatedCardinality += stats.EstimatedCardinality
+	s.stats.EstimatedFPRate += stats.EstimatedFPRate
+	s.shards++
+}
+
+// result returns the combined Stats, with the average false-positive rate and
+// the fill ratio of the combined cells.
+func (s *statsSum) result() Stats {
+	stats := s.stats
+	if s.shards > 0 {
+		stats.EstimatedFPRate /= float64(s.shards)
+	}
+	if stats.M > 0 {
+		stats.FillRatio = float64(stats.SetCells) / float64(stats.M)
+	}
+	return stats
+}
+
+// filterStats returns the filter's Stats, or zero Stats if it doesn't report
+// them.
+func filterStats(filter Filter) Stats {
+	if provider, ok := filter.(StatsProvider); ok {
+		return provider.Stats()
+	}
+	return Stats{}
+}
+
+// nonZero returns the number of buckets with a non-zero value.
+func (b *Buckets) nonZero() uint {
+	if b.bucketSize == 1 {
+		return popCountBytes(b.data)
+	}
+	nonZero := uint(0)
+	for i := uint(0); i < b.count; i++ {
+		if b.Get(i) != 0 {
+			nonZero++
+		}
+	}
+	return nonZero
+}
+
+// popCount returns the number of set bits in the words.
+func popCount(words []uint64) uint {
+	set := 0
+	for _, word := range words {
+		set += bits.OnesCount64(word)
+	}
+	return uint(set)
+}
+
+// popCount32 returns the number of set bits in the words.
+func popCount32(words []uint32) uint {
+	set := 0
+	for _, word := range words {
+		set += bits.OnesCount32(word)
+	}
+	return uint(set)
+}
+
+// popCountBytes returns the number of set bits in the bytes.
+func popCountBytes(data []byte) uint {
+	set := 0
+	for _, x := range data {
+		set += bits.OnesCount8(x)
+	}
+	return uint(set)
+}
@@ -0,0 +1,126 @@
+package boom
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Stats reports consistent sizes and estimates for each kind of
+// filter.
+func TestStats(t *testing.T) {
+	sharded := NewConsistentShardedFilter(16)
+	sharded.AddShard("a", NewBloomFilter(500, 0.01))
+	sharded.AddShard("b", NewBloomFilter(500, 0.01))
+
+	filters := map[string]Filter{
+		"bloom":        NewBloomFilter(1000, 0.01),
+		"blocked":      NewBlockedBloomFilter(1000, 0.01),
+		"concurrent":   NewConcurrentBloomFilter(1000, 0.01),
+		"counting":     NewDefaultCountingBloomFilter(1000, 0.01),
+		"retouched":    NewRetouchedBloomFilter(1000, 0.01),
+		"partitioned":  NewPartitionedBloomFilter(1000, 0.01),
+		"scalable":     NewScalableBloomFilter(100, 0.01, 0.8),
+		"cassandra":    NewCassandraBloomFilter(1000, 0.01, CassandraLegacyFormat),
+		"guava":        NewGuavaBloomFilter(1000, 0.01),
+		"parquet":      NewParquetBloomFilter(1000, 0.01),
+		"rocksdb":      NewRocksDBBloomFilter(1000, 10),
+		"bip37":        NewBIP37BloomFilter(1000, 0.01, 0, BIP37UpdateNone),
+		"yesno":        NewYesNoBloomFilter(1000, 0.01, 100, 0.01),
+		"sharded":      NewShardedBloomFilter(1000, 0.01, 4),
+		"consistent":   sharded,
+		"synchronized": Synchronized(NewBloomFilter(1000, 0.01)),
+		"instrumented": Instrumented(NewBloomFilter(1000, 0.01), newFakeRegisterer()),
+	}
+	for name, filter := range filters {
+		for i := 0; i < 1000; i++ {
+			filter.Add([]byte(strconv.Itoa(i)))
+		}
+		stats := filter.(StatsProvider).Stats()
+		if stats.M == 0 || stats.K == 0 || stats.SetCells == 0 || stats.SetCells > stats.M {
+			t.Errorf("%s: unexpected sizes %s", name, stats)
+		}
+		if stats.Count != 1000 {
+			t.Errorf("%s: expected count 1000, got %s", name, stats)
+		}
+		if stats.FillRatio <= 0 || stats.FillRatio >= 1 {
+			t.Errorf("%s: expected fill ratio in (0, 1), got %s", name, stats)
+		}
+		if math.Abs(stats.EstimatedCardinality-1000) > 100 {
+			t.Errorf("%s: expected cardinality of about 1000, got %s", name, stats)
+		}
+		if stats.EstimatedFPRate <= 0 || stats.EstimatedFPRate > 0.05 {
+			t.Errorf("%s: expected false-positive rate of about 0.01, got %s", name, stats)
+		}
+	}
+}
+
+// Ensures that Stats reports on structures other than sized Bloom filters.
+func TestStatsOtherStructures(t *testing.T) {
+	stable := NewDefaultStableBloomFilter(10000, 0.01)
+	ethereum := NewEthereumBloom()
+	inverse := NewInverseBloomFilter(10000)
+	cms := NewCountMinSketch(0.001, 0.01)
+	hll, err := NewDefaultHyperLogLog(0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		data := []byte(strconv.Itoa(i))
+		stable.Add(data)
+		ethereum.Add(data)
+		inverse.Add(data)
+		cms.Add(data)
+		hll.Add(data)
+	}
+
+	if stats := stable.Stats(); stats.Count != 0 || stats.SetCells == 0 || stats.EstimatedFPRate == 0 {
+		t.Errorf("stable: unexpected %s", stats)
+	}
+	if stats := ethereum.Stats(); stats.M != 2048 || stats.K != 3 || stats.Count != 100 ||
+		math.Abs(stats.EstimatedCardinality-100) > 20 {
+		t.Errorf("ethereum: unexpected %s", stats)
+	}
+	if stats := inverse.Stats(); stats.M != 10000 || stats.SetCells == 0 || stats.EstimatedFPRate != 0 {
+		t.Errorf("inverse: unexpected %s", stats)
+	}
+	if stats := cms.Stats(); stats.M != cms.width*cms.depth || stats.K != cms.depth || stats.Count != 100 ||
+		math.Abs(stats.EstimatedCardinality-100) > 10 {
+		t.Errorf("count-min: unexpected %s", stats)
+	}
+	if stats := hll.Stats(); stats.SetCells == 0 || stats.EstimatedCardinality != float64(hll.Count()) {
+		t.Errorf("hyperloglog: unexpected %s", stats)
+	}
+
+	prefix := NewPrefixBloomFilter(100, 0.01, FixedPrefix(2))
+	prefix.Add([]byte("abc"))
+	prefix.Add([]byte("abd"))
+	if stats := prefix.Stats(); stats.Count != 2 || math.Round(stats.EstimatedCardinality) != 1 {
+		t.Errorf("prefix: unexpected %s", stats)
+	}
+
+	aggregating := NewAggregatingBloomFilter(1000, 0.01)
+	shard := aggregating.Shard()
+	shard.Add([]byte("a"))
+	aggregating.Fold()
+	shard.Add([]byte("b"))
+	if stats := aggregating.Stats(); stats.Count != 2 || stats.SetCells == 0 {
+		t.Errorf("aggregating: unexpected %s", stats)
+	}
+
+	bloom := NewBloomFilter(100, 0.01)
+	bloom.Add([]byte("a"))
+	swappable := NewSwappableBloomFilter(bloom.Freeze())
+	if stats, expected := swappable.Stats(), bloom.Stats(); stats != expected {
+		t.Errorf("swappable: expected %s, got %s", expected, stats)
+	}
+}
+
+// Ensures that Stats of an empty filter are zero apart from its sizes.
+func TestStatsEmpty(t *testing.T) {
+	stats := NewBloomFilter(100, 0.01).Stats()
+	if stats.M == 0 || stats.K == 0 || stats.SetCells != 0 || stats.FillRatio != 0 ||
+		stats.EstimatedCardinality != 0 || stats.EstimatedFPRate != 0 {
+		t.Errorf("Expected empty stats, got %s", stats)
+	}
+}
@@ -0,0 +1,96 @@
+package boom
+
+import (
+	"errors"
+	"math"
+)
+
+// Storage is a byte region backing Buckets. By default Buckets are held in
+// memory, but they can be backed by other storage, such as a memory-mapped file
+// with MmapStorage, so that multi-gigabyte filters live outside the Go heap and
+// survive restarts without being serialized and read back.
+type Storage interface {
+	// Bytes returns the region. It must remain valid, and its length must
+	// not change, until the storage is closed.
+	Bytes() []byte
+
+	// Sync flushes changes to the region to durable storage, if any.
+	Sync() error
+
+	// Close releases the region. Buckets backed by it must not be used
+	// afterward.
+	Close() error
+}
+
+// memoryStorage is a Storage held in memory.
+type memoryStorage []byte
+
+// NewMemoryStorage returns a Storage of the specified number of bytes held in
+// memory, the same as Buckets use by default.
+func NewMemoryStorage(size int) Storage {
+	return make(memoryStorage, size)
+}
+
+func (m memoryStorage) Bytes() []byte { return m }
+func (m memoryStorage) Sync() error   { return nil }
+func (m memoryStorage) Close() error  { return nil }
+
+// StorageSize returns the number of bytes of Storage needed for the specified
+// number of buckets of bucketSize bits.
+func StorageSize(count uint, bucketSize uint8) int {
+	return int((count*uint(bucketSize) + 7) / 8)
+}
+
+// NewBucketsWithStorage creates a new Buckets with the provided number of
+// buckets where each bucket is the specified number of bits, backed by the
+// storage rather than memory. The buckets start with the storage's contents,
+// so Buckets backed by a file keep their values across restarts. Returns an
+// error if the storage isn't StorageSize bytes. ReadFrom and decoding replace
+// the storage with memory.
+func NewBucketsWithStorage(count uint, bucketSize uint8, storage Storage) (*Buckets, error) {
+	data := storage.Bytes()
+	if len(data) != StorageSize(count, bucketSize) {
+		return nil, errors.New("storage size doesn't match buckets")
+	}
+	return &Buckets{
+		count:      count,
+		data:       data,
+		bucketSize: bucketSize,
+		max:        (1 << bucketSize) - 1,
+	}, nil
+}
+
+// NewBloomFilterWithStorage creates a new Bloom filter optimized to store n
+// items with a specified target false-positive rate whose bits are backed by
+// the storage, which must be StorageSize(OptimalM(n, fpRate), 1) bytes. If the
+// storage already holds a filter with the same parameters, such as a file
+// mapped by a previous run, the filter continues from it and its count is
+// estimated from the bits set. Returns an error if the parameters are invalid
+// or the storage is the wrong size.
+func NewBloomFilterWithStorage(n uint, fpRate float64, storage Storage) (*BloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+
+	// The buckets are built directly on the storage, so the bits are never
+	// allocated on the heap.
+	m := OptimalM(n, fpRate)
+	buckets, err := NewBucketsWithStorage(m, 1, storage)
+	if err != nil {
+		return nil, err
+	}
+	b := &BloomFilter{
+		buckets: buckets,
+		hash:    newDefaultHash(),
+		m:       m,
+		k:       OptimalK(fpRate),
+	}
+	b.count = uint(math.Round(b.EstimatedCardinality()))
+	return b, nil
+}
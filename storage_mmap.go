@@ -0,0 +1,71 @@
+//go:build unix && !tinygo
+
+package boom
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileStorage is a Storage backed by a memory-mapped file.
+type fileStorage struct {
+	file *os.File // mapped file
+	data []byte   // mapping
+}
+
+// MmapStorage returns a Storage of the specified number of bytes backed by the
+// file at path, which is mapped into memory so that changes are written to the
+// file by the operating system. The file is created if it doesn't exist and
+// extended with zeros if it's empty. Returns an error if it already has a
+// different size, since it would hold a filter with other parameters.
+func MmapStorage(path string, size int) (Storage, error) {
+	if size <= 0 {
+		return nil, errors.New("storage size must be positive")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	switch {
+	case info.Size() == 0:
+		if err := f.Truncate(int64(size)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	case info.Size() != int64(size):
+		f.Close()
+		return nil, errors.New("storage file " + info.Name() + " has a different size")
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileStorage{file: f, data: data}, nil
+}
+
+func (f *fileStorage) Bytes() []byte { return f.data }
+
+// Sync flushes the mapping to the file.
+func (f *fileStorage) Sync() error {
+	return f.file.Sync()
+}
+
+// Close unmaps and closes the file. Changes are written to the file by the
+// operating system even if it isn't synced first, but only Sync ensures
+// they're durable.
+func (f *fileStorage) Close() error {
+	err := syscall.Munmap(f.data)
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
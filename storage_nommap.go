@@ -0,0 +1,69 @@
+//go:build !unix || tinygo
+
+package boom
+
+import (
+	"errors"
+	"os"
+)
+
+// fileStorage is a Storage backed by a file which is read into memory and
+// written back when synced.
+type fileStorage struct {
+	file *os.File // backing file
+	data []byte   // file contents
+}
+
+// MmapStorage returns a Storage of the specified number of bytes backed by the
+// file at path. Memory mapping isn't supported on this platform, so the file
+// is read into memory and written back by Sync and Close instead. The file is
+// created if it doesn't exist and extended with zeros if it's empty. Returns
+// an error if it already has a different size, since it would hold a filter
+// with other parameters.
+func MmapStorage(path string, size int) (Storage, error) {
+	if size <= 0 {
+		return nil, errors.New("storage size must be positive")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	data := make([]byte, size)
+	switch {
+	case info.Size() == 0:
+	case info.Size() != int64(size):
+		f.Close()
+		return nil, errors.New("storage file " + info.Name() + " has a different size")
+	default:
+		if _, err := f.ReadAt(data, 0); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &fileStorage{file: f, data: data}, nil
+}
+
+func (f *fileStorage) Bytes() []byte { return f.data }
+
+// Sync writes the contents to the file.
+func (f *fileStorage) Sync() error {
+	if _, err := f.file.WriteAt(f.data, 0); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Close syncs and closes the file.
+func (f *fileStorage) Close() error {
+	err := f.Sync()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
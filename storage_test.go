@@ -0,0 +1,118 @@
+package boom
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Buckets can be backed by memory storage of the right size.
+func TestNewBucketsWithStorage(t *testing.T) {
+	storage := NewMemoryStorage(StorageSize(100, 4))
+	b, err := NewBucketsWithStorage(100, 4, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Set(10, 9)
+	if storage.Bytes()[5] == 0 {
+		t.Error("Expected the value to be stored in the storage")
+	}
+	if v := b.Get(10); v != 9 {
+		t.Errorf("Expected 9, got %d", v)
+	}
+
+	if _, err := NewBucketsWithStorage(101, 4, storage); err == nil {
+		t.Error("Expected error for mismatched storage size")
+	}
+}
+
+// Ensures that a Bloom filter backed by a file keeps its contents across
+// restarts.
+func TestBloomFilterMmapStorage(t *testing.T) {
+	var (
+		path = filepath.Join(t.TempDir(), "filter.bloom")
+		size = StorageSize(OptimalM(1000, 0.01), 1)
+	)
+	storage, err := MmapStorage(path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewBloomFilterWithStorage(1000, 0.01, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	if err := storage.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err = MmapStorage(path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	f, err = NewBloomFilterWithStorage(1000, 0.01, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+	if count := f.Count(); count < 475 || count > 525 {
+		t.Errorf("Expected about 500, got %d", count)
+	}
+
+	if _, err := MmapStorage(path, size+1); err == nil {
+		t.Error("Expected error for mismatched file size")
+	}
+	if _, err := NewBloomFilterWithStorage(100, 0.01, storage); err == nil {
+		t.Error("Expected error for mismatched storage size")
+	}
+}
+
+// Ensures that a Bloom filter backed by storage doesn't allocate its bits on
+// the heap.
+func TestBloomFilterWithStorageAllocation(t *testing.T) {
+	size := StorageSize(OptimalM(10000000, 0.01), 1)
+	storage := NewMemoryStorage(size)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := NewBloomFilterWithStorage(10000000, 0.01, storage); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated >= uint64(size) {
+		t.Errorf("Expected fewer than %d bytes allocated, got %d", size, allocated)
+	}
+}
+
+func BenchmarkBloomAddMmapStorage(b *testing.B) {
+	b.StopTimer()
+	storage, err := MmapStorage(filepath.Join(b.TempDir(), "filter.bloom"), StorageSize(OptimalM(100000, 0.1), 1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer storage.Close()
+	f, err := NewBloomFilterWithStorage(100000, 0.1, storage)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
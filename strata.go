@@ -0,0 +1,206 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math/bits"
+)
+
+const (
+	// defaultStrata is the number of strata, which bounds the size of the
+	// difference the StrataEstimator can estimate to 2^defaultStrata.
+	defaultStrata = 32
+
+	// defaultStratumCells is the number of cells in each stratum IBLT.
+	defaultStratumCells = 80
+)
+
+// StrataEstimator estimates the size of the symmetric difference between two
+// sets as described by Eppstein, Goodrich, Uyeda, and Varghese in What's the
+// Difference? Efficient Set Reconciliation without Prior Context:
+//
+// http://www.ics.uci.edu/~eppstein/pubs/EppGooUye-SIGCOMM-11.pdf
+//
+// Elements are assigned to strata by the number of trailing zeros in their
+// hash, so stratum i samples roughly 1/2^(i+1) of the set. Each stratum is a
+// small IBLT. To estimate the difference, the strata of one estimator are
+// subtracted from another and decoded from the sparsest stratum down. Once a
+// stratum fails to decode, the number of elements decoded so far is scaled up
+// by the sampling rate.
+//
+// Estimators are useful for sizing the IBLT used to reconcile two sets, which
+// must be large enough to hold the difference but should be no larger.
+type StrataEstimator struct {
+	strata []*IBLT     // IBLT for each stratum
+	hash   hash.Hash64 // hash function used to assign strata
+}
+
+// NewStrataEstimator creates a new StrataEstimator with the default number of
+// strata, each with a fixed-size IBLT.
+func NewStrataEstimator() *StrataEstimator {
+	strata := make([]*IBLT, defaultStrata)
+	for i := range strata {
+		strata[i] = NewIBLT(defaultStratumCells, 4)
+	}
+
+	return &StrataEstimator{
+		strata: strata,
+		hash:   fnv.New64a(),
+	}
+}
+
+// Add will add the data to the estimator. Returns the estimator to allow for
+// chaining.
+func (s *StrataEstimator) Add(data []byte) *StrataEstimator {
+	s.strata[s.stratum(data)].Add(data)
+	return s
+}
+
+// Remove will remove the data from the estimator. Returns the estimator to
+// allow for chaining.
+func (s *StrataEstimator) Remove(data []byte) *StrataEstimator {
+	s.strata[s.stratum(data)].Remove(data)
+	return s
+}
+
+// Estimate returns the approximate size of the symmetric difference between
+// the set summarized by this estimator and the set summarized by the other.
+// Returns an error if the number of strata or their sizes are not equal.
+// Neither estimator is modified.
+func (s *StrataEstimator) Estimate(other *StrataEstimator) (uint64, error) {
+	if len(s.strata) != len(other.strata) {
+		return 0, errors.New("number of strata must match")
+	}
+
+	count := uint64(0)
+	for i := len(s.strata) - 1; i >= 0; i-- {
+		diff := s.strata[i].copy()
+		if err := diff.Subtract(other.strata[i]); err != nil {
+			return 0, err
+		}
+
+		added, removed, err := diff.Decode()
+		if err != nil {
+			// This stratum samples 1/2^(i+1) of the elements, so scale up
+			// everything decoded in the sparser strata.
+			return count << uint(i+1), nil
+		}
+		count += uint64(len(added) + len(removed))
+	}
+
+	return count, nil
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// estimator's data, the sum of its IBLTs.
+func (s *StrataEstimator) ByteSize() uint {
+	size := uint(0)
+	for _, stratum := range s.strata {
+		size += stratum.ByteSize()
+	}
+	return size
+}
+
+// String returns a one-line summary of the StrataEstimator for logging and
+// debugging.
+func (s *StrataEstimator) String() string {
+	return fmt.Sprintf("StrataEstimator{strata=%d}", len(s.strata))
+}
+
+// Reset restores the estimator to its original state. It returns itself to
+// allow for chaining.
+func (s *StrataEstimator) Reset() *StrataEstimator {
+	for _, stratum := range s.strata {
+		stratum.Reset()
+	}
+	return s
+}
+
+// WriteTo writes a binary representation of the StrataEstimator to an i/o
+// stream. It returns the number of bytes written.
+func (s *StrataEstimator) WriteTo(stream io.Writer) (int64, error) {
+	if err := binary.Write(stream, binary.BigEndian, uint64(len(s.strata))); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(uint64(0)))
+
+	for _, stratum := range s.strata {
+		n, err := stratum.WriteTo(stream)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a StrataEstimator (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (s *StrataEstimator) ReadFrom(stream io.Reader) (int64, error) {
+	var count uint64
+	if err := binary.Read(stream, binary.BigEndian, &count); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(count))
+
+	if count == 0 || count > 64 {
+		return read, errors.New("invalid number of strata")
+	}
+
+	strata := make([]*IBLT, count)
+	for i := range strata {
+		strata[i] = &IBLT{}
+		n, err := strata[i].ReadFrom(stream)
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+
+	if s.hash == nil {
+		s.hash = fnv.New64a()
+	}
+	s.strata = strata
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (s *StrataEstimator) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (s *StrataEstimator) GobDecode(data []byte) error {
+	_, err := s.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// stratum returns the index of the stratum the data belongs to.
+func (s *StrataEstimator) stratum(data []byte) int {
+	s.hash.Write(data)
+	sum := s.hash.Sum64()
+	s.hash.Reset()
+
+	// Mix the bits so strata are independent of the IBLT cell checksums,
+	// which use the same hash function.
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+
+	i := bits.TrailingZeros64(sum)
+	if i >= len(s.strata) {
+		i = len(s.strata) - 1
+	}
+	return i
+}
@@ -0,0 +1,85 @@
+package boom
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// Ensures that Estimate returns the exact difference for small differences
+// and a reasonable approximation for large ones.
+func TestStrataEstimate(t *testing.T) {
+	var (
+		a = NewStrataEstimator()
+		b = NewStrataEstimator()
+	)
+	for i := 0; i < 1000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i)))
+	}
+	a.Add([]byte(`x`)).Add([]byte(`y`))
+	b.Add([]byte(`z`))
+
+	estimate, err := a.Estimate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate != 3 {
+		t.Errorf("Expected 3, got %d", estimate)
+	}
+
+	for i := 1000; i < 11000; i++ {
+		a.Add([]byte(strconv.Itoa(i)))
+	}
+
+	estimate, err = a.Estimate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate < 5000 || estimate > 20000 {
+		t.Errorf("Expected approximately 10003, got %d", estimate)
+	}
+}
+
+// Ensures that Remove cancels out a previous Add.
+func TestStrataRemove(t *testing.T) {
+	var (
+		a = NewStrataEstimator()
+		b = NewStrataEstimator()
+	)
+	a.Add([]byte(`a`)).Add([]byte(`b`))
+	if a.Remove([]byte(`b`)) != a {
+		t.Error("Returned StrataEstimator should be the same instance")
+	}
+	b.Add([]byte(`a`))
+
+	if estimate, _ := a.Estimate(b); estimate != 0 {
+		t.Errorf("Expected 0, got %d", estimate)
+	}
+}
+
+// Ensures that a StrataEstimator can be written to and read from a stream.
+func TestStrataWriteToReadFrom(t *testing.T) {
+	s := NewStrataEstimator()
+	for i := 0; i < 100; i++ {
+		s.Add([]byte(strconv.Itoa(i)))
+	}
+
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored StrataEstimator
+	if _, err := restored.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if estimate, _ := restored.Estimate(s); estimate != 0 {
+		t.Errorf("Expected 0, got %d", estimate)
+	}
+
+	if estimate, _ := restored.Estimate(NewStrataEstimator()); estimate < 50 {
+		t.Errorf("Expected approximately 100, got %d", estimate)
+	}
+}
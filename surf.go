@@ -0,0 +1,496 @@
+package boom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+)
+
+// maxRealSuffixBytes is the maximum number of key bytes stored past the
+// distinguishing prefix of each key.
+const maxRealSuffixBytes = 15
+
+// SuccinctRangeFilter implements a Succinct Range Filter as described by
+// Zhang, Lim, Leis, Andersen, Kaminsky, Keeton, and Pavlo in SuRF: Practical
+// Range Query Filtering with Fast Succinct Tries:
+//
+// http://www.pdl.cmu.edu/PDL-FTP/Storage/surf_sigmod18.pdf
+//
+// A Succinct Range Filter is a static filter built from a set of keys. It
+// stores a trie of the shortest prefix which distinguishes each key from the
+// others, encoded level by level using the LOUDS-Sparse representation: one
+// byte per edge label plus two bits indicating whether the edge leads to a
+// child node and whether it starts a new node. Optionally, a few hash bits
+// and real key bytes are kept for each key to reduce false positives.
+//
+// Because the trie preserves key order, a Succinct Range Filter can answer
+// approximate range-emptiness queries ("is there any key between a and b?")
+// in addition to point lookups. Like a Bloom filter, it has a non-zero
+// probability of false positives and a zero probability of false negatives.
+// This makes it useful for pruning range scans in LSM trees and other sorted
+// storage, where Bloom filters can only help point lookups.
+type SuccinctRangeFilter struct {
+	labels      []byte      // edge labels in level order
+	hasChild    *rankSelect // whether each label leads to a child node
+	louds       *rankSelect // whether each label starts a new node
+	prefixKey   *rankSelect // whether each node is also the end of a key
+	hashes      *Buckets    // hash suffix of each key
+	hashBits    uint8       // number of hash suffix bits per key
+	real        []byte      // real suffix bytes of each leaf
+	realLens    *Buckets    // number of real suffix bytes of each leaf
+	realBytes   uint8       // maximum number of real suffix bytes per leaf
+	hash        hash.Hash32 // hash function used for hash suffixes
+	count       uint        // number of keys
+	prefixCount uint        // number of keys which end at an internal node
+}
+
+// surfNode is a node of the pointer-based trie used to build the filter.
+type surfNode struct {
+	labels    []byte
+	children  []*surfNode
+	leaves    []surfLeaf
+	prefixKey bool
+	prefixSum uint32
+}
+
+// surfLeaf holds the suffix of a key which ends at a leaf.
+type surfLeaf struct {
+	hash uint32
+	real []byte
+}
+
+// NewSuccinctRangeFilter creates a new Succinct Range Filter from the provided
+// keys, which don't need to be sorted or unique. hashBits (up to 8) hash bits
+// are stored for each key to reduce false positives for point lookups, and up
+// to realBytes (at most 15) key bytes past each distinguishing prefix are
+// stored to reduce false positives for both point lookups and range queries.
+func NewSuccinctRangeFilter(keys [][]byte, hashBits, realBytes uint8) (*SuccinctRangeFilter, error) {
+	if hashBits > 8 {
+		return nil, errors.New("hashBits must be at most 8")
+	}
+	if realBytes > maxRealSuffixBytes {
+		return nil, errors.New("realBytes must be at most 15")
+	}
+
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	unique := sorted[:0]
+	for i, key := range sorted {
+		if i == 0 || !bytes.Equal(key, sorted[i-1]) {
+			unique = append(unique, key)
+		}
+	}
+
+	s := &SuccinctRangeFilter{
+		hashBits:  hashBits,
+		realBytes: realBytes,
+		hash:      fnv.New32a(),
+		count:     uint(len(unique)),
+	}
+
+	root := &surfNode{}
+	for i, key := range unique {
+		// Keep only as much of the key as is needed to distinguish it from
+		// its neighbors.
+		length := 0
+		if i > 0 {
+			length = commonPrefix(key, unique[i-1])
+		}
+		if i < len(unique)-1 {
+			if l := commonPrefix(key, unique[i+1]); l > length {
+				length = l
+			}
+		}
+		if length == len(key) && i < len(unique)-1 {
+			// The key is a prefix of the next key, so it ends at an internal
+			// node rather than a leaf.
+			s.insertPrefixKey(root, key)
+			continue
+		}
+		if length < len(key) {
+			length++
+		}
+		s.insert(root, key, length)
+	}
+
+	s.encode(root)
+	return s, nil
+}
+
+// Count returns the number of keys in the filter.
+func (s *SuccinctRangeFilter) Count() uint {
+	return s.count
+}
+
+// Test will test for membership of the key and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives but a zero probability of false
+// negatives.
+func (s *SuccinctRangeFilter) Test(key []byte) bool {
+	if len(s.labels) == 0 {
+		// The only key which can be stored without any labels is empty.
+		return s.count > 0 && len(key) == 0
+	}
+
+	node := uint(0)
+	for depth := 0; ; depth++ {
+		if depth == len(key) {
+			if s.prefixKey.get(node) == 0 {
+				return false
+			}
+			idx := s.prefixKey.rank(node) - 1 + s.leafCount()
+			return s.hashMatches(idx, key)
+		}
+
+		pos, ok := s.find(node, key[depth])
+		if !ok {
+			return false
+		}
+
+		if s.hasChild.get(pos) == 1 {
+			node = s.hasChild.rank(pos)
+			continue
+		}
+
+		leaf := pos - s.hasChild.rank(pos)
+		if !s.hashMatches(leaf, key) {
+			return false
+		}
+		real := s.realSuffix(leaf)
+		rest := key[depth+1:]
+		if len(rest) > len(real) {
+			rest = rest[:len(real)]
+		}
+		return bytes.Equal(real, rest) &&
+			(len(real) == int(s.realBytes) || len(key[depth+1:]) == len(real))
+	}
+}
+
+// TestRange will test whether any key in the range [lo, hi] is a member,
+// returning true if there may be one and false if there definitely isn't.
+// This is a probabilistic test, meaning there is a non-zero probability of
+// false positives but a zero probability of false negatives.
+func (s *SuccinctRangeFilter) TestRange(lo, hi []byte) bool {
+	if bytes.Compare(lo, hi) > 0 {
+		return false
+	}
+	if len(s.labels) == 0 {
+		return s.count > 0 && len(lo) == 0
+	}
+
+	candidate, ok := s.lowerBound(0, nil, lo, true)
+	if !ok {
+		return false
+	}
+
+	// The candidate is the smallest key which could be stored at or after
+	// lo, so the range is empty if it sorts after hi.
+	return bytes.Compare(candidate, hi) <= 0
+}
+
+// lowerBound returns the smallest key in the subtree of the node, whose path
+// from the root is prefix, which may be greater than or equal to lo. If tight
+// is true, prefix is equal to lo[:len(prefix)]. Otherwise, it is already
+// greater than lo.
+func (s *SuccinctRangeFilter) lowerBound(node uint, prefix, lo []byte, tight bool) ([]byte, bool) {
+	depth := len(prefix)
+
+	if s.prefixKey.get(node) == 1 && (!tight || depth == len(lo)) {
+		return prefix, true
+	}
+
+	start, end := s.nodeRange(node)
+	for pos := start; pos < end; pos++ {
+		label := s.labels[pos]
+		childTight := tight
+		if tight {
+			if depth < len(lo) && label < lo[depth] {
+				continue
+			}
+			childTight = depth < len(lo) && label == lo[depth]
+		}
+
+		path := append(append([]byte(nil), prefix...), label)
+		if s.hasChild.get(pos) == 1 {
+			if key, ok := s.lowerBound(s.hasChild.rank(pos), path, lo, childTight); ok {
+				return key, true
+			}
+			continue
+		}
+
+		key := append(path, s.realSuffix(pos-s.hasChild.rank(pos))...)
+		if childTight && !s.mayBeAtLeast(key, len(path), lo) {
+			continue
+		}
+		return key, true
+	}
+
+	return nil, false
+}
+
+// mayBeAtLeast indicates if a key stored at a leaf, of which only key is
+// known and the first length bytes match lo, may be greater than or equal to
+// lo.
+func (s *SuccinctRangeFilter) mayBeAtLeast(key []byte, length int, lo []byte) bool {
+	n := len(key)
+	if n > len(lo) {
+		n = len(lo)
+	}
+	if cmp := bytes.Compare(key[length:n], lo[length:n]); cmp != 0 {
+		return cmp > 0
+	}
+	if len(key) >= len(lo) {
+		return true
+	}
+
+	// The key is a prefix of lo. It may still be greater if the rest of it
+	// was truncated.
+	return len(key)-length == int(s.realBytes)
+}
+
+// insert adds the first length bytes of the key to the trie, ending at a leaf
+// which holds its suffix.
+func (s *SuccinctRangeFilter) insert(root *surfNode, key []byte, length int) {
+	if length == 0 {
+		// Only the empty key has nothing to distinguish it.
+		s.insertPrefixKey(root, key)
+		return
+	}
+
+	node, idx := s.path(root, key[:length])
+	real := key[length:]
+	if len(real) > int(s.realBytes) {
+		real = real[:s.realBytes]
+	}
+	node.leaves[idx] = surfLeaf{hash: s.hashOf(key), real: real}
+}
+
+// insertPrefixKey adds the key to the trie, ending at an internal node.
+func (s *SuccinctRangeFilter) insertPrefixKey(root *surfNode, key []byte) {
+	node := root
+	if len(key) > 0 {
+		parent, idx := s.path(root, key)
+		if parent.children[idx] == nil {
+			parent.children[idx] = &surfNode{}
+		}
+		node = parent.children[idx]
+	}
+
+	node.prefixKey = true
+	node.prefixSum = s.hashOf(key)
+	s.prefixCount++
+}
+
+// path creates the nodes along the path of the prefix and returns the last
+// node and the index of the prefix's final label within it.
+func (s *SuccinctRangeFilter) path(root *surfNode, prefix []byte) (*surfNode, int) {
+	node := root
+	for depth, label := range prefix {
+		idx := len(node.labels) - 1
+		if idx < 0 || node.labels[idx] != label {
+			// Keys are inserted in order, so a new label always goes last.
+			node.labels = append(node.labels, label)
+			node.children = append(node.children, nil)
+			node.leaves = append(node.leaves, surfLeaf{})
+			idx++
+		}
+
+		if depth == len(prefix)-1 {
+			return node, idx
+		}
+
+		if node.children[idx] == nil {
+			node.children[idx] = &surfNode{}
+		}
+		node = node.children[idx]
+	}
+	return node, -1
+}
+
+// encode converts the pointer-based trie into the succinct representation.
+func (s *SuccinctRangeFilter) encode(root *surfNode) {
+	var (
+		hasChild, louds, prefixKey []bool
+		leaves                     []surfLeaf
+		prefixSums                 []uint32
+		queue                      = []*surfNode{root}
+	)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		prefixKey = append(prefixKey, node.prefixKey)
+		if node.prefixKey {
+			prefixSums = append(prefixSums, node.prefixSum)
+		}
+
+		for i, label := range node.labels {
+			s.labels = append(s.labels, label)
+			louds = append(louds, i == 0)
+			if child := node.children[i]; child != nil {
+				hasChild = append(hasChild, true)
+				queue = append(queue, child)
+			} else {
+				hasChild = append(hasChild, false)
+				leaves = append(leaves, node.leaves[i])
+			}
+		}
+	}
+
+	s.hasChild = newRankSelect(hasChild)
+	s.louds = newRankSelect(louds)
+	s.prefixKey = newRankSelect(prefixKey)
+
+	// Hash suffixes are stored for leaves followed by prefix keys.
+	s.hashes = NewBuckets(uint(len(leaves)+len(prefixSums)), s.hashBits)
+	s.realLens = NewBuckets(uint(len(leaves)), 4)
+	s.real = make([]byte, len(leaves)*int(s.realBytes))
+	for i, leaf := range leaves {
+		s.realLens.Set(uint(i), uint8(len(leaf.real)))
+		copy(s.real[i*int(s.realBytes):], leaf.real)
+	}
+	if s.hashBits > 0 {
+		mask := uint32(s.hashes.MaxBucketValue())
+		for i, leaf := range leaves {
+			s.hashes.Set(uint(i), uint8(leaf.hash&mask))
+		}
+		for i, sum := range prefixSums {
+			s.hashes.Set(uint(len(leaves)+i), uint8(sum&mask))
+		}
+	}
+}
+
+// find returns the position of the label in the node.
+func (s *SuccinctRangeFilter) find(node uint, label byte) (uint, bool) {
+	start, end := s.nodeRange(node)
+	labels := s.labels[start:end]
+	i := sort.Search(len(labels), func(i int) bool { return labels[i] >= label })
+	if i < len(labels) && labels[i] == label {
+		return start + uint(i), true
+	}
+	return 0, false
+}
+
+// nodeRange returns the range of label positions belonging to the node.
+func (s *SuccinctRangeFilter) nodeRange(node uint) (uint, uint) {
+	start := s.louds.selectOne(node + 1)
+	end := uint(len(s.labels))
+	if node+2 <= s.louds.ones {
+		end = s.louds.selectOne(node + 2)
+	}
+	return start, end
+}
+
+// leafCount returns the number of keys which end at leaves.
+func (s *SuccinctRangeFilter) leafCount() uint {
+	return s.count - s.prefixCount
+}
+
+// realSuffix returns the real suffix bytes stored for the leaf.
+func (s *SuccinctRangeFilter) realSuffix(leaf uint) []byte {
+	start := leaf * uint(s.realBytes)
+	return s.real[start : start+uint(s.realLens.Get(leaf))]
+}
+
+// hashMatches indicates if the hash suffix stored at idx matches the key.
+func (s *SuccinctRangeFilter) hashMatches(idx uint, key []byte) bool {
+	if s.hashBits == 0 {
+		return true
+	}
+	return s.hashes.Get(idx) == s.hashOf(key)&uint32(s.hashes.MaxBucketValue())
+}
+
+// hashOf returns the hash used for the hash suffix of the key.
+func (s *SuccinctRangeFilter) hashOf(key []byte) uint32 {
+	s.hash.Write(key)
+	sum := s.hash.Sum32()
+	s.hash.Reset()
+	return sum
+}
+
+// commonPrefix returns the length of the longest common prefix of a and b.
+func commonPrefix(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// rankSelect is an immutable bit vector supporting rank and select queries.
+type rankSelect struct {
+	words []uint64 // bit data
+	ranks []uint   // number of ones before each word
+	ones  uint     // total number of ones
+}
+
+// newRankSelect creates a new rankSelect from the provided bits.
+func newRankSelect(values []bool) *rankSelect {
+	r := &rankSelect{words: make([]uint64, (len(values)+63)/64)}
+	for i, v := range values {
+		if v {
+			r.words[i/64] |= 1 << uint(i%64)
+		}
+	}
+
+	r.ranks = make([]uint, len(r.words))
+	for i, word := range r.words {
+		r.ranks[i] = r.ones
+		r.ones += uint(bits.OnesCount64(word))
+	}
+	return r
+}
+
+// get returns the bit at the position.
+func (r *rankSelect) get(pos uint) uint {
+	return uint(r.words[pos/64]>>(pos%64)) & 1
+}
+
+// rank returns the number of ones at or before the position.
+func (r *rankSelect) rank(pos uint) uint {
+	mask := uint64(1)<<(pos%64+1) - 1
+	if pos%64 == 63 {
+		mask = ^uint64(0)
+	}
+	return r.ranks[pos/64] + uint(bits.OnesCount64(r.words[pos/64]&mask))
+}
+
+// selectOne returns the position of the nth one, starting from one.
+func (r *rankSelect) selectOne(n uint) uint {
+	// Find the last word with fewer than n ones before it.
+	w := sort.Search(len(r.ranks), func(i int) bool { return r.ranks[i] >= n }) - 1
+	word := r.words[w]
+	for remaining := n - r.ranks[w]; remaining > 1; remaining-- {
+		word &= word - 1
+	}
+	return uint(w)*64 + uint(bits.TrailingZeros64(word))
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data.
+func (s *SuccinctRangeFilter) ByteSize() uint {
+	size := uint(len(s.labels)) + uint(len(s.real)) + s.hashes.ByteSize() + s.realLens.ByteSize()
+	for _, r := range []*rankSelect{s.hasChild, s.louds, s.prefixKey} {
+		size += uint(len(r.words))*8 + uint(len(r.ranks))*pointerSize
+	}
+	return size
+}
+
+// String returns a one-line summary of the SuccinctRangeFilter for logging and
+// debugging.
+func (s *SuccinctRangeFilter) String() string {
+	return fmt.Sprintf("SuccinctRangeFilter{count=%d labels=%d hashBits=%d realBytes=%d}",
+		s.count, len(s.labels), s.hashBits, s.realBytes)
+}
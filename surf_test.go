@@ -0,0 +1,163 @@
+package boom
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+func surfKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		// Spread the keys out so there are gaps between them.
+		keys[i] = make([]byte, 8)
+		binary.BigEndian.PutUint64(keys[i], uint64(i)*1000)
+	}
+	return keys
+}
+
+func surfKey(i uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, i)
+	return key
+}
+
+// Ensures that Test has no false negatives and rejects most non-members.
+func TestSuccinctRangeFilterTest(t *testing.T) {
+	keys := surfKeys(10000)
+	f, err := NewSuccinctRangeFilter(keys, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f.Count(); count != 10000 {
+		t.Errorf("Expected 10000, got %d", count)
+	}
+
+	for _, key := range keys {
+		if !f.Test(key) {
+			t.Fatalf("%x should be a member", key)
+		}
+	}
+
+	fps := 0
+	for i := uint64(0); i < 10000; i++ {
+		if f.Test(surfKey(i*1000 + 500)) {
+			fps++
+		}
+	}
+	if fps > 100 {
+		t.Errorf("Expected fewer than 100 false positives, got %d", fps)
+	}
+}
+
+// Ensures that keys which are prefixes of other keys are handled.
+func TestSuccinctRangeFilterPrefixKeys(t *testing.T) {
+	keys := [][]byte{[]byte(`a`), []byte(`ab`), []byte(`abc`), []byte(`b`),
+		[]byte(`b`), []byte(`bcd`)}
+	f, err := NewSuccinctRangeFilter(keys, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := f.Count(); count != 5 {
+		t.Errorf("Expected 5, got %d", count)
+	}
+
+	for _, key := range keys {
+		if !f.Test(key) {
+			t.Errorf("%s should be a member", key)
+		}
+	}
+
+	for _, key := range []string{``, `c`, `ba`, `aa`} {
+		if f.Test([]byte(key)) {
+			t.Errorf("%s should not be a member", key)
+		}
+	}
+
+	if !f.TestRange([]byte(`abb`), []byte(`abd`)) {
+		t.Error("Expected a key in [abb, abd]")
+	}
+
+	if f.TestRange([]byte(`c`), []byte(`z`)) {
+		t.Error("Expected no key in [c, z]")
+	}
+}
+
+// Ensures that TestRange has no false negatives and detects empty ranges.
+func TestSuccinctRangeFilterTestRange(t *testing.T) {
+	keys := surfKeys(10000)
+	f, err := NewSuccinctRangeFilter(keys, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint64(0); i < 10000; i++ {
+		if !f.TestRange(surfKey(i*1000-10), surfKey(i*1000+10)) && i > 0 {
+			t.Fatalf("Expected a key near %d", i*1000)
+		}
+		if !f.TestRange(surfKey(i*1000), surfKey(i*1000)) {
+			t.Fatalf("Expected key %d", i*1000)
+		}
+	}
+
+	fps := 0
+	for i := uint64(0); i < 10000; i++ {
+		if f.TestRange(surfKey(i*1000+100), surfKey(i*1000+900)) {
+			fps++
+		}
+	}
+	if fps > 100 {
+		t.Errorf("Expected fewer than 100 false positives, got %d", fps)
+	}
+
+	if f.TestRange(surfKey(20000000), surfKey(30000000)) {
+		t.Error("Expected no keys past the last key")
+	}
+
+	if f.TestRange(surfKey(5000), surfKey(1000)) {
+		t.Error("Expected no keys in an inverted range")
+	}
+}
+
+// Ensures that invalid parameters and empty key sets are handled.
+func TestSuccinctRangeFilterEdgeCases(t *testing.T) {
+	if _, err := NewSuccinctRangeFilter(nil, 9, 0); err == nil {
+		t.Error("Expected error for too many hash bits")
+	}
+
+	if _, err := NewSuccinctRangeFilter(nil, 0, 16); err == nil {
+		t.Error("Expected error for too many real bytes")
+	}
+
+	f, err := NewSuccinctRangeFilter(nil, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Test([]byte(`a`)) || f.TestRange([]byte(`a`), []byte(`z`)) {
+		t.Error("Expected empty filter to contain nothing")
+	}
+
+	f, err = NewSuccinctRangeFilter([][]byte{{}}, 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Test([]byte{}) || f.Test([]byte(`a`)) {
+		t.Error("Expected filter to contain only the empty key")
+	}
+}
+
+func BenchmarkSuccinctRangeFilterTest(b *testing.B) {
+	b.StopTimer()
+	keys := make([][]byte, 100000)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i))
+	}
+	f, _ := NewSuccinctRangeFilter(keys, 8, 1)
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(keys[n%len(keys)])
+	}
+}
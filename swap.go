@@ -0,0 +1,55 @@
+package boom
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SwappableBloomFilter holds the FrozenBloomFilter currently being served and
+// allows it to be atomically replaced, for example by a background rebuild.
+// Readers never take a lock and always see either the old or the new filter
+// in its entirety. A replaced filter is reclaimed by the garbage collector
+// once the last reader holding it returns, so no explicit epoch tracking is
+// needed.
+type SwappableBloomFilter struct {
+	current atomic.Value // *FrozenBloomFilter being served
+}
+
+// NewSwappableBloomFilter creates a new SwappableBloomFilter serving the
+// provided filter.
+func NewSwappableBloomFilter(initial *FrozenBloomFilter) *SwappableBloomFilter {
+	s := &SwappableBloomFilter{}
+	s.current.Store(initial)
+	return s
+}
+
+// Current returns the filter currently being served. Callers performing
+// several related lookups should hold on to the returned filter so that they
+// all see the same snapshot.
+func (s *SwappableBloomFilter) Current() *FrozenBloomFilter {
+	return s.current.Load().(*FrozenBloomFilter)
+}
+
+// Swap atomically replaces the filter being served and returns the previous
+// one.
+func (s *SwappableBloomFilter) Swap(filter *FrozenBloomFilter) *FrozenBloomFilter {
+	return s.current.Swap(filter).(*FrozenBloomFilter)
+}
+
+// Test will test for membership of the data in the filter currently being
+// served. It's safe to call concurrently with Swap.
+func (s *SwappableBloomFilter) Test(data []byte) bool {
+	return s.Current().Test(data)
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the filter
+// being served.
+func (s *SwappableBloomFilter) ByteSize() uint {
+	return s.Current().ByteSize()
+}
+
+// String returns a one-line summary of the SwappableBloomFilter for logging and
+// debugging.
+func (s *SwappableBloomFilter) String() string {
+	return fmt.Sprintf("SwappableBloomFilter{current=%s}", s.Current())
+}
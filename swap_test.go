@@ -0,0 +1,63 @@
+package boom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Ensures that Current and Swap replace the filter being served.
+func TestSwappableCurrentAndSwap(t *testing.T) {
+	first := NewBloomFilter(100, 0.01)
+	first.Add([]byte(`a`))
+	second := NewBloomFilter(100, 0.01)
+	second.Add([]byte(`b`))
+
+	frozen := first.Freeze()
+	s := NewSwappableBloomFilter(frozen)
+
+	if s.Current() != frozen {
+		t.Error("Expected the initial filter to be current")
+	}
+
+	if !s.Test([]byte(`a`)) || s.Test([]byte(`b`)) {
+		t.Error("Expected only `a` to be a member")
+	}
+
+	if old := s.Swap(second.Freeze()); old != frozen {
+		t.Error("Expected Swap to return the previous filter")
+	}
+
+	if s.Test([]byte(`a`)) || !s.Test([]byte(`b`)) {
+		t.Error("Expected only `b` to be a member")
+	}
+}
+
+// Ensures that readers can test concurrently with swaps.
+func TestSwappableConcurrent(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 100; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+	s := NewSwappableBloomFilter(f.Freeze())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if !s.Test([]byte(strconv.Itoa(i % 100))) {
+					t.Errorf("`%d` should be a member", i%100)
+				}
+			}
+		}()
+	}
+
+	// Every rebuild keeps the original members.
+	for i := 100; i < 200; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+		s.Swap(f.Freeze())
+	}
+	wg.Wait()
+}
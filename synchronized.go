@@ -0,0 +1,105 @@
+package boom
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SynchronizedFilter wraps a Filter so that it's safe for concurrent use. The
+// filters in this package aren't, since even Test writes to the shared hash
+// function and index buffers, so every operation, including Test, takes an
+// exclusive lock. For concurrent, add-dominated workloads where contention
+// matters, consider an AggregatingBloomFilter instead.
+type SynchronizedFilter struct {
+	mu     sync.Mutex // guards filter
+	filter Filter     // wrapped filter
+}
+
+// Synchronized returns a SynchronizedFilter wrapping the filter. The filter
+// must not be used directly afterward, other than through Do.
+func Synchronized(filter Filter) *SynchronizedFilter {
+	return &SynchronizedFilter{filter: filter}
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. It's safe to call concurrently.
+func (s *SynchronizedFilter) Test(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter.Test(data)
+}
+
+// Add will add the data to the filter. It returns the SynchronizedFilter to
+// allow for chaining. It's safe to call concurrently.
+func (s *SynchronizedFilter) Add(data []byte) Filter {
+	s.mu.Lock()
+	s.filter.Add(data)
+	s.mu.Unlock()
+	return s
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add, atomically. It
+// returns true if the data is a member, false if not. It's safe to call
+// concurrently.
+func (s *SynchronizedFilter) TestAndAdd(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter.TestAndAdd(data)
+}
+
+// AddMany will add each element of data to the filter, taking the lock once.
+// It returns the SynchronizedFilter to allow for chaining. It's safe to call
+// concurrently.
+func (s *SynchronizedFilter) AddMany(data [][]byte) Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if many, ok := s.filter.(interface{ AddMany([][]byte) Filter }); ok {
+		many.AddMany(data)
+		return s
+	}
+	for _, element := range data {
+		s.filter.Add(element)
+	}
+	return s
+}
+
+// TestMany tests the membership of each element of data, taking the lock
+// once, and returns a slice of results in the same order. It's safe to call
+// concurrently.
+func (s *SynchronizedFilter) TestMany(data [][]byte) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if many, ok := s.filter.(interface{ TestMany([][]byte) []bool }); ok {
+		return many.TestMany(data)
+	}
+	results := make([]bool, len(data))
+	for i, element := range data {
+		results[i] = s.filter.Test(element)
+	}
+	return results
+}
+
+// Do calls fn with the wrapped filter while holding the lock, so that any of
+// its other methods, such as TestAndRemove, Reset, or WriteTo, can be called
+// safely. The filter must not be retained after fn returns.
+func (s *SynchronizedFilter) Do(fn func(filter Filter)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.filter)
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// wrapped filter's data, or zero if it doesn't report its size.
+func (s *SynchronizedFilter) ByteSize() uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return byteSize(s.filter)
+}
+
+// String returns a one-line summary of the SynchronizedFilter for logging and
+// debugging.
+func (s *SynchronizedFilter) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("SynchronizedFilter{%v}", s.filter)
+}
@@ -0,0 +1,68 @@
+package boom
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Ensures that a SynchronizedFilter can be used from many goroutines.
+func TestSynchronizedConcurrent(t *testing.T) {
+	filters := []Filter{
+		NewBloomFilter(10000, 0.01),
+		NewDefaultCountingBloomFilter(10000, 0.01),
+		NewDefaultScalableBloomFilter(0.01),
+		NewPartitionedBloomFilter(10000, 0.01),
+	}
+
+	for _, filter := range filters {
+		s := Synchronized(filter)
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					data := []byte(strconv.Itoa(w*500 + i))
+					s.Add(data)
+					s.Test(data)
+					s.TestAndAdd(data)
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		for i := 0; i < 2000; i++ {
+			if !s.Test([]byte(strconv.Itoa(i))) {
+				t.Errorf("%T: `%d` should be a member", filter, i)
+				break
+			}
+		}
+	}
+}
+
+// Ensures that Do runs other operations under the lock.
+func TestSynchronizedDo(t *testing.T) {
+	s := Synchronized(NewDefaultCountingBloomFilter(100, 0.01))
+	if s.Add([]byte(`a`)) != s {
+		t.Error("Returned SynchronizedFilter should be the same instance")
+	}
+
+	removed := false
+	s.Do(func(filter Filter) {
+		removed = filter.(*CountingBloomFilter).TestAndRemove([]byte(`a`))
+	})
+	if !removed || s.Test([]byte(`a`)) {
+		t.Error("Expected `a` to be removed")
+	}
+}
+
+func BenchmarkSynchronizedAdd(b *testing.B) {
+	s := Synchronized(NewBloomFilter(100000, 0.1))
+	b.RunParallel(func(pb *testing.PB) {
+		data := []byte("data")
+		for pb.Next() {
+			s.Add(data)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package boom
+
+import (
+	"fmt"
+	"math"
+)
+
+// tinyLFUSampleFactor is the number of accesses per cache entry recorded
+// before a TinyLFU ages its frequencies.
+const tinyLFUSampleFactor = 10
+
+// TinyLFU is a cache admission policy as described by Einziger, Friedman, and
+// Manes in TinyLFU: A Highly Efficient Cache Admission Policy:
+//
+// https://arxiv.org/abs/1512.00727
+//
+// It approximates the access frequency of keys over a recent sample of
+// accesses with a Count-Min Sketch fronted by a doorkeeper Bloom filter. The
+// doorkeeper records the first access to a key in the sample, so the long
+// tail of keys accessed once never reaches the sketch, which can then be much
+// smaller. Once the sample is full, the doorkeeper is cleared and the
+// sketch's counters are halved, so frequencies reflect recent accesses rather
+// than all-time totals.
+//
+// A cache records every access with Record, and when it must evict an entry
+// to make room for a new one, it calls Admit to decide whether the new entry
+// is worth more than the victim. TinyLFU is not safe for concurrent use.
+type TinyLFU struct {
+	doorkeeper *BloomFilter    // keys accessed at least once in the sample
+	sketch     *CountMinSketch // accesses after the first in the sample
+	sampleSize uint            // accesses recorded before aging
+	accesses   uint            // accesses recorded in the current sample
+}
+
+// NewTinyLFU creates a new TinyLFU for a cache holding up to cacheSize
+// entries. Frequencies are aged every 10 * cacheSize accesses.
+func NewTinyLFU(cacheSize uint) *TinyLFU {
+	sampleSize := cacheSize * tinyLFUSampleFactor
+	return &TinyLFU{
+		doorkeeper: NewBloomFilter(sampleSize, 0.01),
+		sketch:     NewCountMinSketch(1/float64(cacheSize), 0.01),
+		sampleSize: sampleSize,
+	}
+}
+
+// NewTinyLFUE is like NewTinyLFU but returns an error if cacheSize is zero or
+// too large.
+func NewTinyLFUE(cacheSize uint) (*TinyLFU, error) {
+	if err := validateN(cacheSize); err != nil {
+		return nil, err
+	}
+	if cacheSize > math.MaxUint/tinyLFUSampleFactor {
+		return nil, fmt.Errorf("cache size %d is too large", cacheSize)
+	}
+	if err := validateSize(cacheSize*tinyLFUSampleFactor, 0.01, 1); err != nil {
+		return nil, err
+	}
+	return NewTinyLFU(cacheSize), nil
+}
+
+// SampleSize returns the number of accesses recorded before frequencies are
+// aged.
+func (t *TinyLFU) SampleSize() uint {
+	return t.sampleSize
+}
+
+// Record records an access to the key. It returns the TinyLFU to allow for
+// chaining.
+func (t *TinyLFU) Record(key []byte) *TinyLFU {
+	if t.doorkeeper.TestAndAdd(key) {
+		t.sketch.Add(key)
+	}
+	t.accesses++
+	if t.accesses >= t.sampleSize {
+		t.age()
+	}
+	return t
+}
+
+// Frequency returns the estimated number of accesses to the key in the
+// recent sample, where accesses before the last aging count for half as much.
+// Like a Count-Min Sketch, it may overestimate but never underestimates.
+func (t *TinyLFU) Frequency(key []byte) uint64 {
+	if !t.doorkeeper.Test(key) {
+		return t.sketch.Count(key)
+	}
+	return t.sketch.Count(key) + 1
+}
+
+// Admit returns true if the candidate key should be admitted to the cache in
+// place of the victim key, that is, if it has been accessed more frequently.
+// Ties favor the victim, so a burst of new keys can't flush entries which
+// have proven useful.
+func (t *TinyLFU) Admit(candidateKey, victimKey []byte) bool {
+	return t.Frequency(candidateKey) > t.Frequency(victimKey)
+}
+
+// Reset restores the TinyLFU to its original state. It returns itself to
+// allow for chaining.
+func (t *TinyLFU) Reset() *TinyLFU {
+	t.doorkeeper.Reset()
+	t.sketch.Reset()
+	t.accesses = 0
+	return t
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// doorkeeper and sketch.
+func (t *TinyLFU) ByteSize() uint {
+	return t.doorkeeper.ByteSize() + t.sketch.ByteSize()
+}
+
+// String returns a one-line summary of the TinyLFU for logging and debugging.
+func (t *TinyLFU) String() string {
+	return fmt.Sprintf("TinyLFU{sample=%d accesses=%d doorkeeper=%v sketch=%v}",
+		t.sampleSize, t.accesses, t.doorkeeper, t.sketch)
+}
+
+// age clears the doorkeeper and halves the sketch's counters. The accesses
+// which remain in the sketch count as half a sample.
+func (t *TinyLFU) age() {
+	t.doorkeeper.Reset()
+	t.sketch.halve()
+	t.accesses = t.sampleSize / 2
+}
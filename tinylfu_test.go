@@ -0,0 +1,123 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Frequency counts accesses, including the first one recorded by
+// the doorkeeper.
+func TestTinyLFUFrequency(t *testing.T) {
+	f := NewTinyLFU(100)
+	if f.SampleSize() != 1000 {
+		t.Errorf("Expected a sample size of 1000, got %d", f.SampleSize())
+	}
+
+	if freq := f.Frequency([]byte(`a`)); freq != 0 {
+		t.Errorf("Expected frequency 0, got %d", freq)
+	}
+	if f.Record([]byte(`a`)) != f {
+		t.Error("Returned TinyLFU should be the same instance")
+	}
+	if freq := f.Frequency([]byte(`a`)); freq != 1 {
+		t.Errorf("Expected frequency 1, got %d", freq)
+	}
+	if f.sketch.TotalCount() != 0 {
+		t.Error("Expected the first access to only reach the doorkeeper")
+	}
+	for i := 0; i < 4; i++ {
+		f.Record([]byte(`a`))
+	}
+	if freq := f.Frequency([]byte(`a`)); freq != 5 {
+		t.Errorf("Expected frequency 5, got %d", freq)
+	}
+
+	f.Reset()
+	if freq := f.Frequency([]byte(`a`)); freq != 0 {
+		t.Errorf("Expected frequency 0 after Reset, got %d", freq)
+	}
+}
+
+// Ensures that frequencies are halved once the sample is full.
+func TestTinyLFUAging(t *testing.T) {
+	f := NewTinyLFU(10)
+	for i := 0; i < 41; i++ {
+		f.Record([]byte(`hot`))
+	}
+	if freq := f.Frequency([]byte(`hot`)); freq != 41 {
+		t.Errorf("Expected frequency 41, got %d", freq)
+	}
+
+	for i := 0; i < 59; i++ {
+		f.Record([]byte(strconv.Itoa(i)))
+	}
+	// The sample of 100 accesses is full, so the 40 sketch accesses are
+	// halved and the doorkeeper is cleared.
+	if freq := f.Frequency([]byte(`hot`)); freq != 20 {
+		t.Errorf("Expected frequency 20 after aging, got %d", freq)
+	}
+	if f.accesses != 50 {
+		t.Errorf("Expected 50 accesses after aging, got %d", f.accesses)
+	}
+}
+
+// Ensures that Admit favors frequently accessed keys and ties favor the
+// victim.
+func TestTinyLFUAdmit(t *testing.T) {
+	f := NewTinyLFU(1000)
+	for i := 0; i < 10; i++ {
+		f.Record([]byte(`popular`))
+	}
+	f.Record([]byte(`once`))
+
+	if !f.Admit([]byte(`popular`), []byte(`once`)) {
+		t.Error("Expected the popular key to be admitted over a key accessed once")
+	}
+	if f.Admit([]byte(`once`), []byte(`popular`)) {
+		t.Error("Expected a key accessed once not to replace the popular key")
+	}
+	if f.Admit([]byte(`new`), []byte(`unseen`)) {
+		t.Error("Expected ties to favor the victim")
+	}
+}
+
+// Ensures that NewTinyLFUE returns an error for invalid cache sizes.
+func TestNewTinyLFUE(t *testing.T) {
+	for _, size := range []uint{0, ^uint(0)} {
+		if _, err := NewTinyLFUE(size); err == nil {
+			t.Errorf("Expected an error for cache size %d", size)
+		}
+	}
+	if f, err := NewTinyLFUE(100); err != nil || f.SampleSize() != 1000 {
+		t.Errorf("Expected a TinyLFU, got %v", err)
+	}
+}
+
+func BenchmarkTinyLFURecord(b *testing.B) {
+	b.StopTimer()
+	f := NewTinyLFU(10000)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 50000))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Record(data[n])
+	}
+}
+
+func BenchmarkTinyLFUAdmit(b *testing.B) {
+	b.StopTimer()
+	f := NewTinyLFU(10000)
+	data := make([][]byte, b.N+1)
+	for i := range data {
+		data[i] = []byte(strconv.Itoa(i % 50000))
+		f.Record(data[i])
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Admit(data[n], data[n+1])
+	}
+}
@@ -0,0 +1,440 @@
+package boom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// maxDecayExponent is the number of half-lives after the landmark at which
+// the counters of a DecayedTopK are rescaled to avoid overflowing float64.
+const maxDecayExponent = 512
+
+// DecayedElement is an element tracked by a DecayedTopK along with its
+// decayed score.
+type DecayedElement struct {
+	Data  []byte
+	Score float64
+}
+
+// DecayedTopK tracks the top-k most frequent elements in a stream where each
+// occurrence's weight halves every half-life, so the top reflects current
+// traffic rather than all-time totals. It uses forward decay as described by
+// Cormode, Shkapenyuk, Srivastava, and Xu in Forward Decay: A Practical Time
+// Decay Model for Streaming Systems:
+//
+// http://dimacs.rutgers.edu/~graham/pubs/papers/fwddecay.pdf
+//
+// Rather than decaying every counter as time passes, each occurrence is
+// weighted by 2^(t/halfLife) relative to a landmark time and added to a
+// Count-Min Sketch of float counters. Decayed scores at any time are then
+// recovered by dividing by the weight of that time. Since every score is
+// scaled by the same factor, ranking elements never requires decaying them.
+// The landmark is moved forward periodically to keep the weights in range.
+//
+// Elements are ordered by descending score, with ties broken by the data
+// itself, so the output is stable across calls for dashboard use.
+type DecayedTopK struct {
+	matrix   [][]float64       // forward-decayed count matrix
+	width    uint              // matrix width
+	depth    uint              // matrix depth
+	k        uint              // number of elements to track
+	halfLife time.Duration     // time for an occurrence's weight to halve
+	landmark time.Time         // time at which weights are 1
+	elements []*DecayedElement // top-k elements with forward-decayed scores
+	hash     hash.Hash64       // hash function (kernel for all depth functions)
+}
+
+// NewDecayedTopK creates a new DecayedTopK which tracks the k elements with
+// the highest decayed counts, where an occurrence's weight halves every
+// half-life. Counts are approximated by a Count-Min Sketch whose relative
+// accuracy is within a factor of epsilon with probability delta. It panics if
+// the half-life isn't positive.
+func NewDecayedTopK(epsilon, delta float64, k uint, halfLife time.Duration) *DecayedTopK {
+	if halfLife <= 0 {
+		panic("boom: NewDecayedTopK half-life must be positive")
+	}
+
+	var (
+		width, depth = OptimalCMSWidthDepth(epsilon, delta)
+		matrix       = make([][]float64, depth)
+	)
+
+	for i := uint(0); i < depth; i++ {
+		matrix[i] = make([]float64, width)
+	}
+
+	return &DecayedTopK{
+		matrix:   matrix,
+		width:    width,
+		depth:    depth,
+		k:        k,
+		halfLife: halfLife,
+		elements: make([]*DecayedElement, 0, k),
+		hash:     newDefaultHash(),
+	}
+}
+
+// K returns the number of elements tracked.
+func (d *DecayedTopK) K() uint {
+	return d.k
+}
+
+// HalfLife returns the time it takes for an occurrence's weight to halve.
+func (d *DecayedTopK) HalfLife() time.Duration {
+	return d.halfLife
+}
+
+// SetHash sets the hashing function used in the sketch.
+func (d *DecayedTopK) SetHash(h hash.Hash64) {
+	d.hash = h
+}
+
+// Add will add an occurrence of the data at the current time. Returns the
+// DecayedTopK to allow for chaining.
+func (d *DecayedTopK) Add(data []byte) *DecayedTopK {
+	return d.AddAt(data, time.Now())
+}
+
+// AddAt will add an occurrence of the data at the specified time. Occurrences
+// should be added in roughly chronological order, since an occurrence before
+// the landmark carries less weight than its age would suggest. Returns the
+// DecayedTopK to allow for chaining.
+func (d *DecayedTopK) AddAt(data []byte, t time.Time) *DecayedTopK {
+	if d.landmark.IsZero() {
+		d.landmark = t
+	}
+	if d.exponent(t) > maxDecayExponent {
+		d.rescale(t)
+	}
+
+	var (
+		weight       = math.Exp2(d.exponent(t))
+		lower, upper = hashKernel(data, d.hash)
+		score        = math.Inf(1)
+	)
+
+	// Add the weight to each row, estimating the score as the minimum.
+	for i := uint(0); i < d.depth; i++ {
+		idx := DoubleHashing.index(lower, upper, i, d.width)
+		d.matrix[i][idx] += weight
+		score = math.Min(score, d.matrix[i][idx])
+	}
+
+	d.offer(data, score)
+	return d
+}
+
+// Score returns the approximate decayed count for the data at the current
+// time.
+func (d *DecayedTopK) Score(data []byte) float64 {
+	return d.ScoreAt(data, time.Now())
+}
+
+// ScoreAt returns the approximate decayed count for the data at the
+// specified time.
+func (d *DecayedTopK) ScoreAt(data []byte, t time.Time) float64 {
+	if d.landmark.IsZero() {
+		return 0
+	}
+
+	var (
+		lower, upper = hashKernel(data, d.hash)
+		score        = math.Inf(1)
+	)
+
+	for i := uint(0); i < d.depth; i++ {
+		score = math.Min(score, d.matrix[i][DoubleHashing.index(lower, upper, i, d.width)])
+	}
+
+	return score / math.Exp2(d.exponent(t))
+}
+
+// Elements returns the top-k elements with their decayed scores at the
+// current time, ordered by descending score and then by data.
+func (d *DecayedTopK) Elements() []*DecayedElement {
+	return d.ElementsAt(time.Now())
+}
+
+// ElementsAt returns the top-k elements with their decayed scores at the
+// specified time, ordered by descending score and then by data.
+func (d *DecayedTopK) ElementsAt(t time.Time) []*DecayedElement {
+	var (
+		scale    = math.Exp2(d.exponent(t))
+		elements = make([]*DecayedElement, len(d.elements))
+	)
+
+	for i, e := range d.elements {
+		elements[i] = &DecayedElement{Data: e.Data, Score: e.Score / scale}
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		if elements[i].Score != elements[j].Score {
+			return elements[i].Score > elements[j].Score
+		}
+		return bytes.Compare(elements[i].Data, elements[j].Data) < 0
+	})
+
+	return elements
+}
+
+// WriteTo writes a binary representation of the DecayedTopK to an i/o stream.
+// It returns the number of bytes written.
+func (d *DecayedTopK) WriteTo(stream io.Writer) (int64, error) {
+	header := topKHeader{
+		Width:    uint64(d.width),
+		Depth:    uint64(d.depth),
+		K:        uint64(d.k),
+		HalfLife: int64(d.halfLife),
+		Elements: uint64(len(d.elements)),
+	}
+	// A zero landmark, before anything is added, is written as 0 since it
+	// can't be represented in Unix nanoseconds.
+	if !d.landmark.IsZero() {
+		header.Landmark = d.landmark.UnixNano()
+	}
+	if err := binary.Write(stream, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(header))
+
+	for _, row := range d.matrix {
+		if err := binary.Write(stream, binary.BigEndian, row); err != nil {
+			return written, err
+		}
+		written += int64(binary.Size(row))
+	}
+
+	for _, element := range d.elements {
+		if err := binary.Write(stream, binary.BigEndian, uint64(len(element.Data))); err != nil {
+			return written, err
+		}
+		written += 8
+		n, err := stream.Write(element.Data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if err := binary.Write(stream, binary.BigEndian, element.Score); err != nil {
+			return written, err
+		}
+		written += 8
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of a DecayedTopK (such as might have
+// been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (d *DecayedTopK) ReadFrom(stream io.Reader) (int64, error) {
+	var header topKHeader
+	if err := binary.Read(stream, binary.BigEndian, &header); err != nil {
+		return 0, err
+	}
+	read := int64(binary.Size(header))
+
+	hi, size := bits.Mul64(header.Width, header.Depth)
+	if header.Width == 0 || header.Depth == 0 || hi != 0 || size > math.MaxInt64/8 ||
+		header.HalfLife <= 0 || header.Elements > header.K {
+		return read, errors.New("invalid top-k dimensions")
+	}
+	matrix := make([][]float64, 0, 1)
+	for i := uint64(0); i < header.Depth; i++ {
+		words, n, err := readWords(stream, header.Width)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		row := make([]float64, len(words))
+		for j, word := range words {
+			row[j] = math.Float64frombits(word)
+		}
+		matrix = append(matrix, row)
+	}
+
+	elements := make([]*DecayedElement, 0, 1)
+	for i := uint64(0); i < header.Elements; i++ {
+		var length uint64
+		if err := binary.Read(stream, binary.BigEndian, &length); err != nil {
+			return read, err
+		}
+		read += 8
+		data, n, err := readBytes(stream, length)
+		read += n
+		if err != nil {
+			return read, err
+		}
+		element := &DecayedElement{Data: data}
+		if err := binary.Read(stream, binary.BigEndian, &element.Score); err != nil {
+			return read, err
+		}
+		read += 8
+		elements = append(elements, element)
+	}
+
+	d.matrix = matrix
+	d.width = uint(header.Width)
+	d.depth = uint(header.Depth)
+	d.k = uint(header.K)
+	d.halfLife = time.Duration(header.HalfLife)
+	d.landmark = time.Time{}
+	if header.Landmark != 0 {
+		d.landmark = time.Unix(0, header.Landmark)
+	}
+	d.elements = elements
+	if d.hash == nil {
+		d.hash = newDefaultHash()
+	}
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (d *DecayedTopK) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (d *DecayedTopK) GobDecode(data []byte) error {
+	_, err := d.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// topKHeader is the header of the binary representation of a DecayedTopK.
+type topKHeader struct {
+	Width    uint64
+	Depth    uint64
+	K        uint64
+	HalfLife int64
+	Landmark int64 // Unix nanoseconds, or 0 if unset
+	Elements uint64
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// sketch's data, including the tracked elements.
+func (d *DecayedTopK) ByteSize() uint {
+	size := d.width * d.depth * 8
+	for _, element := range d.elements {
+		size += uint(len(element.Data))
+	}
+	return size
+}
+
+// String returns a one-line summary of the DecayedTopK for logging and
+// debugging.
+func (d *DecayedTopK) String() string {
+	return fmt.Sprintf("DecayedTopK{k=%d halfLife=%s width=%d depth=%d tracked=%d}",
+		d.k, d.halfLife, d.width, d.depth, len(d.elements))
+}
+
+// Reset restores the DecayedTopK to its original state. It returns the
+// DecayedTopK to allow for chaining.
+func (d *DecayedTopK) Reset() *DecayedTopK {
+	for _, row := range d.matrix {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	d.elements = d.elements[:0]
+	d.landmark = time.Time{}
+	return d
+}
+
+// Copy returns a deep copy of the DecayedTopK. Returns ErrHashNotCloneable if
+// the sketch's hash can't be cloned.
+func (d *DecayedTopK) Copy() (*DecayedTopK, error) {
+	hash, err := copyHash64(d.hash)
+	if err != nil {
+		return nil, err
+	}
+	copied := *d
+	copied.matrix = make([][]float64, len(d.matrix))
+	for i, row := range d.matrix {
+		copied.matrix[i] = append([]float64(nil), row...)
+	}
+	copied.elements = make([]*DecayedElement, len(d.elements))
+	for i, element := range d.elements {
+		copied.elements[i] = &DecayedElement{Data: element.Data, Score: element.Score}
+	}
+	copied.hash = hash
+	return &copied, nil
+}
+
+// Equal returns whether the other DecayedTopK has the same parameters, hashing
+// function, and counters and elements.
+func (d *DecayedTopK) Equal(other *DecayedTopK) bool {
+	if d.width != other.width || d.depth != other.depth || d.k != other.k ||
+		d.halfLife != other.halfLife || !d.landmark.Equal(other.landmark) ||
+		!sameHash(d.hash, other.hash) || len(d.elements) != len(other.elements) {
+		return false
+	}
+	for i, row := range d.matrix {
+		for j, counter := range row {
+			if other.matrix[i][j] != counter {
+				return false
+			}
+		}
+	}
+	for i, element := range d.elements {
+		if !bytes.Equal(element.Data, other.elements[i].Data) || element.Score != other.elements[i].Score {
+			return false
+		}
+	}
+	return true
+}
+
+// exponent returns the number of half-lives between the landmark and the
+// time.
+func (d *DecayedTopK) exponent(t time.Time) float64 {
+	if d.halfLife <= 0 {
+		return 0
+	}
+	return float64(t.Sub(d.landmark)) / float64(d.halfLife)
+}
+
+// rescale moves the landmark to the time, scaling every counter and tracked
+// score down by the weight of the time.
+func (d *DecayedTopK) rescale(t time.Time) {
+	scale := math.Exp2(-d.exponent(t))
+	for _, row := range d.matrix {
+		for i := range row {
+			row[i] *= scale
+		}
+	}
+	for _, e := range d.elements {
+		e.Score *= scale
+	}
+	d.landmark = t
+}
+
+// offer updates the score of the data if it's tracked, or starts tracking it
+// if it's among the top k.
+func (d *DecayedTopK) offer(data []byte, score float64) {
+	min := -1
+	for i, e := range d.elements {
+		if bytes.Equal(e.Data, data) {
+			e.Score = score
+			return
+		}
+		if min < 0 || e.Score < d.elements[min].Score {
+			min = i
+		}
+	}
+
+	element := &DecayedElement{Data: append([]byte(nil), data...), Score: score}
+	if uint(len(d.elements)) < d.k {
+		d.elements = append(d.elements, element)
+	} else if min >= 0 && score > d.elements[min].Score {
+		d.elements[min] = element
+	}
+}
@@ -0,0 +1,216 @@
+package boom
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Ensures that K and HalfLife return the values the DecayedTopK was created
+// with.
+func TestDecayedTopKParameters(t *testing.T) {
+	d := NewDecayedTopK(0.001, 0.99, 5, time.Minute)
+
+	if k := d.K(); k != 5 {
+		t.Errorf("Expected 5, got %d", k)
+	}
+
+	if halfLife := d.HalfLife(); halfLife != time.Minute {
+		t.Errorf("Expected 1m0s, got %s", halfLife)
+	}
+}
+
+// Ensures that scores halve every half-life.
+func TestDecayedTopKScore(t *testing.T) {
+	var (
+		d   = NewDecayedTopK(0.001, 0.99, 5, time.Minute)
+		now = time.Unix(1000, 0)
+	)
+
+	if score := d.ScoreAt([]byte(`a`), now); score != 0 {
+		t.Errorf("Expected 0, got %f", score)
+	}
+
+	for i := 0; i < 8; i++ {
+		if d.AddAt([]byte(`a`), now) != d {
+			t.Error("Returned DecayedTopK should be the same instance")
+		}
+	}
+
+	if score := d.ScoreAt([]byte(`a`), now); score != 8 {
+		t.Errorf("Expected 8, got %f", score)
+	}
+
+	if score := d.ScoreAt([]byte(`a`), now.Add(2*time.Minute)); math.Abs(score-2) > 1e-9 {
+		t.Errorf("Expected 2, got %f", score)
+	}
+
+	d.AddAt([]byte(`a`), now.Add(time.Minute))
+	if score := d.ScoreAt([]byte(`a`), now.Add(time.Minute)); math.Abs(score-5) > 1e-9 {
+		t.Errorf("Expected 5, got %f", score)
+	}
+}
+
+// Ensures that the top-k reflects recent traffic and is ordered by descending
+// score and then by data.
+func TestDecayedTopKElements(t *testing.T) {
+	var (
+		d   = NewDecayedTopK(0.001, 0.99, 3, time.Minute)
+		now = time.Unix(1000, 0)
+	)
+
+	// `old` was popular an hour ago.
+	for i := 0; i < 1000; i++ {
+		d.AddAt([]byte(`old`), now)
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		d.AddAt([]byte(`c`), now)
+		d.AddAt([]byte(`b`), now)
+		d.AddAt([]byte(`a`), now)
+	}
+	d.AddAt([]byte(`d`), now)
+
+	elements := d.ElementsAt(now)
+	if len(elements) != 3 {
+		t.Fatalf("Expected 3 elements, got %d", len(elements))
+	}
+
+	for i, expected := range []string{"a", "b", "c"} {
+		if string(elements[i].Data) != expected {
+			t.Errorf("Expected %s, got %s", expected, elements[i].Data)
+		}
+		if elements[i].Score != 10 {
+			t.Errorf("Expected 10, got %f", elements[i].Score)
+		}
+	}
+}
+
+// Ensures that counters are rescaled rather than overflowing after many
+// half-lives.
+func TestDecayedTopKRescale(t *testing.T) {
+	var (
+		d   = NewDecayedTopK(0.001, 0.99, 3, time.Second)
+		now = time.Unix(1000, 0)
+	)
+
+	d.AddAt([]byte(`a`), now)
+	now = now.Add(2000 * time.Second)
+	d.AddAt([]byte(`b`), now)
+	d.AddAt([]byte(`b`), now)
+
+	if score := d.ScoreAt([]byte(`b`), now); score != 2 {
+		t.Errorf("Expected 2, got %f", score)
+	}
+
+	elements := d.ElementsAt(now)
+	if len(elements) != 2 || string(elements[0].Data) != "b" || elements[0].Score != 2 {
+		t.Errorf("Expected b with score 2 first, got %v", elements)
+	}
+}
+
+// Ensures that Reset clears the DecayedTopK.
+func TestDecayedTopKReset(t *testing.T) {
+	d := NewDecayedTopK(0.001, 0.99, 3, time.Minute)
+	for i := 0; i < 100; i++ {
+		d.Add([]byte(strconv.Itoa(i)))
+	}
+
+	if d.Reset() != d {
+		t.Error("Returned DecayedTopK should be the same instance")
+	}
+
+	if elements := d.Elements(); len(elements) != 0 {
+		t.Errorf("Expected 0 elements, got %d", len(elements))
+	}
+
+	if score := d.Score([]byte(`1`)); score != 0 {
+		t.Errorf("Expected 0, got %f", score)
+	}
+}
+
+// Ensures that a DecayedTopK round-trips through WriteTo and ReadFrom.
+func TestDecayedTopKWriteToReadFrom(t *testing.T) {
+	start := time.Unix(1000, 0)
+	topk := NewDecayedTopK(0.001, 0.99, 5, time.Minute)
+	for i := 0; i < 100; i++ {
+		topk.AddAt([]byte(strconv.Itoa(i%10)), start.Add(time.Duration(i)*time.Second))
+	}
+
+	var buf bytes.Buffer
+	if _, err := topk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &DecayedTopK{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	now := start.Add(2 * time.Minute)
+	expected, actual := topk.ElementsAt(now), other.ElementsAt(now)
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected %d elements, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if string(actual[i].Data) != string(expected[i].Data) || actual[i].Score != expected[i].Score {
+			t.Errorf("Expected %v, got %v", expected[i], actual[i])
+		}
+	}
+	if score := other.ScoreAt([]byte(`3`), now); score != topk.ScoreAt([]byte(`3`), now) {
+		t.Errorf("Expected %f, got %f", topk.ScoreAt([]byte(`3`), now), score)
+	}
+}
+
+// Ensures that an empty DecayedTopK round-trips through WriteTo and ReadFrom
+// without gaining a landmark.
+func TestDecayedTopKWriteToReadFromEmpty(t *testing.T) {
+	topk := NewDecayedTopK(0.01, 0.99, 5, time.Minute)
+
+	var buf bytes.Buffer
+	if _, err := topk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := &DecayedTopK{}
+	if _, err := other.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !other.landmark.IsZero() {
+		t.Errorf("Expected no landmark, got %v", other.landmark)
+	}
+	if !topk.Equal(other) {
+		t.Error("Expected the round-tripped sketch to be equal")
+	}
+}
+
+// Ensures that NewDecayedTopK panics for a half-life which isn't positive,
+// which ReadFrom would reject.
+func TestNewDecayedTopKHalfLife(t *testing.T) {
+	for _, halfLife := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for a half-life of %v", halfLife)
+				}
+			}()
+			NewDecayedTopK(0.01, 0.99, 5, halfLife)
+		}()
+	}
+}
+
+func BenchmarkDecayedTopKAdd(b *testing.B) {
+	b.StopTimer()
+	d := NewDecayedTopK(0.001, 0.99, 10, time.Minute)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i % 1000))
+	}
+	now := time.Now()
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		d.AddAt(data[n], now)
+	}
+}
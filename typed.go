@@ -0,0 +1,79 @@
+package boom
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Encoder converts a key of type T to the bytes a filter hashes. Equal keys
+// must always encode to the same bytes, and distinct keys should encode to
+// distinct bytes, or they'll be indistinguishable to the filter.
+type Encoder[T any] func(key T) []byte
+
+// TypedFilter wraps a Filter so that keys of type T, such as strings,
+// integers, or structs, can be added and tested directly rather than being
+// converted to bytes at every call site.
+type TypedFilter[T any] struct {
+	filter Filter     // wrapped filter
+	encode Encoder[T] // converts keys to bytes
+}
+
+// Typed returns a TypedFilter which encodes keys with encode before passing
+// them to the filter. The filter can still be used directly with the encoded
+// keys.
+func Typed[T any](filter Filter, encode Encoder[T]) *TypedFilter[T] {
+	return &TypedFilter[T]{filter: filter, encode: encode}
+}
+
+// Test will test for membership of the key and returns true if it is a
+// member, false if not.
+func (t *TypedFilter[T]) Test(key T) bool {
+	return t.filter.Test(t.encode(key))
+}
+
+// Add will add the key to the filter. It returns the TypedFilter to allow for
+// chaining.
+func (t *TypedFilter[T]) Add(key T) *TypedFilter[T] {
+	t.filter.Add(t.encode(key))
+	return t
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the key is a member, false if not.
+func (t *TypedFilter[T]) TestAndAdd(key T) bool {
+	return t.filter.TestAndAdd(t.encode(key))
+}
+
+// Filter returns the wrapped filter.
+func (t *TypedFilter[T]) Filter() Filter {
+	return t.filter
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// wrapped filter's data, or zero if it doesn't report its size.
+func (t *TypedFilter[T]) ByteSize() uint {
+	return byteSize(t.filter)
+}
+
+// String returns a one-line summary of the TypedFilter for logging and
+// debugging.
+func (t *TypedFilter[T]) String() string {
+	return fmt.Sprintf("TypedFilter{%v}", t.filter)
+}
+
+// StringEncoder encodes a string as its bytes.
+func StringEncoder(key string) []byte {
+	return []byte(key)
+}
+
+// Int64Encoder encodes an int64 as 8 big-endian bytes.
+func Int64Encoder(key int64) []byte {
+	return Uint64Encoder(uint64(key))
+}
+
+// Uint64Encoder encodes a uint64 as 8 big-endian bytes.
+func Uint64Encoder(key uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], key)
+	return buf[:]
+}
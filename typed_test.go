@@ -0,0 +1,82 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Test, Add, and TestAndAdd behave correctly with string keys.
+func TestTypedString(t *testing.T) {
+	f := Typed(NewBloomFilter(100, 0.01), StringEncoder)
+
+	if f.Add("a") != f {
+		t.Error("Returned TypedFilter should be the same instance")
+	}
+	if !f.Test("a") {
+		t.Error("`a` should be a member")
+	}
+	if f.TestAndAdd("b") {
+		t.Error("`b` should not be a member")
+	}
+	if !f.Test("b") {
+		t.Error("`b` should be a member")
+	}
+
+	// The wrapped filter sees the encoded keys.
+	if !f.Filter().Test([]byte(`a`)) {
+		t.Error("`a` should be a member of the wrapped filter")
+	}
+}
+
+// Ensures that integer keys are encoded distinctly.
+func TestTypedInt64(t *testing.T) {
+	f := Typed(NewDefaultScalableBloomFilter(0.001), Int64Encoder)
+	for i := int64(-500); i < 500; i += 2 {
+		f.Add(i)
+	}
+
+	fp := 0
+	for i := int64(-500); i < 500; i++ {
+		if i%2 == 0 && !f.Test(i) {
+			t.Errorf("`%d` should be a member", i)
+		}
+		if i%2 != 0 && f.Test(i) {
+			fp++
+		}
+	}
+	if fp > 5 {
+		t.Errorf("Expected few false positives, got %d", fp)
+	}
+}
+
+// Ensures that struct keys can be used with a custom encoder.
+func TestTypedStruct(t *testing.T) {
+	type edge struct {
+		from, to uint64
+	}
+	f := Typed(NewBloomFilter(100, 0.01), func(e edge) []byte {
+		return append(Uint64Encoder(e.from), Uint64Encoder(e.to)...)
+	})
+
+	f.Add(edge{1, 2})
+	if !f.Test(edge{1, 2}) {
+		t.Error("Edge 1->2 should be a member")
+	}
+	if f.Test(edge{2, 1}) {
+		t.Error("Edge 2->1 should not be a member")
+	}
+}
+
+func BenchmarkTypedAdd(b *testing.B) {
+	b.StopTimer()
+	f := Typed(NewBloomFilter(100000, 0.1), StringEncoder)
+	data := make([]string, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = strconv.Itoa(i)
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Add(data[n])
+	}
+}
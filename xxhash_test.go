@@ -0,0 +1,108 @@
+package boom
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Ensures that NewXXHash computes the reference XXH64 values, whether the
+// data is written at once or in pieces.
+func TestXXHash(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+
+	h := NewXXHash()
+	for _, test := range tests {
+		h.Reset()
+		h.Write([]byte(test.data))
+		if sum := h.Sum64(); sum != test.expected {
+			t.Errorf("%q: Expected %x, got %x", test.data, test.expected, sum)
+		}
+		if sum := xxHash64(test.data); sum != test.expected {
+			t.Errorf("%q: Expected %x, got %x", test.data, test.expected, sum)
+		}
+	}
+
+	// Lengths exercising every stage of the algorithm agree between bytes,
+	// strings, and pieces.
+	data := strings.Repeat("0123456789abcdef", 5)
+	for n := 0; n <= len(data); n++ {
+		h.Reset()
+		h.Write([]byte(data[:n/2]))
+		h.Write([]byte(data[n/2 : n]))
+		if h.Sum64() != xxHash64(data[:n]) || h.Sum64() != xxHash64([]byte(data[:n])) {
+			t.Errorf("Expected sums of %d bytes to agree", n)
+		}
+	}
+}
+
+// Ensures that SetDefaultHash changes the hash of filters created afterward
+// and that filters using NewXXHash work with the hash-dependent features.
+func TestSetDefaultHash(t *testing.T) {
+	SetDefaultHash(NewXXHash)
+	defer SetDefaultHash(nil)
+
+	f := NewBloomFilter(1000, 0.01)
+	if _, ok := f.hash.(*xxHash); !ok {
+		t.Fatalf("Expected xxHash, got %T", f.hash)
+	}
+	for i := 0; i < 1000; i++ {
+		f.AddString(strconv.Itoa(i))
+	}
+
+	frozen := f.Freeze()
+	copied, err := f.Copy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		data := []byte(strconv.Itoa(i))
+		if !f.Test(data) || !frozen.Test(data) || !copied.Test(data) {
+			t.Errorf("`%d` should be a member", i)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.TestString("hello")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+
+	SetDefaultHash(nil)
+	if reflect.TypeOf(NewBloomFilter(100, 0.01).hash) != fnv64Type {
+		t.Error("Expected FNV-1 to be restored")
+	}
+}
+
+func BenchmarkXXHash(b *testing.B) {
+	benchmarkHash(b, NewXXHash())
+}
+
+func BenchmarkFNVHash(b *testing.B) {
+	benchmarkHash(b, newDefaultHash())
+}
+
+func benchmarkHash(b *testing.B, h interface {
+	Write([]byte) (int, error)
+	Sum64() uint64
+	Reset()
+}) {
+	data := []byte(strings.Repeat("x", 64))
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		h.Write(data)
+		h.Sum64()
+		h.Reset()
+	}
+}
@@ -0,0 +1,204 @@
+package boom
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// YesNoBloomFilter implements a Yes-No Bloom filter as described by Carrea,
+// Vernitski, and Reed in Yes-No Bloom Filter: A Way of Representing Sets with
+// Fewer False Positives:
+//
+// https://arxiv.org/abs/1603.01060
+//
+// A Yes-No Bloom filter pairs a "yes" Bloom filter of the elements in the set
+// with a "no" Bloom filter of known false positives of the yes filter. Data is
+// a member if it's in the yes filter and not in the no filter, so false
+// positives can be suppressed as they are discovered without rebuilding the
+// filter. A false positive in the no filter suppresses a real member, which
+// introduces a non-zero probability of false negatives.
+//
+// Yes-No Bloom filters are useful for applications which learn their false
+// positives at runtime, such as a cache which misses after the filter
+// reported a hit.
+type YesNoBloomFilter struct {
+	yes *BloomFilter // filter of elements
+	no  *BloomFilter // filter of known false positives
+}
+
+// NewYesNoBloomFilter creates a new Yes-No Bloom filter optimized to store n
+// items with a specified target false-positive rate and record up to fps
+// known false positives with a specified target false-negative rate.
+func NewYesNoBloomFilter(n uint, fpRate float64, fps uint, fnRate float64) *YesNoBloomFilter {
+	return &YesNoBloomFilter{
+		yes: NewBloomFilter(n, fpRate),
+		no:  NewBloomFilter(fps, fnRate),
+	}
+}
+
+// NewYesNoBloomFilterE is like NewYesNoBloomFilter but returns an error if n or
+// fps is zero, fpRate or fnRate isn't between 0 and 1, or either filter would
+// be too large to address.
+func NewYesNoBloomFilterE(n uint, fpRate float64, fps uint, fnRate float64) (*YesNoBloomFilter, error) {
+	if err := validateN(n); err != nil {
+		return nil, err
+	}
+	if fps == 0 {
+		return nil, errors.New("fps must be positive")
+	}
+	if err := validateRate("fpRate", fpRate); err != nil {
+		return nil, err
+	}
+	if err := validateRate("fnRate", fnRate); err != nil {
+		return nil, err
+	}
+	if err := validateSize(n, fpRate, 1); err != nil {
+		return nil, err
+	}
+	if err := validateSize(fps, fnRate, 1); err != nil {
+		return nil, err
+	}
+	return NewYesNoBloomFilter(n, fpRate, fps, fnRate), nil
+}
+
+// Count returns the number of items added to the filter.
+func (y *YesNoBloomFilter) Count() uint {
+	return y.yes.Count()
+}
+
+// FalsePositives returns the number of false positives recorded.
+func (y *YesNoBloomFilter) FalsePositives() uint {
+	return y.no.Count()
+}
+
+// Test will test for membership of the data and returns true if it is a
+// member, false if not. This is a probabilistic test, meaning there is a
+// non-zero probability of false positives and false negatives.
+func (y *YesNoBloomFilter) Test(data []byte) bool {
+	return y.yes.Test(data) && !y.no.Test(data)
+}
+
+// Add will add the data to the filter. Data previously recorded with
+// AddFalsePositive still doesn't test as a member, since false positives
+// can't be removed from the no filter. It returns the filter to allow for
+// chaining.
+func (y *YesNoBloomFilter) Add(data []byte) Filter {
+	y.yes.Add(data)
+	return y
+}
+
+// TestAndAdd is equivalent to calling Test followed by Add. It returns true if
+// the data is a member, false if not.
+func (y *YesNoBloomFilter) TestAndAdd(data []byte) bool {
+	return y.yes.TestAndAdd(data) && !y.no.Test(data)
+}
+
+// AddFalsePositive records the data as a false positive so that it no longer
+// tests as a member, even if it's added later. Data which doesn't test as a
+// member is ignored. It returns the filter to allow for chaining.
+func (y *YesNoBloomFilter) AddFalsePositive(data []byte) *YesNoBloomFilter {
+	if y.Test(data) {
+		y.no.Add(data)
+	}
+	return y
+}
+
+// WriteTo writes a binary representation of the YesNoBloomFilter to an i/o
+// stream, the yes filter followed by the no filter. It returns the number of
+// bytes written.
+func (y *YesNoBloomFilter) WriteTo(stream io.Writer) (int64, error) {
+	written, err := y.yes.WriteTo(stream)
+	if err != nil {
+		return written, err
+	}
+	n, err := y.no.WriteTo(stream)
+	return written + n, err
+}
+
+// ReadFrom reads a binary representation of a YesNoBloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream. It returns the number of
+// bytes read.
+func (y *YesNoBloomFilter) ReadFrom(stream io.Reader) (int64, error) {
+	yes, no := &BloomFilter{}, &BloomFilter{}
+	read, err := yes.ReadFrom(stream)
+	if err != nil {
+		return read, err
+	}
+	n, err := no.ReadFrom(stream)
+	read += n
+	if err != nil {
+		return read, err
+	}
+
+	y.yes = yes
+	y.no = no
+	return read, nil
+}
+
+// GobEncode implements gob.GobEncoder interface.
+func (y *YesNoBloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := y.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder interface.
+func (y *YesNoBloomFilter) GobDecode(data []byte) error {
+	_, err := y.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// ByteSize returns the approximate number of bytes of memory used by the
+// filter's data, the sum of its yes and no filters.
+func (y *YesNoBloomFilter) ByteSize() uint {
+	return y.yes.ByteSize() + y.no.ByteSize()
+}
+
+// String returns a one-line summary of the YesNoBloomFilter for logging and
+// debugging.
+func (y *YesNoBloomFilter) String() string {
+	var count, falsePositives uint
+	if y.yes != nil && y.no != nil {
+		count, falsePositives = y.yes.count, y.no.count
+	}
+	return fmt.Sprintf("YesNoBloomFilter{count=%d falsePositives=%d yes=%s no=%s}",
+		count, falsePositives, y.yes, y.no)
+}
+
+// Reset restores the filter to its original state. It returns the filter to
+// allow for chaining.
+func (y *YesNoBloomFilter) Reset() *YesNoBloomFilter {
+	y.yes.Reset()
+	y.no.Reset()
+	return y
+}
+
+// Copy returns a deep copy of the YesNoBloomFilter. Returns
+// ErrHashNotCloneable if the filter's hash can't be cloned.
+func (y *YesNoBloomFilter) Copy() (*YesNoBloomFilter, error) {
+	yes, err := y.yes.Copy()
+	if err != nil {
+		return nil, err
+	}
+	no, err := y.no.Copy()
+	if err != nil {
+		return nil, err
+	}
+	return &YesNoBloomFilter{yes: yes, no: no}, nil
+}
+
+// Equal returns whether the other YesNoBloomFilter has equal yes and no
+// filters.
+func (y *YesNoBloomFilter) Equal(other *YesNoBloomFilter) bool {
+	return y.yes.Equal(other.yes) && y.no.Equal(other.no)
+}
+
+// Clear is equivalent to Reset, but doesn't return the filter so that it
+// satisfies ResettableFilter.
+func (y *YesNoBloomFilter) Clear() {
+	y.Reset()
+}
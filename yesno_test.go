@@ -0,0 +1,150 @@
+package boom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Ensures that Test, Add, and TestAndAdd behave correctly.
+func TestYesNoTestAndAdd(t *testing.T) {
+	f := NewYesNoBloomFilter(100, 0.01, 10, 0.01)
+
+	// `a` isn't in the filter.
+	if f.Test([]byte(`a`)) {
+		t.Error("`a` should not be a member")
+	}
+
+	if f.Add([]byte(`a`)) != f {
+		t.Error("Returned YesNoBloomFilter should be the same instance")
+	}
+
+	// `a` is now in the filter.
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+
+	// `b` isn't in the filter.
+	if f.TestAndAdd([]byte(`b`)) {
+		t.Error("`b` should not be a member")
+	}
+
+	// `b` is now in the filter.
+	if !f.Test([]byte(`b`)) {
+		t.Error("`b` should be a member")
+	}
+
+	if count := f.Count(); count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+}
+
+// Ensures that NewYesNoBloomFilterE returns an error for invalid parameters.
+func TestNewYesNoBloomFilterE(t *testing.T) {
+	if f, err := NewYesNoBloomFilterE(100, 0.01, 10, 0.01); err != nil || f == nil {
+		t.Errorf("Expected a YesNoBloomFilter, got error %v", err)
+	}
+
+	if _, err := NewYesNoBloomFilterE(0, 0.01, 10, 0.01); err == nil {
+		t.Error("Expected error for n = 0")
+	}
+
+	if _, err := NewYesNoBloomFilterE(100, 0.01, 0, 0.01); err == nil {
+		t.Error("Expected error for fps = 0")
+	}
+
+	if _, err := NewYesNoBloomFilterE(100, 0.01, 10, 1); err == nil {
+		t.Error("Expected error for fnRate = 1")
+	}
+}
+
+// Ensures that AddFalsePositive suppresses recorded false positives.
+func TestYesNoAddFalsePositive(t *testing.T) {
+	f := NewYesNoBloomFilter(1000, 0.1, 500, 0.001)
+	for i := 0; i < 1000; i++ {
+		f.Add([]byte(strconv.Itoa(i)))
+	}
+
+	fps := [][]byte{}
+	for i := 1000; i < 3000; i++ {
+		if data := []byte(strconv.Itoa(i)); f.Test(data) {
+			fps = append(fps, data)
+		}
+	}
+	if len(fps) == 0 {
+		t.Fatal("Expected false positives")
+	}
+
+	for _, data := range fps {
+		if f.AddFalsePositive(data) != f {
+			t.Error("Returned YesNoBloomFilter should be the same instance")
+		}
+	}
+
+	// Suppressed false positives are no longer members, so they aren't
+	// recorded again.
+	f.AddFalsePositive(fps[0])
+
+	if count := f.FalsePositives(); count != uint(len(fps)) {
+		t.Errorf("Expected %d, got %d", len(fps), count)
+	}
+
+	for _, data := range fps {
+		if f.Test(data) {
+			t.Errorf("`%s` should not be a member", data)
+		}
+	}
+
+	fns := 0
+	for i := 0; i < 1000; i++ {
+		if !f.Test([]byte(strconv.Itoa(i))) {
+			fns++
+		}
+	}
+	if fns > 10 {
+		t.Errorf("Expected at most 10 false negatives, got %d", fns)
+	}
+	// Recorded false positives can't be removed, so adding them later doesn't
+	// make them members.
+	f.Add(fps[0])
+	if f.Test(fps[0]) {
+		t.Errorf("`%s` should not be a member", fps[0])
+	}
+}
+
+// Ensures that Reset clears both filters.
+func TestYesNoReset(t *testing.T) {
+	f := NewYesNoBloomFilter(100, 0.1, 10, 0.01)
+	f.Add([]byte(`a`))
+	f.AddFalsePositive([]byte(`a`))
+
+	if f.Reset() != f {
+		t.Error("Returned YesNoBloomFilter should be the same instance")
+	}
+
+	if count := f.Count(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	if count := f.FalsePositives(); count != 0 {
+		t.Errorf("Expected 0, got %d", count)
+	}
+
+	f.Add([]byte(`a`))
+	if !f.Test([]byte(`a`)) {
+		t.Error("`a` should be a member")
+	}
+}
+
+func BenchmarkYesNoTest(b *testing.B) {
+	b.StopTimer()
+	f := NewYesNoBloomFilter(100000, 0.1, 1000, 0.01)
+	data := make([][]byte, b.N)
+	for i := 0; i < b.N; i++ {
+		data[i] = []byte(strconv.Itoa(i))
+	}
+	b.StartTimer()
+
+	for n := 0; n < b.N; n++ {
+		f.Test(data[n])
+	}
+}